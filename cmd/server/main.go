@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors" // Import errors package for As
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
@@ -50,13 +51,27 @@ func main() {
 	// Initialize Asynq Client (Task Queue)
 	taskQueueClient := queue.NewAsynqClient(cfg)
 	// defer taskQueueClient.Close() // Add Close method to interface and call here if needed
+	taskInspector := queue.NewAsynqInspector(cfg) // 用于查看和重试失败任务
+	if closer, ok := taskInspector.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
 
 	// Initialize File Storage
-	fileStorage, err := storage.NewLocalStorage(cfg)
+	localStorage, err := storage.NewLocalStorage(cfg)
 	if err != nil {
 		logger.Error("本地文件存储初始化失败", "error", err)
 		os.Exit(1)
 	}
+	var fileStorage service.FileStorage = localStorage
+	if cfg.FileEncryptionEnabled() {
+		// 启用静态加密时，用 EncryptedStorage 包装本地存储
+		encryptedStorage, err := storage.NewEncryptedStorage(localStorage, postgres.NewPostgresFileKeyRepository(dbPool), cfg)
+		if err != nil {
+			logger.Error("文件加密存储初始化失败", "error", err)
+			os.Exit(1)
+		}
+		fileStorage = encryptedStorage
+	}
 
 	// Initialize LLM Provider
 	llmProvider, err := llm.NewOpenAIProvider(cfg)
@@ -78,22 +93,57 @@ func main() {
 	vectorRepo := pgvector.NewPGVectorRepository(dbPool)
 	taskRepo := postgres.NewPostgresTaskRepository(dbPool)
 	// Access the underlying Pool from the custom DB type
-	userRepo := postgres.NewPostgresUserRepository(dbPool.Pool)                 // Initialize UserRepository
-	configRepo := postgres.NewPostgresConfigRepository(dbPool.Pool)             // Initialize ConfigRepository
-	structuredMemoryRepo := postgres.NewStructuredMemoryRepository(dbPool.Pool) // Initialize StructuredMemoryRepository
+	userRepo := postgres.NewPostgresUserRepository(dbPool.Pool)            // Initialize UserRepository
+	configRepo := postgres.NewPostgresConfigRepository(dbPool.Pool)        // Initialize ConfigRepository
+	structuredMemoryRepo := postgres.NewStructuredMemoryRepository(dbPool) // Initialize StructuredMemoryRepository
+	uploadSessionRepo := postgres.NewPostgresUploadSessionRepository(dbPool)
+	taskFailureRepo := postgres.NewPostgresTaskFailureRepository(dbPool)
+	messageSearchRepo := pgvector.NewPGMessageSearchRepository(dbPool)
+	personaRepo := postgres.NewPostgresPersonaRepository(dbPool)
+	memoryEmbeddingRepo := pgvector.NewPGMemoryEmbeddingRepository(dbPool)
+	memorySuggestionRepo := postgres.NewPostgresMemorySuggestionRepository(dbPool)
+	graphMemoryRepo := postgres.NewPostgresGraphMemoryRepository(dbPool)
+	eventRepo := postgres.NewPostgresEventRepository(dbPool)
 
 	// Initialize Services
 	ragService := service.NewRAGService(vectorRepo, embeddingProvider) // Initialize RAGService
 	// TODO: Initialize MemoryService when available
-	chatService := service.NewChatService(chatRepo, llmProvider, ragService /*, memoryService */) // Inject RAGService
-	fileService := service.NewFileService(fileStorage, docRepo, taskRepo, taskQueueClient, vectorRepo)
-	authService := service.NewAuthService(userRepo, cfg)                                // Initialize AuthService
-	configService := service.NewConfigService(configRepo)                               // Initialize ConfigService
-	structuredMemoryService := service.NewStructuredMemoryService(structuredMemoryRepo) // Initialize StructuredMemoryService
+	eventBusService := service.NewEventBusService(eventRepo, taskQueueClient, nil) // webhook 由 Worker 投递，这里只负责入队
+	var eventPublisher service.EventPublisher                                      // nil 表示不发布 dreamhub.* 事件
+	if cfg.EventBusPublishInternal {
+		eventPublisher = eventBusService
+	}
+	titleService := service.NewConversationTitleService(chatRepo, llmProvider, taskQueueClient) // 标题由 Worker 生成，这里只负责入队
+	messageSearchService := service.NewMessageSearchService(messageSearchRepo, chatRepo, embeddingProvider, taskQueueClient, cfg)
+	conversationTransferService := service.NewConversationTransferService(chatRepo, docRepo, fileStorage, postgres.NewPostgresConversationImportFileRepository(dbPool), taskQueueClient, taskInspector, messageSearchService, cfg)
+	personaService := service.NewPersonaService(personaRepo)
+	memoryContextService := service.NewMemoryContextService(structuredMemoryRepo, memoryEmbeddingRepo, embeddingProvider, cfg)
+	// 记忆由 Worker 提取，这里负责入队和处理用户对建议的批准或拒绝
+	memoryExtractionService := service.NewMemoryExtractionService(chatRepo, structuredMemoryRepo, memorySuggestionRepo, llmProvider, taskQueueClient, eventPublisher, cfg)
+	graphMemoryService := service.NewGraphMemoryService(graphMemoryRepo)
+	var graphRecorder service.GraphRecorder // nil 表示不自动记录图记忆
+	if cfg.GraphMemoryAutoRecord {
+		graphRecorder = graphMemoryService
+	}
+	chatService := service.NewChatService(chatRepo, llmProvider, ragService, titleService, messageSearchService, personaService, memoryContextService, memoryExtractionService, graphRecorder, eventPublisher /*, memoryService */) // Inject RAGService
+	fileService := service.NewFileService(fileStorage, docRepo, taskRepo, taskQueueClient, vectorRepo, cfg)
+	resumableUploadService := service.NewResumableUploadService(uploadSessionRepo, fileStorage, fileService)
+	taskAdminService := service.NewTaskAdminService(taskInspector, taskFailureRepo, docRepo, taskQueueClient)
+	authService := service.NewAuthService(userRepo, cfg)                                                // Initialize AuthService
+	configService := service.NewConfigService(configRepo)                                               // Initialize ConfigService
+	structuredMemoryService := service.NewStructuredMemoryService(structuredMemoryRepo, eventPublisher) // Initialize StructuredMemoryService
 
 	// Initialize API Handlers
 	chatHandler := api.NewChatHandler(chatService)
-	fileHandler := api.NewFileHandler(fileService)
+	searchHandler := api.NewSearchHandler(messageSearchService)
+	personaHandler := api.NewPersonaHandler(personaService)
+	memorySuggestionHandler := api.NewMemorySuggestionHandler(memoryExtractionService)
+	graphMemoryHandler := api.NewGraphMemoryHandler(graphMemoryService)
+	eventBusHandler := api.NewEventBusHandler(eventBusService, cfg.EventStreamPollInterval)
+	conversationTransferHandler := api.NewConversationTransferHandler(conversationTransferService, cfg.ConversationImportMaxSizeBytes)
+	fileHandler := api.NewFileHandler(fileService, cfg.MaxUploadSizeBytes)
+	resumableUploadHandler := api.NewResumableUploadHandler(resumableUploadService)
+	taskAdminHandler := api.NewTaskAdminHandler(taskAdminService)
 	authHandler := api.NewAuthHandler(authService)                 // Initialize AuthHandler
 	configHandler := api.NewConfigHandler(configService)           // Initialize ConfigHandler
 	memoryHandler := api.NewMemoryHandler(structuredMemoryService) // Initialize MemoryHandler
@@ -148,25 +198,47 @@ func main() {
 		protectedRoutes.Use(authMiddleware.Authenticate()) // Apply auth middleware to this group
 		{
 			// Register protected routes from handlers
-			chatHandler.RegisterRoutes(protectedRoutes)   // Registers /chat and /chat/{id}/messages
-			fileHandler.RegisterRoutes(protectedRoutes)   // Registers /files routes
-			configHandler.RegisterRoutes(protectedRoutes) // Registers /config routes
-
-			// Register the new route for getting conversations
-			protectedRoutes.GET("/conversations", chatHandler.GetUserConversationsHandler)
+			chatHandler.RegisterRoutes(protectedRoutes)            // Registers /chat and /chat/{id}/messages
+			fileHandler.RegisterRoutes(protectedRoutes)            // Registers /files routes
+			resumableUploadHandler.RegisterRoutes(protectedRoutes) // Registers /uploads routes (resumable uploads)
+			taskAdminHandler.RegisterRoutes(protectedRoutes)       // Registers /tasks/failed routes (own failed tasks)
+			configHandler.RegisterRoutes(protectedRoutes)          // Registers /config routes
+
+			// Register conversation management routes
+			chatHandler.RegisterConversationRoutes(protectedRoutes)     // Registers /conversations routes
+			searchHandler.RegisterRoutes(protectedRoutes)               // Registers /search/messages
+			conversationTransferHandler.RegisterRoutes(protectedRoutes) // Registers /conversations export and import routes
+			personaHandler.RegisterRoutes(protectedRoutes)              // Registers /personas routes
+			memorySuggestionHandler.RegisterRoutes(protectedRoutes)     // Registers /memory/suggestions routes
+			graphMemoryHandler.RegisterRoutes(protectedRoutes)          // Registers /graph routes
+			eventBusHandler.RegisterRoutes(protectedRoutes)             // Registers /events routes (publish, SSE stream, subscriptions)
 
 			// Register Structured Memory routes
 			memoryGroup := protectedRoutes.Group("/memory/structured")
 			{
-				memoryGroup.POST("", memoryHandler.CreateMemory)        // POST /api/v1/memory/structured
-				memoryGroup.GET("", memoryHandler.GetUserMemories)      // GET /api/v1/memory/structured
-				memoryGroup.GET("/:key", memoryHandler.GetMemoryByKey)  // GET /api/v1/memory/structured/{key}
-				memoryGroup.PUT("/:key", memoryHandler.UpdateMemory)    // PUT /api/v1/memory/structured/{key}
-				memoryGroup.DELETE("/:key", memoryHandler.DeleteMemory) // DELETE /api/v1/memory/structured/{key}
+				memoryGroup.POST("", memoryHandler.CreateMemory)                 // POST /api/v1/memory/structured
+				memoryGroup.GET("", memoryHandler.GetUserMemories)               // GET /api/v1/memory/structured
+				memoryGroup.GET("/export", memoryHandler.ExportMemories)         // GET /api/v1/memory/structured/export
+				memoryGroup.POST("/import", memoryHandler.ImportMemories)        // POST /api/v1/memory/structured/import
+				memoryGroup.POST("/batch", memoryHandler.BatchMemories)          // POST /api/v1/memory/structured/batch
+				memoryGroup.GET("/:key", memoryHandler.GetMemoryByKey)           // GET /api/v1/memory/structured/{key}
+				memoryGroup.PUT("/:key", memoryHandler.UpdateMemory)             // PUT /api/v1/memory/structured/{key}
+				memoryGroup.DELETE("/:key", memoryHandler.DeleteMemory)          // DELETE /api/v1/memory/structured/{key}
+				memoryGroup.GET("/:key/history", memoryHandler.GetMemoryHistory) // GET /api/v1/memory/structured/{key}/history
+				memoryGroup.POST("/:key/revert", memoryHandler.RevertMemory)     // POST /api/v1/memory/structured/{key}/revert
 			}
 
 			// Register other protected handlers here...
 		}
+
+		// Group for admin-only routes (ADMIN_USER_IDS)
+		adminRoutes := apiV1.Group("/admin")
+		adminRoutes.Use(authMiddleware.Authenticate(), api.RequireAdmin(cfg.AdminUserIDs))
+		{
+			taskAdminHandler.RegisterAdminRoutes(adminRoutes) // Registers /admin/tasks/failed routes (all users)
+			// Runtime metrics (expvar), including asynq_queue_depth for the interactive and bulk queues
+			adminRoutes.GET("/debug/vars", gin.WrapH(expvar.Handler())) // GET /api/v1/admin/debug/vars
+		}
 	}
 	logger.Info("API 路由注册完成。")
 
@@ -2,25 +2,52 @@ package main
 
 import (
 	"context"
+	"errors"
+	"math/rand/v2"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"              // Import task type registry
+	"github.com/soaringjerry/dreamhub/internal/repository"          // Import repository interfaces
 	"github.com/soaringjerry/dreamhub/internal/repository/pgvector" // Import pgvector repo impl
 	"github.com/soaringjerry/dreamhub/internal/repository/postgres" // Import postgres repo impl
+	"github.com/soaringjerry/dreamhub/internal/service"             // Import service interfaces
 	"github.com/soaringjerry/dreamhub/internal/service/embedding"   // Import embedding provider impl
+	"github.com/soaringjerry/dreamhub/internal/service/importer"    // Import message importers
+	"github.com/soaringjerry/dreamhub/internal/service/llm"         // Import LLM provider impl
+	"github.com/soaringjerry/dreamhub/internal/service/ocr"         // Import OCR impl
+	"github.com/soaringjerry/dreamhub/internal/service/queue"       // Import queue client impl
 	"github.com/soaringjerry/dreamhub/internal/service/storage"     // Import storage impl
+	"github.com/soaringjerry/dreamhub/internal/service/webhook"     // Import webhook sender impl
+	"github.com/soaringjerry/dreamhub/internal/service/webpage"     // Import web page fetcher impl
 	"github.com/soaringjerry/dreamhub/internal/worker/handlers"     // Import handlers
 	"github.com/soaringjerry/dreamhub/pkg/config"                   // 导入 config 包
 	"github.com/soaringjerry/dreamhub/pkg/logger"                   // 导入 logger 包
 	"github.com/tmc/langchaingo/textsplitter"                       // Import textsplitter
 )
 
-// TODO: 将任务类型定义移到更合适的位置 (e.g., internal/tasks or internal/entity)
 const (
-	// TypeEmbedding 是用于生成 embedding 的任务类型。
-	TypeEmbedding = "embedding:generate"
+	// recrawlCheckInterval 是检查到期 URL 文档的周期。
+	recrawlCheckInterval = time.Minute
+	// recrawlBatchSize 是每个周期最多领取的 URL 文档数量。
+	recrawlBatchSize = 100
+	// ocrRetryBaseDelay 是 OCR 任务重试的基础间隔，第 n 次重试等待 (n+1) 倍。
+	// OCR 占用大量 CPU，失败后不宜像普通任务那样快速重试。
+	ocrRetryBaseDelay = 2 * time.Minute
+	// throttledRetryDelay 是因用户并发上限被推迟的任务重新执行前的等待时间 (另加最多同样长的随机抖动)。
+	throttledRetryDelay = 5 * time.Second
+	// legacyQueueWeight 是 default 队列的权重，用于处理引入队列优先级之前入队的任务。
+	legacyQueueWeight = 1
+	// maintenanceMaxRetry 是定时维护任务的重试次数，失败的维护任务会在下一个调度周期重新执行。
+	maintenanceMaxRetry = 1
+	// maintenanceUniqueTTL 是定时维护任务的去重时间窗口。每个 Worker 实例都运行 Scheduler，
+	// 同一调度时刻只有第一个实例的任务能入队。
+	maintenanceUniqueTTL = 5 * time.Minute
+	// maintenanceResultRetention 是维护任务完成后在 Asynq 中保留执行结果的时长。
+	maintenanceResultRetention = 7 * 24 * time.Hour
 )
 
 func main() {
@@ -45,11 +72,28 @@ func main() {
 	defer dbPool.Close()
 
 	// Initialize File Storage
-	fileStorage, err := storage.NewLocalStorage(cfg)
+	localStorage, err := storage.NewLocalStorage(cfg)
 	if err != nil {
 		logger.Error("本地文件存储初始化失败", "error", err)
 		os.Exit(1)
 	}
+	var fileStorage service.FileStorage = localStorage
+	if cfg.FileEncryptionEnabled() {
+		// 启用静态加密时，用 EncryptedStorage 包装本地存储
+		encryptedStorage, err := storage.NewEncryptedStorage(localStorage, postgres.NewPostgresFileKeyRepository(dbPool), cfg)
+		if err != nil {
+			logger.Error("文件加密存储初始化失败", "error", err)
+			os.Exit(1)
+		}
+		fileStorage = encryptedStorage
+
+		// 使用当前主密钥重新包装旧主密钥下的数据密钥 (密钥轮换)
+		go func() {
+			if _, _, err := encryptedStorage.RotateKeys(ctx); err != nil {
+				logger.ErrorContext(ctx, "文件数据密钥轮换失败", "error", err)
+			}
+		}()
+	}
 
 	// Initialize Embedding Provider
 	embeddingProvider, err := embedding.NewOpenAIEmbeddingProvider(cfg)
@@ -58,10 +102,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Initialize LLM Provider (用于生成对话标题)
+	llmProvider, err := llm.NewOpenAIProvider(cfg)
+	if err != nil {
+		logger.Error("LLM Provider 初始化失败", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize Repositories
+	chatRepo := postgres.NewPostgresChatRepository(dbPool)
 	docRepo := postgres.NewPostgresDocumentRepository(dbPool)
 	vectorRepo := pgvector.NewPGVectorRepository(dbPool)
 	taskRepo := postgres.NewPostgresTaskRepository(dbPool) // Initialize TaskRepo
+	taskFailureRepo := postgres.NewPostgresTaskFailureRepository(dbPool)
+	uploadSessionRepo := postgres.NewPostgresUploadSessionRepository(dbPool)
 
 	// Initialize Text Splitter
 	// TODO: Read ChunkSize and ChunkOverlap from config if defined
@@ -75,6 +129,39 @@ func main() {
 	)
 	logger.Info("文本分割器初始化完成。", "chunk_size", chunkSize, "chunk_overlap", chunkOverlap)
 
+	// Initialize Task Queue Client (URL 抓取和 OCR 需要在 Worker 中继续入队任务)
+	taskQueueClient := queue.NewAsynqClient(cfg)
+	if closer, ok := taskQueueClient.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	// Initialize OCR (找不到 tesseract 时禁用 OCR，图片和扫描版 PDF 会被标记为失败)
+	var ocrProvider service.OCRProvider
+	var ocrQueue service.TaskQueueClient
+	if cfg.OCREnabled {
+		ocrProvider, err = ocr.NewTesseractOCR(cfg)
+		if err != nil {
+			logger.Warn("OCR 初始化失败，OCR 已禁用", "error", err)
+		} else {
+			ocrQueue = taskQueueClient
+		}
+	}
+	pdfExtractor, err := ocr.NewPDFToTextExtractor(cfg)
+	if err != nil {
+		logger.Warn("PDF 文本提取器初始化失败，PDF 将直接进行 OCR", "error", err)
+	}
+
+	var graphRecorder service.GraphRecorder // nil 表示不自动记录图记忆
+	if cfg.GraphMemoryAutoRecord {
+		graphRecorder = service.NewGraphMemoryService(postgres.NewPostgresGraphMemoryRepository(dbPool))
+	}
+	// Worker 执行 webhook 投递；文档处理和记忆提取发布的事件同样需要入队投递，因此传入任务队列
+	eventBusService := service.NewEventBusService(postgres.NewPostgresEventRepository(dbPool), taskQueueClient, webhook.NewHTTPSender(cfg))
+	var eventPublisher service.EventPublisher // nil 表示不发布 dreamhub.* 事件
+	if cfg.EventBusPublishInternal {
+		eventPublisher = eventBusService
+	}
+
 	// Initialize Task Handler
 	embeddingHandler := handlers.NewEmbeddingTaskHandler(
 		fileStorage,
@@ -82,9 +169,40 @@ func main() {
 		vectorRepo,
 		taskRepo, // Pass TaskRepo
 		embeddingProvider,
-		textSplitter, // Pass TextSplitter
+		textSplitter,       // Pass TextSplitter
+		importer.Default(), // 邮件归档和聊天导出按消息分块
+		pdfExtractor,
+		ocrQueue,       // nil 表示 OCR 未启用
+		graphRecorder,  // nil 表示不记录图记忆
+		eventPublisher, // nil 表示不发布事件
+	)
+
+	fetchURLHandler := handlers.NewFetchURLTaskHandler(
+		webpage.NewHTTPFetcher(cfg),
+		fileStorage,
+		docRepo,
+		vectorRepo,
+		taskQueueClient,
 	)
 
+	// 本地目录同步通过 FileService 导入文件，与 API 上传走相同的校验和处理流程
+	fileService := service.NewFileService(fileStorage, docRepo, taskRepo, taskQueueClient, vectorRepo, cfg)
+	folderSyncService := service.NewFolderSyncService(fileService, docRepo, cfg)
+
+	// 定时维护任务需要检查任务在队列中的状态
+	taskInspector := queue.NewAsynqInspector(cfg)
+	if closer, ok := taskInspector.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+	importFileRepo := postgres.NewPostgresConversationImportFileRepository(dbPool)
+	maintenanceService := service.NewMaintenanceService(fileStorage, docRepo, uploadSessionRepo, taskRepo, taskFailureRepo, vectorRepo, importFileRepo, taskInspector, taskQueueClient, cfg)
+
+	conversationTitleService := service.NewConversationTitleService(chatRepo, llmProvider, nil)
+	memoryExtractionService := service.NewMemoryExtractionService(chatRepo, postgres.NewStructuredMemoryRepository(dbPool), postgres.NewPostgresMemorySuggestionRepository(dbPool), llmProvider, nil, eventPublisher, cfg)
+	// 导入的消息需要入队生成搜索向量，因此传入任务队列
+	messageSearchService := service.NewMessageSearchService(pgvector.NewPGMessageSearchRepository(dbPool), chatRepo, embeddingProvider, taskQueueClient, cfg)
+	conversationTransferService := service.NewConversationTransferService(chatRepo, docRepo, fileStorage, importFileRepo, taskQueueClient, taskInspector, messageSearchService, cfg)
+
 	logger.Info("Worker 依赖初始化完成。")
 
 	// --- 2. Setup Asynq Server ---
@@ -98,31 +216,134 @@ func main() {
 		redisConnOpt,
 		asynq.Config{
 			Concurrency: cfg.WorkerConcurrency,
+			// 按权重从各队列取任务：用户直接触发的任务优先，批量任务也不会被饿死
+			Queues: map[string]int{
+				entity.TaskPriorityInteractive.QueueName(): cfg.QueueWeightInteractive,
+				entity.TaskPriorityBulk.QueueName():        cfg.QueueWeightBulk,
+				"default":                                  legacyQueueWeight,
+			},
+			// 因用户并发上限被推迟不算失败，不消耗重试次数
+			IsFailure: func(err error) bool {
+				return !errors.Is(err, entity.ErrTaskThrottled)
+			},
 			ErrorHandler: asynq.ErrorHandlerFunc(func(ctx context.Context, task *asynq.Task, err error) {
+				if errors.Is(err, entity.ErrTaskThrottled) {
+					return
+				}
+				taskID, _ := asynq.GetTaskID(ctx)
+				retried, _ := asynq.GetRetryCount(ctx)
+				maxRetry, _ := asynq.GetMaxRetry(ctx)
+				// 不可重试或重试次数用尽的任务会被 Asynq 移入死信队列 (archived)，可以通过 /tasks/failed 接口查看、重试或删除
 				logger.ErrorContext(ctx, "Worker 处理任务失败",
 					"type", task.Type(),
+					"task_id", taskID,
 					"error", err,
+					"retry", retried,
+					"max_retry", maxRetry,
+					"dead_lettered", errors.Is(err, asynq.SkipRetry) || retried >= maxRetry,
 				)
+				recordTaskFailure(ctx, taskFailureRepo, task, err)
 			}),
+			RetryDelayFunc: func(n int, err error, task *asynq.Task) time.Duration {
+				if errors.Is(err, entity.ErrTaskThrottled) {
+					return throttledRetryDelay + rand.N(throttledRetryDelay)
+				}
+				if task.Type() == entity.TaskTypeOCR {
+					return time.Duration(n+1) * ocrRetryBaseDelay
+				}
+				return asynq.DefaultRetryDelayFunc(n, err, task)
+			},
 			// Logger: logger.NewAsynqLogger(logger.GetLogger()), // Optional custom logger
 		},
 	)
 
 	// --- 3. Register Task Handlers ---
 	mux := asynq.NewServeMux()
+	mux.Use(handlers.NewUserConcurrencyLimiter(cfg.WorkerPerUserConcurrency).Middleware)
 	// Register the actual handler
-	mux.Handle(TypeEmbedding, embeddingHandler)
+	mux.Handle(entity.TaskTypeEmbedding, embeddingHandler)
+	mux.Handle(entity.TaskTypeFetchURL, fetchURLHandler)
+	if ocrProvider != nil {
+		mux.Handle(entity.TaskTypeOCR, handlers.NewOCRTaskHandler(ocrProvider, fileStorage, embeddingHandler))
+	}
+	maintenanceHandler := handlers.NewMaintenanceTaskHandler(maintenanceService)
+	mux.Handle(entity.TaskTypeMaintenanceOrphanFiles, maintenanceHandler)
+	mux.Handle(entity.TaskTypeMaintenanceTaskRetention, maintenanceHandler)
+	mux.Handle(entity.TaskTypeMaintenanceStaleDocuments, maintenanceHandler)
+	mux.Handle(entity.TaskTypeMaintenanceVectorIndex, maintenanceHandler)
+	mux.Handle(entity.TaskTypeMaintenanceExpiredUploads, maintenanceHandler)
+	mux.Handle(entity.TaskTypeConversationTitle, handlers.NewConversationTitleTaskHandler(conversationTitleService))
+	mux.Handle(entity.TaskTypeMessageEmbedding, handlers.NewMessageEmbeddingTaskHandler(messageSearchService))
+	mux.Handle(entity.TaskTypeConversationImport, handlers.NewConversationImportTaskHandler(conversationTransferService))
+	mux.Handle(entity.TaskTypeMemoryExtraction, handlers.NewMemoryExtractionTaskHandler(memoryExtractionService))
+	mux.Handle(entity.TaskTypeEventDelivery, handlers.NewEventDeliveryTaskHandler(eventBusService))
 	// Register other handlers here...
 	logger.Info("Asynq 任务处理器注册完成。")
 
 	// --- 4. Start Asynq Server ---
-	logger.Info("Worker 准备启动...", "concurrency", cfg.WorkerConcurrency)
+	logger.Info("Worker 准备启动...", "concurrency", cfg.WorkerConcurrency, "per_user_concurrency", cfg.WorkerPerUserConcurrency,
+		"interactive_weight", cfg.QueueWeightInteractive, "bulk_weight", cfg.QueueWeightBulk)
 	if err := srv.Start(mux); err != nil {
 		logger.Error("无法启动 Worker 服务器", "error", err)
 		cancel() // Signal shutdown
 		os.Exit(1)
 	}
 
+	// 启动定时维护任务的 Scheduler
+	scheduler := asynq.NewScheduler(redisConnOpt, &asynq.SchedulerOpts{
+		Location: time.UTC,
+		EnqueueErrorHandler: func(task *asynq.Task, opts []asynq.Option, err error) {
+			if errors.Is(err, asynq.ErrDuplicateTask) {
+				return // 其他 Worker 实例已经入队
+			}
+			logger.Error("定时维护任务入队失败", "type", task.Type(), "error", err)
+		},
+	})
+	if registerMaintenanceJobs(scheduler, cfg) > 0 {
+		if err := scheduler.Start(); err != nil {
+			logger.Error("无法启动定时维护任务 Scheduler", "error", err)
+		} else {
+			defer scheduler.Shutdown()
+		}
+	}
+
+	// 定期将到期的 URL 文档重新抓取任务入队
+	go func() {
+		ticker := time.NewTicker(recrawlCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := handlers.EnqueueDueRecrawls(ctx, docRepo, taskQueueClient, recrawlBatchSize); err != nil {
+					logger.ErrorContext(ctx, "调度 URL 文档重新抓取失败", "error", err)
+				}
+			}
+		}
+	}()
+
+	// 同步监视目录：启动时先与数据库对账 (补上停机期间的变化)，之后定期重新扫描
+	if len(cfg.WatchedFolders) > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.FolderSyncInterval)
+			defer ticker.Stop()
+			for {
+				for _, folder := range cfg.WatchedFolders {
+					if _, err := folderSyncService.SyncFolder(ctx, folder.UserID, folder.Path); err != nil && ctx.Err() == nil {
+						logger.ErrorContext(ctx, "同步监视目录失败", "error", err, "path", folder.Path, "user_id", folder.UserID)
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+		logger.Info("本地目录同步已启用。", "folders", len(cfg.WatchedFolders), "interval", cfg.FolderSyncInterval)
+	}
+
 	// --- 5. Graceful Shutdown ---
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -140,6 +361,68 @@ func main() {
 	logger.Info("Worker 已成功关闭。")
 }
 
+// recordTaskFailure 记录任务的一次失败尝试，供失败任务接口展示完整的错误历史 (Asynq 只保留最后一次错误)。
+func recordTaskFailure(ctx context.Context, repo repository.TaskFailureRepository, task *asynq.Task, taskErr error) {
+	taskID, _ := asynq.GetTaskID(ctx)
+	queueName, _ := asynq.GetQueueName(ctx)
+	retried, _ := asynq.GetRetryCount(ctx)
+	ref := entity.ParseTaskPayloadRef(task.Payload())
+	failure := &entity.TaskFailure{
+		TaskID:     taskID,
+		Queue:      queueName,
+		TaskType:   task.Type(),
+		UserID:     ref.UserID,
+		DocumentID: ref.DocumentID,
+		Attempt:    retried + 1,
+		Error:      taskErr.Error(),
+		FailedAt:   time.Now(),
+	}
+	// 任务的 ctx 可能已经超时，使用独立的 ctx 写入
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := repo.RecordFailure(recordCtx, failure); err != nil {
+		logger.WarnContext(ctx, "记录任务失败历史失败", "error", err, "task_id", taskID)
+	}
+}
+
+// registerMaintenanceJobs 将已启用的定时维护任务注册到 Scheduler，返回注册成功的任务数。
+// 维护任务进入 bulk 队列，不会挤占用户直接触发的任务。
+func registerMaintenanceJobs(scheduler *asynq.Scheduler, cfg *config.Config) int {
+	jobs := []struct {
+		taskType string
+		job      config.ScheduledJob
+		timeout  time.Duration
+	}{
+		{entity.TaskTypeMaintenanceOrphanFiles, cfg.OrphanFileJob, time.Hour},
+		{entity.TaskTypeMaintenanceTaskRetention, cfg.TaskRetentionJob, 10 * time.Minute},
+		{entity.TaskTypeMaintenanceStaleDocuments, cfg.StaleDocumentJob, 10 * time.Minute},
+		{entity.TaskTypeMaintenanceVectorIndex, cfg.VectorIndexJob, 6 * time.Hour}, // REINDEX 大表耗时较长
+		{entity.TaskTypeMaintenanceExpiredUploads, cfg.ExpiredUploadJob, 10 * time.Minute},
+	}
+
+	registered := 0
+	for _, j := range jobs {
+		if !j.job.Enabled {
+			logger.Info("定时维护任务已禁用", "type", j.taskType)
+			continue
+		}
+		_, err := scheduler.Register(j.job.Cronspec, asynq.NewTask(j.taskType, nil),
+			asynq.Queue(entity.TaskPriorityBulk.QueueName()),
+			asynq.MaxRetry(maintenanceMaxRetry),
+			asynq.Timeout(j.timeout),
+			asynq.Unique(maintenanceUniqueTTL),
+			asynq.Retention(maintenanceResultRetention),
+		)
+		if err != nil {
+			logger.Error("注册定时维护任务失败，请检查 cron 表达式", "type", j.taskType, "cron", j.job.Cronspec, "error", err)
+			continue
+		}
+		logger.Info("定时维护任务已注册", "type", j.taskType, "cron", j.job.Cronspec)
+		registered++
+	}
+	return registered
+}
+
 // Placeholder function removed as it's no longer used.
 
 // TODO: Implement Asynq logger adapter if needed.
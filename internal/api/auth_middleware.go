@@ -92,3 +92,22 @@ func GetUserIDFromContext(c *gin.Context) (string, bool) {
 	userID, ok := userIDVal.(string)
 	return userID, ok
 }
+
+// RequireAdmin 返回只允许管理员通过的 Gin 中间件，必须在 Authenticate 之后使用。
+// 管理员由配置 ADMIN_USER_IDS 指定；未配置任何管理员时所有请求都会被拒绝。
+func RequireAdmin(adminUserIDs []string) gin.HandlerFunc {
+	admins := make(map[string]struct{}, len(adminUserIDs))
+	for _, id := range adminUserIDs {
+		admins[id] = struct{}{}
+	}
+	return func(c *gin.Context) {
+		userID, ok := GetUserIDFromContext(c)
+		if _, isAdmin := admins[userID]; !ok || !isAdmin {
+			err := apperr.ErrPermissionDenied("需要管理员权限")
+			logger.WarnContext(c.Request.Context(), "拒绝非管理员访问管理接口", "user_id", userID, "path", c.FullPath())
+			c.AbortWithStatusJSON(err.HTTPStatus, gin.H{"error": err})
+			return
+		}
+		c.Next()
+	}
+}
@@ -3,8 +3,12 @@ package api
 import (
 	"fmt" // Import fmt for Sscan
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
 	"github.com/soaringjerry/dreamhub/internal/service"
 	"github.com/soaringjerry/dreamhub/pkg/apperr" // 需要 apperr 来处理错误
 	"github.com/soaringjerry/dreamhub/pkg/logger"
@@ -38,7 +42,10 @@ func (h *ChatHandler) RegisterRoutes(router *gin.RouterGroup) {
 	{
 		chatGroup.POST("", h.handlePostChat) // 处理 POST /api/v1/chat
 		// chatGroup.GET("/ws", h.handleChatWebSocket) // 处理 GET /api/v1/chat/ws (未来)
-		chatGroup.GET("/:conversation_id/messages", h.handleGetMessages) // 处理 GET /api/v1/chat/{conversation_id}/messages
+		chatGroup.GET("/:conversation_id/messages", h.handleGetMessages)                               // 处理 GET /api/v1/chat/{conversation_id}/messages
+		chatGroup.POST("/:conversation_id/messages/:message_id/regenerate", h.handleRegenerateMessage) // 处理 POST /api/v1/chat/{conversation_id}/messages/{message_id}/regenerate
+		chatGroup.POST("/:conversation_id/messages/:message_id/edit", h.handleEditMessage)             // 处理 POST /api/v1/chat/{conversation_id}/messages/{message_id}/edit
+		chatGroup.PUT("/:conversation_id/active-branch", h.handleSelectBranch)                         // 处理 PUT /api/v1/chat/{conversation_id}/active-branch
 	}
 }
 
@@ -48,6 +55,35 @@ type ChatRequest struct {
 	ConversationID string `json:"conversation_id,omitempty"` // 可选，如果为空则开始新对话
 	Message        string `json:"message" binding:"required"`
 	ModelName      string `json:"model_name,omitempty"` // 新增：可选的模型名称
+	PersonaID      string `json:"persona_id,omitempty"` // 可选，切换对话使用的人设 (之后的消息沿用)
+	// GenerationOptions 可选，本次回复的生成参数 (temperature、max_tokens、top_p、stop、seed、response_format)
+	GenerationOptions *entity.GenerationOptions `json:"generation_options,omitempty"`
+	// RetrievalFilter 可选，限定 RAG 检索的范围 (例如只检索某人某段时间的邮件/聊天记录)
+	RetrievalFilter *RetrievalFilter `json:"retrieval_filter,omitempty"`
+}
+
+// RetrievalFilter 定义了按消息元数据过滤检索结果的条件，时间使用 RFC 3339 格式。
+type RetrievalFilter struct {
+	Sender     string     `json:"sender,omitempty"`      // 发送者名称或地址 (不区分大小写)
+	ThreadID   string     `json:"thread_id,omitempty"`   // 邮件会话或聊天 ID
+	SentAfter  *time.Time `json:"sent_after,omitempty"`  // 包含
+	SentBefore *time.Time `json:"sent_before,omitempty"` // 不包含
+}
+
+// toChunkFilter 校验并转换为 entity.ChunkFilter，f 为 nil 时返回 nil。
+func (f *RetrievalFilter) toChunkFilter() (*entity.ChunkFilter, *apperr.AppError) {
+	if f == nil {
+		return nil, nil
+	}
+	if f.SentAfter != nil && f.SentBefore != nil && !f.SentAfter.Before(*f.SentBefore) {
+		return nil, apperr.New(apperr.CodeValidation, "sent_after 必须早于 sent_before")
+	}
+	return &entity.ChunkFilter{
+		Sender:     strings.TrimSpace(f.Sender),
+		ThreadID:   strings.TrimSpace(f.ThreadID),
+		SentAfter:  f.SentAfter,
+		SentBefore: f.SentBefore,
+	}, nil
 }
 
 // ChatResponse 定义了聊天响应的 JSON 结构体。
@@ -56,6 +92,31 @@ type ChatResponse struct {
 	Reply          string `json:"reply"`
 }
 
+// RegenerateMessageRequest 定义了重新生成 AI 回复请求的 JSON 结构体 (请求体可以省略)。
+type RegenerateMessageRequest struct {
+	ModelName         string                    `json:"model_name,omitempty"`         // 可选的模型名称
+	GenerationOptions *entity.GenerationOptions `json:"generation_options,omitempty"` // 可选的生成参数
+}
+
+// EditMessageRequest 定义了编辑用户消息请求的 JSON 结构体。
+type EditMessageRequest struct {
+	Message           string                    `json:"message" binding:"required"`   // 编辑后的消息内容
+	ModelName         string                    `json:"model_name,omitempty"`         // 可选的模型名称
+	GenerationOptions *entity.GenerationOptions `json:"generation_options,omitempty"` // 可选的生成参数
+}
+
+// BranchResponse 定义了编辑消息或重新生成回复的响应结构体，新消息所在的分支成为对话的当前分支。
+type BranchResponse struct {
+	ConversationID string          `json:"conversation_id"`
+	Message        *entity.Message `json:"message,omitempty"` // 编辑后的用户消息 (仅编辑时返回)
+	Reply          *entity.Message `json:"reply"`             // 新生成的 AI 回复
+}
+
+// SelectBranchRequest 定义了切换对话分支请求的 JSON 结构体。
+type SelectBranchRequest struct {
+	MessageID string `json:"message_id" binding:"required"` // 要切换到的分支上的任意一条消息
+}
+
 // handlePostChat 处理非流式的聊天请求。
 func (h *ChatHandler) handlePostChat(c *gin.Context) {
 	var req ChatRequest
@@ -92,10 +153,16 @@ func (h *ChatHandler) handlePostChat(c *gin.Context) {
 	// conversationID is now string, no need to parse or use uuid.Nil
 	conversationID := req.ConversationID // Use the string directly, empty string means new conversation
 
+	filter, appErr := req.RetrievalFilter.toChunkFilter()
+	if appErr != nil {
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
 	// 调用 ChatService 处理消息，传入 ModelName
 	// Pass string conversationID directly
 	// Pass userID explicitly
-	reply, newConvID, err := h.chatService.HandleChatMessage(ctx, userID, conversationID, req.Message, req.ModelName)
+	reply, newConvID, err := h.chatService.HandleChatMessage(ctx, userID, conversationID, req.Message, req.ModelName, strings.TrimSpace(req.PersonaID), req.GenerationOptions, filter)
 	if err != nil {
 		// HandleChatMessage 内部应该已经记录了日志并包装了错误
 		// 直接使用返回的 apperr
@@ -165,9 +232,21 @@ func (h *ChatHandler) handleGetMessages(c *gin.Context) {
 	// Note: We might need to pass userID explicitly to GetConversationMessages if it needs it for authorization/filtering
 	// For now, assume the service layer handles context implicitly or doesn't need explicit userID for this call.
 
-	// Pass string conversationIDStr directly
-	// Pass userID explicitly
-	messages, err := h.chatService.GetConversationMessages(ctx, userID, conversationIDStr, limitInt, offsetInt)
+	// branch=active 时只返回当前分支上的最近 limit 条消息，否则返回所有分支的消息
+	var messages []*entity.Message
+	var err error
+	switch branch := c.Query("branch"); branch {
+	case "":
+		// Pass string conversationIDStr directly
+		// Pass userID explicitly
+		messages, err = h.chatService.GetConversationMessages(ctx, userID, conversationIDStr, limitInt, offsetInt)
+	case "active":
+		messages, err = h.chatService.GetActiveBranchMessages(ctx, userID, conversationIDStr, limitInt)
+	default:
+		appErr := apperr.New(apperr.CodeInvalidArgument, "branch 参数只能为 active").WithDetails("branch=" + branch)
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
 	if err != nil {
 		appErr, ok := err.(*apperr.AppError)
 		if !ok {
@@ -181,7 +260,110 @@ func (h *ChatHandler) handleGetMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, messages)
 }
 
-// GetUserConversationsHandler 处理获取用户所有对话列表的请求。
+// handleRegenerateMessage 处理重新生成 AI 回复的请求，新回复与原回复是兄弟节点。
+func (h *ChatHandler) handleRegenerateMessage(c *gin.Context) {
+	var req RegenerateMessageRequest
+	// 请求体可选，只有提供了请求体时才解析
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+	}
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (RegenerateMessage)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	conversationID := c.Param("conversation_id")
+	reply, err := h.chatService.RegenerateReply(c.Request.Context(), userID, conversationID, c.Param("message_id"), req.ModelName, req.GenerationOptions)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "重新生成回复时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, BranchResponse{ConversationID: conversationID, Reply: reply})
+}
+
+// handleEditMessage 处理编辑用户消息的请求：创建原消息的兄弟节点并生成新的回复。
+func (h *ChatHandler) handleEditMessage(c *gin.Context) {
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c.Request.Context(), "无效的编辑消息请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (EditMessage)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	conversationID := c.Param("conversation_id")
+	edited, reply, err := h.chatService.EditMessage(c.Request.Context(), userID, conversationID, c.Param("message_id"), req.Message, req.ModelName, req.GenerationOptions)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "编辑消息时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, BranchResponse{ConversationID: conversationID, Message: edited, Reply: reply})
+}
+
+// handleSelectBranch 处理切换对话当前分支的请求，返回更新后的对话。
+func (h *ChatHandler) handleSelectBranch(c *gin.Context) {
+	var req SelectBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (SelectBranch)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	conversation, err := h.chatService.SelectBranch(c.Request.Context(), userID, c.Param("conversation_id"), req.MessageID)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "切换对话分支时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, conversation)
+}
+
+// RegisterConversationRoutes 将对话管理相关的路由注册到 Gin 引擎。
+func (h *ChatHandler) RegisterConversationRoutes(router *gin.RouterGroup) {
+	conversationGroup := router.Group("/conversations")
+	{
+		conversationGroup.GET("", h.GetUserConversationsHandler)                              // GET /api/v1/conversations?archived=...&pinned=...&limit=...&offset=...
+		conversationGroup.GET("/:conversation_id", h.handleGetConversation)                   // GET /api/v1/conversations/{conversation_id}
+		conversationGroup.PATCH("/:conversation_id", h.handleUpdateConversation)              // PATCH /api/v1/conversations/{conversation_id}
+		conversationGroup.DELETE("/:conversation_id", h.handleDeleteConversation)             // DELETE /api/v1/conversations/{conversation_id}
+		conversationGroup.POST("/:conversation_id/title/regenerate", h.handleRegenerateTitle) // POST /api/v1/conversations/{conversation_id}/title/regenerate
+	}
+}
+
+// GetUserConversationsHandler 处理获取用户对话列表的请求。
+// 默认不包含已归档的对话 (archived=all 列出全部)，响应体为对话数组，符合条件的总数通过 X-Total-Count 响应头返回。
 func (h *ChatHandler) GetUserConversationsHandler(c *gin.Context) {
 	// 从认证中间件设置的上下文中获取 UserID
 	userID, ok := GetUserIDFromContext(c)
@@ -194,8 +376,39 @@ func (h *ChatHandler) GetUserConversationsHandler(c *gin.Context) {
 	logger.DebugContext(c.Request.Context(), "获取用户对话列表", "user_id", userID)
 	ctx := c.Request.Context()
 
+	// 获取分页参数
+	limit, errL := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, errO := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if errL != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if errO != nil || offset < 0 {
+		offset = 0
+	}
+
+	filter := &entity.ConversationFilter{}
+	archivedFalse := false
+	filter.Archived = &archivedFalse
+	if archived := c.Query("archived"); archived != "" {
+		var appErr *apperr.AppError
+		if filter.Archived, appErr = parseOptionalBool("archived", archived, true); appErr != nil {
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+	}
+	if pinned := c.Query("pinned"); pinned != "" {
+		var appErr *apperr.AppError
+		if filter.Pinned, appErr = parseOptionalBool("pinned", pinned, false); appErr != nil {
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+	}
+
 	// 调用 ChatService 获取对话列表
-	conversations, err := h.chatService.GetUserConversations(ctx, userID)
+	conversations, total, err := h.chatService.GetUserConversations(ctx, userID, filter, limit, offset)
 	if err != nil {
 		// GetUserConversations 内部应该已经记录了日志并包装了错误
 		appErr, ok := err.(*apperr.AppError)
@@ -209,9 +422,121 @@ func (h *ChatHandler) GetUserConversationsHandler(c *gin.Context) {
 
 	// 返回对话列表 (entity.Conversation 结构体已经有 json tag)
 	// 如果列表为空，也会返回一个空的 JSON 数组 `[]`
+	c.Header("X-Total-Count", strconv.Itoa(total))
 	c.JSON(http.StatusOK, conversations)
 }
 
+// parseOptionalBool 解析 true/false 查询参数；allowAll 为 true 时 "all" 表示不过滤 (返回 nil)。
+func parseOptionalBool(name string, value string, allowAll bool) (*bool, *apperr.AppError) {
+	if allowAll && value == "all" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, fmt.Sprintf("%s 参数只能是 true 或 false", name))
+	}
+	return &b, nil
+}
+
+// handleGetConversation 处理获取单个对话的请求。
+func (h *ChatHandler) handleGetConversation(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (GetConversation)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	conversation, err := h.chatService.GetConversation(c.Request.Context(), userID, c.Param("conversation_id"))
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "获取对话时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, conversation)
+}
+
+// handleUpdateConversation 处理修改对话标题、归档、置顶状态和人设的请求 (只修改请求体中出现的字段)。
+func (h *ChatHandler) handleUpdateConversation(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (UpdateConversation)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	var req entity.ConversationUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c.Request.Context(), "无效的修改对话请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	conversation, err := h.chatService.UpdateConversation(c.Request.Context(), userID, c.Param("conversation_id"), &req)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "修改对话时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, conversation)
+}
+
+// handleDeleteConversation 处理删除对话及其所有消息的请求。
+func (h *ChatHandler) handleDeleteConversation(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (DeleteConversation)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	if err := h.chatService.DeleteConversation(c.Request.Context(), userID, c.Param("conversation_id")); err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "删除对话时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "对话已删除"})
+}
+
+// handleRegenerateTitle 处理重新生成对话标题的请求。标题在后台生成，完成后可通过 GET 对话接口获取。
+func (h *ChatHandler) handleRegenerateTitle(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (RegenerateTitle)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	taskID, err := h.chatService.RegenerateConversationTitle(c.Request.Context(), userID, c.Param("conversation_id"))
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "重新生成对话标题时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	// HTTP 202 Accepted 表示标题在后台生成中
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "对话标题正在后台生成中...",
+		"task_id": taskID,
+	})
+}
+
 // handleChatWebSocket 处理 WebSocket 连接请求 (未来实现)。
 // func (h *ChatHandler) handleChatWebSocket(c *gin.Context) {
 //  // TODO: 实现 WebSocket 逻辑
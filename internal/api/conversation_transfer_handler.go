@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// ConversationTransferHandler 负责处理对话导出和导入相关的 API 请求。
+type ConversationTransferHandler struct {
+	transferService service.ConversationTransferService
+	maxImportSize   int64 // 上传的导入文件的最大字节数，用于限制请求体大小
+}
+
+// NewConversationTransferHandler 创建一个新的 ConversationTransferHandler 实例。
+func NewConversationTransferHandler(ts service.ConversationTransferService, maxImportSize int64) *ConversationTransferHandler {
+	return &ConversationTransferHandler{
+		transferService: ts,
+		maxImportSize:   maxImportSize,
+	}
+}
+
+// RegisterRoutes 将对话导出和导入相关的路由注册到 Gin 引擎。
+func (h *ConversationTransferHandler) RegisterRoutes(router *gin.RouterGroup) {
+	conversationGroup := router.Group("/conversations")
+	{
+		conversationGroup.GET("/export", h.handleExportAll)                           // GET /api/v1/conversations/export?format=markdown|json|zip
+		conversationGroup.GET("/:conversation_id/export", h.handleExportConversation) // GET /api/v1/conversations/{conversation_id}/export?format=...
+		conversationGroup.POST("/import", h.handleImport)                             // POST /api/v1/conversations/import (multipart/form-data)
+		conversationGroup.GET("/import/:task_id", h.handleGetImportStatus)            // GET /api/v1/conversations/import/{task_id}
+	}
+}
+
+// handleExportConversation 处理导出单个对话的请求，响应为可下载的文件。
+func (h *ConversationTransferHandler) handleExportConversation(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (ExportConversation)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	file, err := h.transferService.ExportConversation(c.Request.Context(), userID, c.Param("conversation_id"), c.DefaultQuery("format", entity.ExportFormatMarkdown))
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "导出对话时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	writeExportFile(c, file)
+}
+
+// handleExportAll 处理导出用户所有对话的请求，响应为可下载的文件。
+func (h *ConversationTransferHandler) handleExportAll(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (ExportAllConversations)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	file, err := h.transferService.ExportAllConversations(c.Request.Context(), userID, c.DefaultQuery("format", entity.ExportFormatZip))
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "导出对话时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	writeExportFile(c, file)
+}
+
+// writeExportFile 以附件形式返回导出文件。
+func writeExportFile(c *gin.Context, file *entity.ExportFile) {
+	c.Header("Content-Disposition", contentDisposition("attachment", file.Filename))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, file.ContentType, file.Data)
+}
+
+// handleImport 处理上传 ChatGPT 导出文件的请求 (multipart/form-data，字段名 file)。
+// 导入在后台进行，响应中的 task_id 用于查询导入结果。
+func (h *ConversationTransferHandler) handleImport(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (ImportConversations)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	ctx := c.Request.Context()
+
+	// 限制请求体大小，避免解析超大的 multipart 请求
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxImportSize+multipartOverhead)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logger.WarnContext(ctx, "导入请求体超出大小限制", "user_id", userID, "limit", maxBytesErr.Limit)
+			appErr := apperr.New(apperr.CodeValidation, "导入文件大小超出上限").
+				WithDetails(fmt.Sprintf("max_import_size_bytes=%d", h.maxImportSize)).
+				WithHTTPStatus(http.StatusRequestEntityTooLarge)
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+		logger.WarnContext(ctx, "无法获取上传的导入文件", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "缺少文件或表单字段名错误 ('file')")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	// 目前只支持 ChatGPT 的导出格式，source 字段为以后支持其他平台预留
+	if source := c.DefaultPostForm("source", "chatgpt"); source != "chatgpt" {
+		appErr := apperr.New(apperr.CodeInvalidArgument, "不支持的导入来源").WithDetails("source=" + source + "，可选值: chatgpt")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	fileData, err := fileHeader.Open()
+	if err != nil {
+		logger.ErrorContext(ctx, "打开上传的导入文件失败", "error", err, "filename", fileHeader.Filename)
+		appErr := apperr.Wrap(err, apperr.CodeInternal, "无法处理上传的文件")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	defer fileData.Close()
+
+	taskID, err := h.transferService.StartChatGPTImport(ctx, userID, fileHeader.Filename, fileHeader.Size, fileData)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "导入对话时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	// HTTP 202 Accepted 表示导入在后台进行中
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "文件上传成功，正在后台导入对话...",
+		"task_id": taskID,
+	})
+}
+
+// handleGetImportStatus 处理查询导入任务状态的请求。
+func (h *ConversationTransferHandler) handleGetImportStatus(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (GetImportStatus)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	status, err := h.transferService.GetImportStatus(c.Request.Context(), userID, c.Param("task_id"))
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "查询导入状态时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
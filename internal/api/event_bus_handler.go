@@ -0,0 +1,393 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// eventStreamBatchSize 是 SSE 连接每次读取的最大事件数，读满时立即读取下一批。
+	eventStreamBatchSize = 100
+	// eventStreamKeepAlive 是 SSE 连接空闲时发送注释行的间隔，避免代理关闭空闲连接。
+	eventStreamKeepAlive = 15 * time.Second
+	// eventStreamRetry 是建议客户端断开后重连的等待时间 (毫秒)。
+	eventStreamRetry = 3000
+)
+
+// EventBusHandler 负责处理事件总线 (发布事件、SSE 推送和订阅) 相关的 API 请求。
+type EventBusHandler struct {
+	eventBus     service.EventBusService
+	pollInterval time.Duration // SSE 连接检查新事件的间隔
+}
+
+// NewEventBusHandler 创建一个新的 EventBusHandler 实例。
+func NewEventBusHandler(eb service.EventBusService, pollInterval time.Duration) *EventBusHandler {
+	return &EventBusHandler{
+		eventBus:     eb,
+		pollInterval: pollInterval,
+	}
+}
+
+// RegisterRoutes 将事件总线相关的路由注册到 Gin 引擎。
+func (h *EventBusHandler) RegisterRoutes(router *gin.RouterGroup) {
+	eventGroup := router.Group("/events")
+	{
+		eventGroup.POST("", h.handlePublish)                                                                    // POST /api/v1/events
+		eventGroup.GET("", h.handleListEvents)                                                                  // GET /api/v1/events?type=&schema_version=&after=&limit=
+		eventGroup.GET("/stream", h.handleStream)                                                               // GET /api/v1/events/stream?subscription_id= 或 ?type=&schema_version=
+		eventGroup.POST("/subscriptions", h.handleCreateSubscription)                                           // POST /api/v1/events/subscriptions
+		eventGroup.GET("/subscriptions", h.handleListSubscriptions)                                             // GET /api/v1/events/subscriptions
+		eventGroup.GET("/subscriptions/:subscription_id", h.handleGetSubscription)                              // GET /api/v1/events/subscriptions/{subscription_id}
+		eventGroup.DELETE("/subscriptions/:subscription_id", h.handleDeleteSubscription)                        // DELETE /api/v1/events/subscriptions/{subscription_id}
+		eventGroup.GET("/subscriptions/:subscription_id/deliveries", h.handleListDeliveries)                    // GET /api/v1/events/subscriptions/{subscription_id}/deliveries
+		eventGroup.POST("/subscriptions/:subscription_id/deliveries/:delivery_id/retry", h.handleRetryDelivery) // POST /api/v1/events/subscriptions/{subscription_id}/deliveries/{delivery_id}/retry
+	}
+}
+
+// eventBusUserID 从上下文中获取用户 ID，失败时写入错误响应并返回 false。
+func eventBusUserID(c *gin.Context, handler string) (string, bool) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID ("+handler+")")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+	}
+	return userID, ok
+}
+
+// writeEventBusError 写入服务返回的错误，非 AppError 包装为内部错误。
+func writeEventBusError(c *gin.Context, err error, message string) {
+	appErr, ok := err.(*apperr.AppError)
+	if !ok {
+		appErr = apperr.Wrap(err, apperr.CodeInternal, message)
+	}
+	c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+}
+
+// parseEventFilter 解析事件类型 (逗号分隔的多个模式) 和 schema_version 查询参数。
+func parseEventFilter(c *gin.Context) (*entity.EventFilter, *apperr.AppError) {
+	filter := &entity.EventFilter{}
+	if types := c.Query("type"); types != "" {
+		for _, pattern := range strings.Split(types, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				filter.TypePatterns = append(filter.TypePatterns, pattern)
+			}
+		}
+	}
+	if value := c.Query("schema_version"); value != "" {
+		version, err := strconv.Atoi(value)
+		if err != nil || version < 0 {
+			return nil, apperr.New(apperr.CodeInvalidArgument, "无效的查询参数").WithDetails("schema_version=" + value)
+		}
+		filter.SchemaVersion = &version
+	}
+	return filter, nil
+}
+
+// parseEventCursor 解析 seq 游标，value 为空时返回 0。
+func parseEventCursor(name string, value string) (int64, *apperr.AppError) {
+	if value == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, apperr.New(apperr.CodeInvalidArgument, "无效的事件序号").WithDetails(name + "=" + value)
+	}
+	return seq, nil
+}
+
+// handlePublish 处理发布事件的请求。请求体为 CloudEvents 结构化模式的 JSON，
+// 新事件返回 201，source 和 id 相同的事件已发布过时返回 200 和已有的事件。
+func (h *EventBusHandler) handlePublish(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "PublishEvent")
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, entity.MaxEventBodySize)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			appErr := apperr.New(apperr.CodeValidation, "事件大小超出上限").
+				WithDetails(fmt.Sprintf("max_event_size_bytes=%d", entity.MaxEventBodySize)).
+				WithHTTPStatus(http.StatusRequestEntityTooLarge)
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "无法读取请求体")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	var event entity.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		logger.WarnContext(ctx, "无效的发布事件请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体不是有效的 CloudEvents JSON")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	published, created, err := h.eventBus.Publish(ctx, userID, &event)
+	if err != nil {
+		writeEventBusError(c, err, "发布事件时发生未知错误")
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, published)
+}
+
+// handleListEvents 处理按 seq 升序列出事件的请求，用于回放 after 之后的事件。
+func (h *EventBusHandler) handleListEvents(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "ListEvents")
+	if !ok {
+		return
+	}
+	filter, appErr := parseEventFilter(c)
+	if appErr != nil {
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	if filter.After, appErr = parseEventCursor("after", c.Query("after")); appErr != nil {
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	filter.Limit = min(limit, 100)
+
+	events, err := h.eventBus.ListEvents(c.Request.Context(), userID, filter)
+	if err != nil {
+		writeEventBusError(c, err, "获取事件列表时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// handleStream 通过 Server-Sent Events 推送新事件，每条消息的 id 为事件的 seq，data 为事件 JSON。
+// 事件按 subscription_id 指定的 SSE 订阅过滤，或按 type 和 schema_version 查询参数过滤。
+// 断线重连时客户端发送的 Last-Event-ID 头 (或 after 查询参数) 之后的事件会被补发；两者都没有时只推送新事件。
+func (h *EventBusHandler) handleStream(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "StreamEvents")
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	filter, appErr := parseEventFilter(c)
+	if appErr != nil {
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	if subscriptionID := c.Query("subscription_id"); subscriptionID != "" {
+		sub, err := h.eventBus.GetSubscription(ctx, userID, subscriptionID)
+		if err != nil {
+			writeEventBusError(c, err, "获取事件订阅时发生未知错误")
+			return
+		}
+		if sub.Delivery != entity.EventDeliverySSE {
+			appErr := apperr.New(apperr.CodeValidation, "只能通过 SSE 接收 sse 订阅的事件").WithDetails("delivery=" + string(sub.Delivery))
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+		filter.TypePatterns = []string{sub.TypePattern}
+		filter.SchemaVersion = sub.SchemaVersion
+	}
+
+	cursorName, cursorValue := "Last-Event-ID", c.GetHeader("Last-Event-ID")
+	if cursorValue == "" {
+		cursorName, cursorValue = "after", c.Query("after")
+	}
+	if cursorValue != "" {
+		if filter.After, appErr = parseEventCursor(cursorName, cursorValue); appErr != nil {
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+	} else {
+		latest, err := h.eventBus.LatestEventSeq(ctx, userID)
+		if err != nil {
+			writeEventBusError(c, err, "获取最新事件序号时发生未知错误")
+			return
+		}
+		filter.After = latest
+	}
+	filter.Limit = eventStreamBatchSize
+
+	// 在写入响应头之前读取第一批事件，过滤条件无效时仍然可以返回 JSON 错误
+	events, err := h.eventBus.ListEvents(ctx, userID, filter)
+	if err != nil {
+		writeEventBusError(c, err, "获取事件列表时发生未知错误")
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁止 Nginx 缓冲响应
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", eventStreamRetry)
+	c.Writer.Flush()
+	logger.InfoContext(ctx, "SSE 事件流已连接", "user_id", userID, "types", filter.TypePatterns, "after", filter.After)
+
+	poll := time.NewTicker(h.pollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				logger.ErrorContext(ctx, "序列化事件失败", "error", err, "seq", event.Seq)
+				return
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %d\ndata: %s\n\n", event.Seq, data); err != nil {
+				return // 客户端已断开
+			}
+			filter.After = event.Seq
+		}
+		if len(events) > 0 {
+			c.Writer.Flush()
+			keepAlive.Reset(eventStreamKeepAlive)
+		}
+
+		full := len(events) == eventStreamBatchSize
+		events = nil
+		if !full {
+			select {
+			case <-ctx.Done():
+				logger.InfoContext(ctx, "SSE 事件流已断开", "user_id", userID, "last_seq", filter.After)
+				return
+			case <-keepAlive.C:
+				if _, err := io.WriteString(c.Writer, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+				continue
+			case <-poll.C:
+			}
+		}
+		if events, err = h.eventBus.ListEvents(ctx, userID, filter); err != nil {
+			logger.WarnContext(ctx, "SSE 读取事件失败，关闭连接", "error", err, "user_id", userID)
+			return // 客户端会带着 Last-Event-ID 重连
+		}
+	}
+}
+
+// handleCreateSubscription 处理创建订阅的请求。webhook 订阅的签名密钥只在这个响应中返回。
+func (h *EventBusHandler) handleCreateSubscription(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "CreateEventSubscription")
+	if !ok {
+		return
+	}
+	var req entity.EventSubscriptionInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c.Request.Context(), "无效的创建订阅请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	sub, err := h.eventBus.CreateSubscription(c.Request.Context(), userID, &req)
+	if err != nil {
+		writeEventBusError(c, err, "创建事件订阅时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusCreated, sub)
+}
+
+// handleListSubscriptions 处理列出订阅的请求。
+func (h *EventBusHandler) handleListSubscriptions(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "ListEventSubscriptions")
+	if !ok {
+		return
+	}
+	subscriptions, err := h.eventBus.ListSubscriptions(c.Request.Context(), userID)
+	if err != nil {
+		writeEventBusError(c, err, "获取事件订阅列表时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions})
+}
+
+// handleGetSubscription 处理获取订阅的请求。
+func (h *EventBusHandler) handleGetSubscription(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "GetEventSubscription")
+	if !ok {
+		return
+	}
+	sub, err := h.eventBus.GetSubscription(c.Request.Context(), userID, c.Param("subscription_id"))
+	if err != nil {
+		writeEventBusError(c, err, "获取事件订阅时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// handleDeleteSubscription 处理删除订阅的请求。
+func (h *EventBusHandler) handleDeleteSubscription(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "DeleteEventSubscription")
+	if !ok {
+		return
+	}
+	if err := h.eventBus.DeleteSubscription(c.Request.Context(), userID, c.Param("subscription_id")); err != nil {
+		writeEventBusError(c, err, "删除事件订阅时发生未知错误")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleListDeliveries 处理列出 webhook 投递记录的请求，总数通过 X-Total-Count 响应头返回。
+func (h *EventBusHandler) handleListDeliveries(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "ListEventDeliveries")
+	if !ok {
+		return
+	}
+	limit, errL := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, errO := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if errL != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if errO != nil || offset < 0 {
+		offset = 0
+	}
+	deliveries, total, err := h.eventBus.ListDeliveries(c.Request.Context(), userID, c.Param("subscription_id"), limit, offset)
+	if err != nil {
+		writeEventBusError(c, err, "获取投递记录时发生未知错误")
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// handleRetryDelivery 处理重新投递失败的 webhook 投递的请求。
+func (h *EventBusHandler) handleRetryDelivery(c *gin.Context) {
+	userID, ok := eventBusUserID(c, "RetryEventDelivery")
+	if !ok {
+		return
+	}
+	delivery, err := h.eventBus.RetryDelivery(c.Request.Context(), userID, c.Param("subscription_id"), c.Param("delivery_id"))
+	if err != nil {
+		writeEventBusError(c, err, "重新投递时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
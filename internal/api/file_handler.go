@@ -1,9 +1,14 @@
 package api
 
 import (
-	// Import fmt for error formatting
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	// "github.com/google/uuid" // Removed unused import
@@ -12,15 +17,20 @@ import (
 	"github.com/soaringjerry/dreamhub/pkg/logger"
 )
 
+// multipartOverhead 是 multipart 请求体中除文件内容外 (边界、表单头等) 允许的额外字节数。
+const multipartOverhead = 1 << 20
+
 // FileHandler 负责处理与文件和任务相关的 API 请求。
 type FileHandler struct {
-	fileService service.FileService
+	fileService   service.FileService
+	maxUploadSize int64 // 单个上传文件的最大字节数，用于限制请求体大小
 }
 
 // NewFileHandler 创建一个新的 FileHandler 实例。
-func NewFileHandler(fs service.FileService) *FileHandler {
+func NewFileHandler(fs service.FileService, maxUploadSize int64) *FileHandler {
 	return &FileHandler{
-		fileService: fs,
+		fileService:   fs,
+		maxUploadSize: maxUploadSize,
 	}
 }
 
@@ -28,6 +38,8 @@ func NewFileHandler(fs service.FileService) *FileHandler {
 func (h *FileHandler) RegisterRoutes(router *gin.RouterGroup) {
 	// 文件上传路由
 	router.POST("/upload", h.handleUploadFile)
+	// 存储用量和配额查询路由
+	router.GET("/storage/usage", h.handleGetStorageUsage)
 
 	// 任务状态查询路由
 	tasksGroup := router.Group("/tasks")
@@ -39,9 +51,12 @@ func (h *FileHandler) RegisterRoutes(router *gin.RouterGroup) {
 	docsGroup := router.Group("/documents")
 	{
 		// TODO: Add authentication middleware here
-		docsGroup.GET("", h.handleListDocuments)             // GET /api/v1/documents?user_id=...
-		docsGroup.GET("/:doc_id", h.handleGetDocument)       // GET /api/v1/documents/{doc_id}
-		docsGroup.DELETE("/:doc_id", h.handleDeleteDocument) // DELETE /api/v1/documents/{doc_id}
+		docsGroup.GET("", h.handleListDocuments)                      // GET /api/v1/documents?user_id=...
+		docsGroup.POST("/from-url", h.handleIngestURL)                // POST /api/v1/documents/from-url
+		docsGroup.GET("/:doc_id", h.handleGetDocument)                // GET /api/v1/documents/{doc_id}
+		docsGroup.GET("/:doc_id/content", h.handleGetDocumentContent) // GET /api/v1/documents/{doc_id}/content?disposition=inline
+		docsGroup.GET("/:doc_id/chunks", h.handleListDocumentChunks)  // GET /api/v1/documents/{doc_id}/chunks?limit=...&offset=...
+		docsGroup.DELETE("/:doc_id", h.handleDeleteDocument)          // DELETE /api/v1/documents/{doc_id}
 	}
 }
 
@@ -60,9 +75,21 @@ func (h *FileHandler) handleUploadFile(c *gin.Context) {
 	logger.DebugContext(c.Request.Context(), "处理文件上传", "user_id", userID)
 	ctx := c.Request.Context() // Use original context
 
+	// 限制请求体大小，避免解析超大的 multipart 请求
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUploadSize+multipartOverhead)
+
 	// 从表单获取文件
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logger.WarnContext(ctx, "上传请求体超出大小限制", "user_id", userID, "limit", maxBytesErr.Limit)
+			appErr := apperr.New(apperr.CodeValidation, "文件大小超出上限").
+				WithDetails(fmt.Sprintf("max_upload_size_bytes=%d", h.maxUploadSize)).
+				WithHTTPStatus(http.StatusRequestEntityTooLarge)
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
 		logger.WarnContext(ctx, "无法获取上传的文件", "error", err)
 		// Use apperr.Wrap function instead of chaining from helper
 		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "缺少文件或表单字段名错误 ('file')")
@@ -117,6 +144,73 @@ func (h *FileHandler) handleUploadFile(c *gin.Context) {
 	})
 }
 
+// IngestURLRequest 定义了从 URL 导入文档的请求体。
+type IngestURLRequest struct {
+	URL                    string `json:"url" binding:"required"`
+	RecrawlIntervalMinutes int    `json:"recrawl_interval_minutes"` // 0 表示只抓取一次
+}
+
+// handleIngestURL 处理从 URL 导入网页文档的请求。
+func (h *FileHandler) handleIngestURL(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (IngestURL)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	var req IngestURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体格式错误 (需要 url)")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	recrawlInterval := time.Duration(req.RecrawlIntervalMinutes) * time.Minute
+	doc, taskID, err := h.fileService.IngestURL(c.Request.Context(), userID, req.URL, recrawlInterval)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "导入 URL 时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	// 返回成功响应 (HTTP 202 Accepted 表示后台抓取中)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "URL 已提交，正在后台抓取和处理中...",
+		"source_url": doc.SourceURL,
+		"filename":   doc.OriginalFilename,
+		"doc_id":     doc.ID,
+		"task_id":    taskID,
+	})
+}
+
+// handleGetStorageUsage 处理获取当前用户存储用量和配额的请求。
+func (h *FileHandler) handleGetStorageUsage(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (GetStorageUsage)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	usage, err := h.fileService.GetStorageUsage(c.Request.Context(), userID)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "获取存储用量时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
 // handleGetTaskStatus 处理获取任务状态的请求。
 func (h *FileHandler) handleGetTaskStatus(c *gin.Context) {
 	taskID := c.Param("task_id")
@@ -224,6 +318,117 @@ func (h *FileHandler) handleGetDocument(c *gin.Context) {
 	c.JSON(http.StatusOK, doc)
 }
 
+// handleGetDocumentContent 处理下载/预览原始文件的请求。
+// 支持 HTTP Range 请求；disposition=inline 时用于浏览器内预览，默认作为附件下载。
+func (h *FileHandler) handleGetDocumentContent(c *gin.Context) {
+	docIDStr := c.Param("doc_id")
+	if docIDStr == "" {
+		appErr := apperr.New(apperr.CodeInvalidArgument, "缺少文档 ID")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (GetDocumentContent)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	logger.DebugContext(c.Request.Context(), "获取文档内容", "user_id", userID, "doc_id", docIDStr)
+	ctx := c.Request.Context()
+
+	disposition := c.DefaultQuery("disposition", "attachment")
+	if disposition != "attachment" && disposition != "inline" {
+		appErr := apperr.New(apperr.CodeInvalidArgument, "disposition 参数只能是 attachment 或 inline")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	doc, content, err := h.fileService.GetDocumentContent(ctx, userID, docIDStr)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "获取文档内容时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", documentContentType(doc.ContentType, doc.OriginalFilename))
+	c.Header("Content-Disposition", contentDisposition(disposition, doc.OriginalFilename))
+	c.Header("X-Content-Type-Options", "nosniff")
+	if disposition == "inline" {
+		// 用户上传的内容可能包含脚本，预览时放入沙箱
+		c.Header("Content-Security-Policy", "sandbox")
+	}
+
+	// 存储返回可 Seek 的内容时 (本地文件或可随机访问的解密 reader)，由 ServeContent 负责
+	// Range、If-Range、If-Modified-Since 等处理；否则按顺序流式输出，不支持 Range。
+	// 解密后的明文只存在于内存中，不写入磁盘。
+	seeker, ok := content.(io.ReadSeeker)
+	if !ok {
+		c.Header("Accept-Ranges", "none")
+		c.Status(http.StatusOK)
+		if _, err := io.Copy(c.Writer, content); err != nil {
+			logger.WarnContext(ctx, "输出文档内容时中断", "error", err, "doc_id", doc.ID)
+		}
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, doc.OriginalFilename, doc.UploadTime, seeker)
+}
+
+// handleListDocumentChunks 处理列出文档已索引文本块的请求。
+func (h *FileHandler) handleListDocumentChunks(c *gin.Context) {
+	docIDStr := c.Param("doc_id")
+	if docIDStr == "" {
+		appErr := apperr.New(apperr.CodeInvalidArgument, "缺少文档 ID")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (ListDocumentChunks)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	logger.DebugContext(c.Request.Context(), "列出文档块", "user_id", userID, "doc_id", docIDStr)
+	ctx := c.Request.Context()
+
+	// 获取分页参数
+	limit, errL := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, errO := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if errL != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	if errO != nil || offset < 0 {
+		offset = 0
+	}
+
+	chunks, err := h.fileService.ListDocumentChunks(ctx, userID, docIDStr, limit, offset)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "获取文档块时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": docIDStr,
+		"chunks":      chunks,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
 // handleDeleteDocument 处理删除文档的请求。
 func (h *FileHandler) handleDeleteDocument(c *gin.Context) {
 	docIDStr := c.Param("doc_id")
@@ -259,3 +464,22 @@ func (h *FileHandler) handleDeleteDocument(c *gin.Context) {
 }
 
 // Removed the duplicated/incorrect error handling block below
+
+// documentContentType 返回下载时使用的 Content-Type，优先使用上传时记录的类型。
+func documentContentType(contentType, filename string) string {
+	if contentType != "" {
+		return contentType
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(filename)); byExt != "" {
+		return byExt
+	}
+	return "application/octet-stream"
+}
+
+// contentDisposition 构造 Content-Disposition 头，非 ASCII 文件名按 RFC 2231 编码。
+func contentDisposition(disposition, filename string) string {
+	if header := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); header != "" {
+		return header
+	}
+	return disposition
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+// fakeFileService 只实现测试用到的 IngestURL，调用其他方法会 panic。
+type fakeFileService struct {
+	service.FileService
+	ingestURL func(ctx context.Context, userID string, rawURL string, recrawlInterval time.Duration) (*entity.Document, string, error)
+}
+
+func (f *fakeFileService) IngestURL(ctx context.Context, userID string, rawURL string, recrawlInterval time.Duration) (*entity.Document, string, error) {
+	return f.ingestURL(ctx, userID, rawURL, recrawlInterval)
+}
+
+// newFileHandlerRouter 返回注册了文件路由的 Gin 引擎，userID 不为空时模拟已认证的用户。
+func newFileHandlerRouter(fs service.FileService, userID string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if userID != "" {
+		router.Use(func(c *gin.Context) { c.Set(authorizationPayloadKey, userID) })
+	}
+	NewFileHandler(fs, 1024).RegisterRoutes(router.Group("/api/v1"))
+	return router
+}
+
+func TestHandleIngestURL(t *testing.T) {
+	var gotUserID, gotURL string
+	var gotInterval time.Duration
+	fs := &fakeFileService{ingestURL: func(ctx context.Context, userID string, rawURL string, recrawlInterval time.Duration) (*entity.Document, string, error) {
+		gotUserID, gotURL, gotInterval = userID, rawURL, recrawlInterval
+		sourceURL := rawURL
+		return &entity.Document{ID: "doc-1", OriginalFilename: "example.com.md", SourceURL: &sourceURL}, "task-1", nil
+	}}
+	router := newFileHandlerRouter(fs, "user-1")
+
+	body := `{"url": "https://example.com/post", "recrawl_interval_minutes": 90}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/documents/from-url", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+	if gotUserID != "user-1" || gotURL != "https://example.com/post" || gotInterval != 90*time.Minute {
+		t.Errorf("IngestURL(%q, %q, %v), want (user-1, https://example.com/post, 1h30m0s)", gotUserID, gotURL, gotInterval)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp["doc_id"] != "doc-1" || resp["task_id"] != "task-1" || resp["source_url"] != "https://example.com/post" {
+		t.Errorf("response = %v, want doc_id, task_id and source_url of the created document", resp)
+	}
+}
+
+func TestHandleIngestURLErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     string
+		body       string
+		serviceErr error
+		wantStatus int
+	}{
+		{"missing url", "user-1", `{}`, nil, http.StatusBadRequest},
+		{"invalid JSON", "user-1", `{"url":`, nil, http.StatusBadRequest},
+		{"rejected by service", "user-1", `{"url": "http://127.0.0.1/"}`, apperr.New(apperr.CodeValidation, "不允许抓取该地址"), http.StatusBadRequest},
+		{"queue unavailable", "user-1", `{"url": "https://example.com/"}`, apperr.New(apperr.CodeUnavailable, "任务队列不可用"), http.StatusServiceUnavailable},
+		{"unknown error", "user-1", `{"url": "https://example.com/"}`, context.DeadlineExceeded, http.StatusInternalServerError},
+		{"no user", "", `{"url": "https://example.com/"}`, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			fs := &fakeFileService{ingestURL: func(ctx context.Context, userID string, rawURL string, recrawlInterval time.Duration) (*entity.Document, string, error) {
+				called = true
+				if tt.serviceErr == nil {
+					t.Error("IngestURL should not be called")
+				}
+				return nil, "", tt.serviceErr
+			}}
+			router := newFileHandlerRouter(fs, tt.userID)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/documents/from-url", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.serviceErr != nil && !called {
+				t.Error("IngestURL was not called")
+			}
+			var resp struct {
+				Error map[string]any `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+				t.Errorf("response = %s, want a JSON error object", rec.Body.String())
+			}
+		})
+	}
+}
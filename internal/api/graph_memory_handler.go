@@ -0,0 +1,255 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// GraphMemoryHandler 负责处理图记忆 (节点和边) 相关的 API 请求。
+type GraphMemoryHandler struct {
+	graphService service.GraphMemoryService
+}
+
+// NewGraphMemoryHandler 创建一个新的 GraphMemoryHandler 实例。
+func NewGraphMemoryHandler(gs service.GraphMemoryService) *GraphMemoryHandler {
+	return &GraphMemoryHandler{
+		graphService: gs,
+	}
+}
+
+// RegisterRoutes 将图记忆相关的路由注册到 Gin 引擎。
+func (h *GraphMemoryHandler) RegisterRoutes(router *gin.RouterGroup) {
+	graphGroup := router.Group("/graph")
+	{
+		graphGroup.POST("/nodes", h.handleRecordNode)                                            // POST /api/v1/graph/nodes
+		graphGroup.GET("/nodes", h.handleListNodes)                                              // GET /api/v1/graph/nodes?type=&ref_type=&ref_id=
+		graphGroup.GET("/nodes/:node_id", h.handleGetNode)                                       // GET /api/v1/graph/nodes/{node_id}
+		graphGroup.DELETE("/nodes/:node_id", h.handleDeleteNode)                                 // DELETE /api/v1/graph/nodes/{node_id}
+		graphGroup.GET("/nodes/:node_id/edges", h.handleListNodeEdges)                           // GET /api/v1/graph/nodes/{node_id}/edges
+		graphGroup.GET("/nodes/:node_id/ancestors", h.handleTraverse(entity.GraphAncestors))     // GET /api/v1/graph/nodes/{node_id}/ancestors
+		graphGroup.GET("/nodes/:node_id/descendants", h.handleTraverse(entity.GraphDescendants)) // GET /api/v1/graph/nodes/{node_id}/descendants
+		graphGroup.POST("/edges", h.handleRecordEdge)                                            // POST /api/v1/graph/edges
+		graphGroup.DELETE("/edges/:edge_id", h.handleDeleteEdge)                                 // DELETE /api/v1/graph/edges/{edge_id}
+		graphGroup.GET("/paths", h.handleFindPaths)                                              // GET /api/v1/graph/paths?from=&to=
+	}
+}
+
+// graphUserID 从上下文中获取用户 ID，失败时写入错误响应并返回 false。
+func graphUserID(c *gin.Context, handler string) (string, bool) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID ("+handler+")")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+	}
+	return userID, ok
+}
+
+// writeGraphError 写入服务返回的错误，非 AppError 包装为内部错误。
+func writeGraphError(c *gin.Context, err error, message string) {
+	appErr, ok := err.(*apperr.AppError)
+	if !ok {
+		appErr = apperr.Wrap(err, apperr.CodeInternal, message)
+	}
+	c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+}
+
+// parseGraphInt 解析可选的非负整数查询参数，未设置时返回 0。
+func parseGraphInt(c *gin.Context, name string) (int, *apperr.AppError) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, apperr.New(apperr.CodeInvalidArgument, "无效的查询参数").WithDetails(name + "=" + value)
+	}
+	return n, nil
+}
+
+// handleRecordNode 处理记录节点的请求。
+func (h *GraphMemoryHandler) handleRecordNode(c *gin.Context) {
+	userID, ok := graphUserID(c, "RecordGraphNode")
+	if !ok {
+		return
+	}
+	var req entity.GraphNodeInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c.Request.Context(), "无效的记录节点请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	node, err := h.graphService.RecordNode(c.Request.Context(), userID, &req)
+	if err != nil {
+		writeGraphError(c, err, "记录图记忆节点时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusCreated, node)
+}
+
+// handleListNodes 处理列出节点的请求，符合条件的总数通过 X-Total-Count 响应头返回。
+func (h *GraphMemoryHandler) handleListNodes(c *gin.Context) {
+	userID, ok := graphUserID(c, "ListGraphNodes")
+	if !ok {
+		return
+	}
+	limit, errL := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, errO := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if errL != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if errO != nil || offset < 0 {
+		offset = 0
+	}
+	filter := &entity.GraphNodeFilter{
+		Type:    entity.GraphNodeType(c.Query("type")),
+		RefType: c.Query("ref_type"),
+		RefID:   c.Query("ref_id"),
+		Limit:   limit,
+		Offset:  offset,
+	}
+	nodes, total, err := h.graphService.ListNodes(c.Request.Context(), userID, filter)
+	if err != nil {
+		writeGraphError(c, err, "获取图记忆节点列表时发生未知错误")
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, gin.H{"nodes": nodes})
+}
+
+// handleGetNode 处理获取单个节点的请求。
+func (h *GraphMemoryHandler) handleGetNode(c *gin.Context) {
+	userID, ok := graphUserID(c, "GetGraphNode")
+	if !ok {
+		return
+	}
+	node, err := h.graphService.GetNode(c.Request.Context(), userID, c.Param("node_id"))
+	if err != nil {
+		writeGraphError(c, err, "获取图记忆节点时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusOK, node)
+}
+
+// handleDeleteNode 处理删除节点的请求，与节点相连的边一并删除。
+func (h *GraphMemoryHandler) handleDeleteNode(c *gin.Context) {
+	userID, ok := graphUserID(c, "DeleteGraphNode")
+	if !ok {
+		return
+	}
+	if err := h.graphService.DeleteNode(c.Request.Context(), userID, c.Param("node_id")); err != nil {
+		writeGraphError(c, err, "删除图记忆节点时发生未知错误")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleListNodeEdges 处理列出节点的边的请求。
+func (h *GraphMemoryHandler) handleListNodeEdges(c *gin.Context) {
+	userID, ok := graphUserID(c, "ListGraphNodeEdges")
+	if !ok {
+		return
+	}
+	edges, err := h.graphService.ListNodeEdges(c.Request.Context(), userID, c.Param("node_id"))
+	if err != nil {
+		writeGraphError(c, err, "获取图记忆边时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"edges": edges})
+}
+
+// handleTraverse 返回查询节点的祖先或后代的处理函数。查询参数 depth 为最大深度，edge_types 为逗号分隔的边类型。
+func (h *GraphMemoryHandler) handleTraverse(direction entity.GraphDirection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := graphUserID(c, "TraverseGraph")
+		if !ok {
+			return
+		}
+		depth, appErr := parseGraphInt(c, "depth")
+		if appErr != nil {
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+		var edgeTypes []entity.GraphEdgeType
+		for _, t := range strings.Split(c.Query("edge_types"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				edgeTypes = append(edgeTypes, entity.GraphEdgeType(t))
+			}
+		}
+		nodes, err := h.graphService.Traverse(c.Request.Context(), userID, c.Param("node_id"), direction, depth, edgeTypes)
+		if err != nil {
+			writeGraphError(c, err, "查询图记忆时发生未知错误")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"nodes": nodes})
+	}
+}
+
+// handleRecordEdge 处理记录边的请求。
+func (h *GraphMemoryHandler) handleRecordEdge(c *gin.Context) {
+	userID, ok := graphUserID(c, "RecordGraphEdge")
+	if !ok {
+		return
+	}
+	var req entity.GraphEdgeInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c.Request.Context(), "无效的记录边请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	edge, err := h.graphService.RecordEdge(c.Request.Context(), userID, &req)
+	if err != nil {
+		writeGraphError(c, err, "记录图记忆边时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusCreated, edge)
+}
+
+// handleDeleteEdge 处理删除边的请求。
+func (h *GraphMemoryHandler) handleDeleteEdge(c *gin.Context) {
+	userID, ok := graphUserID(c, "DeleteGraphEdge")
+	if !ok {
+		return
+	}
+	if err := h.graphService.DeleteEdge(c.Request.Context(), userID, c.Param("edge_id")); err != nil {
+		writeGraphError(c, err, "删除图记忆边时发生未知错误")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleFindPaths 处理查找两个节点之间路径的请求。
+func (h *GraphMemoryHandler) handleFindPaths(c *gin.Context) {
+	userID, ok := graphUserID(c, "FindGraphPaths")
+	if !ok {
+		return
+	}
+	depth, appErr := parseGraphInt(c, "depth")
+	if appErr != nil {
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	limit, appErr := parseGraphInt(c, "limit")
+	if appErr != nil {
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	paths, err := h.graphService.FindPaths(c.Request.Context(), userID, c.Query("from"), c.Query("to"), depth, limit)
+	if err != nil {
+		writeGraphError(c, err, "查询图记忆路径时发生未知错误")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"paths": paths})
+}
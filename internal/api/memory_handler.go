@@ -3,7 +3,12 @@ package api
 import (
 	"errors"
 	"fmt" // Add fmt for error messages
+	"io"
+	"mime/multipart"
 	"net/http"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	// "github.com/google/uuid" // No longer asserting to UUID here
@@ -28,11 +33,39 @@ func NewMemoryHandler(s service.StructuredMemoryService) *MemoryHandler {
 type CreateMemoryRequest struct {
 	Key   string `json:"key" binding:"required"`
 	Value string `json:"value" binding:"required"`
+	MemoryAttributes
 }
 
 // UpdateMemoryRequest defines the structure for the update memory request body.
+// Omitted attributes revert to their defaults.
 type UpdateMemoryRequest struct {
 	Value string `json:"value" binding:"required"`
+	MemoryAttributes
+}
+
+// MemoryAttributes holds the optional typed attributes of a memory in create and update requests.
+type MemoryAttributes struct {
+	ValueType  entity.MemoryValueType `json:"value_type"` // string (default), number, date, json or list
+	Namespace  string                 `json:"namespace"`
+	Confidence *float64               `json:"confidence"` // 0..1
+	ExpiresAt  *time.Time             `json:"expires_at"` // RFC 3339
+}
+
+// RevertMemoryRequest defines the structure for the revert memory request body.
+type RevertMemoryRequest struct {
+	HistoryID string `json:"history_id" binding:"required"` // ID of the history entry to restore
+}
+
+// toInput converts the request attributes and value to a StructuredMemoryInput.
+func (a MemoryAttributes) toInput(key string, value string) *entity.StructuredMemoryInput {
+	return &entity.StructuredMemoryInput{
+		Key:        key,
+		Value:      value,
+		ValueType:  a.ValueType,
+		Namespace:  a.Namespace,
+		Confidence: a.Confidence,
+		ExpiresAt:  a.ExpiresAt,
+	}
 }
 
 // CreateMemory godoc
@@ -75,7 +108,7 @@ func (h *MemoryHandler) CreateMemory(c *gin.Context) {
 	}
 
 	// Pass string userID to the service (assuming service accepts string)
-	memory, err := h.service.CreateMemory(c.Request.Context(), userIDStr, req.Key, req.Value)
+	memory, err := h.service.CreateMemory(c.Request.Context(), userIDStr, req.toInput(req.Key, req.Value))
 	if err != nil {
 		logger.ErrorContext(c, "CreateMemory service error", "user_id", userIDStr, "key", req.Key, "error", err)
 		// Handle specific errors (assuming repository defines ErrDuplicateKey)
@@ -93,9 +126,11 @@ func (h *MemoryHandler) CreateMemory(c *gin.Context) {
 
 // GetUserMemories godoc
 // @Summary Get all structured memory entries for the current user
-// @Description Retrieves all key-value pairs stored for the logged-in user.
+// @Description Retrieves the key-value pairs stored for the logged-in user. Expired entries are omitted unless include_expired is true.
 // @Tags Memory
 // @Produce json
+// @Param namespace query string false "Only entries in this namespace"
+// @Param include_expired query bool false "Include expired entries"
 // @Success 200 {array} entity.StructuredMemory
 // @Failure 401 {object} gin.H{"error": "string"} "Unauthorized"
 // @Failure 500 {object} gin.H{"error": "string"} "Internal server error"
@@ -119,7 +154,11 @@ func (h *MemoryHandler) GetUserMemories(c *gin.Context) {
 	}
 
 	// Pass string userID to the service (assuming service accepts string)
-	memories, err := h.service.GetUserMemories(c.Request.Context(), userIDStr)
+	filter := &service.StructuredMemoryFilter{
+		Namespace:      c.Query("namespace"),
+		IncludeExpired: c.Query("include_expired") == "true",
+	}
+	memories, err := h.service.GetUserMemories(c.Request.Context(), userIDStr, filter)
 	if err != nil {
 		logger.ErrorContext(c, "GetUserMemories service error", "user_id", userIDStr, "error", err)
 		c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
@@ -236,7 +275,7 @@ func (h *MemoryHandler) UpdateMemory(c *gin.Context) {
 	}
 
 	// Pass string userID to the service (assuming service accepts string)
-	memory, err := h.service.UpdateMemory(c.Request.Context(), userIDStr, key, req.Value)
+	memory, err := h.service.UpdateMemory(c.Request.Context(), userIDStr, key, req.toInput(key, req.Value))
 	if err != nil {
 		logger.ErrorContext(c, "UpdateMemory service error", "user_id", userIDStr, "key", key, "error", err)
 		// Handle specific errors (assuming repository defines ErrNotFound)
@@ -304,3 +343,263 @@ func (h *MemoryHandler) DeleteMemory(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// GetMemoryHistory godoc
+// @Summary List the history of a structured memory entry
+// @Description Returns every recorded version of the key, newest first, including versions of deleted entries.
+// @Tags Memory
+// @Produce json
+// @Param key path string true "Memory Key"
+// @Success 200 {array} entity.StructuredMemoryHistory
+// @Failure 401 {object} gin.H{"error": "string"} "Unauthorized"
+// @Failure 404 {object} gin.H{"error": "string"} "No history for the key"
+// @Failure 500 {object} gin.H{"error": "string"} "Internal server error"
+// @Security BearerAuth
+// @Router /api/v1/memory/structured/{key}/history [get]
+func (h *MemoryHandler) GetMemoryHistory(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c, "无法从上下文中获取 user_id", "handler", "GetMemoryHistory")
+		err := apperr.New(apperr.CodeUnauthenticated, "无效的认证信息")
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	key := c.Param("key")
+	history, err := h.service.GetMemoryHistory(c.Request.Context(), userID, key)
+	if err != nil {
+		logger.ErrorContext(c, "GetMemoryHistory service error", "user_id", userID, "key", key, "error", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			nfErr := apperr.Wrap(err, apperr.CodeNotFound, "找不到指定键的内存历史")
+			c.AbortWithStatusJSON(apperr.GetHTTPStatus(nfErr), gin.H{"error": nfErr.Error()})
+		} else {
+			c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// RevertMemory godoc
+// @Summary Revert a structured memory entry to a past version
+// @Description Restores the value and attributes recorded in a history entry of the key. A deleted entry is created again.
+// @Tags Memory
+// @Accept json
+// @Produce json
+// @Param key path string true "Memory Key"
+// @Param revert body RevertMemoryRequest true "History entry to restore"
+// @Success 200 {object} entity.StructuredMemory
+// @Failure 400 {object} gin.H{"error": "string"} "Invalid input"
+// @Failure 401 {object} gin.H{"error": "string"} "Unauthorized"
+// @Failure 404 {object} gin.H{"error": "string"} "History entry not found"
+// @Failure 500 {object} gin.H{"error": "string"} "Internal server error"
+// @Security BearerAuth
+// @Router /api/v1/memory/structured/{key}/revert [post]
+func (h *MemoryHandler) RevertMemory(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c, "无法从上下文中获取 user_id", "handler", "RevertMemory")
+		err := apperr.New(apperr.CodeUnauthenticated, "无效的认证信息")
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var req RevertMemoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c, "无效的请求体", "handler", "RevertMemory", "error", err)
+		bindErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体格式错误")
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(bindErr), gin.H{"error": bindErr.Error()})
+		return
+	}
+
+	key := c.Param("key")
+	memory, err := h.service.RevertMemory(c.Request.Context(), userID, key, req.HistoryID)
+	if err != nil {
+		logger.ErrorContext(c, "RevertMemory service error", "user_id", userID, "key", key, "history_id", req.HistoryID, "error", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			nfErr := apperr.Wrap(err, apperr.CodeNotFound, "找不到指定的内存历史版本")
+			c.AbortWithStatusJSON(apperr.GetHTTPStatus(nfErr), gin.H{"error": nfErr.Error()})
+		} else {
+			c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, memory)
+}
+
+// maxMemoryImportSize is the maximum size of a structured memory import file.
+const maxMemoryImportSize = 10 << 20
+
+// BatchMemoriesRequest defines the structure for the batch request body.
+type BatchMemoriesRequest struct {
+	Operations []*entity.MemoryBatchOperation `json:"operations" binding:"required"`
+}
+
+// abortWithBatchError responds with the error of an import or batch request. When some items were invalid
+// the summary lists them, and the response includes their results.
+func abortWithBatchError(c *gin.Context, summary *entity.MemoryBatchSummary, err error) {
+	if summary != nil {
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error(), "results": summary.Results})
+		return
+	}
+	c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+}
+
+// ExportMemories godoc
+// @Summary Export structured memory entries
+// @Description Downloads all of the user's entries, including expired ones, as a JSON array or a CSV file.
+// @Tags Memory
+// @Produce json
+// @Produce text/csv
+// @Param format query string false "json (default) or csv"
+// @Param namespace query string false "Only entries in this namespace"
+// @Success 200 {file} file
+// @Failure 400 {object} gin.H{"error": "string"} "Unsupported format"
+// @Failure 401 {object} gin.H{"error": "string"} "Unauthorized"
+// @Failure 500 {object} gin.H{"error": "string"} "Internal server error"
+// @Security BearerAuth
+// @Router /api/v1/memory/structured/export [get]
+func (h *MemoryHandler) ExportMemories(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c, "无法从上下文中获取 user_id", "handler", "ExportMemories")
+		err := apperr.New(apperr.CodeUnauthenticated, "无效的认证信息")
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", entity.MemoryFileFormatJSON)
+	file, err := h.service.ExportMemories(c.Request.Context(), userID, c.Query("namespace"), format)
+	if err != nil {
+		logger.ErrorContext(c, "ExportMemories service error", "user_id", userID, "format", format, "error", err)
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	writeExportFile(c, file)
+}
+
+// ImportMemories godoc
+// @Summary Import structured memory entries
+// @Description Imports entries from a JSON array or a CSV file in one transaction, with source "imported".
+// @Description The file is the request body, or the "file" field of a multipart form. The format is taken from the
+// @Description format parameter, else from the file name or Content-Type (JSON by default).
+// @Description strategy decides what happens to existing keys: skip (default), overwrite or fail (roll back the import).
+// @Tags Memory
+// @Accept json
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Param format query string false "json or csv"
+// @Param strategy query string false "skip (default), overwrite or fail"
+// @Success 200 {object} entity.MemoryBatchSummary
+// @Failure 400 {object} gin.H{"error": "string"} "Invalid file or entries (results lists the invalid entries)"
+// @Failure 401 {object} gin.H{"error": "string"} "Unauthorized"
+// @Failure 409 {object} gin.H{"error": "string"} "A key exists and strategy is fail"
+// @Failure 413 {object} gin.H{"error": "string"} "File too large"
+// @Failure 500 {object} gin.H{"error": "string"} "Internal server error"
+// @Security BearerAuth
+// @Router /api/v1/memory/structured/import [post]
+func (h *MemoryHandler) ImportMemories(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c, "无法从上下文中获取 user_id", "handler", "ImportMemories")
+		err := apperr.New(apperr.CodeUnauthenticated, "无效的认证信息")
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.Query("format")
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxMemoryImportSize+multipartOverhead)
+	var data []byte
+	var err error
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		var fileHeader *multipart.FileHeader
+		if fileHeader, err = c.FormFile("file"); err == nil {
+			if format == "" && strings.EqualFold(path.Ext(fileHeader.Filename), ".csv") {
+				format = entity.MemoryFileFormatCSV
+			}
+			var file multipart.File
+			if file, err = fileHeader.Open(); err == nil {
+				data, err = io.ReadAll(io.LimitReader(file, maxMemoryImportSize+1))
+				file.Close()
+			}
+		}
+	} else {
+		if format == "" && c.ContentType() == "text/csv" {
+			format = entity.MemoryFileFormatCSV
+		}
+		data, err = io.ReadAll(c.Request.Body)
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || len(data) > maxMemoryImportSize {
+		logger.WarnContext(c, "导入请求体超出大小限制", "handler", "ImportMemories", "user_id", userID)
+		tooLarge := apperr.New(apperr.CodeValidation, "导入文件大小超出上限").
+			WithDetails(fmt.Sprintf("max_import_size_bytes=%d", maxMemoryImportSize)).
+			WithHTTPStatus(http.StatusRequestEntityTooLarge)
+		c.AbortWithStatusJSON(tooLarge.HTTPStatus, gin.H{"error": tooLarge.Error()})
+		return
+	}
+	if err != nil {
+		logger.WarnContext(c, "无法读取导入文件", "handler", "ImportMemories", "error", err)
+		readErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "缺少导入文件或表单字段名错误 ('file')")
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(readErr), gin.H{"error": readErr.Error()})
+		return
+	}
+	if format == "" {
+		format = entity.MemoryFileFormatJSON
+	}
+
+	strategy := entity.MemoryConflictStrategy(c.Query("strategy"))
+	summary, err := h.service.ImportMemories(c.Request.Context(), userID, format, strategy, data)
+	if err != nil {
+		logger.ErrorContext(c, "ImportMemories service error", "user_id", userID, "format", format, "strategy", strategy, "error", err)
+		abortWithBatchError(c, summary, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// BatchMemories godoc
+// @Summary Upsert and delete structured memory entries in one transaction
+// @Description Runs the operations in order; either all of them are applied or none. Upserts replace existing entries.
+// @Description Deleting a key that does not exist is reported as not_found and does not fail the batch.
+// @Tags Memory
+// @Accept json
+// @Produce json
+// @Param batch body BatchMemoriesRequest true "Operations"
+// @Success 200 {object} entity.MemoryBatchSummary
+// @Failure 400 {object} gin.H{"error": "string"} "Invalid operations (results lists them)"
+// @Failure 401 {object} gin.H{"error": "string"} "Unauthorized"
+// @Failure 500 {object} gin.H{"error": "string"} "Internal server error"
+// @Security BearerAuth
+// @Router /api/v1/memory/structured/batch [post]
+func (h *MemoryHandler) BatchMemories(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c, "无法从上下文中获取 user_id", "handler", "BatchMemories")
+		err := apperr.New(apperr.CodeUnauthenticated, "无效的认证信息")
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var req BatchMemoriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c, "无效的请求体", "handler", "BatchMemories", "error", err)
+		bindErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体格式错误")
+		c.AbortWithStatusJSON(apperr.GetHTTPStatus(bindErr), gin.H{"error": bindErr.Error()})
+		return
+	}
+
+	summary, err := h.service.BatchMemories(c.Request.Context(), userID, req.Operations)
+	if err != nil {
+		logger.ErrorContext(c, "BatchMemories service error", "user_id", userID, "operations", len(req.Operations), "error", err)
+		abortWithBatchError(c, summary, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
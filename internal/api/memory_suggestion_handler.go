@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// MemorySuggestionHandler 负责处理自动提取的记忆建议相关的 API 请求。
+type MemorySuggestionHandler struct {
+	extractionService service.MemoryExtractionService
+}
+
+// NewMemorySuggestionHandler 创建一个新的 MemorySuggestionHandler 实例。
+func NewMemorySuggestionHandler(es service.MemoryExtractionService) *MemorySuggestionHandler {
+	return &MemorySuggestionHandler{
+		extractionService: es,
+	}
+}
+
+// RegisterRoutes 将记忆建议相关的路由注册到 Gin 引擎。
+func (h *MemorySuggestionHandler) RegisterRoutes(router *gin.RouterGroup) {
+	suggestionGroup := router.Group("/memory/suggestions")
+	{
+		suggestionGroup.GET("", h.handleListSuggestions)                           // GET /api/v1/memory/suggestions?status=pending
+		suggestionGroup.POST("/:suggestion_id/approve", h.handleApproveSuggestion) // POST /api/v1/memory/suggestions/{suggestion_id}/approve
+		suggestionGroup.POST("/:suggestion_id/reject", h.handleRejectSuggestion)   // POST /api/v1/memory/suggestions/{suggestion_id}/reject
+	}
+}
+
+// handleListSuggestions 处理列出记忆建议的请求。默认只返回待确认的建议，status=all 返回所有建议。
+func (h *MemorySuggestionHandler) handleListSuggestions(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (ListMemorySuggestions)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	status := entity.MemorySuggestionStatus(c.DefaultQuery("status", string(entity.MemorySuggestionPending)))
+	if status == "all" {
+		status = ""
+	}
+	suggestions, err := h.extractionService.ListSuggestions(c.Request.Context(), userID, status)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "获取记忆建议时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// handleApproveSuggestion 处理批准记忆建议的请求，返回写入的结构化记忆。
+func (h *MemorySuggestionHandler) handleApproveSuggestion(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (ApproveMemorySuggestion)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	memory, err := h.extractionService.ApproveSuggestion(c.Request.Context(), userID, c.Param("suggestion_id"))
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "批准记忆建议时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, memory)
+}
+
+// handleRejectSuggestion 处理拒绝记忆建议的请求，返回更新后的建议。
+func (h *MemorySuggestionHandler) handleRejectSuggestion(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (RejectMemorySuggestion)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	suggestion, err := h.extractionService.RejectSuggestion(c.Request.Context(), userID, c.Param("suggestion_id"))
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "拒绝记忆建议时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, suggestion)
+}
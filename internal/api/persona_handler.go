@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// PersonaHandler 负责处理人设管理相关的 API 请求。
+type PersonaHandler struct {
+	personaService service.PersonaService
+}
+
+// NewPersonaHandler 创建一个新的 PersonaHandler 实例。
+func NewPersonaHandler(ps service.PersonaService) *PersonaHandler {
+	return &PersonaHandler{
+		personaService: ps,
+	}
+}
+
+// RegisterRoutes 将人设相关的路由注册到 Gin 引擎。
+func (h *PersonaHandler) RegisterRoutes(router *gin.RouterGroup) {
+	personaGroup := router.Group("/personas")
+	{
+		personaGroup.GET("", h.handleListPersonas)                 // GET /api/v1/personas
+		personaGroup.POST("", h.handleCreatePersona)               // POST /api/v1/personas
+		personaGroup.PUT("/default", h.handleSetDefaultPersona)    // PUT /api/v1/personas/default
+		personaGroup.GET("/:persona_id", h.handleGetPersona)       // GET /api/v1/personas/{persona_id}
+		personaGroup.PUT("/:persona_id", h.handleUpdatePersona)    // PUT /api/v1/personas/{persona_id}
+		personaGroup.DELETE("/:persona_id", h.handleDeletePersona) // DELETE /api/v1/personas/{persona_id}
+	}
+}
+
+// SetDefaultPersonaRequest 定义了设置默认人设请求的 JSON 结构体。
+type SetDefaultPersonaRequest struct {
+	PersonaID string `json:"persona_id"` // 为空时取消默认人设
+}
+
+// handleListPersonas 处理列出用户所有人设的请求。
+func (h *PersonaHandler) handleListPersonas(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (ListPersonas)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	personas, err := h.personaService.ListPersonas(c.Request.Context(), userID)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "获取人设列表时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"personas": personas})
+}
+
+// handleCreatePersona 处理创建人设的请求。
+func (h *PersonaHandler) handleCreatePersona(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (CreatePersona)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	var req entity.PersonaInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c.Request.Context(), "无效的创建人设请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	persona, err := h.personaService.CreatePersona(c.Request.Context(), userID, &req)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "创建人设时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusCreated, persona)
+}
+
+// handleGetPersona 处理获取单个人设的请求。
+func (h *PersonaHandler) handleGetPersona(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (GetPersona)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	persona, err := h.personaService.GetPersona(c.Request.Context(), userID, c.Param("persona_id"))
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "获取人设时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, persona)
+}
+
+// handleUpdatePersona 处理修改人设的请求 (整体替换人设的设置)。
+func (h *PersonaHandler) handleUpdatePersona(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (UpdatePersona)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	var req entity.PersonaInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c.Request.Context(), "无效的修改人设请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	persona, err := h.personaService.UpdatePersona(c.Request.Context(), userID, c.Param("persona_id"), &req)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "修改人设时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, persona)
+}
+
+// handleDeletePersona 处理删除人设的请求。
+func (h *PersonaHandler) handleDeletePersona(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (DeletePersona)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	if err := h.personaService.DeletePersona(c.Request.Context(), userID, c.Param("persona_id")); err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "删除人设时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleSetDefaultPersona 处理设置或取消默认人设的请求。
+func (h *PersonaHandler) handleSetDefaultPersona(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (SetDefaultPersona)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	var req SetDefaultPersonaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.WarnContext(c.Request.Context(), "无效的设置默认人设请求体", "error", err)
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体无效")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	if err := h.personaService.SetDefaultPersona(c.Request.Context(), userID, req.PersonaID); err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "设置默认人设时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// headerUploadOffset 和 headerUploadLength 沿用 tus 协议的头部名称。
+	headerUploadOffset = "Upload-Offset"
+	headerUploadLength = "Upload-Length"
+	// offsetOctetStream 是 PATCH 请求体要求的 Content-Type (同 tus)。
+	offsetOctetStream = "application/offset+octet-stream"
+)
+
+// ResumableUploadHandler 负责处理可恢复分块上传 (tus 风格) 的 API 请求。
+type ResumableUploadHandler struct {
+	uploadService service.ResumableUploadService
+}
+
+// NewResumableUploadHandler 创建一个新的 ResumableUploadHandler 实例。
+func NewResumableUploadHandler(us service.ResumableUploadService) *ResumableUploadHandler {
+	return &ResumableUploadHandler{
+		uploadService: us,
+	}
+}
+
+// CreateUploadRequest 定义了创建上传会话的请求体。
+type CreateUploadRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	Size        *int64 `json:"size" binding:"required"`
+	ContentType string `json:"content_type"`
+}
+
+// RegisterRoutes 将可恢复上传相关的路由注册到 Gin 引擎。
+func (h *ResumableUploadHandler) RegisterRoutes(router *gin.RouterGroup) {
+	uploadsGroup := router.Group("/uploads")
+	{
+		uploadsGroup.POST("", h.handleCreateUpload)                       // POST /api/v1/uploads
+		uploadsGroup.HEAD("/:upload_id", h.handleHeadUpload)              // HEAD /api/v1/uploads/{upload_id} (查询 Upload-Offset)
+		uploadsGroup.GET("/:upload_id", h.handleGetUpload)                // GET /api/v1/uploads/{upload_id}
+		uploadsGroup.PATCH("/:upload_id", h.handlePatchUpload)            // PATCH /api/v1/uploads/{upload_id} (Upload-Offset + 字节)
+		uploadsGroup.POST("/:upload_id/finalize", h.handleFinalizeUpload) // POST /api/v1/uploads/{upload_id}/finalize
+		uploadsGroup.DELETE("/:upload_id", h.handleAbortUpload)           // DELETE /api/v1/uploads/{upload_id}
+	}
+}
+
+// handleCreateUpload 处理创建上传会话的请求。
+func (h *ResumableUploadHandler) handleCreateUpload(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (CreateUpload)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	ctx := c.Request.Context()
+
+	var req CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		appErr := apperr.Wrap(err, apperr.CodeInvalidArgument, "请求体格式错误 (需要 filename 和 size)")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	session, err := h.uploadService.CreateUpload(ctx, userID, req.Filename, req.ContentType, *req.Size)
+	if err != nil {
+		respondUploadError(c, err, "创建上传会话时发生未知错误")
+		return
+	}
+
+	c.Header("Location", c.Request.URL.Path+"/"+session.ID)
+	c.Header(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+	c.JSON(http.StatusCreated, session)
+}
+
+// handleHeadUpload 通过响应头返回当前 Upload-Offset，供客户端断线后恢复上传。
+func (h *ResumableUploadHandler) handleHeadUpload(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	session, err := h.uploadService.GetUpload(c.Request.Context(), userID, c.Param("upload_id"))
+	if err != nil {
+		c.Status(apperr.GetHTTPStatus(err)) // HEAD 响应没有响应体
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+	c.Header(headerUploadLength, strconv.FormatInt(session.TotalSize, 10))
+	c.Status(http.StatusOK)
+}
+
+// handleGetUpload 处理获取上传会话详情的请求。
+func (h *ResumableUploadHandler) handleGetUpload(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (GetUpload)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	session, err := h.uploadService.GetUpload(c.Request.Context(), userID, c.Param("upload_id"))
+	if err != nil {
+		respondUploadError(c, err, "获取上传会话时发生未知错误")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, session)
+}
+
+// handlePatchUpload 处理追加字节区间的请求。
+// 请求头 Upload-Offset 必须等于服务器当前的偏移，请求体为原始字节 (Content-Type: application/offset+octet-stream)。
+func (h *ResumableUploadHandler) handlePatchUpload(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (PatchUpload)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	ctx := c.Request.Context()
+
+	if c.ContentType() != offsetOctetStream {
+		appErr := apperr.New(apperr.CodeInvalidArgument, "Content-Type 必须为 "+offsetOctetStream).
+			WithHTTPStatus(http.StatusUnsupportedMediaType)
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		appErr := apperr.New(apperr.CodeInvalidArgument, "缺少或无效的 Upload-Offset 请求头")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	session, err := h.uploadService.AppendChunk(ctx, userID, c.Param("upload_id"), offset, c.Request.Body)
+	if err != nil {
+		respondUploadError(c, err, "写入上传数据时发生未知错误")
+		return
+	}
+
+	c.Header(headerUploadOffset, strconv.FormatInt(session.Offset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// handleFinalizeUpload 处理完成上传的请求：合并数据为文档并触发后台处理。
+func (h *ResumableUploadHandler) handleFinalizeUpload(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (FinalizeUpload)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	doc, taskID, err := h.uploadService.FinalizeUpload(c.Request.Context(), userID, c.Param("upload_id"))
+	if err != nil {
+		respondUploadError(c, err, "完成上传时发生未知错误")
+		return
+	}
+
+	// 与 POST /upload 的响应保持一致 (HTTP 202 Accepted 表示后台处理中)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "文件上传成功，正在后台处理中...",
+		"filename": doc.OriginalFilename,
+		"doc_id":   doc.ID,
+		"task_id":  taskID,
+	})
+}
+
+// handleAbortUpload 处理取消上传的请求。
+func (h *ResumableUploadHandler) handleAbortUpload(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (AbortUpload)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	if err := h.uploadService.AbortUpload(c.Request.Context(), userID, c.Param("upload_id")); err != nil {
+		respondUploadError(c, err, "取消上传时发生未知错误")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "上传已取消"})
+}
+
+// respondUploadError 将服务层错误写为 JSON 响应，未知错误包装为内部错误。
+func respondUploadError(c *gin.Context, err error, fallbackMessage string) {
+	appErr, ok := err.(*apperr.AppError)
+	if !ok {
+		appErr = apperr.Wrap(err, apperr.CodeInternal, fallbackMessage)
+	}
+	c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// SearchHandler 负责处理搜索对话消息的 API 请求。
+type SearchHandler struct {
+	searchService service.MessageSearchService
+}
+
+// NewSearchHandler 创建一个新的 SearchHandler 实例。
+func NewSearchHandler(ss service.MessageSearchService) *SearchHandler {
+	return &SearchHandler{
+		searchService: ss,
+	}
+}
+
+// RegisterRoutes 将搜索相关的路由注册到 Gin 引擎。
+func (h *SearchHandler) RegisterRoutes(router *gin.RouterGroup) {
+	searchGroup := router.Group("/search")
+	{
+		searchGroup.GET("/messages", h.handleSearchMessages) // GET /api/v1/search/messages?q=...&mode=...&conversation_id=...&role=...&from=...&to=...
+	}
+}
+
+// handleSearchMessages 处理搜索对话消息的请求。
+func (h *SearchHandler) handleSearchMessages(c *gin.Context) {
+	userID, ok := GetUserIDFromContext(c)
+	if !ok {
+		logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (SearchMessages)")
+		appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+
+	query := &entity.MessageSearchQuery{
+		Query:          c.Query("q"),
+		Mode:           c.Query("mode"),
+		ConversationID: c.Query("conversation_id"),
+		Role:           entity.SenderRole(c.Query("role")),
+	}
+	var appErr *apperr.AppError
+	if query.After, appErr = parseOptionalTime("from", c.Query("from")); appErr != nil {
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	if query.Before, appErr = parseOptionalTime("to", c.Query("to")); appErr != nil {
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	// 无效的分页参数使用默认值 (由 service 层填充和限制)
+	query.Limit, _ = strconv.Atoi(c.Query("limit"))
+	query.Offset, _ = strconv.Atoi(c.Query("offset"))
+
+	results, err := h.searchService.Search(c.Request.Context(), userID, query)
+	if err != nil {
+		appErr, ok := err.(*apperr.AppError)
+		if !ok {
+			appErr = apperr.Wrap(err, apperr.CodeInternal, "搜索消息时发生未知错误")
+		}
+		c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"mode":    query.Mode,
+		"results": results,
+	})
+}
+
+// parseOptionalTime 解析 RFC 3339 格式的可选时间参数，value 为空时返回 nil。
+func parseOptionalTime(name string, value string) (*time.Time, *apperr.AppError) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, name+" 参数必须是 RFC 3339 格式的时间").WithDetails(name + "=" + value)
+	}
+	return &t, nil
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// TaskAdminHandler 负责处理查看、重试和删除失败任务 (死信队列) 的 API 请求。
+// 普通用户只能访问自己文档的任务；管理员接口可以访问所有用户的任务。
+type TaskAdminHandler struct {
+	taskAdminService service.TaskAdminService
+}
+
+// NewTaskAdminHandler 创建一个新的 TaskAdminHandler 实例。
+func NewTaskAdminHandler(tas service.TaskAdminService) *TaskAdminHandler {
+	return &TaskAdminHandler{
+		taskAdminService: tas,
+	}
+}
+
+// taskScope 返回请求可访问的用户范围，空字符串表示所有用户。
+type taskScope func(c *gin.Context) (string, bool)
+
+// RegisterRoutes 将用户范围的失败任务路由注册到 Gin 引擎 (只能访问当前用户的任务)。
+func (h *TaskAdminHandler) RegisterRoutes(router *gin.RouterGroup) {
+	h.registerFailedTaskRoutes(router, GetUserIDFromContext)
+}
+
+// RegisterAdminRoutes 将管理员的失败任务路由注册到 Gin 引擎。
+// router 需要已经应用 Authenticate 和 RequireAdmin 中间件。
+func (h *TaskAdminHandler) RegisterAdminRoutes(router *gin.RouterGroup) {
+	h.registerFailedTaskRoutes(router, func(c *gin.Context) (string, bool) {
+		return c.Query("user_id"), true // 可选按用户过滤
+	})
+}
+
+// registerFailedTaskRoutes 注册 /tasks/failed 下的路由，scope 决定请求可以访问哪些用户的任务。
+func (h *TaskAdminHandler) registerFailedTaskRoutes(router *gin.RouterGroup, scope taskScope) {
+	failedGroup := router.Group("/tasks/failed")
+	{
+		failedGroup.GET("", h.handleListFailedTasks(scope))              // GET .../tasks/failed?state=retry|archived&limit=...&offset=...
+		failedGroup.GET("/:task_id", h.handleGetFailedTask(scope))       // GET .../tasks/failed/{task_id}
+		failedGroup.POST("/:task_id/retry", h.handleRetryTask(scope))    // POST .../tasks/failed/{task_id}/retry
+		failedGroup.DELETE("/:task_id", h.handleDeleteFailedTask(scope)) // DELETE .../tasks/failed/{task_id}
+	}
+}
+
+// handleListFailedTasks 处理列出失败任务的请求。
+func (h *TaskAdminHandler) handleListFailedTasks(scope taskScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := scope(c)
+		if !ok {
+			logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (ListFailedTasks)")
+			appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+
+		// 获取分页参数
+		limit, errL := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		offset, errO := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if errL != nil || limit <= 0 {
+			limit = 20
+		}
+		if limit > 100 {
+			limit = 100
+		}
+		if errO != nil || offset < 0 {
+			offset = 0
+		}
+		state := entity.FailedTaskState(c.Query("state"))
+
+		tasks, total, truncated, err := h.taskAdminService.ListFailedTasks(c.Request.Context(), userID, state, limit, offset)
+		if err != nil {
+			respondTaskAdminError(c, err, "获取失败任务列表时发生未知错误")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"tasks":     tasks,
+			"total":     total,
+			"truncated": truncated, // 失败任务过多时只检查了一部分，total 不完整
+			"limit":     limit,
+			"offset":    offset,
+		})
+	}
+}
+
+// handleGetFailedTask 处理获取单个失败任务及其失败历史的请求。
+func (h *TaskAdminHandler) handleGetFailedTask(scope taskScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := scope(c)
+		if !ok {
+			logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (GetFailedTask)")
+			appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+
+		task, err := h.taskAdminService.GetFailedTask(c.Request.Context(), userID, c.Param("task_id"))
+		if err != nil {
+			respondTaskAdminError(c, err, "获取失败任务时发生未知错误")
+			return
+		}
+
+		c.JSON(http.StatusOK, task)
+	}
+}
+
+// handleRetryTask 处理重试失败任务的请求。
+func (h *TaskAdminHandler) handleRetryTask(scope taskScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := scope(c)
+		if !ok {
+			logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (RetryTask)")
+			appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+		taskID := c.Param("task_id")
+
+		newTaskID, err := h.taskAdminService.RetryTask(c.Request.Context(), userID, taskID)
+		if err != nil {
+			respondTaskAdminError(c, err, "重试任务时发生未知错误")
+			return
+		}
+
+		// 返回成功响应 (HTTP 202 Accepted 表示已重新入队)
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":      "任务已重新入队",
+			"task_id":      newTaskID,
+			"retried_from": taskID,
+		})
+	}
+}
+
+// handleDeleteFailedTask 处理删除失败任务的请求。
+func (h *TaskAdminHandler) handleDeleteFailedTask(scope taskScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := scope(c)
+		if !ok {
+			logger.ErrorContext(c.Request.Context(), "无法从上下文中获取用户 ID (DeleteFailedTask)")
+			appErr := apperr.New(apperr.CodeInternal, "无法处理请求，缺少用户信息")
+			c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+			return
+		}
+
+		if err := h.taskAdminService.DeleteTask(c.Request.Context(), userID, c.Param("task_id")); err != nil {
+			respondTaskAdminError(c, err, "删除任务时发生未知错误")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "任务已删除"})
+	}
+}
+
+// respondTaskAdminError 将服务层错误转换为 JSON 错误响应。
+func respondTaskAdminError(c *gin.Context, err error, fallbackMessage string) {
+	appErr, ok := err.(*apperr.AppError)
+	if !ok {
+		appErr = apperr.Wrap(err, apperr.CodeInternal, fallbackMessage)
+	}
+	c.JSON(appErr.HTTPStatus, gin.H{"error": appErr})
+}
@@ -6,9 +6,44 @@ import "time"
 type Conversation struct {
 	ID            string    `json:"id" db:"id"`
 	UserID        string    `json:"user_id" db:"user_id"`
-	Title         string    `json:"title" db:"title"` // 对话标题 (可以考虑后续实现)
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
-	LastUpdatedAt time.Time `json:"last_updated_at" db:"last_updated_at"`
+	Title         string    `json:"title" db:"title"`                     // 对话标题 (可以为空)
+	TitleSource   string    `json:"title_source" db:"title_source"`       // 标题来源: none、auto (LLM 生成) 或 user (用户设置)
+	Archived      bool      `json:"archived" db:"archived"`               // 是否已归档 (默认不出现在对话列表中)
+	Pinned        bool      `json:"pinned" db:"pinned"`                   // 是否置顶
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`           // 创建时间
+	LastUpdatedAt time.Time `json:"last_updated_at" db:"last_message_at"` // 最后一条消息的时间 (最后活动时间)
+	ActiveLeafID  *string   `json:"active_leaf_id" db:"active_leaf_id"`   // 当前分支的最后一条消息 (没有消息时为 null)
+	PersonaID     *string   `json:"persona_id" db:"persona_id"`           // 对话选择的人设 (为 null 时使用用户的默认人设)
+}
+
+// MaxConversationTitleLength 是对话标题的最大长度 (字符数)。
+const MaxConversationTitleLength = 255
+
+// 对话标题的来源。自动生成的标题不会覆盖用户手动设置的标题。
+const (
+	ConversationTitleSourceNone = "none" // 尚无标题
+	ConversationTitleSourceAuto = "auto" // 由 LLM 自动生成
+	ConversationTitleSourceUser = "user" // 由用户手动设置
+)
+
+// ConversationUpdate 描述对对话的部分更新，nil 字段表示不修改。
+type ConversationUpdate struct {
+	Title    *string `json:"title,omitempty"`
+	Archived *bool   `json:"archived,omitempty"`
+	Pinned   *bool   `json:"pinned,omitempty"`
+	// PersonaID 切换对话使用的人设，空字符串表示取消选择 (使用用户的默认人设)
+	PersonaID *string `json:"persona_id,omitempty"`
+}
+
+// IsEmpty 返回是否没有需要修改的字段。
+func (u *ConversationUpdate) IsEmpty() bool {
+	return u.Title == nil && u.Archived == nil && u.Pinned == nil && u.PersonaID == nil
+}
+
+// ConversationFilter 描述对话列表的过滤条件，nil 字段表示不过滤。
+type ConversationFilter struct {
+	Archived *bool // 只列出 (未) 归档的对话
+	Pinned   *bool // 只列出 (未) 置顶的对话
 }
 
 // ChatMessage 定义用户发送的聊天消息结构体
@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// DocumentChunk.Metadata 中由消息导入器 (邮件、聊天记录) 写入的键。
+// 检索时可以通过 ChunkFilter 按这些字段过滤。
+const (
+	ChunkMetaSourceFormat  = "source_format"  // 来源格式，例如 "mbox"、"eml"、"telegram"、"whatsapp"
+	ChunkMetaSender        = "sender"         // 发送者显示名称 (没有名称时为地址)
+	ChunkMetaSenderAddress = "sender_address" // 发送者地址 (邮箱地址或聊天平台的用户 ID)
+	ChunkMetaRecipients    = "recipients"     // 收件人地址列表 (仅邮件)
+	ChunkMetaSentAt        = "sent_at"        // 发送时间 (RFC 3339, UTC)，合并的聊天片段为第一条消息的时间
+	ChunkMetaSentUntil     = "sent_until"     // 合并的聊天片段中最后一条消息的发送时间 (RFC 3339, UTC，仅聊天记录)
+	ChunkMetaThreadID      = "thread_id"      // 邮件会话或聊天的 ID
+	ChunkMetaThreadName    = "thread_name"    // 聊天名称 (仅聊天记录)
+	ChunkMetaSubject       = "subject"        // 邮件主题
+	ChunkMetaMessageID     = "message_id"     // 消息 ID
+)
+
+// DocumentChunk.Metadata 中由 OCR 写入的键。
+const (
+	ChunkMetaExtractionMethod = "extraction_method" // 文本的提取方式，OCR 识别的块为 "ocr"
+	ChunkMetaPageNumber       = "page_number"       // 块所在的页码 (从 1 开始)
+	ChunkMetaOCRConfidence    = "ocr_confidence"    // 该页的 OCR 平均置信度 (0-1)
+)
+
+// ChunkFilter 定义检索文档块时基于元数据的过滤条件，零值字段不参与过滤。
+type ChunkFilter struct {
+	Sender     string     // 匹配 sender 或 sender_address
+	ThreadID   string     // 匹配 thread_id
+	SentAfter  *time.Time // sent_until (没有时为 sent_at) >= SentAfter，时间范围与过滤条件重叠的聊天片段也会匹配
+	SentBefore *time.Time // sent_at < SentBefore
+}
+
+// IsEmpty 返回过滤条件是否为空。
+func (f *ChunkFilter) IsEmpty() bool {
+	return f == nil || (f.Sender == "" && f.ThreadID == "" && f.SentAfter == nil && f.SentBefore == nil)
+}
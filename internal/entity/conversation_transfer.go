@@ -0,0 +1,61 @@
+package entity
+
+import "time"
+
+// 对话导出格式。
+const (
+	ExportFormatMarkdown = "markdown" // 当前分支的可读文本，AI 回复附带引用来源
+	ExportFormatJSON     = "json"     // ConversationArchive，包含所有分支的消息和元数据
+	ExportFormatZip      = "zip"      // 包含 conversations.json 和每个对话一个 Markdown 文件的压缩包
+)
+
+// ConversationArchiveVersion 是 ConversationArchive 的格式版本，结构发生不兼容的变化时递增。
+const ConversationArchiveVersion = 1
+
+// ConversationArchive 是 JSON 导出的顶层结构。
+type ConversationArchive struct {
+	FormatVersion int                   `json:"format_version"`
+	ExportedAt    time.Time             `json:"exported_at"`
+	Conversations []*ConversationExport `json:"conversations"`
+	// Documents 是消息引用来源中出现的文档 ID 到文件名的映射 (已删除的文档不在其中)。
+	Documents map[string]string `json:"documents"`
+}
+
+// ConversationExport 是单个对话的导出内容。
+type ConversationExport struct {
+	Conversation *Conversation `json:"conversation"`
+	Messages     []*Message    `json:"messages"` // 所有分支的消息，按时间升序排列
+}
+
+// ExportFile 是生成的导出文件。
+type ExportFile struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ConversationImportReport 汇总一次对话导入的结果。
+type ConversationImportReport struct {
+	Source                string   `json:"source"`                 // 导入来源，例如 "chatgpt"
+	ConversationsImported int      `json:"conversations_imported"` // 新建或补全的对话数
+	ConversationsSkipped  int      `json:"conversations_skipped"`  // 已经完整导入过或没有可导入消息的对话数
+	MessagesImported      int      `json:"messages_imported"`
+	Errors                []string `json:"errors,omitempty"` // 无法导入的对话 (不影响其他对话)
+}
+
+// ConversationImportStatus 是导入任务的当前状态。
+type ConversationImportStatus struct {
+	TaskID string                    `json:"task_id"`
+	State  string                    `json:"state"` // Asynq 任务状态: pending、active、retry、archived、completed 等
+	Report *ConversationImportReport `json:"report,omitempty"`
+	Error  string                    `json:"error,omitempty"` // 最后一次失败的原因
+}
+
+// ConversationImportFile 记录一个等待导入任务处理的上传文件，对应 conversation_import_files 表。
+// 孤立文件对账时，导入任务仍在队列中的文件视为被引用。
+type ConversationImportFile struct {
+	StoredPath string    `json:"stored_path"`
+	UserID     string    `json:"user_id"`
+	TaskID     string    `json:"task_id"` // 导入任务入队前为空
+	CreatedAt  time.Time `json:"created_at"`
+}
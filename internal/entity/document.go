@@ -20,6 +20,16 @@ type Document struct {
 	ProcessingStatus TaskStatus `json:"processing_status"`  // 文件处理状态 (关联 Task)
 	ProcessingTaskID *string    `json:"processing_task_id"` // 关联的处理任务 ID (string, e.g., Asynq ID)
 	ErrorMessage     string     `json:"error_message"`      // 处理失败时的错误信息
+	EncryptionKeyID  *string    `json:"encryption_key_id"`  // 包装该文件数据密钥的主密钥 ID (未加密时为 nil)
+	// 从 URL 导入的文档 (网页) 相关字段，上传的文件为 nil/0
+	SourceURL              *string    `json:"source_url"`               // 来源 URL
+	ContentHash            *string    `json:"content_hash"`             // 提取出的可读内容的 SHA-256，用于重新抓取时的变更检测
+	LastFetchedAt          *time.Time `json:"last_fetched_at"`          // 最后一次抓取时间
+	RecrawlIntervalMinutes int        `json:"recrawl_interval_minutes"` // 定期重新抓取的间隔 (分钟)，0 表示不重新抓取
+	NextCrawlAt            *time.Time `json:"next_crawl_at"`            // 下一次计划抓取的时间
+	// 从本地监视目录同步的文档相关字段，其他来源为 nil
+	SourcePath       *string    `json:"source_path"`        // 文件在 Worker 主机上的绝对路径
+	SourceModifiedAt *time.Time `json:"source_modified_at"` // 最后一次同步时文件的修改时间
 	// 可以添加文件哈希等字段用于去重
 	// FileHash         string     `json:"file_hash"`
 }
@@ -39,6 +49,29 @@ type DocumentChunk struct {
 	// ChunkHash  string          `json:"chunk_hash"`
 }
 
+// StorageUsage 描述用户的存储用量与上传限制。
+type StorageUsage struct {
+	UsedBytes          int64 `json:"used_bytes"`            // 已使用的存储字节数
+	QuotaBytes         int64 `json:"quota_bytes"`           // 存储配额，0 表示不限制
+	MaxUploadSizeBytes int64 `json:"max_upload_size_bytes"` // 单个文件的最大字节数
+}
+
+// FileSource 描述从本地文件系统导入的文件的来源信息。
+type FileSource struct {
+	Path       string    // 文件的绝对路径
+	ModifiedAt time.Time // 文件的修改时间
+}
+
+// FolderSyncResult 汇总一次目录同步的结果。
+type FolderSyncResult struct {
+	Added     int `json:"added"`     // 新导入的文件数
+	Updated   int `json:"updated"`   // 内容变化并重新索引的文件数
+	Unchanged int `json:"unchanged"` // 未变化的文件数
+	Deleted   int `json:"deleted"`   // 已从目录中消失并删除的文档数
+	Skipped   int `json:"skipped"`   // 跳过的文件数 (过大、类型不支持或仍在写入)
+	Failed    int `json:"failed"`    // 处理失败的文件数 (下次同步时重试)
+}
+
 // NewDocument 创建一个新的 Document 实例。
 func NewDocument(userID, originalFilename, storedPath string, fileSize int64, contentType string) *Document {
 	return &Document{
@@ -0,0 +1,254 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 事件总线的限制。
+const (
+	CloudEventsSpecVersion = "1.0"      // 支持的 CloudEvents 规范版本 (specversion)
+	MaxEventBodySize       = 512 * 1024 // 发布事件的请求体的最大字节数
+	MaxEventDataSize       = 256 * 1024 // 事件 data 序列化为 JSON 后的最大字节数
+	MaxEventSubscriptions  = 100        // 每个用户最多的订阅数
+	MaxEventExtensionCount = 20         // 每个事件最多的扩展属性数
+)
+
+// ErrEventDeliveryRejected 表示 webhook 投递重试也不会成功 (webhook 拒绝了事件或订阅已删除)，
+// Worker 不再重试该投递任务。
+var ErrEventDeliveryRejected = errors.New("webhook 投递被拒绝，不再重试")
+
+// EventSourceDreamHub 是 DreamHub 自身发布的事件的 source。
+const EventSourceDreamHub = "/dreamhub"
+
+// SystemEventTypePrefix 是 DreamHub 自身发布的事件类型的前缀，D-App 不能发布以它开头的事件。
+const SystemEventTypePrefix = "dreamhub."
+
+// DreamHub 自身发布的事件类型。
+const (
+	EventTypeChatCompleted   = "dreamhub.chat.completed"   // 一轮对话完成，AI 回复已保存，data 为 ChatCompletedEventData
+	EventTypeDocumentIndexed = "dreamhub.document.indexed" // 文档处理完成，可以被检索，data 为 DocumentIndexedEventData
+	EventTypeMemoryChanged   = "dreamhub.memory.changed"   // 结构化记忆被写入或删除，data 为 MemoryChangedEventData
+)
+
+// SystemEventVersions 是 DreamHub 自身发布的事件当前的 data 版本。
+// 字段只增不改：增加字段时提高次版本号，不兼容的修改需要提高主版本号。
+var SystemEventVersions = map[string]string{
+	EventTypeChatCompleted:   "1.0",
+	EventTypeDocumentIndexed: "1.0",
+	EventTypeMemoryChanged:   "1.0",
+}
+
+// Event 是事件总线上的一个事件，JSON 表示兼容 CloudEvents v1.0 的结构化模式 (structured content mode)，对应 events 表。
+// 除规范定义的属性外，dataversion (data 的 schema 版本，必填) 和 traceid 为 DreamHub 约定的扩展属性，
+// seq 为服务器分配的序号；其他扩展属性保存在 Extensions 中。
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	DataVersion     string          `json:"dataversion"`
+	TraceID         string          `json:"traceid,omitempty"`
+	Seq             int64           `json:"seq,omitempty"` // 发布时由服务器分配，严格递增
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"` // 不支持，仅用于拒绝二进制 data
+
+	UserID     string         `json:"-"`
+	DataMajor  int            `json:"-"` // DataVersion 的主版本号
+	Extensions map[string]any `json:"-"` // 其他扩展属性，JSON 中与规范属性位于同一层
+	CreatedAt  time.Time      `json:"-"`
+}
+
+// eventAttributeNames 是 Event 中具名字段对应的属性，其他属性都是扩展属性。
+var eventAttributeNames = map[string]bool{
+	"specversion": true, "id": true, "source": true, "type": true, "subject": true, "time": true,
+	"datacontenttype": true, "dataschema": true, "dataversion": true, "traceid": true, "seq": true,
+	"data": true, "data_base64": true,
+}
+
+// eventJSON 与 Event 字段相同但没有 JSON 方法，用于编解码具名字段。
+type eventJSON Event
+
+// MarshalJSON 将扩展属性与规范属性输出在同一层。
+func (e Event) MarshalJSON() ([]byte, error) {
+	base, err := json.Marshal(eventJSON(e))
+	if err != nil || len(e.Extensions) == 0 {
+		return base, err
+	}
+	attrs := make(map[string]json.RawMessage, len(e.Extensions)+12)
+	if err := json.Unmarshal(base, &attrs); err != nil {
+		return nil, err
+	}
+	for name, value := range e.Extensions {
+		if eventAttributeNames[name] {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		attrs[name] = raw
+	}
+	return json.Marshal(attrs)
+}
+
+// UnmarshalJSON 解析具名字段，其余属性作为扩展属性保存在 Extensions 中。
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var decoded eventJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return err
+	}
+	for name, raw := range attrs {
+		if eventAttributeNames[name] {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if decoded.Extensions == nil {
+			decoded.Extensions = make(map[string]any)
+		}
+		decoded.Extensions[name] = value
+	}
+	*e = Event(decoded)
+	return nil
+}
+
+// MatchEventType 返回事件类型是否符合订阅的类型模式。模式为 "*" (所有事件)、以 ".*" 结尾的前缀或完整的事件类型。
+func MatchEventType(pattern string, eventType string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(eventType, prefix)
+	}
+	return pattern == eventType
+}
+
+// EventFilter 是列出事件时的过滤条件，零值字段表示不过滤。
+type EventFilter struct {
+	TypePatterns  []string // 符合任一模式的事件，格式同 MatchEventType
+	SchemaVersion *int     // data 的主版本号
+	After         int64    // 只返回 seq 大于该值的事件
+	Limit         int
+}
+
+// EventDeliveryMode 是订阅接收事件的方式。
+type EventDeliveryMode string
+
+const (
+	EventDeliverySSE     EventDeliveryMode = "sse"     // 客户端通过 Server-Sent Events 连接接收
+	EventDeliveryWebhook EventDeliveryMode = "webhook" // 服务器将事件 POST 到 webhook 地址，失败时重试
+)
+
+// EventSubscription 是按事件类型模式订阅事件的订阅，对应 event_subscriptions 表。
+type EventSubscription struct {
+	ID            string            `json:"id"`
+	UserID        string            `json:"user_id"`
+	TypePattern   string            `json:"type"`
+	SchemaVersion *int              `json:"schema_version"` // 只接收该主版本的事件，nil 表示不限制
+	Delivery      EventDeliveryMode `json:"delivery"`
+	WebhookURL    string            `json:"webhook_url,omitempty"`
+	// Secret 是 webhook 请求签名的密钥，只在创建订阅时返回。
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches 返回事件是否应投递给订阅。
+func (s *EventSubscription) Matches(event *Event) bool {
+	if s.SchemaVersion != nil && *s.SchemaVersion != event.DataMajor {
+		return false
+	}
+	return MatchEventType(s.TypePattern, event.Type)
+}
+
+// EventSubscriptionInput 是创建订阅时客户端提交的字段。
+type EventSubscriptionInput struct {
+	TypePattern   string            `json:"type"`
+	SchemaVersion *int              `json:"schema_version,omitempty"`
+	Delivery      EventDeliveryMode `json:"delivery"`
+	WebhookURL    string            `json:"webhook_url,omitempty"`
+	Secret        string            `json:"secret,omitempty"` // 为空时自动生成
+}
+
+// EventDeliveryStatus 是一次 webhook 投递的状态。
+type EventDeliveryStatus string
+
+const (
+	EventDeliveryPending   EventDeliveryStatus = "pending"   // 等待投递或等待重试
+	EventDeliverySucceeded EventDeliveryStatus = "succeeded" // webhook 返回了 2xx
+	EventDeliveryFailed    EventDeliveryStatus = "failed"    // 重试次数用尽或 webhook 拒绝了事件
+)
+
+// EventDelivery 记录一个事件向一个 webhook 订阅的投递，对应 event_deliveries 表。
+type EventDelivery struct {
+	ID             string              `json:"id"`
+	UserID         string              `json:"-"`
+	SubscriptionID string              `json:"subscription_id"`
+	EventSeq       int64               `json:"event_seq"`
+	EventID        string              `json:"event_id"`
+	EventType      string              `json:"event_type"`
+	Status         EventDeliveryStatus `json:"status"`
+	Attempts       int                 `json:"attempts"`
+	LastStatusCode *int                `json:"last_status_code,omitempty"` // 最近一次尝试的 HTTP 状态码，没有收到响应时为空
+	LastError      string              `json:"last_error,omitempty"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+	DeliveredAt    *time.Time          `json:"delivered_at,omitempty"`
+}
+
+// ChatCompletedEventData 是 dreamhub.chat.completed 事件的 data。
+type ChatCompletedEventData struct {
+	ConversationID string `json:"conversation_id"`
+	UserMessageID  string `json:"user_message_id"`
+	MessageID      string `json:"message_id"` // AI 回复的消息 ID
+	ModelName      string `json:"model_name,omitempty"`
+}
+
+// DocumentIndexedEventData 是 dreamhub.document.indexed 事件的 data。
+type DocumentIndexedEventData struct {
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+	ChunkCount int    `json:"chunk_count"`
+}
+
+// MemoryChangedEventData 是 dreamhub.memory.changed 事件的 data。一次操作 (例如导入) 写入的所有记忆在同一个事件中。
+type MemoryChangedEventData struct {
+	Changes []MemoryChange `json:"changes"`
+}
+
+// MemoryChange 是一条结构化记忆的变化。
+type MemoryChange struct {
+	Action    string       `json:"action"` // created、updated 或 deleted
+	Key       string       `json:"key"`
+	Namespace string       `json:"namespace,omitempty"`
+	Version   int          `json:"version,omitempty"` // 写入后的版本，删除时为空
+	Source    MemorySource `json:"source,omitempty"`
+}
+
+// 记忆变化的类型 (MemoryChange.Action)。
+const (
+	MemoryChangeCreated = "created"
+	MemoryChangeUpdated = "updated"
+	MemoryChangeDeleted = "deleted"
+)
+
+// NewMemoryChange 返回写入 memory 后的变化，版本为 1 表示新建。
+func NewMemoryChange(memory *StructuredMemory) MemoryChange {
+	action := MemoryChangeUpdated
+	if memory.Version == 1 {
+		action = MemoryChangeCreated
+	}
+	return MemoryChange{Action: action, Key: memory.Key, Namespace: memory.Namespace, Version: memory.Version, Source: memory.Source}
+}
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// FileDataKey 代表一个已加密存储文件的数据密钥 (信封加密)。
+// 文件内容使用随机生成的数据密钥加密，数据密钥本身再由主密钥包装后保存。
+// 轮换主密钥时只需重新包装数据密钥，无需重写文件内容。
+type FileDataKey struct {
+	StoredPath string    `json:"stored_path"` // 文件在存储中的路径 (与 Document.StoredPath 对应)
+	KeyID      string    `json:"key_id"`      // 包装数据密钥所用的主密钥 ID
+	WrappedKey []byte    `json:"-"`           // 被主密钥加密后的数据密钥 (nonce + ciphertext)
+	CreatedAt  time.Time `json:"created_at"`  // 创建时间
+	UpdatedAt  time.Time `json:"updated_at"`  // 最后一次重新包装的时间
+}
@@ -0,0 +1,31 @@
+package entity
+
+// 生成参数的取值范围。
+const (
+	MinTemperature   = 0.0
+	MaxTemperature   = 2.0
+	MinTopP          = 0.0
+	MaxTopP          = 1.0
+	MaxStopSequences = 4 // 最多 4 个停止序列 (与 OpenAI API 一致)
+)
+
+// 回复格式 (GenerationOptions.ResponseFormat)。
+const (
+	ResponseFormatText = "text"        // 普通文本 (默认)
+	ResponseFormatJSON = "json_object" // JSON 模式：回复必须是一个合法的 JSON 对象
+)
+
+// GenerationOptions 是调用 LLM 时的生成参数，nil 或零值字段表示不设置 (由 LLMProvider 使用默认值)。
+type GenerationOptions struct {
+	Temperature    *float64 `json:"temperature,omitempty"`     // 采样温度
+	TopP           *float64 `json:"top_p,omitempty"`           // 核采样概率
+	MaxTokens      *int     `json:"max_tokens,omitempty"`      // 回复的最大 token 数 (上限取决于模型)
+	Stop           []string `json:"stop,omitempty"`            // 停止序列
+	Seed           *int     `json:"seed,omitempty"`            // 随机种子，与 temperature 0 一起使用可以得到尽量确定的输出
+	ResponseFormat string   `json:"response_format,omitempty"` // ResponseFormatText 或 ResponseFormatJSON
+}
+
+// JSONMode 返回是否要求模型以 JSON 对象回复。
+func (o *GenerationOptions) JSONMode() bool {
+	return o != nil && o.ResponseFormat == ResponseFormatJSON
+}
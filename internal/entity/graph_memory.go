@@ -0,0 +1,131 @@
+package entity
+
+import "time"
+
+// 图记忆的限制。
+const (
+	MaxGraphLabelLength        = 500   // 节点标签的最大长度 (字符)
+	MaxGraphPropertiesSize     = 16384 // 节点或边的属性序列化为 JSON 后的最大字节数
+	DefaultGraphTraversalDepth = 3     // 查询祖先、后代和路径时默认的最大深度
+	MaxGraphTraversalDepth     = 10    // 查询祖先、后代和路径时允许的最大深度
+	MaxGraphPaths              = 100   // 一次最多返回的路径数
+	MaxGraphTraversalNodes     = 1000  // 查询祖先和后代时最多返回的节点数 (距离近的优先)
+	MaxGraphPathExpansions     = 10000 // 查找路径时最多扩展的部分路径数，避免在稠密的图中枚举指数级数量的路径
+)
+
+// GraphNodeType 是图记忆节点的类型 (PCAS 设计中的事件、决策、指令、结果和反馈)。
+type GraphNodeType string
+
+const (
+	GraphNodeEvent    GraphNodeType = "event"    // 发生的事情，例如用户发送的消息或处理完成的文档
+	GraphNodeDecision GraphNodeType = "decision" // 做出的决定
+	GraphNodeCommand  GraphNodeType = "command"  // 发出的指令
+	GraphNodeResult   GraphNodeType = "result"   // 执行的结果，例如 AI 的回复
+	GraphNodeFeedback GraphNodeType = "feedback" // 对结果的反馈
+)
+
+// Valid 返回节点类型是否受支持。
+func (t GraphNodeType) Valid() bool {
+	switch t {
+	case GraphNodeEvent, GraphNodeDecision, GraphNodeCommand, GraphNodeResult, GraphNodeFeedback:
+		return true
+	}
+	return false
+}
+
+// GraphEdgeType 是图记忆边的类型。边都是有向的，从原因 (或较早的节点) 指向结果 (或较晚的节点)。
+type GraphEdgeType string
+
+const (
+	GraphEdgeCauses      GraphEdgeType = "causes"       // 起点引起了终点，例如用户消息引起 AI 回复
+	GraphEdgeFollows     GraphEdgeType = "follows"      // 终点在序列中紧接在起点之后，例如同一分支上的下一轮交流
+	GraphEdgeInforms     GraphEdgeType = "informs"      // 起点为终点提供了信息，例如回复引用的文档
+	GraphEdgeEvaluatedBy GraphEdgeType = "evaluated_by" // 终点是对起点的反馈
+)
+
+// Valid 返回边类型是否受支持。
+func (t GraphEdgeType) Valid() bool {
+	switch t {
+	case GraphEdgeCauses, GraphEdgeFollows, GraphEdgeInforms, GraphEdgeEvaluatedBy:
+		return true
+	}
+	return false
+}
+
+// 自动记录的节点引用的对象类型 (GraphNode.RefType)。被引用的消息或文档删除时，节点及其边由数据库触发器一并删除。
+const (
+	GraphRefMessage  = "message"  // 对话消息，RefID 为消息 ID
+	GraphRefDocument = "document" // 上传的文档，RefID 为文档 ID
+)
+
+// GraphNode 是图记忆中的一个节点，对应 graph_nodes 表。
+type GraphNode struct {
+	ID         string         `json:"id"`
+	UserID     string         `json:"user_id"`
+	Type       GraphNodeType  `json:"type"`
+	Label      string         `json:"label"`      // 简短的描述
+	Properties map[string]any `json:"properties"` // 任意 JSON 对象
+	// RefType 和 RefID 是节点记录的对象 (例如消息或文档)，为空表示没有引用。
+	// 同一用户的同一个对象只有一个节点。
+	RefType   string    `json:"ref_type,omitempty"`
+	RefID     string    `json:"ref_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GraphEdge 是图记忆中从 SourceID 指向 TargetID 的一条有向边，对应 graph_edges 表。
+// 两个节点之间每种类型最多有一条边。
+type GraphEdge struct {
+	ID         string         `json:"id"`
+	UserID     string         `json:"user_id"`
+	SourceID   string         `json:"source_id"`
+	TargetID   string         `json:"target_id"`
+	Type       GraphEdgeType  `json:"type"`
+	Properties map[string]any `json:"properties"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// GraphNodeFilter 是列出节点时的过滤条件，零值字段表示不过滤。
+type GraphNodeFilter struct {
+	Type    GraphNodeType
+	RefType string
+	RefID   string
+	Limit   int
+	Offset  int
+}
+
+// GraphDirection 是遍历图的方向。
+type GraphDirection string
+
+const (
+	GraphAncestors   GraphDirection = "ancestors"   // 沿边的反方向，查找原因
+	GraphDescendants GraphDirection = "descendants" // 沿边的方向，查找结果
+)
+
+// GraphTraversalNode 是遍历到的一个节点及其与起点的最短距离 (边数)。
+type GraphTraversalNode struct {
+	*GraphNode
+	Depth int `json:"depth"`
+}
+
+// GraphPath 是两个节点之间沿边方向的一条路径。NodeIDs 包括起点和终点，EdgeIDs 依次连接相邻的节点。
+type GraphPath struct {
+	NodeIDs []string `json:"node_ids"`
+	EdgeIDs []string `json:"edge_ids"`
+}
+
+// GraphNodeInput 是记录节点时客户端提交的字段。
+type GraphNodeInput struct {
+	Type       GraphNodeType  `json:"type"`
+	Label      string         `json:"label"`
+	Properties map[string]any `json:"properties,omitempty"`
+	RefType    string         `json:"ref_type,omitempty"` // 与 RefID 同时设置或同时为空
+	RefID      string         `json:"ref_id,omitempty"`
+}
+
+// GraphEdgeInput 是记录边时客户端提交的字段。
+type GraphEdgeInput struct {
+	SourceID   string         `json:"source_id"`
+	TargetID   string         `json:"target_id"`
+	Type       GraphEdgeType  `json:"type"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
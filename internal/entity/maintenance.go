@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// MaintenanceReport 汇总一次维护任务的执行结果。
+// Counts 的键由具体任务定义，例如 "orphan_files_deleted"。
+type MaintenanceReport struct {
+	Job        string           `json:"job"`         // 任务类型 (TaskTypeMaintenance*)
+	StartedAt  time.Time        `json:"started_at"`  // 开始时间
+	FinishedAt time.Time        `json:"finished_at"` // 结束时间
+	Counts     map[string]int64 `json:"counts"`      // 各项处理数量
+}
+
+// NewMaintenanceReport 创建一个开始时间为当前时间的 MaintenanceReport。
+func NewMaintenanceReport(job string) *MaintenanceReport {
+	return &MaintenanceReport{
+		Job:       job,
+		StartedAt: time.Now(),
+		Counts:    make(map[string]int64),
+	}
+}
+
+// Add 累加一项处理数量。
+func (r *MaintenanceReport) Add(key string, n int64) {
+	r.Counts[key] += n
+}
+
+// Finish 记录结束时间。
+func (r *MaintenanceReport) Finish() *MaintenanceReport {
+	r.FinishedAt = time.Now()
+	return r
+}
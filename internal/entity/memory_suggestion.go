@@ -0,0 +1,55 @@
+package entity
+
+import "time"
+
+// 自动提取的记忆的长度限制 (字符数)。超出限制的记忆会被丢弃，而不是截断。
+const (
+	MaxMemoryKeyLength   = 255 // 与 structured_memories.key 一致
+	MaxMemoryValueLength = 500
+)
+
+// MemorySuggestionStatus 是记忆建议的状态。
+type MemorySuggestionStatus string
+
+const (
+	MemorySuggestionPending  MemorySuggestionStatus = "pending"  // 等待用户确认
+	MemorySuggestionApproved MemorySuggestionStatus = "approved" // 已批准并写入结构化记忆
+	MemorySuggestionRejected MemorySuggestionStatus = "rejected" // 已拒绝，相同的键值不会再次建议
+)
+
+// Valid 返回状态是否为已定义的值。
+func (s MemorySuggestionStatus) Valid() bool {
+	switch s {
+	case MemorySuggestionPending, MemorySuggestionApproved, MemorySuggestionRejected:
+		return true
+	default:
+		return false
+	}
+}
+
+// MemorySuggestion 是 LLM 从对话中提取、等待用户确认的一条记忆。
+type MemorySuggestion struct {
+	ID             string                 `json:"id"`
+	UserID         string                 `json:"user_id"`
+	Key            string                 `json:"key"`
+	Value          string                 `json:"value"`
+	Confidence     *float64               `json:"confidence"`      // LLM 给出的置信度 (0 到 1)，批准后写入记忆
+	ConversationID *string                `json:"conversation_id"` // 提取记忆的对话 (对话删除后为 null)
+	MessageID      *string                `json:"message_id"`      // 触发提取的 AI 回复
+	Status         MemorySuggestionStatus `json:"status"`
+	CreatedAt      time.Time              `json:"created_at"`
+	ResolvedAt     *time.Time             `json:"resolved_at"` // 批准或拒绝的时间
+}
+
+// ExtractedMemory 是 LLM 从对话中提取的一条记忆。
+type ExtractedMemory struct {
+	Key        string   `json:"key"`
+	Value      string   `json:"value"`
+	Confidence *float64 `json:"confidence,omitempty"` // 0 到 1，超出范围时忽略
+}
+
+// MemoryExtractionResult 是一次记忆提取的结果。
+type MemoryExtractionResult struct {
+	Applied   []string `json:"applied"`   // 直接写入结构化记忆的键 (auto 模式)
+	Suggested []string `json:"suggested"` // 新建为待确认建议的键 (suggest 模式)
+}
@@ -16,11 +16,27 @@ const (
 	SenderRoleSystem SenderRole = "system" // Add System role
 )
 
+// MessageMetaSources 是 AI 回复的 Metadata 中记录 RAG 引用来源的键，值为 []MessageSource。
+const MessageMetaSources = "sources"
+
+// MessageMetaMemoryIDs 是 AI 回复的 Metadata 中记录注入提示词的结构化记忆的键，值为记忆 ID 列表。
+const MessageMetaMemoryIDs = "memory_ids"
+
+// MessageSource 描述 AI 回复引用的一个文档块。
+type MessageSource struct {
+	DocumentID string `json:"document_id"`
+	ChunkID    string `json:"chunk_id"`
+	PageNumber int    `json:"page_number,omitempty"` // 块所在的页码 (仅 OCR 识别的块)
+	Excerpt    string `json:"excerpt"`               // 块内容的开头部分
+}
+
 // Message 代表一条对话消息。
 // 这对应于数据库中的 conversation_history 表。
+// 对话中的消息组成一棵树：编辑消息或重新生成回复会创建原消息的兄弟节点，而不是覆盖原消息。
 type Message struct {
 	ID             string          `json:"id"`              // 消息的唯一 ID (string UUID)
 	ConversationID string          `json:"conversation_id"` // 所属对话的 ID (string UUID)
+	ParentID       *string         `json:"parent_id"`       // 同一分支上的上一条消息 (对话的第一条消息为 null)
 	UserID         string          `json:"user_id"`         // 发送消息的用户 ID (用于数据隔离)
 	SenderRole     SenderRole      `json:"sender_role"`     // 发送者角色 ('user' 或 'ai')
 	Content        string          `json:"content"`         // 消息内容
@@ -62,3 +78,17 @@ func (m *Message) GetMetadata(target map[string]interface{}) error {
 	}
 	return json.Unmarshal(m.Metadata, &target)
 }
+
+// Sources 返回消息元数据中记录的引用来源，没有记录或无法解析时返回 nil。
+func (m *Message) Sources() []MessageSource {
+	if len(m.Metadata) == 0 {
+		return nil
+	}
+	var meta struct {
+		Sources []MessageSource `json:"sources"`
+	}
+	if err := json.Unmarshal(m.Metadata, &meta); err != nil {
+		return nil
+	}
+	return meta.Sources
+}
@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+// 消息搜索方式。
+const (
+	MessageSearchModeFullText = "fulltext" // PostgreSQL 全文检索 (包含中日韩文字时使用子串匹配)
+	MessageSearchModeSemantic = "semantic" // 按消息向量的语义相似度检索 (需要启用 MESSAGE_SEMANTIC_SEARCH_ENABLED)
+)
+
+// MaxMessageSearchLimit 是单次消息搜索返回结果数量的上限。
+const MaxMessageSearchLimit = 100
+
+// MessageSearchQuery 定义了搜索对话消息的条件，零值字段不参与过滤。
+type MessageSearchQuery struct {
+	Query          string     // 搜索词 (全文检索支持 websearch 语法，例如 "Q3 budget" -draft)
+	Mode           string     // MessageSearchModeFullText 或 MessageSearchModeSemantic
+	ConversationID string     // 只搜索该对话
+	Role           SenderRole // 只搜索该角色的消息
+	After          *time.Time // timestamp >= After
+	Before         *time.Time // timestamp < Before
+	Limit          int
+	Offset         int
+}
+
+// MessageSearchResult 代表一条匹配的消息。
+type MessageSearchResult struct {
+	MessageID         string     `json:"message_id"`
+	ConversationID    string     `json:"conversation_id"`
+	ConversationTitle string     `json:"conversation_title"`
+	SenderRole        SenderRole `json:"sender_role"`
+	// Snippet 是经过 HTML 转义的消息片段，唯一的标记是包围匹配内容的 <mark></mark> (语义检索不标记)，
+	// 客户端可以直接作为 HTML 渲染。
+	Snippet   string    `json:"snippet"`
+	Timestamp time.Time `json:"timestamp"` // 消息时间
+	// Position 是消息在其所在分支上的位置 (从 1 开始)。消息位于当前分支时，
+	// 即为 GET /chat/{conversation_id}/messages?branch=active 返回的完整分支中的序号。
+	Position int     `json:"position"`
+	Score    float64 `json:"score"` // 相关度，越大越相关 (不同搜索方式的分数不可比较)
+}
@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+// 人设字段的长度限制 (字符数)。
+const (
+	MaxPersonaNameLength         = 100
+	MaxPersonaSystemPromptLength = 20000
+	MaxPersonaModelNameLength    = 100
+)
+
+// Persona 是用户定义的人设：系统提示词和默认的生成设置。
+// 对话可以选择一个人设；没有选择时使用用户的默认人设，没有默认人设时不发送系统提示词。
+type Persona struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Name         string    `json:"name"`
+	SystemPrompt string    `json:"system_prompt"` // 每次调用 LLM 时作为第一条消息发送 (为空时不发送)
+	ModelName    string    `json:"model_name"`    // 默认模型，请求指定的模型优先 (为空时使用服务端默认模型)
+	Temperature  *float64  `json:"temperature"`   // 采样温度 (为 null 时使用模型默认值)
+	RAGEnabled   bool      `json:"rag_enabled"`   // 是否检索用户文档作为回复的上下文
+	IsDefault    bool      `json:"is_default"`    // 是否为用户的默认人设
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// PersonaInput 是创建或修改人设时提交的字段。修改时整体替换 (未提供的可选字段恢复默认值)。
+type PersonaInput struct {
+	Name         string   `json:"name"`
+	SystemPrompt string   `json:"system_prompt"`
+	ModelName    string   `json:"model_name"`
+	Temperature  *float64 `json:"temperature"`
+	RAGEnabled   *bool    `json:"rag_enabled"` // 默认为 true
+}
@@ -5,15 +5,47 @@ import (
 	// "github.com/google/uuid" // Removed unused import
 )
 
+// MemoryValueType is the type of a structured memory's value. Values are
+// stored as text and validated against their type when written.
+type MemoryValueType string
+
+const (
+	MemoryValueString MemoryValueType = "string" // Free text (default)
+	MemoryValueNumber MemoryValueType = "number" // A decimal number, e.g. "42" or "3.5"
+	MemoryValueDate   MemoryValueType = "date"   // A date ("2006-01-02") or an RFC 3339 timestamp
+	MemoryValueJSON   MemoryValueType = "json"   // Any valid JSON document
+	MemoryValueList   MemoryValueType = "list"   // A JSON array, e.g. ["Go", "Rust"]
+)
+
+// MemorySource records where a structured memory came from.
+type MemorySource string
+
+const (
+	MemorySourceManual    MemorySource = "manual"    // Written by the user through the API (default)
+	MemorySourceExtracted MemorySource = "extracted" // Extracted from a conversation by the LLM
+	MemorySourceImported  MemorySource = "imported"  // Imported in bulk
+)
+
+// MaxMemoryNamespaceLength is the maximum length (in characters) of a memory namespace.
+const MaxMemoryNamespaceLength = 100
+
 // StructuredMemory represents a single piece of structured information
 // stored for a specific user.
 type StructuredMemory struct {
-	ID        string    `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Keep ID as UUID string for consistency? Or uint? Let's use string UUID.
-	UserID    string    `json:"user_id" gorm:"type:uuid;not null;index"`                    // Foreign key to users table (string UUID)
-	Key       string    `json:"key" gorm:"type:varchar(255);not null;index"`
-	Value     string    `json:"value" gorm:"type:text;not null"` // Use TEXT for flexibility
-	CreatedAt time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
-	UpdatedAt time.Time `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
+	ID        string          `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Keep ID as UUID string for consistency? Or uint? Let's use string UUID.
+	UserID    string          `json:"user_id" gorm:"type:uuid;not null;index"`                    // Foreign key to users table (string UUID)
+	Key       string          `json:"key" gorm:"type:varchar(255);not null;index"`
+	Value     string          `json:"value" gorm:"type:text;not null"` // Use TEXT for flexibility
+	ValueType MemoryValueType `json:"value_type" gorm:"type:varchar(20);not null;default:'string'"`
+	Namespace string          `json:"namespace" gorm:"type:varchar(100);not null;default:''"` // Groups memories (e.g. "work"); keys stay unique per user
+	Source    MemorySource    `json:"source" gorm:"type:varchar(20);not null;default:'manual'"`
+	// SourceConversationID is the conversation an extracted or imported memory came from (null once it is deleted).
+	SourceConversationID *string    `json:"source_conversation_id" gorm:"type:uuid"`
+	Confidence           *float64   `json:"confidence" gorm:"type:real"`       // 0..1, set by the extractor; null when unknown
+	ExpiresAt            *time.Time `json:"expires_at"`                        // Expired memories are no longer used in chats
+	Version              int        `json:"version" gorm:"not null;default:1"` // Incremented on every update
+	CreatedAt            time.Time  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt            time.Time  `json:"updated_at" gorm:"default:CURRENT_TIMESTAMP"`
 
 	// Define unique constraint for UserID and Key
 	// This is typically defined in the migration, but can be hinted here for ORM awareness
@@ -24,3 +56,111 @@ type StructuredMemory struct {
 func (StructuredMemory) TableName() string {
 	return "structured_memories"
 }
+
+// Expired reports whether the memory has expired at the given time.
+func (m *StructuredMemory) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
+// StructuredMemoryInput holds the fields a client submits when creating or
+// replacing a memory. Optional fields that are omitted revert to their defaults.
+type StructuredMemoryInput struct {
+	Key        string          `json:"key"`
+	Value      string          `json:"value"`
+	ValueType  MemoryValueType `json:"value_type,omitempty"` // Defaults to "string"
+	Namespace  string          `json:"namespace,omitempty"`
+	Confidence *float64        `json:"confidence,omitempty"`
+	ExpiresAt  *time.Time      `json:"expires_at,omitempty"`
+}
+
+// MemoryChangeType is the kind of change recorded in a memory's history.
+type MemoryChangeType string
+
+const (
+	MemoryChangeInsert MemoryChangeType = "insert"
+	MemoryChangeUpdate MemoryChangeType = "update"
+	MemoryChangeDelete MemoryChangeType = "delete"
+)
+
+// StructuredMemoryHistory is one recorded version of a structured memory:
+// the memory as it was after an insert or update, or just before a delete.
+type StructuredMemoryHistory struct {
+	ID                   string           `json:"id"`
+	MemoryID             string           `json:"memory_id"` // A key deleted and created again has a new memory ID
+	UserID               string           `json:"user_id"`
+	Key                  string           `json:"key"`
+	Version              int              `json:"version"`
+	Value                string           `json:"value"`
+	ValueType            MemoryValueType  `json:"value_type"`
+	Namespace            string           `json:"namespace"`
+	Source               MemorySource     `json:"source"`
+	SourceConversationID *string          `json:"source_conversation_id"`
+	Confidence           *float64         `json:"confidence"`
+	ExpiresAt            *time.Time       `json:"expires_at"`
+	ChangeType           MemoryChangeType `json:"change_type"`
+	ChangedAt            time.Time        `json:"changed_at"`
+}
+
+// Formats of a structured memory export or import file.
+const (
+	MemoryFileFormatJSON = "json" // A JSON array of memories
+	MemoryFileFormatCSV  = "csv"  // A CSV file with a header row; key and value are required columns
+)
+
+// MaxMemoryBatchSize is the maximum number of items in one import or batch request.
+const MaxMemoryBatchSize = 1000
+
+// MemoryConflictStrategy decides what an import does with a key the user already has.
+type MemoryConflictStrategy string
+
+const (
+	MemoryConflictSkip      MemoryConflictStrategy = "skip"      // Keep the existing memory (default)
+	MemoryConflictOverwrite MemoryConflictStrategy = "overwrite" // Replace the existing memory, recording a new version
+	MemoryConflictFail      MemoryConflictStrategy = "fail"      // Roll back the whole import
+)
+
+// MemoryBatchOpType is the kind of a batch operation.
+type MemoryBatchOpType string
+
+const (
+	MemoryBatchUpsert MemoryBatchOpType = "upsert" // Create the memory, or replace it if the key exists
+	MemoryBatchDelete MemoryBatchOpType = "delete" // Delete the memory; only Key is used
+)
+
+// MemoryBatchOperation is one item of a batch request: an operation and the memory it applies to.
+type MemoryBatchOperation struct {
+	Op MemoryBatchOpType `json:"op"`
+	StructuredMemoryInput
+}
+
+// MemoryBatchStatus is the outcome of one item of an import or batch request.
+type MemoryBatchStatus string
+
+const (
+	MemoryBatchCreated  MemoryBatchStatus = "created"
+	MemoryBatchUpdated  MemoryBatchStatus = "updated"
+	MemoryBatchSkipped  MemoryBatchStatus = "skipped" // The key existed and the strategy is skip
+	MemoryBatchDeleted  MemoryBatchStatus = "deleted"
+	MemoryBatchNotFound MemoryBatchStatus = "not_found" // Deleting a key that does not exist
+	MemoryBatchInvalid  MemoryBatchStatus = "invalid"   // The item failed validation; nothing was written
+)
+
+// MemoryBatchResult is the outcome of one item of an import or batch request, in request order.
+type MemoryBatchResult struct {
+	Index  int               `json:"index"` // Zero-based position of the item (the CSV data row for CSV imports)
+	Op     MemoryBatchOpType `json:"op"`
+	Key    string            `json:"key"`
+	Status MemoryBatchStatus `json:"status"`
+	Memory *StructuredMemory `json:"memory,omitempty"` // The stored memory after a create or update
+	Error  string            `json:"error,omitempty"`  // Why an invalid item was rejected
+}
+
+// MemoryBatchSummary is the response of an import or batch request.
+type MemoryBatchSummary struct {
+	Created  int                  `json:"created"`
+	Updated  int                  `json:"updated"`
+	Skipped  int                  `json:"skipped"`
+	Deleted  int                  `json:"deleted"`
+	NotFound int                  `json:"not_found"`
+	Results  []*MemoryBatchResult `json:"results"`
+}
@@ -157,3 +157,14 @@ func (t *Task) UpdateProgress(progress float64) {
 func (t *Task) CanRetry() bool {
 	return t.Status == TaskStatusFailed && t.RetryCount < t.MaxRetries
 }
+
+// QueuedTaskInfo 是任务队列中一个任务的状态和结果。
+type QueuedTaskInfo struct {
+	ID      string
+	Type    string
+	Queue   string
+	State   string
+	Payload []byte
+	Result  json.RawMessage // 任务通过 ResultWriter 写入的结果 (仅完成的任务)
+	LastErr string
+}
@@ -0,0 +1,41 @@
+package entity
+
+import "time"
+
+// FailedTaskState 是失败任务在 Asynq 中所处的状态。
+type FailedTaskState string
+
+const (
+	FailedTaskStateRetry    FailedTaskState = "retry"    // 执行失败，等待下一次自动重试
+	FailedTaskStateArchived FailedTaskState = "archived" // 不可重试或重试次数用尽，已移入死信队列
+)
+
+// TaskFailure 记录任务的一次失败尝试 (对应 task_failures 表)。
+type TaskFailure struct {
+	ID         int64     `json:"id"`
+	TaskID     string    `json:"task_id"`     // Asynq 任务 ID
+	Queue      string    `json:"queue"`       // 任务所在队列
+	TaskType   string    `json:"task_type"`   // 任务类型 (entity.TaskType*)
+	UserID     string    `json:"user_id"`     // payload 中的用户 ID (payload 无效时为空)
+	DocumentID string    `json:"document_id"` // payload 中的文档 ID (payload 无效时为空)
+	Attempt    int       `json:"attempt"`     // 第几次执行 (从 1 开始)
+	Error      string    `json:"error"`       // 错误信息
+	FailedAt   time.Time `json:"failed_at"`   // 失败时间
+}
+
+// FailedTask 描述一个处于重试等待或死信队列中的任务，以及它的失败历史。
+type FailedTask struct {
+	ID            string          `json:"id"`                        // Asynq 任务 ID
+	Queue         string          `json:"queue"`                     // 任务所在队列
+	Type          string          `json:"type"`                      // 任务类型
+	State         FailedTaskState `json:"state"`                     // retry 或 archived
+	UserID        string          `json:"user_id"`                   // payload 中的用户 ID
+	DocumentID    string          `json:"document_id"`               // payload 中的文档 ID
+	Filename      string          `json:"filename,omitempty"`        // payload 中的原始文件名 (URL 抓取任务没有)
+	Retried       int             `json:"retried"`                   // 已重试次数
+	MaxRetry      int             `json:"max_retry"`                 // 最大重试次数
+	LastError     string          `json:"last_error"`                // 最后一次失败的错误信息
+	LastFailedAt  *time.Time      `json:"last_failed_at"`            // 最后一次失败的时间
+	NextProcessAt *time.Time      `json:"next_process_at,omitempty"` // 下一次自动重试的时间 (仅 retry 状态)
+	ErrorHistory  []*TaskFailure  `json:"error_history"`             // 按时间顺序排列的失败记录
+}
@@ -2,44 +2,222 @@ package entity
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
-// TaskTypeEmbedding defines the type name for the embedding task.
-const TaskTypeEmbedding = "embedding:process_file"
-
-// EmbeddingPayload defines the data needed for the file embedding task.
-type EmbeddingPayload struct {
-	UserID           string `json:"user_id"`
-	FilePath         string `json:"file_path"`
-	OriginalFilename string `json:"original_filename"`
-}
-
-// NewEmbeddingTask creates a new Asynq task for file embedding.
-// func NewEmbeddingTask(userID, filePath, originalFilename string) (*asynq.Task, error) {
-// 	payload, err := json.Marshal(EmbeddingPayload{
-// 		UserID:           userID,
-// 		FilePath:         filePath,
-// 		OriginalFilename: originalFilename,
-// 	})
-// 	if err != nil {
-// 		return nil, fmt.Errorf("failed to marshal embedding payload: %w", err)
-// 	}
-// 	// Task type is TaskTypeEmbedding
-// 	return asynq.NewTask(TaskTypeEmbedding, payload), nil
-// }
-
-// Note: The NewEmbeddingTask helper function depends on asynq package.
-// It might be better placed in a package that handles task enqueuing (e.g., internal/service or a dedicated task client package)
-// to avoid circular dependencies or entity package depending on infrastructure.
-// For now, it's commented out here for reference.
-
-// Helper to unmarshal payload in the worker
-func UnmarshalEmbeddingPayload(data []byte) (*EmbeddingPayload, error) {
-	var p EmbeddingPayload
-	err := json.Unmarshal(data, &p)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal embedding payload: %w", err)
-	}
-	return &p, nil
+// 任务类型注册表：生产者 (API 服务、Worker 中的二次入队) 和消费者 (Worker 处理器) 共用这些常量。
+const (
+	// TaskTypeEmbedding 读取文档文件、分块并生成 Embedding，payload 为 EmbeddingTaskPayload。
+	TaskTypeEmbedding = "embedding:generate"
+	// TaskTypeFetchURL 抓取 URL 文档并保存正文快照，payload 为 FetchURLTaskPayload。
+	TaskTypeFetchURL = "document:fetch_url"
+	// TaskTypeOCR 对扫描版 PDF 和图片进行 OCR 后生成 Embedding，payload 为 EmbeddingTaskPayload。
+	TaskTypeOCR = "document:ocr"
+	// TaskTypeConversationTitle 调用 LLM 为对话生成标题，payload 为 ConversationTitleTaskPayload。
+	TaskTypeConversationTitle = "conversation:generate_title"
+	// TaskTypeMessageEmbedding 为对话消息生成用于语义搜索的向量，payload 为 MessageEmbeddingTaskPayload。
+	TaskTypeMessageEmbedding = "message:embed"
+	// TaskTypeConversationImport 从上传的 ChatGPT 导出文件中导入对话，payload 为 ConversationImportTaskPayload。
+	TaskTypeConversationImport = "conversation:import_chatgpt"
+	// TaskTypeMemoryExtraction 调用 LLM 从对话中提取用户记忆，payload 为 MemoryExtractionTaskPayload。
+	TaskTypeMemoryExtraction = "memory:extract"
+	// TaskTypeEventDelivery 将事件 POST 到 webhook 订阅的地址，payload 为 EventDeliveryTaskPayload。
+	TaskTypeEventDelivery = "event:deliver_webhook"
+
+	// 以下为 Worker 中的 Scheduler 定期触发的维护任务，没有 payload。
+
+	// TaskTypeMaintenanceOrphanFiles 对账存储中的文件与 documents 表：删除孤立文件，标记文件丢失的文档。
+	TaskTypeMaintenanceOrphanFiles = "maintenance:orphan_files"
+	// TaskTypeMaintenanceTaskRetention 删除超过保留期的任务记录和失败历史。
+	TaskTypeMaintenanceTaskRetention = "maintenance:task_retention"
+	// TaskTypeMaintenanceStaleDocuments 重置长时间停留在 processing 状态的文档。
+	TaskTypeMaintenanceStaleDocuments = "maintenance:stale_documents"
+	// TaskTypeMaintenanceVectorIndex 清理孤立向量块并维护向量索引。
+	TaskTypeMaintenanceVectorIndex = "maintenance:vector_index"
+	// TaskTypeMaintenanceExpiredUploads 删除已过期的可恢复上传会话及其数据块。
+	TaskTypeMaintenanceExpiredUploads = "maintenance:expired_uploads"
+)
+
+// TaskPriority 决定任务进入哪个 Asynq 队列。Worker 按权重从各队列取任务，
+// 批量导入不会让用户直接触发的任务长时间排队。
+type TaskPriority string
+
+const (
+	// TaskPriorityInteractive 用于用户直接触发的任务 (上传、URL 导入、手动重试)，未设置优先级时的默认值。
+	TaskPriorityInteractive TaskPriority = "interactive"
+	// TaskPriorityBulk 用于批量或后台任务 (本地目录同步、定期重新抓取)。
+	TaskPriorityBulk TaskPriority = "bulk"
+)
+
+// QueueName 返回该优先级对应的 Asynq 队列名。
+func (p TaskPriority) QueueName() string {
+	if p == TaskPriorityBulk {
+		return string(TaskPriorityBulk)
+	}
+	return string(TaskPriorityInteractive)
+}
+
+var (
+	// ErrInvalidTaskPayload 表示任务 payload 无法解析或缺少必需字段。
+	// 这类任务重试也不会成功，Worker 会直接将其移入死信队列 (Asynq 的 archived 集合) 供排查。
+	ErrInvalidTaskPayload = errors.New("无效的任务 payload")
+
+	// ErrTaskThrottled 表示任务所属用户在 Worker 中同时执行的任务数已达上限。
+	// 任务会在稍后重新执行，且不计入重试次数。
+	ErrTaskThrottled = errors.New("用户并发任务数已达上限，稍后重新执行")
+)
+
+// TaskPayload 是所有任务 payload 的公共接口。
+type TaskPayload interface {
+	// Validate 检查必需字段。
+	Validate() error
+}
+
+// EmbeddingTaskPayload 定义了 embedding:generate 和 document:ocr 任务的 payload 结构。
+type EmbeddingTaskPayload struct {
+	UserID      string `json:"user_id"`
+	DocumentID  string `json:"document_id"`
+	FilePath    string `json:"file_path"`    // 文件在 FileStorage 中的存储路径
+	Filename    string `json:"filename"`     // 原始文件名 (用于匹配消息导入器和日志)
+	ContentType string `json:"content_type"` // 嗅探出的 MIME 类型
+	// Priority 决定任务进入的队列，由 Embedding 任务派生的 OCR 任务沿用同一优先级
+	Priority TaskPriority `json:"priority,omitempty"`
+}
+
+// NewEmbeddingTaskPayload 根据文档创建 Embedding 任务 payload。
+func NewEmbeddingTaskPayload(doc *Document, contentType string, priority TaskPriority) *EmbeddingTaskPayload {
+	return &EmbeddingTaskPayload{
+		UserID:      doc.UserID,
+		DocumentID:  doc.ID,
+		FilePath:    doc.StoredPath,
+		Filename:    doc.OriginalFilename,
+		ContentType: contentType,
+		Priority:    priority,
+	}
+}
+
+// Validate 实现 TaskPayload 接口。
+func (p *EmbeddingTaskPayload) Validate() error {
+	if p.UserID == "" || p.DocumentID == "" || p.FilePath == "" {
+		return fmt.Errorf("%w: 缺少 user_id、document_id 或 file_path", ErrInvalidTaskPayload)
+	}
+	return nil
+}
+
+// FetchURLTaskPayload 定义了 document:fetch_url 任务的 payload 结构。
+type FetchURLTaskPayload struct {
+	UserID     string `json:"user_id"`
+	DocumentID string `json:"document_id"`
+	// Priority 决定任务进入的队列，抓取完成后的 Embedding 任务沿用同一优先级
+	Priority TaskPriority `json:"priority,omitempty"`
+}
+
+// Validate 实现 TaskPayload 接口。
+func (p *FetchURLTaskPayload) Validate() error {
+	if p.UserID == "" || p.DocumentID == "" {
+		return fmt.Errorf("%w: 缺少 user_id 或 document_id", ErrInvalidTaskPayload)
+	}
+	return nil
+}
+
+// ConversationTitleTaskPayload 定义了 conversation:generate_title 任务的 payload 结构。
+type ConversationTitleTaskPayload struct {
+	UserID         string `json:"user_id"`
+	ConversationID string `json:"conversation_id"`
+	ModelName      string `json:"model_name,omitempty"` // 生成标题使用的模型，为空时使用默认模型
+	// Force 为 true 时替换已有的自动标题 (用户手动重新生成)；为 false 时只为没有标题的对话生成。
+	// 两种情况都不会覆盖用户手动设置的标题。
+	Force bool `json:"force,omitempty"`
+}
+
+// Validate 实现 TaskPayload 接口。
+func (p *ConversationTitleTaskPayload) Validate() error {
+	if p.UserID == "" || p.ConversationID == "" {
+		return fmt.Errorf("%w: 缺少 user_id 或 conversation_id", ErrInvalidTaskPayload)
+	}
+	return nil
+}
+
+// MessageEmbeddingTaskPayload 定义了 message:embed 任务的 payload 结构。
+type MessageEmbeddingTaskPayload struct {
+	UserID         string `json:"user_id"`
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+}
+
+// Validate 实现 TaskPayload 接口。
+func (p *MessageEmbeddingTaskPayload) Validate() error {
+	if p.UserID == "" || p.ConversationID == "" || p.MessageID == "" {
+		return fmt.Errorf("%w: 缺少 user_id、conversation_id 或 message_id", ErrInvalidTaskPayload)
+	}
+	return nil
+}
+
+// ConversationImportTaskPayload 定义了 conversation:import_chatgpt 任务的 payload 结构。
+type ConversationImportTaskPayload struct {
+	UserID     string `json:"user_id"`
+	StoredPath string `json:"stored_path"` // 上传的导出文件在存储中的路径，导入结束后删除
+	Filename   string `json:"filename"`    // 上传时的原始文件名
+}
+
+// Validate 实现 TaskPayload 接口。
+func (p *ConversationImportTaskPayload) Validate() error {
+	if p.UserID == "" || p.StoredPath == "" {
+		return fmt.Errorf("%w: 缺少 user_id 或 stored_path", ErrInvalidTaskPayload)
+	}
+	return nil
+}
+
+// MemoryExtractionTaskPayload 定义了 memory:extract 任务的 payload 结构。
+type MemoryExtractionTaskPayload struct {
+	UserID         string `json:"user_id"`
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`           // 触发提取的 AI 回复，提取以它结尾的分支上的最近消息
+	ModelName      string `json:"model_name,omitempty"` // 提取使用的模型，为空时使用默认模型
+}
+
+// Validate 实现 TaskPayload 接口。
+func (p *MemoryExtractionTaskPayload) Validate() error {
+	if p.UserID == "" || p.ConversationID == "" || p.MessageID == "" {
+		return fmt.Errorf("%w: 缺少 user_id、conversation_id 或 message_id", ErrInvalidTaskPayload)
+	}
+	return nil
+}
+
+// EventDeliveryTaskPayload 定义了 event:deliver_webhook 任务的 payload 结构。
+type EventDeliveryTaskPayload struct {
+	UserID     string `json:"user_id"`
+	DeliveryID string `json:"delivery_id"` // event_deliveries 表中的投递记录
+}
+
+// Validate 实现 TaskPayload 接口。
+func (p *EventDeliveryTaskPayload) Validate() error {
+	if p.UserID == "" || p.DeliveryID == "" {
+		return fmt.Errorf("%w: 缺少 user_id 或 delivery_id", ErrInvalidTaskPayload)
+	}
+	return nil
+}
+
+// DecodeTaskPayload 解析并校验任务 payload，失败时返回的错误包装了 ErrInvalidTaskPayload。
+func DecodeTaskPayload(data []byte, payload TaskPayload) error {
+	if err := json.Unmarshal(data, payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTaskPayload, err)
+	}
+	return payload.Validate()
+}
+
+// TaskPayloadRef 是所有任务 payload 共有的字段。
+// 用于在不关心具体任务类型时定位任务所属的用户和文档 (例如记录失败历史、查看死信队列)。
+type TaskPayloadRef struct {
+	UserID     string `json:"user_id"`
+	DocumentID string `json:"document_id"`
+	Filename   string `json:"filename"`
+}
+
+// ParseTaskPayloadRef 尽力解析 payload 中的公共字段，payload 无效时返回零值。
+func ParseTaskPayloadRef(data []byte) TaskPayloadRef {
+	var ref TaskPayloadRef
+	_ = json.Unmarshal(data, &ref)
+	return ref
 }
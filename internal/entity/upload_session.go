@@ -0,0 +1,60 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadSessionStatus 定义了可恢复上传会话的状态。
+type UploadSessionStatus string
+
+const (
+	UploadSessionStatusActive     UploadSessionStatus = "active"     // 正在接收数据
+	UploadSessionStatusFinalizing UploadSessionStatus = "finalizing" // 正在合并为文档
+)
+
+// UploadSession 代表一个可恢复的分块上传会话 (tus 风格)。
+// 客户端按顺序 PATCH 字节区间，断线后通过查询 Offset 继续上传。
+type UploadSession struct {
+	ID          string              `json:"id"`           // 会话 ID (string UUID)
+	UserID      string              `json:"user_id"`      // 所属用户 ID
+	Filename    string              `json:"filename"`     // 原始文件名
+	ContentType string              `json:"content_type"` // 客户端声明的 MIME 类型 (完成时会重新嗅探)
+	TotalSize   int64               `json:"total_size"`   // 文件总大小 (bytes)
+	Offset      int64               `json:"offset"`       // 已接收的字节数
+	Status      UploadSessionStatus `json:"status"`       // 会话状态
+	ExpiresAt   time.Time           `json:"expires_at"`   // 过期时间，过期后会话及已上传的分块会被清理
+	CreatedAt   time.Time           `json:"created_at"`   // 创建时间
+	UpdatedAt   time.Time           `json:"updated_at"`   // 更新时间
+}
+
+// UploadPart 代表上传会话中一次 PATCH 写入的数据块。
+type UploadPart struct {
+	SessionID  string    `json:"session_id"`  // 所属会话 ID
+	Offset     int64     `json:"offset"`      // 该块在文件中的起始偏移
+	Size       int64     `json:"size"`        // 该块的字节数
+	StoredPath string    `json:"stored_path"` // 该块在 FileStorage 中的存储路径
+	CreatedAt  time.Time `json:"created_at"`  // 创建时间
+}
+
+// NewUploadSession 创建一个新的 UploadSession 实例。
+func NewUploadSession(userID, filename, contentType string, totalSize int64, ttl time.Duration) *UploadSession {
+	now := time.Now()
+	return &UploadSession{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		TotalSize:   totalSize,
+		Status:      UploadSessionStatusActive,
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// IsComplete 返回是否已接收全部数据。
+func (s *UploadSession) IsComplete() bool {
+	return s.Offset == s.TotalSize
+}
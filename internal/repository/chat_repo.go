@@ -8,23 +8,56 @@ import (
 
 // ChatRepository 定义了与对话历史数据存储交互的方法。
 type ChatRepository interface {
-	// SaveMessage 保存一条新的对话消息。
-	// 需要确保实现中处理了 user_id 以进行数据隔离。
+	// SaveMessage 保存一条新的对话消息，并更新对话的最后活动时间，新消息成为当前分支的最后一条消息。
+	// message.ParentID 应指向同一分支上的上一条消息 (对话的第一条消息为 nil)。
+	// 需要确保实现中处理了 user_id 以进行数据隔离。对话记录必须已经存在 (见 EnsureConversation)。
 	SaveMessage(ctx context.Context, message *entity.Message) error
 
-	// GetMessagesByConversationID 获取指定对话的所有消息。
+	// GetMessagesByConversationID 获取指定对话的所有消息 (包括所有分支)。
 	// 可以添加分页、排序等参数。
 	// conversationID is now string
 	GetMessagesByConversationID(ctx context.Context, userID string, conversationID string, limit int, offset int) ([]*entity.Message, error)
 
-	// GetConversationHistory 获取指定对话的最近 N 条消息 (用于 RAG 或 LLM 上下文)。
+	// GetMessage 获取对话中的单条消息，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetMessage(ctx context.Context, userID string, conversationID string, messageID string) (*entity.Message, error)
+
+	// GetConversationHistory 获取指定对话当前分支的最近 N 条消息 (用于 RAG 或 LLM 上下文)，按时间顺序排列。
 	// conversationID is now string
 	GetConversationHistory(ctx context.Context, userID string, conversationID string, lastN int) ([]*entity.Message, error)
 
-	// GetUserConversations 获取指定用户的所有对话基本信息。
-	// 按最后更新时间降序排序。
-	GetUserConversations(ctx context.Context, userID string) ([]*entity.Conversation, error)
+	// GetMessageBranch 获取以 leafID 对应消息结尾的分支上的最近 N 条消息，按时间顺序排列。
+	GetMessageBranch(ctx context.Context, userID string, conversationID string, leafID string, lastN int) ([]*entity.Message, error)
+
+	// CountBranchMessages 统计以 leafID 对应消息结尾的分支上角色为 role 的消息数量。
+	CountBranchMessages(ctx context.Context, userID string, conversationID string, leafID string, role entity.SenderRole) (int, error)
+
+	// SetActiveBranch 将对话的当前分支切换到包含指定消息的分支 (该消息之后最近一次延续的分支)，返回更新后的对话。
+	// 消息不存在时返回 CodeNotFound 错误。
+	SetActiveBranch(ctx context.Context, userID string, conversationID string, messageID string) (*entity.Conversation, error)
+
+	// GetUserConversations 分页获取指定用户满足过滤条件的对话，返回当前页的对话和符合条件的对话总数。
+	// 置顶的对话排在前面，其余按最后活动时间降序排序。
+	GetUserConversations(ctx context.Context, userID string, filter *entity.ConversationFilter, limit int, offset int) ([]*entity.Conversation, int, error)
+
+	// EnsureConversation 在对话不存在时创建对话记录 (保存消息前调用)。
+	// 对话已存在但属于其他用户时返回 CodeNotFound 错误。
+	EnsureConversation(ctx context.Context, userID string, conversationID string) error
+
+	// CreateConversation 使用 conv 中的 ID、标题、标题来源和创建时间创建对话记录 (用于导入)，
+	// 对话的最后活动时间初始化为创建时间。对话 ID 已存在时不做修改，返回 false。
+	CreateConversation(ctx context.Context, conv *entity.Conversation) (bool, error)
+
+	// GetConversation 获取指定用户的对话，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetConversation(ctx context.Context, userID string, conversationID string) (*entity.Conversation, error)
+
+	// UpdateConversation 更新对话的标题、归档、置顶状态和人设，返回更新后的对话。
+	// 调用方需要确认人设属于该用户。
+	UpdateConversation(ctx context.Context, userID string, conversationID string, update *entity.ConversationUpdate) (*entity.Conversation, error)
+
+	// SetGeneratedTitle 保存 LLM 生成的对话标题，不会覆盖用户手动设置的标题。
+	// force 为 false 时只更新尚无标题的对话，为 true 时也替换已有的自动标题。返回标题是否被更新。
+	SetGeneratedTitle(ctx context.Context, userID string, conversationID string, title string, force bool) (bool, error)
 
-	// TODO: 可能需要添加其他方法，例如：
-	// DeleteMessagesByConversationID(ctx context.Context, conversationID uuid.UUID) error
+	// DeleteConversation 删除对话及其所有消息 (外键级联删除)。
+	DeleteConversation(ctx context.Context, userID string, conversationID string) error
 }
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// ConversationImportFileRepository 定义了与等待导入的上传文件 (conversation_import_files 表) 交互的方法。
+type ConversationImportFileRepository interface {
+	// SaveImportFile 记录一个已保存到存储、等待导入的文件。
+	SaveImportFile(ctx context.Context, file *entity.ConversationImportFile) error
+
+	// SetImportFileTask 记录处理该文件的导入任务 ID。
+	SetImportFileTask(ctx context.Context, storedPath string, taskID string) error
+
+	// DeleteImportFile 删除文件记录 (文件本身由调用方删除)。不存在时不视为错误。
+	DeleteImportFile(ctx context.Context, storedPath string) error
+
+	// ListImportFiles 列出所有等待导入的文件 (用于对账存储中的孤立文件)。
+	ListImportFiles(ctx context.Context) ([]*entity.ConversationImportFile, error)
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	// "github.com/google/uuid" // Removed unused import
 	"github.com/soaringjerry/dreamhub/internal/entity"
@@ -30,6 +31,49 @@ type DocumentRepository interface {
 	// Added userID string parameter, changed docID to string
 	DeleteDocument(ctx context.Context, userID string, docID string) error
 
+	// GetUserStorageUsage 返回指定用户所有文档和进行中的可恢复上传 (active 会话的数据块) 占用的存储字节数。
+	GetUserStorageUsage(ctx context.Context, userID string) (int64, error)
+
+	// UpdateDocumentSnapshot 用新内容替换文档的存储文件和内容哈希 (URL 重新抓取或本地文件变化时使用)。
+	UpdateDocumentSnapshot(ctx context.Context, userID string, docID string, snapshot *DocumentSnapshot) error
+
+	// MarkDocumentFetched 仅更新最后抓取时间 (内容未变化时使用)。
+	MarkDocumentFetched(ctx context.Context, userID string, docID string, fetchedAt time.Time) error
+
+	// ClaimDueRecrawls 领取 next_crawl_at 已到期的 URL 文档 (最多 limit 个)，并把它们的 next_crawl_at 推迟一个抓取间隔。
+	ClaimDueRecrawls(ctx context.Context, now time.Time, limit int) ([]*entity.Document, error)
+
+	// ListDocumentsBySourcePrefix 列出用户 source_path 以 prefix 开头的文档 (本地目录同步)。
+	ListDocumentsBySourcePrefix(ctx context.Context, userID string, prefix string) ([]*entity.Document, error)
+
+	// UpdateSourceModifiedAt 仅更新同步文档记录的文件修改时间 (文件被 touch 但内容未变化时使用)。
+	UpdateSourceModifiedAt(ctx context.Context, userID string, docID string, modifiedAt time.Time) error
+
+	// ListStoredFiles 列出所有带有存储文件的文档引用 (用于对账存储中的孤立文件)。
+	ListStoredFiles(ctx context.Context) ([]*StoredFileRef, error)
+
+	// ListStaleProcessingDocuments 列出 processing 状态且在 updatedBefore 之后没有更新过的文档 (最多 limit 个)。
+	ListStaleProcessingDocuments(ctx context.Context, updatedBefore time.Time, limit int) ([]*entity.Document, error)
+
 	// TODO: 可能需要添加其他方法，例如：
 	// GetDocumentByHash(ctx context.Context, userID string, fileHash string) (*entity.Document, error) // 用于去重
 }
+
+// StoredFileRef 是文档对存储文件的引用。
+type StoredFileRef struct {
+	DocumentID       string
+	UserID           string
+	StoredPath       string
+	ProcessingStatus entity.TaskStatus
+}
+
+// DocumentSnapshot 描述替换文档内容时写入的新文件信息。
+type DocumentSnapshot struct {
+	StoredPath       string
+	FileSize         int64
+	ContentType      string
+	ContentHash      string
+	FetchedAt        time.Time
+	EncryptionKeyID  *string
+	SourceModifiedAt *time.Time // 本地同步文件的修改时间，nil 表示不修改
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// EventRepository 定义了与事件总线 (events、event_subscriptions 和 event_deliveries 表) 交互的方法。所有方法都按 user_id 隔离数据。
+type EventRepository interface {
+	// CreateEvent 保存事件，并将 seq 和创建时间写回 event，返回 true。
+	// 同一用户已有 source 和 id 相同的事件时不保存，将已有的事件写回 event 并返回 false。
+	CreateEvent(ctx context.Context, event *entity.Event) (bool, error)
+
+	// GetEvent 按 seq 获取事件，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetEvent(ctx context.Context, userID string, seq int64) (*entity.Event, error)
+
+	// ListEvents 按 seq 升序列出符合条件的事件。
+	ListEvents(ctx context.Context, userID string, filter *entity.EventFilter) ([]*entity.Event, error)
+
+	// LatestEventSeq 返回用户最新事件的 seq，没有事件时返回 0。
+	LatestEventSeq(ctx context.Context, userID string) (int64, error)
+
+	// CreateSubscription 保存订阅，并将 ID 和创建时间写回 subscription。
+	CreateSubscription(ctx context.Context, subscription *entity.EventSubscription) error
+
+	// GetSubscription 获取订阅 (包括 Secret)，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetSubscription(ctx context.Context, userID string, subscriptionID string) (*entity.EventSubscription, error)
+
+	// ListSubscriptions 按创建时间列出用户的订阅 (包括 Secret)。
+	ListSubscriptions(ctx context.Context, userID string) ([]*entity.EventSubscription, error)
+
+	// DeleteSubscription 删除订阅及其投递记录，不存在时返回 CodeNotFound 错误。
+	DeleteSubscription(ctx context.Context, userID string, subscriptionID string) error
+
+	// CreateDeliveries 为事件和每个订阅创建状态为 pending 的投递记录。
+	CreateDeliveries(ctx context.Context, event *entity.Event, subscriptionIDs []string) ([]*entity.EventDelivery, error)
+
+	// GetDelivery 获取投递记录，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetDelivery(ctx context.Context, userID string, deliveryID string) (*entity.EventDelivery, error)
+
+	// ListDeliveries 按创建时间倒序列出订阅的投递记录，同时返回总数。
+	ListDeliveries(ctx context.Context, userID string, subscriptionID string, limit int, offset int) ([]*entity.EventDelivery, int, error)
+
+	// RecordDeliveryAttempt 记录一次投递尝试：尝试次数加一并更新状态、状态码和错误信息。
+	RecordDeliveryAttempt(ctx context.Context, deliveryID string, status entity.EventDeliveryStatus, statusCode *int, errMsg string) error
+
+	// ResetDelivery 将投递记录恢复为 pending 以便重新投递，不存在时返回 CodeNotFound 错误。
+	ResetDelivery(ctx context.Context, userID string, deliveryID string) (*entity.EventDelivery, error)
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// FileKeyRepository 定义了与文件数据密钥 (file_encryption_keys 表) 交互的方法。
+type FileKeyRepository interface {
+	// SaveFileKey 保存一个新文件的已包装数据密钥。
+	SaveFileKey(ctx context.Context, key *entity.FileDataKey) error
+
+	// GetFileKey 根据存储路径获取数据密钥。
+	// 如果文件没有对应的密钥 (例如启用加密前上传的文件)，返回 CodeNotFound 错误。
+	GetFileKey(ctx context.Context, storedPath string) (*entity.FileDataKey, error)
+
+	// DeleteFileKey 删除指定存储路径的数据密钥。不存在时不视为错误。
+	DeleteFileKey(ctx context.Context, storedPath string) error
+
+	// ListKeysNotWrappedBy 按存储路径升序列出不是由指定主密钥包装、且存储路径大于 afterPath 的数据密钥 (用于密钥轮换)。
+	// afterPath 为空时从头开始，调用方传入上一批最后一条记录的路径以分页。
+	ListKeysNotWrappedBy(ctx context.Context, keyID string, afterPath string, limit int) ([]*entity.FileDataKey, error)
+
+	// RewrapKey 用新的主密钥 ID 和包装结果替换数据密钥，并同步更新 documents.encryption_key_id。
+	// oldKeyID 用作乐观锁，避免并发轮换时覆盖。
+	RewrapKey(ctx context.Context, storedPath string, oldKeyID string, newKeyID string, wrappedKey []byte) error
+}
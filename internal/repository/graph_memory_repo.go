@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// GraphMemoryRepository 定义了与图记忆 (graph_nodes 和 graph_edges 表) 交互的方法。所有方法都按 user_id 隔离数据。
+type GraphMemoryRepository interface {
+	// CreateNode 保存节点，并将 ID 和创建时间写回 node。
+	// 节点带引用 (RefID 不为空) 且该引用已有节点时，更新已有节点的标签、合并属性并返回已有节点。
+	CreateNode(ctx context.Context, node *entity.GraphNode) error
+
+	// GetNode 获取指定用户的节点，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetNode(ctx context.Context, userID string, nodeID string) (*entity.GraphNode, error)
+
+	// GetNodeByRef 获取记录了指定对象的节点，不存在时返回 CodeNotFound 错误。
+	GetNodeByRef(ctx context.Context, userID string, refType string, refID string) (*entity.GraphNode, error)
+
+	// ListNodes 按创建时间倒序列出用户的节点，同时返回符合条件的节点总数。
+	ListNodes(ctx context.Context, userID string, filter *entity.GraphNodeFilter) ([]*entity.GraphNode, int, error)
+
+	// DeleteNode 删除节点及与其相连的边，不存在时返回 CodeNotFound 错误。
+	DeleteNode(ctx context.Context, userID string, nodeID string) error
+
+	// CreateEdge 保存边，并将 ID 和创建时间写回 edge。任一节点不存在或不属于该用户时返回 CodeNotFound 错误。
+	// 两个节点之间已有同类型的边时合并属性并返回已有的边。
+	CreateEdge(ctx context.Context, edge *entity.GraphEdge) error
+
+	// ListNodeEdges 列出以节点为起点或终点的所有边，按创建时间排列。
+	ListNodeEdges(ctx context.Context, userID string, nodeID string) ([]*entity.GraphEdge, error)
+
+	// DeleteEdge 删除边，不存在时返回 CodeNotFound 错误。
+	DeleteEdge(ctx context.Context, userID string, edgeID string) error
+
+	// Traverse 从节点出发沿 direction 遍历最多 maxDepth 条边，返回遍历到的节点 (不含起点) 及其最短距离，
+	// 按距离和创建时间排列，最多返回 entity.MaxGraphTraversalNodes 个。edgeTypes 不为空时只沿这些类型的边遍历。
+	// 起点不存在时返回 CodeNotFound 错误。
+	Traverse(ctx context.Context, userID string, nodeID string, direction entity.GraphDirection, maxDepth int, edgeTypes []entity.GraphEdgeType) ([]*entity.GraphTraversalNode, error)
+
+	// FindPaths 查找从 fromID 沿边的方向到达 toID、长度不超过 maxDepth 的无环路径，最短的在前，最多返回 limit 条。
+	// 最多扩展 entity.MaxGraphPathExpansions 条部分路径，超过时只返回已找到的路径。
+	FindPaths(ctx context.Context, userID string, fromID string, toID string, maxDepth int, limit int) ([]*entity.GraphPath, error)
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// MemoryEmbedding 是结构化记忆的向量缓存。
+type MemoryEmbedding struct {
+	MemoryID        string
+	Vector          pgvector.Vector
+	MemoryUpdatedAt time.Time // 生成向量时记忆的 updated_at，与记忆当前的 updated_at 不同时向量已过期
+}
+
+// MemoryEmbeddingRepository 定义了存取结构化记忆向量的方法，用于按相似度选择注入提示词的记忆。
+type MemoryEmbeddingRepository interface {
+	// GetMemoryEmbeddings 返回用户所有已生成向量的记忆，键为记忆 ID。
+	GetMemoryEmbeddings(ctx context.Context, userID string) (map[string]*MemoryEmbedding, error)
+
+	// SaveMemoryEmbedding 保存 (或替换) 记忆的向量，并记录记忆当前的 updated_at。
+	SaveMemoryEmbedding(ctx context.Context, memory *entity.StructuredMemory, vector pgvector.Vector) error
+}
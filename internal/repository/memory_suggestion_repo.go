@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// MemorySuggestionRepository 定义了与记忆建议 (memory_suggestions 表) 交互的方法。所有方法都按 user_id 隔离数据。
+type MemorySuggestionRepository interface {
+	// CreateSuggestion 保存一条待确认的记忆建议。用户已有相同键值的建议 (包括已批准或已拒绝的) 时不保存，返回 false。
+	CreateSuggestion(ctx context.Context, suggestion *entity.MemorySuggestion) (created bool, err error)
+
+	// GetSuggestion 获取指定用户的记忆建议，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetSuggestion(ctx context.Context, userID string, suggestionID string) (*entity.MemorySuggestion, error)
+
+	// ListSuggestions 列出用户的记忆建议，按创建时间倒序排列。status 为空时返回所有状态的建议。
+	ListSuggestions(ctx context.Context, userID string, status entity.MemorySuggestionStatus) ([]*entity.MemorySuggestion, error)
+
+	// ResolveSuggestion 将待确认的建议标记为 status (批准或拒绝) 并返回更新后的建议。
+	// 建议不存在时返回 CodeNotFound 错误，已经处理过时返回 CodeConflict 错误。
+	ResolveSuggestion(ctx context.Context, userID string, suggestionID string, status entity.MemorySuggestionStatus) (*entity.MemorySuggestion, error)
+
+	// ApproveSuggestion 在同一个事务中将待确认的建议标记为已批准，并写入 memory (键已存在时覆盖)，
+	// 成功后 memory 被更新为写入后的记忆。错误与 ResolveSuggestion 相同，出错时两者都不会写入。
+	ApproveSuggestion(ctx context.Context, userID string, suggestionID string, memory *entity.StructuredMemory) (*entity.MemorySuggestion, error)
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// MessageSearchRepository 定义了搜索对话消息的方法。
+// 消息向量与文档向量分开存储，不会出现在文档的 RAG 检索结果中。
+type MessageSearchRepository interface {
+	// SearchFullText 在指定用户的对话消息中进行全文检索，按相关度降序返回。
+	SearchFullText(ctx context.Context, userID string, query *entity.MessageSearchQuery) ([]*entity.MessageSearchResult, error)
+
+	// SearchSemantic 在指定用户已生成向量的消息中检索与查询向量最相似的消息。
+	SearchSemantic(ctx context.Context, userID string, queryVector pgvector.Vector, query *entity.MessageSearchQuery) ([]*entity.MessageSearchResult, error)
+
+	// SaveMessageEmbedding 保存 (或替换) 消息的向量。
+	SaveMessageEmbedding(ctx context.Context, message *entity.Message, vector pgvector.Vector) error
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// PersonaRepository 定义了与人设 (personas 表) 交互的方法。所有方法都按 user_id 隔离数据。
+type PersonaRepository interface {
+	// CreatePersona 创建人设，同一用户下名称重复时返回 CodeConflict 错误。
+	CreatePersona(ctx context.Context, persona *entity.Persona) error
+
+	// GetPersona 获取指定用户的人设，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetPersona(ctx context.Context, userID string, personaID string) (*entity.Persona, error)
+
+	// ListPersonas 列出用户的所有人设，按名称排序。
+	ListPersonas(ctx context.Context, userID string) ([]*entity.Persona, error)
+
+	// UpdatePersona 更新人设的名称、系统提示词和生成设置 (不修改默认状态)，返回更新后的人设。
+	// 不存在时返回 CodeNotFound 错误，名称重复时返回 CodeConflict 错误。
+	UpdatePersona(ctx context.Context, persona *entity.Persona) (*entity.Persona, error)
+
+	// DeletePersona 删除人设，使用该人设的对话恢复为使用默认人设 (外键 ON DELETE SET NULL)。
+	DeletePersona(ctx context.Context, userID string, personaID string) error
+
+	// SetDefaultPersona 在同一事务中将指定人设设为用户的默认人设，并取消原默认人设。
+	// personaID 为空时只取消默认人设。人设不存在时返回 CodeNotFound 错误。
+	SetDefaultPersona(ctx context.Context, userID string, personaID string) error
+
+	// GetConversationPersona 返回对话使用的人设：对话选择的人设，或者对话没有选择时用户的默认人设。
+	// 都没有时返回 nil, nil。
+	GetConversationPersona(ctx context.Context, userID string, conversationID string) (*entity.Persona, error)
+}
@@ -0,0 +1,66 @@
+package pgvector
+
+import (
+	"context"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/internal/repository/postgres"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure pgMemoryEmbeddingRepository implements MemoryEmbeddingRepository interface.
+var _ repository.MemoryEmbeddingRepository = (*pgMemoryEmbeddingRepository)(nil)
+
+// pgMemoryEmbeddingRepository 是 MemoryEmbeddingRepository 接口的 pgvector 实现。
+type pgMemoryEmbeddingRepository struct {
+	db *postgres.DB
+}
+
+// NewPGMemoryEmbeddingRepository 创建一个新的 pgMemoryEmbeddingRepository 实例。
+func NewPGMemoryEmbeddingRepository(db *postgres.DB) repository.MemoryEmbeddingRepository {
+	return &pgMemoryEmbeddingRepository{db: db}
+}
+
+// GetMemoryEmbeddings 返回用户所有已生成向量的记忆。
+func (r *pgMemoryEmbeddingRepository) GetMemoryEmbeddings(ctx context.Context, userID string) (map[string]*repository.MemoryEmbedding, error) {
+	// 向量以文本格式读取 (连接上没有注册 vector 类型的二进制编解码)
+	const sql = `SELECT memory_id, embedding::text, memory_updated_at FROM structured_memory_embeddings WHERE user_id = $1`
+	rows, err := r.db.Pool.Query(ctx, sql, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取记忆向量失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取记忆向量")
+	}
+	defer rows.Close()
+
+	embeddings := make(map[string]*repository.MemoryEmbedding)
+	for rows.Next() {
+		var e repository.MemoryEmbedding
+		if err := rows.Scan(&e.MemoryID, &e.Vector, &e.MemoryUpdatedAt); err != nil {
+			logger.ErrorContext(ctx, "扫描记忆向量失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理记忆向量时出错")
+		}
+		embeddings[e.MemoryID] = &e
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (记忆向量)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return embeddings, nil
+}
+
+// SaveMemoryEmbedding 保存记忆的向量，重复执行时替换已有的向量。
+func (r *pgMemoryEmbeddingRepository) SaveMemoryEmbedding(ctx context.Context, memory *entity.StructuredMemory, vector pgvector.Vector) error {
+	const sql = `
+		INSERT INTO structured_memory_embeddings (memory_id, user_id, embedding, memory_updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (memory_id) DO UPDATE
+		SET embedding = EXCLUDED.embedding, memory_updated_at = EXCLUDED.memory_updated_at, created_at = NOW()`
+	if _, err := r.db.Pool.Exec(ctx, sql, memory.ID, memory.UserID, vector, memory.UpdatedAt); err != nil {
+		logger.ErrorContext(ctx, "保存记忆向量失败", "error", err, "memory_id", memory.ID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法保存记忆向量")
+	}
+	return nil
+}
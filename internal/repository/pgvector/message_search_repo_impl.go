@@ -0,0 +1,255 @@
+package pgvector
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/internal/repository/postgres"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// snippetContextRunes 是子串匹配和语义检索结果中匹配位置前后保留的字符数。
+	snippetContextRunes = 60
+	// highlightStart 和 highlightStop 标记片段中匹配的内容。片段的其余部分经过 HTML 转义。
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+	// headlineStart 和 headlineStop 是传给 ts_headline 的匹配标记 (Unicode 私用区字符，消息内容中的同名字符会先被删除)。
+	// ts_headline 不转义内容，因此先用这两个字符标记，转义后再替换为 highlightStart 和 highlightStop。
+	headlineStart = "\ue000"
+	headlineStop  = "\ue001"
+)
+
+// messageSearchColumns 是搜索结果的公共列，snippet 列由调用方提供，顺序与 scanSearchResults 一致。
+// position 是消息在其所在分支上的位置 (从 1 开始，即沿 parent_id 回溯到第一条消息经过的消息数)。
+const messageSearchColumns = `
+	h.id, h.conversation_id, c.title, h.sender_role, %s AS snippet, h.timestamp,
+	(WITH RECURSIVE ancestors AS (
+		SELECT p.parent_id FROM conversation_history p WHERE p.id = h.id
+		UNION ALL
+		SELECT p.parent_id FROM conversation_history p JOIN ancestors a ON p.id = a.parent_id
+	) SELECT COUNT(*) FROM ancestors) AS position,
+	%s AS score`
+
+// pgMessageSearchRepository 是 MessageSearchRepository 接口的 PostgreSQL 实现 (全文检索 + pgvector)。
+type pgMessageSearchRepository struct {
+	db *postgres.DB
+}
+
+// NewPGMessageSearchRepository 创建一个新的 pgMessageSearchRepository 实例。
+func NewPGMessageSearchRepository(db *postgres.DB) repository.MessageSearchRepository {
+	return &pgMessageSearchRepository{db: db}
+}
+
+// SearchFullText 使用 PostgreSQL 全文检索搜索消息。
+// 'simple' 分词器无法切分中日韩文字，搜索词包含这些文字时改用子串匹配 (由 pg_trgm 索引加速)。
+func (r *pgMessageSearchRepository) SearchFullText(ctx context.Context, userID string, query *entity.MessageSearchQuery) ([]*entity.MessageSearchResult, error) {
+	if containsCJK(query.Query) {
+		return r.searchSubstring(ctx, userID, query)
+	}
+
+	args := []any{userID, query.Query, headlineStart + headlineStop,
+		"StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", MaxWords=35, MinWords=15, MaxFragments=2"}
+	where := append([]string{"h.user_id = $1", "h.content_tsv @@ q.query"}, messageFilterClauses(query, &args)...)
+	columns := fmt.Sprintf(messageSearchColumns,
+		`ts_headline('simple', translate(h.message_content, $3, ''), q.query, $4)`,
+		`ts_rank(h.content_tsv, q.query)`)
+	sql := fmt.Sprintf(`
+		SELECT %s
+		FROM conversation_history h
+		JOIN conversations c ON c.id = h.conversation_id
+		CROSS JOIN websearch_to_tsquery('simple', $2) AS q(query)
+		WHERE %s
+		ORDER BY score DESC, h.timestamp DESC
+		%s`, columns, strings.Join(where, " AND "), pageClause(query, &args))
+
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		logger.ErrorContext(ctx, "全文检索消息失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "搜索消息失败")
+	}
+	return scanSearchResults(ctx, rows, escapeHeadline)
+}
+
+// searchSubstring 不区分大小写地匹配包含搜索词的消息，按 pg_trgm 的词相似度和时间排序。
+func (r *pgMessageSearchRepository) searchSubstring(ctx context.Context, userID string, query *entity.MessageSearchQuery) ([]*entity.MessageSearchResult, error) {
+	term := strings.TrimSpace(query.Query)
+	args := []any{userID, term, "%" + escapeLike(term) + "%"}
+	where := append([]string{"h.user_id = $1", `h.message_content ILIKE $3 ESCAPE '\'`}, messageFilterClauses(query, &args)...)
+	columns := fmt.Sprintf(messageSearchColumns, `h.message_content`, `word_similarity($2, h.message_content)`)
+	sql := fmt.Sprintf(`
+		SELECT %s
+		FROM conversation_history h
+		JOIN conversations c ON c.id = h.conversation_id
+		WHERE %s
+		ORDER BY score DESC, h.timestamp DESC
+		%s`, columns, strings.Join(where, " AND "), pageClause(query, &args))
+
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		logger.ErrorContext(ctx, "子串匹配搜索消息失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "搜索消息失败")
+	}
+	return scanSearchResults(ctx, rows, func(content string) string { return highlightSnippet(content, term) })
+}
+
+// SearchSemantic 按余弦距离检索与查询向量最相似的消息。
+func (r *pgMessageSearchRepository) SearchSemantic(ctx context.Context, userID string, queryVector pgvector.Vector, query *entity.MessageSearchQuery) ([]*entity.MessageSearchResult, error) {
+	args := []any{userID, queryVector}
+	where := append([]string{"e.user_id = $1"}, messageFilterClauses(query, &args)...)
+	columns := fmt.Sprintf(messageSearchColumns, `h.message_content`, `1 - (e.embedding <=> $2)`)
+	sql := fmt.Sprintf(`
+		SELECT %s
+		FROM message_embeddings e
+		JOIN conversation_history h ON h.id = e.message_id
+		JOIN conversations c ON c.id = h.conversation_id
+		WHERE %s
+		ORDER BY e.embedding <=> $2
+		%s`, columns, strings.Join(where, " AND "), pageClause(query, &args))
+
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		logger.ErrorContext(ctx, "语义检索消息失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "搜索消息失败")
+	}
+	return scanSearchResults(ctx, rows, func(content string) string { return truncateSnippet(content) })
+}
+
+// SaveMessageEmbedding 保存消息的向量，重复执行时替换已有的向量。
+func (r *pgMessageSearchRepository) SaveMessageEmbedding(ctx context.Context, message *entity.Message, vector pgvector.Vector) error {
+	const sql = `
+		INSERT INTO message_embeddings (message_id, conversation_id, user_id, embedding)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id) DO UPDATE SET embedding = EXCLUDED.embedding, created_at = NOW()`
+	if _, err := r.db.Pool.Exec(ctx, sql, message.ID, message.ConversationID, message.UserID, vector); err != nil {
+		logger.ErrorContext(ctx, "保存消息向量失败", "error", err, "message_id", message.ID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法保存消息向量")
+	}
+	return nil
+}
+
+// messageFilterClauses 根据对话、角色和时间范围生成 WHERE 条件 (作用于别名 h)，并将参数追加到 args。
+func messageFilterClauses(query *entity.MessageSearchQuery, args *[]any) []string {
+	var clauses []string
+	add := func(format string, value any) {
+		*args = append(*args, value)
+		clauses = append(clauses, fmt.Sprintf(format, len(*args)))
+	}
+	if query.ConversationID != "" {
+		add("h.conversation_id = $%d", query.ConversationID)
+	}
+	if query.Role != "" {
+		add("h.sender_role = $%d", string(query.Role))
+	}
+	if query.After != nil {
+		add("h.timestamp >= $%d", *query.After)
+	}
+	if query.Before != nil {
+		add("h.timestamp < $%d", *query.Before)
+	}
+	return clauses
+}
+
+// pageClause 生成 LIMIT/OFFSET 子句，并将参数追加到 args。
+func pageClause(query *entity.MessageSearchQuery, args *[]any) string {
+	*args = append(*args, query.Limit, query.Offset)
+	return fmt.Sprintf("LIMIT $%d OFFSET $%d", len(*args)-1, len(*args))
+}
+
+// scanSearchResults 扫描搜索结果并关闭 rows；snippetFn 不为 nil 时用于将 snippet 列 (消息全文) 转换为片段。
+func scanSearchResults(ctx context.Context, rows pgx.Rows, snippetFn func(content string) string) ([]*entity.MessageSearchResult, error) {
+	defer rows.Close()
+
+	results := make([]*entity.MessageSearchResult, 0)
+	for rows.Next() {
+		var res entity.MessageSearchResult
+		if err := rows.Scan(&res.MessageID, &res.ConversationID, &res.ConversationTitle, &res.SenderRole, &res.Snippet, &res.Timestamp, &res.Position, &res.Score); err != nil {
+			logger.ErrorContext(ctx, "扫描数据库行失败 (消息搜索)", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		if snippetFn != nil {
+			res.Snippet = snippetFn(res.Snippet)
+		}
+		results = append(results, &res)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (消息搜索)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return results, nil
+}
+
+// containsCJK 判断字符串是否包含中日韩文字。
+func containsCJK(s string) bool {
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeLike 转义 LIKE 模式中的特殊字符 (配合 ESCAPE '\' 使用)。
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// escapeHeadline 对 ts_headline 生成的片段进行 HTML 转义，并将 headlineStart/headlineStop 替换为 <mark> 标记。
+func escapeHeadline(headline string) string {
+	escaped := html.EscapeString(headline)
+	return strings.NewReplacer(headlineStart, highlightStart, headlineStop, highlightStop).Replace(escaped)
+}
+
+// highlightSnippet 截取 content 中第一次出现 term (不区分大小写) 的位置前后的内容，
+// 对内容进行 HTML 转义后用 <mark> 标记匹配部分。
+func highlightSnippet(content string, term string) string {
+	runes := []rune(content)
+	lowerRunes := []rune(strings.ToLower(content))
+	termRunes := []rune(strings.ToLower(term))
+	idx := -1
+	// 逐字符比较而不是使用 strings.Index，保证下标是字符下标 (ToLower 可能改变字节长度)
+	if len(lowerRunes) == len(runes) {
+		for i := 0; i+len(termRunes) <= len(lowerRunes); i++ {
+			if string(lowerRunes[i:i+len(termRunes)]) == string(termRunes) {
+				idx = i
+				break
+			}
+		}
+	}
+	if idx < 0 || len(termRunes) == 0 {
+		return truncateSnippet(content)
+	}
+
+	start := max(idx-snippetContextRunes, 0)
+	end := min(idx+len(termRunes)+snippetContextRunes, len(runes))
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	b.WriteString(html.EscapeString(string(runes[start:idx])))
+	b.WriteString(highlightStart)
+	b.WriteString(html.EscapeString(string(runes[idx : idx+len(termRunes)])))
+	b.WriteString(highlightStop)
+	b.WriteString(html.EscapeString(string(runes[idx+len(termRunes) : end])))
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+// truncateSnippet 返回 content 开头的一段内容 (经过 HTML 转义)。
+func truncateSnippet(content string) string {
+	runes := []rune(content)
+	if len(runes) <= 2*snippetContextRunes {
+		return html.EscapeString(content)
+	}
+	return html.EscapeString(string(runes[:2*snippetContextRunes])) + "..."
+}
@@ -0,0 +1,54 @@
+package pgvector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	tests := []struct {
+		name    string
+		content string
+		term    string
+		want    string
+	}{
+		{"match", "deploy the release today", "release", "deploy the <mark>release</mark> today"},
+		{"case insensitive", "Deploy The RELEASE", "release", "Deploy The <mark>RELEASE</mark>"},
+		{"first match only", "a b a", "a", "<mark>a</mark> b a"},
+		{"multibyte", "今天发布新版本", "发布", "今天<mark>发布</mark>新版本"},
+		{"escapes content", `<script>alert("x")</script> release & more`, "release",
+			`&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <mark>release</mark> &amp; more`},
+		{"escapes matched text", "a <b> c", "<b>", "a <mark>&lt;b&gt;</mark> c"},
+		{"context is trimmed", long + "needle" + long, "needle",
+			"..." + strings.Repeat("x", snippetContextRunes) + "<mark>needle</mark>" + strings.Repeat("x", snippetContextRunes) + "..."},
+		{"no match", "<i>plain</i>", "missing", "&lt;i&gt;plain&lt;/i&gt;"},
+		{"empty term", "text", "", "text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlightSnippet(tt.content, tt.term); got != tt.want {
+				t.Errorf("highlightSnippet(%q, %q) = %q, want %q", tt.content, tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateSnippet(t *testing.T) {
+	short := "<b>short</b>"
+	if got, want := truncateSnippet(short), "&lt;b&gt;short&lt;/b&gt;"; got != want {
+		t.Errorf("truncateSnippet(%q) = %q, want %q", short, got, want)
+	}
+	long := strings.Repeat("界", 3*snippetContextRunes)
+	if got, want := truncateSnippet(long), strings.Repeat("界", 2*snippetContextRunes)+"..."; got != want {
+		t.Errorf("truncateSnippet(long) = %q, want %q", got, want)
+	}
+}
+
+func TestEscapeHeadline(t *testing.T) {
+	headline := "run " + headlineStart + "<script>" + headlineStop + " & done"
+	want := "run <mark>&lt;script&gt;</mark> &amp; done"
+	if got := escapeHeadline(headline); got != want {
+		t.Errorf("escapeHeadline(%q) = %q, want %q", headline, got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	// "github.com/google/uuid" // Removed unused import
 	"github.com/pgvector/pgvector-go"
@@ -27,8 +28,11 @@ const (
 	metadataChunkIDKey = "chunk_id"
 	// metadataContentKey 是 cmetadata JSONB 字段中存储块内容的键 (可选，如果 document 列不存在或不适用)。
 	// metadataContentKey = "content"
-	// metadataChunkIndexKey 是 cmetadata JSONB 字段中存储块索引的键 (可选)。
-	// metadataChunkIndexKey = "chunk_index"
+	// metadataChunkIndexKey 是 cmetadata JSONB 字段中存储块索引的键 (用于按顺序列出文档块)。
+	metadataChunkIndexKey = "chunk_index"
+	// vectorIndexName 是向量列上的 IVFFlat 索引 (见 init_db.sql)。
+	// IVFFlat 的聚类中心在建索引时确定，数据量变化较大后需要重建索引以保持召回率。
+	vectorIndexName = "langchain_pg_embedding_ivfflat_idx"
 )
 
 // pgVectorRepository 是 VectorRepository 接口的 PGVector 实现。
@@ -95,6 +99,7 @@ func (r *pgVectorRepository) AddChunks(ctx context.Context, chunks []*entity.Doc
 		chunk.Metadata[metadataUserIDKey] = chunk.UserID
 		chunk.Metadata[metadataDocumentIDKey] = chunk.DocumentID // Already string
 		chunk.Metadata[metadataChunkIDKey] = chunk.ID            // Already string
+		chunk.Metadata[metadataChunkIndexKey] = chunk.ChunkIndex
 
 		metadataBytes, errJson := json.Marshal(chunk.Metadata)
 		if errJson != nil {
@@ -131,7 +136,7 @@ func (r *pgVectorRepository) AddChunks(ctx context.Context, chunks []*entity.Doc
 
 // SearchSimilarChunks 搜索与查询向量相似的文档块。
 // Added userID string parameter for filtering
-func (r *pgVectorRepository) SearchSimilarChunks(ctx context.Context, userID string, queryVector pgvector.Vector, limit int, filter map[string]any) ([]repository.SearchResult, error) {
+func (r *pgVectorRepository) SearchSimilarChunks(ctx context.Context, userID string, queryVector pgvector.Vector, limit int, filter *entity.ChunkFilter) ([]repository.SearchResult, error) {
 	// userID is now passed explicitly.
 
 	// -- 构建 SQL 查询 --
@@ -155,14 +160,31 @@ func (r *pgVectorRepository) SearchSimilarChunks(ctx context.Context, userID str
 	args := []interface{}{queryVector} // $1 是查询向量
 	argCounter := 2                    // 从 $2 开始用于其他过滤器
 
-	// 添加来自 filter map 的额外过滤条件
-	for key, value := range filter {
-		// 对 key 进行基本清理，防止注入 (虽然这里 key 来自内部，但仍是好习惯)
-		// 更健壮的方法是使用白名单验证 key
-		safeKey := key // 假设 key 是安全的元数据字段名
-		whereClauses = append(whereClauses, fmt.Sprintf("cmetadata->>'%s' = $%d", safeKey, argCounter))
-		args = append(args, value)
-		argCounter++
+	// 添加基于元数据的过滤条件 (消息导入器写入的发送者、会话和时间)
+	if !filter.IsEmpty() {
+		if filter.Sender != "" {
+			whereClauses = append(whereClauses, fmt.Sprintf("(lower(cmetadata->>'%s') = lower($%d) OR lower(cmetadata->>'%s') = lower($%d))",
+				entity.ChunkMetaSender, argCounter, entity.ChunkMetaSenderAddress, argCounter))
+			args = append(args, filter.Sender)
+			argCounter++
+		}
+		if filter.ThreadID != "" {
+			whereClauses = append(whereClauses, fmt.Sprintf("cmetadata->>'%s' = $%d", entity.ChunkMetaThreadID, argCounter))
+			args = append(args, filter.ThreadID)
+			argCounter++
+		}
+		// sent_at / sent_until 统一以 UTC 的 RFC 3339 格式存储，可以直接按字符串比较，避免类型转换失败。
+		// 合并的聊天片段覆盖一个时间范围，只要与过滤范围重叠就匹配。
+		if filter.SentAfter != nil {
+			whereClauses = append(whereClauses, fmt.Sprintf("COALESCE(cmetadata->>'%s', cmetadata->>'%s') >= $%d", entity.ChunkMetaSentUntil, entity.ChunkMetaSentAt, argCounter))
+			args = append(args, filter.SentAfter.UTC().Format(time.RFC3339))
+			argCounter++
+		}
+		if filter.SentBefore != nil {
+			whereClauses = append(whereClauses, fmt.Sprintf("cmetadata->>'%s' < $%d", entity.ChunkMetaSentAt, argCounter))
+			args = append(args, filter.SentBefore.UTC().Format(time.RFC3339))
+			argCounter++
+		}
 	}
 
 	whereClause := ""
@@ -260,3 +282,102 @@ func (r *pgVectorRepository) DeleteChunksByDocumentID(ctx context.Context, userI
 	// 注意：即使 RowsAffected 为 0 也可能不是错误（可能该文档没有块，或已被删除）
 	return nil
 }
+
+// ListChunksByDocumentID 按块索引顺序列出指定文档的向量块 (不包含向量)。
+// 较早写入的块可能没有 chunk_index 元数据，这些块排在最后。
+func (r *pgVectorRepository) ListChunksByDocumentID(ctx context.Context, userID string, documentID string, limit int, offset int) ([]*entity.DocumentChunk, error) {
+	filterBytes, err := json.Marshal(map[string]string{
+		metadataUserIDKey:     userID,
+		metadataDocumentIDKey: documentID,
+	})
+	if err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法构建查询条件")
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT
+			COALESCE(cmetadata->>'%[1]s', uuid::text) AS chunk_id,
+			COALESCE(document, '') AS content,
+			cmetadata
+		FROM %[2]s
+		WHERE cmetadata @> $1::jsonb
+		ORDER BY (cmetadata->>'%[3]s')::int ASC NULLS LAST, uuid ASC
+		LIMIT $2 OFFSET $3
+	`, metadataChunkIDKey, tableName, metadataChunkIndexKey)
+
+	rows, err := r.db.Pool.Query(ctx, sql, string(filterBytes), limit, offset)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询文档向量块失败", "error", err, "document_id", documentID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询文档块")
+	}
+	defer rows.Close()
+
+	chunks := make([]*entity.DocumentChunk, 0)
+	for rows.Next() {
+		var chunkID, content string
+		var metadataBytes []byte
+		if err := rows.Scan(&chunkID, &content, &metadataBytes); err != nil {
+			logger.ErrorContext(ctx, "扫描文档向量块行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+
+		var metadataMap map[string]any
+		if err := json.Unmarshal(metadataBytes, &metadataMap); err != nil {
+			logger.WarnContext(ctx, "无法解析文档块的 cmetadata", "error", err, "chunk_id", chunkID)
+			metadataMap = make(map[string]any)
+		}
+
+		chunkIndex := -1 // 未记录索引的旧数据
+		if idx, ok := metadataMap[metadataChunkIndexKey].(float64); ok {
+			chunkIndex = int(idx)
+		}
+
+		chunks = append(chunks, &entity.DocumentChunk{
+			ID:         chunkID,
+			DocumentID: documentID,
+			UserID:     userID,
+			ChunkIndex: chunkIndex,
+			Content:    content,
+			Metadata:   metadataMap,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理文档向量块结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+
+	return chunks, nil
+}
+
+// DeleteOrphanedChunks 删除 document_id 元数据指向的文档已不存在的向量块。
+func (r *pgVectorRepository) DeleteOrphanedChunks(ctx context.Context) (int64, error) {
+	sql := fmt.Sprintf(`
+		DELETE FROM %[1]s e
+		WHERE e.cmetadata ? '%[2]s'
+		  AND NOT EXISTS (SELECT 1 FROM documents d WHERE d.id::text = e.cmetadata->>'%[2]s')`,
+		tableName, metadataDocumentIDKey)
+	cmdTag, err := r.db.Pool.Exec(ctx, sql)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除孤立向量块失败", "error", err)
+		return 0, apperr.Wrap(err, apperr.CodeInternal, "无法删除孤立向量块")
+	}
+	return cmdTag.RowsAffected(), nil
+}
+
+// OptimizeIndexes 对向量表执行 VACUUM ANALYZE，reindex 为 true 时使用 REINDEX CONCURRENTLY 重建向量索引 (不阻塞读写)。
+// 这两条语句都不能在事务中执行，不带参数的 Exec 使用简单查询协议，不会隐式开启事务。
+func (r *pgVectorRepository) OptimizeIndexes(ctx context.Context, reindex bool) error {
+	if reindex {
+		start := time.Now()
+		if _, err := r.db.Pool.Exec(ctx, "REINDEX INDEX CONCURRENTLY "+vectorIndexName); err != nil {
+			logger.ErrorContext(ctx, "重建向量索引失败", "error", err, "index", vectorIndexName)
+			return apperr.Wrap(err, apperr.CodeInternal, "无法重建向量索引")
+		}
+		logger.InfoContext(ctx, "向量索引重建完成", "index", vectorIndexName, "duration", time.Since(start))
+	}
+	if _, err := r.db.Pool.Exec(ctx, "VACUUM (ANALYZE) "+tableName); err != nil {
+		logger.ErrorContext(ctx, "VACUUM 向量表失败", "error", err, "table", tableName)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法清理向量表")
+	}
+	return nil
+}
@@ -2,7 +2,11 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/soaringjerry/dreamhub/internal/entity"
 	"github.com/soaringjerry/dreamhub/internal/repository"
 	"github.com/soaringjerry/dreamhub/pkg/apperr"
@@ -19,21 +23,45 @@ func NewPostgresChatRepository(db *DB) repository.ChatRepository {
 	return &postgresChatRepository{db: db}
 }
 
-// SaveMessage 保存一条新的对话消息到 conversation_history 表。
+// messageColumns 是查询 conversation_history 表时使用的列列表，顺序与 scanMessage 一致。
+const messageColumns = `id, conversation_id, user_id, parent_id, sender_role, message_content, timestamp, metadata`
+
+// scanMessage 将一行 messageColumns 结果扫描为 Message 实体。
+func scanMessage(row pgx.Row) (*entity.Message, error) {
+	var msg entity.Message
+	// 注意：扫描 metadata (JSONB) 到 json.RawMessage
+	if err := row.Scan(&msg.ID, &msg.ConversationID, &msg.UserID, &msg.ParentID, &msg.SenderRole, &msg.Content, &msg.Timestamp, &msg.Metadata); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// SaveMessage 保存一条新的对话消息到 conversation_history 表，
+// 并在同一事务中更新对话的最后活动时间，将新消息设为当前分支的最后一条消息。
 func (r *postgresChatRepository) SaveMessage(ctx context.Context, message *entity.Message) error {
-	const sql = `
-		INSERT INTO conversation_history (id, conversation_id, user_id, sender_role, message_content, timestamp, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	const insertSQL = `
+		INSERT INTO conversation_history (id, conversation_id, user_id, parent_id, sender_role, message_content, timestamp, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
-	_, err := r.db.Pool.Exec(ctx, sql,
-		message.ID,
-		message.ConversationID,
-		message.UserID, // user_id 用于数据隔离
-		message.SenderRole,
-		message.Content,
-		message.Timestamp,
-		message.Metadata, // 确保存储的是 JSONB 兼容的类型 (json.RawMessage 应该可以)
-	)
+	const touchSQL = `
+		UPDATE conversations SET last_message_at = GREATEST(last_message_at, $1), active_leaf_id = $2
+		WHERE id = $3 AND user_id = $4`
+	err := r.db.ExecuteInTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, insertSQL,
+			message.ID,
+			message.ConversationID,
+			message.UserID, // user_id 用于数据隔离
+			message.ParentID,
+			message.SenderRole,
+			message.Content,
+			message.Timestamp,
+			message.Metadata, // 确保存储的是 JSONB 兼容的类型 (json.RawMessage 应该可以)
+		); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, touchSQL, message.Timestamp, message.ID, message.ConversationID, message.UserID)
+		return err
+	})
 	if err != nil {
 		logger.ErrorContext(ctx, "保存消息到数据库失败", "error", err, "message_id", message.ID)
 		return apperr.Wrap(err, apperr.CodeInternal, "无法保存对话消息") // Use CodeInternal
@@ -42,17 +70,12 @@ func (r *postgresChatRepository) SaveMessage(ctx context.Context, message *entit
 	return nil
 }
 
-// GetMessagesByConversationID 获取指定对话的所有消息，按时间戳升序排列。
+// GetMessagesByConversationID 获取指定对话的所有消息 (包括所有分支)，按时间戳升序排列。
 // 强制使用 ctx 中的 user_id 进行过滤。
 // conversationID is now string
 func (r *postgresChatRepository) GetMessagesByConversationID(ctx context.Context, userID string, conversationID string, limit int, offset int) ([]*entity.Message, error) {
-	// userID is now passed as a parameter, remove GetUserIDFromCtx
-	// if err != nil { // Error handling for GetUserIDFromCtx removed
-	// 	return nil, err // GetUserIDFromCtx 已经包装了错误
-	// }
-
-	const sql = `
-		SELECT id, conversation_id, user_id, sender_role, message_content, timestamp, metadata
+	sql := `
+		SELECT ` + messageColumns + `
 		FROM conversation_history
 		WHERE conversation_id = $1 AND user_id = $2
 		ORDER BY timestamp ASC
@@ -64,133 +87,306 @@ func (r *postgresChatRepository) GetMessagesByConversationID(ctx context.Context
 		logger.ErrorContext(ctx, "从数据库获取对话消息失败", "error", err, "conversation_id", conversationID, "user_id", userID)
 		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取对话消息") // Use CodeInternal
 	}
-	defer rows.Close()
+	return collectMessages(ctx, rows)
+}
 
-	messages := make([]*entity.Message, 0)
-	for rows.Next() {
-		var msg entity.Message
-		// 注意：扫描 metadata (JSONB) 到 json.RawMessage
-		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.UserID, &msg.SenderRole, &msg.Content, &msg.Timestamp, &msg.Metadata); err != nil {
-			logger.ErrorContext(ctx, "扫描数据库行失败", "error", err)
-			// 决定是继续处理部分结果还是返回错误
-			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+// GetMessage 获取对话中的单条消息。
+func (r *postgresChatRepository) GetMessage(ctx context.Context, userID string, conversationID string, messageID string) (*entity.Message, error) {
+	sql := `SELECT ` + messageColumns + ` FROM conversation_history WHERE id = $1 AND conversation_id = $2 AND user_id = $3`
+	msg, err := scanMessage(r.db.Pool.QueryRow(ctx, sql, messageID, conversationID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("消息未找到")
 		}
-		messages = append(messages, &msg)
+		logger.ErrorContext(ctx, "获取消息失败", "error", err, "message_id", messageID, "conversation_id", conversationID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取消息")
 	}
-
-	if err := rows.Err(); err != nil {
-		logger.ErrorContext(ctx, "处理数据库结果集时出错", "error", err)
-		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
-	}
-
-	return messages, nil
+	return msg, nil
 }
 
-// GetConversationHistory 获取指定对话的最近 N 条消息，按时间戳降序排列。
+// GetConversationHistory 获取对话当前分支的最近 N 条消息 (从当前分支的最后一条消息沿 parent_id 向上回溯)，按时间顺序排列。
 // 强制使用 ctx 中的 user_id 进行过滤。
 // conversationID is now string
 func (r *postgresChatRepository) GetConversationHistory(ctx context.Context, userID string, conversationID string, lastN int) ([]*entity.Message, error) {
-	// userID is now passed as a parameter, remove GetUserIDFromCtx
-	// if err != nil { // Error handling for GetUserIDFromCtx removed
-	// 	return nil, err
-	// }
+	const leafSQL = `(SELECT active_leaf_id FROM conversations WHERE id = $1 AND user_id = $2)`
+	return r.walkBranch(ctx, userID, conversationID, leafSQL, lastN)
+}
+
+// GetMessageBranch 获取以指定消息结尾的分支上的最近 N 条消息，按时间顺序排列 (最后一条为 leafID 对应的消息)。
+func (r *postgresChatRepository) GetMessageBranch(ctx context.Context, userID string, conversationID string, leafID string, lastN int) ([]*entity.Message, error) {
+	return r.walkBranch(ctx, userID, conversationID, `$4::uuid`, lastN, leafID)
+}
 
-	// lastN <= 0 表示获取所有历史记录（或者可以设定一个合理的默认值/上限）
+// walkBranch 从 leafExpr 指定的消息开始沿 parent_id 向上回溯最多 lastN 条消息，按时间顺序返回。
+// leafExpr 可以引用 $1 (conversation_id)、$2 (user_id) 以及 extraArgs 对应的 $4 之后的参数。
+func (r *postgresChatRepository) walkBranch(ctx context.Context, userID string, conversationID string, leafExpr string, lastN int, extraArgs ...any) ([]*entity.Message, error) {
+	// lastN <= 0 表示不获取历史记录
 	if lastN <= 0 {
-		// 可以选择返回错误，或者获取所有记录（可能需要调整查询）
-		// 这里我们暂时返回空切片，表示不获取
-		logger.WarnContext(ctx, "GetConversationHistory 请求 lastN <= 0", "conversation_id", conversationID, "user_id", userID, "lastN", lastN)
+		logger.WarnContext(ctx, "获取对话分支时 lastN <= 0", "conversation_id", conversationID, "user_id", userID, "lastN", lastN)
 		return []*entity.Message{}, nil
-		// 或者调整 SQL 去掉 LIMIT
 	}
 
-	const sql = `
-		SELECT id, conversation_id, user_id, sender_role, message_content, timestamp, metadata
-		FROM conversation_history
-		WHERE conversation_id = $1 AND user_id = $2
-		ORDER BY timestamp DESC
-		LIMIT $3
+	sql := `
+		WITH RECURSIVE branch AS (
+			SELECT ` + messageColumns + `, 1 AS depth
+			FROM conversation_history
+			WHERE id = ` + leafExpr + ` AND conversation_id = $1 AND user_id = $2
+			UNION ALL
+			SELECT h.id, h.conversation_id, h.user_id, h.parent_id, h.sender_role, h.message_content, h.timestamp, h.metadata, b.depth + 1
+			FROM conversation_history h
+			JOIN branch b ON h.id = b.parent_id
+			WHERE b.depth < $3
+		)
+		SELECT ` + messageColumns + ` FROM branch ORDER BY depth DESC
 	`
-	// Pass string conversationID to query
-	rows, err := r.db.Pool.Query(ctx, sql, conversationID, userID, lastN)
+	args := append([]any{conversationID, userID, lastN}, extraArgs...)
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
 	if err != nil {
-		logger.ErrorContext(ctx, "从数据库获取最近对话历史失败", "error", err, "conversation_id", conversationID, "user_id", userID, "lastN", lastN)
+		logger.ErrorContext(ctx, "从数据库获取对话分支失败", "error", err, "conversation_id", conversationID, "user_id", userID, "lastN", lastN)
 		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取最近对话历史") // Use CodeInternal
 	}
+	return collectMessages(ctx, rows)
+}
+
+// CountBranchMessages 统计以 leafID 结尾的分支上角色为 role 的消息数量，leafID 不存在时返回 0。
+func (r *postgresChatRepository) CountBranchMessages(ctx context.Context, userID string, conversationID string, leafID string, role entity.SenderRole) (int, error) {
+	sql := `
+		WITH RECURSIVE branch AS (
+			SELECT id, parent_id, sender_role
+			FROM conversation_history
+			WHERE id = $3 AND conversation_id = $1 AND user_id = $2
+			UNION ALL
+			SELECT h.id, h.parent_id, h.sender_role
+			FROM conversation_history h
+			JOIN branch b ON h.id = b.parent_id
+		)
+		SELECT COUNT(*) FROM branch WHERE sender_role = $4
+	`
+	var count int
+	if err := r.db.Pool.QueryRow(ctx, sql, conversationID, userID, leafID, string(role)).Scan(&count); err != nil {
+		logger.ErrorContext(ctx, "统计对话分支消息数失败", "error", err, "conversation_id", conversationID, "leaf_id", leafID)
+		return 0, apperr.Wrap(err, apperr.CodeInternal, "无法统计对话消息数")
+	}
+	return count, nil
+}
+
+// collectMessages 扫描并关闭 rows 中的所有消息。
+func collectMessages(ctx context.Context, rows pgx.Rows) ([]*entity.Message, error) {
 	defer rows.Close()
 
-	messages := make([]*entity.Message, 0, lastN) // 预分配容量
+	messages := make([]*entity.Message, 0)
 	for rows.Next() {
-		var msg entity.Message
-		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.UserID, &msg.SenderRole, &msg.Content, &msg.Timestamp, &msg.Metadata); err != nil {
-			logger.ErrorContext(ctx, "扫描数据库行失败 (历史记录)", "error", err)
+		msg, err := scanMessage(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描数据库行失败 (消息)", "error", err)
 			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
 		}
-		messages = append(messages, &msg)
+		messages = append(messages, msg)
 	}
-
 	if err := rows.Err(); err != nil {
-		logger.ErrorContext(ctx, "处理数据库结果集时出错 (历史记录)", "error", err)
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (消息)", "error", err)
 		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
 	}
-
-	// 因为查询是 DESC，但通常上下文需要按时间顺序 (ASC)，所以反转切片
-	reverseMessages(messages)
-
 	return messages, nil
 }
 
-// reverseMessages 原地反转消息切片。
-func reverseMessages(s []*entity.Message) {
-	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
-		s[i], s[j] = s[j], s[i]
+// conversationColumns 是查询 conversations 表时使用的列列表，顺序与 scanConversation 一致。
+const conversationColumns = `id, user_id, title, title_source, archived, pinned, created_at, last_message_at, active_leaf_id, persona_id`
+
+// scanConversation 将一行 conversationColumns 结果扫描为 Conversation 实体。
+func scanConversation(row pgx.Row) (*entity.Conversation, error) {
+	var conv entity.Conversation
+	if err := row.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.TitleSource, &conv.Archived, &conv.Pinned, &conv.CreatedAt, &conv.LastUpdatedAt, &conv.ActiveLeafID, &conv.PersonaID); err != nil {
+		return nil, err
 	}
+	return &conv, nil
 }
 
-// GetUserConversations 获取指定用户的所有对话基本信息，按最后更新时间降序排序。
-// 注意：当前实现从 conversation_history 推断信息，Title 字段将为空。
-func (r *postgresChatRepository) GetUserConversations(ctx context.Context, userID string) ([]*entity.Conversation, error) {
-	const sql = `
-		SELECT
-			conversation_id AS id,
-			user_id,
-			'' AS title, -- Title 暂时无法从 history 表高效获取
-			MIN(timestamp) AS created_at,
-			MAX(timestamp) AS last_updated_at
-		FROM conversation_history
-		WHERE user_id = $1
-		GROUP BY conversation_id, user_id
-		ORDER BY last_updated_at DESC
-	`
+// GetUserConversations 分页获取指定用户的对话，置顶的对话在前，其余按最后活动时间降序排序。
+func (r *postgresChatRepository) GetUserConversations(ctx context.Context, userID string, filter *entity.ConversationFilter, limit int, offset int) ([]*entity.Conversation, int, error) {
+	where := []string{"user_id = $1"}
+	args := []any{userID}
+	if filter != nil {
+		if filter.Archived != nil {
+			args = append(args, *filter.Archived)
+			where = append(where, fmt.Sprintf("archived = $%d", len(args)))
+		}
+		if filter.Pinned != nil {
+			args = append(args, *filter.Pinned)
+			where = append(where, fmt.Sprintf("pinned = $%d", len(args)))
+		}
+	}
+	whereClause := strings.Join(where, " AND ")
 
-	rows, err := r.db.Pool.Query(ctx, sql, userID)
+	var total int
+	if err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM conversations WHERE `+whereClause, args...).Scan(&total); err != nil {
+		logger.ErrorContext(ctx, "统计用户对话数量失败", "error", err, "user_id", userID)
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "无法获取用户对话列表")
+	}
+
+	args = append(args, limit, offset)
+	sql := fmt.Sprintf(`SELECT %s FROM conversations WHERE %s ORDER BY pinned DESC, last_message_at DESC, id LIMIT $%d OFFSET $%d`,
+		conversationColumns, whereClause, len(args)-1, len(args))
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
 	if err != nil {
 		logger.ErrorContext(ctx, "从数据库获取用户对话列表失败", "error", err, "user_id", userID)
-		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取用户对话列表")
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "无法获取用户对话列表")
 	}
 	defer rows.Close()
 
 	conversations := make([]*entity.Conversation, 0)
 	for rows.Next() {
-		var conv entity.Conversation
-		// 注意：确保 entity.Conversation 中的字段类型与查询结果匹配
-		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.CreatedAt, &conv.LastUpdatedAt); err != nil {
+		conv, err := scanConversation(rows)
+		if err != nil {
 			logger.ErrorContext(ctx, "扫描数据库行失败 (对话列表)", "error", err)
-			// 决定是继续处理部分结果还是返回错误
-			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+			return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
 		}
-		// 确保 UserID 匹配 (虽然 WHERE 子句已过滤，但作为安全检查)
-		if conv.UserID != userID {
-			logger.WarnContext(ctx, "查询结果中的 UserID 与请求不匹配", "expected_user_id", userID, "actual_user_id", conv.UserID, "conversation_id", conv.ID)
-			continue // 跳过不匹配的记录
-		}
-		conversations = append(conversations, &conv)
+		conversations = append(conversations, conv)
 	}
-
 	if err := rows.Err(); err != nil {
 		logger.ErrorContext(ctx, "处理数据库结果集时出错 (对话列表)", "error", err)
-		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return conversations, total, nil
+}
+
+// EnsureConversation 在对话不存在时创建对话记录。
+func (r *postgresChatRepository) EnsureConversation(ctx context.Context, userID string, conversationID string) error {
+	const insertSQL = `INSERT INTO conversations (id, user_id) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`
+	if _, err := r.db.Pool.Exec(ctx, insertSQL, conversationID, userID); err != nil {
+		logger.ErrorContext(ctx, "创建对话记录失败", "error", err, "conversation_id", conversationID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法创建对话")
+	}
+	// 对话已存在时确认属于该用户
+	var ownerID string
+	if err := r.db.Pool.QueryRow(ctx, `SELECT user_id FROM conversations WHERE id = $1`, conversationID).Scan(&ownerID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperr.ErrNotFound("对话未找到") // 在两条语句之间被删除
+		}
+		logger.ErrorContext(ctx, "查询对话记录失败", "error", err, "conversation_id", conversationID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法查询对话")
 	}
+	if ownerID != userID {
+		logger.WarnContext(ctx, "尝试访问不属于该用户的对话", "conversation_id", conversationID, "user_id", userID)
+		return apperr.ErrNotFound("对话未找到")
+	}
+	return nil
+}
 
-	return conversations, nil
+// CreateConversation 创建对话记录，对话 ID 已存在时不做修改。
+func (r *postgresChatRepository) CreateConversation(ctx context.Context, conv *entity.Conversation) (bool, error) {
+	const sql = `
+		INSERT INTO conversations (id, user_id, title, title_source, created_at, last_message_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (id) DO NOTHING`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, conv.ID, conv.UserID, conv.Title, conv.TitleSource, conv.CreatedAt)
+	if err != nil {
+		logger.ErrorContext(ctx, "创建对话记录失败", "error", err, "conversation_id", conv.ID, "user_id", conv.UserID)
+		return false, apperr.Wrap(err, apperr.CodeInternal, "无法创建对话")
+	}
+	return cmdTag.RowsAffected() > 0, nil
+}
+
+// GetConversation 获取指定用户的对话。
+func (r *postgresChatRepository) GetConversation(ctx context.Context, userID string, conversationID string) (*entity.Conversation, error) {
+	sql := `SELECT ` + conversationColumns + ` FROM conversations WHERE id = $1 AND user_id = $2`
+	conv, err := scanConversation(r.db.Pool.QueryRow(ctx, sql, conversationID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("对话未找到")
+		}
+		logger.ErrorContext(ctx, "获取对话失败", "error", err, "conversation_id", conversationID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取对话")
+	}
+	return conv, nil
+}
+
+// UpdateConversation 更新对话的标题、归档、置顶状态和人设 (nil 字段保持不变)。
+// 用户设置的非空标题会被标记为 user 来源，此后不再被自动标题覆盖；清空标题后恢复为 none。
+// 人设为空字符串时取消选择。
+func (r *postgresChatRepository) UpdateConversation(ctx context.Context, userID string, conversationID string, update *entity.ConversationUpdate) (*entity.Conversation, error) {
+	sql := `
+		UPDATE conversations
+		SET title = COALESCE($1, title),
+			title_source = CASE
+				WHEN $1 IS NULL THEN title_source
+				WHEN $1 = '' THEN 'none'
+				ELSE 'user'
+			END,
+			archived = COALESCE($2, archived), pinned = COALESCE($3, pinned),
+			persona_id = CASE
+				WHEN $6::text IS NULL THEN persona_id
+				WHEN $6::text = '' THEN NULL
+				ELSE $6::uuid
+			END
+		WHERE id = $4 AND user_id = $5
+		RETURNING ` + conversationColumns
+	conv, err := scanConversation(r.db.Pool.QueryRow(ctx, sql, update.Title, update.Archived, update.Pinned, conversationID, userID, update.PersonaID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("对话未找到")
+		}
+		logger.ErrorContext(ctx, "更新对话失败", "error", err, "conversation_id", conversationID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法更新对话")
+	}
+	logger.InfoContext(ctx, "对话更新成功", "conversation_id", conversationID)
+	return conv, nil
+}
+
+// DeleteConversation 删除对话，conversation_history 中的消息由外键级联删除。
+func (r *postgresChatRepository) DeleteConversation(ctx context.Context, userID string, conversationID string) error {
+	const sql = `DELETE FROM conversations WHERE id = $1 AND user_id = $2`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, conversationID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除对话失败", "error", err, "conversation_id", conversationID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除对话")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("对话未找到")
+	}
+	logger.InfoContext(ctx, "对话已删除", "conversation_id", conversationID, "user_id", userID)
+	return nil
+}
+
+// SetGeneratedTitle 保存自动生成的对话标题。只有尚无标题的对话 (force 为 true 时也包括已有自动标题的对话) 会被更新，
+// 用户手动设置的标题永远不会被覆盖。返回标题是否被更新。
+func (r *postgresChatRepository) SetGeneratedTitle(ctx context.Context, userID string, conversationID string, title string, force bool) (bool, error) {
+	const sql = `
+		UPDATE conversations
+		SET title = $1, title_source = 'auto'
+		WHERE id = $2 AND user_id = $3
+		  AND (title_source = 'none' OR ($4 AND title_source = 'auto'))`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, title, conversationID, userID, force)
+	if err != nil {
+		logger.ErrorContext(ctx, "保存自动生成的对话标题失败", "error", err, "conversation_id", conversationID, "user_id", userID)
+		return false, apperr.Wrap(err, apperr.CodeInternal, "无法更新对话标题")
+	}
+	return cmdTag.RowsAffected() > 0, nil
+}
+
+// SetActiveBranch 切换对话的当前分支：将指定消息所在子树中最新的一条消息设为当前分支的最后一条消息。
+// 子树中最新的消息一定是叶子节点 (子消息总是晚于父消息)，因此选择一条较早的消息会切换到它最近一次延续的分支。
+func (r *postgresChatRepository) SetActiveBranch(ctx context.Context, userID string, conversationID string, messageID string) (*entity.Conversation, error) {
+	sql := `
+		WITH RECURSIVE subtree AS (
+			SELECT id, timestamp FROM conversation_history
+			WHERE id = $3 AND conversation_id = $1 AND user_id = $2
+			UNION ALL
+			SELECT h.id, h.timestamp FROM conversation_history h
+			JOIN subtree s ON h.parent_id = s.id
+		)
+		UPDATE conversations
+		SET active_leaf_id = (SELECT id FROM subtree ORDER BY timestamp DESC, id DESC LIMIT 1)
+		WHERE id = $1 AND user_id = $2 AND EXISTS (SELECT 1 FROM subtree)
+		RETURNING ` + conversationColumns
+	conv, err := scanConversation(r.db.Pool.QueryRow(ctx, sql, conversationID, userID, messageID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("消息未找到")
+		}
+		logger.ErrorContext(ctx, "切换对话分支失败", "error", err, "conversation_id", conversationID, "message_id", messageID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法切换对话分支")
+	}
+	logger.InfoContext(ctx, "对话分支已切换", "conversation_id", conversationID, "active_leaf_id", conv.ActiveLeafID)
+	return conv, nil
 }
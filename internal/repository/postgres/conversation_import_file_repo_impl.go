@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure postgresConversationImportFileRepository implements ConversationImportFileRepository interface.
+var _ repository.ConversationImportFileRepository = (*postgresConversationImportFileRepository)(nil)
+
+// postgresConversationImportFileRepository 是 ConversationImportFileRepository 接口的 PostgreSQL 实现。
+type postgresConversationImportFileRepository struct {
+	db *DB
+}
+
+// NewPostgresConversationImportFileRepository 创建一个新的 postgresConversationImportFileRepository 实例。
+func NewPostgresConversationImportFileRepository(db *DB) repository.ConversationImportFileRepository {
+	return &postgresConversationImportFileRepository{db: db}
+}
+
+// SaveImportFile 记录一个等待导入的文件。
+func (r *postgresConversationImportFileRepository) SaveImportFile(ctx context.Context, file *entity.ConversationImportFile) error {
+	const sql = `
+		INSERT INTO conversation_import_files (stored_path, user_id, task_id, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), NOW())
+		RETURNING created_at
+	`
+	if err := r.db.Pool.QueryRow(ctx, sql, file.StoredPath, file.UserID, file.TaskID).Scan(&file.CreatedAt); err != nil {
+		logger.ErrorContext(ctx, "保存导入文件记录失败", "error", err, "stored_path", file.StoredPath, "user_id", file.UserID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法保存导入文件记录")
+	}
+	return nil
+}
+
+// SetImportFileTask 记录处理该文件的导入任务 ID。
+func (r *postgresConversationImportFileRepository) SetImportFileTask(ctx context.Context, storedPath string, taskID string) error {
+	const sql = `UPDATE conversation_import_files SET task_id = $1 WHERE stored_path = $2`
+	if _, err := r.db.Pool.Exec(ctx, sql, taskID, storedPath); err != nil {
+		logger.ErrorContext(ctx, "更新导入文件的任务 ID 失败", "error", err, "stored_path", storedPath, "task_id", taskID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法更新导入文件记录")
+	}
+	return nil
+}
+
+// DeleteImportFile 删除文件记录。
+func (r *postgresConversationImportFileRepository) DeleteImportFile(ctx context.Context, storedPath string) error {
+	const sql = `DELETE FROM conversation_import_files WHERE stored_path = $1`
+	if _, err := r.db.Pool.Exec(ctx, sql, storedPath); err != nil {
+		logger.ErrorContext(ctx, "删除导入文件记录失败", "error", err, "stored_path", storedPath)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除导入文件记录")
+	}
+	return nil
+}
+
+// ListImportFiles 列出所有等待导入的文件。
+func (r *postgresConversationImportFileRepository) ListImportFiles(ctx context.Context) ([]*entity.ConversationImportFile, error) {
+	const sql = `SELECT stored_path, user_id, COALESCE(task_id, ''), created_at FROM conversation_import_files`
+	rows, err := r.db.Pool.Query(ctx, sql)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询导入文件记录失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询导入文件记录")
+	}
+	defer rows.Close()
+
+	files := make([]*entity.ConversationImportFile, 0)
+	for rows.Next() {
+		var file entity.ConversationImportFile
+		if err := rows.Scan(&file.StoredPath, &file.UserID, &file.TaskID, &file.CreatedAt); err != nil {
+			logger.ErrorContext(ctx, "扫描导入文件记录行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		files = append(files, &file)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理导入文件记录结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return files, nil
+}
@@ -12,6 +12,27 @@ import (
 	"github.com/soaringjerry/dreamhub/pkg/logger"
 )
 
+// documentColumns 是查询 documents 表时使用的列列表，顺序与 scanDocument 一致。
+const documentColumns = `id, user_id, original_filename, stored_path, file_size, content_type, upload_time, processing_status, processing_task_id, error_message, encryption_key_id,
+	source_url, content_hash, last_fetched_at, recrawl_interval_minutes, next_crawl_at,
+	source_path, source_modified_at`
+
+// scanDocument 将一行 documentColumns 结果扫描为 Document 实体。
+func scanDocument(row pgx.Row) (*entity.Document, error) {
+	var doc entity.Document
+	err := row.Scan(
+		&doc.ID, &doc.UserID, &doc.OriginalFilename, &doc.StoredPath, &doc.FileSize,
+		&doc.ContentType, &doc.UploadTime, &doc.ProcessingStatus, &doc.ProcessingTaskID, &doc.ErrorMessage,
+		&doc.EncryptionKeyID,
+		&doc.SourceURL, &doc.ContentHash, &doc.LastFetchedAt, &doc.RecrawlIntervalMinutes, &doc.NextCrawlAt,
+		&doc.SourcePath, &doc.SourceModifiedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
 // postgresDocumentRepository 是 DocumentRepository 接口的 PostgreSQL 实现。
 type postgresDocumentRepository struct {
 	db *DB // 嵌入 DB 连接池
@@ -25,8 +46,10 @@ func NewPostgresDocumentRepository(db *DB) repository.DocumentRepository {
 // SaveDocument 保存一个新的文档元数据记录到 documents 表。
 func (r *postgresDocumentRepository) SaveDocument(ctx context.Context, doc *entity.Document) error {
 	const sql = `
-		INSERT INTO documents (id, user_id, original_filename, stored_path, file_size, content_type, upload_time, processing_status, processing_task_id, error_message)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO documents (id, user_id, original_filename, stored_path, file_size, content_type, upload_time, processing_status, processing_task_id, error_message, encryption_key_id,
+			source_url, content_hash, last_fetched_at, recrawl_interval_minutes, next_crawl_at,
+			source_path, source_modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 	`
 	_, err := r.db.Pool.Exec(ctx, sql,
 		doc.ID,
@@ -39,6 +62,14 @@ func (r *postgresDocumentRepository) SaveDocument(ctx context.Context, doc *enti
 		doc.ProcessingStatus,
 		doc.ProcessingTaskID,
 		doc.ErrorMessage,
+		doc.EncryptionKeyID,
+		doc.SourceURL,
+		doc.ContentHash,
+		doc.LastFetchedAt,
+		doc.RecrawlIntervalMinutes,
+		doc.NextCrawlAt,
+		doc.SourcePath,
+		doc.SourceModifiedAt,
 	)
 	if err != nil {
 		logger.ErrorContext(ctx, "保存文档元数据到数据库失败", "error", err, "doc_id", doc.ID, "filename", doc.OriginalFilename)
@@ -59,18 +90,14 @@ func (r *postgresDocumentRepository) GetDocumentByID(ctx context.Context, userID
 	// }
 
 	const sql = `
-		SELECT id, user_id, original_filename, stored_path, file_size, content_type, upload_time, processing_status, processing_task_id, error_message
+		SELECT ` + documentColumns + `
 		FROM documents
 		WHERE id = $1 AND user_id = $2
 	`
 	// Pass string docID and userID
 	row := r.db.Pool.QueryRow(ctx, sql, docID, userID)
-	var doc entity.Document
 	// Assuming entity.Document fields (ID, UserID, ProcessingTaskID) are now string or *string
-	err := row.Scan(
-		&doc.ID, &doc.UserID, &doc.OriginalFilename, &doc.StoredPath, &doc.FileSize,
-		&doc.ContentType, &doc.UploadTime, &doc.ProcessingStatus, &doc.ProcessingTaskID, &doc.ErrorMessage,
-	)
+	doc, err := scanDocument(row)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			logger.WarnContext(ctx, "未找到指定的文档", "doc_id", docID, "user_id", userID)
@@ -79,7 +106,7 @@ func (r *postgresDocumentRepository) GetDocumentByID(ctx context.Context, userID
 		logger.ErrorContext(ctx, "从数据库获取文档元数据失败", "error", err, "doc_id", docID, "user_id", userID)
 		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取文档元数据")
 	}
-	return &doc, nil
+	return doc, nil
 }
 
 // GetDocumentsByUser 获取指定用户的所有文档元数据，按上传时间降序排列。
@@ -96,7 +123,7 @@ func (r *postgresDocumentRepository) GetDocumentsByUser(ctx context.Context, use
 	// }
 
 	const sql = `
-		SELECT id, user_id, original_filename, stored_path, file_size, content_type, upload_time, processing_status, processing_task_id, error_message
+		SELECT ` + documentColumns + `
 		FROM documents
 		WHERE user_id = $1
 		ORDER BY upload_time DESC
@@ -111,16 +138,12 @@ func (r *postgresDocumentRepository) GetDocumentsByUser(ctx context.Context, use
 
 	documents := make([]*entity.Document, 0)
 	for rows.Next() {
-		var doc entity.Document
-		err := rows.Scan(
-			&doc.ID, &doc.UserID, &doc.OriginalFilename, &doc.StoredPath, &doc.FileSize,
-			&doc.ContentType, &doc.UploadTime, &doc.ProcessingStatus, &doc.ProcessingTaskID, &doc.ErrorMessage,
-		)
+		doc, err := scanDocument(rows)
 		if err != nil {
 			logger.ErrorContext(ctx, "扫描文档行失败", "error", err)
 			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
 		}
-		documents = append(documents, &doc)
+		documents = append(documents, doc)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -189,3 +212,194 @@ func (r *postgresDocumentRepository) DeleteDocument(ctx context.Context, userID
 	logger.InfoContext(ctx, "文档元数据删除成功", "doc_id", docID)
 	return nil
 }
+
+// GetUserStorageUsage 统计用户所有文档的文件大小与进行中的可恢复上传已接收的字节数之和。
+// finalizing 状态的会话正在合并为文档，其数据块不计入，避免与新文档重复计算。
+func (r *postgresDocumentRepository) GetUserStorageUsage(ctx context.Context, userID string) (int64, error) {
+	const sql = `
+		SELECT
+			(SELECT COALESCE(SUM(file_size), 0) FROM documents WHERE user_id = $1) +
+			(SELECT COALESCE(SUM(p.size), 0)
+			 FROM upload_session_parts p
+			 JOIN upload_sessions s ON s.id = p.session_id
+			 WHERE s.user_id = $1 AND s.status = 'active')
+	`
+	var usage int64
+	if err := r.db.Pool.QueryRow(ctx, sql, userID).Scan(&usage); err != nil {
+		logger.ErrorContext(ctx, "统计用户存储用量失败", "error", err, "user_id", userID)
+		return 0, apperr.Wrap(err, apperr.CodeInternal, "无法获取存储用量")
+	}
+	return usage, nil
+}
+
+// UpdateDocumentSnapshot 替换文档的存储文件，并记录内容哈希和抓取/同步时间。
+func (r *postgresDocumentRepository) UpdateDocumentSnapshot(ctx context.Context, userID string, docID string, snapshot *repository.DocumentSnapshot) error {
+	const sql = `
+		UPDATE documents
+		SET stored_path = $1, file_size = $2, content_type = $3, content_hash = $4, last_fetched_at = $5,
+			encryption_key_id = $6, error_message = '', source_modified_at = COALESCE($7, source_modified_at)
+		WHERE id = $8 AND user_id = $9
+	`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql,
+		snapshot.StoredPath, snapshot.FileSize, snapshot.ContentType, snapshot.ContentHash, snapshot.FetchedAt,
+		snapshot.EncryptionKeyID, snapshot.SourceModifiedAt, docID, userID,
+	)
+	if err != nil {
+		logger.ErrorContext(ctx, "更新文档快照失败", "error", err, "doc_id", docID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法更新文档快照")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("文档未找到或无权更新")
+	}
+	return nil
+}
+
+// MarkDocumentFetched 记录一次内容未变化的抓取。
+func (r *postgresDocumentRepository) MarkDocumentFetched(ctx context.Context, userID string, docID string, fetchedAt time.Time) error {
+	const sql = `UPDATE documents SET last_fetched_at = $1 WHERE id = $2 AND user_id = $3`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, fetchedAt, docID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "更新文档抓取时间失败", "error", err, "doc_id", docID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法更新文档抓取时间")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("文档未找到或无权更新")
+	}
+	return nil
+}
+
+// ClaimDueRecrawls 领取到期需要重新抓取的 URL 文档，并将其 next_crawl_at 推迟一个抓取间隔。
+// 使用 FOR UPDATE SKIP LOCKED，多个 Worker 实例并发调用时不会领取到同一文档。
+func (r *postgresDocumentRepository) ClaimDueRecrawls(ctx context.Context, now time.Time, limit int) ([]*entity.Document, error) {
+	const sql = `
+		UPDATE documents
+		SET next_crawl_at = $1 + make_interval(mins => recrawl_interval_minutes)
+		WHERE id IN (
+			SELECT id FROM documents
+			WHERE next_crawl_at IS NOT NULL AND next_crawl_at <= $1 AND recrawl_interval_minutes > 0
+			ORDER BY next_crawl_at ASC
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + documentColumns
+	rows, err := r.db.Pool.Query(ctx, sql, now, limit)
+	if err != nil {
+		logger.ErrorContext(ctx, "领取待重新抓取的文档失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询待重新抓取的文档")
+	}
+	defer rows.Close()
+
+	documents := make([]*entity.Document, 0)
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描文档行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理文档结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return documents, nil
+}
+
+// ListDocumentsBySourcePrefix 列出用户来源路径以 prefix 开头的文档。
+func (r *postgresDocumentRepository) ListDocumentsBySourcePrefix(ctx context.Context, userID string, prefix string) ([]*entity.Document, error) {
+	const sql = `
+		SELECT ` + documentColumns + `
+		FROM documents
+		WHERE user_id = $1 AND source_path IS NOT NULL AND starts_with(source_path, $2)
+	`
+	rows, err := r.db.Pool.Query(ctx, sql, userID, prefix)
+	if err != nil {
+		logger.ErrorContext(ctx, "按来源路径查询文档失败", "error", err, "user_id", userID, "prefix", prefix)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询同步的文档")
+	}
+	defer rows.Close()
+
+	documents := make([]*entity.Document, 0)
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描文档行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理文档结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return documents, nil
+}
+
+// UpdateSourceModifiedAt 更新同步文档记录的文件修改时间 (内容未变化时使用)。
+func (r *postgresDocumentRepository) UpdateSourceModifiedAt(ctx context.Context, userID string, docID string, modifiedAt time.Time) error {
+	const sql = `UPDATE documents SET source_modified_at = $1, last_fetched_at = NOW() WHERE id = $2 AND user_id = $3`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, modifiedAt, docID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "更新文档来源修改时间失败", "error", err, "doc_id", docID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法更新文档")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("文档未找到或无权更新")
+	}
+	return nil
+}
+
+// ListStoredFiles 列出所有带有存储文件的文档引用。
+func (r *postgresDocumentRepository) ListStoredFiles(ctx context.Context) ([]*repository.StoredFileRef, error) {
+	const sql = `SELECT id, user_id, stored_path, processing_status FROM documents WHERE stored_path <> ''`
+	rows, err := r.db.Pool.Query(ctx, sql)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询文档存储路径失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询文档存储路径")
+	}
+	defer rows.Close()
+
+	refs := make([]*repository.StoredFileRef, 0)
+	for rows.Next() {
+		var ref repository.StoredFileRef
+		if err := rows.Scan(&ref.DocumentID, &ref.UserID, &ref.StoredPath, &ref.ProcessingStatus); err != nil {
+			logger.ErrorContext(ctx, "扫描文档存储路径失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		refs = append(refs, &ref)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理文档存储路径结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return refs, nil
+}
+
+// ListStaleProcessingDocuments 列出长时间停留在 processing 状态的文档 (updated_at 由触发器维护)。
+func (r *postgresDocumentRepository) ListStaleProcessingDocuments(ctx context.Context, updatedBefore time.Time, limit int) ([]*entity.Document, error) {
+	sql := `SELECT ` + documentColumns + ` FROM documents
+		WHERE processing_status = $1 AND updated_at < $2
+		ORDER BY updated_at ASC
+		LIMIT $3`
+	rows, err := r.db.Pool.Query(ctx, sql, entity.TaskStatusProcessing, updatedBefore, limit)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询长时间处理中的文档失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询处理中的文档")
+	}
+	defer rows.Close()
+
+	documents := make([]*entity.Document, 0)
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描文档行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理文档结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return documents, nil
+}
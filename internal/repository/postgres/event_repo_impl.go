@@ -0,0 +1,406 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure postgresEventRepository implements EventRepository interface.
+var _ repository.EventRepository = (*postgresEventRepository)(nil)
+
+// eventColumns 是查询 events 表时使用的列，顺序与 scanEvent 一致。
+const eventColumns = `seq, user_id, event_id, source, event_type, subject, event_time, data_content_type, data_schema,
+	data_version, data_major, trace_id, extensions, data, created_at`
+
+// eventSubscriptionColumns 是查询 event_subscriptions 表时使用的列，顺序与 scanEventSubscription 一致。
+const eventSubscriptionColumns = `id, user_id, type_pattern, schema_version, delivery, webhook_url, secret, created_at`
+
+// eventDeliveryColumns 是查询 event_deliveries 表 (别名 d，关联 events 表 e) 时使用的列，顺序与 scanEventDelivery 一致。
+const eventDeliveryColumns = `d.id, d.user_id, d.subscription_id, d.event_seq, e.event_id, e.event_type, d.status, d.attempts,
+	d.last_status_code, d.last_error, d.created_at, d.updated_at, d.delivered_at`
+
+// postgresEventRepository 是 EventRepository 接口的 PostgreSQL 实现。
+type postgresEventRepository struct {
+	db *DB
+}
+
+// NewPostgresEventRepository 创建一个新的 postgresEventRepository 实例。
+func NewPostgresEventRepository(db *DB) repository.EventRepository {
+	return &postgresEventRepository{db: db}
+}
+
+// scanEvent 将一行 eventColumns 结果扫描为 Event。
+func scanEvent(row pgx.Row) (*entity.Event, error) {
+	var e entity.Event
+	var data []byte
+	if err := row.Scan(&e.Seq, &e.UserID, &e.ID, &e.Source, &e.Type, &e.Subject, &e.Time, &e.DataContentType, &e.DataSchema,
+		&e.DataVersion, &e.DataMajor, &e.TraceID, &e.Extensions, &data, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	e.SpecVersion = entity.CloudEventsSpecVersion
+	e.Data = data
+	if len(e.Extensions) == 0 {
+		e.Extensions = nil
+	}
+	return &e, nil
+}
+
+// scanEventSubscription 将一行 eventSubscriptionColumns 结果扫描为 EventSubscription。
+func scanEventSubscription(row pgx.Row) (*entity.EventSubscription, error) {
+	var s entity.EventSubscription
+	var delivery string
+	if err := row.Scan(&s.ID, &s.UserID, &s.TypePattern, &s.SchemaVersion, &delivery, &s.WebhookURL, &s.Secret, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	s.Delivery = entity.EventDeliveryMode(delivery)
+	return &s, nil
+}
+
+// scanEventDelivery 将一行 eventDeliveryColumns 结果扫描为 EventDelivery。
+func scanEventDelivery(row pgx.Row) (*entity.EventDelivery, error) {
+	var d entity.EventDelivery
+	var status string
+	if err := row.Scan(&d.ID, &d.UserID, &d.SubscriptionID, &d.EventSeq, &d.EventID, &d.EventType, &status, &d.Attempts,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt, &d.DeliveredAt); err != nil {
+		return nil, err
+	}
+	d.Status = entity.EventDeliveryStatus(status)
+	return &d, nil
+}
+
+// eventTypeLikePattern 将订阅的类型模式转换为 LIKE 模式，事件类型中的 % 和 _ 按字面匹配。
+func eventTypeLikePattern(pattern string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return escape.Replace(prefix) + "%"
+	}
+	return escape.Replace(pattern)
+}
+
+// CreateEvent 保存事件。source 和 id 相同的事件已存在时返回已有的事件。
+// 插入前锁定用户在 event_sequences 中的行直到事务提交，同一用户的事件因此按 seq 顺序提交：
+// 读取者按 seq > after 翻页或推送时，不会因为较小的 seq 较晚提交而漏掉事件。
+func (r *postgresEventRepository) CreateEvent(ctx context.Context, event *entity.Event) (bool, error) {
+	extensions := event.Extensions
+	if extensions == nil {
+		extensions = map[string]any{}
+	}
+	var data []byte // nil 保存为 NULL
+	if len(event.Data) > 0 {
+		data = event.Data
+	}
+	sql := `
+		INSERT INTO events (user_id, event_id, source, event_type, subject, event_time, data_content_type, data_schema,
+			data_version, data_major, trace_id, extensions, data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (user_id, source, event_id) DO NOTHING
+		RETURNING seq, created_at`
+	err := r.db.ExecuteInTx(ctx, func(tx pgx.Tx) error {
+		lockSQL := `
+			INSERT INTO event_sequences (user_id) VALUES ($1)
+			ON CONFLICT (user_id) DO UPDATE SET last_seq = event_sequences.last_seq`
+		if _, err := tx.Exec(ctx, lockSQL, event.UserID); err != nil {
+			return err
+		}
+		err := tx.QueryRow(ctx, sql,
+			event.UserID, event.ID, event.Source, event.Type, event.Subject, event.Time, event.DataContentType, event.DataSchema,
+			event.DataVersion, event.DataMajor, event.TraceID, extensions, data,
+		).Scan(&event.Seq, &event.CreatedAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE event_sequences SET last_seq = $2 WHERE user_id = $1`, event.UserID, event.Seq)
+		return err
+	})
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		logger.ErrorContext(ctx, "保存事件失败", "error", err, "user_id", event.UserID, "type", event.Type, "source", event.Source, "id", event.ID)
+		return false, apperr.Wrap(err, apperr.CodeInternal, "无法保存事件")
+	}
+
+	// 事件已经发布过
+	existing, err := scanEvent(r.db.Pool.QueryRow(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE user_id = $1 AND source = $2 AND event_id = $3`,
+		event.UserID, event.Source, event.ID))
+	if err != nil {
+		logger.ErrorContext(ctx, "获取已发布的事件失败", "error", err, "user_id", event.UserID, "source", event.Source, "id", event.ID)
+		return false, apperr.Wrap(err, apperr.CodeInternal, "无法保存事件")
+	}
+	*event = *existing
+	return false, nil
+}
+
+// GetEvent 按 seq 获取事件。
+func (r *postgresEventRepository) GetEvent(ctx context.Context, userID string, seq int64) (*entity.Event, error) {
+	event, err := scanEvent(r.db.Pool.QueryRow(ctx, `SELECT `+eventColumns+` FROM events WHERE seq = $1 AND user_id = $2`, seq, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("事件未找到")
+		}
+		logger.ErrorContext(ctx, "获取事件失败", "error", err, "seq", seq, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取事件")
+	}
+	return event, nil
+}
+
+// ListEvents 按 seq 升序列出事件。
+func (r *postgresEventRepository) ListEvents(ctx context.Context, userID string, filter *entity.EventFilter) ([]*entity.Event, error) {
+	if filter == nil {
+		filter = &entity.EventFilter{}
+	}
+	conditions := []string{"user_id = $1", "seq > $2"}
+	args := []any{userID, filter.After}
+	if len(filter.TypePatterns) > 0 {
+		patterns := make([]string, 0, len(filter.TypePatterns))
+		for _, p := range filter.TypePatterns {
+			patterns = append(patterns, eventTypeLikePattern(p))
+		}
+		args = append(args, patterns)
+		conditions = append(conditions, fmt.Sprintf("event_type LIKE ANY($%d::text[])", len(args)))
+	}
+	if filter.SchemaVersion != nil {
+		args = append(args, *filter.SchemaVersion)
+		conditions = append(conditions, fmt.Sprintf("data_major = $%d", len(args)))
+	}
+	args = append(args, filter.Limit)
+	sql := fmt.Sprintf(`SELECT %s FROM events WHERE %s ORDER BY seq LIMIT $%d`, eventColumns, strings.Join(conditions, " AND "), len(args))
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取事件列表失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取事件列表")
+	}
+	defer rows.Close()
+
+	events := make([]*entity.Event, 0)
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描事件数据失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理事件数据时出错")
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (事件列表)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return events, nil
+}
+
+// LatestEventSeq 返回用户最新事件的 seq。
+func (r *postgresEventRepository) LatestEventSeq(ctx context.Context, userID string) (int64, error) {
+	var seq int64
+	if err := r.db.Pool.QueryRow(ctx, `SELECT COALESCE(MAX(seq), 0) FROM events WHERE user_id = $1`, userID).Scan(&seq); err != nil {
+		logger.ErrorContext(ctx, "获取最新事件序号失败", "error", err, "user_id", userID)
+		return 0, apperr.Wrap(err, apperr.CodeInternal, "无法获取事件列表")
+	}
+	return seq, nil
+}
+
+// CreateSubscription 保存订阅。
+func (r *postgresEventRepository) CreateSubscription(ctx context.Context, subscription *entity.EventSubscription) error {
+	sql := `
+		INSERT INTO event_subscriptions (user_id, type_pattern, schema_version, delivery, webhook_url, secret)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + eventSubscriptionColumns
+	created, err := scanEventSubscription(r.db.Pool.QueryRow(ctx, sql,
+		subscription.UserID, subscription.TypePattern, subscription.SchemaVersion, string(subscription.Delivery), subscription.WebhookURL, subscription.Secret))
+	if err != nil {
+		logger.ErrorContext(ctx, "保存事件订阅失败", "error", err, "user_id", subscription.UserID, "type", subscription.TypePattern)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法保存事件订阅")
+	}
+	*subscription = *created
+	return nil
+}
+
+// GetSubscription 获取订阅。
+func (r *postgresEventRepository) GetSubscription(ctx context.Context, userID string, subscriptionID string) (*entity.EventSubscription, error) {
+	if _, err := uuid.Parse(subscriptionID); err != nil {
+		return nil, apperr.ErrNotFound("事件订阅未找到") // 无效的 ID 不可能存在
+	}
+	sql := `SELECT ` + eventSubscriptionColumns + ` FROM event_subscriptions WHERE id = $1 AND user_id = $2`
+	subscription, err := scanEventSubscription(r.db.Pool.QueryRow(ctx, sql, subscriptionID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("事件订阅未找到")
+		}
+		logger.ErrorContext(ctx, "获取事件订阅失败", "error", err, "subscription_id", subscriptionID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取事件订阅")
+	}
+	return subscription, nil
+}
+
+// ListSubscriptions 按创建时间列出用户的订阅。
+func (r *postgresEventRepository) ListSubscriptions(ctx context.Context, userID string) ([]*entity.EventSubscription, error) {
+	sql := `SELECT ` + eventSubscriptionColumns + ` FROM event_subscriptions WHERE user_id = $1 ORDER BY created_at, id`
+	rows, err := r.db.Pool.Query(ctx, sql, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取事件订阅列表失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取事件订阅列表")
+	}
+	defer rows.Close()
+
+	subscriptions := make([]*entity.EventSubscription, 0)
+	for rows.Next() {
+		subscription, err := scanEventSubscription(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描事件订阅数据失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理事件订阅数据时出错")
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (事件订阅列表)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return subscriptions, nil
+}
+
+// DeleteSubscription 删除订阅，投递记录由外键级联删除。
+func (r *postgresEventRepository) DeleteSubscription(ctx context.Context, userID string, subscriptionID string) error {
+	if _, err := uuid.Parse(subscriptionID); err != nil {
+		return apperr.ErrNotFound("事件订阅未找到")
+	}
+	cmdTag, err := r.db.Pool.Exec(ctx, `DELETE FROM event_subscriptions WHERE id = $1 AND user_id = $2`, subscriptionID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除事件订阅失败", "error", err, "subscription_id", subscriptionID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除事件订阅")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("事件订阅未找到")
+	}
+	logger.InfoContext(ctx, "事件订阅已删除", "subscription_id", subscriptionID, "user_id", userID)
+	return nil
+}
+
+// CreateDeliveries 为每个订阅创建投递记录，已存在的记录不重复创建。
+func (r *postgresEventRepository) CreateDeliveries(ctx context.Context, event *entity.Event, subscriptionIDs []string) ([]*entity.EventDelivery, error) {
+	deliveries := make([]*entity.EventDelivery, 0, len(subscriptionIDs))
+	if len(subscriptionIDs) == 0 {
+		return deliveries, nil
+	}
+	sql := `
+		INSERT INTO event_deliveries (user_id, subscription_id, event_seq)
+		SELECT $1::uuid, subscription_id, $3::bigint FROM unnest($2::uuid[]) AS subscription_id
+		ON CONFLICT (subscription_id, event_seq) DO NOTHING
+		RETURNING id, subscription_id, status, attempts, created_at, updated_at`
+	rows, err := r.db.Pool.Query(ctx, sql, event.UserID, subscriptionIDs, event.Seq)
+	if err != nil {
+		logger.ErrorContext(ctx, "创建事件投递记录失败", "error", err, "user_id", event.UserID, "seq", event.Seq)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法创建事件投递记录")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := &entity.EventDelivery{UserID: event.UserID, EventSeq: event.Seq, EventID: event.ID, EventType: event.Type}
+		var status string
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &status, &d.Attempts, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			logger.ErrorContext(ctx, "扫描事件投递记录失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理事件投递数据时出错")
+		}
+		d.Status = entity.EventDeliveryStatus(status)
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (事件投递记录)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return deliveries, nil
+}
+
+// GetDelivery 获取投递记录。
+func (r *postgresEventRepository) GetDelivery(ctx context.Context, userID string, deliveryID string) (*entity.EventDelivery, error) {
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		return nil, apperr.ErrNotFound("事件投递记录未找到")
+	}
+	sql := `SELECT ` + eventDeliveryColumns + ` FROM event_deliveries d JOIN events e ON e.seq = d.event_seq WHERE d.id = $1 AND d.user_id = $2`
+	delivery, err := scanEventDelivery(r.db.Pool.QueryRow(ctx, sql, deliveryID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("事件投递记录未找到")
+		}
+		logger.ErrorContext(ctx, "获取事件投递记录失败", "error", err, "delivery_id", deliveryID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取事件投递记录")
+	}
+	return delivery, nil
+}
+
+// ListDeliveries 按创建时间倒序列出订阅的投递记录。
+func (r *postgresEventRepository) ListDeliveries(ctx context.Context, userID string, subscriptionID string, limit int, offset int) ([]*entity.EventDelivery, int, error) {
+	var total int
+	if err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM event_deliveries WHERE subscription_id = $1 AND user_id = $2`,
+		subscriptionID, userID).Scan(&total); err != nil {
+		logger.ErrorContext(ctx, "统计事件投递记录失败", "error", err, "subscription_id", subscriptionID, "user_id", userID)
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "无法获取事件投递记录")
+	}
+
+	sql := `
+		SELECT ` + eventDeliveryColumns + `
+		FROM event_deliveries d JOIN events e ON e.seq = d.event_seq
+		WHERE d.subscription_id = $1 AND d.user_id = $2
+		ORDER BY d.created_at DESC, d.id
+		LIMIT $3 OFFSET $4`
+	rows, err := r.db.Pool.Query(ctx, sql, subscriptionID, userID, limit, offset)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取事件投递记录失败", "error", err, "subscription_id", subscriptionID, "user_id", userID)
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "无法获取事件投递记录")
+	}
+	defer rows.Close()
+
+	deliveries := make([]*entity.EventDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanEventDelivery(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描事件投递记录失败", "error", err)
+			return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "处理事件投递数据时出错")
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (事件投递记录)", "error", err)
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return deliveries, total, nil
+}
+
+// RecordDeliveryAttempt 记录一次投递尝试，成功时记录投递时间。
+func (r *postgresEventRepository) RecordDeliveryAttempt(ctx context.Context, deliveryID string, status entity.EventDeliveryStatus, statusCode *int, errMsg string) error {
+	sql := `
+		UPDATE event_deliveries
+		SET attempts = attempts + 1, status = $2::varchar, last_status_code = $3, last_error = $4, updated_at = NOW(),
+			delivered_at = CASE WHEN $2::varchar = 'succeeded' THEN NOW() ELSE delivered_at END
+		WHERE id = $1`
+	if _, err := r.db.Pool.Exec(ctx, sql, deliveryID, string(status), statusCode, errMsg); err != nil {
+		logger.ErrorContext(ctx, "记录事件投递结果失败", "error", err, "delivery_id", deliveryID, "status", status)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法记录事件投递结果")
+	}
+	return nil
+}
+
+// ResetDelivery 将投递记录恢复为 pending，保留已尝试的次数。
+func (r *postgresEventRepository) ResetDelivery(ctx context.Context, userID string, deliveryID string) (*entity.EventDelivery, error) {
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		return nil, apperr.ErrNotFound("事件投递记录未找到")
+	}
+	cmdTag, err := r.db.Pool.Exec(ctx,
+		`UPDATE event_deliveries SET status = 'pending', updated_at = NOW() WHERE id = $1 AND user_id = $2`, deliveryID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "重置事件投递记录失败", "error", err, "delivery_id", deliveryID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法重新投递事件")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return nil, apperr.ErrNotFound("事件投递记录未找到")
+	}
+	return r.GetDelivery(ctx, userID, deliveryID)
+}
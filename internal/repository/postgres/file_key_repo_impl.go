@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure postgresFileKeyRepository implements FileKeyRepository interface.
+var _ repository.FileKeyRepository = (*postgresFileKeyRepository)(nil)
+
+// postgresFileKeyRepository 是 FileKeyRepository 接口的 PostgreSQL 实现。
+type postgresFileKeyRepository struct {
+	db *DB
+}
+
+// NewPostgresFileKeyRepository 创建一个新的 postgresFileKeyRepository 实例。
+func NewPostgresFileKeyRepository(db *DB) repository.FileKeyRepository {
+	return &postgresFileKeyRepository{db: db}
+}
+
+// SaveFileKey 保存一个新文件的已包装数据密钥。
+func (r *postgresFileKeyRepository) SaveFileKey(ctx context.Context, key *entity.FileDataKey) error {
+	const sql = `
+		INSERT INTO file_encryption_keys (stored_path, key_id, wrapped_key, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING created_at, updated_at
+	`
+	err := r.db.Pool.QueryRow(ctx, sql, key.StoredPath, key.KeyID, key.WrappedKey).Scan(&key.CreatedAt, &key.UpdatedAt)
+	if err != nil {
+		logger.ErrorContext(ctx, "保存文件数据密钥失败", "error", err, "stored_path", key.StoredPath, "key_id", key.KeyID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法保存文件数据密钥")
+	}
+	return nil
+}
+
+// GetFileKey 根据存储路径获取数据密钥。
+func (r *postgresFileKeyRepository) GetFileKey(ctx context.Context, storedPath string) (*entity.FileDataKey, error) {
+	const sql = `
+		SELECT stored_path, key_id, wrapped_key, created_at, updated_at
+		FROM file_encryption_keys
+		WHERE stored_path = $1
+	`
+	var key entity.FileDataKey
+	err := r.db.Pool.QueryRow(ctx, sql, storedPath).Scan(&key.StoredPath, &key.KeyID, &key.WrappedKey, &key.CreatedAt, &key.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("文件数据密钥未找到")
+		}
+		logger.ErrorContext(ctx, "获取文件数据密钥失败", "error", err, "stored_path", storedPath)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取文件数据密钥")
+	}
+	return &key, nil
+}
+
+// DeleteFileKey 删除指定存储路径的数据密钥。
+func (r *postgresFileKeyRepository) DeleteFileKey(ctx context.Context, storedPath string) error {
+	const sql = `DELETE FROM file_encryption_keys WHERE stored_path = $1`
+	if _, err := r.db.Pool.Exec(ctx, sql, storedPath); err != nil {
+		logger.ErrorContext(ctx, "删除文件数据密钥失败", "error", err, "stored_path", storedPath)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除文件数据密钥")
+	}
+	return nil
+}
+
+// ListKeysNotWrappedBy 按存储路径 (主键) 分页列出不是由指定主密钥包装的数据密钥。
+func (r *postgresFileKeyRepository) ListKeysNotWrappedBy(ctx context.Context, keyID string, afterPath string, limit int) ([]*entity.FileDataKey, error) {
+	const sql = `
+		SELECT stored_path, key_id, wrapped_key, created_at, updated_at
+		FROM file_encryption_keys
+		WHERE key_id <> $1 AND stored_path > $2
+		ORDER BY stored_path ASC
+		LIMIT $3
+	`
+	rows, err := r.db.Pool.Query(ctx, sql, keyID, afterPath, limit)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询待轮换的文件数据密钥失败", "error", err, "key_id", keyID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询文件数据密钥")
+	}
+	defer rows.Close()
+
+	keys := make([]*entity.FileDataKey, 0)
+	for rows.Next() {
+		var key entity.FileDataKey
+		if err := rows.Scan(&key.StoredPath, &key.KeyID, &key.WrappedKey, &key.CreatedAt, &key.UpdatedAt); err != nil {
+			logger.ErrorContext(ctx, "扫描文件数据密钥行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		keys = append(keys, &key)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理文件数据密钥结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return keys, nil
+}
+
+// RewrapKey 在同一事务中更新数据密钥和关联文档的 encryption_key_id。
+func (r *postgresFileKeyRepository) RewrapKey(ctx context.Context, storedPath string, oldKeyID string, newKeyID string, wrappedKey []byte) error {
+	return r.db.ExecuteInTx(ctx, func(tx pgx.Tx) error {
+		const updateKeySQL = `
+			UPDATE file_encryption_keys
+			SET key_id = $1, wrapped_key = $2, updated_at = NOW()
+			WHERE stored_path = $3 AND key_id = $4
+		`
+		cmdTag, err := tx.Exec(ctx, updateKeySQL, newKeyID, wrappedKey, storedPath, oldKeyID)
+		if err != nil {
+			logger.ErrorContext(ctx, "更新文件数据密钥失败", "error", err, "stored_path", storedPath)
+			return apperr.Wrap(err, apperr.CodeInternal, "无法更新文件数据密钥")
+		}
+		if cmdTag.RowsAffected() == 0 {
+			return apperr.New(apperr.CodeConflict, "文件数据密钥已被修改或删除")
+		}
+
+		const updateDocSQL = `UPDATE documents SET encryption_key_id = $1 WHERE stored_path = $2`
+		if _, err := tx.Exec(ctx, updateDocSQL, newKeyID, storedPath); err != nil {
+			logger.ErrorContext(ctx, "更新文档加密密钥 ID 失败", "error", err, "stored_path", storedPath)
+			return apperr.Wrap(err, apperr.CodeInternal, "无法更新文档加密密钥 ID")
+		}
+		return nil
+	})
+}
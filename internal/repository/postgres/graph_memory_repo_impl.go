@@ -0,0 +1,443 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure postgresGraphMemoryRepository implements GraphMemoryRepository interface.
+var _ repository.GraphMemoryRepository = (*postgresGraphMemoryRepository)(nil)
+
+// graphNodeColumns 是查询 graph_nodes 表时使用的列，顺序与 scanGraphNode 一致。
+const graphNodeColumns = `id, user_id, node_type, label, properties, ref_type, ref_id, created_at`
+
+// graphEdgeColumns 是查询 graph_edges 表时使用的列，顺序与 scanGraphEdge 一致。
+const graphEdgeColumns = `id, user_id, source_node_id, target_node_id, edge_type, properties, created_at`
+
+// postgresGraphMemoryRepository 是 GraphMemoryRepository 接口的 PostgreSQL 实现。
+type postgresGraphMemoryRepository struct {
+	db *DB
+}
+
+// NewPostgresGraphMemoryRepository 创建一个新的 postgresGraphMemoryRepository 实例。
+func NewPostgresGraphMemoryRepository(db *DB) repository.GraphMemoryRepository {
+	return &postgresGraphMemoryRepository{db: db}
+}
+
+// scanGraphNode 将一行 graphNodeColumns 结果扫描为 GraphNode。extra 为 graphNodeColumns 之后的其他列。
+func scanGraphNode(row pgx.Row, extra ...any) (*entity.GraphNode, error) {
+	var n entity.GraphNode
+	var nodeType string
+	dest := append([]any{&n.ID, &n.UserID, &nodeType, &n.Label, &n.Properties, &n.RefType, &n.RefID, &n.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	n.Type = entity.GraphNodeType(nodeType)
+	return &n, nil
+}
+
+// scanGraphEdge 将一行 graphEdgeColumns 结果扫描为 GraphEdge。
+func scanGraphEdge(row pgx.Row) (*entity.GraphEdge, error) {
+	var e entity.GraphEdge
+	var edgeType string
+	if err := row.Scan(&e.ID, &e.UserID, &e.SourceID, &e.TargetID, &edgeType, &e.Properties, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	e.Type = entity.GraphEdgeType(edgeType)
+	return &e, nil
+}
+
+// graphProperties 返回要保存的属性，nil 保存为空对象。
+func graphProperties(properties map[string]any) map[string]any {
+	if properties == nil {
+		return map[string]any{}
+	}
+	return properties
+}
+
+// CreateNode 保存节点。带引用的节点已存在时更新标签并合并属性。
+func (r *postgresGraphMemoryRepository) CreateNode(ctx context.Context, node *entity.GraphNode) error {
+	sql := `
+		INSERT INTO graph_nodes (user_id, node_type, label, properties, ref_type, ref_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, ref_type, ref_id) WHERE ref_id <> ''
+		DO UPDATE SET label = EXCLUDED.label, properties = graph_nodes.properties || EXCLUDED.properties
+		RETURNING ` + graphNodeColumns
+	created, err := scanGraphNode(r.db.Pool.QueryRow(ctx, sql,
+		node.UserID, string(node.Type), node.Label, graphProperties(node.Properties), node.RefType, node.RefID))
+	if err != nil {
+		logger.ErrorContext(ctx, "保存图记忆节点失败", "error", err, "user_id", node.UserID, "ref_type", node.RefType, "ref_id", node.RefID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法保存图记忆节点")
+	}
+	*node = *created
+	return nil
+}
+
+// GetNode 获取指定用户的节点。
+func (r *postgresGraphMemoryRepository) GetNode(ctx context.Context, userID string, nodeID string) (*entity.GraphNode, error) {
+	if _, err := uuid.Parse(nodeID); err != nil {
+		return nil, apperr.ErrNotFound("图记忆节点未找到") // 无效的 ID 不可能存在
+	}
+	sql := `SELECT ` + graphNodeColumns + ` FROM graph_nodes WHERE id = $1 AND user_id = $2`
+	node, err := scanGraphNode(r.db.Pool.QueryRow(ctx, sql, nodeID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("图记忆节点未找到")
+		}
+		logger.ErrorContext(ctx, "获取图记忆节点失败", "error", err, "node_id", nodeID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取图记忆节点")
+	}
+	return node, nil
+}
+
+// GetNodeByRef 获取记录了指定对象的节点。
+func (r *postgresGraphMemoryRepository) GetNodeByRef(ctx context.Context, userID string, refType string, refID string) (*entity.GraphNode, error) {
+	sql := `SELECT ` + graphNodeColumns + ` FROM graph_nodes WHERE user_id = $1 AND ref_type = $2 AND ref_id = $3 AND ref_id <> ''`
+	node, err := scanGraphNode(r.db.Pool.QueryRow(ctx, sql, userID, refType, refID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("图记忆节点未找到")
+		}
+		logger.ErrorContext(ctx, "按引用获取图记忆节点失败", "error", err, "ref_type", refType, "ref_id", refID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取图记忆节点")
+	}
+	return node, nil
+}
+
+// ListNodes 按创建时间倒序列出用户的节点。
+func (r *postgresGraphMemoryRepository) ListNodes(ctx context.Context, userID string, filter *entity.GraphNodeFilter) ([]*entity.GraphNode, int, error) {
+	if filter == nil {
+		filter = &entity.GraphNodeFilter{}
+	}
+	conditions := []string{"user_id = $1"}
+	args := []any{userID}
+	if filter.Type != "" {
+		args = append(args, string(filter.Type))
+		conditions = append(conditions, fmt.Sprintf("node_type = $%d", len(args)))
+	}
+	if filter.RefType != "" {
+		args = append(args, filter.RefType)
+		conditions = append(conditions, fmt.Sprintf("ref_type = $%d", len(args)))
+	}
+	if filter.RefID != "" {
+		args = append(args, filter.RefID)
+		conditions = append(conditions, fmt.Sprintf("ref_id = $%d", len(args)))
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	if err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM graph_nodes WHERE `+where, args...).Scan(&total); err != nil {
+		logger.ErrorContext(ctx, "统计图记忆节点失败", "error", err, "user_id", userID)
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "无法获取图记忆节点列表")
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	sql := fmt.Sprintf(`SELECT %s FROM graph_nodes WHERE %s ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d`,
+		graphNodeColumns, where, len(args)-1, len(args))
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取图记忆节点列表失败", "error", err, "user_id", userID)
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "无法获取图记忆节点列表")
+	}
+	defer rows.Close()
+
+	nodes := make([]*entity.GraphNode, 0)
+	for rows.Next() {
+		node, err := scanGraphNode(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描图记忆节点数据失败", "error", err)
+			return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "处理图记忆节点数据时出错")
+		}
+		nodes = append(nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (图记忆节点列表)", "error", err)
+		return nil, 0, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return nodes, total, nil
+}
+
+// DeleteNode 删除节点，与其相连的边由外键级联删除。
+func (r *postgresGraphMemoryRepository) DeleteNode(ctx context.Context, userID string, nodeID string) error {
+	if _, err := uuid.Parse(nodeID); err != nil {
+		return apperr.ErrNotFound("图记忆节点未找到")
+	}
+	cmdTag, err := r.db.Pool.Exec(ctx, `DELETE FROM graph_nodes WHERE id = $1 AND user_id = $2`, nodeID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除图记忆节点失败", "error", err, "node_id", nodeID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除图记忆节点")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("图记忆节点未找到")
+	}
+	logger.InfoContext(ctx, "图记忆节点已删除", "node_id", nodeID, "user_id", userID)
+	return nil
+}
+
+// CreateEdge 保存边。两个节点都必须属于该用户；已有同类型的边时合并属性。
+func (r *postgresGraphMemoryRepository) CreateEdge(ctx context.Context, edge *entity.GraphEdge) error {
+	for _, id := range []string{edge.SourceID, edge.TargetID} {
+		if _, err := uuid.Parse(id); err != nil {
+			return apperr.ErrNotFound("图记忆节点未找到").WithDetails("node_id=" + id)
+		}
+	}
+	sql := `
+		INSERT INTO graph_edges (user_id, source_node_id, target_node_id, edge_type, properties)
+		SELECT $1::uuid, $2::uuid, $3::uuid, $4::varchar, $5::jsonb
+		WHERE EXISTS (SELECT 1 FROM graph_nodes WHERE id = $2 AND user_id = $1)
+		  AND EXISTS (SELECT 1 FROM graph_nodes WHERE id = $3 AND user_id = $1)
+		ON CONFLICT (source_node_id, target_node_id, edge_type)
+		DO UPDATE SET properties = graph_edges.properties || EXCLUDED.properties
+		RETURNING ` + graphEdgeColumns
+	created, err := scanGraphEdge(r.db.Pool.QueryRow(ctx, sql,
+		edge.UserID, edge.SourceID, edge.TargetID, string(edge.Type), graphProperties(edge.Properties)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperr.ErrNotFound("图记忆节点未找到").WithDetails("source_id="+edge.SourceID, "target_id="+edge.TargetID)
+		}
+		logger.ErrorContext(ctx, "保存图记忆边失败", "error", err, "user_id", edge.UserID, "source_id", edge.SourceID, "target_id", edge.TargetID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法保存图记忆边")
+	}
+	*edge = *created
+	return nil
+}
+
+// ListNodeEdges 列出以节点为起点或终点的所有边。
+func (r *postgresGraphMemoryRepository) ListNodeEdges(ctx context.Context, userID string, nodeID string) ([]*entity.GraphEdge, error) {
+	if _, err := r.GetNode(ctx, userID, nodeID); err != nil {
+		return nil, err
+	}
+	sql := `
+		SELECT ` + graphEdgeColumns + `
+		FROM graph_edges
+		WHERE user_id = $1 AND (source_node_id = $2 OR target_node_id = $2)
+		ORDER BY created_at, id`
+	rows, err := r.db.Pool.Query(ctx, sql, userID, nodeID)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取图记忆边失败", "error", err, "node_id", nodeID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取图记忆边")
+	}
+	defer rows.Close()
+
+	edges := make([]*entity.GraphEdge, 0)
+	for rows.Next() {
+		edge, err := scanGraphEdge(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描图记忆边数据失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理图记忆边数据时出错")
+		}
+		edges = append(edges, edge)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (图记忆边)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return edges, nil
+}
+
+// DeleteEdge 删除边。
+func (r *postgresGraphMemoryRepository) DeleteEdge(ctx context.Context, userID string, edgeID string) error {
+	if _, err := uuid.Parse(edgeID); err != nil {
+		return apperr.ErrNotFound("图记忆边未找到")
+	}
+	cmdTag, err := r.db.Pool.Exec(ctx, `DELETE FROM graph_edges WHERE id = $1 AND user_id = $2`, edgeID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除图记忆边失败", "error", err, "edge_id", edgeID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除图记忆边")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("图记忆边未找到")
+	}
+	return nil
+}
+
+// Traverse 使用递归 CTE 按层 (广度优先) 遍历图。UNION 去掉重复的 (节点, 距离)，
+// 因此每层最多处理每个节点一次，不会枚举经过同一节点的所有路径；每个节点取最短距离。
+func (r *postgresGraphMemoryRepository) Traverse(ctx context.Context, userID string, nodeID string, direction entity.GraphDirection, maxDepth int, edgeTypes []entity.GraphEdgeType) ([]*entity.GraphTraversalNode, error) {
+	if _, err := r.GetNode(ctx, userID, nodeID); err != nil {
+		return nil, err
+	}
+	from, to := "source_node_id", "target_node_id" // 后代: 沿边的方向
+	if direction == entity.GraphAncestors {
+		from, to = to, from
+	}
+	var types []string // nil 表示不限制边的类型
+	for _, t := range edgeTypes {
+		types = append(types, string(t))
+	}
+	sql := fmt.Sprintf(`
+		WITH RECURSIVE walk (node_id, depth) AS (
+			SELECT $2::uuid, 0
+			UNION
+			SELECT e.%[2]s, w.depth + 1
+			FROM walk w
+			JOIN graph_edges e ON e.%[1]s = w.node_id
+			WHERE e.user_id = $1 AND w.depth < $3
+			  AND ($4::text[] IS NULL OR e.edge_type = ANY($4::text[]))
+		)
+		SELECT %[3]s, d.depth
+		FROM graph_nodes
+		JOIN (SELECT node_id, MIN(depth) AS depth FROM walk WHERE node_id <> $2::uuid GROUP BY node_id) d ON d.node_id = graph_nodes.id
+		ORDER BY d.depth, created_at, id
+		LIMIT $5`, from, to, graphNodeColumns)
+	rows, err := r.db.Pool.Query(ctx, sql, userID, nodeID, maxDepth, types, entity.MaxGraphTraversalNodes)
+	if err != nil {
+		logger.ErrorContext(ctx, "遍历图记忆失败", "error", err, "node_id", nodeID, "direction", direction, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询图记忆")
+	}
+	defer rows.Close()
+
+	nodes := make([]*entity.GraphTraversalNode, 0)
+	for rows.Next() {
+		var depth int
+		node, err := scanGraphNode(rows, &depth)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描图记忆节点数据失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理图记忆节点数据时出错")
+		}
+		nodes = append(nodes, &entity.GraphTraversalNode{GraphNode: node, Depth: depth})
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (图记忆遍历)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return nodes, nil
+}
+
+// graphPathEdge 是查找路径时加载的一条边。
+type graphPathEdge struct {
+	id, target string
+}
+
+// FindPaths 在 Go 中按长度 (广度优先) 扩展从起点出发的无环路径。
+// 先用递归 CTE 求出能在 maxDepth 步内到达终点的节点及其到终点的最短距离，只沿这些节点扩展，
+// 并且剩余步数不足以到达终点的路径不再扩展；扩展的部分路径总数不超过 entity.MaxGraphPathExpansions。
+func (r *postgresGraphMemoryRepository) FindPaths(ctx context.Context, userID string, fromID string, toID string, maxDepth int, limit int) ([]*entity.GraphPath, error) {
+	from, err := r.GetNode(ctx, userID, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.GetNode(ctx, userID, toID)
+	if err != nil {
+		return nil, err
+	}
+	fromID, toID = from.ID, to.ID // 与查询结果中的 ID 格式一致
+	distances, adjacency, err := r.loadPathSubgraph(ctx, userID, toID, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := distances[fromID]; !ok || d > maxDepth {
+		return []*entity.GraphPath{}, nil
+	}
+
+	paths := make([]*entity.GraphPath, 0)
+	frontier := []*entity.GraphPath{{NodeIDs: []string{fromID}, EdgeIDs: []string{}}}
+	expansions := 0
+	for len(frontier) > 0 && len(paths) < limit {
+		next := make([]*entity.GraphPath, 0)
+		for _, path := range frontier {
+			last := path.NodeIDs[len(path.NodeIDs)-1]
+			for _, edge := range adjacency[last] {
+				d, ok := distances[edge.target]
+				if !ok || len(path.EdgeIDs)+1+d > maxDepth || slices.Contains(path.NodeIDs, edge.target) {
+					continue
+				}
+				if expansions == entity.MaxGraphPathExpansions {
+					logger.WarnContext(ctx, "图记忆路径过多，只返回已找到的路径", "from_id", fromID, "to_id", toID, "user_id", userID, "paths", len(paths))
+					return paths, nil
+				}
+				expansions++
+				extended := &entity.GraphPath{
+					NodeIDs: append(slices.Clone(path.NodeIDs), edge.target),
+					EdgeIDs: append(slices.Clone(path.EdgeIDs), edge.id),
+				}
+				if edge.target == toID {
+					paths = append(paths, extended) // 到达终点的路径不再延伸
+					if len(paths) == limit {
+						return paths, nil
+					}
+					continue
+				}
+				next = append(next, extended)
+			}
+		}
+		frontier = next
+	}
+	return paths, nil
+}
+
+// loadPathSubgraph 返回能在 maxDepth 步内沿边的方向到达 toID 的节点及其到 toID 的最短距离，
+// 以及这些节点之间的边 (按起点分组，按创建时间排列)。
+func (r *postgresGraphMemoryRepository) loadPathSubgraph(ctx context.Context, userID string, toID string, maxDepth int) (map[string]int, map[string][]graphPathEdge, error) {
+	sql := `
+		WITH RECURSIVE back (node_id, depth) AS (
+			SELECT $2::uuid, 0
+			UNION
+			SELECT e.source_node_id, b.depth + 1
+			FROM back b
+			JOIN graph_edges e ON e.target_node_id = b.node_id
+			WHERE e.user_id = $1 AND b.depth < $3
+		)
+		SELECT node_id::text, MIN(depth) FROM back GROUP BY node_id`
+	rows, err := r.db.Pool.Query(ctx, sql, userID, toID, maxDepth)
+	if err != nil {
+		logger.ErrorContext(ctx, "查找图记忆路径失败", "error", err, "to_id", toID, "user_id", userID)
+		return nil, nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询图记忆")
+	}
+	distances := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var depth int
+		if err := rows.Scan(&id, &depth); err != nil {
+			rows.Close()
+			logger.ErrorContext(ctx, "扫描图记忆路径数据失败", "error", err)
+			return nil, nil, apperr.Wrap(err, apperr.CodeInternal, "处理图记忆路径数据时出错")
+		}
+		distances[id] = depth
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (图记忆路径)", "error", err)
+		return nil, nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+
+	nodeIDs := make([]string, 0, len(distances))
+	for id := range distances {
+		nodeIDs = append(nodeIDs, id)
+	}
+	sql = `
+		SELECT id::text, source_node_id::text, target_node_id::text
+		FROM graph_edges
+		WHERE user_id = $1 AND source_node_id = ANY($2::uuid[]) AND target_node_id = ANY($2::uuid[])
+		ORDER BY created_at, id`
+	rows, err = r.db.Pool.Query(ctx, sql, userID, nodeIDs)
+	if err != nil {
+		logger.ErrorContext(ctx, "查找图记忆路径失败", "error", err, "to_id", toID, "user_id", userID)
+		return nil, nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询图记忆")
+	}
+	defer rows.Close()
+	adjacency := make(map[string][]graphPathEdge)
+	for rows.Next() {
+		var id, source, target string
+		if err := rows.Scan(&id, &source, &target); err != nil {
+			logger.ErrorContext(ctx, "扫描图记忆路径数据失败", "error", err)
+			return nil, nil, apperr.Wrap(err, apperr.CodeInternal, "处理图记忆路径数据时出错")
+		}
+		adjacency[source] = append(adjacency[source], graphPathEdge{id: id, target: target})
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (图记忆路径)", "error", err)
+		return nil, nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return distances, adjacency, nil
+}
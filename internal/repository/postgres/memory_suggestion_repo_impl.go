@@ -0,0 +1,192 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure postgresMemorySuggestionRepository implements MemorySuggestionRepository interface.
+var _ repository.MemorySuggestionRepository = (*postgresMemorySuggestionRepository)(nil)
+
+// memorySuggestionColumns 是查询 memory_suggestions 表时使用的列，顺序与 scanMemorySuggestion 一致。
+const memorySuggestionColumns = `id, user_id, key, value, confidence, conversation_id, message_id, status, created_at, resolved_at`
+
+// postgresMemorySuggestionRepository 是 MemorySuggestionRepository 接口的 PostgreSQL 实现。
+type postgresMemorySuggestionRepository struct {
+	db *DB
+}
+
+// NewPostgresMemorySuggestionRepository 创建一个新的 postgresMemorySuggestionRepository 实例。
+func NewPostgresMemorySuggestionRepository(db *DB) repository.MemorySuggestionRepository {
+	return &postgresMemorySuggestionRepository{db: db}
+}
+
+// scanMemorySuggestion 将一行 memorySuggestionColumns 结果扫描为 MemorySuggestion。
+func scanMemorySuggestion(row pgx.Row) (*entity.MemorySuggestion, error) {
+	var s entity.MemorySuggestion
+	var status string
+	var confidence *float32 // confidence 列为 REAL
+	if err := row.Scan(&s.ID, &s.UserID, &s.Key, &s.Value, &confidence, &s.ConversationID, &s.MessageID, &status, &s.CreatedAt, &s.ResolvedAt); err != nil {
+		return nil, err
+	}
+	s.Status = entity.MemorySuggestionStatus(status)
+	s.Confidence = float32PtrToFloat64(confidence)
+	return &s, nil
+}
+
+// CreateSuggestion 保存记忆建议，与已有建议的键值重复时不保存。
+func (r *postgresMemorySuggestionRepository) CreateSuggestion(ctx context.Context, suggestion *entity.MemorySuggestion) (bool, error) {
+	sql := `
+		INSERT INTO memory_suggestions (id, user_id, key, value, confidence, conversation_id, message_id, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, key, value) DO NOTHING
+		RETURNING ` + memorySuggestionColumns
+	created, err := scanMemorySuggestion(r.db.Pool.QueryRow(ctx, sql,
+		suggestion.ID, suggestion.UserID, suggestion.Key, suggestion.Value, suggestion.Confidence, suggestion.ConversationID, suggestion.MessageID, string(suggestion.Status)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil // 相同的键值已经建议过
+		}
+		logger.ErrorContext(ctx, "保存记忆建议失败", "error", err, "user_id", suggestion.UserID, "key", suggestion.Key)
+		return false, apperr.Wrap(err, apperr.CodeInternal, "无法保存记忆建议")
+	}
+	*suggestion = *created
+	return true, nil
+}
+
+// GetSuggestion 获取指定用户的记忆建议。
+func (r *postgresMemorySuggestionRepository) GetSuggestion(ctx context.Context, userID string, suggestionID string) (*entity.MemorySuggestion, error) {
+	if _, err := uuid.Parse(suggestionID); err != nil {
+		return nil, apperr.ErrNotFound("记忆建议未找到") // 无效的 ID 不可能存在
+	}
+	sql := `SELECT ` + memorySuggestionColumns + ` FROM memory_suggestions WHERE id = $1 AND user_id = $2`
+	suggestion, err := scanMemorySuggestion(r.db.Pool.QueryRow(ctx, sql, suggestionID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("记忆建议未找到")
+		}
+		logger.ErrorContext(ctx, "获取记忆建议失败", "error", err, "suggestion_id", suggestionID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取记忆建议")
+	}
+	return suggestion, nil
+}
+
+// ListSuggestions 列出用户的记忆建议。
+func (r *postgresMemorySuggestionRepository) ListSuggestions(ctx context.Context, userID string, status entity.MemorySuggestionStatus) ([]*entity.MemorySuggestion, error) {
+	sql := `
+		SELECT ` + memorySuggestionColumns + `
+		FROM memory_suggestions
+		WHERE user_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id`
+	rows, err := r.db.Pool.Query(ctx, sql, userID, string(status))
+	if err != nil {
+		logger.ErrorContext(ctx, "获取记忆建议列表失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取记忆建议列表")
+	}
+	defer rows.Close()
+
+	suggestions := make([]*entity.MemorySuggestion, 0)
+	for rows.Next() {
+		suggestion, err := scanMemorySuggestion(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描记忆建议数据失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理记忆建议数据时出错")
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (记忆建议列表)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return suggestions, nil
+}
+
+// ResolveSuggestion 将待确认的建议标记为已批准或已拒绝。
+func (r *postgresMemorySuggestionRepository) ResolveSuggestion(ctx context.Context, userID string, suggestionID string, status entity.MemorySuggestionStatus) (*entity.MemorySuggestion, error) {
+	if _, err := uuid.Parse(suggestionID); err != nil {
+		return nil, apperr.ErrNotFound("记忆建议未找到")
+	}
+	sql := `
+		UPDATE memory_suggestions
+		SET status = $1, resolved_at = NOW()
+		WHERE id = $2 AND user_id = $3 AND status = 'pending'
+		RETURNING ` + memorySuggestionColumns
+	resolved, err := scanMemorySuggestion(r.db.Pool.QueryRow(ctx, sql, string(status), suggestionID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// 区分建议不存在和已经处理过
+			if _, getErr := r.GetSuggestion(ctx, userID, suggestionID); getErr != nil {
+				return nil, getErr
+			}
+			return nil, apperr.New(apperr.CodeConflict, "记忆建议已经处理过").WithDetails("suggestion_id=" + suggestionID)
+		}
+		logger.ErrorContext(ctx, "更新记忆建议状态失败", "error", err, "suggestion_id", suggestionID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法更新记忆建议")
+	}
+	logger.InfoContext(ctx, "记忆建议已处理", "suggestion_id", suggestionID, "status", status)
+	return resolved, nil
+}
+
+// ApproveSuggestion 在同一个事务中批准建议并写入结构化记忆。
+func (r *postgresMemorySuggestionRepository) ApproveSuggestion(ctx context.Context, userID string, suggestionID string, memory *entity.StructuredMemory) (*entity.MemorySuggestion, error) {
+	if _, err := uuid.Parse(suggestionID); err != nil {
+		return nil, apperr.ErrNotFound("记忆建议未找到")
+	}
+	resolveSQL := `
+		UPDATE memory_suggestions
+		SET status = $1, resolved_at = NOW()
+		WHERE id = $2 AND user_id = $3 AND status = 'pending'
+		RETURNING ` + memorySuggestionColumns
+	upsertSQL := `
+		INSERT INTO structured_memories (user_id, key, value, value_type, namespace, source, source_conversation_id, confidence, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET value = EXCLUDED.value, value_type = EXCLUDED.value_type, namespace = EXCLUDED.namespace,
+		    source = EXCLUDED.source, source_conversation_id = EXCLUDED.source_conversation_id,
+		    confidence = EXCLUDED.confidence, expires_at = EXCLUDED.expires_at, updated_at = EXCLUDED.updated_at
+		RETURNING ` + structuredMemoryColumns
+
+	withMemoryDefaults(memory)
+	var resolved *entity.MemorySuggestion
+	var stored *entity.StructuredMemory
+	err := r.db.ExecuteInTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		// 先更新建议状态：并发的批准或拒绝会在这里等待行锁，之后看不到 pending 状态
+		if resolved, err = scanMemorySuggestion(tx.QueryRow(ctx, resolveSQL, string(entity.MemorySuggestionApproved), suggestionID, userID)); err != nil {
+			return err
+		}
+		stored, err = scanStructuredMemory(tx.QueryRow(ctx, upsertSQL,
+			userID,
+			memory.Key,
+			memory.Value,
+			string(memory.ValueType),
+			memory.Namespace,
+			string(memory.Source),
+			memory.SourceConversationID,
+			memory.Confidence,
+			memory.ExpiresAt,
+		))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// 区分建议不存在和已经处理过
+			if _, getErr := r.GetSuggestion(ctx, userID, suggestionID); getErr != nil {
+				return nil, getErr
+			}
+			return nil, apperr.New(apperr.CodeConflict, "记忆建议已经处理过").WithDetails("suggestion_id=" + suggestionID)
+		}
+		logger.ErrorContext(ctx, "批准记忆建议失败", "error", err, "suggestion_id", suggestionID, "user_id", userID, "key", memory.Key)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法批准记忆建议")
+	}
+	*memory = *stored
+	logger.InfoContext(ctx, "记忆建议已批准", "suggestion_id", suggestionID, "key", memory.Key)
+	return resolved, nil
+}
@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure postgresPersonaRepository implements PersonaRepository interface.
+var _ repository.PersonaRepository = (*postgresPersonaRepository)(nil)
+
+// personaColumns 是查询 personas 表时使用的列，顺序与 scanPersona 一致。
+const personaColumns = `id, user_id, name, system_prompt, model_name, temperature, rag_enabled, is_default, created_at, updated_at`
+
+// postgresPersonaRepository 是 PersonaRepository 接口的 PostgreSQL 实现。
+type postgresPersonaRepository struct {
+	db *DB
+}
+
+// NewPostgresPersonaRepository 创建一个新的 postgresPersonaRepository 实例。
+func NewPostgresPersonaRepository(db *DB) repository.PersonaRepository {
+	return &postgresPersonaRepository{db: db}
+}
+
+// scanPersona 将一行 personaColumns 结果扫描为 Persona。
+func scanPersona(row pgx.Row) (*entity.Persona, error) {
+	var p entity.Persona
+	var temperature *float32 // temperature 列为 REAL
+	if err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.SystemPrompt, &p.ModelName, &temperature, &p.RAGEnabled, &p.IsDefault, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if temperature != nil {
+		t := float64(*temperature)
+		p.Temperature = &t
+	}
+	return &p, nil
+}
+
+// isUniqueViolation 判断错误是否为唯一约束冲突 (23505)。
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// CreatePersona 创建人设。
+func (r *postgresPersonaRepository) CreatePersona(ctx context.Context, persona *entity.Persona) error {
+	sql := `
+		INSERT INTO personas (id, user_id, name, system_prompt, model_name, temperature, rag_enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + personaColumns
+	created, err := scanPersona(r.db.Pool.QueryRow(ctx, sql,
+		persona.ID, persona.UserID, persona.Name, persona.SystemPrompt, persona.ModelName, persona.Temperature, persona.RAGEnabled))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return apperr.New(apperr.CodeConflict, "同名的人设已存在").WithDetails("name=" + persona.Name)
+		}
+		logger.ErrorContext(ctx, "创建人设失败", "error", err, "user_id", persona.UserID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法创建人设")
+	}
+	*persona = *created
+	logger.InfoContext(ctx, "人设创建成功", "persona_id", persona.ID, "user_id", persona.UserID)
+	return nil
+}
+
+// GetPersona 获取指定用户的人设。
+func (r *postgresPersonaRepository) GetPersona(ctx context.Context, userID string, personaID string) (*entity.Persona, error) {
+	if _, err := uuid.Parse(personaID); err != nil {
+		return nil, apperr.ErrNotFound("人设未找到") // 无效的 ID 不可能存在
+	}
+	sql := `SELECT ` + personaColumns + ` FROM personas WHERE id = $1 AND user_id = $2`
+	persona, err := scanPersona(r.db.Pool.QueryRow(ctx, sql, personaID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("人设未找到")
+		}
+		logger.ErrorContext(ctx, "获取人设失败", "error", err, "persona_id", personaID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取人设")
+	}
+	return persona, nil
+}
+
+// ListPersonas 列出用户的所有人设。
+func (r *postgresPersonaRepository) ListPersonas(ctx context.Context, userID string) ([]*entity.Persona, error) {
+	sql := `SELECT ` + personaColumns + ` FROM personas WHERE user_id = $1 ORDER BY name, id`
+	rows, err := r.db.Pool.Query(ctx, sql, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取人设列表失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取人设列表")
+	}
+	defer rows.Close()
+
+	personas := make([]*entity.Persona, 0)
+	for rows.Next() {
+		persona, err := scanPersona(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描人设数据失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理人设数据时出错")
+		}
+		personas = append(personas, persona)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理数据库结果集时出错 (人设列表)", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return personas, nil
+}
+
+// UpdatePersona 更新人设的名称、系统提示词和生成设置。
+func (r *postgresPersonaRepository) UpdatePersona(ctx context.Context, persona *entity.Persona) (*entity.Persona, error) {
+	if _, err := uuid.Parse(persona.ID); err != nil {
+		return nil, apperr.ErrNotFound("人设未找到")
+	}
+	sql := `
+		UPDATE personas
+		SET name = $1, system_prompt = $2, model_name = $3, temperature = $4, rag_enabled = $5
+		WHERE id = $6 AND user_id = $7
+		RETURNING ` + personaColumns
+	updated, err := scanPersona(r.db.Pool.QueryRow(ctx, sql,
+		persona.Name, persona.SystemPrompt, persona.ModelName, persona.Temperature, persona.RAGEnabled, persona.ID, persona.UserID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("人设未找到")
+		}
+		if isUniqueViolation(err) {
+			return nil, apperr.New(apperr.CodeConflict, "同名的人设已存在").WithDetails("name=" + persona.Name)
+		}
+		logger.ErrorContext(ctx, "更新人设失败", "error", err, "persona_id", persona.ID, "user_id", persona.UserID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法更新人设")
+	}
+	logger.InfoContext(ctx, "人设更新成功", "persona_id", persona.ID)
+	return updated, nil
+}
+
+// DeletePersona 删除人设。
+func (r *postgresPersonaRepository) DeletePersona(ctx context.Context, userID string, personaID string) error {
+	if _, err := uuid.Parse(personaID); err != nil {
+		return apperr.ErrNotFound("人设未找到")
+	}
+	cmdTag, err := r.db.Pool.Exec(ctx, `DELETE FROM personas WHERE id = $1 AND user_id = $2`, personaID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除人设失败", "error", err, "persona_id", personaID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除人设")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("人设未找到")
+	}
+	logger.InfoContext(ctx, "人设已删除", "persona_id", personaID, "user_id", userID)
+	return nil
+}
+
+// SetDefaultPersona 设置用户的默认人设。
+// 唯一索引 idx_personas_user_default 不可延迟检查，因此先取消原默认人设，再设置新的默认人设。
+func (r *postgresPersonaRepository) SetDefaultPersona(ctx context.Context, userID string, personaID string) error {
+	if personaID != "" {
+		if _, err := uuid.Parse(personaID); err != nil {
+			return apperr.ErrNotFound("人设未找到")
+		}
+	}
+	errNotFound := apperr.ErrNotFound("人设未找到")
+	err := r.db.ExecuteInTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `UPDATE personas SET is_default = FALSE WHERE user_id = $1 AND is_default`, userID); err != nil {
+			return err
+		}
+		if personaID == "" {
+			return nil
+		}
+		cmdTag, err := tx.Exec(ctx, `UPDATE personas SET is_default = TRUE WHERE id = $1 AND user_id = $2`, personaID, userID)
+		if err != nil {
+			return err
+		}
+		if cmdTag.RowsAffected() == 0 {
+			return errNotFound // 回滚，保留原默认人设
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return errNotFound
+		}
+		logger.ErrorContext(ctx, "设置默认人设失败", "error", err, "persona_id", personaID, "user_id", userID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法设置默认人设")
+	}
+	logger.InfoContext(ctx, "默认人设已更新", "persona_id", personaID, "user_id", userID)
+	return nil
+}
+
+// GetConversationPersona 返回对话使用的人设。对话不存在 (新对话) 时返回用户的默认人设。
+func (r *postgresPersonaRepository) GetConversationPersona(ctx context.Context, userID string, conversationID string) (*entity.Persona, error) {
+	sql := `
+		SELECT p.` + personaColumns + `
+		FROM personas p
+		LEFT JOIN conversations c ON c.id = $2 AND c.user_id = $1
+		WHERE p.user_id = $1 AND (p.id = c.persona_id OR (c.persona_id IS NULL AND p.is_default))
+		LIMIT 1`
+	persona, err := scanPersona(r.db.Pool.QueryRow(ctx, sql, userID, conversationID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		logger.ErrorContext(ctx, "获取对话的人设失败", "error", err, "conversation_id", conversationID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取对话的人设")
+	}
+	return persona, nil
+}
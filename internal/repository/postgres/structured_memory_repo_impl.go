@@ -3,12 +3,13 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	// "github.com/google/uuid" // Removed unused import
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/soaringjerry/dreamhub/internal/entity"
 	"github.com/soaringjerry/dreamhub/internal/repository"
 )
@@ -17,30 +18,125 @@ import (
 // var ErrDuplicateKey = errors.New("duplicate key for user") // Defined in repository package
 // var ErrNotFound = pgx.ErrNoRows // Defined in repository package
 
+// Ensure structuredMemoryRepoImpl implements StructuredMemoryRepository interface.
+var _ repository.StructuredMemoryRepository = (*structuredMemoryRepoImpl)(nil)
+
+// structuredMemoryColumns lists the columns read for a memory, in the order scanned by scanStructuredMemory.
+const structuredMemoryColumns = `id, user_id, key, value, value_type, namespace, source, source_conversation_id, confidence, expires_at, version, created_at, updated_at`
+
+// memoryHistoryColumns lists the columns read for a history entry, in the order scanned by scanMemoryHistory.
+const memoryHistoryColumns = `id, memory_id, user_id, key, version, value, value_type, namespace, source, source_conversation_id, confidence, expires_at, change_type, changed_at`
+
 type structuredMemoryRepoImpl struct {
-	db *pgxpool.Pool
+	db *DB
 }
 
 // NewStructuredMemoryRepository creates a new instance of StructuredMemoryRepository.
-func NewStructuredMemoryRepository(db *pgxpool.Pool) repository.StructuredMemoryRepository {
+func NewStructuredMemoryRepository(db *DB) repository.StructuredMemoryRepository {
 	return &structuredMemoryRepoImpl{db: db}
 }
 
+// scanStructuredMemory scans a row of structuredMemoryColumns.
+func scanStructuredMemory(row pgx.Row) (*entity.StructuredMemory, error) {
+	memory := &entity.StructuredMemory{}
+	var valueType, source string
+	var confidence *float32 // confidence is a REAL column
+	err := row.Scan(
+		&memory.ID,
+		&memory.UserID,
+		&memory.Key,
+		&memory.Value,
+		&valueType,
+		&memory.Namespace,
+		&source,
+		&memory.SourceConversationID,
+		&confidence,
+		&memory.ExpiresAt,
+		&memory.Version,
+		&memory.CreatedAt,
+		&memory.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	memory.ValueType = entity.MemoryValueType(valueType)
+	memory.Source = entity.MemorySource(source)
+	memory.Confidence = float32PtrToFloat64(confidence)
+	return memory, nil
+}
+
+// scanMemoryHistory scans a row of memoryHistoryColumns.
+func scanMemoryHistory(row pgx.Row) (*entity.StructuredMemoryHistory, error) {
+	entry := &entity.StructuredMemoryHistory{}
+	var valueType, source, changeType string
+	var confidence *float32
+	err := row.Scan(
+		&entry.ID,
+		&entry.MemoryID,
+		&entry.UserID,
+		&entry.Key,
+		&entry.Version,
+		&entry.Value,
+		&valueType,
+		&entry.Namespace,
+		&source,
+		&entry.SourceConversationID,
+		&confidence,
+		&entry.ExpiresAt,
+		&changeType,
+		&entry.ChangedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	entry.ValueType = entity.MemoryValueType(valueType)
+	entry.Source = entity.MemorySource(source)
+	entry.ChangeType = entity.MemoryChangeType(changeType)
+	entry.Confidence = float32PtrToFloat64(confidence)
+	return entry, nil
+}
+
+// float32PtrToFloat64 converts a nullable REAL column value.
+func float32PtrToFloat64(v *float32) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := float64(*v)
+	return &f
+}
+
+// withMemoryDefaults fills in the defaults of the typed attributes for callers that only set Key and Value.
+func withMemoryDefaults(memory *entity.StructuredMemory) {
+	if memory.ValueType == "" {
+		memory.ValueType = entity.MemoryValueString
+	}
+	if memory.Source == "" {
+		memory.Source = entity.MemorySourceManual
+	}
+}
+
 // Create adds a new structured memory entry.
 func (r *structuredMemoryRepoImpl) Create(ctx context.Context, memory *entity.StructuredMemory) error {
+	withMemoryDefaults(memory)
 	query := `
-		INSERT INTO structured_memories (user_id, key, value, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at`
+		INSERT INTO structured_memories (user_id, key, value, value_type, namespace, source, source_conversation_id, confidence, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING ` + structuredMemoryColumns
 
 	now := time.Now()
-	err := r.db.QueryRow(ctx, query,
+	created, err := scanStructuredMemory(r.db.Pool.QueryRow(ctx, query,
 		memory.UserID,
 		memory.Key,
 		memory.Value,
+		string(memory.ValueType),
+		memory.Namespace,
+		string(memory.Source),
+		memory.SourceConversationID,
+		memory.Confidence,
+		memory.ExpiresAt,
 		now, // Set CreatedAt server-side
 		now, // Set UpdatedAt server-side
-	).Scan(&memory.ID, &memory.CreatedAt, &memory.UpdatedAt)
+	))
 
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -50,27 +146,16 @@ func (r *structuredMemoryRepoImpl) Create(ctx context.Context, memory *entity.St
 		}
 		return err // Return other errors directly
 	}
+	*memory = *created
 	return nil
 }
 
 // GetByKey retrieves a specific structured memory entry by user ID and key.
 // Changed userID type from uuid.UUID to string (UUID)
 func (r *structuredMemoryRepoImpl) GetByKey(ctx context.Context, userID string, key string) (*entity.StructuredMemory, error) {
-	query := `
-		SELECT id, user_id, key, value, created_at, updated_at
-		FROM structured_memories
-		WHERE user_id = $1 AND key = $2`
-
-	memory := &entity.StructuredMemory{}
-	err := r.db.QueryRow(ctx, query, userID, key).Scan(
-		&memory.ID,
-		&memory.UserID,
-		&memory.Key,
-		&memory.Value,
-		&memory.CreatedAt,
-		&memory.UpdatedAt,
-	)
+	query := `SELECT ` + structuredMemoryColumns + ` FROM structured_memories WHERE user_id = $1 AND key = $2`
 
+	memory, err := scanStructuredMemory(r.db.Pool.QueryRow(ctx, query, userID, key))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, repository.ErrNotFound // Return error from repository package
@@ -80,16 +165,16 @@ func (r *structuredMemoryRepoImpl) GetByKey(ctx context.Context, userID string,
 	return memory, nil
 }
 
-// GetByUserID retrieves all structured memory entries for a user.
+// GetByUserID retrieves all structured memory entries for a user, including expired ones.
 // Changed userID type from uuid.UUID to string (UUID)
 func (r *structuredMemoryRepoImpl) GetByUserID(ctx context.Context, userID string) ([]*entity.StructuredMemory, error) {
 	query := `
-		SELECT id, user_id, key, value, created_at, updated_at
+		SELECT ` + structuredMemoryColumns + `
 		FROM structured_memories
 		WHERE user_id = $1
 		ORDER BY created_at DESC` // Or order by key, depending on desired default sorting
 
-	rows, err := r.db.Query(ctx, query, userID)
+	rows, err := r.db.Pool.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -97,15 +182,7 @@ func (r *structuredMemoryRepoImpl) GetByUserID(ctx context.Context, userID strin
 
 	memories := []*entity.StructuredMemory{}
 	for rows.Next() {
-		memory := &entity.StructuredMemory{}
-		err := rows.Scan(
-			&memory.ID,
-			&memory.UserID,
-			&memory.Key,
-			&memory.Value,
-			&memory.CreatedAt,
-			&memory.UpdatedAt,
-		)
+		memory, err := scanStructuredMemory(rows)
 		if err != nil {
 			return nil, err // Return error encountered during row scanning
 		}
@@ -119,21 +196,30 @@ func (r *structuredMemoryRepoImpl) GetByUserID(ctx context.Context, userID strin
 	return memories, nil
 }
 
-// Update modifies an existing structured memory entry's value.
+// Update replaces an existing structured memory entry's value and attributes.
+// The version is incremented and the previous state recorded in the history by database triggers.
 func (r *structuredMemoryRepoImpl) Update(ctx context.Context, memory *entity.StructuredMemory) error {
+	withMemoryDefaults(memory)
 	query := `
 		UPDATE structured_memories
-		SET value = $1, updated_at = $2
-		WHERE user_id = $3 AND key = $4
-		RETURNING updated_at` // Return updated_at to confirm update and potentially update the entity
+		SET value = $1, value_type = $2, namespace = $3, source = $4, source_conversation_id = $5,
+		    confidence = $6, expires_at = $7, updated_at = $8
+		WHERE user_id = $9 AND key = $10
+		RETURNING ` + structuredMemoryColumns
 
 	now := time.Now()
-	err := r.db.QueryRow(ctx, query,
+	updated, err := scanStructuredMemory(r.db.Pool.QueryRow(ctx, query,
 		memory.Value,
+		string(memory.ValueType),
+		memory.Namespace,
+		string(memory.Source),
+		memory.SourceConversationID,
+		memory.Confidence,
+		memory.ExpiresAt,
 		now, // Set UpdatedAt server-side
 		memory.UserID,
 		memory.Key,
-	).Scan(&memory.UpdatedAt) // Scan the updated timestamp back into the entity
+	))
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -142,6 +228,7 @@ func (r *structuredMemoryRepoImpl) Update(ctx context.Context, memory *entity.St
 		}
 		return err
 	}
+	*memory = *updated
 	return nil
 }
 
@@ -151,7 +238,7 @@ func (r *structuredMemoryRepoImpl) Delete(ctx context.Context, userID string, ke
 	query := `DELETE FROM structured_memories WHERE user_id = $1 AND key = $2`
 
 	// Pass string userID
-	result, err := r.db.Exec(ctx, query, userID, key)
+	result, err := r.db.Pool.Exec(ctx, query, userID, key)
 	if err != nil {
 		return err
 	}
@@ -163,3 +250,124 @@ func (r *structuredMemoryRepoImpl) Delete(ctx context.Context, userID string, ke
 
 	return nil
 }
+
+// ListHistory retrieves all recorded versions of a key, newest first.
+func (r *structuredMemoryRepoImpl) ListHistory(ctx context.Context, userID string, key string) ([]*entity.StructuredMemoryHistory, error) {
+	query := `
+		SELECT ` + memoryHistoryColumns + `
+		FROM structured_memory_history
+		WHERE user_id = $1 AND key = $2
+		ORDER BY changed_at DESC, version DESC`
+
+	rows, err := r.db.Pool.Query(ctx, query, userID, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*entity.StructuredMemoryHistory{}
+	for rows.Next() {
+		entry, err := scanMemoryHistory(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetHistoryEntry retrieves a single recorded version by its ID.
+func (r *structuredMemoryRepoImpl) GetHistoryEntry(ctx context.Context, userID string, historyID string) (*entity.StructuredMemoryHistory, error) {
+	if _, err := uuid.Parse(historyID); err != nil {
+		return nil, repository.ErrNotFound // An invalid ID cannot exist
+	}
+	query := `SELECT ` + memoryHistoryColumns + ` FROM structured_memory_history WHERE id = $1 AND user_id = $2`
+
+	entry, err := scanMemoryHistory(r.db.Pool.QueryRow(ctx, query, historyID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ApplyBatch runs the writes in order in a single transaction.
+// A memory written by an upsert has version 1 if it was created, so the version tells created and updated rows apart.
+func (r *structuredMemoryRepoImpl) ApplyBatch(ctx context.Context, userID string, writes []repository.MemoryWrite, onConflict entity.MemoryConflictStrategy) ([]*entity.MemoryBatchResult, error) {
+	insert := `
+		INSERT INTO structured_memories (user_id, key, value, value_type, namespace, source, source_conversation_id, confidence, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)`
+	switch onConflict {
+	case entity.MemoryConflictOverwrite:
+		insert += `
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET value = EXCLUDED.value, value_type = EXCLUDED.value_type, namespace = EXCLUDED.namespace,
+		    source = EXCLUDED.source, source_conversation_id = EXCLUDED.source_conversation_id,
+		    confidence = EXCLUDED.confidence, expires_at = EXCLUDED.expires_at, updated_at = EXCLUDED.updated_at`
+	case entity.MemoryConflictSkip:
+		insert += `
+		ON CONFLICT (user_id, key) DO NOTHING`
+	}
+	insert += `
+		RETURNING ` + structuredMemoryColumns
+
+	results := make([]*entity.MemoryBatchResult, 0, len(writes))
+	err := r.db.ExecuteInTx(ctx, func(tx pgx.Tx) error {
+		now := time.Now()
+		for i, w := range writes {
+			result := &entity.MemoryBatchResult{Index: i, Op: w.Op, Key: w.Memory.Key}
+			results = append(results, result)
+
+			if w.Op == entity.MemoryBatchDelete {
+				cmdTag, err := tx.Exec(ctx, `DELETE FROM structured_memories WHERE user_id = $1 AND key = $2`, userID, w.Memory.Key)
+				if err != nil {
+					return err
+				}
+				result.Status = entity.MemoryBatchDeleted
+				if cmdTag.RowsAffected() == 0 {
+					result.Status = entity.MemoryBatchNotFound
+				}
+				continue
+			}
+
+			memory := w.Memory
+			withMemoryDefaults(memory)
+			stored, err := scanStructuredMemory(tx.QueryRow(ctx, insert,
+				userID,
+				memory.Key,
+				memory.Value,
+				string(memory.ValueType),
+				memory.Namespace,
+				string(memory.Source),
+				memory.SourceConversationID,
+				memory.Confidence,
+				memory.ExpiresAt,
+				now,
+			))
+			switch {
+			case err == nil:
+				result.Memory = stored
+				result.Status = entity.MemoryBatchUpdated
+				if stored.Version == 1 {
+					result.Status = entity.MemoryBatchCreated
+				}
+			case errors.Is(err, pgx.ErrNoRows): // ON CONFLICT DO NOTHING
+				result.Status = entity.MemoryBatchSkipped
+			case isUniqueViolation(err):
+				return fmt.Errorf("%w: key=%s", repository.ErrDuplicateKey, memory.Key)
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
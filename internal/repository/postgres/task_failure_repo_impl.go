@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure postgresTaskFailureRepository implements TaskFailureRepository interface.
+var _ repository.TaskFailureRepository = (*postgresTaskFailureRepository)(nil)
+
+// postgresTaskFailureRepository 是 TaskFailureRepository 接口的 PostgreSQL 实现。
+type postgresTaskFailureRepository struct {
+	db *DB
+}
+
+// NewPostgresTaskFailureRepository 创建一个新的 postgresTaskFailureRepository 实例。
+func NewPostgresTaskFailureRepository(db *DB) repository.TaskFailureRepository {
+	return &postgresTaskFailureRepository{db: db}
+}
+
+// RecordFailure 记录任务的一次失败尝试。user_id 和 document_id 为空时存为 NULL。
+func (r *postgresTaskFailureRepository) RecordFailure(ctx context.Context, failure *entity.TaskFailure) error {
+	const sql = `
+		INSERT INTO task_failures (task_id, queue, task_type, user_id, document_id, attempt, error, failed_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8)
+		RETURNING id
+	`
+	err := r.db.Pool.QueryRow(ctx, sql,
+		failure.TaskID, failure.Queue, failure.TaskType, failure.UserID, failure.DocumentID,
+		failure.Attempt, failure.Error, failure.FailedAt,
+	).Scan(&failure.ID)
+	if err != nil {
+		logger.ErrorContext(ctx, "记录任务失败历史失败", "error", err, "task_id", failure.TaskID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法记录任务失败历史")
+	}
+	return nil
+}
+
+// ListByTaskIDs 按失败时间顺序返回这些任务的失败记录。
+func (r *postgresTaskFailureRepository) ListByTaskIDs(ctx context.Context, taskIDs []string) (map[string][]*entity.TaskFailure, error) {
+	result := make(map[string][]*entity.TaskFailure, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return result, nil
+	}
+	const sql = `
+		SELECT id, task_id, queue, task_type, COALESCE(user_id, ''), COALESCE(document_id, ''), attempt, error, failed_at
+		FROM task_failures
+		WHERE task_id = ANY($1)
+		ORDER BY failed_at ASC, id ASC
+	`
+	rows, err := r.db.Pool.Query(ctx, sql, taskIDs)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询任务失败历史失败", "error", err, "task_count", len(taskIDs))
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询任务失败历史")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f entity.TaskFailure
+		if err := rows.Scan(&f.ID, &f.TaskID, &f.Queue, &f.TaskType, &f.UserID, &f.DocumentID, &f.Attempt, &f.Error, &f.FailedAt); err != nil {
+			logger.ErrorContext(ctx, "扫描任务失败历史失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "无法读取任务失败历史")
+		}
+		result[f.TaskID] = append(result[f.TaskID], &f)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "遍历任务失败历史失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法读取任务失败历史")
+	}
+	return result, nil
+}
+
+// ReassignTask 将 oldTaskID 的失败记录转移到 newTaskID。
+func (r *postgresTaskFailureRepository) ReassignTask(ctx context.Context, oldTaskID string, newTaskID string) error {
+	const sql = `UPDATE task_failures SET task_id = $2 WHERE task_id = $1`
+	if _, err := r.db.Pool.Exec(ctx, sql, oldTaskID, newTaskID); err != nil {
+		logger.ErrorContext(ctx, "转移任务失败历史失败", "error", err, "old_task_id", oldTaskID, "new_task_id", newTaskID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法转移任务失败历史")
+	}
+	return nil
+}
+
+// DeleteByTaskID 删除任务的所有失败记录。
+func (r *postgresTaskFailureRepository) DeleteByTaskID(ctx context.Context, taskID string) error {
+	const sql = `DELETE FROM task_failures WHERE task_id = $1`
+	if _, err := r.db.Pool.Exec(ctx, sql, taskID); err != nil {
+		logger.ErrorContext(ctx, "删除任务失败历史失败", "error", err, "task_id", taskID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除任务失败历史")
+	}
+	return nil
+}
+
+// DeleteBefore 删除在 before 之前记录的失败历史。
+func (r *postgresTaskFailureRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	const sql = `DELETE FROM task_failures WHERE failed_at < $1`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, before)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除过期任务失败历史失败", "error", err, "before", before)
+		return 0, apperr.Wrap(err, apperr.CodeInternal, "无法删除过期任务失败历史")
+	}
+	return cmdTag.RowsAffected(), nil
+}
@@ -221,3 +221,14 @@ func (r *postgresTaskRepository) GetPendingTasks(ctx context.Context, limit int)
 
 	return tasks, nil
 }
+
+// DeleteFinishedTasksBefore 删除在 before 之前结束的任务记录 (pending 和 processing 状态的任务不受影响)。
+func (r *postgresTaskRepository) DeleteFinishedTasksBefore(ctx context.Context, before time.Time) (int64, error) {
+	const sql = `DELETE FROM tasks WHERE status IN ($1, $2) AND updated_at < $3`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, entity.TaskStatusCompleted, entity.TaskStatusFailed, before)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除过期任务记录失败", "error", err, "before", before)
+		return 0, apperr.Wrap(err, apperr.CodeInternal, "无法删除过期任务记录")
+	}
+	return cmdTag.RowsAffected(), nil
+}
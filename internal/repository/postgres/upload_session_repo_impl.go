@@ -0,0 +1,218 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure postgresUploadSessionRepository implements UploadSessionRepository interface.
+var _ repository.UploadSessionRepository = (*postgresUploadSessionRepository)(nil)
+
+// uploadSessionColumns 是查询 upload_sessions 时使用的列，顺序与 scanUploadSession 一致。
+const uploadSessionColumns = `id, user_id, filename, content_type, total_size, upload_offset, status, expires_at, created_at, updated_at`
+
+// postgresUploadSessionRepository 是 UploadSessionRepository 接口的 PostgreSQL 实现。
+type postgresUploadSessionRepository struct {
+	db *DB
+}
+
+// NewPostgresUploadSessionRepository 创建一个新的 postgresUploadSessionRepository 实例。
+func NewPostgresUploadSessionRepository(db *DB) repository.UploadSessionRepository {
+	return &postgresUploadSessionRepository{db: db}
+}
+
+// scanUploadSession 将一行查询结果扫描为 UploadSession。
+func scanUploadSession(row pgx.Row) (*entity.UploadSession, error) {
+	var s entity.UploadSession
+	var status string
+	err := row.Scan(&s.ID, &s.UserID, &s.Filename, &s.ContentType, &s.TotalSize, &s.Offset, &status, &s.ExpiresAt, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.Status = entity.UploadSessionStatus(status)
+	return &s, nil
+}
+
+// CreateSession 创建一个新的上传会话。
+func (r *postgresUploadSessionRepository) CreateSession(ctx context.Context, session *entity.UploadSession) error {
+	const sql = `
+		INSERT INTO upload_sessions (id, user_id, filename, content_type, total_size, upload_offset, status, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := r.db.Pool.Exec(ctx, sql,
+		session.ID, session.UserID, session.Filename, session.ContentType, session.TotalSize,
+		session.Offset, string(session.Status), session.ExpiresAt, session.CreatedAt, session.UpdatedAt,
+	)
+	if err != nil {
+		logger.ErrorContext(ctx, "创建上传会话失败", "error", err, "user_id", session.UserID, "filename", session.Filename)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法创建上传会话")
+	}
+	return nil
+}
+
+// GetSession 获取指定用户的上传会话。
+func (r *postgresUploadSessionRepository) GetSession(ctx context.Context, userID string, sessionID string) (*entity.UploadSession, error) {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return nil, apperr.ErrNotFound("上传会话未找到") // 无效的 ID 不可能存在
+	}
+	sql := `SELECT ` + uploadSessionColumns + ` FROM upload_sessions WHERE id = $1 AND user_id = $2`
+	session, err := scanUploadSession(r.db.Pool.QueryRow(ctx, sql, sessionID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.ErrNotFound("上传会话未找到")
+		}
+		logger.ErrorContext(ctx, "获取上传会话失败", "error", err, "session_id", sessionID, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取上传会话")
+	}
+	return session, nil
+}
+
+// AppendPart 记录新的数据块并推进会话的 Offset。
+func (r *postgresUploadSessionRepository) AppendPart(ctx context.Context, userID string, part *entity.UploadPart, expiresAt time.Time) error {
+	return r.db.ExecuteInTx(ctx, func(tx pgx.Tx) error {
+		const updateSQL = `
+			UPDATE upload_sessions
+			SET upload_offset = upload_offset + $1, expires_at = $2
+			WHERE id = $3 AND user_id = $4 AND upload_offset = $5 AND status = $6
+			  AND upload_offset + $1 <= total_size
+		`
+		cmdTag, err := tx.Exec(ctx, updateSQL, part.Size, expiresAt, part.SessionID, userID, part.Offset, string(entity.UploadSessionStatusActive))
+		if err != nil {
+			logger.ErrorContext(ctx, "更新上传会话偏移失败", "error", err, "session_id", part.SessionID)
+			return apperr.Wrap(err, apperr.CodeInternal, "无法更新上传会话")
+		}
+		if cmdTag.RowsAffected() == 0 {
+			return apperr.New(apperr.CodeConflict, "上传偏移不匹配或会话已不可写入")
+		}
+
+		const insertSQL = `
+			INSERT INTO upload_session_parts (session_id, part_offset, size, stored_path, created_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			RETURNING created_at
+		`
+		if err := tx.QueryRow(ctx, insertSQL, part.SessionID, part.Offset, part.Size, part.StoredPath).Scan(&part.CreatedAt); err != nil {
+			logger.ErrorContext(ctx, "保存上传数据块失败", "error", err, "session_id", part.SessionID, "offset", part.Offset)
+			return apperr.Wrap(err, apperr.CodeInternal, "无法保存上传数据块")
+		}
+		return nil
+	})
+}
+
+// ListParts 按偏移顺序列出会话的所有数据块。
+func (r *postgresUploadSessionRepository) ListParts(ctx context.Context, sessionID string) ([]*entity.UploadPart, error) {
+	const sql = `
+		SELECT session_id, part_offset, size, stored_path, created_at
+		FROM upload_session_parts
+		WHERE session_id = $1
+		ORDER BY part_offset ASC
+	`
+	rows, err := r.db.Pool.Query(ctx, sql, sessionID)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询上传数据块失败", "error", err, "session_id", sessionID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询上传数据块")
+	}
+	defer rows.Close()
+
+	parts := make([]*entity.UploadPart, 0)
+	for rows.Next() {
+		var part entity.UploadPart
+		if err := rows.Scan(&part.SessionID, &part.Offset, &part.Size, &part.StoredPath, &part.CreatedAt); err != nil {
+			logger.ErrorContext(ctx, "扫描上传数据块行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		parts = append(parts, &part)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理上传数据块结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return parts, nil
+}
+
+// UpdateStatus 将会话从 from 状态切换到 to 状态。
+func (r *postgresUploadSessionRepository) UpdateStatus(ctx context.Context, userID string, sessionID string, from, to entity.UploadSessionStatus) error {
+	const sql = `UPDATE upload_sessions SET status = $1 WHERE id = $2 AND user_id = $3 AND status = $4`
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, string(to), sessionID, userID, string(from))
+	if err != nil {
+		logger.ErrorContext(ctx, "更新上传会话状态失败", "error", err, "session_id", sessionID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法更新上传会话状态")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.New(apperr.CodeConflict, "上传会话状态已改变")
+	}
+	return nil
+}
+
+// DeleteSession 删除上传会话及其数据块记录。
+func (r *postgresUploadSessionRepository) DeleteSession(ctx context.Context, userID string, sessionID string) error {
+	const sql = `DELETE FROM upload_sessions WHERE id = $1 AND user_id = $2` // upload_session_parts 通过 ON DELETE CASCADE 删除
+	cmdTag, err := r.db.Pool.Exec(ctx, sql, sessionID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "删除上传会话失败", "error", err, "session_id", sessionID)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法删除上传会话")
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return apperr.ErrNotFound("上传会话未找到")
+	}
+	return nil
+}
+
+// ListExpiredSessions 列出已过期的会话。
+func (r *postgresUploadSessionRepository) ListExpiredSessions(ctx context.Context, before time.Time, limit int) ([]*entity.UploadSession, error) {
+	sql := `SELECT ` + uploadSessionColumns + ` FROM upload_sessions WHERE expires_at < $1 ORDER BY expires_at ASC LIMIT $2`
+	rows, err := r.db.Pool.Query(ctx, sql, before, limit)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询过期上传会话失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询过期上传会话")
+	}
+	defer rows.Close()
+
+	sessions := make([]*entity.UploadSession, 0)
+	for rows.Next() {
+		session, err := scanUploadSession(rows)
+		if err != nil {
+			logger.ErrorContext(ctx, "扫描上传会话行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理上传会话结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return sessions, nil
+}
+
+// ListPartPaths 列出所有数据块的存储路径。
+func (r *postgresUploadSessionRepository) ListPartPaths(ctx context.Context) ([]string, error) {
+	const sql = `SELECT stored_path FROM upload_session_parts`
+	rows, err := r.db.Pool.Query(ctx, sql)
+	if err != nil {
+		logger.ErrorContext(ctx, "查询上传数据块存储路径失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法查询上传数据块")
+	}
+	defer rows.Close()
+
+	paths := make([]string, 0)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			logger.ErrorContext(ctx, "扫描上传数据块行失败", "error", err)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+		}
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		logger.ErrorContext(ctx, "处理上传数据块结果集时出错", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "处理数据库结果时出错")
+	}
+	return paths, nil
+}
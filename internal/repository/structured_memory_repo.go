@@ -31,10 +31,33 @@ type StructuredMemoryRepository interface {
 
 	// Update modifies an existing structured memory entry.
 	// It accepts UserConfig with UserID as string (UUID).
-	// It should typically update the 'Value' and 'UpdatedAt' fields based on UserID and Key.
+	// It replaces the value and its attributes (type, namespace, source, confidence, expiry)
+	// based on UserID and Key, and scans the new ID, Version and timestamps back into memory.
+	// Returns ErrNotFound if the entry does not exist.
 	Update(ctx context.Context, memory *entity.StructuredMemory) error
 
 	// Delete removes a structured memory entry from the storage based on UserID and Key.
 	// Changed userID type from uuid.UUID to string (UUID)
 	Delete(ctx context.Context, userID string, key string) error
+
+	// ListHistory retrieves every recorded version of the user's memories with the given key,
+	// newest first. Versions of deleted memories are included.
+	ListHistory(ctx context.Context, userID string, key string) ([]*entity.StructuredMemoryHistory, error)
+
+	// GetHistoryEntry retrieves a single recorded version.
+	// Returns ErrNotFound if it does not exist or belongs to another user.
+	GetHistoryEntry(ctx context.Context, userID string, historyID string) (*entity.StructuredMemoryHistory, error)
+
+	// ApplyBatch runs the writes in order in a single transaction and returns one result per write.
+	// onConflict decides what an upsert does when the key exists. With MemoryConflictFail the
+	// transaction is rolled back and an error wrapping ErrDuplicateKey (naming the key) is returned.
+	// Deleting a key that does not exist is reported as not_found and does not abort the batch.
+	ApplyBatch(ctx context.Context, userID string, writes []MemoryWrite, onConflict entity.MemoryConflictStrategy) ([]*entity.MemoryBatchResult, error)
+}
+
+// MemoryWrite is one write of StructuredMemoryRepository.ApplyBatch.
+// Delete writes only use Memory.Key.
+type MemoryWrite struct {
+	Op     entity.MemoryBatchOpType
+	Memory *entity.StructuredMemory
 }
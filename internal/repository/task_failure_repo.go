@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// TaskFailureRepository 定义了与任务失败历史 (task_failures 表) 交互的方法。
+type TaskFailureRepository interface {
+	// RecordFailure 记录任务的一次失败尝试。
+	RecordFailure(ctx context.Context, failure *entity.TaskFailure) error
+
+	// ListByTaskIDs 按失败时间顺序返回这些任务的失败记录，以任务 ID 为键。
+	ListByTaskIDs(ctx context.Context, taskIDs []string) (map[string][]*entity.TaskFailure, error)
+
+	// ReassignTask 将 oldTaskID 的失败记录转移到 newTaskID (死信任务重新入队后保留历史)。
+	ReassignTask(ctx context.Context, oldTaskID string, newTaskID string) error
+
+	// DeleteByTaskID 删除任务的所有失败记录。
+	DeleteByTaskID(ctx context.Context, taskID string) error
+
+	// DeleteBefore 删除在 before 之前记录的失败历史，返回删除的行数。
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
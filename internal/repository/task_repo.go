@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/soaringjerry/dreamhub/internal/entity"
 )
@@ -33,6 +34,9 @@ type TaskRepository interface {
 	// 可以添加过滤条件，例如按创建时间、优先级等。
 	GetPendingTasks(ctx context.Context, limit int) ([]*entity.Task, error)
 
+	// DeleteFinishedTasksBefore 删除在 before 之前结束 (completed 或 failed) 的任务记录，返回删除的行数。
+	DeleteFinishedTasksBefore(ctx context.Context, before time.Time) (int64, error)
+
 	// TODO: 可能需要添加其他方法，例如：
 	// GetTasksByUser(ctx context.Context, userID string, limit int, offset int) ([]*entity.Task, error)
 	// DeleteTask(ctx context.Context, taskID uuid.UUID) error
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// UploadSessionRepository 定义了与可恢复上传会话 (upload_sessions / upload_session_parts 表) 交互的方法。
+type UploadSessionRepository interface {
+	// CreateSession 创建一个新的上传会话。
+	CreateSession(ctx context.Context, session *entity.UploadSession) error
+
+	// GetSession 获取指定用户的上传会话，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetSession(ctx context.Context, userID string, sessionID string) (*entity.UploadSession, error)
+
+	// AppendPart 在同一事务中记录新的数据块并推进会话的 Offset，同时延长过期时间。
+	// part.Offset 必须等于会话当前的 Offset 且会话处于 active 状态，否则返回 CodeConflict 错误。
+	AppendPart(ctx context.Context, userID string, part *entity.UploadPart, expiresAt time.Time) error
+
+	// ListParts 按偏移顺序列出会话的所有数据块。
+	ListParts(ctx context.Context, sessionID string) ([]*entity.UploadPart, error)
+
+	// UpdateStatus 将会话从 from 状态切换到 to 状态 (乐观锁)，状态不匹配时返回 CodeConflict 错误。
+	UpdateStatus(ctx context.Context, userID string, sessionID string, from, to entity.UploadSessionStatus) error
+
+	// DeleteSession 删除上传会话及其数据块记录 (不删除存储中的文件)。
+	DeleteSession(ctx context.Context, userID string, sessionID string) error
+
+	// ListExpiredSessions 列出在 before 之前过期的会话 (用于清理)。
+	ListExpiredSessions(ctx context.Context, before time.Time, limit int) ([]*entity.UploadSession, error)
+
+	// ListPartPaths 列出所有数据块的存储路径 (用于对账存储中的孤立文件)。
+	ListPartPaths(ctx context.Context) ([]string, error)
+}
@@ -25,15 +25,25 @@ type VectorRepository interface {
 	// SearchSimilarChunks 搜索与查询向量相似的文档块。
 	// 需要确保实现中根据 ctx 中的 user_id 进行了过滤。
 	// limit 参数指定返回结果的数量。
-	// filter 参数允许根据元数据进行额外过滤 (可选)。
+	// filter 参数允许根据元数据 (发送者、会话、时间范围) 进行额外过滤 (可选，nil 表示不过滤)。
 	// Added userID string parameter for filtering
-	SearchSimilarChunks(ctx context.Context, userID string, queryVector pgvector.Vector, limit int, filter map[string]any) ([]SearchResult, error)
+	SearchSimilarChunks(ctx context.Context, userID string, queryVector pgvector.Vector, limit int, filter *entity.ChunkFilter) ([]SearchResult, error)
 
 	// DeleteChunksByDocumentID 删除指定文档的所有相关向量块。
 	// Added userID string parameter for filtering
 	// Changed documentID type from uuid.UUID to string
 	DeleteChunksByDocumentID(ctx context.Context, userID string, documentID string) error
 
+	// ListChunksByDocumentID 按块索引顺序分页列出指定文档的块 (不包含向量)。
+	// 用于让用户检查 RAG 实际索引了哪些内容。
+	ListChunksByDocumentID(ctx context.Context, userID string, documentID string, limit int, offset int) ([]*entity.DocumentChunk, error)
+
+	// DeleteOrphanedChunks 删除所属文档已不存在的向量块 (例如删除文档时清理向量失败留下的块)，返回删除的块数。
+	DeleteOrphanedChunks(ctx context.Context) (int64, error)
+
+	// OptimizeIndexes 回收已删除向量块占用的空间并更新统计信息；reindex 为 true 时同时在线重建向量索引。
+	OptimizeIndexes(ctx context.Context, reindex bool) error
+
 	// TODO: 可能需要添加其他方法，例如：
 	// GetChunkByID(ctx context.Context, userID string, chunkID string) (*entity.DocumentChunk, error) // Changed chunkID to string, added userID
 	// DeleteChunkByID(ctx context.Context, chunkID uuid.UUID) error
@@ -13,24 +13,54 @@ type ChatService interface {
 	// 它会检索上下文（历史记录，未来可能包括 RAG），调用 LLM，
 	// 保存用户消息和 AI 回复，并返回 AI 的回复和对话 ID。
 	// modelName 参数用于指定要使用的 LLM 模型，如果为空则使用默认模型。
+	// personaID 不为空时将对话的人设切换为该人设，为空时使用对话已选择的人设或用户的默认人设；
+	// 人设的系统提示词作为第一条消息发送，请求未指定模型时使用人设的默认模型。
+	// opts 为生成参数 (temperature、max_tokens、JSON 模式等)，未设置的字段使用人设或模型的默认值；
+	// 参数超出范围或超出模型限制时返回 CodeValidation 错误，此时不会保存用户消息。
+	// filter 限定 RAG 检索的文档块 (例如只检索某人某段时间的邮件/聊天记录)，为 nil 时不过滤。
 	// conversationID is now string
-	HandleChatMessage(ctx context.Context, userID string, conversationID string, message string, modelName string) (reply string, newConversationID string, err error)
+	HandleChatMessage(ctx context.Context, userID string, conversationID string, message string, modelName string, personaID string, opts *entity.GenerationOptions, filter *entity.ChunkFilter) (reply string, newConversationID string, err error)
 
 	// HandleStreamChatMessage 处理流式聊天消息 (用于 WebSocket)。
 	// 实现逻辑与 HandleChatMessage 类似，但通过 channel 流式返回 AI 回复块。
-	// modelName 参数用于指定要使用的 LLM 模型，如果为空则使用默认模型。
+	// modelName 参数用于指定要使用的 LLM 模型，如果为空则使用默认模型。personaID 和 opts 与 HandleChatMessage 相同。
 	// conversationID is now string
-	HandleStreamChatMessage(ctx context.Context, userID string, conversationID string, message string, modelName string, streamCh chan<- string) (newConversationID string, err error)
+	HandleStreamChatMessage(ctx context.Context, userID string, conversationID string, message string, modelName string, personaID string, opts *entity.GenerationOptions, filter *entity.ChunkFilter, streamCh chan<- string) (newConversationID string, err error)
 
 	// GetConversationMessages 获取指定对话的消息列表（带分页）。
 	// conversationID is now string
 	GetConversationMessages(ctx context.Context, userID string, conversationID string, limit int, offset int) ([]*entity.Message, error)
 
-	// GetUserConversations 获取指定用户的所有对话基本信息。
-	GetUserConversations(ctx context.Context, userID string) ([]*entity.Conversation, error)
+	// GetActiveBranchMessages 获取对话当前分支的最近 limit 条消息，按时间顺序排列。
+	GetActiveBranchMessages(ctx context.Context, userID string, conversationID string, limit int) ([]*entity.Message, error)
+
+	// RegenerateReply 为指定的 AI 回复重新生成一个版本。新回复与原回复是兄弟节点 (同一条用户消息的子消息)，
+	// 并成为对话的当前分支。上下文为原回复之前的分支。
+	RegenerateReply(ctx context.Context, userID string, conversationID string, messageID string, modelName string, opts *entity.GenerationOptions) (reply *entity.Message, err error)
+
+	// EditMessage 以新内容创建指定用户消息的新版本 (原消息的兄弟节点) 并为其生成回复，新分支成为对话的当前分支。
+	// 原消息及其后续消息保留在原分支上。
+	EditMessage(ctx context.Context, userID string, conversationID string, messageID string, content string, modelName string, opts *entity.GenerationOptions) (edited *entity.Message, reply *entity.Message, err error)
+
+	// SelectBranch 将对话的当前分支切换到包含指定消息的分支，后续消息和 LLM 上下文都基于该分支。
+	SelectBranch(ctx context.Context, userID string, conversationID string, messageID string) (*entity.Conversation, error)
+
+	// GetUserConversations 分页获取指定用户满足过滤条件的对话 (置顶在前，按最后活动时间降序)，并返回符合条件的总数。
+	GetUserConversations(ctx context.Context, userID string, filter *entity.ConversationFilter, limit int, offset int) ([]*entity.Conversation, int, error)
+
+	// GetConversation 获取指定用户的单个对话。
+	GetConversation(ctx context.Context, userID string, conversationID string) (*entity.Conversation, error)
+
+	// UpdateConversation 修改对话的标题、归档、置顶状态和人设，返回更新后的对话。
+	// 人设必须属于该用户，persona_id 为空字符串时对话恢复为使用默认人设。
+	UpdateConversation(ctx context.Context, userID string, conversationID string, update *entity.ConversationUpdate) (*entity.Conversation, error)
+
+	// DeleteConversation 删除对话及其所有消息。
+	DeleteConversation(ctx context.Context, userID string, conversationID string) error
 
-	// TODO: 可能需要添加其他方法，例如：
-	// DeleteConversation(ctx context.Context, conversationID uuid.UUID) error
+	// RegenerateConversationTitle 在后台重新生成对话标题 (替换已有的自动标题)，返回任务 ID。
+	// 对话标题由用户手动设置时返回 CodeConflict 错误。
+	RegenerateConversationTitle(ctx context.Context, userID string, conversationID string) (taskID string, err error)
 }
 
 // LLMProvider 定义了与大型语言模型交互的接口。
@@ -38,10 +68,14 @@ type ChatService interface {
 type LLMProvider interface {
 	// GenerateContent 根据提供的消息历史生成回复。
 	// modelName 参数用于指定要使用的 LLM 模型，如果为空则使用默认模型。
-	GenerateContent(ctx context.Context, messages []*entity.Message, modelName string) (string, error)
+	// opts 为生成参数 (如 temperature)，为 nil 时使用默认值。
+	GenerateContent(ctx context.Context, messages []*entity.Message, modelName string, opts *entity.GenerationOptions) (string, error)
 	// GenerateContentStream 根据提供的消息历史流式生成回复。
 	// modelName 参数用于指定要使用的 LLM 模型，如果为空则使用默认模型。
-	GenerateContentStream(ctx context.Context, messages []*entity.Message, modelName string, streamFn func(chunk string)) error
+	GenerateContentStream(ctx context.Context, messages []*entity.Message, modelName string, opts *entity.GenerationOptions, streamFn func(chunk string)) error
+	// ValidateGenerationOptions 检查生成参数是否在模型的限制之内 (最大 token 数、是否支持 JSON 模式和采样参数等)，
+	// 超出限制时返回 CodeValidation 错误。modelName 为空时检查默认模型。
+	ValidateGenerationOptions(modelName string, opts *entity.GenerationOptions) error
 }
 
 // EmbeddingProvider 定义了生成文本嵌入向量的接口。
@@ -55,6 +89,8 @@ type EmbeddingProvider interface {
 // RAGService 定义了执行 RAG 检索的接口 (暂时定义，后续实现)。
 type RAGService interface {
 	RetrieveRelevantChunks(ctx context.Context, userID string, query string, limit int) ([]*entity.DocumentChunk, error)
+	// RetrieveFilteredChunks 与 RetrieveRelevantChunks 相同，但只在满足元数据过滤条件 (发送者、会话、时间范围) 的块中检索。
+	RetrieveFilteredChunks(ctx context.Context, userID string, query string, limit int, filter *entity.ChunkFilter) ([]*entity.DocumentChunk, error)
 }
 
 // MemoryService 定义了管理对话记忆和摘要的接口 (暂时定义，后续实现)。
@@ -4,12 +4,14 @@ import (
 	"context" // Import fmt for error formatting
 	"fmt"     // Import fmt for string formatting
 	"strings" // Import strings for builder
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/soaringjerry/dreamhub/internal/entity"
 	"github.com/soaringjerry/dreamhub/internal/repository"
 
 	// "github.com/soaringjerry/dreamhub/internal/repository/postgres" // Removed unused import
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
 	"github.com/soaringjerry/dreamhub/pkg/logger"
 )
 
@@ -18,6 +20,13 @@ type chatServiceImpl struct {
 	chatRepo    repository.ChatRepository // 对话历史仓库
 	llmProvider LLMProvider               // LLM 服务提供者
 	ragService  RAGService                // RAG 服务
+	titler      ConversationTitleService  // 对话标题生成服务 (可以为 nil，此时不自动生成标题)
+	indexer     MessageIndexer            // 消息搜索索引 (可以为 nil)
+	personas    PersonaResolver           // 人设查找 (可以为 nil，此时不发送系统提示词)
+	memories    MemoryContextProvider     // 用户记忆选择 (可以为 nil，此时不注入记忆)
+	extractor   MemoryExtractionService   // 用户记忆自动提取 (可以为 nil，此时不提取记忆)
+	graph       GraphRecorder             // 图记忆自动记录 (可以为 nil，此时不记录)
+	events      EventPublisher            // 事件总线 (可以为 nil，此时不发布 dreamhub.chat.completed 事件)
 	// memoryService MemoryService             // 对话记忆服务 (未来添加)
 	// maxHistory int // 最大历史消息数 (可以从配置读取)
 }
@@ -27,25 +36,41 @@ func NewChatService(
 	chatRepo repository.ChatRepository,
 	llm LLMProvider,
 	rag RAGService, // 添加 RAG 服务依赖
+	titler ConversationTitleService,
+	indexer MessageIndexer,
+	personas PersonaResolver,
+	memories MemoryContextProvider,
+	extractor MemoryExtractionService,
+	graph GraphRecorder,
+	events EventPublisher,
 	// mem MemoryService,
 ) ChatService {
 	return &chatServiceImpl{
 		chatRepo:    chatRepo,
 		llmProvider: llm,
 		ragService:  rag, // 初始化 RAG 服务
+		titler:      titler,
+		indexer:     indexer,
+		personas:    personas,
+		memories:    memories,
+		extractor:   extractor,
+		graph:       graph,
+		events:      events,
 		// memoryService: mem,
 		// maxHistory: 10, // Example default
 	}
 }
 
-// HandleChatMessage 处理传入的聊天消息。
-func (s *chatServiceImpl) HandleChatMessage(ctx context.Context, userID string, conversationID string, message string, modelName string) (reply string, newConversationID string, err error) {
-	// userID is now passed as a parameter, remove GetUserIDFromCtx
-	// if err != nil { // Error handling for GetUserIDFromCtx removed
-	// 	// Return empty string for newConversationID as it's now string
-	// 	return "", "", err
-	// } // Removed the extra closing brace
+const (
+	chatHistoryLimit = 10 // 获取当前分支最近 10 条消息作为上下文 (应可配置)
+	chatRAGLimit     = 3  // 获取最多 3 个相关块 (应可配置)
+)
 
+// HandleChatMessage 处理传入的聊天消息。
+func (s *chatServiceImpl) HandleChatMessage(ctx context.Context, userID string, conversationID string, message string, modelName string, personaID string, opts *entity.GenerationOptions, filter *entity.ChunkFilter) (reply string, newConversationID string, err error) {
+	if err := validateGenerationOptions(opts); err != nil {
+		return "", conversationID, err
+	}
 	isNewConversation := (conversationID == "") // Check for empty string for new conversation
 	if isNewConversation {
 		conversationID = uuid.NewString() // 为新对话生成 string 类型的 ID
@@ -54,91 +79,48 @@ func (s *chatServiceImpl) HandleChatMessage(ctx context.Context, userID string,
 		logger.InfoContext(ctx, "继续现有对话", "user_id", userID, "conversation_id", conversationID)
 	}
 	newConversationID = conversationID // 返回当前的（可能是新的）对话 ID
-
-	// 1. 保存用户消息
-	// Assuming entity.NewMessage now accepts string IDs
-	userMessage := entity.NewMessage(conversationID, userID, entity.SenderRoleUser, message)
-	if err := s.chatRepo.SaveMessage(ctx, userMessage); err != nil {
-		// 保存失败，直接返回错误
-		return "", newConversationID, err // SaveMessage 内部已包装错误
+	if err := s.ensureConversation(ctx, userID, conversationID); err != nil {
+		return "", newConversationID, err
 	}
-
-	// 2. 获取对话历史
-	const historyLimit = 10 // 获取最近 10 条消息作为上下文 (应可配置)
-	// Pass userID to GetConversationHistory if it needs user-specific filtering (assuming it might)
-	historyMessages, err := s.chatRepo.GetConversationHistory(ctx, userID, conversationID, historyLimit)
+	persona, err := s.selectPersona(ctx, userID, conversationID, personaID)
 	if err != nil {
-		logger.WarnContext(ctx, "获取对话历史失败，将继续执行", "error", err, "user_id", userID, "conversation_id", conversationID)
-		historyMessages = []*entity.Message{} // 使用空历史
+		return "", newConversationID, err
 	}
-
-	// 2.5 (RAG) 检索相关文档块
-	const ragLimit = 3 // 获取最多 3 个相关块 (应可配置)
-	var ragContextMessage *entity.Message
-	relevantChunks, ragErr := s.ragService.RetrieveRelevantChunks(ctx, userID, message, ragLimit) // Pass userID
-	if ragErr != nil {
-		// RAG 检索失败，记录警告但继续
-		logger.WarnContext(ctx, "RAG 检索相关文档块失败", "error", ragErr, "conversation_id", conversationID)
-	} else if len(relevantChunks) > 0 {
-		// 构建 RAG 上下文消息
-		var contextBuilder strings.Builder
-		contextBuilder.WriteString("Relevant context:\n")
-		for i, chunk := range relevantChunks {
-			// Assuming chunk.DocumentID and chunk.ID are now string
-			contextBuilder.WriteString(fmt.Sprintf("--- Context %d (Doc: %s, Chunk: %s) ---\n", i+1, chunk.DocumentID, chunk.ID))
-			// 可以在这里添加清理或截断 chunk.Content 的逻辑
-			contextBuilder.WriteString(chunk.Content)
-			contextBuilder.WriteString("\n")
-		}
-		// Assuming entity.NewMessage now accepts string IDs
-		ragContextMessage = entity.NewMessage(conversationID, userID, entity.SenderRoleSystem, contextBuilder.String())
-		logger.InfoContext(ctx, "成功检索 RAG 上下文", "chunk_count", len(relevantChunks), "conversation_id", conversationID)
+	settings, err := s.newReplySettings(persona, modelName, opts)
+	if err != nil {
+		return "", newConversationID, err
 	}
 
-	// 准备 LLM 输入 (历史消息 + RAG 上下文 (如果存在) + 当前用户消息)
-	llmInputMessages := make([]*entity.Message, 0, len(historyMessages)+2)
-	llmInputMessages = append(llmInputMessages, historyMessages...)
-	if ragContextMessage != nil {
-		llmInputMessages = append(llmInputMessages, ragContextMessage) // 在用户消息前插入 RAG 上下文
+	// 1. 获取当前分支的对话历史，并将用户消息保存到当前分支的末尾
+	historyMessages, userMessage, err := s.appendUserMessage(ctx, userID, conversationID, message)
+	if err != nil {
+		return "", newConversationID, err
 	}
-	llmInputMessages = append(llmInputMessages, userMessage)
 
-	// 3. 调用 LLM 生成回复
-	logger.InfoContext(ctx, "准备调用 LLM", "conversation_id", conversationID, "message_count", len(llmInputMessages), "model_name", modelName, "with_rag", ragContextMessage != nil) // Log model name and RAG status
-	// 将 modelName 传递给 LLMProvider
-	aiReplyContent, err := s.llmProvider.GenerateContent(ctx, llmInputMessages, modelName)
+	// 2. 调用 LLM 生成回复并保存
+	aiMessage, err := s.generateReply(ctx, userID, conversationID, historyMessages, userMessage, settings, filter)
 	if err != nil {
-		// LLM 调用失败
-		return "", newConversationID, err // GenerateContent 内部已包装错误
+		return "", newConversationID, err
 	}
-	logger.InfoContext(ctx, "LLM 生成回复成功", "conversation_id", conversationID)
-
-	// 4. 保存 AI 回复
-	// Assuming entity.NewMessage now accepts string IDs
-	aiMessage := entity.NewMessage(conversationID, userID, entity.SenderRoleAI, aiReplyContent)
-	if err := s.chatRepo.SaveMessage(ctx, aiMessage); err != nil {
-		// 保存 AI 回复失败，这是一个问题，但用户已经收到了回复
-		// 记录严重错误，但仍然返回成功获取的回复
-		logger.ErrorContext(ctx, "保存 AI 回复失败", "error", err, "conversation_id", conversationID)
-		// 可以考虑返回一个特殊的错误或标记，指示保存失败
+	if len(historyMessages) == 0 {
+		// 这是对话的第一轮交流
+		s.requestAutoTitle(ctx, userID, conversationID, settings.modelName)
 	}
+	s.requestMemoryExtraction(ctx, userID, conversationID, aiMessage.ID, settings.modelName)
 
-	// 5. (未来) 更新对话摘要
+	// 3. (未来) 更新对话摘要
 	// err = s.memoryService.SummarizeAndSave(ctx, conversationID, append(llmInputMessages, aiMessage))
 	// if err != nil { logger.ErrorContext(ctx, "更新对话摘要失败", ...) }
 
-	return aiReplyContent, newConversationID, nil
+	return aiMessage.Content, newConversationID, nil
 }
 
 // HandleStreamChatMessage 处理流式聊天消息。
-func (s *chatServiceImpl) HandleStreamChatMessage(ctx context.Context, userID string, conversationID string, message string, modelName string, streamCh chan<- string) (newConversationID string, err error) {
+func (s *chatServiceImpl) HandleStreamChatMessage(ctx context.Context, userID string, conversationID string, message string, modelName string, personaID string, opts *entity.GenerationOptions, filter *entity.ChunkFilter, streamCh chan<- string) (newConversationID string, err error) {
 	defer close(streamCh) // 确保 channel 在函数退出时关闭
-
-	// userID is now passed as a parameter, remove GetUserIDFromCtx
-	// if err != nil { // Error handling for GetUserIDFromCtx removed
-	// 	// Return empty string for newConversationID as it's now string
-	// 	return "", err
-	// } // Removed the extra closing brace
+	if err := validateGenerationOptions(opts); err != nil {
+		return conversationID, err
+	}
 
 	isNewConversation := (conversationID == "") // Check for empty string for new conversation
 	if isNewConversation {
@@ -148,57 +130,33 @@ func (s *chatServiceImpl) HandleStreamChatMessage(ctx context.Context, userID st
 		logger.InfoContext(ctx, "继续现有对话 (流式)", "user_id", userID, "conversation_id", conversationID)
 	}
 	newConversationID = conversationID
-
-	// 1. 保存用户消息
-	// Assuming entity.NewMessage now accepts string IDs
-	userMessage := entity.NewMessage(conversationID, userID, entity.SenderRoleUser, message)
-	if err := s.chatRepo.SaveMessage(ctx, userMessage); err != nil {
+	if err := s.ensureConversation(ctx, userID, conversationID); err != nil {
 		return newConversationID, err
 	}
-
-	// 2. 获取对话历史
-	const historyLimit = 10 // (应可配置)
-	// Pass userID to GetConversationHistory if it needs user-specific filtering (assuming it might)
-	historyMessages, err := s.chatRepo.GetConversationHistory(ctx, userID, conversationID, historyLimit)
+	persona, err := s.selectPersona(ctx, userID, conversationID, personaID)
 	if err != nil {
-		logger.WarnContext(ctx, "获取对话历史失败 (流式)，将继续执行", "error", err, "user_id", userID, "conversation_id", conversationID)
-		historyMessages = []*entity.Message{}
+		return newConversationID, err
 	}
-
-	// 2.5 (RAG) 检索相关文档块
-	const ragLimitStream = 3 // (应可配置)
-	var ragContextMessageStream *entity.Message
-	relevantChunksStream, ragErrStream := s.ragService.RetrieveRelevantChunks(ctx, userID, message, ragLimitStream) // Pass userID
-	if ragErrStream != nil {
-		logger.WarnContext(ctx, "RAG 检索相关文档块失败 (流式)", "error", ragErrStream, "conversation_id", conversationID)
-	} else if len(relevantChunksStream) > 0 {
-		var contextBuilder strings.Builder
-		contextBuilder.WriteString("Relevant context:\n")
-		for i, chunk := range relevantChunksStream {
-			// Assuming chunk.DocumentID and chunk.ID are now string
-			contextBuilder.WriteString(fmt.Sprintf("--- Context %d (Doc: %s, Chunk: %s) ---\n", i+1, chunk.DocumentID, chunk.ID))
-			contextBuilder.WriteString(chunk.Content)
-			contextBuilder.WriteString("\n")
-		}
-		// Assuming entity.NewMessage now accepts string IDs
-		ragContextMessageStream = entity.NewMessage(conversationID, userID, entity.SenderRoleSystem, contextBuilder.String())
-		logger.InfoContext(ctx, "成功检索 RAG 上下文 (流式)", "chunk_count", len(relevantChunksStream), "conversation_id", conversationID)
+	settings, err := s.newReplySettings(persona, modelName, opts)
+	if err != nil {
+		return newConversationID, err
 	}
 
-	// 准备 LLM 输入 (历史消息 + RAG 上下文 (如果存在) + 当前用户消息)
-	llmInputMessages := make([]*entity.Message, 0, len(historyMessages)+2)
-	llmInputMessages = append(llmInputMessages, historyMessages...)
-	if ragContextMessageStream != nil {
-		llmInputMessages = append(llmInputMessages, ragContextMessageStream)
+	// 1. 获取当前分支的对话历史，并将用户消息保存到当前分支的末尾
+	historyMessages, userMessage, err := s.appendUserMessage(ctx, userID, conversationID, message)
+	if err != nil {
+		return newConversationID, err
 	}
-	llmInputMessages = append(llmInputMessages, userMessage)
+
+	// 2. 准备 LLM 输入 (人设系统提示词 + 历史消息 + RAG 上下文 (如果存在) + 当前用户消息)
+	input := s.buildLLMInput(ctx, userID, conversationID, historyMessages, userMessage, settings.persona, filter)
 
 	// 3. 调用 LLM 流式生成回复
-	logger.InfoContext(ctx, "准备调用 LLM (流式)", "conversation_id", conversationID, "message_count", len(llmInputMessages), "model_name", modelName, "with_rag", ragContextMessageStream != nil) // Log model name and RAG status
+	logger.InfoContext(ctx, "准备调用 LLM (流式)", "conversation_id", conversationID, "message_count", len(input.messages), "model_name", settings.modelName)
 
 	var fullReply strings.Builder // 用于拼接完整回复以保存
 	// 将 modelName 传递给 LLMProvider
-	streamErr := s.llmProvider.GenerateContentStream(ctx, llmInputMessages, modelName, func(chunk string) {
+	streamErr := s.llmProvider.GenerateContentStream(ctx, input.messages, settings.modelName, settings.options, func(chunk string) {
 		// 将块发送到 channel
 		select {
 		case streamCh <- chunk:
@@ -216,14 +174,22 @@ func (s *chatServiceImpl) HandleStreamChatMessage(ctx context.Context, userID st
 	}
 	logger.InfoContext(ctx, "LLM 流式回复完成", "conversation_id", conversationID)
 
-	// 4. 保存完整的 AI 回复
+	// 4. 保存完整的 AI 回复 (作为用户消息的子消息)
 	aiReplyContent := fullReply.String()
 	if aiReplyContent != "" { // 确保有内容才保存
-		// Assuming entity.NewMessage now accepts string IDs
 		aiMessage := entity.NewMessage(conversationID, userID, entity.SenderRoleAI, aiReplyContent)
-		if err := s.chatRepo.SaveMessage(ctx, aiMessage); err != nil {
+		aiMessage.ParentID = &userMessage.ID
+		setReplyMetadata(ctx, aiMessage, input)
+		if err := s.saveMessage(ctx, aiMessage); err != nil {
 			logger.ErrorContext(ctx, "保存 AI 回复失败 (流式)", "error", err, "conversation_id", conversationID)
 			// 记录错误，但不影响流式发送
+		} else {
+			if len(historyMessages) == 0 {
+				s.requestAutoTitle(ctx, userID, conversationID, settings.modelName)
+			}
+			s.requestMemoryExtraction(ctx, userID, conversationID, aiMessage.ID, settings.modelName)
+			s.recordChatTurn(ctx, userMessage, aiMessage)
+			s.publishChatCompleted(ctx, userMessage, aiMessage, settings.modelName)
 		}
 	} else {
 		logger.WarnContext(ctx, "LLM 流式调用未生成任何内容", "conversation_id", conversationID)
@@ -235,6 +201,335 @@ func (s *chatServiceImpl) HandleStreamChatMessage(ctx context.Context, userID st
 	return newConversationID, nil
 }
 
+// RegenerateReply 为 AI 回复生成一个新版本。
+func (s *chatServiceImpl) RegenerateReply(ctx context.Context, userID string, conversationID string, messageID string, modelName string, opts *entity.GenerationOptions) (*entity.Message, error) {
+	if err := validateGenerationOptions(opts); err != nil {
+		return nil, err
+	}
+	original, err := s.getBranchPoint(ctx, userID, conversationID, messageID, entity.SenderRoleAI)
+	if err != nil {
+		return nil, err
+	}
+	if original.ParentID == nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "该回复没有对应的用户消息，无法重新生成")
+	}
+
+	// 上下文为原回复之前的分支 (最后一条是原回复对应的用户消息)
+	branch, err := s.chatRepo.GetMessageBranch(ctx, userID, conversationID, *original.ParentID, chatHistoryLimit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(branch) == 0 {
+		return nil, apperr.ErrNotFound("消息未找到") // 父消息在查询期间被删除
+	}
+	userMessage := branch[len(branch)-1]
+	persona, err := s.resolvePersona(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.newReplySettings(persona, modelName, opts)
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "重新生成 AI 回复", "conversation_id", conversationID, "message_id", messageID)
+	return s.generateReply(ctx, userID, conversationID, branch[:len(branch)-1], userMessage, settings, nil)
+}
+
+// EditMessage 以编辑后的内容创建用户消息的新版本，并为其生成回复。
+func (s *chatServiceImpl) EditMessage(ctx context.Context, userID string, conversationID string, messageID string, content string, modelName string, opts *entity.GenerationOptions) (*entity.Message, *entity.Message, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, nil, apperr.New(apperr.CodeInvalidArgument, "消息内容不能为空")
+	}
+	if err := validateGenerationOptions(opts); err != nil {
+		return nil, nil, err
+	}
+	original, err := s.getBranchPoint(ctx, userID, conversationID, messageID, entity.SenderRoleUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 上下文为原消息之前的分支，新消息与原消息拥有相同的父消息
+	historyMessages := []*entity.Message{}
+	if original.ParentID != nil {
+		if historyMessages, err = s.chatRepo.GetMessageBranch(ctx, userID, conversationID, *original.ParentID, chatHistoryLimit); err != nil {
+			return nil, nil, err
+		}
+	}
+	persona, err := s.resolvePersona(ctx, userID, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, err := s.newReplySettings(persona, modelName, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	userMessage := entity.NewMessage(conversationID, userID, entity.SenderRoleUser, content)
+	userMessage.ParentID = original.ParentID
+	if err := s.saveMessage(ctx, userMessage); err != nil {
+		return nil, nil, err
+	}
+	logger.InfoContext(ctx, "已创建编辑后的用户消息", "conversation_id", conversationID, "message_id", messageID, "new_message_id", userMessage.ID)
+
+	aiMessage, err := s.generateReply(ctx, userID, conversationID, historyMessages, userMessage, settings, nil)
+	if err != nil {
+		return userMessage, nil, err
+	}
+	s.requestMemoryExtraction(ctx, userID, conversationID, aiMessage.ID, settings.modelName)
+	return userMessage, aiMessage, nil
+}
+
+// SelectBranch 切换对话的当前分支。
+func (s *chatServiceImpl) SelectBranch(ctx context.Context, userID string, conversationID string, messageID string) (*entity.Conversation, error) {
+	if err := validateConversationID(conversationID); err != nil {
+		return nil, err
+	}
+	if err := validateMessageID(messageID); err != nil {
+		return nil, err
+	}
+	return s.chatRepo.SetActiveBranch(ctx, userID, conversationID, messageID)
+}
+
+// GetActiveBranchMessages 获取对话当前分支的最近消息。
+func (s *chatServiceImpl) GetActiveBranchMessages(ctx context.Context, userID string, conversationID string, limit int) ([]*entity.Message, error) {
+	if err := validateConversationID(conversationID); err != nil {
+		return nil, err
+	}
+	return s.chatRepo.GetConversationHistory(ctx, userID, conversationID, limit)
+}
+
+// appendUserMessage 获取对话当前分支的历史消息，并将用户消息作为当前分支最后一条消息的子消息保存。
+// 返回的历史消息不包含新保存的用户消息。
+func (s *chatServiceImpl) appendUserMessage(ctx context.Context, userID string, conversationID string, message string) ([]*entity.Message, *entity.Message, error) {
+	// 历史记录决定了新消息在树中的位置，获取失败时不能继续 (否则新消息会成为新的根节点)
+	historyMessages, err := s.chatRepo.GetConversationHistory(ctx, userID, conversationID, chatHistoryLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userMessage := entity.NewMessage(conversationID, userID, entity.SenderRoleUser, message)
+	if len(historyMessages) > 0 {
+		userMessage.ParentID = &historyMessages[len(historyMessages)-1].ID
+	}
+	if err := s.saveMessage(ctx, userMessage); err != nil {
+		return nil, nil, err // saveMessage 内部已包装错误
+	}
+	return historyMessages, userMessage, nil
+}
+
+// llmInput 是一次 LLM 调用的输入消息，以及需要记录在回复元数据中的上下文来源。
+type llmInput struct {
+	messages  []*entity.Message
+	sources   []entity.MessageSource // RAG 检索到的文档块
+	memoryIDs []string               // 注入的结构化记忆
+}
+
+// buildLLMInput 准备 LLM 输入：人设的系统提示词 (如果存在) + 用户记忆 (如果存在) + 历史消息 + RAG 上下文 (如果存在) + 当前用户消息，
+// 同时返回检索到的文档块和注入的记忆作为回复的上下文来源。人设关闭 RAG 时不检索文档。
+// 记忆选择或 RAG 检索失败时只记录警告，不影响回复。
+func (s *chatServiceImpl) buildLLMInput(ctx context.Context, userID string, conversationID string, historyMessages []*entity.Message, userMessage *entity.Message, persona *entity.Persona, filter *entity.ChunkFilter) *llmInput {
+	input := &llmInput{messages: make([]*entity.Message, 0, len(historyMessages)+4)}
+	if persona != nil && persona.SystemPrompt != "" {
+		// 系统提示词始终是第一条消息
+		input.messages = append(input.messages, entity.NewMessage(conversationID, userID, entity.SenderRoleSystem, persona.SystemPrompt))
+	}
+	if memoryMessage := s.buildMemoryContext(ctx, userID, conversationID, userMessage.Content, input); memoryMessage != nil {
+		input.messages = append(input.messages, memoryMessage)
+	}
+	input.messages = append(input.messages, historyMessages...)
+
+	if persona != nil && !persona.RAGEnabled {
+		input.messages = append(input.messages, userMessage)
+		return input
+	}
+	relevantChunks, ragErr := s.ragService.RetrieveFilteredChunks(ctx, userID, userMessage.Content, chatRAGLimit, filter)
+	if ragErr != nil {
+		logger.WarnContext(ctx, "RAG 检索相关文档块失败", "error", ragErr, "conversation_id", conversationID)
+	} else if len(relevantChunks) > 0 {
+		// 构建 RAG 上下文消息，插入在用户消息之前
+		var contextBuilder strings.Builder
+		contextBuilder.WriteString("Relevant context:\n")
+		for i, chunk := range relevantChunks {
+			contextBuilder.WriteString(fmt.Sprintf("--- Context %d (Doc: %s, Chunk: %s) ---\n", i+1, chunk.DocumentID, chunk.ID))
+			// 可以在这里添加清理或截断 chunk.Content 的逻辑
+			contextBuilder.WriteString(chunk.Content)
+			contextBuilder.WriteString("\n")
+			input.sources = append(input.sources, newMessageSource(chunk))
+		}
+		input.messages = append(input.messages, entity.NewMessage(conversationID, userID, entity.SenderRoleSystem, contextBuilder.String()))
+		logger.InfoContext(ctx, "成功检索 RAG 上下文", "chunk_count", len(relevantChunks), "conversation_id", conversationID)
+	}
+
+	input.messages = append(input.messages, userMessage)
+	return input
+}
+
+// buildMemoryContext 选择与用户消息相关的结构化记忆，返回包含这些记忆的系统消息，并将记忆 ID 记录到 input。
+// 没有可注入的记忆时返回 nil。
+func (s *chatServiceImpl) buildMemoryContext(ctx context.Context, userID string, conversationID string, query string, input *llmInput) *entity.Message {
+	if s.memories == nil {
+		return nil
+	}
+	memories, err := s.memories.SelectMemories(ctx, userID, query)
+	if err != nil {
+		logger.WarnContext(ctx, "选择用户记忆失败", "error", err, "conversation_id", conversationID)
+		return nil
+	}
+	if len(memories) == 0 {
+		return nil
+	}
+	var memoryBuilder strings.Builder
+	memoryBuilder.WriteString("Known facts about the user (saved by the user; use them when relevant):\n")
+	for _, m := range memories {
+		memoryBuilder.WriteString("- ")
+		memoryBuilder.WriteString(formatMemory(m))
+		memoryBuilder.WriteString("\n")
+		input.memoryIDs = append(input.memoryIDs, m.ID)
+	}
+	logger.InfoContext(ctx, "已注入用户记忆", "memory_count", len(memories), "conversation_id", conversationID)
+	return entity.NewMessage(conversationID, userID, entity.SenderRoleSystem, memoryBuilder.String())
+}
+
+// sourceExcerptRunes 是引用来源中保存的块内容摘录的最大字符数。
+const sourceExcerptRunes = 200
+
+// newMessageSource 根据检索到的文档块创建引用来源。
+func newMessageSource(chunk *entity.DocumentChunk) entity.MessageSource {
+	source := entity.MessageSource{
+		DocumentID: chunk.DocumentID,
+		ChunkID:    chunk.ID,
+		Excerpt:    truncateRunes(strings.TrimSpace(chunk.Content), sourceExcerptRunes),
+	}
+	// 元数据从 JSON 解析时数字为 float64
+	switch page := chunk.Metadata[entity.ChunkMetaPageNumber].(type) {
+	case int:
+		source.PageNumber = page
+	case float64:
+		source.PageNumber = int(page)
+	}
+	return source
+}
+
+// setReplyMetadata 将引用来源和注入的记忆 ID 写入 AI 回复的元数据。元数据不是必需的，写入失败只记录日志。
+func setReplyMetadata(ctx context.Context, message *entity.Message, input *llmInput) {
+	metadata := map[string]interface{}{}
+	if len(input.sources) > 0 {
+		metadata[entity.MessageMetaSources] = input.sources
+	}
+	if len(input.memoryIDs) > 0 {
+		metadata[entity.MessageMetaMemoryIDs] = input.memoryIDs
+	}
+	if len(metadata) == 0 {
+		return
+	}
+	if err := message.SetMetadata(metadata); err != nil {
+		logger.WarnContext(ctx, "记录回复的上下文来源失败", "error", err, "message_id", message.ID)
+	}
+}
+
+// generateReply 调用 LLM 为 userMessage 生成回复，并将回复作为 userMessage 的子消息保存。
+// 保存回复失败时只记录错误，仍然返回生成的回复 (用户已经可以看到回复)。
+func (s *chatServiceImpl) generateReply(ctx context.Context, userID string, conversationID string, historyMessages []*entity.Message, userMessage *entity.Message, settings *replySettings, filter *entity.ChunkFilter) (*entity.Message, error) {
+	input := s.buildLLMInput(ctx, userID, conversationID, historyMessages, userMessage, settings.persona, filter)
+
+	logger.InfoContext(ctx, "准备调用 LLM", "conversation_id", conversationID, "message_count", len(input.messages), "model_name", settings.modelName)
+	// 将 modelName 传递给 LLMProvider
+	aiReplyContent, err := s.llmProvider.GenerateContent(ctx, input.messages, settings.modelName, settings.options)
+	if err != nil {
+		return nil, err // GenerateContent 内部已包装错误
+	}
+	logger.InfoContext(ctx, "LLM 生成回复成功", "conversation_id", conversationID)
+
+	aiMessage := entity.NewMessage(conversationID, userID, entity.SenderRoleAI, aiReplyContent)
+	aiMessage.ParentID = &userMessage.ID
+	setReplyMetadata(ctx, aiMessage, input)
+	if err := s.saveMessage(ctx, aiMessage); err != nil {
+		// 保存 AI 回复失败，这是一个问题，但用户已经收到了回复
+		logger.ErrorContext(ctx, "保存 AI 回复失败", "error", err, "conversation_id", conversationID)
+	} else {
+		s.recordChatTurn(ctx, userMessage, aiMessage)
+		s.publishChatCompleted(ctx, userMessage, aiMessage, settings.modelName)
+	}
+	return aiMessage, nil
+}
+
+// selectPersona 返回本次回复使用的人设。personaID 不为空时先校验人设属于该用户，
+// 并将其保存为对话的人设 (之后的消息沿用)；否则使用对话已选择的人设或用户的默认人设。
+func (s *chatServiceImpl) selectPersona(ctx context.Context, userID string, conversationID string, personaID string) (*entity.Persona, error) {
+	if personaID == "" {
+		return s.resolvePersona(ctx, userID, conversationID)
+	}
+	if s.personas == nil {
+		return nil, apperr.New(apperr.CodeUnavailable, "人设服务不可用")
+	}
+	persona, err := s.personas.GetPersona(ctx, userID, personaID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.chatRepo.UpdateConversation(ctx, userID, conversationID, &entity.ConversationUpdate{PersonaID: &persona.ID}); err != nil {
+		return nil, err
+	}
+	return persona, nil
+}
+
+// resolvePersona 返回对话当前使用的人设，没有人设 (或人设服务未配置) 时返回 nil。
+func (s *chatServiceImpl) resolvePersona(ctx context.Context, userID string, conversationID string) (*entity.Persona, error) {
+	if s.personas == nil {
+		return nil, nil
+	}
+	return s.personas.ResolvePersona(ctx, userID, conversationID)
+}
+
+// resolveModelName 确定要使用的模型：请求指定的模型优先，其次是人设的默认模型，都为空时由 LLMProvider 使用默认模型。
+func resolveModelName(modelName string, persona *entity.Persona) string {
+	if modelName == "" && persona != nil {
+		return persona.ModelName
+	}
+	return modelName
+}
+
+// replySettings 是生成一条回复使用的人设、模型和生成参数。
+type replySettings struct {
+	persona   *entity.Persona           // 为 nil 时不发送系统提示词
+	modelName string                    // 为空时由 LLMProvider 使用默认模型
+	options   *entity.GenerationOptions // 请求的生成参数与人设默认值合并后的结果
+}
+
+// newReplySettings 确定回复使用的模型和生成参数，并检查生成参数是否在该模型的限制之内。
+// 必须在保存用户消息之前调用，避免参数无效时留下没有回复的消息。
+func (s *chatServiceImpl) newReplySettings(persona *entity.Persona, modelName string, opts *entity.GenerationOptions) (*replySettings, error) {
+	settings := &replySettings{
+		persona:   persona,
+		modelName: resolveModelName(modelName, persona),
+		options:   mergeGenerationOptions(persona, opts),
+	}
+	if err := s.llmProvider.ValidateGenerationOptions(settings.modelName, settings.options); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// getBranchPoint 校验 ID 并获取要编辑或重新生成的消息，消息的角色必须为 role。
+func (s *chatServiceImpl) getBranchPoint(ctx context.Context, userID string, conversationID string, messageID string, role entity.SenderRole) (*entity.Message, error) {
+	if err := validateConversationID(conversationID); err != nil {
+		return nil, err
+	}
+	if err := validateMessageID(messageID); err != nil {
+		return nil, err
+	}
+	msg, err := s.chatRepo.GetMessage(ctx, userID, conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderRole != role {
+		if role == entity.SenderRoleAI {
+			return nil, apperr.New(apperr.CodeInvalidArgument, "只能重新生成 AI 回复")
+		}
+		return nil, apperr.New(apperr.CodeInvalidArgument, "只能编辑用户消息")
+	}
+	return msg, nil
+}
+
 // GetConversationMessages 获取对话消息列表。
 func (s *chatServiceImpl) GetConversationMessages(ctx context.Context, userID string, conversationID string, limit int, offset int) ([]*entity.Message, error) {
 	// Pass userID explicitly to the repository layer for filtering
@@ -247,13 +542,145 @@ func (s *chatServiceImpl) GetConversationMessages(ctx context.Context, userID st
 	return messages, nil
 }
 
-// GetUserConversations 获取指定用户的所有对话基本信息。
-func (s *chatServiceImpl) GetUserConversations(ctx context.Context, userID string) ([]*entity.Conversation, error) {
-	// 直接调用 repository 层的方法
-	conversations, err := s.chatRepo.GetUserConversations(ctx, userID)
-	if err != nil {
-		// 错误已在 repository 层记录和包装
+// GetUserConversations 分页获取指定用户的对话。
+func (s *chatServiceImpl) GetUserConversations(ctx context.Context, userID string, filter *entity.ConversationFilter, limit int, offset int) ([]*entity.Conversation, int, error) {
+	// 错误已在 repository 层记录和包装
+	return s.chatRepo.GetUserConversations(ctx, userID, filter, limit, offset)
+}
+
+// GetConversation 获取指定用户的单个对话。
+func (s *chatServiceImpl) GetConversation(ctx context.Context, userID string, conversationID string) (*entity.Conversation, error) {
+	if err := validateConversationID(conversationID); err != nil {
+		return nil, err
+	}
+	return s.chatRepo.GetConversation(ctx, userID, conversationID)
+}
+
+// UpdateConversation 校验并更新对话的标题、归档、置顶状态和人设。
+func (s *chatServiceImpl) UpdateConversation(ctx context.Context, userID string, conversationID string, update *entity.ConversationUpdate) (*entity.Conversation, error) {
+	if err := validateConversationID(conversationID); err != nil {
 		return nil, err
 	}
-	return conversations, nil
+	if update == nil || update.IsEmpty() {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "至少需要提供 title、archived、pinned 或 persona_id 中的一个字段")
+	}
+	if update.Title != nil {
+		title := strings.TrimSpace(*update.Title)
+		if utf8.RuneCountInString(title) > entity.MaxConversationTitleLength {
+			return nil, apperr.New(apperr.CodeValidation, fmt.Sprintf("对话标题不能超过 %d 个字符", entity.MaxConversationTitleLength))
+		}
+		update.Title = &title
+	}
+	if update.PersonaID != nil && *update.PersonaID != "" {
+		// 人设必须属于该用户 (空字符串表示恢复为使用默认人设)
+		if s.personas == nil {
+			return nil, apperr.New(apperr.CodeUnavailable, "人设服务不可用")
+		}
+		if _, err := s.personas.GetPersona(ctx, userID, *update.PersonaID); err != nil {
+			return nil, err
+		}
+	}
+	return s.chatRepo.UpdateConversation(ctx, userID, conversationID, update)
+}
+
+// DeleteConversation 删除对话及其所有消息。
+func (s *chatServiceImpl) DeleteConversation(ctx context.Context, userID string, conversationID string) error {
+	if err := validateConversationID(conversationID); err != nil {
+		return err
+	}
+	return s.chatRepo.DeleteConversation(ctx, userID, conversationID)
+}
+
+// RegenerateConversationTitle 重新生成对话标题。
+func (s *chatServiceImpl) RegenerateConversationTitle(ctx context.Context, userID string, conversationID string) (string, error) {
+	if s.titler == nil {
+		return "", apperr.New(apperr.CodeUnavailable, "对话标题生成服务不可用")
+	}
+	conv, err := s.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		return "", err
+	}
+	if conv.TitleSource == entity.ConversationTitleSourceUser {
+		return "", apperr.New(apperr.CodeConflict, "对话标题由用户设置，不能自动重新生成；请先清空标题")
+	}
+	return s.titler.RequestTitle(ctx, userID, conversationID, "", true)
+}
+
+// saveMessage 保存消息并更新消息的搜索索引。索引不是必需的，更新失败只记录日志。
+func (s *chatServiceImpl) saveMessage(ctx context.Context, message *entity.Message) error {
+	if err := s.chatRepo.SaveMessage(ctx, message); err != nil {
+		return err
+	}
+	if s.indexer != nil {
+		if err := s.indexer.IndexMessage(ctx, message); err != nil {
+			logger.WarnContext(ctx, "更新消息搜索索引失败", "error", err, "message_id", message.ID)
+		}
+	}
+	return nil
+}
+
+// requestAutoTitle 在对话的第一轮交流后请求自动生成标题。
+// 标题不是必需的，入队失败只记录日志，不影响聊天请求。
+func (s *chatServiceImpl) requestAutoTitle(ctx context.Context, userID string, conversationID string, modelName string) {
+	if s.titler == nil {
+		return
+	}
+	if _, err := s.titler.RequestTitle(ctx, userID, conversationID, modelName, false); err != nil {
+		logger.WarnContext(ctx, "请求自动生成对话标题失败", "error", err, "conversation_id", conversationID)
+	}
+}
+
+// requestMemoryExtraction 在一轮交流后请求从对话中提取用户记忆 (是否入队由提取间隔决定)。
+// 与标题相同，入队失败只记录日志，不影响聊天请求。
+func (s *chatServiceImpl) requestMemoryExtraction(ctx context.Context, userID string, conversationID string, messageID string, modelName string) {
+	if s.extractor == nil {
+		return
+	}
+	if _, err := s.extractor.RequestExtraction(ctx, userID, conversationID, messageID, modelName); err != nil {
+		logger.WarnContext(ctx, "请求提取用户记忆失败", "error", err, "conversation_id", conversationID)
+	}
+}
+
+// recordChatTurn 将一轮交流记录到图记忆。图记忆不影响回复，记录失败只记录日志。
+func (s *chatServiceImpl) recordChatTurn(ctx context.Context, userMessage *entity.Message, aiMessage *entity.Message) {
+	if s.graph == nil {
+		return
+	}
+	if err := s.graph.RecordChatTurn(ctx, userMessage, aiMessage); err != nil {
+		logger.WarnContext(ctx, "记录对话到图记忆失败", "error", err, "conversation_id", aiMessage.ConversationID, "message_id", aiMessage.ID)
+	}
+}
+
+// publishChatCompleted 发布 dreamhub.chat.completed 事件，subject 为对话 ID。
+func (s *chatServiceImpl) publishChatCompleted(ctx context.Context, userMessage *entity.Message, aiMessage *entity.Message, modelName string) {
+	publishSystemEvent(ctx, s.events, aiMessage.UserID, entity.EventTypeChatCompleted, aiMessage.ConversationID, &entity.ChatCompletedEventData{
+		ConversationID: aiMessage.ConversationID,
+		UserMessageID:  userMessage.ID,
+		MessageID:      aiMessage.ID,
+		ModelName:      modelName,
+	})
+}
+
+// ensureConversation 校验客户端传入的对话 ID，并在保存消息前确保对话记录存在且属于该用户。
+func (s *chatServiceImpl) ensureConversation(ctx context.Context, userID string, conversationID string) error {
+	if err := validateConversationID(conversationID); err != nil {
+		return err
+	}
+	return s.chatRepo.EnsureConversation(ctx, userID, conversationID)
+}
+
+// validateMessageID 检查消息 ID 是否为合法的 UUID。
+func validateMessageID(messageID string) error {
+	if _, err := uuid.Parse(messageID); err != nil {
+		return apperr.New(apperr.CodeInvalidArgument, "无效的消息 ID").WithDetails("message_id=" + messageID)
+	}
+	return nil
+}
+
+// validateConversationID 检查对话 ID 是否为合法的 UUID (conversations.id 为 UUID 类型)。
+func validateConversationID(conversationID string) error {
+	if _, err := uuid.Parse(conversationID); err != nil {
+		return apperr.New(apperr.CodeInvalidArgument, "无效的对话 ID").WithDetails("conversation_id=" + conversationID)
+	}
+	return nil
 }
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// chatGPTImportSource 是导入报告中 ChatGPT 导入的来源名称。
+const chatGPTImportSource = "chatgpt"
+
+// chatGPTConversationsFile 是 ChatGPT 导出压缩包中包含对话的文件名。
+const chatGPTConversationsFile = "conversations.json"
+
+// chatGPTImportNamespace 是由 ChatGPT 中的 ID 生成对话和消息 UUID 的命名空间。
+// 同一用户重复导入同一对话时得到相同的 ID，因此导入可以安全地重试。
+var chatGPTImportNamespace = uuid.MustParse("6f1c7c1e-3f0a-4d51-9b8e-2a7c0d5e4b13")
+
+// chatGPTConversation 是 ChatGPT conversations.json 中的一个对话。
+// 消息以树的形式保存在 mapping 中 (编辑和重新生成会产生分支)，current_node 是当前显示的分支的最后一个节点。
+type chatGPTConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	Mapping        map[string]chatGPTNode `json:"mapping"`
+	CurrentNode    string                 `json:"current_node"`
+}
+
+// chatGPTNode 是对话树中的一个节点，根节点和部分系统节点没有消息。
+type chatGPTNode struct {
+	ID       string          `json:"id"`
+	Message  *chatGPTMessage `json:"message"`
+	Parent   string          `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+// chatGPTMessage 是节点中的消息。parts 中除文本外还可能有图片等对象，只导入文本。
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+	Metadata struct {
+		IsVisuallyHidden bool `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+// ImportChatGPT 实现 ConversationTransferService 接口。
+func (s *conversationTransferServiceImpl) ImportChatGPT(ctx context.Context, payload *entity.ConversationImportTaskPayload) (*entity.ConversationImportReport, error) {
+	reader, err := s.fileStorage.GetFileReader(ctx, payload.StoredPath)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			return nil, apperr.New(apperr.CodeValidation, "导入文件不存在").WithDetails("stored_path=" + payload.StoredPath)
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	report := &entity.ConversationImportReport{Source: chatGPTImportSource}
+	err = withChatGPTConversations(reader, func(conv *chatGPTConversation) error {
+		return s.importChatGPTConversation(ctx, payload.UserID, conv, report)
+	})
+	if err != nil && !apperr.Is(err, apperr.CodeValidation) {
+		return nil, err // 临时性错误，保留文件以便重试
+	}
+	s.discardImportFile(ctx, payload.StoredPath)
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "ChatGPT 对话导入完成", "user_id", payload.UserID,
+		"conversations_imported", report.ConversationsImported, "conversations_skipped", report.ConversationsSkipped,
+		"messages_imported", report.MessagesImported, "errors", len(report.Errors))
+	return report, nil
+}
+
+// randomAccessReader 是可以随机访问的文件内容，例如本地文件或加密存储返回的可随机访问的解密 reader。
+type randomAccessReader interface {
+	io.ReaderAt
+	io.ReadSeeker
+}
+
+// withChatGPTConversations 逐个解析 ChatGPT 导出中的对话并调用 fn，不会一次性将整个文件读入内存。
+// 文件可以是 conversations.json，也可以是包含它的 zip 压缩包 (ChatGPT 导出的原始文件)。
+// zip 需要随机访问，直接读取存储返回的 reader；解密后的内容不会写入临时文件。
+func withChatGPTConversations(reader io.Reader, fn func(conv *chatGPTConversation) error) error {
+	ra, seekable := reader.(randomAccessReader)
+	if !seekable {
+		buffered := bufio.NewReader(reader)
+		if head, _ := buffered.Peek(4); bytes.Equal(head, zipMagic) {
+			return apperr.New(apperr.CodeValidation, "文件存储不支持随机访问，无法读取 zip 压缩包").
+				WithDetails("请上传解压后的 " + chatGPTConversationsFile)
+		}
+		return decodeChatGPTConversations(buffered, fn)
+	}
+
+	head := make([]byte, len(zipMagic))
+	if n, _ := ra.ReadAt(head, 0); n < len(zipMagic) || !bytes.Equal(head, zipMagic) {
+		if _, err := ra.Seek(0, io.SeekStart); err != nil {
+			return apperr.Wrap(err, apperr.CodeInternal, "无法读取导入文件")
+		}
+		return decodeChatGPTConversations(bufio.NewReader(ra), fn)
+	}
+	size, err := ra.Seek(0, io.SeekEnd)
+	if err != nil {
+		return apperr.Wrap(err, apperr.CodeInternal, "无法读取导入文件")
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return apperr.Wrap(err, apperr.CodeValidation, "无法解析 zip 压缩包")
+	}
+	for _, file := range zr.File {
+		if path.Base(file.Name) != chatGPTConversationsFile {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return apperr.Wrap(err, apperr.CodeValidation, "无法读取压缩包中的 "+chatGPTConversationsFile)
+		}
+		defer rc.Close()
+		return decodeChatGPTConversations(rc, fn)
+	}
+	return apperr.New(apperr.CodeValidation, "压缩包中没有 "+chatGPTConversationsFile)
+}
+
+// zipMagic 是 zip 文件 (本地文件头) 的开头。
+var zipMagic = []byte("PK\x03\x04")
+
+// decodeChatGPTConversations 流式解析 conversations.json 顶层的对话数组。
+func decodeChatGPTConversations(r io.Reader, fn func(conv *chatGPTConversation) error) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return apperr.New(apperr.CodeValidation, "不是有效的 ChatGPT 导出文件").WithDetails("conversations.json 应为对话数组")
+	}
+	for dec.More() {
+		var conv chatGPTConversation
+		if err := dec.Decode(&conv); err != nil {
+			return apperr.Wrap(err, apperr.CodeValidation, "不是有效的 ChatGPT 导出文件")
+		}
+		if err := fn(&conv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importChatGPTConversation 导入一个对话。对话已经存在时只补全缺少的消息 (上次导入中断或重复导入)。
+// 对话本身的问题 (缺少 ID、ID 与其他用户冲突) 记录在报告中，不影响其他对话；数据库错误中止导入。
+func (s *conversationTransferServiceImpl) importChatGPTConversation(ctx context.Context, userID string, source *chatGPTConversation, report *entity.ConversationImportReport) error {
+	sourceID := source.ConversationID
+	if sourceID == "" {
+		sourceID = source.ID
+	}
+	if sourceID == "" {
+		report.Errors = append(report.Errors, fmt.Sprintf("对话 %q 缺少 ID，已跳过", source.Title))
+		return nil
+	}
+
+	messages := convertChatGPTMessages(userID, sourceID, source)
+	if len(messages) == 0 {
+		report.ConversationsSkipped++
+		return nil
+	}
+
+	conv := &entity.Conversation{
+		ID:          chatGPTImportID(userID, sourceID).String(),
+		UserID:      userID,
+		Title:       truncateRunes(strings.TrimSpace(source.Title), entity.MaxConversationTitleLength),
+		TitleSource: entity.ConversationTitleSourceNone,
+		CreatedAt:   chatGPTTime(source.CreateTime, messages[0].Timestamp),
+	}
+	if conv.Title != "" {
+		conv.TitleSource = entity.ConversationTitleSourceAuto // ChatGPT 的标题是自动生成的，允许重新生成
+	}
+	created, err := s.chatRepo.CreateConversation(ctx, conv)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	if !created {
+		// ID 包含用户 ID，对话属于其他用户的情况只可能是 UUID 冲突
+		if _, err := s.chatRepo.GetConversation(ctx, userID, conv.ID); err != nil {
+			if apperr.Is(err, apperr.CodeNotFound) {
+				report.Errors = append(report.Errors, fmt.Sprintf("对话 %q 的 ID 冲突，已跳过", source.Title))
+				return nil
+			}
+			return err
+		}
+		saved, err := s.listAllMessages(ctx, userID, conv.ID)
+		if err != nil {
+			return err
+		}
+		for _, msg := range saved {
+			existing[msg.ID] = true
+		}
+	}
+
+	imported := 0
+	for _, msg := range messages {
+		if existing[msg.ID] {
+			continue
+		}
+		if err := s.chatRepo.SaveMessage(ctx, msg); err != nil {
+			return err
+		}
+		if s.indexer != nil {
+			if err := s.indexer.IndexMessage(ctx, msg); err != nil {
+				logger.WarnContext(ctx, "更新导入消息的搜索索引失败", "error", err, "message_id", msg.ID)
+			}
+		}
+		imported++
+	}
+	if imported == 0 {
+		report.ConversationsSkipped++
+		return nil
+	}
+
+	// SaveMessage 将最后保存的消息设为当前分支，恢复 ChatGPT 中当前显示的分支
+	if leaf := chatGPTCurrentLeaf(userID, sourceID, source, messages); leaf != "" {
+		if _, err := s.chatRepo.SetActiveBranch(ctx, userID, conv.ID, leaf); err != nil {
+			return err
+		}
+	}
+	report.ConversationsImported++
+	report.MessagesImported += imported
+	return nil
+}
+
+// convertChatGPTMessages 按深度优先顺序 (父消息总在子消息之前) 将对话树转换为消息。
+// 只导入用户和助手的文本消息；跳过的节点 (根节点、系统提示、工具调用等) 的子消息挂到最近的已导入祖先下。
+// 消息时间不早于父消息，保证子树中最新的消息是叶子节点。
+func convertChatGPTMessages(userID string, sourceID string, source *chatGPTConversation) []*entity.Message {
+	type frame struct {
+		nodeID string
+		parent *entity.Message // 最近的已导入祖先
+	}
+	stack := make([]frame, 0)
+	// 根节点按 mapping 中的父子关系确定，按 ID 倒序入栈以获得稳定的顺序
+	roots := make([]string, 0)
+	for id, node := range source.Mapping {
+		if _, ok := source.Mapping[node.Parent]; node.Parent == "" || !ok {
+			roots = append(roots, id)
+		}
+	}
+	sort.Strings(roots)
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, frame{nodeID: roots[i]})
+	}
+
+	fallback := chatGPTTime(source.CreateTime, time.Now())
+	messages := make([]*entity.Message, 0)
+	visited := make(map[string]bool)
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[top.nodeID] {
+			continue // 防御格式错误的文件中的环
+		}
+		visited[top.nodeID] = true
+		node := source.Mapping[top.nodeID]
+
+		parent := top.parent
+		if msg := convertChatGPTMessage(userID, sourceID, top.nodeID, node.Message); msg != nil {
+			after := fallback
+			if parent != nil {
+				after = parent.Timestamp
+			}
+			if node.Message.CreateTime == nil || msg.Timestamp.Before(after) {
+				msg.Timestamp = after
+			}
+			if parent != nil {
+				msg.ParentID = &parent.ID
+			}
+			messages = append(messages, msg)
+			parent = msg
+		}
+		for i := len(node.Children) - 1; i >= 0; i-- {
+			if _, ok := source.Mapping[node.Children[i]]; ok {
+				stack = append(stack, frame{nodeID: node.Children[i], parent: parent})
+			}
+		}
+	}
+	return messages
+}
+
+// convertChatGPTMessage 将节点中的消息转换为 Message，不需要导入的消息返回 nil。
+func convertChatGPTMessage(userID string, sourceID string, nodeID string, source *chatGPTMessage) *entity.Message {
+	if source == nil || source.Metadata.IsVisuallyHidden {
+		return nil
+	}
+	var role entity.SenderRole
+	switch source.Author.Role {
+	case "user":
+		role = entity.SenderRoleUser
+	case "assistant":
+		role = entity.SenderRoleAI
+	default:
+		return nil
+	}
+	if source.Content.ContentType != "text" && source.Content.ContentType != "multimodal_text" {
+		return nil
+	}
+	texts := make([]string, 0, len(source.Content.Parts))
+	for _, part := range source.Content.Parts {
+		var text string
+		if err := json.Unmarshal(part, &text); err == nil && strings.TrimSpace(text) != "" {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+
+	conversationID := chatGPTImportID(userID, sourceID).String()
+	msg := entity.NewMessage(conversationID, userID, role, strings.Join(texts, "\n\n"))
+	msg.ID = chatGPTImportID(userID, sourceID+":"+nodeID).String()
+	if source.CreateTime != nil {
+		msg.Timestamp = chatGPTTime(*source.CreateTime, msg.Timestamp)
+	}
+	return msg
+}
+
+// chatGPTCurrentLeaf 返回 current_node 对应的已导入消息 ID。current_node 本身没有被导入时 (例如以工具调用结尾)，
+// 沿父节点向上查找最近的已导入消息。找不到时返回空字符串。
+func chatGPTCurrentLeaf(userID string, sourceID string, source *chatGPTConversation, messages []*entity.Message) string {
+	imported := make(map[string]bool, len(messages))
+	for _, msg := range messages {
+		imported[msg.ID] = true
+	}
+	seen := make(map[string]bool)
+	for nodeID := source.CurrentNode; nodeID != "" && !seen[nodeID]; nodeID = source.Mapping[nodeID].Parent {
+		seen[nodeID] = true
+		if id := chatGPTImportID(userID, sourceID+":"+nodeID).String(); imported[id] {
+			return id
+		}
+	}
+	return ""
+}
+
+// chatGPTImportID 由用户 ID 和 ChatGPT 中的 ID 生成确定的 UUID。
+func chatGPTImportID(userID string, sourceID string) uuid.UUID {
+	return uuid.NewSHA1(chatGPTImportNamespace, []byte(userID+":"+sourceID))
+}
+
+// chatGPTTime 将 ChatGPT 的 Unix 时间戳 (秒，带小数) 转换为 time.Time，无效时返回 fallback。
+func chatGPTTime(seconds float64, fallback time.Time) time.Time {
+	if seconds <= 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return fallback
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
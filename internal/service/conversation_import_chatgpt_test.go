@@ -0,0 +1,90 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+const testChatGPTExport = `[
+	{"id": "c1", "title": "First", "mapping": {}},
+	{"conversation_id": "c2", "title": "Second", "mapping": {}}
+]`
+
+// collectChatGPTTitles 读取导出文件并返回对话标题。
+func collectChatGPTTitles(t *testing.T, r io.Reader) ([]string, error) {
+	t.Helper()
+	var titles []string
+	err := withChatGPTConversations(r, func(conv *chatGPTConversation) error {
+		titles = append(titles, conv.Title)
+		return nil
+	})
+	return titles, err
+}
+
+// zipChatGPTExport 返回包含 name 文件的 zip 压缩包。
+func zipChatGPTExport(t *testing.T, name string, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// streamOnly 隐藏底层 reader 的 ReaderAt 和 Seeker，模拟只能顺序读取的存储。
+type streamOnly struct{ io.Reader }
+
+func TestWithChatGPTConversations(t *testing.T) {
+	zipped := zipChatGPTExport(t, "export/conversations.json", testChatGPTExport)
+	tests := []struct {
+		name   string
+		reader io.Reader
+	}{
+		{"json stream", streamOnly{bytes.NewReader([]byte(testChatGPTExport))}},
+		{"json random access", bytes.NewReader([]byte(testChatGPTExport))},
+		{"zip random access", bytes.NewReader(zipped)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			titles, err := collectChatGPTTitles(t, tt.reader)
+			if err != nil {
+				t.Fatalf("withChatGPTConversations() error = %v", err)
+			}
+			if len(titles) != 2 || titles[0] != "First" || titles[1] != "Second" {
+				t.Errorf("titles = %v, want [First Second]", titles)
+			}
+		})
+	}
+}
+
+func TestWithChatGPTConversationsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader io.Reader
+	}{
+		{"zip without random access", streamOnly{bytes.NewReader(zipChatGPTExport(t, "conversations.json", testChatGPTExport))}},
+		{"zip without conversations", bytes.NewReader(zipChatGPTExport(t, "user.json", "{}"))},
+		{"not an array", bytes.NewReader([]byte(`{"conversations": []}`))},
+		{"truncated", bytes.NewReader([]byte(`[{"id": "c1", "title": `))},
+		{"empty", bytes.NewReader(nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := collectChatGPTTitles(t, tt.reader); !apperr.Is(err, apperr.CodeValidation) {
+				t.Errorf("withChatGPTConversations() error = %v, want code %s", err, apperr.CodeValidation)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// ConversationTitleService 定义了为对话自动生成标题的接口。
+// 标题在后台任务中由 LLM 生成，不会覆盖用户手动设置的标题。
+type ConversationTitleService interface {
+	// RequestTitle 将生成标题的任务放入队列，返回任务 ID。
+	// force 为 true 时替换已有的自动标题 (用于重新生成)，否则只为尚无标题的对话生成。
+	RequestTitle(ctx context.Context, userID string, conversationID string, modelName string, force bool) (taskID string, err error)
+
+	// GenerateTitle 根据对话的前几条消息调用 LLM 生成标题并保存 (由 Worker 调用)。
+	// 返回生成的标题以及标题是否被保存 (对话已有用户设置的标题时不保存)。
+	GenerateTitle(ctx context.Context, payload *entity.ConversationTitleTaskPayload) (title string, updated bool, err error)
+}
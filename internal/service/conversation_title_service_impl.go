@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// titleSourceMessageLimit 是生成标题时读取的对话开头消息数量。
+	titleSourceMessageLimit = 4
+	// titleBranchMaxMessages 是生成标题时从当前分支末尾向上回溯的最大消息数。
+	// 分支更长时，标题基于回溯范围内最早的几条消息。
+	titleBranchMaxMessages = 1000
+	// titleSourceMessageMaxRunes 是每条消息传给 LLM 的最大字符数，避免长消息浪费 token。
+	titleSourceMessageMaxRunes = 1000
+	// maxGeneratedTitleRunes 是自动生成标题的最大字符数。
+	maxGeneratedTitleRunes = 80
+)
+
+// titleSystemPrompt 是生成对话标题时使用的系统提示词。
+const titleSystemPrompt = `You generate titles for chat conversations.
+Read the conversation below and reply with a concise title (at most 8 words) that summarizes its topic.
+Write the title in the same language the user writes in.
+Reply with the title only: no quotes, no trailing punctuation, no explanations.`
+
+// Ensure conversationTitleServiceImpl implements ConversationTitleService interface.
+var _ ConversationTitleService = (*conversationTitleServiceImpl)(nil)
+
+// conversationTitleServiceImpl 是 ConversationTitleService 接口的实现。
+type conversationTitleServiceImpl struct {
+	chatRepo    repository.ChatRepository
+	llmProvider LLMProvider
+	taskQueue   TaskQueueClient
+}
+
+// NewConversationTitleService 创建一个新的 conversationTitleServiceImpl 实例。
+// 只负责入队的 API 服务可以传入 nil 的 llm，只负责生成的 Worker 可以传入 nil 的 taskQueue。
+func NewConversationTitleService(chatRepo repository.ChatRepository, llm LLMProvider, taskQueue TaskQueueClient) ConversationTitleService {
+	return &conversationTitleServiceImpl{
+		chatRepo:    chatRepo,
+		llmProvider: llm,
+		taskQueue:   taskQueue,
+	}
+}
+
+// RequestTitle 将生成标题的任务放入队列。
+func (s *conversationTitleServiceImpl) RequestTitle(ctx context.Context, userID string, conversationID string, modelName string, force bool) (string, error) {
+	if s.taskQueue == nil {
+		return "", apperr.New(apperr.CodeUnavailable, "任务队列不可用，无法生成对话标题")
+	}
+	payload := &entity.ConversationTitleTaskPayload{
+		UserID:         userID,
+		ConversationID: conversationID,
+		ModelName:      modelName,
+		Force:          force,
+	}
+	taskID, err := s.taskQueue.EnqueueConversationTitleTask(ctx, payload)
+	if err != nil {
+		return "", err // 内部已记录日志和包装错误
+	}
+	logger.InfoContext(ctx, "生成对话标题任务已入队", "task_id", taskID, "conversation_id", conversationID, "force", force)
+	return taskID, nil
+}
+
+// GenerateTitle 调用 LLM 生成标题并保存。
+func (s *conversationTitleServiceImpl) GenerateTitle(ctx context.Context, payload *entity.ConversationTitleTaskPayload) (string, bool, error) {
+	if s.llmProvider == nil {
+		return "", false, apperr.New(apperr.CodeUnavailable, "LLM 服务不可用，无法生成对话标题")
+	}
+
+	conv, err := s.chatRepo.GetConversation(ctx, payload.UserID, payload.ConversationID)
+	if err != nil {
+		return "", false, err
+	}
+	// 提前检查，避免为不会被保存的标题调用 LLM；最终以 SetGeneratedTitle 的条件更新为准
+	if !titleReplaceable(conv.TitleSource, payload.Force) {
+		logger.InfoContext(ctx, "对话已有标题，跳过自动生成", "conversation_id", payload.ConversationID, "title_source", conv.TitleSource)
+		return conv.Title, false, nil
+	}
+
+	// 只读取当前分支，编辑或重新生成后被放弃的分支不参与生成标题
+	messages, err := s.chatRepo.GetConversationHistory(ctx, payload.UserID, payload.ConversationID, titleBranchMaxMessages)
+	if err != nil {
+		return "", false, err
+	}
+	if len(messages) > titleSourceMessageLimit {
+		messages = messages[:titleSourceMessageLimit]
+	}
+	if len(messages) == 0 {
+		logger.InfoContext(ctx, "对话没有消息，跳过生成标题", "conversation_id", payload.ConversationID)
+		return "", false, nil
+	}
+
+	var transcript strings.Builder
+	for _, msg := range messages {
+		if msg.SenderRole == entity.SenderRoleSystem {
+			continue
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.SenderRole, truncateRunes(strings.TrimSpace(msg.Content), titleSourceMessageMaxRunes))
+	}
+	llmInput := []*entity.Message{
+		entity.NewMessage(payload.ConversationID, payload.UserID, entity.SenderRoleSystem, titleSystemPrompt),
+		entity.NewMessage(payload.ConversationID, payload.UserID, entity.SenderRoleUser, transcript.String()),
+	}
+	raw, err := s.llmProvider.GenerateContent(ctx, llmInput, payload.ModelName, nil)
+	if err != nil {
+		return "", false, err // GenerateContent 内部已包装错误
+	}
+
+	title := cleanGeneratedTitle(raw)
+	if title == "" {
+		logger.WarnContext(ctx, "LLM 未生成有效的对话标题", "conversation_id", payload.ConversationID, "raw", raw)
+		return "", false, nil
+	}
+	updated, err := s.chatRepo.SetGeneratedTitle(ctx, payload.UserID, payload.ConversationID, title, payload.Force)
+	if err != nil {
+		return "", false, err
+	}
+	if updated {
+		logger.InfoContext(ctx, "对话标题已自动生成", "conversation_id", payload.ConversationID, "title", title)
+	} else {
+		logger.InfoContext(ctx, "对话标题在生成期间已被设置，丢弃自动标题", "conversation_id", payload.ConversationID)
+	}
+	return title, updated, nil
+}
+
+// titleReplaceable 判断自动生成的标题能否写入来源为 source 的对话标题。
+func titleReplaceable(source string, force bool) bool {
+	switch source {
+	case entity.ConversationTitleSourceNone:
+		return true
+	case entity.ConversationTitleSourceAuto:
+		return force
+	default:
+		return false
+	}
+}
+
+// cleanGeneratedTitle 清理 LLM 的输出：只保留第一行非空内容，去掉常见的前缀、引号和结尾标点，并限制长度。
+func cleanGeneratedTitle(raw string) string {
+	var title string
+	for _, line := range strings.Split(raw, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			title = line
+			break
+		}
+	}
+	for _, prefix := range []string{"Title:", "title:", "标题：", "标题:"} {
+		title = strings.TrimSpace(strings.TrimPrefix(title, prefix))
+	}
+	title = strings.Trim(title, "\"'`“”‘’「」《》*# ")
+	title = strings.TrimRightFunc(title, func(r rune) bool {
+		return unicode.IsPunct(r) && r != ')' && r != '）'
+	})
+	return strings.TrimSpace(truncateRunes(title, maxGeneratedTitleRunes))
+}
+
+// truncateRunes 将 s 截断为最多 maxRunes 个字符。
+func truncateRunes(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return string(runes[:maxRunes])
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+)
+
+// fakeTitleChatRepo 保存一个对话及其消息树，只实现生成标题用到的方法。
+type fakeTitleChatRepo struct {
+	repository.ChatRepository
+	conv     *entity.Conversation
+	messages map[string]*entity.Message
+	title    string
+}
+
+func (f *fakeTitleChatRepo) GetConversation(ctx context.Context, userID string, conversationID string) (*entity.Conversation, error) {
+	return f.conv, nil
+}
+
+// GetConversationHistory 从当前分支末尾沿 ParentID 回溯，与数据库实现一致。
+func (f *fakeTitleChatRepo) GetConversationHistory(ctx context.Context, userID string, conversationID string, lastN int) ([]*entity.Message, error) {
+	var branch []*entity.Message
+	for id := f.conv.ActiveLeafID; id != nil && len(branch) < lastN; {
+		msg := f.messages[*id]
+		branch = append([]*entity.Message{msg}, branch...)
+		id = msg.ParentID
+	}
+	return branch, nil
+}
+
+func (f *fakeTitleChatRepo) SetGeneratedTitle(ctx context.Context, userID string, conversationID string, title string, force bool) (bool, error) {
+	f.title = title
+	return true, nil
+}
+
+// fakeTitleLLM 记录收到的对话内容并返回固定的标题。
+type fakeTitleLLM struct {
+	LLMProvider
+	transcript string
+}
+
+func (f *fakeTitleLLM) GenerateContent(ctx context.Context, messages []*entity.Message, modelName string, opts *entity.GenerationOptions) (string, error) {
+	f.transcript = messages[len(messages)-1].Content
+	return "Title: Trip to Kyoto.", nil
+}
+
+func TestCleanGeneratedTitle(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"Planning a trip to Kyoto", "Planning a trip to Kyoto"},
+		{"  \n\nPlanning a trip to Kyoto\nThis conversation is about...", "Planning a trip to Kyoto"},
+		{"Title: Planning a trip to Kyoto", "Planning a trip to Kyoto"},
+		{"title: \"Planning a trip to Kyoto.\"", "Planning a trip to Kyoto"},
+		{"**Planning a trip to Kyoto**", "Planning a trip to Kyoto"},
+		{"# Planning a trip to Kyoto!", "Planning a trip to Kyoto"},
+		{"'Debugging Go tests'", "Debugging Go tests"},
+		{"`Debugging Go tests`", "Debugging Go tests"},
+		{"Why is my build slow?", "Why is my build slow"},
+		{"Setting up CI (GitHub Actions)", "Setting up CI (GitHub Actions)"},
+		{"标题：京都旅行计划。", "京都旅行计划"},
+		{"标题: 京都旅行计划", "京都旅行计划"},
+		{"“京都旅行计划”", "京都旅行计划"},
+		{"「京都旅行计划」", "京都旅行计划"},
+		{"《京都旅行计划》", "京都旅行计划"},
+		{"如何学习 Go 语言？", "如何学习 Go 语言"},
+		{"配置持续集成（GitHub Actions）", "配置持续集成（GitHub Actions）"},
+		{"京都旅行计划！！", "京都旅行计划"},
+		{"", ""},
+		{"  \n  ", ""},
+		{"\"\"", ""},
+		{"...", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := cleanGeneratedTitle(tt.raw); got != tt.want {
+				t.Errorf("cleanGeneratedTitle(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanGeneratedTitleTruncates(t *testing.T) {
+	got := cleanGeneratedTitle(strings.Repeat("标", maxGeneratedTitleRunes+20))
+	if n := len([]rune(got)); n != maxGeneratedTitleRunes {
+		t.Errorf("cleanGeneratedTitle() length = %d runes, want %d", n, maxGeneratedTitleRunes)
+	}
+}
+
+func TestTitleReplaceable(t *testing.T) {
+	tests := []struct {
+		source string
+		force  bool
+		want   bool
+	}{
+		{entity.ConversationTitleSourceNone, false, true},
+		{entity.ConversationTitleSourceNone, true, true},
+		{entity.ConversationTitleSourceAuto, false, false},
+		{entity.ConversationTitleSourceAuto, true, true},
+		// 用户手动设置的标题即使 force 也不会被覆盖
+		{entity.ConversationTitleSourceUser, false, false},
+		{entity.ConversationTitleSourceUser, true, false},
+		{"unknown", true, false},
+	}
+	for _, tt := range tests {
+		if got := titleReplaceable(tt.source, tt.force); got != tt.want {
+			t.Errorf("titleReplaceable(%q, %v) = %v, want %v", tt.source, tt.force, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateTitleUsesActiveBranch(t *testing.T) {
+	// 对话的第一条回复被重新生成过：abandoned 分支更早，但不在当前分支上
+	msg := func(id string, parent string, role entity.SenderRole, content string) *entity.Message {
+		m := &entity.Message{ID: id, SenderRole: role, Content: content}
+		if parent != "" {
+			m.ParentID = &parent
+		}
+		return m
+	}
+	messages := map[string]*entity.Message{}
+	for _, m := range []*entity.Message{
+		msg("u1", "", entity.SenderRoleUser, "Help me plan a trip to Kyoto"),
+		msg("abandoned", "u1", entity.SenderRoleAI, "Abandoned reply about Osaka"),
+		msg("a1", "u1", entity.SenderRoleAI, "Sure, how many days?"),
+		msg("u2", "a1", entity.SenderRoleUser, "Five days"),
+		msg("a2", "u2", entity.SenderRoleAI, "Day one: Fushimi Inari"),
+		msg("u3", "a2", entity.SenderRoleUser, "Later message beyond the first four"),
+	} {
+		messages[m.ID] = m
+	}
+	leaf := "u3"
+	repo := &fakeTitleChatRepo{
+		conv:     &entity.Conversation{ID: "conv-1", TitleSource: entity.ConversationTitleSourceNone, ActiveLeafID: &leaf},
+		messages: messages,
+	}
+	llm := &fakeTitleLLM{}
+	s := NewConversationTitleService(repo, llm, nil)
+
+	title, updated, err := s.GenerateTitle(context.Background(), &entity.ConversationTitleTaskPayload{UserID: "user-1", ConversationID: "conv-1"})
+	if err != nil || !updated || title != "Trip to Kyoto" || repo.title != "Trip to Kyoto" {
+		t.Fatalf("GenerateTitle() = %q, %v, %v, want the cleaned title to be saved", title, updated, err)
+	}
+	for _, want := range []string{"Help me plan a trip to Kyoto", "Sure, how many days?", "Five days", "Day one: Fushimi Inari"} {
+		if !strings.Contains(llm.transcript, want) {
+			t.Errorf("transcript = %q, want it to contain %q", llm.transcript, want)
+		}
+	}
+	for _, unwanted := range []string{"Abandoned reply", "Later message"} {
+		if strings.Contains(llm.transcript, unwanted) {
+			t.Errorf("transcript = %q, should not contain %q", llm.transcript, unwanted)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// ConversationTransferService 定义了导出对话和从其他平台导入对话的业务逻辑接口。
+type ConversationTransferService interface {
+	// ExportConversation 以 format (entity.ExportFormat*) 格式导出单个对话。
+	// Markdown 只包含当前分支，JSON 和 zip 包含所有分支；AI 回复附带引用来源。
+	ExportConversation(ctx context.Context, userID string, conversationID string, format string) (*entity.ExportFile, error)
+
+	// ExportAllConversations 以 format 格式导出用户的所有对话 (包括已归档的对话)。
+	ExportAllConversations(ctx context.Context, userID string, format string) (*entity.ExportFile, error)
+
+	// StartChatGPTImport 保存上传的 ChatGPT 导出文件 (conversations.json 或包含它的 zip 压缩包)，
+	// 并将导入任务放入队列，返回任务 ID。文件超过大小上限时返回 CodeValidation 错误。
+	StartChatGPTImport(ctx context.Context, userID string, filename string, size int64, data io.Reader) (string, error)
+
+	// GetImportStatus 返回导入任务的状态，已完成的任务附带导入结果。
+	// 任务不存在、不是导入任务或不属于该用户时返回 CodeNotFound 错误。
+	GetImportStatus(ctx context.Context, userID string, taskID string) (*entity.ConversationImportStatus, error)
+
+	// ImportChatGPT 由 Worker 调用，从 payload 指向的文件中导入对话。
+	// 导入是幂等的：对话和消息的 ID 由 ChatGPT 中的 ID 确定，重试或重复导入同一文件只会补全缺少的消息。
+	// 文件无法解析时返回 CodeValidation 错误 (重试无意义)。
+	ImportChatGPT(ctx context.Context, payload *entity.ConversationImportTaskPayload) (*entity.ConversationImportReport, error)
+}
@@ -0,0 +1,414 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// exportPageSize 是导出时每次从数据库读取的对话数和消息数。
+	exportPageSize = 500
+	// exportSlugRunes 是 zip 中 Markdown 文件名里标题部分的最大字符数。
+	exportSlugRunes = 40
+)
+
+// Ensure conversationTransferServiceImpl implements ConversationTransferService interface.
+var _ ConversationTransferService = (*conversationTransferServiceImpl)(nil)
+
+// conversationTransferServiceImpl 是 ConversationTransferService 接口的实现。
+type conversationTransferServiceImpl struct {
+	chatRepo      repository.ChatRepository
+	docRepo       repository.DocumentRepository               // 解析引用来源的文件名
+	fileStorage   FileStorage                                 // 暂存上传的导入文件
+	importFiles   repository.ConversationImportFileRepository // 记录等待导入的文件，避免被孤立文件对账删除
+	taskQueue     TaskQueueClient
+	inspector     TaskInspector    // 查询导入任务的状态和结果 (可以为 nil，此时无法查询)
+	indexer       MessageIndexer   // 导入的消息的搜索索引 (可以为 nil)
+	maxImportSize int64            // 上传的导入文件的最大字节数
+	now           func() time.Time // 导出时间，便于替换
+}
+
+// NewConversationTransferService 创建一个新的 ConversationTransferService 实例。
+func NewConversationTransferService(
+	chatRepo repository.ChatRepository,
+	docRepo repository.DocumentRepository,
+	fileStorage FileStorage,
+	importFiles repository.ConversationImportFileRepository,
+	taskQueue TaskQueueClient,
+	inspector TaskInspector,
+	indexer MessageIndexer,
+	cfg *config.Config,
+) ConversationTransferService {
+	return &conversationTransferServiceImpl{
+		chatRepo:      chatRepo,
+		docRepo:       docRepo,
+		fileStorage:   fileStorage,
+		importFiles:   importFiles,
+		taskQueue:     taskQueue,
+		inspector:     inspector,
+		indexer:       indexer,
+		maxImportSize: cfg.ConversationImportMaxSizeBytes,
+		now:           time.Now,
+	}
+}
+
+// ExportConversation 实现 ConversationTransferService 接口。
+func (s *conversationTransferServiceImpl) ExportConversation(ctx context.Context, userID string, conversationID string, format string) (*entity.ExportFile, error) {
+	if err := validateExportFormat(format); err != nil {
+		return nil, err
+	}
+	if err := validateConversationID(conversationID); err != nil {
+		return nil, err
+	}
+	conv, err := s.chatRepo.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	export, err := s.loadConversation(ctx, userID, conv)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := s.buildArchive(ctx, []*entity.ConversationExport{export})
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "导出对话", "user_id", userID, "conversation_id", conversationID, "format", format)
+	return renderExport(archive, format, "conversation-"+conversationID)
+}
+
+// ExportAllConversations 实现 ConversationTransferService 接口。
+func (s *conversationTransferServiceImpl) ExportAllConversations(ctx context.Context, userID string, format string) (*entity.ExportFile, error) {
+	if err := validateExportFormat(format); err != nil {
+		return nil, err
+	}
+	exports := make([]*entity.ConversationExport, 0)
+	for offset := 0; ; offset += exportPageSize {
+		convs, total, err := s.chatRepo.GetUserConversations(ctx, userID, nil, exportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, conv := range convs {
+			export, err := s.loadConversation(ctx, userID, conv)
+			if err != nil {
+				return nil, err
+			}
+			exports = append(exports, export)
+		}
+		if len(convs) < exportPageSize || offset+len(convs) >= total {
+			break
+		}
+	}
+	archive, err := s.buildArchive(ctx, exports)
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "导出所有对话", "user_id", userID, "conversation_count", len(exports), "format", format)
+	return renderExport(archive, format, "conversations-"+archive.ExportedAt.Format("20060102"))
+}
+
+// loadConversation 读取对话的所有消息 (所有分支，按时间升序)。
+func (s *conversationTransferServiceImpl) loadConversation(ctx context.Context, userID string, conv *entity.Conversation) (*entity.ConversationExport, error) {
+	messages, err := s.listAllMessages(ctx, userID, conv.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.ConversationExport{Conversation: conv, Messages: messages}, nil
+}
+
+// listAllMessages 分页读取对话的所有消息。
+func (s *conversationTransferServiceImpl) listAllMessages(ctx context.Context, userID string, conversationID string) ([]*entity.Message, error) {
+	messages := make([]*entity.Message, 0)
+	for offset := 0; ; offset += exportPageSize {
+		page, err := s.chatRepo.GetMessagesByConversationID(ctx, userID, conversationID, exportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, page...)
+		if len(page) < exportPageSize {
+			return messages, nil
+		}
+	}
+}
+
+// buildArchive 汇总导出的对话，并解析消息引用来源中的文档文件名。已删除的文档不出现在 Documents 中。
+func (s *conversationTransferServiceImpl) buildArchive(ctx context.Context, exports []*entity.ConversationExport) (*entity.ConversationArchive, error) {
+	archive := &entity.ConversationArchive{
+		FormatVersion: entity.ConversationArchiveVersion,
+		ExportedAt:    s.now().UTC(),
+		Conversations: exports,
+		Documents:     make(map[string]string),
+	}
+	resolved := make(map[string]bool)
+	for _, export := range exports {
+		for _, msg := range export.Messages {
+			for _, source := range msg.Sources() {
+				if resolved[source.DocumentID] {
+					continue
+				}
+				resolved[source.DocumentID] = true
+				doc, err := s.docRepo.GetDocumentByID(ctx, export.Conversation.UserID, source.DocumentID)
+				if err != nil {
+					if apperr.Is(err, apperr.CodeNotFound) {
+						continue
+					}
+					return nil, err
+				}
+				archive.Documents[source.DocumentID] = doc.OriginalFilename
+			}
+		}
+	}
+	return archive, nil
+}
+
+// StartChatGPTImport 实现 ConversationTransferService 接口。
+func (s *conversationTransferServiceImpl) StartChatGPTImport(ctx context.Context, userID string, filename string, size int64, data io.Reader) (string, error) {
+	if s.maxImportSize > 0 && size > s.maxImportSize {
+		return "", apperr.New(apperr.CodeValidation, "导入文件大小超出上限").
+			WithDetails(fmt.Sprintf("max_import_size_bytes=%d", s.maxImportSize)).
+			WithHTTPStatus(http.StatusRequestEntityTooLarge)
+	}
+	// 文件在导入任务结束后删除。导入任务仍在队列中 (等待执行、重试或在死信队列中) 时，
+	// conversation_import_files 中的记录使孤立文件维护任务保留该文件；任务被删除后文件由维护任务清理
+	storedPath, err := s.fileStorage.SaveFile(ctx, userID, filename, data)
+	if err != nil {
+		return "", err
+	}
+	if err := s.importFiles.SaveImportFile(ctx, &entity.ConversationImportFile{StoredPath: storedPath, UserID: userID}); err != nil {
+		s.discardImportFile(ctx, storedPath)
+		return "", err
+	}
+	taskID, err := s.taskQueue.EnqueueConversationImportTask(ctx, &entity.ConversationImportTaskPayload{
+		UserID:     userID,
+		StoredPath: storedPath,
+		Filename:   filename,
+	})
+	if err != nil {
+		s.discardImportFile(ctx, storedPath)
+		return "", err
+	}
+	if err := s.importFiles.SetImportFileTask(ctx, storedPath, taskID); err != nil {
+		// 没有任务 ID 的记录在孤立文件宽限期内仍然有效，导入通常在此之前完成
+		logger.WarnContext(ctx, "记录导入文件的任务 ID 失败", "error", err, "stored_path", storedPath, "task_id", taskID)
+	}
+	logger.InfoContext(ctx, "ChatGPT 对话导入任务已入队", "user_id", userID, "task_id", taskID, "filename", filename, "size", size)
+	return taskID, nil
+}
+
+// discardImportFile 删除导入文件及其记录，失败时只记录日志 (遗留的文件由孤立文件维护任务清理)。
+func (s *conversationTransferServiceImpl) discardImportFile(ctx context.Context, storedPath string) {
+	if err := s.fileStorage.DeleteFile(ctx, storedPath); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+		logger.WarnContext(ctx, "删除导入文件失败", "error", err, "stored_path", storedPath)
+	}
+	if err := s.importFiles.DeleteImportFile(ctx, storedPath); err != nil {
+		logger.WarnContext(ctx, "删除导入文件记录失败", "error", err, "stored_path", storedPath)
+	}
+}
+
+// GetImportStatus 实现 ConversationTransferService 接口。
+func (s *conversationTransferServiceImpl) GetImportStatus(ctx context.Context, userID string, taskID string) (*entity.ConversationImportStatus, error) {
+	if s.inspector == nil {
+		return nil, apperr.New(apperr.CodeUnavailable, "无法查询任务状态")
+	}
+	info, err := s.inspector.GetTaskInfo(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	// 其他用户的任务和其他类型的任务按不存在处理
+	if info.Type != entity.TaskTypeConversationImport || entity.ParseTaskPayloadRef(info.Payload).UserID != userID {
+		return nil, apperr.ErrNotFound("任务未找到")
+	}
+	status := &entity.ConversationImportStatus{TaskID: info.ID, State: info.State, Error: info.LastErr}
+	if len(info.Result) > 0 {
+		var report entity.ConversationImportReport
+		if err := json.Unmarshal(info.Result, &report); err != nil {
+			logger.WarnContext(ctx, "解析导入任务结果失败", "error", err, "task_id", taskID)
+		} else {
+			status.Report = &report
+		}
+	}
+	return status, nil
+}
+
+// validateExportFormat 检查导出格式是否受支持。
+func validateExportFormat(format string) error {
+	switch format {
+	case entity.ExportFormatMarkdown, entity.ExportFormatJSON, entity.ExportFormatZip:
+		return nil
+	}
+	return apperr.New(apperr.CodeInvalidArgument, "不支持的导出格式").
+		WithDetails("format=" + format + "，可选值: markdown、json、zip")
+}
+
+// renderExport 将归档渲染为指定格式的文件，baseName 是不含扩展名的下载文件名。
+func renderExport(archive *entity.ConversationArchive, format string, baseName string) (*entity.ExportFile, error) {
+	switch format {
+	case entity.ExportFormatMarkdown:
+		var buf bytes.Buffer
+		for i, export := range archive.Conversations {
+			if i > 0 {
+				buf.WriteString("\n\n---\n\n")
+			}
+			writeConversationMarkdown(&buf, export, archive.Documents)
+		}
+		return &entity.ExportFile{Filename: baseName + ".md", ContentType: "text/markdown; charset=utf-8", Data: buf.Bytes()}, nil
+	case entity.ExportFormatJSON:
+		data, err := json.MarshalIndent(archive, "", "  ")
+		if err != nil {
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "无法生成导出文件")
+		}
+		return &entity.ExportFile{Filename: baseName + ".json", ContentType: "application/json", Data: data}, nil
+	default:
+		data, err := renderZip(archive)
+		if err != nil {
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "无法生成导出文件")
+		}
+		return &entity.ExportFile{Filename: baseName + ".zip", ContentType: "application/zip", Data: data}, nil
+	}
+}
+
+// renderZip 生成包含 conversations.json 和每个对话一个 Markdown 文件的压缩包。
+func renderZip(archive *entity.ConversationArchive) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	writeEntry := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: archive.ExportedAt})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry("conversations.json", data); err != nil {
+		return nil, err
+	}
+	for _, export := range archive.Conversations {
+		var md bytes.Buffer
+		writeConversationMarkdown(&md, export, archive.Documents)
+		if err := writeEntry("markdown/"+markdownFilename(export.Conversation), md.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// markdownFilename 生成对话在压缩包中的文件名：创建日期 + 标题 + 对话 ID 前缀 (保证唯一)。
+func markdownFilename(conv *entity.Conversation) string {
+	var slug strings.Builder
+	lastDash := true
+	for _, r := range conv.Title {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			slug.WriteRune(r)
+			lastDash = false
+		} else if !lastDash {
+			slug.WriteByte('-')
+			lastDash = true
+		}
+	}
+	name := conv.CreatedAt.UTC().Format("2006-01-02")
+	if title := strings.Trim(truncateRunes(slug.String(), exportSlugRunes), "-"); title != "" {
+		name += "-" + title
+	}
+	return name + "-" + conv.ID[:min(8, len(conv.ID))] + ".md"
+}
+
+// writeConversationMarkdown 将对话当前分支的消息写为 Markdown，AI 回复后列出引用来源。
+func writeConversationMarkdown(buf *bytes.Buffer, export *entity.ConversationExport, documents map[string]string) {
+	conv := export.Conversation
+	title := conv.Title
+	if title == "" {
+		title = "未命名对话"
+	}
+	fmt.Fprintf(buf, "# %s\n\n", title)
+	fmt.Fprintf(buf, "- 对话 ID: `%s`\n", conv.ID)
+	fmt.Fprintf(buf, "- 创建时间: %s\n", conv.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(buf, "- 最后活动: %s\n", conv.LastUpdatedAt.UTC().Format(time.RFC3339))
+
+	for _, msg := range activeBranch(export) {
+		fmt.Fprintf(buf, "\n## %s · %s\n\n", roleLabel(msg.SenderRole), msg.Timestamp.UTC().Format("2006-01-02 15:04:05 UTC"))
+		buf.WriteString(strings.TrimSpace(msg.Content))
+		buf.WriteString("\n")
+
+		sources := msg.Sources()
+		if len(sources) == 0 {
+			continue
+		}
+		buf.WriteString("\n**引用来源**\n\n")
+		for i, source := range sources {
+			name, ok := documents[source.DocumentID]
+			if !ok {
+				name = "已删除的文档 " + source.DocumentID
+			}
+			fmt.Fprintf(buf, "%d. %s", i+1, name)
+			if source.PageNumber > 0 {
+				fmt.Fprintf(buf, " (第 %d 页)", source.PageNumber)
+			}
+			fmt.Fprintf(buf, " — 块 `%s`\n", source.ChunkID)
+			if excerpt := strings.TrimSpace(source.Excerpt); excerpt != "" {
+				fmt.Fprintf(buf, "   > %s\n", strings.Join(strings.Fields(excerpt), " "))
+			}
+		}
+	}
+}
+
+// activeBranch 返回对话当前分支上的消息 (按时间顺序)。没有记录当前分支时使用最新消息所在的分支。
+func activeBranch(export *entity.ConversationExport) []*entity.Message {
+	if len(export.Messages) == 0 {
+		return nil
+	}
+	byID := make(map[string]*entity.Message, len(export.Messages))
+	for _, msg := range export.Messages {
+		byID[msg.ID] = msg
+	}
+	leaf := export.Messages[len(export.Messages)-1]
+	if id := export.Conversation.ActiveLeafID; id != nil && byID[*id] != nil {
+		leaf = byID[*id]
+	}
+
+	branch := make([]*entity.Message, 0)
+	for msg := leaf; msg != nil; {
+		branch = append(branch, msg)
+		if msg.ParentID == nil {
+			break
+		}
+		msg = byID[*msg.ParentID]
+	}
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch
+}
+
+// roleLabel 返回 Markdown 中显示的发送者名称。
+func roleLabel(role entity.SenderRole) string {
+	switch role {
+	case entity.SenderRoleUser:
+		return "用户"
+	case entity.SenderRoleAI:
+		return "助手"
+	case entity.SenderRoleSystem:
+		return "系统"
+	}
+	return string(role)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// EventPublisher 定义了 DreamHub 内部流程 (聊天、文档处理、记忆写入) 向事件总线发布事件的接口。
+type EventPublisher interface {
+	// PublishSystemEvent 发布 DreamHub 自身的事件：source 为 entity.EventSourceDreamHub，
+	// dataversion 取自 entity.SystemEventVersions，data 序列化为 JSON。
+	PublishSystemEvent(ctx context.Context, userID string, eventType string, subject string, data any) error
+}
+
+// EventBusService 定义了事件总线的业务逻辑接口：D-App 发布 CloudEvents 兼容的事件，
+// 按事件类型模式订阅，并通过 SSE 或 webhook 接收。
+type EventBusService interface {
+	EventPublisher
+
+	// Publish 校验并保存 D-App 发布的事件，并为匹配的 webhook 订阅安排投递。
+	// source 和 id 相同的事件已发布过时不重复保存和投递，返回已有的事件和 false。
+	Publish(ctx context.Context, userID string, event *entity.Event) (*entity.Event, bool, error)
+
+	// ListEvents 按 seq 升序列出事件，用于回放和 SSE 推送。
+	ListEvents(ctx context.Context, userID string, filter *entity.EventFilter) ([]*entity.Event, error)
+
+	// LatestEventSeq 返回用户最新事件的 seq，没有事件时返回 0。
+	LatestEventSeq(ctx context.Context, userID string) (int64, error)
+
+	// CreateSubscription 校验并创建订阅。webhook 订阅的签名密钥未提供时自动生成，只在返回值中出现这一次。
+	CreateSubscription(ctx context.Context, userID string, input *entity.EventSubscriptionInput) (*entity.EventSubscription, error)
+
+	// GetSubscription 获取订阅 (不含签名密钥)，不存在时返回 CodeNotFound 错误。
+	GetSubscription(ctx context.Context, userID string, subscriptionID string) (*entity.EventSubscription, error)
+
+	// ListSubscriptions 列出用户的订阅 (不含签名密钥)。
+	ListSubscriptions(ctx context.Context, userID string) ([]*entity.EventSubscription, error)
+
+	// DeleteSubscription 删除订阅及其投递记录。
+	DeleteSubscription(ctx context.Context, userID string, subscriptionID string) error
+
+	// ListDeliveries 按创建时间倒序分页列出 webhook 订阅的投递记录，同时返回总数。
+	ListDeliveries(ctx context.Context, userID string, subscriptionID string, limit int, offset int) ([]*entity.EventDelivery, int, error)
+
+	// RetryDelivery 重新投递一个失败的投递记录，投递仍在进行中时返回 CodeConflict 错误。
+	RetryDelivery(ctx context.Context, userID string, subscriptionID string, deliveryID string) (*entity.EventDelivery, error)
+
+	// DeliverWebhook 执行一次 webhook 投递 (由 Worker 调用)。
+	// 返回的错误可以重试；webhook 拒绝事件 (4xx) 或订阅已不存在等重试无意义的情况返回包装了
+	// entity.ErrEventDeliveryRejected 的错误。finalAttempt 为 true 时失败的投递标记为 failed。
+	DeliverWebhook(ctx context.Context, payload *entity.EventDeliveryTaskPayload, finalAttempt bool) error
+}
+
+// WebhookSender 定义了将事件 POST 到 webhook 地址的接口。
+type WebhookSender interface {
+	// Send 发送请求并返回响应的状态码 (没有收到响应时为 0)。
+	// 目标地址不允许访问或返回 4xx (408 和 429 除外) 时返回 CodeValidation 错误 (重试无意义)，
+	// 临时性故障 (超时、连接失败、5xx、408、429) 返回 CodeUnavailable 错误。
+	Send(ctx context.Context, url string, header http.Header, body []byte) (statusCode int, err error)
+}
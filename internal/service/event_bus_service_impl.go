@@ -0,0 +1,545 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/ctxutil"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// 事件属性和订阅字段的长度限制，与 events 和 event_subscriptions 表的列一致。
+const (
+	maxEventIDLength      = 255
+	maxEventSourceLength  = 1024
+	maxEventTypeLength    = 255
+	maxEventSubjectLength = 1024
+	maxEventSchemaLength  = 1024
+	maxEventListLimit     = 100
+	maxEventTypePatterns  = 20 // 列出事件时最多的类型模式数
+	maxWebhookURLLength   = 2048
+	minWebhookSecretLen   = 16
+	maxWebhookSecretLen   = 255
+	webhookSecretBytes    = 32 // 自动生成的签名密钥的随机字节数
+)
+
+var (
+	// eventDataVersionPattern 是 dataversion 的格式：主版本号，可选的次版本号和修订号。
+	eventDataVersionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,2}$`)
+	// eventExtensionNamePattern 是 CloudEvents 规定的扩展属性名格式。
+	eventExtensionNamePattern = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+)
+
+// eventBusServiceImpl 是 EventBusService 接口的实现。
+type eventBusServiceImpl struct {
+	repo      repository.EventRepository
+	taskQueue TaskQueueClient // 用于安排 webhook 投递，为 nil 时不投递 webhook
+	sender    WebhookSender   // 只有 Worker 需要，API 服务中为 nil
+}
+
+// Ensure eventBusServiceImpl implements EventBusService interface.
+var _ EventBusService = (*eventBusServiceImpl)(nil)
+
+// NewEventBusService 创建一个新的 eventBusServiceImpl 实例。
+func NewEventBusService(repo repository.EventRepository, taskQueue TaskQueueClient, sender WebhookSender) EventBusService {
+	return &eventBusServiceImpl{repo: repo, taskQueue: taskQueue, sender: sender}
+}
+
+// Publish 校验 D-App 发布的事件并保存。dreamhub.* 类型和 /dreamhub 来源保留给 DreamHub 自身的事件。
+func (s *eventBusServiceImpl) Publish(ctx context.Context, userID string, event *entity.Event) (*entity.Event, bool, error) {
+	if event == nil {
+		return nil, false, apperr.New(apperr.CodeInvalidArgument, "缺少事件内容")
+	}
+	if err := validateEvent(event); err != nil {
+		return nil, false, err
+	}
+	if strings.HasPrefix(event.Type, entity.SystemEventTypePrefix) || event.Source == entity.EventSourceDreamHub {
+		return nil, false, apperr.New(apperr.CodePermissionDenied, "不能发布 DreamHub 保留的事件").
+			WithDetails(fmt.Sprintf("type=%s", event.Type), fmt.Sprintf("source=%s", event.Source))
+	}
+	return s.publish(ctx, userID, event)
+}
+
+// PublishSystemEvent 发布 DreamHub 自身的事件。
+func (s *eventBusServiceImpl) PublishSystemEvent(ctx context.Context, userID string, eventType string, subject string, data any) error {
+	version, ok := entity.SystemEventVersions[eventType]
+	if !ok {
+		return apperr.New(apperr.CodeInternal, "未注册的内部事件类型").WithDetails("type=" + eventType)
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return apperr.Wrap(err, apperr.CodeInternal, "无法序列化事件 data")
+	}
+	event := &entity.Event{
+		SpecVersion:     entity.CloudEventsSpecVersion,
+		ID:              uuid.NewString(),
+		Source:          entity.EventSourceDreamHub,
+		Type:            eventType,
+		Subject:         subject,
+		DataContentType: "application/json",
+		DataVersion:     version,
+		Data:            raw,
+	}
+	if err := validateEvent(event); err != nil {
+		return err
+	}
+	_, _, err = s.publish(ctx, userID, event)
+	return err
+}
+
+// publish 补全可选属性并保存已校验的事件，新事件会投递给匹配的 webhook 订阅。
+func (s *eventBusServiceImpl) publish(ctx context.Context, userID string, event *entity.Event) (*entity.Event, bool, error) {
+	event.UserID = userID
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.TraceID == "" {
+		event.TraceID = ctxutil.GetTraceID(ctx)
+		if event.TraceID == "" {
+			event.TraceID = uuid.NewString()
+		}
+	}
+	if len(event.Data) > 0 && event.DataContentType == "" {
+		event.DataContentType = "application/json"
+	}
+
+	created, err := s.repo.CreateEvent(ctx, event)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created {
+		logger.InfoContext(ctx, "事件已发布过，忽略重复的事件", "user_id", userID, "source", event.Source, "event_id", event.ID, "seq", event.Seq)
+		return event, false, nil
+	}
+	logger.InfoContext(ctx, "事件已发布", "user_id", userID, "type", event.Type, "source", event.Source, "seq", event.Seq)
+	s.scheduleWebhooks(ctx, event)
+	return event, true, nil
+}
+
+// scheduleWebhooks 为匹配事件的 webhook 订阅创建投递记录并将投递任务入队。
+// 事件已经保存，这里的失败只记录日志：投递记录会标记为 failed，用户可以手动重试。
+func (s *eventBusServiceImpl) scheduleWebhooks(ctx context.Context, event *entity.Event) {
+	if s.taskQueue == nil {
+		return
+	}
+	subscriptions, err := s.repo.ListSubscriptions(ctx, event.UserID)
+	if err != nil {
+		logger.WarnContext(ctx, "获取事件订阅失败，跳过 webhook 投递", "error", err, "user_id", event.UserID, "seq", event.Seq)
+		return
+	}
+	var subscriptionIDs []string
+	for _, sub := range subscriptions {
+		if sub.Delivery == entity.EventDeliveryWebhook && sub.Matches(event) {
+			subscriptionIDs = append(subscriptionIDs, sub.ID)
+		}
+	}
+	if len(subscriptionIDs) == 0 {
+		return
+	}
+	deliveries, err := s.repo.CreateDeliveries(ctx, event, subscriptionIDs)
+	if err != nil {
+		logger.WarnContext(ctx, "创建 webhook 投递记录失败", "error", err, "user_id", event.UserID, "seq", event.Seq)
+		return
+	}
+	for _, delivery := range deliveries {
+		s.enqueueDelivery(ctx, delivery)
+	}
+}
+
+// enqueueDelivery 将投递任务入队，失败时将投递记录标记为 failed 并返回错误。
+func (s *eventBusServiceImpl) enqueueDelivery(ctx context.Context, delivery *entity.EventDelivery) error {
+	payload := &entity.EventDeliveryTaskPayload{UserID: delivery.UserID, DeliveryID: delivery.ID}
+	if _, err := s.taskQueue.EnqueueEventDeliveryTask(ctx, payload); err != nil {
+		logger.WarnContext(ctx, "webhook 投递任务入队失败", "error", err, "delivery_id", delivery.ID)
+		if recErr := s.repo.RecordDeliveryAttempt(ctx, delivery.ID, entity.EventDeliveryFailed, nil, err.Error()); recErr != nil {
+			logger.WarnContext(ctx, "更新投递记录失败", "error", recErr, "delivery_id", delivery.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// ListEvents 校验过滤条件并列出事件。
+func (s *eventBusServiceImpl) ListEvents(ctx context.Context, userID string, filter *entity.EventFilter) ([]*entity.Event, error) {
+	if filter == nil {
+		filter = &entity.EventFilter{}
+	}
+	if len(filter.TypePatterns) > maxEventTypePatterns {
+		return nil, apperr.New(apperr.CodeInvalidArgument, fmt.Sprintf("最多指定 %d 个事件类型", maxEventTypePatterns))
+	}
+	for _, pattern := range filter.TypePatterns {
+		if err := validateEventTypePattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	if filter.Limit <= 0 || filter.Limit > maxEventListLimit {
+		filter.Limit = maxEventListLimit
+	}
+	return s.repo.ListEvents(ctx, userID, filter)
+}
+
+// LatestEventSeq 返回用户最新事件的 seq。
+func (s *eventBusServiceImpl) LatestEventSeq(ctx context.Context, userID string) (int64, error) {
+	return s.repo.LatestEventSeq(ctx, userID)
+}
+
+// CreateSubscription 校验输入并创建订阅。
+func (s *eventBusServiceImpl) CreateSubscription(ctx context.Context, userID string, input *entity.EventSubscriptionInput) (*entity.EventSubscription, error) {
+	if input == nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "缺少订阅内容")
+	}
+	sub := &entity.EventSubscription{
+		UserID:        userID,
+		TypePattern:   strings.TrimSpace(input.TypePattern),
+		SchemaVersion: input.SchemaVersion,
+		Delivery:      input.Delivery,
+		WebhookURL:    strings.TrimSpace(input.WebhookURL),
+		Secret:        input.Secret,
+	}
+	if err := validateEventTypePattern(sub.TypePattern); err != nil {
+		return nil, err
+	}
+	if err := validateSubscriptionSchemaVersion(sub.TypePattern, sub.SchemaVersion); err != nil {
+		return nil, err
+	}
+	switch sub.Delivery {
+	case entity.EventDeliverySSE:
+		if sub.WebhookURL != "" || sub.Secret != "" {
+			return nil, apperr.New(apperr.CodeValidation, "SSE 订阅不能设置 webhook_url 和 secret")
+		}
+	case entity.EventDeliveryWebhook:
+		if err := validateWebhookURL(sub.WebhookURL); err != nil {
+			return nil, err
+		}
+		if sub.Secret == "" {
+			secret, err := generateWebhookSecret()
+			if err != nil {
+				return nil, err
+			}
+			sub.Secret = secret
+		} else if len(sub.Secret) < minWebhookSecretLen || len(sub.Secret) > maxWebhookSecretLen {
+			return nil, apperr.New(apperr.CodeValidation, fmt.Sprintf("secret 的长度必须在 %d 到 %d 个字符之间", minWebhookSecretLen, maxWebhookSecretLen))
+		}
+	default:
+		return nil, apperr.New(apperr.CodeValidation, "不支持的投递方式").
+			WithDetails(fmt.Sprintf("delivery=%s，可选值: sse、webhook", sub.Delivery))
+	}
+
+	existing, err := s.repo.ListSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= entity.MaxEventSubscriptions {
+		return nil, apperr.New(apperr.CodeValidation, fmt.Sprintf("最多创建 %d 个订阅", entity.MaxEventSubscriptions))
+	}
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "事件订阅已创建", "user_id", userID, "subscription_id", sub.ID, "type", sub.TypePattern, "delivery", sub.Delivery)
+	return sub, nil
+}
+
+// GetSubscription 获取订阅，不返回签名密钥。
+func (s *eventBusServiceImpl) GetSubscription(ctx context.Context, userID string, subscriptionID string) (*entity.EventSubscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, userID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+// ListSubscriptions 列出订阅，不返回签名密钥。
+func (s *eventBusServiceImpl) ListSubscriptions(ctx context.Context, userID string) ([]*entity.EventSubscription, error) {
+	subscriptions, err := s.repo.ListSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subscriptions {
+		sub.Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// DeleteSubscription 删除订阅。已入队的投递任务在执行时发现投递记录不存在后放弃。
+func (s *eventBusServiceImpl) DeleteSubscription(ctx context.Context, userID string, subscriptionID string) error {
+	return s.repo.DeleteSubscription(ctx, userID, subscriptionID)
+}
+
+// ListDeliveries 确认订阅存在后分页列出投递记录。
+func (s *eventBusServiceImpl) ListDeliveries(ctx context.Context, userID string, subscriptionID string, limit int, offset int) ([]*entity.EventDelivery, int, error) {
+	if _, err := s.repo.GetSubscription(ctx, userID, subscriptionID); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListDeliveries(ctx, userID, subscriptionID, limit, offset)
+}
+
+// RetryDelivery 将失败的投递恢复为 pending 并重新入队。
+func (s *eventBusServiceImpl) RetryDelivery(ctx context.Context, userID string, subscriptionID string, deliveryID string) (*entity.EventDelivery, error) {
+	delivery, err := s.repo.GetDelivery(ctx, userID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.SubscriptionID != subscriptionID {
+		return nil, apperr.ErrNotFound("投递记录不存在")
+	}
+	if delivery.Status != entity.EventDeliveryFailed {
+		return nil, apperr.New(apperr.CodeConflict, "只能重新投递失败的投递").WithDetails("status=" + string(delivery.Status))
+	}
+	if s.taskQueue == nil {
+		return nil, apperr.New(apperr.CodeUnavailable, "任务队列不可用")
+	}
+	delivery, err = s.repo.ResetDelivery(ctx, userID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueueDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "webhook 投递已重新入队", "user_id", userID, "subscription_id", subscriptionID, "delivery_id", deliveryID)
+	return delivery, nil
+}
+
+// DeliverWebhook 将事件以 CloudEvents 结构化模式 POST 到订阅的地址，并记录结果。
+// 请求带有 X-DreamHub-Signature 头：以订阅的 secret 为密钥对请求体计算的 HMAC-SHA256 (十六进制)。
+func (s *eventBusServiceImpl) DeliverWebhook(ctx context.Context, payload *entity.EventDeliveryTaskPayload, finalAttempt bool) error {
+	if s.sender == nil {
+		return apperr.New(apperr.CodeUnavailable, "webhook 发送器未配置")
+	}
+	delivery, err := s.repo.GetDelivery(ctx, payload.UserID, payload.DeliveryID)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			return fmt.Errorf("%w: 投递记录不存在 (订阅可能已删除)", entity.ErrEventDeliveryRejected)
+		}
+		return err
+	}
+	if delivery.Status == entity.EventDeliverySucceeded {
+		return nil // 重复执行的任务
+	}
+	sub, err := s.repo.GetSubscription(ctx, payload.UserID, delivery.SubscriptionID)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			return fmt.Errorf("%w: 订阅不存在", entity.ErrEventDeliveryRejected)
+		}
+		return err
+	}
+	event, err := s.repo.GetEvent(ctx, payload.UserID, delivery.EventSeq)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			return fmt.Errorf("%w: 事件不存在", entity.ErrEventDeliveryRejected)
+		}
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return apperr.Wrap(err, apperr.CodeInternal, "无法序列化事件")
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+	header.Set("X-DreamHub-Delivery", delivery.ID)
+	header.Set("X-DreamHub-Signature", "sha256="+signWebhookBody(sub.Secret, body))
+	statusCode, sendErr := s.sender.Send(ctx, sub.WebhookURL, header, body)
+
+	var code *int
+	if statusCode > 0 {
+		code = &statusCode
+	}
+	if sendErr == nil {
+		if err := s.repo.RecordDeliveryAttempt(ctx, delivery.ID, entity.EventDeliverySucceeded, code, ""); err != nil {
+			logger.WarnContext(ctx, "更新投递记录失败", "error", err, "delivery_id", delivery.ID)
+		}
+		logger.InfoContext(ctx, "webhook 投递成功", "delivery_id", delivery.ID, "subscription_id", sub.ID, "seq", event.Seq, "status", statusCode)
+		return nil
+	}
+
+	rejected := apperr.Is(sendErr, apperr.CodeValidation)
+	status := entity.EventDeliveryPending
+	if rejected || finalAttempt {
+		status = entity.EventDeliveryFailed
+	}
+	if err := s.repo.RecordDeliveryAttempt(ctx, delivery.ID, status, code, sendErr.Error()); err != nil {
+		logger.WarnContext(ctx, "更新投递记录失败", "error", err, "delivery_id", delivery.ID)
+	}
+	logger.WarnContext(ctx, "webhook 投递失败", "error", sendErr, "delivery_id", delivery.ID, "subscription_id", sub.ID,
+		"status", statusCode, "final", rejected || finalAttempt)
+	if rejected {
+		return fmt.Errorf("%w: %v", entity.ErrEventDeliveryRejected, sendErr)
+	}
+	return sendErr
+}
+
+// validateEvent 校验 CloudEvents 属性和 DreamHub 约定的扩展属性，并根据 dataversion 设置 DataMajor。
+func validateEvent(e *entity.Event) error {
+	if e.SpecVersion != entity.CloudEventsSpecVersion {
+		return apperr.New(apperr.CodeValidation, "只支持 CloudEvents 1.0").WithDetails("specversion=" + e.SpecVersion)
+	}
+	if e.ID == "" || len(e.ID) > maxEventIDLength {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("id 不能为空且不能超过 %d 个字符", maxEventIDLength))
+	}
+	if e.Source == "" || len(e.Source) > maxEventSourceLength {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("source 不能为空且不能超过 %d 个字符", maxEventSourceLength))
+	}
+	if err := validateEventType(e.Type); err != nil {
+		return err
+	}
+	if len(e.Subject) > maxEventSubjectLength {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("subject 不能超过 %d 个字符", maxEventSubjectLength))
+	}
+	if len(e.DataSchema) > maxEventSchemaLength {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("dataschema 不能超过 %d 个字符", maxEventSchemaLength))
+	}
+	if len(e.DataContentType) > 255 || len(e.TraceID) > 255 {
+		return apperr.New(apperr.CodeValidation, "datacontenttype 和 traceid 不能超过 255 个字符")
+	}
+
+	if !eventDataVersionPattern.MatchString(e.DataVersion) || len(e.DataVersion) > 32 {
+		return apperr.New(apperr.CodeValidation, "dataversion 必须是 \"主版本号[.次版本号[.修订号]]\" 格式，例如 1.0").
+			WithDetails("dataversion=" + e.DataVersion)
+	}
+	major, err := strconv.Atoi(strings.SplitN(e.DataVersion, ".", 2)[0])
+	if err != nil {
+		return apperr.Wrap(err, apperr.CodeValidation, "dataversion 的主版本号无效").WithDetails("dataversion=" + e.DataVersion)
+	}
+	e.DataMajor = major
+
+	if e.DataBase64 != "" {
+		return apperr.New(apperr.CodeValidation, "不支持二进制 data (data_base64)，请使用 JSON data")
+	}
+	if len(e.Data) > entity.MaxEventDataSize {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("data 不能超过 %d 字节", entity.MaxEventDataSize))
+	}
+
+	if len(e.Extensions) > entity.MaxEventExtensionCount {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("最多 %d 个扩展属性", entity.MaxEventExtensionCount))
+	}
+	for name, value := range e.Extensions {
+		if !eventExtensionNamePattern.MatchString(name) {
+			return apperr.New(apperr.CodeValidation, "扩展属性名只能包含小写字母和数字，且不能超过 20 个字符").WithDetails("name=" + name)
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return apperr.New(apperr.CodeValidation, "扩展属性的值只能是字符串、数字或布尔值").WithDetails("name=" + name)
+		}
+	}
+	return nil
+}
+
+// validateEventType 校验事件类型：不能为空，不能包含空白字符和通配符 "*"。
+func validateEventType(eventType string) error {
+	if eventType == "" || len(eventType) > maxEventTypeLength {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("type 不能为空且不能超过 %d 个字符", maxEventTypeLength))
+	}
+	if strings.ContainsAny(eventType, "* \t\r\n") {
+		return apperr.New(apperr.CodeValidation, "type 不能包含空白字符和 \"*\"").WithDetails("type=" + eventType)
+	}
+	return nil
+}
+
+// validateEventTypePattern 校验订阅的类型模式："*"、以 ".*" 结尾的前缀或完整的事件类型。
+func validateEventTypePattern(pattern string) error {
+	if pattern == "*" {
+		return nil
+	}
+	if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+		pattern = prefix
+	}
+	if err := validateEventType(pattern); err != nil {
+		return apperr.New(apperr.CodeValidation, "无效的事件类型模式，格式为 \"*\"、\"前缀.*\" 或完整的事件类型").WithDetails("type=" + pattern)
+	}
+	return nil
+}
+
+// validateSubscriptionSchemaVersion 校验订阅的主版本号。订阅 DreamHub 自身的某个事件类型时，
+// 主版本号必须与当前版本一致，否则订阅永远收不到事件。
+func validateSubscriptionSchemaVersion(pattern string, schemaVersion *int) error {
+	if schemaVersion == nil {
+		return nil
+	}
+	if *schemaVersion < 0 {
+		return apperr.New(apperr.CodeValidation, "schema_version 不能为负数")
+	}
+	version, ok := entity.SystemEventVersions[pattern]
+	if !ok {
+		return nil
+	}
+	major, _ := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if major != *schemaVersion {
+		return apperr.New(apperr.CodeValidation, "schema_version 与事件当前的主版本号不一致").
+			WithDetails(fmt.Sprintf("type=%s", pattern), fmt.Sprintf("dataversion=%s", version))
+	}
+	return nil
+}
+
+// validateWebhookURL 校验 webhook 地址的格式。目标地址是否允许访问在投递时检查 (域名可能解析到不同的地址)。
+func validateWebhookURL(rawURL string) error {
+	if rawURL == "" {
+		return apperr.New(apperr.CodeValidation, "webhook 订阅必须设置 webhook_url")
+	}
+	if len(rawURL) > maxWebhookURLLength {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("webhook_url 不能超过 %d 个字符", maxWebhookURLLength))
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return apperr.New(apperr.CodeValidation, "webhook_url 必须是 http 或 https 地址").WithDetails("webhook_url=" + rawURL)
+	}
+	if u.User != nil {
+		return apperr.New(apperr.CodeValidation, "webhook_url 不能包含用户名和密码")
+	}
+	return nil
+}
+
+// generateWebhookSecret 生成随机的签名密钥。
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", apperr.Wrap(err, apperr.CodeInternal, "无法生成签名密钥")
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// signWebhookBody 返回以 secret 为密钥的 HMAC-SHA256 签名 (十六进制)。
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// publishSystemEvent 在 publisher 不为 nil 时发布 DreamHub 自身的事件。
+// 事件总线不影响业务流程，发布失败只记录日志。
+func publishSystemEvent(ctx context.Context, publisher EventPublisher, userID string, eventType string, subject string, data any) {
+	if publisher == nil {
+		return
+	}
+	if err := publisher.PublishSystemEvent(ctx, userID, eventType, subject, data); err != nil {
+		logger.WarnContext(ctx, "发布内部事件失败", "error", err, "user_id", userID, "type", eventType)
+	}
+}
+
+// publishMemoryChanges 发布 dreamhub.memory.changed 事件，只有一条变化时 subject 为记忆的键。
+func publishMemoryChanges(ctx context.Context, publisher EventPublisher, userID string, changes []entity.MemoryChange) {
+	if len(changes) == 0 {
+		return
+	}
+	subject := ""
+	if len(changes) == 1 {
+		subject = changes[0].Key
+	}
+	publishSystemEvent(ctx, publisher, userID, entity.EventTypeMemoryChanged, subject, &entity.MemoryChangedEventData{Changes: changes})
+}
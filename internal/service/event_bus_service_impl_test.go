@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+// validTestEvent 返回一个可以通过校验的事件。
+func validTestEvent() *entity.Event {
+	return &entity.Event{
+		SpecVersion: entity.CloudEventsSpecVersion,
+		ID:          "evt-1",
+		Source:      "/dapps/todo",
+		Type:        "com.example.todo.created",
+		DataVersion: "2.1",
+		Data:        json.RawMessage(`{"title":"write tests"}`),
+		Extensions:  map[string]any{"region": "eu", "priority": 3.0, "urgent": true},
+	}
+}
+
+func TestValidateEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(e *entity.Event)
+		valid  bool
+	}{
+		{"valid", func(e *entity.Event) {}, true},
+		{"major version only", func(e *entity.Event) { e.DataVersion = "3" }, true},
+		{"unsupported specversion", func(e *entity.Event) { e.SpecVersion = "0.3" }, false},
+		{"missing id", func(e *entity.Event) { e.ID = "" }, false},
+		{"id too long", func(e *entity.Event) { e.ID = strings.Repeat("a", maxEventIDLength+1) }, false},
+		{"missing source", func(e *entity.Event) { e.Source = "" }, false},
+		{"missing type", func(e *entity.Event) { e.Type = "" }, false},
+		{"type with wildcard", func(e *entity.Event) { e.Type = "com.example.*" }, false},
+		{"type with space", func(e *entity.Event) { e.Type = "com.example todo" }, false},
+		{"missing dataversion", func(e *entity.Event) { e.DataVersion = "" }, false},
+		{"invalid dataversion", func(e *entity.Event) { e.DataVersion = "v1" }, false},
+		{"too many dataversion parts", func(e *entity.Event) { e.DataVersion = "1.2.3.4" }, false},
+		{"binary data", func(e *entity.Event) { e.DataBase64 = "AAEC" }, false},
+		{"data too large", func(e *entity.Event) {
+			e.Data = json.RawMessage(`"` + strings.Repeat("a", entity.MaxEventDataSize) + `"`)
+		}, false},
+		{"invalid extension name", func(e *entity.Event) { e.Extensions = map[string]any{"Region": "eu"} }, false},
+		{"extension name too long", func(e *entity.Event) { e.Extensions = map[string]any{strings.Repeat("a", 21): "x"} }, false},
+		{"object extension value", func(e *entity.Event) { e.Extensions = map[string]any{"meta": map[string]any{}} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := validTestEvent()
+			tt.modify(event)
+			err := validateEvent(event)
+			if tt.valid && err != nil {
+				t.Errorf("validateEvent() = %v, want nil", err)
+			}
+			if !tt.valid && !apperr.Is(err, apperr.CodeValidation) {
+				t.Errorf("validateEvent() = %v, want code %s", err, apperr.CodeValidation)
+			}
+		})
+	}
+}
+
+func TestValidateEventSetsDataMajor(t *testing.T) {
+	for version, major := range map[string]int{"2.1": 2, "10": 10, "0.9.1": 0} {
+		event := validTestEvent()
+		event.DataVersion = version
+		if err := validateEvent(event); err != nil {
+			t.Fatalf("validateEvent(dataversion=%s) = %v", version, err)
+		}
+		if event.DataMajor != major {
+			t.Errorf("DataMajor for dataversion %s = %d, want %d", version, event.DataMajor, major)
+		}
+	}
+}
+
+func TestSignWebhookBody(t *testing.T) {
+	tests := []struct {
+		secret string
+		body   string
+		want   string
+	}{
+		// RFC 4231 test case 2
+		{"Jefe", "what do ya want for nothing?", "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"", "", "b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad"},
+	}
+	for _, tt := range tests {
+		if got := signWebhookBody(tt.secret, []byte(tt.body)); got != tt.want {
+			t.Errorf("signWebhookBody(%q, %q) = %s, want %s", tt.secret, tt.body, got, tt.want)
+		}
+	}
+	if signWebhookBody("secret-a", []byte("{}")) == signWebhookBody("secret-b", []byte("{}")) {
+		t.Error("signatures with different secrets should differ")
+	}
+}
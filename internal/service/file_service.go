@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"io"
+	"time"
 
 	// "github.com/google/uuid" // Removed unused import
 	"github.com/soaringjerry/dreamhub/internal/entity"
@@ -11,6 +12,7 @@ import (
 // FileService 定义了处理文件上传、元数据管理和触发异步处理的业务逻辑接口。
 type FileService interface {
 	// UploadFile 处理文件上传。
+	// 0. 校验文件大小、用户存储配额和嗅探出的真实 MIME 类型 (不信任客户端的 Content-Type)。
 	// 1. 保存文件到存储 (e.g., 本地磁盘, S3)。
 	// 2. 保存文件元数据到数据库 (DocumentRepository)。
 	// 3. 将文件处理任务 (e.g., embedding) 入队 (TaskQueueClient)。
@@ -18,6 +20,13 @@ type FileService interface {
 	// 添加了 userID string 参数
 	UploadFile(ctx context.Context, userID string, filename string, fileSize int64, contentType string, fileData io.Reader) (*entity.Document, string, error) // taskID is string as Asynq returns string ID
 
+	// ImportFile 导入本地文件系统中的文件，流程与 UploadFile 相同，同时在文档中记录文件来源 (路径和修改时间)。
+	ImportFile(ctx context.Context, userID string, filename string, source entity.FileSource, fileSize int64, fileData io.Reader) (*entity.Document, string, error)
+
+	// ReplaceDocumentContent 用新内容替换已有文档的文件：删除旧的向量块和旧文件，并重新触发 Embedding。
+	// source 不为 nil 时同时更新记录的文件修改时间。返回更新后的文档和任务 ID。
+	ReplaceDocumentContent(ctx context.Context, userID string, docID string, source *entity.FileSource, fileSize int64, fileData io.Reader) (*entity.Document, string, error)
+
 	// GetDocument 获取文档元数据。
 	// 添加了 userID string 参数, docID 改为 string
 	GetDocument(ctx context.Context, userID string, docID string) (*entity.Document, error)
@@ -30,6 +39,26 @@ type FileService interface {
 	// 添加了 userID string 参数, docID 改为 string
 	DeleteDocument(ctx context.Context, userID string, docID string) error
 
+	// GetDocumentContent 获取文档元数据及原始文件内容 (已解密)。
+	// 调用方负责关闭返回的 io.ReadCloser。
+	GetDocumentContent(ctx context.Context, userID string, docID string) (*entity.Document, io.ReadCloser, error)
+
+	// ListDocumentChunks 分页列出文档被索引的文本块及其元数据。
+	ListDocumentChunks(ctx context.Context, userID string, docID string, limit int, offset int) ([]*entity.DocumentChunk, error)
+
+	// ValidateUploadSize 检查大小为 fileSize 的文件是否满足单文件上限和用户存储配额。
+	// 超出时返回 CodeValidation (HTTP 413) 错误。用于在接收数据前提前拒绝 (例如可恢复上传)。
+	ValidateUploadSize(ctx context.Context, userID string, fileSize int64) error
+
+	// GetStorageUsage 获取用户的存储用量、配额和单文件大小上限。
+	GetStorageUsage(ctx context.Context, userID string) (*entity.StorageUsage, error)
+
+	// IngestURL 从 URL 导入网页作为文档。
+	// 创建文档记录并将抓取任务入队，实际的抓取、正文提取和 Embedding 在 Worker 中完成。
+	// recrawlInterval 大于 0 时，Worker 会按该间隔重新抓取，仅在内容变化时重新生成 Embedding。
+	// 返回创建的文档实体和抓取任务 ID。
+	IngestURL(ctx context.Context, userID string, rawURL string, recrawlInterval time.Duration) (*entity.Document, string, error)
+
 	// GetTaskStatus 获取异步任务的状态 (需要 TaskRepository)。
 	// 添加了 userID string 参数 (推荐)
 	GetTaskStatus(ctx context.Context, userID string, taskID string) (*entity.Task, error)
@@ -39,9 +68,30 @@ type FileService interface {
 // 这允许我们将具体的队列实现 (如 Asynq, RabbitMQ) 解耦。
 type TaskQueueClient interface {
 	// EnqueueEmbeddingTask 将一个生成 Embedding 的任务放入队列。
-	// payload 应包含处理任务所需的所有信息，如 user_id, document_id, file_path 等。
 	// 返回由队列系统生成的任务 ID。
-	EnqueueEmbeddingTask(ctx context.Context, payload map[string]interface{}) (taskID string, err error)
+	EnqueueEmbeddingTask(ctx context.Context, payload *entity.EmbeddingTaskPayload) (taskID string, err error)
+
+	// EnqueueFetchURLTask 将一个抓取 URL 文档的任务放入队列。
+	EnqueueFetchURLTask(ctx context.Context, payload *entity.FetchURLTaskPayload) (taskID string, err error)
+
+	// EnqueueOCRTask 将一个 OCR 任务放入队列，payload 与 Embedding 任务相同。
+	// OCR 任务使用独立的超时和重试策略 (OCR_TIMEOUT_SECONDS、OCR_MAX_RETRY)。
+	EnqueueOCRTask(ctx context.Context, payload *entity.EmbeddingTaskPayload) (taskID string, err error)
+
+	// EnqueueConversationTitleTask 将一个生成对话标题的任务放入队列。
+	EnqueueConversationTitleTask(ctx context.Context, payload *entity.ConversationTitleTaskPayload) (taskID string, err error)
+
+	// EnqueueMessageEmbeddingTask 将一个为对话消息生成搜索向量的任务放入队列。
+	EnqueueMessageEmbeddingTask(ctx context.Context, payload *entity.MessageEmbeddingTaskPayload) (taskID string, err error)
+
+	// EnqueueConversationImportTask 将一个导入对话的任务放入队列。
+	EnqueueConversationImportTask(ctx context.Context, payload *entity.ConversationImportTaskPayload) (taskID string, err error)
+
+	// EnqueueMemoryExtractionTask 将一个从对话中提取用户记忆的任务放入队列。
+	EnqueueMemoryExtractionTask(ctx context.Context, payload *entity.MemoryExtractionTaskPayload) (taskID string, err error)
+
+	// EnqueueEventDeliveryTask 将一个 webhook 投递任务放入队列。
+	EnqueueEventDeliveryTask(ctx context.Context, payload *entity.EventDeliveryTaskPayload) (taskID string, err error)
 
 	// TODO: 可能需要添加其他任务类型的入队方法，例如：
 	// EnqueueSummarizationTask(...)
@@ -56,3 +106,34 @@ type FileStorage interface {
 	// GetFileReader 获取文件的 io.ReadCloser。
 	GetFileReader(ctx context.Context, storedPath string) (io.ReadCloser, error)
 }
+
+// KeyedFileStorage 是 FileStorage 的可选扩展，由提供静态加密的存储实现。
+// FileService 据此在文档元数据中记录包装数据密钥所用的主密钥 ID。
+type KeyedFileStorage interface {
+	// ActiveKeyID 返回当前用于包装新文件数据密钥的主密钥 ID。
+	ActiveKeyID() string
+}
+
+// ListableFileStorage 是 FileStorage 的可选扩展，支持遍历存储中的所有文件。
+// 定时维护任务据此找出没有文档引用的孤立文件。
+type ListableFileStorage interface {
+	// WalkFiles 对存储中的每个文件调用 fn，storedPath 与 SaveFile 返回的路径格式一致。
+	// fn 返回错误时停止遍历并返回该错误。
+	WalkFiles(ctx context.Context, fn func(storedPath string, modTime time.Time) error) error
+}
+
+// WebPageFetcher 定义了抓取网页并提取可读正文的接口。
+type WebPageFetcher interface {
+	// Fetch 下载 rawURL 指向的页面并提取正文文本。
+	// 目标不可访问、返回 4xx 或类型不受支持时返回 CodeValidation 错误 (重试无意义)，
+	// 临时性故障 (超时、5xx、429) 返回 CodeUnavailable 错误。
+	Fetch(ctx context.Context, rawURL string) (*FetchedPage, error)
+}
+
+// FetchedPage 是一次网页抓取的结果。
+type FetchedPage struct {
+	URL         string // 跟随重定向后的最终 URL
+	Title       string // 页面标题 (可能为空)
+	Text        string // 提取出的可读正文
+	ContentType string // 源站返回的 MIME 类型
+}
@@ -1,8 +1,19 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
 
 	// "github.com/google/uuid" // Removed unused import
 	"github.com/soaringjerry/dreamhub/internal/entity"
@@ -10,9 +21,21 @@ import (
 
 	// "github.com/soaringjerry/dreamhub/internal/repository/postgres" // Avoid dependency on specific implementation details like GetUserIDFromCtx
 	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
 	"github.com/soaringjerry/dreamhub/pkg/logger"
 )
 
+const (
+	// sniffLen 是 MIME 嗅探时读取的文件头字节数 (与 mimetype 的默认读取上限一致)。
+	sniffLen = 3072
+	// URL 导入的限制
+	maxSourceURLLength = 2048
+	minRecrawlInterval = 15 * time.Minute
+	maxRecrawlInterval = 30 * 24 * time.Hour
+	// urlSnapshotContentType 是 URL 文档快照的类型 (Worker 将提取出的正文保存为 Markdown)。
+	urlSnapshotContentType = "text/markdown"
+)
+
 // fileServiceImpl 是 FileService 接口的实现。
 type fileServiceImpl struct {
 	fileStorage FileStorage                   // 文件存储接口
@@ -20,6 +43,10 @@ type fileServiceImpl struct {
 	taskRepo    repository.TaskRepository     // 任务状态仓库
 	taskQueue   TaskQueueClient               // 任务队列客户端
 	vectorRepo  repository.VectorRepository   // 向量仓库 (用于删除)
+	// 上传校验配置
+	maxUploadSize    int64    // 单个文件的最大字节数
+	allowedMIMETypes []string // 允许的 MIME 类型
+	storageQuota     int64    // 每个用户的存储配额，0 表示不限制
 }
 
 // NewFileService 创建一个新的 fileServiceImpl 实例。
@@ -29,37 +56,78 @@ func NewFileService(
 	tr repository.TaskRepository,
 	tq TaskQueueClient,
 	vr repository.VectorRepository,
+	cfg *config.Config,
 ) FileService {
 	return &fileServiceImpl{
-		fileStorage: fs,
-		docRepo:     dr,
-		taskRepo:    tr,
-		taskQueue:   tq,
-		vectorRepo:  vr,
+		fileStorage:      fs,
+		docRepo:          dr,
+		taskRepo:         tr,
+		taskQueue:        tq,
+		vectorRepo:       vr,
+		maxUploadSize:    cfg.MaxUploadSizeBytes,
+		allowedMIMETypes: cfg.AllowedUploadMIMETypes,
+		storageQuota:     cfg.UserStorageQuotaBytes,
 	}
 }
 
 // UploadFile 处理文件上传，保存文件和元数据，并触发 Embedding 任务。
 // Added userID string parameter
 func (s *fileServiceImpl) UploadFile(ctx context.Context, userID string, filename string, fileSize int64, contentType string, fileData io.Reader) (*entity.Document, string, error) {
+	return s.uploadFile(ctx, userID, filename, fileSize, contentType, fileData, nil)
+}
+
+// ImportFile 导入本地文件，与 UploadFile 相同，但同时记录文件来源。
+func (s *fileServiceImpl) ImportFile(ctx context.Context, userID string, filename string, source entity.FileSource, fileSize int64, fileData io.Reader) (*entity.Document, string, error) {
+	return s.uploadFile(ctx, userID, filename, fileSize, "", fileData, &source)
+}
+
+// uploadFile 是 UploadFile 和 ImportFile 的共同实现，source 不为 nil 时记录文件来源。
+func (s *fileServiceImpl) uploadFile(ctx context.Context, userID string, filename string, fileSize int64, contentType string, fileData io.Reader, source *entity.FileSource) (*entity.Document, string, error) {
 	// userID is now passed explicitly, no need to extract from context here.
 	// userID, err := postgres.GetUserIDFromCtx(ctx) // REMOVED
 	// if err != nil {
 	// 	return nil, "", err
 	// }
 
+	// 0. 上传校验：大小上限、存储配额和真实 MIME 类型
+	limit, err := s.checkUploadLimit(ctx, userID, fileSize, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	detectedType, fileData, err := s.detectContentType(ctx, filename, contentType, fileData)
+	if err != nil {
+		return nil, "", err
+	}
+
 	// 1. 保存文件到存储 (SaveFile already accepts userID string)
-	storedPath, err := s.fileStorage.SaveFile(ctx, userID, filename, fileData)
+	// 边写入边计数，超出限制时中止，不依赖客户端声明的大小
+	// 同时计算内容哈希
+	limited := &limitedReader{r: fileData, remaining: limit.maxBytes, limitErr: limit.exceededErr}
+	hasher := sha256.New()
+	storedPath, err := s.fileStorage.SaveFile(ctx, userID, filename, io.TeeReader(limited, hasher))
 	if err != nil {
+		if limited.exceeded {
+			logger.WarnContext(ctx, "上传文件超出大小限制，已中止写入", "user_id", userID, "filename", filename, "limit", limit.maxBytes)
+			return nil, "", limit.exceededErr
+		}
 		// SaveFile 内部已经记录了错误日志
 		return nil, "", err // 错误已经被包装
 	}
 
-	// 2. 创建并保存文件元数据
-	doc := entity.NewDocument(userID, filename, storedPath, fileSize, contentType)
-	// 可以在这里计算文件哈希用于去重 (可选)
-	// doc.FileHash = calculateHash(storedPath)
-	// existingDoc, _ := s.docRepo.GetDocumentByHash(ctx, userID, doc.FileHash)
+	// 2. 创建并保存文件元数据 (使用实际写入的大小和嗅探出的类型)
+	doc := entity.NewDocument(userID, filename, storedPath, limited.read, detectedType)
+	if keyed, ok := s.fileStorage.(KeyedFileStorage); ok {
+		keyID := keyed.ActiveKeyID()
+		doc.EncryptionKeyID = &keyID // 记录包装数据密钥所用的主密钥，便于轮换时追踪
+	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	doc.ContentHash = &contentHash
+	if source != nil {
+		doc.SourcePath = &source.Path
+		doc.SourceModifiedAt = &source.ModifiedAt
+	}
+	// 可以基于 ContentHash 实现去重 (可选)
+	// existingDoc, _ := s.docRepo.GetDocumentByHash(ctx, userID, contentHash)
 	// if existingDoc != nil { /* 处理重复文件逻辑 */ }
 
 	if err := s.docRepo.SaveDocument(ctx, doc); err != nil {
@@ -72,19 +140,122 @@ func (s *fileServiceImpl) UploadFile(ctx context.Context, userID string, filenam
 		return nil, "", err // 返回保存元数据的错误
 	}
 
-	// 3. 将 Embedding 任务入队
-	// 准备任务 payload
-	taskPayload := map[string]interface{}{
-		"user_id":      userID, // Use the passed userID string
-		"document_id":  doc.ID, // Assuming doc.ID is now string UUID
-		"file_path":    storedPath,
-		"filename":     filename,
-		"content_type": contentType,
+	// 3. 将 Embedding 任务入队，并更新文档状态为 Pending
+	// 本地目录同步属于批量导入，进入 bulk 队列，避免挤占用户直接上传的文件
+	taskID, err := s.enqueueEmbedding(ctx, userID, doc, detectedType, sourcePriority(source))
+	if err != nil {
+		if apperr.Is(err, apperr.CodeRateLimited) {
+			// 队列积压时回滚，客户端 (或下一次目录同步) 稍后重试即可，不留下失败的文档
+			s.rollbackDocument(ctx, userID, doc)
+			return nil, "", err
+		}
+		return doc, "", err // 返回文档信息和入队错误
+	}
+
+	logger.InfoContext(ctx, "文件上传处理完成，任务已入队", "document_id", doc.ID, "task_id", taskID) // Log string doc.ID
+	return doc, taskID, nil
+}
+
+// ReplaceDocumentContent 用新内容替换已有文档的文件。
+// 新文件写入文档记录后才会删除旧的向量块和旧文件，在此之前任何一步失败都保留原有内容。
+func (s *fileServiceImpl) ReplaceDocumentContent(ctx context.Context, userID string, docID string, source *entity.FileSource, fileSize int64, fileData io.Reader) (*entity.Document, string, error) {
+	doc, err := s.docRepo.GetDocumentByID(ctx, userID, docID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit, err := s.checkUploadLimit(ctx, userID, fileSize, doc.FileSize) // 旧文件将被删除，不计入配额
+	if err != nil {
+		return nil, "", err
+	}
+	detectedType, fileData, err := s.detectContentType(ctx, doc.OriginalFilename, "", fileData)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limited := &limitedReader{r: fileData, remaining: limit.maxBytes, limitErr: limit.exceededErr}
+	hasher := sha256.New()
+	storedPath, err := s.fileStorage.SaveFile(ctx, userID, doc.OriginalFilename, io.TeeReader(limited, hasher))
+	if err != nil {
+		if limited.exceeded {
+			return nil, "", limit.exceededErr
+		}
+		return nil, "", err
+	}
+
+	snapshot := &repository.DocumentSnapshot{
+		StoredPath:  storedPath,
+		FileSize:    limited.read,
+		ContentType: detectedType,
+		ContentHash: hex.EncodeToString(hasher.Sum(nil)),
+		FetchedAt:   time.Now(),
+	}
+	if keyed, ok := s.fileStorage.(KeyedFileStorage); ok {
+		keyID := keyed.ActiveKeyID()
+		snapshot.EncryptionKeyID = &keyID
+	}
+	if source != nil {
+		snapshot.SourceModifiedAt = &source.ModifiedAt
+	}
+	if err := s.docRepo.UpdateDocumentSnapshot(ctx, userID, doc.ID, snapshot); err != nil {
+		s.deleteStoredFile(ctx, storedPath)
+		return nil, "", err
+	}
+	if doc.StoredPath != "" {
+		s.deleteStoredFile(ctx, doc.StoredPath)
+	}
+	doc.StoredPath, doc.FileSize, doc.ContentType = storedPath, snapshot.FileSize, snapshot.ContentType
+	doc.ContentHash, doc.EncryptionKeyID = &snapshot.ContentHash, snapshot.EncryptionKeyID
+	doc.SourceModifiedAt = snapshot.SourceModifiedAt
+
+	// 删除旧的向量块，避免新旧内容同时出现在检索结果中。
+	// 删除失败时旧向量块仍可检索，将文档标记为失败，不再为新内容建立索引。
+	if err := s.vectorRepo.DeleteChunksByDocumentID(ctx, userID, doc.ID); err != nil {
+		if updateErr := s.docRepo.UpdateDocumentStatus(ctx, userID, doc.ID, entity.TaskStatusFailed, nil, "Failed to delete previous chunks"); updateErr != nil {
+			logger.ErrorContext(ctx, "删除旧向量块失败后更新文档状态也失败", "update_error", updateErr, "original_error", err, "document_id", doc.ID)
+		}
+		return doc, "", err
+	}
+
+	taskID, err := s.enqueueEmbedding(ctx, userID, doc, detectedType, sourcePriority(source))
+	if err != nil {
+		return doc, "", err
 	}
+	logger.InfoContext(ctx, "文档内容已替换，任务已入队", "document_id", doc.ID, "task_id", taskID)
+	return doc, taskID, nil
+}
 
+// deleteStoredFile 删除存储中的文件，失败时只记录日志。
+func (s *fileServiceImpl) deleteStoredFile(ctx context.Context, storedPath string) {
+	if err := s.fileStorage.DeleteFile(ctx, storedPath); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+		logger.WarnContext(ctx, "删除存储文件失败", "error", err, "stored_path", storedPath)
+	}
+}
+
+// sourcePriority 返回文档处理任务的优先级：从本地目录同步的文件为 bulk，用户上传的文件为 interactive。
+func sourcePriority(source *entity.FileSource) entity.TaskPriority {
+	if source != nil {
+		return entity.TaskPriorityBulk
+	}
+	return entity.TaskPriorityInteractive
+}
+
+// rollbackDocument 删除刚创建的文档记录及其存储文件，失败时只记录日志。
+func (s *fileServiceImpl) rollbackDocument(ctx context.Context, userID string, doc *entity.Document) {
+	if err := s.docRepo.DeleteDocument(ctx, userID, doc.ID); err != nil {
+		logger.ErrorContext(ctx, "回滚删除文档记录失败", "error", err, "document_id", doc.ID)
+		return // 保留文件，避免文档记录指向不存在的文件
+	}
+	if doc.StoredPath != "" {
+		s.deleteStoredFile(ctx, doc.StoredPath)
+	}
+}
+
+// enqueueEmbedding 将文档的 Embedding 任务入队，并更新文档状态为 Pending。
+// 入队失败时将文档标记为失败并返回错误。
+func (s *fileServiceImpl) enqueueEmbedding(ctx context.Context, userID string, doc *entity.Document, contentType string, priority entity.TaskPriority) (string, error) {
 	// 使用 TaskQueueClient 入队
-	// TODO: 从 queue 包引入 TypeEmbedding 常量
-	taskID, err := s.taskQueue.EnqueueEmbeddingTask(ctx, taskPayload)
+	taskID, err := s.taskQueue.EnqueueEmbeddingTask(ctx, entity.NewEmbeddingTaskPayload(doc, contentType, priority))
 	if err != nil {
 		// 如果入队失败，这是一个严重问题，可能需要标记文档状态为错误
 		// 或者尝试回滚数据库记录和文件删除 (更复杂)
@@ -96,7 +267,7 @@ func (s *fileServiceImpl) UploadFile(ctx context.Context, userID string, filenam
 			logger.ErrorContext(ctx, "入队失败后更新文档状态也失败", "update_error", updateErr, "original_error", err, "document_id", doc.ID, "user_id", userID) // Log string doc.ID and userID
 		}
 		// 返回入队错误
-		return doc, "", err // 返回文档信息和入队错误
+		return "", err
 	}
 
 	// 4. (可选) 创建 Task 实体并保存到数据库 (如果需要持久化任务状态)
@@ -121,11 +292,212 @@ func (s *fileServiceImpl) UploadFile(ctx context.Context, userID string, filenam
 		logger.ErrorContext(ctx, "更新文档状态为 Pending 并关联 TaskID 失败", "error", updateErr, "document_id", doc.ID, "user_id", userID, "task_id", taskID) // Log string doc.ID and userID
 		// 记录错误，但不阻塞返回
 	}
+	return taskID, nil
+}
 
-	logger.InfoContext(ctx, "文件上传处理完成，任务已入队", "document_id", doc.ID, "task_id", taskID) // Log string doc.ID
+// uploadLimit 描述一次上传允许写入的最大字节数，以及超出时返回的错误。
+type uploadLimit struct {
+	maxBytes    int64
+	exceededErr error
+}
+
+// checkUploadLimit 根据单文件上限和用户剩余配额计算本次上传的限制。
+// reclaimed 是写入成功后将被释放的字节数 (替换已有文件时为旧文件大小)。
+// 已知的 fileSize 超出限制时直接拒绝。配额检查与写入之间没有加锁，并发上传可能略微超出配额。
+func (s *fileServiceImpl) checkUploadLimit(ctx context.Context, userID string, fileSize int64, reclaimed int64) (uploadLimit, error) {
+	limit := s.maxUploadSize
+	limitErr := apperr.New(apperr.CodeValidation, "文件大小超出上限").
+		WithDetails(fmt.Sprintf("max_upload_size_bytes=%d", s.maxUploadSize)).
+		WithHTTPStatus(http.StatusRequestEntityTooLarge)
+	if fileSize > limit {
+		logger.WarnContext(ctx, "上传文件超出大小限制", "user_id", userID, "file_size", fileSize, "limit", limit)
+		return uploadLimit{}, limitErr
+	}
+	if s.storageQuota <= 0 {
+		return uploadLimit{maxBytes: limit, exceededErr: limitErr}, nil
+	}
+
+	used, err := s.docRepo.GetUserStorageUsage(ctx, userID)
+	if err != nil {
+		return uploadLimit{}, err
+	}
+	remaining := s.storageQuota - used + reclaimed
+	quotaErr := apperr.New(apperr.CodeValidation, "存储空间不足，已超出用户存储配额").
+		WithDetails(fmt.Sprintf("used_bytes=%d", used), fmt.Sprintf("quota_bytes=%d", s.storageQuota)).
+		WithHTTPStatus(http.StatusRequestEntityTooLarge)
+	if remaining <= 0 || fileSize > remaining {
+		logger.WarnContext(ctx, "用户存储配额不足", "user_id", userID, "file_size", fileSize, "used", used, "quota", s.storageQuota)
+		return uploadLimit{}, quotaErr
+	}
+	if remaining < limit {
+		return uploadLimit{maxBytes: remaining, exceededErr: quotaErr}, nil
+	}
+	return uploadLimit{maxBytes: limit, exceededErr: limitErr}, nil
+}
+
+// detectContentType 通过内容嗅探确定文件的真实 MIME 类型并校验是否在允许列表中。
+// 返回的 io.Reader 会重新拼接已读取的文件头，调用方应使用它继续读取文件。
+func (s *fileServiceImpl) detectContentType(ctx context.Context, filename string, declaredType string, fileData io.Reader) (string, io.Reader, error) {
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(fileData, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		logger.ErrorContext(ctx, "读取上传文件头失败", "error", err, "filename", filename)
+		return "", nil, apperr.Wrap(err, apperr.CodeInternal, "无法读取上传的文件")
+	}
+	header = header[:n]
+
+	detected := mimetype.Detect(header)
+	for _, allowed := range s.allowedMIMETypes {
+		if detected.Is(allowed) {
+			if declaredType != "" && !detected.Is(declaredType) {
+				logger.DebugContext(ctx, "客户端声明的 Content-Type 与嗅探结果不一致，使用嗅探结果", "declared", declaredType, "detected", detected.String(), "filename", filename)
+			}
+			return detected.String(), io.MultiReader(bytes.NewReader(header), fileData), nil
+		}
+	}
+
+	logger.WarnContext(ctx, "拒绝不支持的文件类型", "filename", filename, "declared", declaredType, "detected", detected.String())
+	return "", nil, apperr.New(apperr.CodeValidation, "不支持的文件类型").
+		WithDetails("detected_type=" + detected.String()).
+		WithHTTPStatus(http.StatusUnsupportedMediaType)
+}
+
+// limitedReader 在读取超过 remaining 字节时返回 limitErr，并记录已读取的字节数。
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	limitErr  error
+	read      int64
+	exceeded  bool
+}
+
+// Read 实现 io.Reader。
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// 已达到上限：再多读 1 字节以区分“恰好等于上限”和“超出上限”
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			l.exceeded = true
+			return 0, l.limitErr
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	l.read += int64(n)
+	return n, err
+}
+
+// ValidateUploadSize 检查文件大小是否满足单文件上限和用户存储配额。
+func (s *fileServiceImpl) ValidateUploadSize(ctx context.Context, userID string, fileSize int64) error {
+	_, err := s.checkUploadLimit(ctx, userID, fileSize, 0)
+	return err
+}
+
+// IngestURL 创建一个 URL 文档并将抓取任务入队。
+// 此时文档还没有存储文件，Worker 抓取成功后写入快照并触发 Embedding。
+func (s *fileServiceImpl) IngestURL(ctx context.Context, userID string, rawURL string, recrawlInterval time.Duration) (*entity.Document, string, error) {
+	sourceURL, err := normalizeSourceURL(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if recrawlInterval != 0 && (recrawlInterval < minRecrawlInterval || recrawlInterval > maxRecrawlInterval) {
+		return nil, "", apperr.New(apperr.CodeValidation, "重新抓取间隔无效").
+			WithDetails(fmt.Sprintf("min_minutes=%d", int(minRecrawlInterval.Minutes())), fmt.Sprintf("max_minutes=%d", int(maxRecrawlInterval.Minutes())))
+	}
+	// 网页大小在抓取前未知，这里只确认用户还有剩余配额；Worker 抓取时按单文件上限截断
+	if err := s.ValidateUploadSize(ctx, userID, 0); err != nil {
+		return nil, "", err
+	}
+
+	doc := entity.NewDocument(userID, sourceURLFilename(sourceURL), "", 0, urlSnapshotContentType)
+	sourceURLStr := sourceURL.String()
+	doc.SourceURL = &sourceURLStr
+	doc.RecrawlIntervalMinutes = int(recrawlInterval / time.Minute)
+	if recrawlInterval > 0 {
+		nextCrawlAt := doc.UploadTime.Add(recrawlInterval)
+		doc.NextCrawlAt = &nextCrawlAt
+	}
+	if err := s.docRepo.SaveDocument(ctx, doc); err != nil {
+		return nil, "", err
+	}
+
+	taskID, err := s.taskQueue.EnqueueFetchURLTask(ctx, &entity.FetchURLTaskPayload{UserID: userID, DocumentID: doc.ID, Priority: entity.TaskPriorityInteractive})
+	if err != nil {
+		if apperr.Is(err, apperr.CodeRateLimited) {
+			s.rollbackDocument(ctx, userID, doc)
+			return nil, "", err
+		}
+		logger.ErrorContext(ctx, "将 URL 抓取任务入队失败", "error", err, "document_id", doc.ID)
+		if updateErr := s.docRepo.UpdateDocumentStatus(ctx, userID, doc.ID, entity.TaskStatusFailed, nil, "Failed to enqueue fetch task"); updateErr != nil {
+			logger.ErrorContext(ctx, "入队失败后更新文档状态也失败", "update_error", updateErr, "original_error", err, "document_id", doc.ID, "user_id", userID)
+		}
+		return doc, "", err
+	}
+	if updateErr := s.docRepo.UpdateDocumentStatus(ctx, userID, doc.ID, entity.TaskStatusPending, &taskID, ""); updateErr != nil {
+		logger.ErrorContext(ctx, "更新文档状态为 Pending 并关联 TaskID 失败", "error", updateErr, "document_id", doc.ID, "user_id", userID, "task_id", taskID)
+	}
+	doc.ProcessingTaskID = &taskID
+
+	logger.InfoContext(ctx, "URL 文档已创建，抓取任务已入队", "document_id", doc.ID, "url", sourceURLStr, "task_id", taskID, "recrawl_interval_minutes", doc.RecrawlIntervalMinutes)
 	return doc, taskID, nil
 }
 
+// normalizeSourceURL 校验并规范化待导入的 URL：只允许 http/https，去掉片段和用户信息。
+// 目标地址是否为内网由 Worker 中的抓取器在建立连接时检查。
+func normalizeSourceURL(rawURL string) (*url.URL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" || len(rawURL) > maxSourceURLLength {
+		return nil, apperr.New(apperr.CodeValidation, "URL 为空或过长")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeValidation, "无效的 URL")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, apperr.New(apperr.CodeValidation, "只支持 http 和 https 协议的 URL")
+	}
+	if u.Hostname() == "" {
+		return nil, apperr.New(apperr.CodeValidation, "URL 缺少主机名")
+	}
+	if u.User != nil {
+		return nil, apperr.New(apperr.CodeValidation, "URL 不能包含用户名或密码")
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment, u.RawFragment = "", ""
+	return u, nil
+}
+
+// sourceURLFilename 根据 URL 生成文档的显示名称，例如 "example.com/blog/post"。
+func sourceURLFilename(u *url.URL) string {
+	name := u.Hostname()
+	if p := strings.Trim(path.Clean("/"+u.Path), "/"); p != "" {
+		name += "/" + p
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
+
+// GetStorageUsage 获取用户的存储用量和上传限制。
+func (s *fileServiceImpl) GetStorageUsage(ctx context.Context, userID string) (*entity.StorageUsage, error) {
+	used, err := s.docRepo.GetUserStorageUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.StorageUsage{
+		UsedBytes:          used,
+		QuotaBytes:         s.storageQuota,
+		MaxUploadSizeBytes: s.maxUploadSize,
+	}, nil
+}
+
 // GetDocument 获取文档元数据。
 // Added userID string, changed docID to string
 func (s *fileServiceImpl) GetDocument(ctx context.Context, userID string, docID string) (*entity.Document, error) {
@@ -150,6 +522,38 @@ func (s *fileServiceImpl) ListUserDocuments(ctx context.Context, userID string,
 	return docs, nil
 }
 
+// GetDocumentContent 获取文档元数据，并打开其原始文件。
+func (s *fileServiceImpl) GetDocumentContent(ctx context.Context, userID string, docID string) (*entity.Document, io.ReadCloser, error) {
+	doc, err := s.docRepo.GetDocumentByID(ctx, userID, docID) // 同时校验文档归属
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.StoredPath == "" {
+		return nil, nil, apperr.ErrNotFound("文档没有关联的文件")
+	}
+
+	content, err := s.fileStorage.GetFileReader(ctx, doc.StoredPath)
+	if err != nil {
+		// GetFileReader 内部已记录日志和包装错误
+		return nil, nil, err
+	}
+	return doc, content, nil
+}
+
+// ListDocumentChunks 列出文档已索引的文本块。
+func (s *fileServiceImpl) ListDocumentChunks(ctx context.Context, userID string, docID string, limit int, offset int) ([]*entity.DocumentChunk, error) {
+	// 先确认文档存在且属于该用户，避免对不存在的文档返回空列表
+	doc, err := s.docRepo.GetDocumentByID(ctx, userID, docID)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := s.vectorRepo.ListChunksByDocumentID(ctx, userID, doc.ID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
 // DeleteDocument 删除文档及其关联数据。
 // Added userID string, changed docID to string
 func (s *fileServiceImpl) DeleteDocument(ctx context.Context, userID string, docID string) error {
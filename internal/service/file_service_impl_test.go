@@ -0,0 +1,347 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+// fakeDocumentRepo 只实现测试用到的方法，调用其他方法会 panic。
+type fakeDocumentRepo struct {
+	repository.DocumentRepository
+	usage       int64
+	saved       []*entity.Document
+	doc         *entity.Document
+	snapshots   []*repository.DocumentSnapshot
+	snapshotErr error
+	statuses    []entity.TaskStatus
+}
+
+func (f *fakeDocumentRepo) GetDocumentByID(ctx context.Context, userID string, docID string) (*entity.Document, error) {
+	if f.doc == nil || f.doc.ID != docID {
+		return nil, apperr.ErrNotFound("文档未找到")
+	}
+	doc := *f.doc
+	return &doc, nil
+}
+
+func (f *fakeDocumentRepo) UpdateDocumentSnapshot(ctx context.Context, userID string, docID string, snapshot *repository.DocumentSnapshot) error {
+	if f.snapshotErr != nil {
+		return f.snapshotErr
+	}
+	f.snapshots = append(f.snapshots, snapshot)
+	return nil
+}
+
+func (f *fakeDocumentRepo) GetUserStorageUsage(ctx context.Context, userID string) (int64, error) {
+	return f.usage, nil
+}
+
+func (f *fakeDocumentRepo) SaveDocument(ctx context.Context, doc *entity.Document) error {
+	f.saved = append(f.saved, doc)
+	return nil
+}
+
+func (f *fakeDocumentRepo) UpdateDocumentStatus(ctx context.Context, userID string, docID string, status entity.TaskStatus, taskID *string, errMsg string) error {
+	f.statuses = append(f.statuses, status)
+	return nil
+}
+
+// fakeVectorRepo 记录删除向量块时文档快照是否已经更新。
+type fakeVectorRepo struct {
+	repository.VectorRepository
+	docRepo          *fakeDocumentRepo
+	deleteErr        error
+	deletedSnapshots []int // 每次删除时已写入的快照数量
+}
+
+func (f *fakeVectorRepo) DeleteChunksByDocumentID(ctx context.Context, userID string, documentID string) error {
+	f.deletedSnapshots = append(f.deletedSnapshots, len(f.docRepo.snapshots))
+	return f.deleteErr
+}
+
+// fakeTaskQueue 只实现测试用到的方法，记录入队的 Embedding 任务。
+type fakeTaskQueue struct {
+	TaskQueueClient
+	embeddings []*entity.EmbeddingTaskPayload
+}
+
+func (f *fakeTaskQueue) EnqueueEmbeddingTask(ctx context.Context, payload *entity.EmbeddingTaskPayload) (string, error) {
+	f.embeddings = append(f.embeddings, payload)
+	return "task-1", nil
+}
+
+// fakeFileStorage 在内存中保存文件，SaveFile 会读完整个 reader。
+type fakeFileStorage struct {
+	files   map[string][]byte
+	deleted []string
+}
+
+func (f *fakeFileStorage) SaveFile(ctx context.Context, userID string, filename string, fileData io.Reader) (string, error) {
+	data, err := io.ReadAll(fileData)
+	if err != nil {
+		return "", err
+	}
+	if f.files == nil {
+		f.files = make(map[string][]byte)
+	}
+	storedPath := userID + "/" + filename
+	f.files[storedPath] = data
+	return storedPath, nil
+}
+
+func (f *fakeFileStorage) DeleteFile(ctx context.Context, storedPath string) error {
+	f.deleted = append(f.deleted, storedPath)
+	delete(f.files, storedPath)
+	return nil
+}
+
+func (f *fakeFileStorage) GetFileReader(ctx context.Context, storedPath string) (io.ReadCloser, error) {
+	data, ok := f.files[storedPath]
+	if !ok {
+		return nil, apperr.ErrNotFound("文件不存在")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestCheckUploadLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		quota     int64
+		used      int64
+		fileSize  int64
+		reclaimed int64
+		wantMax   int64
+		wantQuota bool // 是否以配额错误作为超限错误
+		wantErr   bool
+	}{
+		{"no quota", 0, 5000, 100, 0, 1000, false, false},
+		{"unknown size", 0, 0, 0, 0, 1000, false, false},
+		{"over max size", 0, 0, 1001, 0, 0, false, true},
+		{"exactly max size", 0, 0, 1000, 0, 1000, false, false},
+		{"quota larger than max size", 10000, 100, 500, 0, 1000, false, false},
+		{"quota remaining below max size", 1000, 700, 200, 0, 300, true, false},
+		{"file larger than remaining quota", 1000, 700, 301, 0, 0, true, true},
+		{"quota used up", 1000, 1000, 0, 0, 0, true, true},
+		{"quota exceeded", 1000, 1200, 0, 0, 0, true, true},
+		{"reclaimed bytes count toward remaining quota", 1000, 1000, 400, 500, 500, true, false},
+		{"reclaimed bytes not enough", 1000, 1000, 600, 500, 0, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fileServiceImpl{docRepo: &fakeDocumentRepo{usage: tt.used}, maxUploadSize: 1000, storageQuota: tt.quota}
+			limit, err := s.checkUploadLimit(context.Background(), "user-1", tt.fileSize, tt.reclaimed)
+			if tt.wantErr {
+				if !apperr.Is(err, apperr.CodeValidation) || apperr.GetHTTPStatus(err) != http.StatusRequestEntityTooLarge {
+					t.Fatalf("checkUploadLimit() error = %v, want a 413 validation error", err)
+				}
+				if isQuota := strings.Contains(err.Error(), "配额"); isQuota != tt.wantQuota {
+					t.Errorf("checkUploadLimit() error = %v, want quota error %v", err, tt.wantQuota)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkUploadLimit() error = %v", err)
+			}
+			if limit.maxBytes != tt.wantMax {
+				t.Errorf("maxBytes = %d, want %d", limit.maxBytes, tt.wantMax)
+			}
+			if isQuota := strings.Contains(limit.exceededErr.Error(), "配额"); isQuota != tt.wantQuota {
+				t.Errorf("exceededErr = %v, want quota error %v", limit.exceededErr, tt.wantQuota)
+			}
+		})
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	s := &fileServiceImpl{allowedMIMETypes: []string{"text/plain", "application/pdf", "image/png"}}
+	longText := strings.Repeat("plain text line\n", sniffLen/8)
+	tests := []struct {
+		name     string
+		content  string
+		declared string
+		wantType string // 空表示应被拒绝
+	}{
+		{"plain text", "hello world\n", "", "text/plain; charset=utf-8"},
+		{"text longer than the sniffed header", longText, "text/plain", "text/plain; charset=utf-8"},
+		{"pdf", "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n", "application/pdf", "application/pdf"},
+		{"png declared as text", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "text/plain", "image/png"},
+		{"zip", "PK\x03\x04\x14\x00\x00\x00\x08\x00", "text/plain", ""},
+		{"executable", "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotType, r, err := s.detectContentType(context.Background(), "file", tt.declared, strings.NewReader(tt.content))
+			if tt.wantType == "" {
+				if !apperr.Is(err, apperr.CodeValidation) || apperr.GetHTTPStatus(err) != http.StatusUnsupportedMediaType {
+					t.Errorf("detectContentType() error = %v, want a 415 validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("detectContentType() error = %v", err)
+			}
+			if gotType != tt.wantType {
+				t.Errorf("detectContentType() type = %q, want %q", gotType, tt.wantType)
+			}
+			// 返回的 reader 必须仍然包含完整内容，包括已嗅探的文件头
+			data, err := io.ReadAll(r)
+			if err != nil || string(data) != tt.content {
+				t.Errorf("detectContentType() reader returned %d bytes (err %v), want the full %d-byte content", len(data), err, len(tt.content))
+			}
+		})
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	errLimit := errors.New("limit exceeded")
+	tests := []struct {
+		name     string
+		size     int
+		limit    int64
+		exceeded bool
+	}{
+		{"below limit", 99, 100, false},
+		{"exactly at limit", 100, 100, false},
+		{"one byte over", 101, 100, true},
+		{"far over", 10000, 100, true},
+		{"empty", 0, 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// OneByteReader 让上限在流的中途被触发，而不是在第一次读取时
+			src := iotest.OneByteReader(strings.NewReader(strings.Repeat("a", tt.size)))
+			l := &limitedReader{r: src, remaining: tt.limit, limitErr: errLimit}
+			data, err := io.ReadAll(l)
+			if tt.exceeded {
+				if !errors.Is(err, errLimit) || !l.exceeded {
+					t.Fatalf("ReadAll() error = %v, exceeded = %v, want the limit error", err, l.exceeded)
+				}
+				if l.read != tt.limit {
+					t.Errorf("read = %d, want %d", l.read, tt.limit)
+				}
+				return
+			}
+			if err != nil || l.exceeded {
+				t.Fatalf("ReadAll() error = %v, exceeded = %v", err, l.exceeded)
+			}
+			if len(data) != tt.size || l.read != int64(tt.size) {
+				t.Errorf("read %d bytes (counted %d), want %d", len(data), l.read, tt.size)
+			}
+		})
+	}
+}
+
+func TestUploadFileStopsAtLimitMidStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		quota   int64
+		used    int64
+		content string
+		wantErr string // 空表示应上传成功
+	}{
+		{"within limits", 0, 0, strings.Repeat("a", 1000), ""},
+		{"over max upload size", 0, 0, strings.Repeat("a", 1001), "上限"},
+		{"over remaining quota", 1000, 900, strings.Repeat("a", 101), "配额"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docRepo := &fakeDocumentRepo{usage: tt.used}
+			storage := &fakeFileStorage{}
+			s := &fileServiceImpl{
+				fileStorage:      storage,
+				docRepo:          docRepo,
+				taskQueue:        &fakeTaskQueue{},
+				allowedMIMETypes: []string{"text/plain"},
+				maxUploadSize:    1000,
+				storageQuota:     tt.quota,
+			}
+			// 客户端声明的大小为 0 (未知)，只能在写入过程中发现超限
+			doc, _, err := s.UploadFile(context.Background(), "user-1", "notes.txt", 0, "text/plain", strings.NewReader(tt.content))
+			if tt.wantErr == "" {
+				if err != nil || doc.FileSize != int64(len(tt.content)) {
+					t.Fatalf("UploadFile() doc = %+v, error = %v, want a %d-byte document", doc, err, len(tt.content))
+				}
+				return
+			}
+			if apperr.GetHTTPStatus(err) != http.StatusRequestEntityTooLarge || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("UploadFile() error = %v, want a 413 error mentioning %q", err, tt.wantErr)
+			}
+			if len(docRepo.saved) != 0 || len(storage.files) != 0 {
+				t.Errorf("UploadFile() saved %d documents and %d files, want none", len(docRepo.saved), len(storage.files))
+			}
+		})
+	}
+}
+
+func TestReplaceDocumentContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		snapshotErr error
+		deleteErr   error
+		wantErr     bool
+		wantDeletes int  // 删除向量块的次数
+		wantQueued  bool // 是否为新内容入队 Embedding 任务
+		wantFailed  bool // 是否将文档标记为失败
+		wantOldFile bool // 旧文件是否保留
+	}{
+		{"replaced", nil, nil, false, 1, true, false, false},
+		{"snapshot update fails", apperr.New(apperr.CodeInternal, "db down"), nil, true, 0, false, false, true},
+		{"chunk deletion fails", nil, apperr.New(apperr.CodeInternal, "db down"), true, 1, false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &fakeFileStorage{files: map[string][]byte{"user-1/old.txt": []byte("old content")}}
+			docRepo := &fakeDocumentRepo{
+				doc:         &entity.Document{ID: "doc-1", UserID: "user-1", OriginalFilename: "notes.txt", StoredPath: "user-1/old.txt", FileSize: 11},
+				snapshotErr: tt.snapshotErr,
+			}
+			vectorRepo := &fakeVectorRepo{docRepo: docRepo, deleteErr: tt.deleteErr}
+			queue := &fakeTaskQueue{}
+			s := &fileServiceImpl{
+				fileStorage:      storage,
+				docRepo:          docRepo,
+				vectorRepo:       vectorRepo,
+				taskQueue:        queue,
+				allowedMIMETypes: []string{"text/plain"},
+				maxUploadSize:    1000,
+			}
+
+			_, _, err := s.ReplaceDocumentContent(context.Background(), "user-1", "doc-1", nil, 0, strings.NewReader("new content"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReplaceDocumentContent() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(vectorRepo.deletedSnapshots) != tt.wantDeletes {
+				t.Fatalf("deleted chunks %d times, want %d", len(vectorRepo.deletedSnapshots), tt.wantDeletes)
+			}
+			for _, n := range vectorRepo.deletedSnapshots {
+				if n == 0 {
+					t.Error("chunks were deleted before the document snapshot was updated")
+				}
+			}
+			if (len(queue.embeddings) > 0) != tt.wantQueued {
+				t.Errorf("enqueued %d embedding tasks, want queued %v", len(queue.embeddings), tt.wantQueued)
+			}
+			failed := len(docRepo.statuses) > 0 && docRepo.statuses[len(docRepo.statuses)-1] == entity.TaskStatusFailed
+			if failed != tt.wantFailed {
+				t.Errorf("document statuses = %v, want failed %v", docRepo.statuses, tt.wantFailed)
+			}
+			if _, ok := storage.files["user-1/old.txt"]; ok != tt.wantOldFile {
+				t.Errorf("old file kept = %v, want %v", ok, tt.wantOldFile)
+			}
+			// 快照更新失败时新文件被删除，否则只保留新文件
+			if _, ok := storage.files["user-1/notes.txt"]; ok != (tt.snapshotErr == nil) {
+				t.Errorf("new file kept = %v, want %v", ok, tt.snapshotErr == nil)
+			}
+		})
+	}
+}
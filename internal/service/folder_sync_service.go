@@ -0,0 +1,15 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// FolderSyncService 定义了将本地目录镜像到用户文档库的接口。
+type FolderSyncService interface {
+	// SyncFolder 扫描 root 目录，并与该用户此前从该目录同步的文档对账：
+	// 导入新文件，重新索引内容 (哈希) 变化的文件，删除已消失文件对应的文档及其向量块。
+	// 对账只依赖数据库中记录的路径、修改时间和哈希，因此重启后的第一次调用即可补上停机期间的变化。
+	SyncFolder(ctx context.Context, userID string, root string) (*entity.FolderSyncResult, error)
+}
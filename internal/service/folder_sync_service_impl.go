@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// fileSettleTime 是文件最后一次修改后需要等待的时间，避免导入仍在写入的文件。
+const fileSettleTime = 5 * time.Second
+
+// folderSyncServiceImpl 是 FolderSyncService 接口的实现。
+// 文件的导入、替换和删除都通过 FileService 完成，因此与上传文件走相同的校验和 Embedding 流程。
+type folderSyncServiceImpl struct {
+	fileService FileService
+	docRepo     repository.DocumentRepository
+	maxFileSize int64 // 超过单文件上限的文件直接跳过，不必打开
+}
+
+// NewFolderSyncService 创建一个新的 folderSyncServiceImpl 实例。
+func NewFolderSyncService(fs FileService, dr repository.DocumentRepository, cfg *config.Config) FolderSyncService {
+	return &folderSyncServiceImpl{
+		fileService: fs,
+		docRepo:     dr,
+		maxFileSize: cfg.MaxUploadSizeBytes,
+	}
+}
+
+// SyncFolder 扫描目录并与数据库对账。
+func (s *folderSyncServiceImpl) SyncFolder(ctx context.Context, userID string, root string) (*entity.FolderSyncResult, error) {
+	root = filepath.Clean(root)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		// 目录不可访问 (例如磁盘未挂载) 时不做任何修改，否则会误删所有已同步的文档
+		logger.WarnContext(ctx, "监视目录不可访问，跳过本次同步", "error", err, "root", root, "user_id", userID)
+		return nil, apperr.New(apperr.CodeUnavailable, "监视目录不可访问").WithDetails("root=" + root)
+	}
+
+	prefix := root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator) // 避免 /data/notes 匹配到 /data/notes2 下的文档
+	}
+	existing, err := s.docRepo.ListDocumentsBySourcePrefix(ctx, userID, prefix)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]*entity.Document, len(existing))
+	for _, doc := range existing {
+		known[*doc.SourcePath] = doc
+	}
+
+	result := &entity.FolderSyncResult{}
+	complete := true // 扫描中出现错误时，未访问到的文件不能视为已删除
+	now := time.Now()
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if walkErr != nil {
+			logger.WarnContext(ctx, "遍历监视目录时出错", "error", walkErr, "path", path)
+			complete = false
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if isIgnoredSyncName(d.Name()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil // 目录、符号链接、设备文件等
+		}
+		info, err := d.Info()
+		if err != nil {
+			logger.WarnContext(ctx, "读取文件信息失败", "error", err, "path", path)
+			complete = false
+			return nil
+		}
+
+		doc := known[path]
+		delete(known, path)
+		s.syncFile(ctx, userID, root, path, info, doc, now, result)
+		return nil
+	})
+	if err != nil {
+		return result, err // 上下文已取消
+	}
+
+	if !complete {
+		logger.WarnContext(ctx, "监视目录扫描不完整，本次跳过删除", "root", root, "user_id", userID, "pending_deletions", len(known))
+	} else {
+		for path, doc := range known {
+			if err := s.fileService.DeleteDocument(ctx, userID, doc.ID); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+				logger.ErrorContext(ctx, "删除已消失文件对应的文档失败", "error", err, "path", path, "document_id", doc.ID)
+				result.Failed++
+				continue
+			}
+			logger.InfoContext(ctx, "文件已从监视目录中移除，已删除对应文档", "path", path, "document_id", doc.ID)
+			result.Deleted++
+		}
+	}
+
+	if result.Added+result.Updated+result.Deleted+result.Failed > 0 {
+		logger.InfoContext(ctx, "监视目录同步完成", "root", root, "user_id", userID,
+			"added", result.Added, "updated", result.Updated, "deleted", result.Deleted,
+			"unchanged", result.Unchanged, "skipped", result.Skipped, "failed", result.Failed)
+	}
+	return result, nil
+}
+
+// syncFile 同步单个文件并更新统计。doc 为该路径已有的文档 (没有时为 nil)。
+func (s *folderSyncServiceImpl) syncFile(ctx context.Context, userID, root, path string, info fs.FileInfo, doc *entity.Document, now time.Time, result *entity.FolderSyncResult) {
+	modTime := info.ModTime().UTC().Truncate(time.Microsecond) // 与数据库时间戳精度一致
+	if info.Size() > s.maxFileSize || now.Sub(modTime) < fileSettleTime {
+		result.Skipped++ // 过大，或仍在写入 (下次同步时再处理)
+		return
+	}
+	if doc != nil && doc.FileSize == info.Size() && doc.SourceModifiedAt != nil && doc.SourceModifiedAt.Equal(modTime) {
+		result.Unchanged++
+		return
+	}
+
+	source := entity.FileSource{Path: path, ModifiedAt: modTime}
+	if doc != nil {
+		// 修改时间或大小变化，比较哈希确认内容是否真的变化
+		hash, err := hashLocalFile(path)
+		if err != nil {
+			logger.WarnContext(ctx, "计算文件哈希失败", "error", err, "path", path)
+			result.Failed++
+			return
+		}
+		if doc.ContentHash != nil && *doc.ContentHash == hash {
+			if err := s.docRepo.UpdateSourceModifiedAt(ctx, userID, doc.ID, modTime); err != nil {
+				result.Failed++
+				return
+			}
+			result.Unchanged++
+			return
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.WarnContext(ctx, "打开同步文件失败", "error", err, "path", path)
+		result.Failed++
+		return
+	}
+	defer file.Close()
+
+	if doc != nil {
+		_, _, err = s.fileService.ReplaceDocumentContent(ctx, userID, doc.ID, &source, info.Size(), file)
+	} else {
+		rel, _ := filepath.Rel(root, path)
+		_, _, err = s.fileService.ImportFile(ctx, userID, filepath.ToSlash(rel), source, info.Size(), file)
+	}
+	switch {
+	case err == nil && doc != nil:
+		result.Updated++
+	case err == nil:
+		result.Added++
+	case apperr.Is(err, apperr.CodeValidation):
+		// 类型不支持、超出大小或配额：保持原状，文件变化后会再次尝试
+		logger.DebugContext(ctx, "跳过无法导入的同步文件", "error", err, "path", path)
+		result.Skipped++
+	default:
+		logger.WarnContext(ctx, "同步文件失败", "error", err, "path", path)
+		result.Failed++
+	}
+}
+
+// isIgnoredSyncName 判断是否忽略该文件或目录：隐藏文件和常见的临时文件。
+func isIgnoredSyncName(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") || strings.HasSuffix(name, "~") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".tmp", ".swp", ".part", ".crdownload":
+		return true
+	}
+	return false
+}
+
+// hashLocalFile 计算文件内容的 SHA-256 (与 FileService 记录的 content_hash 一致)。
+func hashLocalFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+// validateGenerationOptions 检查与模型无关的生成参数取值范围，opts 为 nil 时不检查。
+// 与模型相关的限制 (例如最大 token 数、是否支持 JSON 模式) 由 LLMProvider.ValidateGenerationOptions 检查。
+func validateGenerationOptions(opts *entity.GenerationOptions) error {
+	if opts == nil {
+		return nil
+	}
+	if t := opts.Temperature; t != nil && (*t < entity.MinTemperature || *t > entity.MaxTemperature) {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("temperature 必须在 %.1f 到 %.1f 之间", entity.MinTemperature, entity.MaxTemperature))
+	}
+	if p := opts.TopP; p != nil && (*p < entity.MinTopP || *p > entity.MaxTopP) {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("top_p 必须在 %.1f 到 %.1f 之间", entity.MinTopP, entity.MaxTopP))
+	}
+	if opts.MaxTokens != nil && *opts.MaxTokens <= 0 {
+		return apperr.New(apperr.CodeValidation, "max_tokens 必须大于 0")
+	}
+	if len(opts.Stop) > entity.MaxStopSequences {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("stop 最多包含 %d 个停止序列", entity.MaxStopSequences))
+	}
+	for _, stop := range opts.Stop {
+		if stop == "" {
+			return apperr.New(apperr.CodeValidation, "stop 不能包含空字符串")
+		}
+	}
+	switch opts.ResponseFormat {
+	case "", entity.ResponseFormatText, entity.ResponseFormatJSON:
+	default:
+		return apperr.New(apperr.CodeValidation, "不支持的 response_format").
+			WithDetails(fmt.Sprintf("response_format=%s，可选值: %s, %s", opts.ResponseFormat, entity.ResponseFormatText, entity.ResponseFormatJSON))
+	}
+	return nil
+}
+
+// mergeGenerationOptions 合并人设的默认生成参数和请求指定的生成参数，请求中设置的字段优先。
+// 两者都没有设置任何参数时返回 nil。
+func mergeGenerationOptions(persona *entity.Persona, opts *entity.GenerationOptions) *entity.GenerationOptions {
+	if persona == nil || persona.Temperature == nil {
+		return opts
+	}
+	merged := &entity.GenerationOptions{}
+	if opts != nil {
+		*merged = *opts
+	}
+	if merged.Temperature == nil {
+		merged.Temperature = persona.Temperature
+	}
+	return merged
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// GraphRecorder 定义了聊天和文档处理流程自动写入图记忆的接口。
+// 重复记录同一个对象是安全的：节点按引用去重，边按类型去重。
+type GraphRecorder interface {
+	// RecordChatTurn 记录一轮交流：用户消息 (event 节点) 引起 AI 回复 (result 节点)。
+	// 用户消息的上一条消息已有节点时添加 follows 边；回复引用的文档已有节点时添加 informs 边。
+	RecordChatTurn(ctx context.Context, userMessage *entity.Message, aiMessage *entity.Message) error
+
+	// RecordDocumentIndexed 记录文档处理完成 (event 节点)，chunkCount 为文档的文本块数量。
+	RecordDocumentIndexed(ctx context.Context, userID string, documentID string, filename string, chunkCount int) error
+}
+
+// GraphMemoryService 定义了记录和查询图记忆 (节点和有向边) 的业务逻辑接口。
+type GraphMemoryService interface {
+	GraphRecorder
+
+	// RecordNode 校验输入并记录节点。带引用的节点已存在时更新标签、合并属性并返回已有节点。
+	RecordNode(ctx context.Context, userID string, input *entity.GraphNodeInput) (*entity.GraphNode, error)
+
+	// GetNode 获取节点，不存在时返回 CodeNotFound 错误。
+	GetNode(ctx context.Context, userID string, nodeID string) (*entity.GraphNode, error)
+
+	// ListNodes 按创建时间倒序分页列出节点，同时返回符合条件的节点总数。
+	ListNodes(ctx context.Context, userID string, filter *entity.GraphNodeFilter) ([]*entity.GraphNode, int, error)
+
+	// DeleteNode 删除节点及与其相连的边。
+	DeleteNode(ctx context.Context, userID string, nodeID string) error
+
+	// RecordEdge 校验输入并记录边。两个节点之间已有同类型的边时合并属性并返回已有的边。
+	RecordEdge(ctx context.Context, userID string, input *entity.GraphEdgeInput) (*entity.GraphEdge, error)
+
+	// ListNodeEdges 列出以节点为起点或终点的所有边。
+	ListNodeEdges(ctx context.Context, userID string, nodeID string) ([]*entity.GraphEdge, error)
+
+	// DeleteEdge 删除边。
+	DeleteEdge(ctx context.Context, userID string, edgeID string) error
+
+	// Traverse 返回节点的祖先或后代及其最短距离。depth 为 0 时使用默认深度；edgeTypes 不为空时只沿这些类型的边遍历。
+	Traverse(ctx context.Context, userID string, nodeID string, direction entity.GraphDirection, depth int, edgeTypes []entity.GraphEdgeType) ([]*entity.GraphTraversalNode, error)
+
+	// FindPaths 返回从 fromID 沿边的方向到达 toID 的路径，最短的在前。depth 和 limit 为 0 时使用默认值。
+	FindPaths(ctx context.Context, userID string, fromID string, toID string, depth int, limit int) ([]*entity.GraphPath, error)
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// graphMemoryServiceImpl 是 GraphMemoryService 接口的实现。
+type graphMemoryServiceImpl struct {
+	repo repository.GraphMemoryRepository
+}
+
+// Ensure graphMemoryServiceImpl implements GraphMemoryService interface.
+var _ GraphMemoryService = (*graphMemoryServiceImpl)(nil)
+
+// NewGraphMemoryService 创建一个新的 graphMemoryServiceImpl 实例。
+func NewGraphMemoryService(repo repository.GraphMemoryRepository) GraphMemoryService {
+	return &graphMemoryServiceImpl{repo: repo}
+}
+
+// RecordNode 校验输入并记录节点。
+func (s *graphMemoryServiceImpl) RecordNode(ctx context.Context, userID string, input *entity.GraphNodeInput) (*entity.GraphNode, error) {
+	if input == nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "缺少节点内容")
+	}
+	node := &entity.GraphNode{
+		UserID:     userID,
+		Type:       input.Type,
+		Label:      strings.TrimSpace(input.Label),
+		Properties: input.Properties,
+		RefType:    strings.TrimSpace(input.RefType),
+		RefID:      strings.TrimSpace(input.RefID),
+	}
+	if !node.Type.Valid() {
+		return nil, apperr.New(apperr.CodeValidation, "不支持的节点类型").
+			WithDetails(fmt.Sprintf("type=%s，可选值: event、decision、command、result、feedback", node.Type))
+	}
+	if utf8.RuneCountInString(node.Label) > entity.MaxGraphLabelLength {
+		return nil, apperr.New(apperr.CodeValidation, fmt.Sprintf("节点标签不能超过 %d 个字符", entity.MaxGraphLabelLength))
+	}
+	if (node.RefType == "") != (node.RefID == "") {
+		return nil, apperr.New(apperr.CodeValidation, "ref_type 和 ref_id 必须同时设置")
+	}
+	if err := validateGraphProperties(node.Properties); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateNode(ctx, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// GetNode 获取节点。
+func (s *graphMemoryServiceImpl) GetNode(ctx context.Context, userID string, nodeID string) (*entity.GraphNode, error) {
+	return s.repo.GetNode(ctx, userID, nodeID)
+}
+
+// ListNodes 分页列出节点。
+func (s *graphMemoryServiceImpl) ListNodes(ctx context.Context, userID string, filter *entity.GraphNodeFilter) ([]*entity.GraphNode, int, error) {
+	if filter != nil && filter.Type != "" && !filter.Type.Valid() {
+		return nil, 0, apperr.New(apperr.CodeInvalidArgument, "不支持的节点类型").WithDetails("type=" + string(filter.Type))
+	}
+	return s.repo.ListNodes(ctx, userID, filter)
+}
+
+// DeleteNode 删除节点及与其相连的边。
+func (s *graphMemoryServiceImpl) DeleteNode(ctx context.Context, userID string, nodeID string) error {
+	return s.repo.DeleteNode(ctx, userID, nodeID)
+}
+
+// RecordEdge 校验输入并记录边。
+func (s *graphMemoryServiceImpl) RecordEdge(ctx context.Context, userID string, input *entity.GraphEdgeInput) (*entity.GraphEdge, error) {
+	if input == nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "缺少边的内容")
+	}
+	edge := &entity.GraphEdge{
+		UserID:     userID,
+		SourceID:   strings.TrimSpace(input.SourceID),
+		TargetID:   strings.TrimSpace(input.TargetID),
+		Type:       input.Type,
+		Properties: input.Properties,
+	}
+	if !edge.Type.Valid() {
+		return nil, apperr.New(apperr.CodeValidation, "不支持的边类型").
+			WithDetails(fmt.Sprintf("type=%s，可选值: causes、follows、informs、evaluated_by", edge.Type))
+	}
+	if edge.SourceID == edge.TargetID {
+		return nil, apperr.New(apperr.CodeValidation, "边的起点和终点不能是同一个节点")
+	}
+	if err := validateGraphProperties(edge.Properties); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateEdge(ctx, edge); err != nil {
+		return nil, err
+	}
+	return edge, nil
+}
+
+// ListNodeEdges 列出以节点为起点或终点的所有边。
+func (s *graphMemoryServiceImpl) ListNodeEdges(ctx context.Context, userID string, nodeID string) ([]*entity.GraphEdge, error) {
+	return s.repo.ListNodeEdges(ctx, userID, nodeID)
+}
+
+// DeleteEdge 删除边。
+func (s *graphMemoryServiceImpl) DeleteEdge(ctx context.Context, userID string, edgeID string) error {
+	return s.repo.DeleteEdge(ctx, userID, edgeID)
+}
+
+// Traverse 返回节点的祖先或后代。
+func (s *graphMemoryServiceImpl) Traverse(ctx context.Context, userID string, nodeID string, direction entity.GraphDirection, depth int, edgeTypes []entity.GraphEdgeType) ([]*entity.GraphTraversalNode, error) {
+	if direction != entity.GraphAncestors && direction != entity.GraphDescendants {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "不支持的遍历方向").WithDetails("direction=" + string(direction))
+	}
+	depth, err := graphTraversalDepth(depth)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range edgeTypes {
+		if !t.Valid() {
+			return nil, apperr.New(apperr.CodeInvalidArgument, "不支持的边类型").WithDetails("edge_type=" + string(t))
+		}
+	}
+	return s.repo.Traverse(ctx, userID, nodeID, direction, depth, edgeTypes)
+}
+
+// FindPaths 返回两个节点之间的路径。
+func (s *graphMemoryServiceImpl) FindPaths(ctx context.Context, userID string, fromID string, toID string, depth int, limit int) ([]*entity.GraphPath, error) {
+	if fromID == "" || toID == "" {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "必须指定起点和终点")
+	}
+	if fromID == toID {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "起点和终点不能是同一个节点")
+	}
+	depth, err := graphTraversalDepth(depth)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > entity.MaxGraphPaths {
+		limit = entity.MaxGraphPaths
+	}
+	return s.repo.FindPaths(ctx, userID, fromID, toID, depth, limit)
+}
+
+// RecordChatTurn 记录一轮交流及其与之前的交流和引用文档的关系。
+func (s *graphMemoryServiceImpl) RecordChatTurn(ctx context.Context, userMessage *entity.Message, aiMessage *entity.Message) error {
+	userNode, err := s.recordMessageNode(ctx, userMessage, entity.GraphNodeEvent)
+	if err != nil {
+		return err
+	}
+	replyNode, err := s.recordMessageNode(ctx, aiMessage, entity.GraphNodeResult)
+	if err != nil {
+		return err
+	}
+	userID := userMessage.UserID
+	if err := s.repo.CreateEdge(ctx, &entity.GraphEdge{UserID: userID, SourceID: userNode.ID, TargetID: replyNode.ID, Type: entity.GraphEdgeCauses}); err != nil {
+		return err
+	}
+
+	// 上一条消息 (通常是上一轮的回复) 的节点不存在时 (例如启用自动记录之前的消息) 不添加边
+	if userMessage.ParentID != nil {
+		if err := s.linkFromRef(ctx, userID, entity.GraphRefMessage, *userMessage.ParentID, userNode.ID, entity.GraphEdgeFollows); err != nil {
+			return err
+		}
+	}
+	linked := make(map[string]bool)
+	for _, source := range aiMessage.Sources() {
+		if source.DocumentID == "" || linked[source.DocumentID] {
+			continue
+		}
+		linked[source.DocumentID] = true
+		if err := s.linkFromRef(ctx, userID, entity.GraphRefDocument, source.DocumentID, replyNode.ID, entity.GraphEdgeInforms); err != nil {
+			return err
+		}
+	}
+	logger.DebugContext(ctx, "已记录对话到图记忆", "conversation_id", userMessage.ConversationID, "user_node_id", userNode.ID, "reply_node_id", replyNode.ID)
+	return nil
+}
+
+// RecordDocumentIndexed 记录文档处理完成。
+func (s *graphMemoryServiceImpl) RecordDocumentIndexed(ctx context.Context, userID string, documentID string, filename string, chunkCount int) error {
+	node := &entity.GraphNode{
+		UserID: userID,
+		Type:   entity.GraphNodeEvent,
+		Label:  truncateRunes("文档已索引: "+filename, entity.MaxGraphLabelLength),
+		Properties: map[string]any{
+			"kind":        "document_indexed",
+			"document_id": documentID,
+			"filename":    filename,
+			"chunk_count": chunkCount,
+		},
+		RefType: entity.GraphRefDocument,
+		RefID:   documentID,
+	}
+	return s.repo.CreateNode(ctx, node)
+}
+
+// recordMessageNode 记录消息的节点。节点只引用消息 (ref_id 和属性中的 ID)，不复制消息内容：
+// 消息被删除时节点由数据库触发器一并删除，删除的内容不会残留在图中。
+func (s *graphMemoryServiceImpl) recordMessageNode(ctx context.Context, message *entity.Message, nodeType entity.GraphNodeType) (*entity.GraphNode, error) {
+	label := "用户消息"
+	if message.SenderRole != entity.SenderRoleUser {
+		label = "AI 回复"
+	}
+	node := &entity.GraphNode{
+		UserID: message.UserID,
+		Type:   nodeType,
+		Label:  label,
+		Properties: map[string]any{
+			"kind":            "chat_message",
+			"role":            string(message.SenderRole),
+			"conversation_id": message.ConversationID,
+			"message_id":      message.ID,
+		},
+		RefType: entity.GraphRefMessage,
+		RefID:   message.ID,
+	}
+	if err := s.repo.CreateNode(ctx, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// linkFromRef 在记录了指定对象的节点存在时，添加从该节点到 targetID 的边。
+func (s *graphMemoryServiceImpl) linkFromRef(ctx context.Context, userID string, refType string, refID string, targetID string, edgeType entity.GraphEdgeType) error {
+	source, err := s.repo.GetNodeByRef(ctx, userID, refType, refID)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.repo.CreateEdge(ctx, &entity.GraphEdge{UserID: userID, SourceID: source.ID, TargetID: targetID, Type: edgeType})
+}
+
+// graphTraversalDepth 返回遍历深度，0 表示默认深度。
+func graphTraversalDepth(depth int) (int, error) {
+	if depth == 0 {
+		return entity.DefaultGraphTraversalDepth, nil
+	}
+	if depth < 0 || depth > entity.MaxGraphTraversalDepth {
+		return 0, apperr.New(apperr.CodeInvalidArgument, fmt.Sprintf("depth 必须在 1 到 %d 之间", entity.MaxGraphTraversalDepth))
+	}
+	return depth, nil
+}
+
+// validateGraphProperties 检查属性序列化后的大小。
+func validateGraphProperties(properties map[string]any) error {
+	if properties == nil {
+		return nil
+	}
+	data, err := json.Marshal(properties)
+	if err != nil {
+		return apperr.Wrap(err, apperr.CodeValidation, "属性不是有效的 JSON 对象")
+	}
+	if len(data) > entity.MaxGraphPropertiesSize {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("属性不能超过 %d 字节", entity.MaxGraphPropertiesSize))
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+)
+
+// burstWindow 是合并连续消息的时间窗口：同一会话中同一发送者在该时间内的连续消息合并为一个片段，
+// 避免每条简短的聊天消息单独生成 Embedding。
+const burstWindow = 5 * time.Minute
+
+// chatMessage 是从聊天导出中解析出的单条消息。
+type chatMessage struct {
+	threadID   string
+	threadName string
+	sender     string
+	senderID   string // 平台上的用户 ID，可能为空
+	sentAt     time.Time
+	text       string
+}
+
+// mergeBursts 将消息合并为片段，每个片段包含同一发送者的一组连续消息。
+// 片段的 sent_at 为第一条消息的时间，sent_until 为最后一条消息的时间。
+func mergeBursts(messages []chatMessage, format string) []service.ContentSegment {
+	segments := make([]service.ContentSegment, 0)
+	var sb strings.Builder
+	var first, last *chatMessage
+	flush := func() {
+		if first == nil {
+			return
+		}
+		metadata := map[string]any{
+			entity.ChunkMetaSourceFormat: format,
+			entity.ChunkMetaSender:       first.sender,
+			entity.ChunkMetaSentAt:       formatSentAt(first.sentAt),
+			entity.ChunkMetaSentUntil:    formatSentAt(last.sentAt),
+			entity.ChunkMetaThreadID:     first.threadID,
+		}
+		if first.threadName != "" {
+			metadata[entity.ChunkMetaThreadName] = first.threadName
+		}
+		if first.senderID != "" {
+			metadata[entity.ChunkMetaSenderAddress] = first.senderID
+		}
+		segments = append(segments, service.ContentSegment{Content: sb.String(), Metadata: metadata})
+		sb.Reset()
+		first = nil
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		if strings.TrimSpace(msg.text) == "" {
+			continue
+		}
+		if first != nil && (msg.threadID != first.threadID || msg.sender != first.sender || msg.sentAt.Sub(last.sentAt) > burstWindow || msg.sentAt.Before(last.sentAt)) {
+			flush()
+		}
+		if first == nil {
+			first = msg
+			if msg.threadName != "" {
+				sb.WriteString("Chat: " + msg.threadName + "\n")
+			}
+		}
+		fmt.Fprintf(&sb, "[%s] %s: %s\n", msg.sentAt.Format("2006-01-02 15:04"), msg.sender, strings.TrimSpace(msg.text))
+		last = msg
+	}
+	flush()
+	return segments
+}
+
+// Ensure the chat importers implement MessageImporter interface.
+var (
+	_ service.MessageImporter = (*telegramImporter)(nil)
+	_ service.MessageImporter = (*whatsAppImporter)(nil)
+)
+
+// telegramImporter 处理 Telegram Desktop 导出的 JSON (result.json)，支持单个会话和完整导出。
+type telegramImporter struct{}
+
+// NewTelegramImporter 创建一个 Telegram 聊天导出导入器。
+func NewTelegramImporter() service.MessageImporter {
+	return &telegramImporter{}
+}
+
+// Format 实现 MessageImporter 接口。
+func (i *telegramImporter) Format() string { return "telegram" }
+
+// Match 判断文件是否为 Telegram 导出的 JSON。
+func (i *telegramImporter) Match(filename string, head []byte) bool {
+	if !strings.EqualFold(filepath.Ext(filename), ".json") {
+		return false
+	}
+	trimmed := bytes.TrimSpace(head)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		return false
+	}
+	// 单个会话导出以 name/type/id/messages 开头，完整导出包含 chats
+	return bytes.Contains(head, []byte(`"messages"`)) || bytes.Contains(head, []byte(`"chats"`)) ||
+		bytes.Contains(head, []byte(`"personal_chat"`)) || bytes.Contains(head, []byte(`"private_group"`))
+}
+
+// telegramChat 是导出中的一个会话。
+type telegramChat struct {
+	ID       json.Number       `json:"id"`
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Messages []telegramMessage `json:"messages"`
+}
+
+// telegramMessage 是导出中的一条消息。
+type telegramMessage struct {
+	Type         string          `json:"type"`
+	Date         string          `json:"date"`
+	DateUnixtime string          `json:"date_unixtime"`
+	From         string          `json:"from"`
+	FromID       string          `json:"from_id"`
+	Text         json.RawMessage `json:"text"`
+}
+
+// telegramExport 兼容单个会话 (顶层即会话) 和完整导出 (chats.list)。
+type telegramExport struct {
+	telegramChat
+	Chats *struct {
+		List []telegramChat `json:"list"`
+	} `json:"chats"`
+}
+
+// Parse 解析导出文件，按会话和发送者合并消息。服务消息 (入群、置顶等) 被跳过。
+func (i *telegramImporter) Parse(_ string, data []byte) ([]service.ContentSegment, error) {
+	var export telegramExport
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&export); err != nil {
+		return nil, fmt.Errorf("解析 Telegram 导出失败: %w", err)
+	}
+	chats := []telegramChat{export.telegramChat}
+	if export.Chats != nil {
+		chats = export.Chats.List
+	}
+
+	messages := make([]chatMessage, 0)
+	for _, chat := range chats {
+		threadID := "telegram:" + chat.ID.String()
+		for _, m := range chat.Messages {
+			if m.Type != "message" {
+				continue
+			}
+			sentAt, ok := telegramTime(m)
+			if !ok {
+				continue
+			}
+			sender := m.From
+			if sender == "" {
+				sender = m.FromID // 已删除的账号没有名称
+			}
+			messages = append(messages, chatMessage{
+				threadID:   threadID,
+				threadName: chat.Name,
+				sender:     sender,
+				senderID:   m.FromID,
+				sentAt:     sentAt,
+				text:       telegramText(m.Text),
+			})
+		}
+	}
+	segments := mergeBursts(messages, i.Format())
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("Telegram 导出中没有文本消息")
+	}
+	return segments, nil
+}
+
+// telegramTime 优先使用 date_unixtime，旧版导出只有本地时间的 date (按 UTC 处理)。
+func telegramTime(m telegramMessage) (time.Time, bool) {
+	if m.DateUnixtime != "" {
+		if sec, err := strconv.ParseInt(m.DateUnixtime, 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC(), true
+		}
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05", m.Date); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// telegramText 处理 text 字段：可能是字符串，也可能是字符串和 {type, text} 实体混合的数组。
+func telegramText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, part := range parts {
+		var s string
+		if err := json.Unmarshal(part, &s); err == nil {
+			sb.WriteString(s)
+			continue
+		}
+		var entityPart struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(part, &entityPart); err == nil {
+			sb.WriteString(entityPart.Text)
+		}
+	}
+	return sb.String()
+}
+
+var (
+	// whatsAppLinePattern 匹配 WhatsApp 导出的消息行：
+	// Android 格式 "31/12/20, 21:15 - Alice: text" (也可能带 AM/PM)，
+	// iOS 格式 "[31/12/2020, 21:15:03] Alice: text"。
+	whatsAppLinePattern = regexp.MustCompile(`^\x{200E}?\[?(\d{1,2})[/.\-](\d{1,2})[/.\-](\d{2,4}),?\s+(\d{1,2}):(\d{2})(?::(\d{2}))?(?:\s*([AaPp])\.?\s?[Mm]\.?)?\]?\s*(?:-\s*)?(.*)$`)
+	// whatsAppChatNamePattern 从导出文件名中提取会话名称。
+	whatsAppChatNamePattern = regexp.MustCompile(`(?i)^WhatsApp Chat (?:with|-)\s*(.+?)(?:\s*\(\d+\))?\.txt$`)
+)
+
+// whatsAppImporter 处理 WhatsApp 导出的纯文本聊天记录。
+type whatsAppImporter struct{}
+
+// NewWhatsAppImporter 创建一个 WhatsApp 聊天导出导入器。
+func NewWhatsAppImporter() service.MessageImporter {
+	return &whatsAppImporter{}
+}
+
+// Format 实现 MessageImporter 接口。
+func (i *whatsAppImporter) Format() string { return "whatsapp" }
+
+// Match 判断文件是否为 WhatsApp 导出：.txt 文件且开头几行符合消息行格式。
+func (i *whatsAppImporter) Match(filename string, head []byte) bool {
+	if !strings.EqualFold(filepath.Ext(filename), ".txt") {
+		return false
+	}
+	if whatsAppChatNamePattern.MatchString(filepath.Base(filename)) {
+		return true
+	}
+	// head 可能在行中间截断，只检查完整的前几行
+	lines := strings.Split(string(head), "\n")
+	lines = lines[:len(lines)-1]
+	matched := 0
+	for _, line := range lines[:min(5, len(lines))] {
+		if whatsAppLinePattern.MatchString(strings.TrimSpace(line)) {
+			matched++
+		}
+	}
+	return matched >= 2
+}
+
+// whatsAppLine 是解析出的一个消息行 (日期各部分保留原始数字，待确定日/月顺序后再转换)。
+type whatsAppLine struct {
+	a, b, year, hour, minute, second int
+	meridiem                         string
+	rest                             string
+}
+
+// Parse 解析聊天记录。导出中的时间是导出设备的本地时间且不含时区，这里按 UTC 记录。
+func (i *whatsAppImporter) Parse(filename string, data []byte) ([]service.ContentSegment, error) {
+	lines := make([]whatsAppLine, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		m := whatsAppLinePattern.FindStringSubmatch(text)
+		if m == nil {
+			// 多行消息的后续行追加到上一条消息
+			if len(lines) > 0 {
+				lines[len(lines)-1].rest += "\n" + text
+			}
+			continue
+		}
+		line := whatsAppLine{meridiem: strings.ToUpper(m[7]), rest: m[8]}
+		line.a, _ = strconv.Atoi(m[1])
+		line.b, _ = strconv.Atoi(m[2])
+		line.year, _ = strconv.Atoi(m[3])
+		line.hour, _ = strconv.Atoi(m[4])
+		line.minute, _ = strconv.Atoi(m[5])
+		line.second, _ = strconv.Atoi(m[6])
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 WhatsApp 导出失败: %w", err)
+	}
+
+	// 日期可能是 日/月 或 月/日 (取决于导出设备的地区设置)，根据数据判断；无法判断时按 日/月 处理
+	monthFirst := false
+	for _, line := range lines {
+		if line.a > 12 {
+			monthFirst = false
+			break
+		}
+		if line.b > 12 {
+			monthFirst = true
+		}
+	}
+
+	threadName := ""
+	if m := whatsAppChatNamePattern.FindStringSubmatch(filepath.Base(filename)); m != nil {
+		threadName = m[1]
+	}
+	// 导出文件不包含会话 ID，使用会话名称 (没有时使用文件名) 的哈希
+	threadKey := threadName
+	if threadKey == "" {
+		threadKey = filepath.Base(filename)
+	}
+	sum := sha256.Sum256([]byte(threadKey))
+	threadID := "whatsapp:" + hex.EncodeToString(sum[:8])
+
+	messages := make([]chatMessage, 0, len(lines))
+	for _, line := range lines {
+		sender, text, ok := strings.Cut(line.rest, ": ")
+		if !ok {
+			continue // 系统消息 (加密提示、成员变动等) 没有发送者
+		}
+		day, month := line.a, line.b
+		if monthFirst {
+			day, month = line.b, line.a
+		}
+		year := line.year
+		if year < 100 {
+			year += 2000
+		}
+		hour := line.hour
+		if line.meridiem == "P" && hour < 12 {
+			hour += 12
+		} else if line.meridiem == "A" && hour == 12 {
+			hour = 0
+		}
+		messages = append(messages, chatMessage{
+			threadID:   threadID,
+			threadName: threadName,
+			sender:     strings.TrimSpace(strings.TrimPrefix(sender, "\u200e")),
+			sentAt:     time.Date(year, time.Month(month), day, hour, line.minute, line.second, 0, time.UTC),
+			text:       strings.ReplaceAll(text, "\u200e", ""),
+		})
+	}
+	segments := mergeBursts(messages, i.Format())
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("WhatsApp 导出中没有可解析的消息")
+	}
+	return segments, nil
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+func TestMergeBursts(t *testing.T) {
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	messages := []chatMessage{
+		{threadID: "t1", threadName: "Team", sender: "Alice", senderID: "u1", sentAt: at(0), text: "hi"},
+		{threadID: "t1", threadName: "Team", sender: "Alice", senderID: "u1", sentAt: at(3), text: "are you there?"},
+		{threadID: "t1", threadName: "Team", sender: "Alice", senderID: "u1", sentAt: at(7), text: "ping"}, // 与上一条相隔不超过 5 分钟
+		{threadID: "t1", threadName: "Team", sender: "Bob", sentAt: at(8), text: "yes"},                    // 换了发送者
+		{threadID: "t1", threadName: "Team", sender: "Bob", sentAt: at(8), text: "   "},                    // 空消息被忽略
+		{threadID: "t1", threadName: "Team", sender: "Bob", sentAt: at(20), text: "later"},                 // 超出时间窗口
+		{threadID: "t2", sender: "Bob", sentAt: at(21), text: "other chat"},                                // 换了会话
+	}
+	segments := mergeBursts(messages, "telegram")
+
+	want := []struct {
+		sender, sentAt, sentUntil, content string
+	}{
+		{"Alice", "2024-03-01T09:00:00Z", "2024-03-01T09:07:00Z",
+			"Chat: Team\n[2024-03-01 09:00] Alice: hi\n[2024-03-01 09:03] Alice: are you there?\n[2024-03-01 09:07] Alice: ping\n"},
+		{"Bob", "2024-03-01T09:08:00Z", "2024-03-01T09:08:00Z", "Chat: Team\n[2024-03-01 09:08] Bob: yes\n"},
+		{"Bob", "2024-03-01T09:20:00Z", "2024-03-01T09:20:00Z", "Chat: Team\n[2024-03-01 09:20] Bob: later\n"},
+		{"Bob", "2024-03-01T09:21:00Z", "2024-03-01T09:21:00Z", "[2024-03-01 09:21] Bob: other chat\n"},
+	}
+	if len(segments) != len(want) {
+		t.Fatalf("mergeBursts returned %d segments, want %d: %+v", len(segments), len(want), segments)
+	}
+	for i, w := range want {
+		seg := segments[i]
+		if seg.Content != w.content {
+			t.Errorf("segment %d content = %q, want %q", i, seg.Content, w.content)
+		}
+		meta := seg.Metadata
+		if meta[entity.ChunkMetaSender] != w.sender || meta[entity.ChunkMetaSentAt] != w.sentAt || meta[entity.ChunkMetaSentUntil] != w.sentUntil {
+			t.Errorf("segment %d sender/sent_at/sent_until = %v/%v/%v, want %s/%s/%s", i,
+				meta[entity.ChunkMetaSender], meta[entity.ChunkMetaSentAt], meta[entity.ChunkMetaSentUntil], w.sender, w.sentAt, w.sentUntil)
+		}
+		if meta[entity.ChunkMetaSourceFormat] != "telegram" {
+			t.Errorf("segment %d source format = %v, want telegram", i, meta[entity.ChunkMetaSourceFormat])
+		}
+	}
+	if got := segments[0].Metadata[entity.ChunkMetaSenderAddress]; got != "u1" {
+		t.Errorf("segment 0 sender address = %v, want u1", got)
+	}
+	if _, ok := segments[1].Metadata[entity.ChunkMetaSenderAddress]; ok {
+		t.Error("segment 1 should not have a sender address")
+	}
+	if _, ok := segments[3].Metadata[entity.ChunkMetaThreadName]; ok {
+		t.Error("segment 3 should not have a thread name")
+	}
+}
+
+func TestMergeBurstsOutOfOrder(t *testing.T) {
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	messages := []chatMessage{
+		{threadID: "t1", sender: "Alice", sentAt: base.Add(time.Minute), text: "second"},
+		{threadID: "t1", sender: "Alice", sentAt: base, text: "first"}, // 时间倒退时不合并
+	}
+	if segments := mergeBursts(messages, "whatsapp"); len(segments) != 2 {
+		t.Errorf("mergeBursts returned %d segments, want 2", len(segments))
+	}
+	if segments := mergeBursts(nil, "whatsapp"); len(segments) != 0 {
+		t.Errorf("mergeBursts(nil) returned %d segments, want 0", len(segments))
+	}
+}
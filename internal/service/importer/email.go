@@ -0,0 +1,344 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/internal/service/webpage"
+	"golang.org/x/net/html/charset"
+)
+
+// maxMultipartDepth 限制解析嵌套 multipart 的深度，防止恶意构造的邮件。
+const maxMultipartDepth = 5
+
+var (
+	// subjectPrefixPattern 匹配回复/转发前缀，用于规范化主题。
+	subjectPrefixPattern = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|aw|wg|回复|答复|转发)\s*(\[\d+\])?\s*[:：]\s*)+`)
+	// messageIDPattern 匹配 References / In-Reply-To 中的消息 ID。
+	messageIDPattern = regexp.MustCompile(`<[^<>\s]+>`)
+	// wordDecoder 解码 RFC 2047 编码的邮件头 (例如 =?UTF-8?B?...?=)，支持非 UTF-8 字符集。
+	wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+)
+
+// Ensure the email importers implement MessageImporter interface.
+var (
+	_ service.MessageImporter = (*emlImporter)(nil)
+	_ service.MessageImporter = (*mboxImporter)(nil)
+)
+
+// emlImporter 处理单封 RFC 5322 邮件 (.eml)。
+type emlImporter struct{}
+
+// NewEMLImporter 创建一个 EML 邮件导入器。
+func NewEMLImporter() service.MessageImporter {
+	return &emlImporter{}
+}
+
+// Format 实现 MessageImporter 接口。
+func (i *emlImporter) Format() string { return "eml" }
+
+// Match 根据扩展名或开头的邮件头判断是否为 EML 文件。
+func (i *emlImporter) Match(filename string, head []byte) bool {
+	if strings.EqualFold(filepath.Ext(filename), ".eml") {
+		return true
+	}
+	if bytes.HasPrefix(head, []byte("From ")) {
+		return false // mbox
+	}
+	// 没有扩展名时，要求开头几行中同时出现 From 和 Subject/Message-ID 邮件头
+	header := strings.ToLower(string(head))
+	return hasHeaderLine(header, "from:") && (hasHeaderLine(header, "subject:") || hasHeaderLine(header, "message-id:"))
+}
+
+// Parse 将邮件解析为一个片段。
+func (i *emlImporter) Parse(_ string, data []byte) ([]service.ContentSegment, error) {
+	segment, err := parseEmail(data, i.Format())
+	if err != nil {
+		return nil, err
+	}
+	return []service.ContentSegment{segment}, nil
+}
+
+// mboxImporter 处理 mbox 邮件归档，每封邮件一个片段。
+type mboxImporter struct{}
+
+// NewMboxImporter 创建一个 mbox 导入器。
+func NewMboxImporter() service.MessageImporter {
+	return &mboxImporter{}
+}
+
+// Format 实现 MessageImporter 接口。
+func (i *mboxImporter) Format() string { return "mbox" }
+
+// Match 根据扩展名或 "From " 分隔行判断是否为 mbox 文件。
+func (i *mboxImporter) Match(filename string, head []byte) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".mbox" || ext == ".mbx" || bytes.HasPrefix(head, []byte("From "))
+}
+
+// Parse 按 "From " 分隔行拆分归档并逐封解析。无法解析的邮件会被跳过。
+func (i *mboxImporter) Parse(_ string, data []byte) ([]service.ContentSegment, error) {
+	segments := make([]service.ContentSegment, 0)
+	var current bytes.Buffer
+	inMessage := false
+	flush := func() {
+		if inMessage && current.Len() > 0 {
+			if segment, err := parseEmail(current.Bytes(), i.Format()); err == nil {
+				segments = append(segments, segment)
+			}
+		}
+		current.Reset()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	prevBlank := true
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if prevBlank && bytes.HasPrefix(line, []byte("From ")) {
+			flush()
+			inMessage = true
+			prevBlank = false
+			continue // 分隔行不属于邮件内容
+		}
+		// mboxrd 会把正文中的 "From " 转义为 ">From "，这里还原
+		if unescaped := bytes.TrimLeft(line, ">"); len(unescaped) < len(line) && bytes.HasPrefix(unescaped, []byte("From ")) {
+			line = line[1:]
+		}
+		current.Write(line)
+		current.WriteByte('\n')
+		prevBlank = len(bytes.TrimSpace(line)) == 0
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 mbox 失败: %w", err)
+	}
+	flush()
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("mbox 中没有可解析的邮件")
+	}
+	return segments, nil
+}
+
+// parseEmail 解析单封邮件，返回包含主题、发件人、日期和正文的片段。
+func parseEmail(data []byte, format string) (service.ContentSegment, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return service.ContentSegment{}, fmt.Errorf("解析邮件失败: %w", err)
+	}
+	header := msg.Header
+	subject := decodeHeader(header.Get("Subject"))
+	body := strings.TrimSpace(stripQuotedLines(extractEmailBody(header.Get("Content-Type"), header.Get("Content-Transfer-Encoding"), msg.Body, 0)))
+
+	metadata := map[string]any{entity.ChunkMetaSourceFormat: format}
+	var sb strings.Builder
+	if subject != "" {
+		metadata[entity.ChunkMetaSubject] = subject
+		sb.WriteString("Subject: " + subject + "\n")
+	}
+	if from, err := mail.ParseAddress(decodeHeader(header.Get("From"))); err == nil {
+		metadata[entity.ChunkMetaSenderAddress] = strings.ToLower(from.Address)
+		if from.Name == "" {
+			metadata[entity.ChunkMetaSender] = from.Address
+			sb.WriteString("From: " + from.Address + "\n")
+		} else {
+			// 不使用 from.String()，它会把非 ASCII 名称重新编码为 RFC 2047 格式
+			metadata[entity.ChunkMetaSender] = from.Name
+			sb.WriteString("From: " + from.Name + " <" + from.Address + ">\n")
+		}
+	} else if raw := decodeHeader(header.Get("From")); raw != "" {
+		metadata[entity.ChunkMetaSender] = raw
+		sb.WriteString("From: " + raw + "\n")
+	}
+	if recipients := emailRecipients(header); len(recipients) > 0 {
+		metadata[entity.ChunkMetaRecipients] = recipients
+		sb.WriteString("To: " + strings.Join(recipients, ", ") + "\n")
+	}
+	if date, err := header.Date(); err == nil {
+		metadata[entity.ChunkMetaSentAt] = formatSentAt(date)
+		sb.WriteString("Date: " + date.Format(time.RFC1123Z) + "\n")
+	}
+	messageID := strings.TrimSpace(header.Get("Message-ID"))
+	if messageID != "" {
+		metadata[entity.ChunkMetaMessageID] = messageID
+	}
+	metadata[entity.ChunkMetaThreadID] = emailThreadID(header, messageID, subject)
+
+	if body == "" && subject == "" {
+		return service.ContentSegment{}, fmt.Errorf("邮件没有主题和正文")
+	}
+	sb.WriteString("\n" + body)
+	return service.ContentSegment{Content: sb.String(), Metadata: metadata}, nil
+}
+
+// extractEmailBody 提取邮件正文：优先 text/plain，其次 text/html (转换为纯文本)，递归处理 multipart。
+func extractEmailBody(contentType, transferEncoding string, body io.Reader, depth int) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxMultipartDepth || params["boundary"] == "" {
+			return ""
+		}
+		var plain, html string
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			if strings.HasPrefix(strings.ToLower(part.Header.Get("Content-Disposition")), "attachment") {
+				continue // 跳过附件
+			}
+			partType := part.Header.Get("Content-Type")
+			text := extractEmailBody(partType, part.Header.Get("Content-Transfer-Encoding"), part, depth+1)
+			if text == "" {
+				continue
+			}
+			if strings.HasPrefix(strings.ToLower(partType), "text/html") {
+				if html == "" {
+					html = text
+				}
+			} else if plain == "" {
+				plain = text
+			}
+			if plain != "" && mediaType == "multipart/alternative" {
+				break // alternative 中的纯文本已足够
+			}
+		}
+		if plain != "" {
+			return plain
+		}
+		return html
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "" // 图片等非文本内容
+	}
+
+	decoded := decodeTransferEncoding(transferEncoding, body)
+	if cs := params["charset"]; cs != "" {
+		if r, err := charset.NewReaderLabel(cs, decoded); err == nil {
+			decoded = r
+		}
+	}
+	if mediaType == "text/html" {
+		_, text, err := webpage.ExtractHTML(decoded)
+		if err != nil {
+			return ""
+		}
+		return text
+	}
+	text, err := io.ReadAll(decoded)
+	if err != nil {
+		return ""
+	}
+	return strings.ReplaceAll(string(text), "\r\n", "\n")
+}
+
+// decodeTransferEncoding 处理 base64 和 quoted-printable 传输编码。
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// newlineStripper 去掉 base64 内容中的换行，base64.NewDecoder 不接受换行符。
+type newlineStripper struct {
+	r io.Reader
+}
+
+// Read 实现 io.Reader。
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		count, err := n.r.Read(p)
+		kept := 0
+		for _, b := range p[:count] {
+			if b != '\r' && b != '\n' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// stripQuotedLines 去掉以 ">" 开头的引用行，避免回复中重复索引被引用的原文。
+func stripQuotedLines(body string) string {
+	lines := strings.Split(body, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			continue
+		}
+		kept = append(kept, strings.TrimRight(line, " \t\r"))
+	}
+	return strings.Join(kept, "\n")
+}
+
+// emailRecipients 返回 To 和 Cc 中的收件人地址 (小写)。
+func emailRecipients(header mail.Header) []string {
+	recipients := make([]string, 0)
+	for _, key := range []string{"To", "Cc"} {
+		addrs, err := mail.ParseAddressList(decodeHeader(header.Get(key)))
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			recipients = append(recipients, strings.ToLower(addr.Address))
+		}
+	}
+	return recipients
+}
+
+// emailThreadID 确定邮件所属会话：References 中的第一个 ID (会话根邮件)，
+// 其次 In-Reply-To，再次自身的 Message-ID；都没有时使用规范化主题的哈希。
+func emailThreadID(header mail.Header, messageID, subject string) string {
+	if ids := messageIDPattern.FindAllString(header.Get("References"), -1); len(ids) > 0 {
+		return ids[0]
+	}
+	if ids := messageIDPattern.FindAllString(header.Get("In-Reply-To"), -1); len(ids) > 0 {
+		return ids[0]
+	}
+	if messageID != "" {
+		return messageID
+	}
+	normalized := strings.ToLower(strings.TrimSpace(subjectPrefixPattern.ReplaceAllString(subject, "")))
+	sum := sha256.Sum256([]byte(normalized))
+	return "subject:" + hex.EncodeToString(sum[:8])
+}
+
+// decodeHeader 解码 RFC 2047 编码的邮件头，失败时返回原值。
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// hasHeaderLine 判断 (小写的) 文本中是否有以 name 开头的行。
+func hasHeaderLine(text, name string) bool {
+	return strings.HasPrefix(text, name) || strings.Contains(text, "\n"+name)
+}
@@ -0,0 +1,41 @@
+// Package importer 提供邮件归档和聊天导出文件的 MessageImporter 实现。
+package importer
+
+import (
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/service"
+)
+
+// sniffLength 是 Match 检查的文件开头字节数，调用方应至少传入这么多字节。
+const sniffLength = 4096
+
+// SniffLength 返回 Match 需要的文件开头字节数。
+func SniffLength() int {
+	return sniffLength
+}
+
+// Default 返回所有内置导入器。顺序即匹配优先级：格式特征更明确的导入器在前。
+func Default() []service.MessageImporter {
+	return []service.MessageImporter{
+		NewMboxImporter(),
+		NewEMLImporter(),
+		NewTelegramImporter(),
+		NewWhatsAppImporter(),
+	}
+}
+
+// Find 返回第一个匹配文件的导入器，没有匹配时返回 nil。
+func Find(importers []service.MessageImporter, filename string, head []byte) service.MessageImporter {
+	for _, imp := range importers {
+		if imp.Match(filename, head) {
+			return imp
+		}
+	}
+	return nil
+}
+
+// formatSentAt 将发送时间格式化为 UTC 的 RFC 3339 字符串，使元数据中的时间可按字符串比较。
+func formatSentAt(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
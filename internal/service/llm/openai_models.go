@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+// modelLimits 描述一个 OpenAI 模型对生成参数的限制。
+type modelLimits struct {
+	maxOutputTokens int  // 回复的最大 token 数，0 表示不在本地检查
+	jsonMode        bool // 是否支持 JSON 模式 (response_format=json_object)
+	sampling        bool // 是否支持 temperature 和 top_p (推理模型不支持)
+}
+
+// openAIModelLimits 按模型名称前缀列出已知模型的限制，匹配时使用最长的前缀 (例如 gpt-4o-mini 优先于 gpt-4o)。
+// 带日期后缀的快照 (例如 gpt-4o-2024-08-06) 使用其前缀的限制。
+var openAIModelLimits = map[string]modelLimits{
+	"gpt-4.1":       {maxOutputTokens: 32768, jsonMode: true, sampling: true},
+	"gpt-4o":        {maxOutputTokens: 16384, jsonMode: true, sampling: true},
+	"gpt-4o-mini":   {maxOutputTokens: 16384, jsonMode: true, sampling: true},
+	"gpt-4-turbo":   {maxOutputTokens: 4096, jsonMode: true, sampling: true},
+	"gpt-4-1106":    {maxOutputTokens: 4096, jsonMode: true, sampling: true}, // gpt-4-1106-preview
+	"gpt-4-0125":    {maxOutputTokens: 4096, jsonMode: true, sampling: true}, // gpt-4-0125-preview
+	"gpt-4":         {maxOutputTokens: 8192, jsonMode: false, sampling: true},
+	"gpt-3.5-turbo": {maxOutputTokens: 4096, jsonMode: true, sampling: true},
+	"o1":            {maxOutputTokens: 100000, jsonMode: true, sampling: false},
+	"o1-mini":       {maxOutputTokens: 65536, jsonMode: false, sampling: false},
+	"o3":            {maxOutputTokens: 100000, jsonMode: true, sampling: false},
+	"o3-mini":       {maxOutputTokens: 100000, jsonMode: true, sampling: false},
+	"o4-mini":       {maxOutputTokens: 100000, jsonMode: true, sampling: false},
+}
+
+// unknownModelLimits 用于未列出的模型 (例如通过兼容 API 访问的其他模型)：不在本地限制，由 API 返回错误。
+var unknownModelLimits = modelLimits{jsonMode: true, sampling: true}
+
+// lookupModelLimits 返回模型的限制，模型名称与前缀完全相同或以 "前缀-" 开头时匹配。
+func lookupModelLimits(model string) modelLimits {
+	model = strings.ToLower(model)
+	best, limits := "", unknownModelLimits
+	for prefix, l := range openAIModelLimits {
+		if (model == prefix || strings.HasPrefix(model, prefix+"-")) && len(prefix) > len(best) {
+			best, limits = prefix, l
+		}
+	}
+	return limits
+}
+
+// validateModelOptions 检查生成参数是否在模型的限制之内。
+func validateModelOptions(model string, opts *entity.GenerationOptions) error {
+	if opts == nil {
+		return nil
+	}
+	limits := lookupModelLimits(model)
+	if opts.MaxTokens != nil && limits.maxOutputTokens > 0 && *opts.MaxTokens > limits.maxOutputTokens {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("max_tokens 超出模型的上限 (%d)", limits.maxOutputTokens)).WithDetails("model=" + model)
+	}
+	if opts.JSONMode() && !limits.jsonMode {
+		return apperr.New(apperr.CodeValidation, "该模型不支持 JSON 模式").WithDetails("model=" + model)
+	}
+	if !limits.sampling && (opts.Temperature != nil || opts.TopP != nil) {
+		return apperr.New(apperr.CodeValidation, "该模型不支持 temperature 和 top_p (请检查请求参数和人设的 temperature)").WithDetails("model=" + model)
+	}
+	return nil
+}
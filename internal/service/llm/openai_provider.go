@@ -3,6 +3,8 @@ package llm
 import (
 	"context"
 	"errors" // Import standard errors package
+	"net/http"
+	"strings"
 
 	"github.com/soaringjerry/dreamhub/internal/entity"
 	"github.com/soaringjerry/dreamhub/internal/service"
@@ -40,6 +42,7 @@ func NewOpenAIProvider(cfg *config.Config) (service.LLMProvider, error) {
 	opts := []openai.Option{
 		openai.WithModel(modelName),
 		openai.WithToken(cfg.OpenAIAPIKey),
+		openai.WithHTTPClient(&patchingDoer{next: http.DefaultClient}), // 补充 langchaingo 不支持的请求参数 (见 requestOptions)
 		// openai.WithBaseURL(cfg.OpenAIBaseURL), // 如果使用代理或 Azure OpenAI
 		// openai.WithOrganization(cfg.OpenAIOrgID),
 		// openai.WithStreamingFunc(func(ctx context.Context, chunk []byte) error { ... }), // 全局流式处理函数 (通常在调用时指定)
@@ -59,9 +62,12 @@ func NewOpenAIProvider(cfg *config.Config) (service.LLMProvider, error) {
 }
 
 // GenerateContent 使用 OpenAI 生成回复。
-func (p *openAIProvider) GenerateContent(ctx context.Context, messages []*entity.Message, modelName string) (string, error) {
+func (p *openAIProvider) GenerateContent(ctx context.Context, messages []*entity.Message, modelName string, opts *entity.GenerationOptions) (string, error) {
 	// 将 entity.Message 转换为 langchaingo 的 schema.ChatMessage
 	chatMessages := convertToLangchainMessages(messages)
+	if opts.JSONMode() {
+		chatMessages = ensureJSONInstruction(chatMessages)
+	}
 
 	// 确定要使用的模型名称
 	targetModel := p.modelName // 默认模型
@@ -71,8 +77,8 @@ func (p *openAIProvider) GenerateContent(ctx context.Context, messages []*entity
 
 	// 调用 langchaingo 的 GenerateContent 方法处理聊天消息
 	// TODO: 添加重试、限流等逻辑 (参考 DETAILED_PLAN.md 2.3)
-	resp, err := p.client.GenerateContent(ctx, chatMessages, llms.WithModel(targetModel))
-	// 可以添加其他选项: llms.WithTemperature(0.7) 等
+	callCtx, callOpts := requestOptions(ctx, targetModel, opts)
+	resp, err := p.client.GenerateContent(callCtx, chatMessages, callOpts...)
 
 	if err != nil {
 		logger.ErrorContext(ctx, "调用 OpenAI API 失败", "error", err, "model", targetModel)
@@ -91,8 +97,11 @@ func (p *openAIProvider) GenerateContent(ctx context.Context, messages []*entity
 }
 
 // GenerateContentStream 使用 OpenAI 流式生成回复。
-func (p *openAIProvider) GenerateContentStream(ctx context.Context, messages []*entity.Message, modelName string, streamFn func(chunk string)) error {
+func (p *openAIProvider) GenerateContentStream(ctx context.Context, messages []*entity.Message, modelName string, opts *entity.GenerationOptions, streamFn func(chunk string)) error {
 	chatMessages := convertToLangchainMessages(messages)
+	if opts.JSONMode() {
+		chatMessages = ensureJSONInstruction(chatMessages)
+	}
 
 	// 确定要使用的模型名称
 	targetModel := p.modelName // 默认模型
@@ -106,8 +115,8 @@ func (p *openAIProvider) GenerateContentStream(ctx context.Context, messages []*
 	logger.WarnContext(ctx, "GenerateContentStream: 流式处理尚未完全实现，将使用非流式调用。", "model", targetModel)
 
 	// 调用非流式方法（临时）
-	resp, err := p.client.GenerateContent(ctx, chatMessages, llms.WithModel(targetModel))
-	// 可以添加其他选项: llms.WithTemperature(0.7) 等
+	callCtx, callOpts := requestOptions(ctx, targetModel, opts)
+	resp, err := p.client.GenerateContent(callCtx, chatMessages, callOpts...)
 
 	if err != nil && !errors.Is(err, context.Canceled) { // 忽略由 context 取消引起的错误
 		logger.ErrorContext(ctx, "调用 OpenAI (非流式) API 失败", "error", err, "model", targetModel)
@@ -126,6 +135,68 @@ func (p *openAIProvider) GenerateContentStream(ctx context.Context, messages []*
 	return nil
 }
 
+// ValidateGenerationOptions 检查生成参数是否在模型的限制之内。
+func (p *openAIProvider) ValidateGenerationOptions(modelName string, opts *entity.GenerationOptions) error {
+	if modelName == "" {
+		modelName = p.modelName
+	}
+	return validateModelOptions(modelName, opts)
+}
+
+// requestOptions 将模型名称和生成参数转换为 langchaingo 的调用选项。
+// 当前版本的 langchaingo 不会发送 top_p 和为 0 的 seed，并且总是发送 temperature (推理模型只接受默认值)，
+// 这些字段通过 context 中的 requestPatch 由 patchingDoer 直接修改请求体。
+func requestOptions(ctx context.Context, model string, opts *entity.GenerationOptions) (context.Context, []llms.CallOption) {
+	callOpts := []llms.CallOption{llms.WithModel(model)}
+	patch := &requestPatch{set: map[string]any{}}
+	if !lookupModelLimits(model).sampling {
+		patch.remove = append(patch.remove, "temperature")
+	}
+	if opts != nil {
+		if opts.Temperature != nil {
+			callOpts = append(callOpts, llms.WithTemperature(*opts.Temperature))
+		}
+		if opts.TopP != nil {
+			callOpts = append(callOpts, llms.WithTopP(*opts.TopP))
+			patch.set["top_p"] = *opts.TopP
+		}
+		if opts.MaxTokens != nil {
+			callOpts = append(callOpts, llms.WithMaxTokens(*opts.MaxTokens)) // 发送为 max_completion_tokens
+		}
+		if len(opts.Stop) > 0 {
+			callOpts = append(callOpts, llms.WithStopWords(opts.Stop))
+		}
+		if opts.Seed != nil {
+			callOpts = append(callOpts, llms.WithSeed(*opts.Seed))
+			if *opts.Seed == 0 {
+				patch.set["seed"] = 0
+			}
+		}
+		if opts.JSONMode() {
+			callOpts = append(callOpts, llms.WithJSONMode())
+		}
+	}
+	if len(patch.set) > 0 || len(patch.remove) > 0 {
+		ctx = withRequestPatch(ctx, patch)
+	}
+	return ctx, callOpts
+}
+
+// jsonModeInstruction 在 JSON 模式下追加的系统消息。OpenAI 要求 JSON 模式的消息中必须出现 "JSON" 一词。
+const jsonModeInstruction = "Respond only with a valid JSON object."
+
+// ensureJSONInstruction 在消息中没有提到 JSON 时追加 jsonModeInstruction。
+func ensureJSONInstruction(messages []llms.MessageContent) []llms.MessageContent {
+	for _, msg := range messages {
+		for _, part := range msg.Parts {
+			if text, ok := part.(llms.TextContent); ok && strings.Contains(strings.ToLower(text.Text), "json") {
+				return messages
+			}
+		}
+	}
+	return append(messages, llms.TextParts(llms.ChatMessageTypeSystem, jsonModeInstruction))
+}
+
 // convertToLangchainMessages 将内部的 Message 实体转换为 langchaingo 的 llms.MessageContent。
 func convertToLangchainMessages(messages []*entity.Message) []llms.MessageContent {
 	lcMessages := make([]llms.MessageContent, 0, len(messages))
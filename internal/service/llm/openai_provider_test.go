@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestRequestOptions(t *testing.T) {
+	temperature, topP, zero, maxTokens, seed := 0.2, 0.9, 0, 256, 42
+	tests := []struct {
+		name      string
+		model     string
+		opts      *entity.GenerationOptions
+		wantCall  llms.CallOptions
+		wantPatch *requestPatch // nil 表示不修改请求体
+	}{
+		{
+			name:     "defaults",
+			model:    "gpt-4o",
+			wantCall: llms.CallOptions{Model: "gpt-4o"},
+		},
+		{
+			name:  "all options",
+			model: "gpt-4o",
+			opts: &entity.GenerationOptions{
+				Temperature: &temperature, TopP: &topP, MaxTokens: &maxTokens, Stop: []string{"END"}, Seed: &seed,
+				ResponseFormat: entity.ResponseFormatJSON,
+			},
+			wantCall: llms.CallOptions{
+				Model: "gpt-4o", Temperature: 0.2, TopP: 0.9, MaxTokens: 256, StopWords: []string{"END"}, Seed: 42, JSONMode: true,
+			},
+			// langchaingo 不发送 top_p，需要直接写入请求体
+			wantPatch: &requestPatch{set: map[string]any{"top_p": 0.9}},
+		},
+		{
+			name:      "seed 0 is sent explicitly",
+			model:     "gpt-4o",
+			opts:      &entity.GenerationOptions{Seed: &zero},
+			wantCall:  llms.CallOptions{Model: "gpt-4o"},
+			wantPatch: &requestPatch{set: map[string]any{"seed": 0}},
+		},
+		{
+			name:      "model without sampling drops temperature",
+			model:     "o3-mini",
+			wantCall:  llms.CallOptions{Model: "o3-mini"},
+			wantPatch: &requestPatch{set: map[string]any{}, remove: []string{"temperature"}},
+		},
+		{
+			name:      "dated snapshot of a model without sampling",
+			model:     "o1-2024-12-17",
+			opts:      &entity.GenerationOptions{MaxTokens: &maxTokens},
+			wantCall:  llms.CallOptions{Model: "o1-2024-12-17", MaxTokens: 256},
+			wantPatch: &requestPatch{set: map[string]any{}, remove: []string{"temperature"}},
+		},
+		{
+			name:     "unknown model keeps temperature",
+			model:    "llama-3-70b",
+			opts:     &entity.GenerationOptions{Temperature: &temperature},
+			wantCall: llms.CallOptions{Model: "llama-3-70b", Temperature: 0.2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, callOpts := requestOptions(context.Background(), tt.model, tt.opts)
+
+			var got llms.CallOptions
+			for _, opt := range callOpts {
+				opt(&got)
+			}
+			if !reflect.DeepEqual(got, tt.wantCall) {
+				t.Errorf("call options = %+v, want %+v", got, tt.wantCall)
+			}
+
+			patch, _ := ctx.Value(requestPatchKey{}).(*requestPatch)
+			if tt.wantPatch == nil {
+				if patch != nil {
+					t.Errorf("request patch = %+v, want none", patch)
+				}
+				return
+			}
+			if patch == nil || !reflect.DeepEqual(*patch, *tt.wantPatch) {
+				t.Errorf("request patch = %+v, want %+v", patch, tt.wantPatch)
+			}
+		})
+	}
+}
+
+func TestLookupModelLimits(t *testing.T) {
+	tests := []struct {
+		model string
+		want  modelLimits
+	}{
+		{"gpt-4o", openAIModelLimits["gpt-4o"]},
+		{"GPT-4o-2024-08-06", openAIModelLimits["gpt-4o"]},
+		{"gpt-4o-mini", openAIModelLimits["gpt-4o-mini"]},
+		{"gpt-4o-mini-2024-07-18", openAIModelLimits["gpt-4o-mini"]},
+		{"gpt-4-0125-preview", openAIModelLimits["gpt-4-0125"]},
+		{"gpt-4", openAIModelLimits["gpt-4"]},
+		{"o3-mini", openAIModelLimits["o3-mini"]},
+		{"o3", openAIModelLimits["o3"]},
+		{"gpt-4oo", unknownModelLimits}, // 前缀后必须是 "-"
+		{"llama-3-70b", unknownModelLimits},
+		{"", unknownModelLimits},
+	}
+	for _, tt := range tests {
+		if got := lookupModelLimits(tt.model); got != tt.want {
+			t.Errorf("lookupModelLimits(%q) = %+v, want %+v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestValidateModelOptions(t *testing.T) {
+	temperature, tooMany, ok := 0.5, 16385, 16384
+	tests := []struct {
+		name  string
+		model string
+		opts  *entity.GenerationOptions
+		valid bool
+	}{
+		{"nil options", "o3-mini", nil, true},
+		{"max tokens at limit", "gpt-4o", &entity.GenerationOptions{MaxTokens: &ok}, true},
+		{"max tokens over limit", "gpt-4o", &entity.GenerationOptions{MaxTokens: &tooMany}, false},
+		{"unknown model is not limited", "llama-3-70b", &entity.GenerationOptions{MaxTokens: &tooMany}, true},
+		{"JSON mode supported", "gpt-4o", &entity.GenerationOptions{ResponseFormat: entity.ResponseFormatJSON}, true},
+		{"JSON mode unsupported", "gpt-4", &entity.GenerationOptions{ResponseFormat: entity.ResponseFormatJSON}, false},
+		{"temperature on a reasoning model", "o3-mini", &entity.GenerationOptions{Temperature: &temperature}, false},
+		{"top_p on a reasoning model", "o1", &entity.GenerationOptions{TopP: &temperature}, false},
+		{"temperature on a sampling model", "gpt-4o", &entity.GenerationOptions{Temperature: &temperature}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateModelOptions(tt.model, tt.opts)
+			if tt.valid && err != nil {
+				t.Errorf("validateModelOptions() = %v, want nil", err)
+			}
+			if !tt.valid && !apperr.Is(err, apperr.CodeValidation) {
+				t.Errorf("validateModelOptions() = %v, want code %s", err, apperr.CodeValidation)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// requestPatch 是需要直接修改的 chat completions 请求体字段 (langchaingo 不支持或处理不正确的参数)。
+type requestPatch struct {
+	set    map[string]any // 设置 (或覆盖) 的字段
+	remove []string       // 删除的字段
+}
+
+type requestPatchKey struct{}
+
+// withRequestPatch 返回携带 patch 的 context，patchingDoer 在发送请求时应用它。
+func withRequestPatch(ctx context.Context, patch *requestPatch) context.Context {
+	return context.WithValue(ctx, requestPatchKey{}, patch)
+}
+
+// httpDoer 与 langchaingo openai 客户端使用的 HTTP 客户端接口相同。
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// patchingDoer 在发送请求前将 context 中的 requestPatch 应用到 JSON 请求体。
+type patchingDoer struct {
+	next httpDoer
+}
+
+// Do 实现 httpDoer 接口。没有 patch 或请求体不是 JSON 对象时原样发送。
+func (d *patchingDoer) Do(req *http.Request) (*http.Response, error) {
+	patch, ok := req.Context().Value(requestPatchKey{}).(*requestPatch)
+	if !ok || req.Body == nil {
+		return d.next.Do(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if patched, err := applyRequestPatch(body, patch); err == nil {
+		body = patched
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return d.next.Do(req)
+}
+
+// applyRequestPatch 返回应用 patch 后的 JSON 请求体。
+func applyRequestPatch(body []byte, patch *requestPatch) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for _, key := range patch.remove {
+		delete(fields, key)
+	}
+	for key, value := range patch.set {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = raw
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyRequestPatch(t *testing.T) {
+	const body = `{"model":"o3-mini","messages":[{"role":"user","content":"hi"}],"temperature":0}`
+	tests := []struct {
+		name    string
+		body    string
+		patch   *requestPatch
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:  "remove temperature",
+			body:  body,
+			patch: &requestPatch{remove: []string{"temperature"}},
+			want:  map[string]any{"model": "o3-mini", "messages": []any{map[string]any{"role": "user", "content": "hi"}}},
+		},
+		{
+			name:  "set top_p and seed 0",
+			body:  `{"model":"gpt-4o","top_p":0}`,
+			patch: &requestPatch{set: map[string]any{"top_p": 0.0, "seed": 0}},
+			want:  map[string]any{"model": "gpt-4o", "top_p": 0.0, "seed": 0.0},
+		},
+		{
+			name:  "set overrides existing value",
+			body:  `{"model":"gpt-4o","top_p":1}`,
+			patch: &requestPatch{set: map[string]any{"top_p": 0.5}},
+			want:  map[string]any{"model": "gpt-4o", "top_p": 0.5},
+		},
+		{
+			name:  "remove missing field",
+			body:  `{"model":"gpt-4o"}`,
+			patch: &requestPatch{remove: []string{"temperature"}},
+			want:  map[string]any{"model": "gpt-4o"},
+		},
+		{
+			name:  "empty patch keeps fields",
+			body:  body,
+			patch: &requestPatch{},
+			want:  map[string]any{"model": "o3-mini", "messages": []any{map[string]any{"role": "user", "content": "hi"}}, "temperature": 0.0},
+		},
+		{name: "not JSON", body: "model=gpt-4o", patch: &requestPatch{remove: []string{"temperature"}}, wantErr: true},
+		{name: "JSON array", body: `[{"model":"gpt-4o"}]`, patch: &requestPatch{remove: []string{"temperature"}}, wantErr: true},
+		{name: "unmarshalable value", body: `{}`, patch: &requestPatch{set: map[string]any{"x": func() {}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyRequestPatch([]byte(tt.body), tt.patch)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("applyRequestPatch() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyRequestPatch() error = %v", err)
+			}
+			var fields map[string]any
+			if err := json.Unmarshal(got, &fields); err != nil {
+				t.Fatalf("applyRequestPatch() returned invalid JSON %s: %v", got, err)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("applyRequestPatch() = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+// recordingDoer 记录收到的请求体并返回空响应。
+type recordingDoer struct {
+	body          string
+	contentLength int64
+	getBody       string
+}
+
+func (d *recordingDoer) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		data, _ := io.ReadAll(req.Body)
+		d.body = string(data)
+	}
+	d.contentLength = req.ContentLength
+	if req.GetBody != nil {
+		rc, _ := req.GetBody()
+		data, _ := io.ReadAll(rc)
+		d.getBody = string(data)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestPatchingDoer(t *testing.T) {
+	removeTemperature := &requestPatch{remove: []string{"temperature"}}
+	tests := []struct {
+		name  string
+		body  string
+		patch *requestPatch
+		want  string
+	}{
+		{"no patch", `{"model":"gpt-4o","temperature":0.2}`, nil, `{"model":"gpt-4o","temperature":0.2}`},
+		{"patch applied", `{"model":"o3-mini","temperature":0}`, removeTemperature, `{"model":"o3-mini"}`},
+		{"not JSON passes through", "not json", removeTemperature, "not json"},
+		{"JSON array passes through", `["temperature"]`, removeTemperature, `["temperature"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.patch != nil {
+				ctx = withRequestPatch(ctx, tt.patch)
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/chat/completions", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := &recordingDoer{}
+			resp, err := (&patchingDoer{next: next}).Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+
+			if next.body != tt.want {
+				t.Errorf("sent body = %s, want %s", next.body, tt.want)
+			}
+			if next.contentLength != int64(len(tt.want)) {
+				t.Errorf("ContentLength = %d, want %d", next.contentLength, len(tt.want))
+			}
+			if next.getBody != tt.want {
+				t.Errorf("GetBody() = %s, want %s", next.getBody, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchingDoerWithoutBody(t *testing.T) {
+	req, err := http.NewRequestWithContext(withRequestPatch(context.Background(), &requestPatch{remove: []string{"temperature"}}), http.MethodGet, "https://api.openai.com/v1/models", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &recordingDoer{}
+	if _, err := (&patchingDoer{next: next}).Do(req); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if next.body != "" {
+		t.Errorf("sent body = %q, want none", next.body)
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// MaintenanceService 定义了由定时任务触发的数据维护操作。
+// 每个方法都可以安全地重复执行，返回本次执行的处理数量汇总。
+type MaintenanceService interface {
+	// ReconcileOrphanFiles 对账存储中的文件与 documents / upload_session_parts / conversation_import_files 表：
+	// 删除超过宽限期且没有被引用的文件，将存储文件已丢失的文档标记为失败。
+	// 存储不支持遍历 (未实现 ListableFileStorage) 时跳过。
+	ReconcileOrphanFiles(ctx context.Context) (*entity.MaintenanceReport, error)
+
+	// PurgeTaskHistory 删除超过保留期的已结束任务记录和任务失败历史。
+	PurgeTaskHistory(ctx context.Context) (*entity.MaintenanceReport, error)
+
+	// ResetStaleDocuments 处理长时间停留在 processing 状态的文档：
+	// 关联任务仍在队列中时不处理；任务已进入死信队列时将文档标记为失败；
+	// 任务已丢失 (例如 Worker 崩溃且 Redis 数据丢失) 时重新入队处理任务。
+	ResetStaleDocuments(ctx context.Context) (*entity.MaintenanceReport, error)
+
+	// MaintainVectorIndex 删除所属文档已不存在的向量块，并 VACUUM 向量表 (按配置重建向量索引)。
+	MaintainVectorIndex(ctx context.Context) (*entity.MaintenanceReport, error)
+
+	// PurgeExpiredUploads 删除已过期的可恢复上传会话及其数据块文件。
+	// 刚过期的 finalizing 会话可能仍在合并中，额外等待一段宽限期后才删除。
+	PurgeExpiredUploads(ctx context.Context) (*entity.MaintenanceReport, error)
+}
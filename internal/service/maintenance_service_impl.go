@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// staleDocumentBatchSize 是每次执行最多处理的卡住文档数量。
+	staleDocumentBatchSize = 100
+	// reconcileSafetyMinCount 和 reconcileSafetyMaxRatio 限制单次对账可以删除的孤立文件 (或标记的丢失文件) 数量：
+	// 超过 reconcileSafetyMinCount 个且超过总数的 reconcileSafetyMaxRatio 时放弃本次对账。
+	// 这种情况通常是 UPLOAD_DIR 等配置发生了变化，而不是真的有大量孤立文件。
+	reconcileSafetyMinCount = 100
+	reconcileSafetyMaxRatio = 0.5
+	// expiredUploadBatchSize 是每批清理的过期上传会话数量。
+	expiredUploadBatchSize = 100
+	// staleFinalizingGrace 是处于 finalizing 状态的过期会话在被清理前的额外宽限期，避免清理正在合并的会话。
+	staleFinalizingGrace = time.Hour
+)
+
+// 维护报告中使用的计数键。
+const (
+	countFilesScanned        = "files_scanned"
+	countOrphanFilesDeleted  = "orphan_files_deleted"
+	countOrphanFilesFailed   = "orphan_files_delete_failed"
+	countMissingFileDocs     = "documents_missing_file"
+	countTasksDeleted        = "tasks_deleted"
+	countTaskFailuresDeleted = "task_failures_deleted"
+	countStaleDocuments      = "stale_documents"
+	countStaleStillQueued    = "still_queued"
+	countStaleReenqueued     = "reenqueued"
+	countStaleMarkedFailed   = "marked_failed"
+	countOrphanChunksDeleted = "orphan_chunks_deleted"
+	countUploadsDeleted      = "upload_sessions_deleted"
+	countUploadPartsFailed   = "upload_parts_delete_failed"
+)
+
+// Ensure maintenanceServiceImpl implements MaintenanceService interface.
+var _ MaintenanceService = (*maintenanceServiceImpl)(nil)
+
+// maintenanceServiceImpl 是 MaintenanceService 接口的实现。
+type maintenanceServiceImpl struct {
+	fileStorage       FileStorage
+	docRepo           repository.DocumentRepository
+	uploadSessionRepo repository.UploadSessionRepository
+	taskRepo          repository.TaskRepository
+	failureRepo       repository.TaskFailureRepository
+	vectorRepo        repository.VectorRepository
+	importFiles       repository.ConversationImportFileRepository
+	inspector         TaskInspector
+	taskQueue         TaskQueueClient
+	cfg               *config.Config
+}
+
+// NewMaintenanceService 创建一个新的 maintenanceServiceImpl 实例。
+func NewMaintenanceService(
+	fs FileStorage,
+	docRepo repository.DocumentRepository,
+	uploadSessionRepo repository.UploadSessionRepository,
+	taskRepo repository.TaskRepository,
+	failureRepo repository.TaskFailureRepository,
+	vectorRepo repository.VectorRepository,
+	importFiles repository.ConversationImportFileRepository,
+	inspector TaskInspector,
+	taskQueue TaskQueueClient,
+	cfg *config.Config,
+) MaintenanceService {
+	return &maintenanceServiceImpl{
+		fileStorage:       fs,
+		docRepo:           docRepo,
+		uploadSessionRepo: uploadSessionRepo,
+		taskRepo:          taskRepo,
+		failureRepo:       failureRepo,
+		vectorRepo:        vectorRepo,
+		importFiles:       importFiles,
+		inspector:         inspector,
+		taskQueue:         taskQueue,
+		cfg:               cfg,
+	}
+}
+
+// ReconcileOrphanFiles 实现 MaintenanceService 接口。
+// 先读取数据库中的引用再遍历存储：遍历期间新保存的文件修改时间在宽限期内，不会被误删。
+func (s *maintenanceServiceImpl) ReconcileOrphanFiles(ctx context.Context) (*entity.MaintenanceReport, error) {
+	report := entity.NewMaintenanceReport(entity.TaskTypeMaintenanceOrphanFiles)
+	listable, ok := s.fileStorage.(ListableFileStorage)
+	if !ok {
+		logger.WarnContext(ctx, "文件存储不支持遍历，跳过孤立文件对账")
+		return report.Finish(), nil
+	}
+
+	refs, err := s.docRepo.ListStoredFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	partPaths, err := s.uploadSessionRepo.ListPartPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-s.cfg.OrphanFileGracePeriod)
+	importPaths, err := s.pendingImportPaths(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool, len(refs)+len(partPaths)+len(importPaths)) // 路径 -> 是否在存储中找到
+	for _, ref := range refs {
+		referenced[filepath.Clean(ref.StoredPath)] = false
+	}
+	for _, path := range partPaths {
+		referenced[filepath.Clean(path)] = false
+	}
+	for _, path := range importPaths {
+		referenced[filepath.Clean(path)] = false
+	}
+
+	orphans := make([]string, 0)
+	err = listable.WalkFiles(ctx, func(storedPath string, modTime time.Time) error {
+		report.Add(countFilesScanned, 1)
+		key := filepath.Clean(storedPath)
+		if _, ok := referenced[key]; ok {
+			referenced[key] = true
+			return nil
+		}
+		if modTime.Before(cutoff) {
+			orphans = append(orphans, storedPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]*repository.StoredFileRef, 0)
+	for _, ref := range refs {
+		if !referenced[filepath.Clean(ref.StoredPath)] && ref.ProcessingStatus != entity.TaskStatusFailed {
+			missing = append(missing, ref)
+		}
+	}
+	if exceedsSafetyLimit(len(orphans), int(report.Counts[countFilesScanned])) || exceedsSafetyLimit(len(missing), len(refs)) {
+		logger.ErrorContext(ctx, "孤立文件或丢失文件数量异常，放弃本次对账 (请检查 UPLOAD_DIR 配置是否变化)",
+			"orphan_files", len(orphans), "missing_files", len(missing), "files_scanned", report.Counts[countFilesScanned], "documents", len(refs))
+		return nil, apperr.New(apperr.CodeConflict, "孤立文件数量异常，已放弃对账").
+			WithDetails(fmt.Sprintf("orphan_files=%d", len(orphans)), fmt.Sprintf("missing_files=%d", len(missing)))
+	}
+
+	for _, path := range orphans {
+		if err := s.fileStorage.DeleteFile(ctx, path); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+			logger.WarnContext(ctx, "删除孤立文件失败", "error", err, "path", path)
+			report.Add(countOrphanFilesFailed, 1)
+			continue
+		}
+		report.Add(countOrphanFilesDeleted, 1)
+	}
+
+	for _, ref := range missing {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if s.markMissingFile(ctx, ref) {
+			report.Add(countMissingFileDocs, 1)
+		}
+	}
+	return report.Finish(), nil
+}
+
+// pendingImportPaths 返回导入任务仍在队列中 (等待执行、重试或在死信队列中等待手动重试) 的导入文件路径。
+// 任务已不在队列中的记录 (以及超过宽限期仍没有任务 ID 的记录) 会被删除，对应的文件随后作为孤立文件清理。
+func (s *maintenanceServiceImpl) pendingImportPaths(ctx context.Context, cutoff time.Time) ([]string, error) {
+	files, err := s.importFiles.ListImportFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.TaskID == "" {
+			if file.CreatedAt.After(cutoff) {
+				paths = append(paths, file.StoredPath) // 可能刚刚入队，还没有记录任务 ID
+				continue
+			}
+		} else if s.inspector != nil {
+			state, err := s.inspector.GetTaskState(ctx, file.TaskID)
+			switch {
+			case err == nil && state != "completed":
+				paths = append(paths, file.StoredPath)
+				continue
+			case err != nil && !apperr.Is(err, apperr.CodeNotFound):
+				return nil, err
+			}
+		} else {
+			paths = append(paths, file.StoredPath) // 无法查询任务状态时保留文件
+			continue
+		}
+		if err := s.importFiles.DeleteImportFile(ctx, file.StoredPath); err != nil {
+			logger.WarnContext(ctx, "删除导入文件记录失败", "error", err, "stored_path", file.StoredPath)
+			paths = append(paths, file.StoredPath) // 下次对账再处理
+		}
+	}
+	return paths, nil
+}
+
+// markMissingFile 确认文档的存储文件确实丢失后将文档标记为失败，返回是否标记。
+// 对账期间文档可能被删除或替换了内容 (存储路径变化)，这些情况不处理。
+func (s *maintenanceServiceImpl) markMissingFile(ctx context.Context, ref *repository.StoredFileRef) bool {
+	doc, err := s.docRepo.GetDocumentByID(ctx, ref.UserID, ref.DocumentID)
+	if err != nil || doc.StoredPath != ref.StoredPath {
+		return false
+	}
+	reader, err := s.fileStorage.GetFileReader(ctx, doc.StoredPath)
+	if err == nil {
+		reader.Close()
+		return false
+	}
+	if !apperr.Is(err, apperr.CodeNotFound) {
+		logger.WarnContext(ctx, "检查文档存储文件失败", "error", err, "document_id", doc.ID)
+		return false
+	}
+	logger.WarnContext(ctx, "文档的存储文件已丢失，标记为失败", "document_id", doc.ID, "user_id", doc.UserID, "path", doc.StoredPath)
+	if err := s.docRepo.UpdateDocumentStatus(ctx, doc.UserID, doc.ID, entity.TaskStatusFailed, doc.ProcessingTaskID, "存储中的文件已丢失，请重新上传"); err != nil {
+		return false
+	}
+	return true
+}
+
+// PurgeTaskHistory 实现 MaintenanceService 接口。
+func (s *maintenanceServiceImpl) PurgeTaskHistory(ctx context.Context) (*entity.MaintenanceReport, error) {
+	report := entity.NewMaintenanceReport(entity.TaskTypeMaintenanceTaskRetention)
+	before := time.Now().Add(-s.cfg.TaskRetention)
+
+	deleted, err := s.taskRepo.DeleteFinishedTasksBefore(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	report.Add(countTasksDeleted, deleted)
+
+	deleted, err = s.failureRepo.DeleteBefore(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	report.Add(countTaskFailuresDeleted, deleted)
+	return report.Finish(), nil
+}
+
+// ResetStaleDocuments 实现 MaintenanceService 接口。
+func (s *maintenanceServiceImpl) ResetStaleDocuments(ctx context.Context) (*entity.MaintenanceReport, error) {
+	report := entity.NewMaintenanceReport(entity.TaskTypeMaintenanceStaleDocuments)
+	docs, err := s.docRepo.ListStaleProcessingDocuments(ctx, time.Now().Add(-s.cfg.StaleProcessingTimeout), staleDocumentBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	report.Add(countStaleDocuments, int64(len(docs)))
+
+	for _, doc := range docs {
+		if doc.ProcessingTaskID != nil {
+			state, err := s.inspector.GetTaskState(ctx, *doc.ProcessingTaskID)
+			switch {
+			case err == nil && state == string(entity.FailedTaskStateArchived):
+				// 任务已进入死信队列但处理器没能更新文档状态 (例如 Worker 在处理中崩溃)
+				if err := s.docRepo.UpdateDocumentStatus(ctx, doc.UserID, doc.ID, entity.TaskStatusFailed, doc.ProcessingTaskID, "处理任务失败，请在失败任务列表中重试"); err == nil {
+					report.Add(countStaleMarkedFailed, 1)
+				}
+				continue
+			case err == nil && state != "completed":
+				report.Add(countStaleStillQueued, 1) // 仍在执行或等待重试，交给 Asynq 处理
+				continue
+			case err != nil && !apperr.Is(err, apperr.CodeNotFound):
+				return nil, err
+			}
+		}
+
+		newTaskID, err := s.reenqueue(ctx, doc)
+		if err != nil {
+			if apperr.Is(err, apperr.CodeRateLimited) {
+				logger.WarnContext(ctx, "任务队列繁忙，剩余的卡住文档留到下次处理")
+				break
+			}
+			logger.WarnContext(ctx, "重新入队卡住的文档失败", "error", err, "document_id", doc.ID)
+			continue
+		}
+		logger.InfoContext(ctx, "已重新入队卡住的文档", "document_id", doc.ID, "user_id", doc.UserID, "new_task_id", newTaskID)
+		if err := s.docRepo.UpdateDocumentStatus(ctx, doc.UserID, doc.ID, entity.TaskStatusPending, &newTaskID, ""); err != nil {
+			logger.WarnContext(ctx, "重置文档处理状态失败", "error", err, "document_id", doc.ID, "new_task_id", newTaskID)
+		}
+		report.Add(countStaleReenqueued, 1)
+	}
+	return report.Finish(), nil
+}
+
+// reenqueue 按文档来源重新入队处理任务 (bulk 优先级)：URL 文档重新抓取，其他文档重新生成 Embedding。
+func (s *maintenanceServiceImpl) reenqueue(ctx context.Context, doc *entity.Document) (string, error) {
+	if doc.SourceURL != nil {
+		return s.taskQueue.EnqueueFetchURLTask(ctx, &entity.FetchURLTaskPayload{UserID: doc.UserID, DocumentID: doc.ID, Priority: entity.TaskPriorityBulk})
+	}
+	return s.taskQueue.EnqueueEmbeddingTask(ctx, entity.NewEmbeddingTaskPayload(doc, doc.ContentType, entity.TaskPriorityBulk))
+}
+
+// MaintainVectorIndex 实现 MaintenanceService 接口。
+func (s *maintenanceServiceImpl) MaintainVectorIndex(ctx context.Context) (*entity.MaintenanceReport, error) {
+	report := entity.NewMaintenanceReport(entity.TaskTypeMaintenanceVectorIndex)
+	deleted, err := s.vectorRepo.DeleteOrphanedChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.Add(countOrphanChunksDeleted, deleted)
+
+	if err := s.vectorRepo.OptimizeIndexes(ctx, s.cfg.VectorReindex); err != nil {
+		return nil, err
+	}
+	return report.Finish(), nil
+}
+
+// exceedsSafetyLimit 判断 n 是否超过对账的安全上限 (见 reconcileSafetyMaxRatio)。
+func exceedsSafetyLimit(n int, total int) bool {
+	return n > reconcileSafetyMinCount && float64(n) > float64(total)*reconcileSafetyMaxRatio
+}
+
+// PurgeExpiredUploads 实现 MaintenanceService 接口。
+func (s *maintenanceServiceImpl) PurgeExpiredUploads(ctx context.Context) (*entity.MaintenanceReport, error) {
+	report := entity.NewMaintenanceReport(entity.TaskTypeMaintenanceExpiredUploads)
+	for {
+		now := time.Now()
+		sessions, err := s.uploadSessionRepo.ListExpiredSessions(ctx, now, expiredUploadBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		progress := 0
+		for _, session := range sessions {
+			if session.Status == entity.UploadSessionStatusFinalizing && session.ExpiresAt.After(now.Add(-staleFinalizingGrace)) {
+				continue // 可能仍在合并中
+			}
+			parts, err := s.uploadSessionRepo.ListParts(ctx, session.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, part := range parts {
+				if err := s.fileStorage.DeleteFile(ctx, part.StoredPath); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+					// 没有删除的数据块会在孤立文件对账时清理
+					logger.WarnContext(ctx, "删除过期上传的数据块失败", "error", err, "stored_path", part.StoredPath)
+					report.Add(countUploadPartsFailed, 1)
+				}
+			}
+			if err := s.uploadSessionRepo.DeleteSession(ctx, session.UserID, session.ID); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+				return nil, err
+			}
+			progress++
+		}
+		report.Add(countUploadsDeleted, int64(progress))
+		if len(sessions) < expiredUploadBatchSize || progress == 0 {
+			break
+		}
+	}
+	return report.Finish(), nil
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// MemoryContextProvider 定义了为聊天消息选择要注入提示词的结构化记忆的接口。
+type MemoryContextProvider interface {
+	// SelectMemories 返回要注入提示词的用户记忆，总长度不超过配置的 token 预算。
+	// 全部记忆都在预算之内时返回全部记忆 (按 key 排序)；否则按与 query 的相关度 (或最近更新时间) 从高到低选择。
+	// 没有记忆或注入被禁用时返回空列表。
+	SelectMemories(ctx context.Context, userID string, query string) ([]*entity.StructuredMemory, error)
+}
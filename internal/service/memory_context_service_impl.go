@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure memoryContextServiceImpl implements MemoryContextProvider interface.
+var _ MemoryContextProvider = (*memoryContextServiceImpl)(nil)
+
+// memoryContextServiceImpl 是 MemoryContextProvider 接口的实现。
+type memoryContextServiceImpl struct {
+	memoryRepo      repository.StructuredMemoryRepository
+	embeddingRepo   repository.MemoryEmbeddingRepository // 记忆向量缓存 (可以为 nil，此时不按相似度排序)
+	embedder        EmbeddingProvider                    // 可以为 nil，此时不按相似度排序
+	tokenBudget     int
+	semanticRanking bool
+}
+
+// NewMemoryContextService 创建一个新的 memoryContextServiceImpl 实例。
+func NewMemoryContextService(memoryRepo repository.StructuredMemoryRepository, embeddingRepo repository.MemoryEmbeddingRepository, embedder EmbeddingProvider, cfg *config.Config) MemoryContextProvider {
+	return &memoryContextServiceImpl{
+		memoryRepo:      memoryRepo,
+		embeddingRepo:   embeddingRepo,
+		embedder:        embedder,
+		tokenBudget:     cfg.MemoryContextTokenBudget,
+		semanticRanking: cfg.MemoryContextSemanticRanking && embeddingRepo != nil && embedder != nil,
+	}
+}
+
+// SelectMemories 选择要注入提示词的用户记忆。
+func (s *memoryContextServiceImpl) SelectMemories(ctx context.Context, userID string, query string) ([]*entity.StructuredMemory, error) {
+	if s.tokenBudget <= 0 {
+		return nil, nil
+	}
+	memories, err := s.memoryRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取用户记忆失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取用户记忆")
+	}
+	memories = unexpiredMemories(memories, time.Now())
+	if len(memories) == 0 {
+		return nil, nil
+	}
+
+	total := 0
+	for _, m := range memories {
+		total += memoryTokenCost(m)
+	}
+	if total <= s.tokenBudget {
+		sort.Slice(memories, func(i, j int) bool { return memories[i].Key < memories[j].Key })
+		return memories, nil
+	}
+
+	// 超出预算：按相关度排序后依次选择放得下的记忆
+	ranked := false
+	if s.semanticRanking {
+		if err := s.rankBySimilarity(ctx, userID, query, memories); err != nil {
+			logger.WarnContext(ctx, "按相似度排序记忆失败，改为按最近更新时间选择", "error", err, "user_id", userID)
+		} else {
+			ranked = true
+		}
+	}
+	if !ranked {
+		sort.SliceStable(memories, func(i, j int) bool { return memories[i].UpdatedAt.After(memories[j].UpdatedAt) })
+	}
+
+	selected := make([]*entity.StructuredMemory, 0, len(memories))
+	remaining := s.tokenBudget
+	for _, m := range memories {
+		if cost := memoryTokenCost(m); cost <= remaining {
+			selected = append(selected, m)
+			remaining -= cost
+		}
+	}
+	logger.DebugContext(ctx, "已选择注入的用户记忆", "user_id", userID, "selected", len(selected), "total", len(memories), "semantic", ranked)
+	return selected, nil
+}
+
+// rankBySimilarity 按与 query 的余弦相似度从高到低排序 memories。
+// 没有向量或向量已过期 (记忆被修改) 的记忆与 query 一起生成向量，并写入缓存。
+func (s *memoryContextServiceImpl) rankBySimilarity(ctx context.Context, userID string, query string, memories []*entity.StructuredMemory) error {
+	cached, err := s.embeddingRepo.GetMemoryEmbeddings(ctx, userID)
+	if err != nil {
+		return err
+	}
+	vectors := make(map[string][]float32, len(memories))
+	texts := []string{query}
+	var stale []*entity.StructuredMemory
+	for _, m := range memories {
+		if e, ok := cached[m.ID]; ok && e.MemoryUpdatedAt.Equal(m.UpdatedAt) {
+			vectors[m.ID] = e.Vector.Slice()
+			continue
+		}
+		stale = append(stale, m)
+		texts = append(texts, formatMemory(m))
+	}
+
+	embeddings, err := s.embedder.CreateEmbeddings(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if len(embeddings) != len(texts) {
+		return apperr.New(apperr.CodeInternal, "Embedding 服务返回的向量数量不正确")
+	}
+	for i, m := range stale {
+		vectors[m.ID] = embeddings[i+1]
+		if err := s.embeddingRepo.SaveMemoryEmbedding(ctx, m, pgvector.NewVector(embeddings[i+1])); err != nil {
+			// 缓存不是必需的，下次会重新生成
+			logger.WarnContext(ctx, "缓存记忆向量失败", "error", err, "memory_id", m.ID)
+		}
+	}
+
+	queryVector := embeddings[0]
+	scores := make(map[string]float64, len(memories))
+	for _, m := range memories {
+		scores[m.ID] = cosineSimilarity(queryVector, vectors[m.ID])
+	}
+	sort.SliceStable(memories, func(i, j int) bool { return scores[memories[i].ID] > scores[memories[j].ID] })
+	return nil
+}
+
+// unexpiredMemories 去掉在 now 时已经过期的记忆。
+func unexpiredMemories(memories []*entity.StructuredMemory, now time.Time) []*entity.StructuredMemory {
+	kept := memories[:0]
+	for _, m := range memories {
+		if !m.Expired(now) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// formatMemory 返回记忆在提示词中的文本 (也用于生成向量)。
+func formatMemory(m *entity.StructuredMemory) string {
+	return m.Key + ": " + m.Value
+}
+
+// memoryTokenCost 估算一条记忆在提示词中占用的 token 数 (包括列表符号和换行)。
+func memoryTokenCost(m *entity.StructuredMemory) int {
+	return estimateTokens(formatMemory(m)) + 2
+}
+
+// estimateTokens 粗略估算文本的 token 数：ASCII 字符约 4 个一个 token，其他字符 (例如中文) 约每个字符一个 token。
+// 只用于控制注入内容的大小，不需要与模型的分词器完全一致。
+func estimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// cosineSimilarity 返回两个向量的余弦相似度，长度不同或为零向量时返回 0。
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"favorite_color: blue", 5},
+		{"你好", 2},
+		{"ab你好", 3},
+		{"喜欢的颜色: 蓝色", 7 + 1}, // 7 个中文字符，": " 两个 ASCII 字符
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"identical", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"scaled", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"opposite", []float32{1, 0}, []float32{-1, 0}, -1},
+		{"different lengths", []float32{1, 0}, []float32{1, 0, 0}, 0},
+		{"zero vector", []float32{0, 0}, []float32{1, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := cosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%s: cosineSimilarity() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnexpiredMemories(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	memories := []*entity.StructuredMemory{
+		{Key: "no_expiry"},
+		{Key: "expired", ExpiresAt: &past},
+		{Key: "expires_now", ExpiresAt: &now},
+		{Key: "expires_later", ExpiresAt: &future},
+	}
+	var keys []string
+	for _, m := range unexpiredMemories(memories, now) {
+		keys = append(keys, m.Key)
+	}
+	if want := []string{"no_expiry", "expires_later"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("unexpiredMemories() keys = %v, want %v", keys, want)
+	}
+}
+
+// fakeMemoryRepo 只实现 GetByUserID，每次返回新的切片 (SelectMemories 会原地排序)。
+type fakeMemoryRepo struct {
+	repository.StructuredMemoryRepository
+	memories []*entity.StructuredMemory
+}
+
+func (f *fakeMemoryRepo) GetByUserID(ctx context.Context, userID string) ([]*entity.StructuredMemory, error) {
+	return append([]*entity.StructuredMemory(nil), f.memories...), nil
+}
+
+// fakeMemoryEmbeddingRepo 在内存中缓存记忆向量。
+type fakeMemoryEmbeddingRepo struct {
+	cached map[string]*repository.MemoryEmbedding
+	saved  []string
+}
+
+func (f *fakeMemoryEmbeddingRepo) GetMemoryEmbeddings(ctx context.Context, userID string) (map[string]*repository.MemoryEmbedding, error) {
+	return f.cached, nil
+}
+
+func (f *fakeMemoryEmbeddingRepo) SaveMemoryEmbedding(ctx context.Context, memory *entity.StructuredMemory, vector pgvector.Vector) error {
+	f.saved = append(f.saved, memory.ID)
+	return nil
+}
+
+// fakeEmbedder 按文本返回预设的向量，记录每次请求的文本。
+type fakeEmbedder struct {
+	vectors map[string][]float32
+	err     error
+	texts   [][]string
+}
+
+func (f *fakeEmbedder) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	f.texts = append(f.texts, texts)
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i] = f.vectors[text]
+	}
+	return out, nil
+}
+
+func (f *fakeEmbedder) GetEmbeddingDimension() int { return 2 }
+
+// memoryKeys 返回记忆的 key 列表。
+func memoryKeys(memories []*entity.StructuredMemory) []string {
+	keys := make([]string, 0, len(memories))
+	for _, m := range memories {
+		keys = append(keys, m.Key)
+	}
+	return keys
+}
+
+// testMemories 返回更新时间依次变早的记忆：city 最新，diet 最旧。
+func testMemories(now time.Time) []*entity.StructuredMemory {
+	past := now.Add(-time.Hour)
+	return []*entity.StructuredMemory{
+		{ID: "m-city", Key: "city", Value: "Berlin", UpdatedAt: now.Add(-1 * time.Minute)},
+		{ID: "m-pet", Key: "pet", Value: "a cat named Miso who likes boxes", UpdatedAt: now.Add(-2 * time.Minute)},
+		{ID: "m-trip", Key: "trip", Value: "Kyoto", UpdatedAt: now.Add(-3 * time.Minute)},
+		{ID: "m-diet", Key: "diet", Value: "vegetarian", UpdatedAt: now.Add(-4 * time.Minute)},
+		{ID: "m-old", Key: "old_job", Value: "teacher", UpdatedAt: now.Add(-5 * time.Minute), ExpiresAt: &past},
+	}
+}
+
+func TestSelectMemoriesTokenBudget(t *testing.T) {
+	now := time.Now()
+	memories := testMemories(now)
+	cost := func(keys ...string) int {
+		total := 0
+		for _, m := range memories {
+			for _, k := range keys {
+				if m.Key == k {
+					total += memoryTokenCost(m)
+				}
+			}
+		}
+		return total
+	}
+	tests := []struct {
+		name   string
+		budget int
+		want   []string
+	}{
+		{"disabled", 0, nil},
+		// 全部放得下时按 key 排序，过期的记忆不计入
+		{"everything fits", cost("city", "pet", "trip", "diet"), []string{"city", "diet", "pet", "trip"}},
+		// 超出预算时按最近更新时间选择，放不下的跳过，继续尝试后面更小的记忆
+		{"skips memories that do not fit", cost("city", "trip", "diet"), []string{"city", "trip", "diet"}},
+		{"most recent first", cost("city", "pet"), []string{"city", "pet"}},
+		{"nothing fits", cost("city") - 1, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &memoryContextServiceImpl{memoryRepo: &fakeMemoryRepo{memories: memories}, tokenBudget: tt.budget}
+			got, err := s.SelectMemories(context.Background(), "user-1", "where should I travel?")
+			if err != nil {
+				t.Fatalf("SelectMemories() error = %v", err)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("SelectMemories() = %v, want nil", memoryKeys(got))
+				}
+				return
+			}
+			if keys := memoryKeys(got); !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("SelectMemories() = %v, want %v", keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectMemoriesSemanticRanking(t *testing.T) {
+	now := time.Now()
+	memories := testMemories(now)
+	const query = "where should I travel?"
+	budget := memoryTokenCost(memories[2]) + memoryTokenCost(memories[3]) // trip + diet
+
+	embedder := &fakeEmbedder{vectors: map[string][]float32{
+		query:                                   {1, 0},
+		"city: Berlin":                          {0.6, 0.8},
+		"pet: a cat named Miso who likes boxes": {0, 1},
+		"trip: Kyoto":                           {1, 0.1},
+		"diet: vegetarian":                      {0.7, 0.7},
+		"old_job: teacher":                      {1, 0},
+	}}
+	embeddingRepo := &fakeMemoryEmbeddingRepo{cached: map[string]*repository.MemoryEmbedding{
+		// 向量是最新的，直接使用缓存
+		"m-diet": {MemoryID: "m-diet", Vector: pgvector.NewVector([]float32{0.7, 0.7}), MemoryUpdatedAt: memories[3].UpdatedAt},
+		// 记忆在生成向量后被修改过：缓存的向量与查询完全相同，但已过期，必须重新生成
+		"m-pet": {MemoryID: "m-pet", Vector: pgvector.NewVector([]float32{1, 0}), MemoryUpdatedAt: memories[1].UpdatedAt.Add(-time.Hour)},
+	}}
+	s := &memoryContextServiceImpl{
+		memoryRepo:      &fakeMemoryRepo{memories: memories},
+		embeddingRepo:   embeddingRepo,
+		embedder:        embedder,
+		tokenBudget:     budget,
+		semanticRanking: true,
+	}
+
+	got, err := s.SelectMemories(context.Background(), "user-1", query)
+	if err != nil {
+		t.Fatalf("SelectMemories() error = %v", err)
+	}
+	// 相似度：trip > diet > city > pet；预算只放得下 trip 和 diet
+	if keys, want := memoryKeys(got), []string{"trip", "diet"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("SelectMemories() = %v, want %v", keys, want)
+	}
+
+	wantTexts := []string{query, "city: Berlin", "pet: a cat named Miso who likes boxes", "trip: Kyoto"}
+	if len(embedder.texts) != 1 || !reflect.DeepEqual(embedder.texts[0], wantTexts) {
+		t.Errorf("embedded texts = %v, want %v (fresh cached vectors reused, stale and missing ones regenerated)", embedder.texts, wantTexts)
+	}
+	if want := []string{"m-city", "m-pet", "m-trip"}; !reflect.DeepEqual(embeddingRepo.saved, want) {
+		t.Errorf("cached memory vectors = %v, want %v", embeddingRepo.saved, want)
+	}
+}
+
+func TestSelectMemoriesFallsBackToRecency(t *testing.T) {
+	now := time.Now()
+	memories := testMemories(now)
+	embedder := &fakeEmbedder{err: errors.New("embedding service unavailable")}
+	s := &memoryContextServiceImpl{
+		memoryRepo:      &fakeMemoryRepo{memories: memories},
+		embeddingRepo:   &fakeMemoryEmbeddingRepo{},
+		embedder:        embedder,
+		tokenBudget:     memoryTokenCost(memories[0]) + memoryTokenCost(memories[1]),
+		semanticRanking: true,
+	}
+
+	got, err := s.SelectMemories(context.Background(), "user-1", "where should I travel?")
+	if err != nil {
+		t.Fatalf("SelectMemories() error = %v, want the embedding failure to be ignored", err)
+	}
+	if keys, want := memoryKeys(got), []string{"city", "pet"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("SelectMemories() = %v, want the most recently updated %v", keys, want)
+	}
+	if len(embedder.texts) != 1 {
+		t.Errorf("CreateEmbeddings called %d times, want 1", len(embedder.texts))
+	}
+}
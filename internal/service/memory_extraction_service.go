@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// MemoryExtractionService 定义了从对话中自动提取用户记忆的接口。
+// 提取在后台任务中由 LLM 完成；根据 MEMORY_EXTRACTION_MODE，提取的记忆直接写入结构化记忆，
+// 或者保存为待确认的建议，由用户批准或拒绝。auto 模式下不会覆盖用户手动写入的记忆，这些键的新值也保存为建议。
+type MemoryExtractionService interface {
+	// RequestExtraction 在一轮交流后 (messageID 为 AI 回复) 将提取任务放入队列，返回任务 ID。
+	// 提取已关闭或未达到 MEMORY_EXTRACTION_INTERVAL 时不入队，返回空的任务 ID。
+	RequestExtraction(ctx context.Context, userID string, conversationID string, messageID string, modelName string) (taskID string, err error)
+
+	// ExtractMemories 调用 LLM 从对话的最近消息中提取记忆，与用户已有的记忆去重后写入或保存为建议 (由 Worker 调用)。
+	ExtractMemories(ctx context.Context, payload *entity.MemoryExtractionTaskPayload) (*entity.MemoryExtractionResult, error)
+
+	// ListSuggestions 列出用户的记忆建议，status 为空时返回所有状态的建议。
+	ListSuggestions(ctx context.Context, userID string, status entity.MemorySuggestionStatus) ([]*entity.MemorySuggestion, error)
+
+	// ApproveSuggestion 批准记忆建议：将其写入用户的结构化记忆 (键已存在时覆盖原值)，返回写入的记忆。
+	ApproveSuggestion(ctx context.Context, userID string, suggestionID string) (*entity.StructuredMemory, error)
+
+	// RejectSuggestion 拒绝记忆建议，相同的键值之后不会再次建议。
+	RejectSuggestion(ctx context.Context, userID string, suggestionID string) (*entity.MemorySuggestion, error)
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// extractionSourceMessageMaxRunes 是每条消息传给 LLM 的最大字符数，避免长消息 (例如粘贴的文档) 浪费 token。
+	extractionSourceMessageMaxRunes = 2000
+	// extractionKnownMemoryLimit 是提示词中列出的已有记忆的最大数量 (最近更新的优先)，用于让 LLM 沿用已有的键。
+	extractionKnownMemoryLimit = 100
+	// maxExtractedMemories 是一次提取最多处理的记忆数量，多余的忽略。
+	maxExtractedMemories = 10
+)
+
+// memoryExtractionSystemPrompt 是提取记忆时使用的系统提示词。
+const memoryExtractionSystemPrompt = `You extract durable facts about the user from a chat conversation so that they can be remembered in future conversations.
+Only extract facts the user stated or confirmed about themselves that will stay true for weeks or longer: preferences, names (their own, family, pets, colleagues), projects they work on, deadlines, tools and languages they use, where they live or work, and similar.
+Ignore one-off requests, questions, general knowledge, anything the assistant said that the user did not confirm, and secrets such as passwords, API keys or payment details.
+Use short snake_case keys, for example "preferred_language", "current_project" or "thesis_deadline". If a fact updates one of the known memories listed below, reuse its key.
+Do not repeat known memories whose value has not changed. Keep each value short and self-contained, written in the language the user writes in.
+Set "confidence" to how sure you are that the fact is correct and durable, from 0 to 1.
+Reply with a JSON object of the form {"memories": [{"key": "...", "value": "...", "confidence": 0.9}]}, or {"memories": []} if there is nothing worth remembering.`
+
+// Ensure memoryExtractionServiceImpl implements MemoryExtractionService interface.
+var _ MemoryExtractionService = (*memoryExtractionServiceImpl)(nil)
+
+// memoryExtractionServiceImpl 是 MemoryExtractionService 接口的实现。
+type memoryExtractionServiceImpl struct {
+	chatRepo       repository.ChatRepository
+	memoryRepo     repository.StructuredMemoryRepository
+	suggestionRepo repository.MemorySuggestionRepository
+	llmProvider    LLMProvider
+	taskQueue      TaskQueueClient
+	events         EventPublisher // 可以为 nil，此时不发布记忆变化事件
+	mode           string         // config.MemoryExtractionOff、MemoryExtractionSuggest 或 MemoryExtractionAuto
+	interval       int            // 每隔多少条用户消息提取一次
+}
+
+// NewMemoryExtractionService 创建一个新的 memoryExtractionServiceImpl 实例。
+// 与 ConversationTitleService 相同，只负责入队和处理建议的 API 服务可以传入 nil 的 llm，只负责提取的 Worker 可以传入 nil 的 taskQueue。
+func NewMemoryExtractionService(
+	chatRepo repository.ChatRepository,
+	memoryRepo repository.StructuredMemoryRepository,
+	suggestionRepo repository.MemorySuggestionRepository,
+	llm LLMProvider,
+	taskQueue TaskQueueClient,
+	events EventPublisher,
+	cfg *config.Config,
+) MemoryExtractionService {
+	return &memoryExtractionServiceImpl{
+		chatRepo:       chatRepo,
+		memoryRepo:     memoryRepo,
+		suggestionRepo: suggestionRepo,
+		llmProvider:    llm,
+		taskQueue:      taskQueue,
+		events:         events,
+		mode:           cfg.MemoryExtractionMode,
+		interval:       max(cfg.MemoryExtractionInterval, 1),
+	}
+}
+
+// RequestExtraction 在达到提取间隔时将提取记忆的任务放入队列。
+func (s *memoryExtractionServiceImpl) RequestExtraction(ctx context.Context, userID string, conversationID string, messageID string, modelName string) (string, error) {
+	if s.mode == config.MemoryExtractionOff {
+		return "", nil
+	}
+	if s.taskQueue == nil {
+		return "", apperr.New(apperr.CodeUnavailable, "任务队列不可用，无法提取记忆")
+	}
+	if s.interval > 1 {
+		turns, err := s.chatRepo.CountBranchMessages(ctx, userID, conversationID, messageID, entity.SenderRoleUser)
+		if err != nil {
+			return "", err
+		}
+		if turns == 0 || turns%s.interval != 0 {
+			return "", nil
+		}
+	}
+	payload := &entity.MemoryExtractionTaskPayload{
+		UserID:         userID,
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		ModelName:      modelName,
+	}
+	taskID, err := s.taskQueue.EnqueueMemoryExtractionTask(ctx, payload)
+	if err != nil {
+		return "", err // 内部已记录日志和包装错误
+	}
+	logger.InfoContext(ctx, "提取记忆任务已入队", "task_id", taskID, "conversation_id", conversationID, "message_id", messageID)
+	return taskID, nil
+}
+
+// ExtractMemories 调用 LLM 提取记忆并按配置的方式写入或保存为建议。
+func (s *memoryExtractionServiceImpl) ExtractMemories(ctx context.Context, payload *entity.MemoryExtractionTaskPayload) (*entity.MemoryExtractionResult, error) {
+	result := &entity.MemoryExtractionResult{Applied: []string{}, Suggested: []string{}}
+	if s.mode == config.MemoryExtractionOff {
+		logger.InfoContext(ctx, "记忆提取已关闭，跳过任务", "conversation_id", payload.ConversationID)
+		return result, nil
+	}
+	if s.llmProvider == nil {
+		return nil, apperr.New(apperr.CodeUnavailable, "LLM 服务不可用，无法提取记忆")
+	}
+
+	// 提取自上次提取以来的消息：每条用户消息和对应的回复
+	messages, err := s.chatRepo.GetMessageBranch(ctx, payload.UserID, payload.ConversationID, payload.MessageID, 2*s.interval)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, apperr.ErrNotFound("消息未找到") // 消息在任务执行前已被删除
+	}
+	known, err := s.memoryRepo.GetByUserID(ctx, payload.UserID)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取用户记忆失败", "error", err, "user_id", payload.UserID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取用户记忆")
+	}
+	known = unexpiredMemories(known, time.Now()) // 过期的记忆可以被重新提取
+
+	extracted, err := s.callExtractionLLM(ctx, payload, messages, known)
+	if err != nil {
+		return nil, err
+	}
+	candidates := dedupeExtractedMemories(extracted, known)
+	knownByKey := make(map[string]*entity.StructuredMemory, len(known))
+	for _, m := range known {
+		knownByKey[m.Key] = m
+	}
+	if len(candidates) == 0 {
+		logger.InfoContext(ctx, "对话中没有新的记忆", "conversation_id", payload.ConversationID, "extracted", len(extracted))
+		return result, nil
+	}
+
+	var changes []entity.MemoryChange
+	defer func() { publishMemoryChanges(ctx, s.events, payload.UserID, changes) }() // 中途失败时也发布已写入的记忆
+	for _, m := range candidates {
+		if s.mode == config.MemoryExtractionAuto && autoApplicable(knownByKey[m.Key], m.Value) {
+			memory := extractedStructuredMemory(payload.UserID, m.Key, m.Value, &payload.ConversationID, m.Confidence, knownByKey[m.Key], time.Now())
+			if err := upsertStructuredMemory(ctx, s.memoryRepo, memory); err != nil {
+				return nil, err
+			}
+			result.Applied = append(result.Applied, m.Key)
+			changes = append(changes, entity.NewMemoryChange(memory))
+			continue
+		}
+		suggestion := &entity.MemorySuggestion{
+			ID:             uuid.NewString(),
+			UserID:         payload.UserID,
+			Key:            m.Key,
+			Value:          m.Value,
+			Confidence:     m.Confidence,
+			ConversationID: &payload.ConversationID,
+			MessageID:      &payload.MessageID,
+			Status:         entity.MemorySuggestionPending,
+		}
+		created, err := s.suggestionRepo.CreateSuggestion(ctx, suggestion)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			result.Suggested = append(result.Suggested, m.Key)
+		}
+	}
+	logger.InfoContext(ctx, "记忆提取完成", "conversation_id", payload.ConversationID, "mode", s.mode,
+		"applied", len(result.Applied), "suggested", len(result.Suggested))
+	return result, nil
+}
+
+// callExtractionLLM 将对话记录和已有记忆发送给 LLM，解析其提出的记忆。
+func (s *memoryExtractionServiceImpl) callExtractionLLM(ctx context.Context, payload *entity.MemoryExtractionTaskPayload, messages []*entity.Message, known []*entity.StructuredMemory) ([]entity.ExtractedMemory, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		if msg.SenderRole == entity.SenderRoleSystem {
+			continue
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.SenderRole, truncateRunes(strings.TrimSpace(msg.Content), extractionSourceMessageMaxRunes))
+	}
+
+	prompt := memoryExtractionSystemPrompt
+	if len(known) > 0 {
+		recent := make([]*entity.StructuredMemory, len(known))
+		copy(recent, known)
+		sort.SliceStable(recent, func(i, j int) bool { return recent[i].UpdatedAt.After(recent[j].UpdatedAt) })
+		if len(recent) > extractionKnownMemoryLimit {
+			recent = recent[:extractionKnownMemoryLimit]
+		}
+		var b strings.Builder
+		b.WriteString(prompt)
+		b.WriteString("\n\nKnown memories:")
+		for _, m := range recent {
+			b.WriteString("\n- ")
+			b.WriteString(formatMemory(m))
+		}
+		prompt = b.String()
+	}
+
+	llmInput := []*entity.Message{
+		entity.NewMessage(payload.ConversationID, payload.UserID, entity.SenderRoleSystem, prompt),
+		entity.NewMessage(payload.ConversationID, payload.UserID, entity.SenderRoleUser, transcript.String()),
+	}
+	raw, err := s.llmProvider.GenerateContent(ctx, llmInput, payload.ModelName, s.extractionOptions(payload.ModelName))
+	if err != nil {
+		return nil, err // GenerateContent 内部已包装错误
+	}
+	extracted, err := parseExtractedMemories(raw)
+	if err != nil {
+		// 模型没有按要求回复，重试通常也得不到更好的结果
+		logger.WarnContext(ctx, "无法解析 LLM 提取的记忆", "error", err, "conversation_id", payload.ConversationID, "raw", truncateRunes(raw, 500))
+		return nil, nil
+	}
+	return extracted, nil
+}
+
+// extractionOptions 返回提取记忆时使用的生成参数：尽量使用 JSON 模式和 temperature 0，模型不支持时逐项去掉。
+func (s *memoryExtractionServiceImpl) extractionOptions(modelName string) *entity.GenerationOptions {
+	temperature := 0.0
+	opts := &entity.GenerationOptions{Temperature: &temperature, ResponseFormat: entity.ResponseFormatJSON}
+	if s.llmProvider.ValidateGenerationOptions(modelName, opts) == nil {
+		return opts
+	}
+	opts.Temperature = nil // 推理模型不支持 temperature
+	if s.llmProvider.ValidateGenerationOptions(modelName, opts) == nil {
+		return opts
+	}
+	return nil // 不支持 JSON 模式，只依靠提示词
+}
+
+// parseExtractedMemories 解析 LLM 回复的 {"memories": [...]}，允许回复被 Markdown 代码块包裹。
+func parseExtractedMemories(raw string) ([]entity.ExtractedMemory, error) {
+	raw = strings.TrimSpace(raw)
+	if start, end := strings.Index(raw, "{"), strings.LastIndex(raw, "}"); start >= 0 && end > start {
+		raw = raw[start : end+1]
+	}
+	var reply struct {
+		Memories []entity.ExtractedMemory `json:"memories"`
+	}
+	if err := json.Unmarshal([]byte(raw), &reply); err != nil {
+		return nil, err
+	}
+	return reply.Memories, nil
+}
+
+// dedupeExtractedMemories 清理 LLM 提取的记忆：去掉空的和超长的记忆、同一键的重复项 (保留最后一个)，
+// 以及与用户已有记忆的值相同的记忆。结果最多包含 maxExtractedMemories 条。
+func dedupeExtractedMemories(extracted []entity.ExtractedMemory, known []*entity.StructuredMemory) []entity.ExtractedMemory {
+	knownValues := make(map[string]string, len(known))
+	for _, m := range known {
+		knownValues[m.Key] = m.Value
+	}
+
+	byKey := make(map[string]int)
+	candidates := make([]entity.ExtractedMemory, 0, len(extracted))
+	for _, m := range extracted {
+		m.Key, m.Value = strings.TrimSpace(m.Key), strings.TrimSpace(m.Value)
+		if m.Key == "" || m.Value == "" ||
+			utf8.RuneCountInString(m.Key) > entity.MaxMemoryKeyLength || utf8.RuneCountInString(m.Value) > entity.MaxMemoryValueLength {
+			continue
+		}
+		if value, ok := knownValues[m.Key]; ok && strings.EqualFold(strings.TrimSpace(value), m.Value) {
+			continue
+		}
+		if c := m.Confidence; c != nil && (*c < 0 || *c > 1) {
+			m.Confidence = nil
+		}
+		if i, ok := byKey[m.Key]; ok {
+			candidates[i] = m
+			continue
+		}
+		if len(candidates) == maxExtractedMemories {
+			continue
+		}
+		byKey[m.Key] = len(candidates)
+		candidates = append(candidates, m)
+	}
+	return candidates
+}
+
+// ListSuggestions 列出用户的记忆建议。
+func (s *memoryExtractionServiceImpl) ListSuggestions(ctx context.Context, userID string, status entity.MemorySuggestionStatus) ([]*entity.MemorySuggestion, error) {
+	if status != "" && !status.Valid() {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "无效的记忆建议状态").
+			WithDetails(fmt.Sprintf("status=%s，可选值: %s, %s, %s", status, entity.MemorySuggestionPending, entity.MemorySuggestionApproved, entity.MemorySuggestionRejected))
+	}
+	return s.suggestionRepo.ListSuggestions(ctx, userID, status)
+}
+
+// ApproveSuggestion 将建议写入用户的结构化记忆并标记为已批准。
+func (s *memoryExtractionServiceImpl) ApproveSuggestion(ctx context.Context, userID string, suggestionID string) (*entity.StructuredMemory, error) {
+	suggestion, err := s.suggestionRepo.GetSuggestion(ctx, userID, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+	if suggestion.Status != entity.MemorySuggestionPending {
+		return nil, apperr.New(apperr.CodeConflict, "记忆建议已经处理过").WithDetails("status=" + string(suggestion.Status))
+	}
+	existing, err := s.memoryRepo.GetByKey(ctx, userID, suggestion.Key)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logger.ErrorContext(ctx, "获取结构化记忆失败", "error", err, "user_id", userID, "key", suggestion.Key)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取记忆")
+	}
+	memory := extractedStructuredMemory(userID, suggestion.Key, suggestion.Value, suggestion.ConversationID, suggestion.Confidence, existing, time.Now())
+	// 写入记忆和更新建议状态在同一个事务中完成，避免并发批准重复写入或写入后建议仍为 pending
+	if _, err := s.suggestionRepo.ApproveSuggestion(ctx, userID, suggestionID, memory); err != nil {
+		return nil, err
+	}
+	publishMemoryChanges(ctx, s.events, userID, []entity.MemoryChange{entity.NewMemoryChange(memory)})
+	return memory, nil
+}
+
+// RejectSuggestion 将建议标记为已拒绝。
+func (s *memoryExtractionServiceImpl) RejectSuggestion(ctx context.Context, userID string, suggestionID string) (*entity.MemorySuggestion, error) {
+	return s.suggestionRepo.ResolveSuggestion(ctx, userID, suggestionID, entity.MemorySuggestionRejected)
+}
+
+// autoApplicable 判断 auto 模式下提取的值能否直接写入：用户手动写入的记忆不会被自动覆盖，
+// 值不符合已有记忆的值类型时也不写入，这两种情况改为保存为建议，由用户确认。
+func autoApplicable(existing *entity.StructuredMemory, value string) bool {
+	if existing == nil {
+		return true
+	}
+	return existing.Source != entity.MemorySourceManual && validateMemoryValue(existing.ValueType, value) == nil
+}
+
+// extractedStructuredMemory 构造由 LLM 从对话中提取的记忆。existing 为同名的已有记忆 (可以为 nil)，
+// 新记忆沿用它的命名空间、值类型 (值不符合该类型时使用字符串) 和未过期的过期时间。
+func extractedStructuredMemory(userID string, key string, value string, conversationID *string, confidence *float64, existing *entity.StructuredMemory, now time.Time) *entity.StructuredMemory {
+	memory := &entity.StructuredMemory{
+		UserID:               userID,
+		Key:                  key,
+		Value:                value,
+		ValueType:            entity.MemoryValueString,
+		Source:               entity.MemorySourceExtracted,
+		SourceConversationID: conversationID,
+		Confidence:           confidence,
+	}
+	if existing != nil {
+		memory.Namespace = existing.Namespace
+		if validateMemoryValue(existing.ValueType, value) == nil {
+			memory.ValueType = existing.ValueType
+		}
+		if existing.ExpiresAt != nil && existing.ExpiresAt.After(now) {
+			memory.ExpiresAt = existing.ExpiresAt
+		}
+	}
+	return memory
+}
@@ -0,0 +1,19 @@
+package service
+
+// MessageImporter 定义了将按消息组织的文件 (邮件归档、聊天导出等) 拆分为片段的接口。
+// Embedding Worker 对匹配的文件按片段分块，并把片段的元数据 (发送者、时间、会话) 写入每个块。
+type MessageImporter interface {
+	// Format 返回导入器处理的格式名称，写入块元数据的 source_format。
+	Format() string
+	// Match 根据文件名和文件开头的内容判断是否由该导入器处理。
+	Match(filename string, head []byte) bool
+	// Parse 解析完整的文件内容，每条消息 (或一组连续消息) 返回一个片段。
+	// filename 用于从导出文件名中提取会话名称等信息。
+	Parse(filename string, data []byte) ([]ContentSegment, error)
+}
+
+// ContentSegment 是导入器解析出的一段内容及其元数据。
+type ContentSegment struct {
+	Content  string         // 用于 Embedding 的文本 (包含发送者和时间，便于回答时引用)
+	Metadata map[string]any // 见 entity.ChunkMeta* 常量
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// MessageIndexer 定义了在消息保存后更新搜索索引的接口。
+// 全文检索索引由数据库自动维护，这里只处理需要额外计算的语义搜索向量。
+type MessageIndexer interface {
+	// IndexMessage 在启用语义搜索时将为消息生成向量的任务放入队列，未启用时直接返回。
+	IndexMessage(ctx context.Context, message *entity.Message) error
+}
+
+// MessageSearchService 定义了搜索对话消息的业务逻辑接口。
+type MessageSearchService interface {
+	MessageIndexer
+
+	// Search 校验搜索条件并在指定用户的对话消息中搜索。
+	// 全文检索始终可用；语义检索需要启用 MESSAGE_SEMANTIC_SEARCH_ENABLED，且只包含启用之后生成了向量的消息。
+	Search(ctx context.Context, userID string, query *entity.MessageSearchQuery) ([]*entity.MessageSearchResult, error)
+
+	// EmbedMessage 为消息生成向量并保存 (由 Worker 调用)。
+	EmbedMessage(ctx context.Context, payload *entity.MessageEmbeddingTaskPayload) error
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// defaultMessageSearchLimit 是未指定数量时返回的搜索结果数量。
+	defaultMessageSearchLimit = 20
+	// maxEmbeddedMessageRunes 是生成消息向量时使用的最大字符数，超出部分被截断以避免超过 Embedding 模型的输入上限。
+	maxEmbeddedMessageRunes = 8000
+)
+
+// Ensure messageSearchServiceImpl implements MessageSearchService interface.
+var _ MessageSearchService = (*messageSearchServiceImpl)(nil)
+
+// messageSearchServiceImpl 是 MessageSearchService 接口的实现。
+type messageSearchServiceImpl struct {
+	searchRepo      repository.MessageSearchRepository
+	chatRepo        repository.ChatRepository
+	embedder        EmbeddingProvider
+	taskQueue       TaskQueueClient
+	semanticEnabled bool
+}
+
+// NewMessageSearchService 创建一个新的 messageSearchServiceImpl 实例。
+// 只负责生成向量的 Worker 可以传入 nil 的 taskQueue。
+func NewMessageSearchService(
+	searchRepo repository.MessageSearchRepository,
+	chatRepo repository.ChatRepository,
+	embedder EmbeddingProvider,
+	taskQueue TaskQueueClient,
+	cfg *config.Config,
+) MessageSearchService {
+	return &messageSearchServiceImpl{
+		searchRepo:      searchRepo,
+		chatRepo:        chatRepo,
+		embedder:        embedder,
+		taskQueue:       taskQueue,
+		semanticEnabled: cfg.MessageSemanticSearchEnabled,
+	}
+}
+
+// Search 校验搜索条件并搜索消息。
+func (s *messageSearchServiceImpl) Search(ctx context.Context, userID string, query *entity.MessageSearchQuery) ([]*entity.MessageSearchResult, error) {
+	if err := s.normalizeQuery(query); err != nil {
+		return nil, err
+	}
+
+	if query.Mode == entity.MessageSearchModeFullText {
+		return s.searchRepo.SearchFullText(ctx, userID, query)
+	}
+
+	embeddings, err := s.embedder.CreateEmbeddings(ctx, []string{query.Query})
+	if err != nil {
+		return nil, err // CreateEmbeddings 内部已包装错误
+	}
+	if len(embeddings) != 1 {
+		return nil, apperr.New(apperr.CodeInternal, "生成查询向量失败")
+	}
+	return s.searchRepo.SearchSemantic(ctx, userID, pgvector.NewVector(embeddings[0]), query)
+}
+
+// normalizeQuery 校验搜索条件，并填充默认的搜索方式和数量。
+func (s *messageSearchServiceImpl) normalizeQuery(query *entity.MessageSearchQuery) error {
+	query.Query = strings.TrimSpace(query.Query)
+	if query.Query == "" {
+		return apperr.New(apperr.CodeInvalidArgument, "搜索词不能为空")
+	}
+
+	switch query.Mode {
+	case "":
+		query.Mode = entity.MessageSearchModeFullText
+	case entity.MessageSearchModeFullText:
+	case entity.MessageSearchModeSemantic:
+		if !s.semanticEnabled {
+			return apperr.New(apperr.CodeUnimplemented, "语义搜索未启用")
+		}
+	default:
+		return apperr.New(apperr.CodeInvalidArgument, "mode 只能为 fulltext 或 semantic").WithDetails("mode=" + query.Mode)
+	}
+
+	switch query.Role {
+	case "", entity.SenderRoleUser, entity.SenderRoleAI:
+	default:
+		return apperr.New(apperr.CodeInvalidArgument, "role 只能为 user 或 ai").WithDetails("role=" + string(query.Role))
+	}
+	if query.ConversationID != "" {
+		if err := validateConversationID(query.ConversationID); err != nil {
+			return err
+		}
+	}
+	if query.After != nil && query.Before != nil && !query.After.Before(*query.Before) {
+		return apperr.New(apperr.CodeValidation, "from 必须早于 to")
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = defaultMessageSearchLimit
+	}
+	query.Limit = min(query.Limit, entity.MaxMessageSearchLimit)
+	query.Offset = max(query.Offset, 0)
+	return nil
+}
+
+// IndexMessage 在启用语义搜索时将为消息生成向量的任务放入队列。
+func (s *messageSearchServiceImpl) IndexMessage(ctx context.Context, message *entity.Message) error {
+	if !s.semanticEnabled || strings.TrimSpace(message.Content) == "" {
+		return nil
+	}
+	if s.taskQueue == nil {
+		return apperr.New(apperr.CodeUnavailable, "任务队列不可用，无法为消息生成搜索向量")
+	}
+	_, err := s.taskQueue.EnqueueMessageEmbeddingTask(ctx, &entity.MessageEmbeddingTaskPayload{
+		UserID:         message.UserID,
+		ConversationID: message.ConversationID,
+		MessageID:      message.ID,
+	})
+	return err // 内部已记录日志和包装错误
+}
+
+// EmbedMessage 为消息生成向量并保存。
+func (s *messageSearchServiceImpl) EmbedMessage(ctx context.Context, payload *entity.MessageEmbeddingTaskPayload) error {
+	message, err := s.chatRepo.GetMessage(ctx, payload.UserID, payload.ConversationID, payload.MessageID)
+	if err != nil {
+		return err
+	}
+
+	embeddings, err := s.embedder.CreateEmbeddings(ctx, []string{truncateRunes(message.Content, maxEmbeddedMessageRunes)})
+	if err != nil {
+		return err // CreateEmbeddings 内部已包装错误
+	}
+	if len(embeddings) != 1 {
+		return apperr.New(apperr.CodeInternal, "生成消息向量失败")
+	}
+	if err := s.searchRepo.SaveMessageEmbedding(ctx, message, pgvector.NewVector(embeddings[0])); err != nil {
+		return err
+	}
+	logger.DebugContext(ctx, "消息向量已保存", "message_id", message.ID, "conversation_id", message.ConversationID)
+	return nil
+}
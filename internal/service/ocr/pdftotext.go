@@ -0,0 +1,53 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/soaringjerry/dreamhub/internal/service" // 引入 service 包以引用接口
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure pdfToTextExtractor implements PDFTextExtractor interface.
+var _ service.PDFTextExtractor = (*pdfToTextExtractor)(nil)
+
+// pdfToTextExtractor 是 PDFTextExtractor 接口基于 poppler pdftotext 命令的实现。
+type pdfToTextExtractor struct {
+	path string
+}
+
+// NewPDFToTextExtractor 创建一个新的 PDF 文本提取器，找不到 pdftotext 可执行文件时返回错误。
+func NewPDFToTextExtractor(cfg *config.Config) (service.PDFTextExtractor, error) {
+	path, err := exec.LookPath(cfg.PDFToTextPath)
+	if err != nil {
+		return nil, fmt.Errorf("找不到 pdftotext 可执行文件 (%s): %w", cfg.PDFToTextPath, err)
+	}
+	logger.Info("PDF 文本提取器初始化完成。", "pdftotext", path)
+	return &pdfToTextExtractor{path: path}, nil
+}
+
+// ExtractText 实现 PDFTextExtractor 接口。
+func (e *pdfToTextExtractor) ExtractText(ctx context.Context, data []byte) (string, error) {
+	dir, err := os.MkdirTemp("", "dreamhub-pdf-*")
+	if err != nil {
+		return "", apperr.Wrap(err, apperr.CodeInternal, "无法创建 PDF 临时目录")
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return "", apperr.Wrap(err, apperr.CodeInternal, "无法写入 PDF 临时文件")
+	}
+	out, err := runCommand(ctx, e.path, "-enc", "UTF-8", input, "-")
+	if err != nil {
+		return "", err
+	}
+	// pdftotext 用换页符分隔页面
+	return strings.ReplaceAll(string(out), "\f", "\n\n"), nil
+}
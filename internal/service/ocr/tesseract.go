@@ -0,0 +1,254 @@
+// Package ocr 提供基于 Tesseract 和 poppler-utils 命令行工具的 OCR 与 PDF 文本提取实现。
+package ocr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/soaringjerry/dreamhub/internal/service" // 引入 service 包以引用接口
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	renderDPI      = 300 // 将 PDF 渲染为图片时的分辨率，Tesseract 在 300 DPI 左右效果最好
+	maxStderrBytes = 512 // 错误信息中保留的 stderr 长度
+)
+
+// imageExtensions 是支持的图片类型对应的文件扩展名 (Tesseract 依据扩展名和文件头识别格式)。
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/tiff": ".tif",
+	"image/bmp":  ".bmp",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+// Ensure tesseractOCR implements OCRProvider interface.
+var _ service.OCRProvider = (*tesseractOCR)(nil)
+
+// tesseractOCR 是 OCRProvider 接口基于 Tesseract 命令行的实现。
+type tesseractOCR struct {
+	tesseractPath string
+	pdfToPPMPath  string
+	languages     string
+	maxPages      int
+}
+
+// NewTesseractOCR 创建一个新的 Tesseract OCR 实例。
+// 找不到 tesseract 可执行文件时返回错误；找不到 pdftoppm 时只记录警告，此时只能识别图片。
+func NewTesseractOCR(cfg *config.Config) (service.OCRProvider, error) {
+	tesseractPath, err := exec.LookPath(cfg.TesseractPath)
+	if err != nil {
+		return nil, fmt.Errorf("找不到 tesseract 可执行文件 (%s): %w", cfg.TesseractPath, err)
+	}
+	pdfToPPMPath, err := exec.LookPath(cfg.PDFToPPMPath)
+	if err != nil {
+		logger.Warn("找不到 pdftoppm，扫描版 PDF 将无法进行 OCR", "path", cfg.PDFToPPMPath, "error", err)
+		pdfToPPMPath = ""
+	}
+	logger.Info("Tesseract OCR 初始化完成。", "tesseract", tesseractPath, "languages", cfg.OCRLanguages, "max_pages", cfg.OCRMaxPages)
+	return &tesseractOCR{
+		tesseractPath: tesseractPath,
+		pdfToPPMPath:  pdfToPPMPath,
+		languages:     cfg.OCRLanguages,
+		maxPages:      cfg.OCRMaxPages,
+	}, nil
+}
+
+// Recognize 实现 OCRProvider 接口。PDF 先用 pdftoppm 逐页渲染为图片，再逐页识别。
+func (t *tesseractOCR) Recognize(ctx context.Context, data []byte, contentType string) ([]service.OCRPage, error) {
+	dir, err := os.MkdirTemp("", "dreamhub-ocr-*")
+	if err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法创建 OCR 临时目录")
+	}
+	defer os.RemoveAll(dir)
+
+	if contentType == "application/pdf" {
+		images, err := t.renderPDF(ctx, dir, data)
+		if err != nil {
+			return nil, err
+		}
+		pages := make([]service.OCRPage, 0, len(images))
+		for i, image := range images {
+			recognized, err := t.recognizeImage(ctx, image)
+			if err != nil {
+				return nil, err
+			}
+			// 每张图片只有一页，页码以 PDF 中的页序为准
+			for _, page := range recognized {
+				page.Number = i + 1
+				pages = append(pages, page)
+			}
+		}
+		return pages, nil
+	}
+
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, apperr.New(apperr.CodeValidation, "不支持对该文件类型进行 OCR").WithDetails("content_type=" + contentType)
+	}
+	input := filepath.Join(dir, "input"+ext)
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法写入 OCR 临时文件")
+	}
+	// 多页 TIFF 由 Tesseract 直接处理，页码来自 TSV 输出
+	return t.recognizeImage(ctx, input)
+}
+
+// renderPDF 将 PDF 的前 maxPages 页渲染为灰度 PNG，返回按页序排列的图片路径。
+func (t *tesseractOCR) renderPDF(ctx context.Context, dir string, data []byte) ([]string, error) {
+	if t.pdfToPPMPath == "" {
+		return nil, apperr.New(apperr.CodeInternal, "未安装 pdftoppm，无法对 PDF 进行 OCR")
+	}
+	input := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法写入 OCR 临时文件")
+	}
+	prefix := filepath.Join(dir, "page")
+	if _, err := runCommand(ctx, t.pdfToPPMPath,
+		"-r", strconv.Itoa(renderDPI), "-gray", "-png",
+		"-f", "1", "-l", strconv.Itoa(t.maxPages),
+		input, prefix,
+	); err != nil {
+		return nil, err
+	}
+
+	// pdftoppm 输出 page-1.png 或 page-01.png (按总页数补零)，同一次输出的宽度一致，按字典序即页序
+	images, err := filepath.Glob(prefix + "-*.png")
+	if err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法列出渲染出的 PDF 页面")
+	}
+	sort.Strings(images)
+	if len(images) == 0 {
+		return nil, apperr.New(apperr.CodeValidation, "PDF 中没有可识别的页面")
+	}
+	return images, nil
+}
+
+// recognizeImage 对单个图片文件运行 Tesseract 并解析 TSV 输出。
+func (t *tesseractOCR) recognizeImage(ctx context.Context, image string) ([]service.OCRPage, error) {
+	out, err := runCommand(ctx, t.tesseractPath, image, "stdout", "-l", t.languages, "tsv")
+	if err != nil {
+		return nil, err
+	}
+	return parseTSV(out), nil
+}
+
+// tsvColumns 是 Tesseract TSV 输出的列：
+// level page_num block_num par_num line_num word_num left top width height conf text
+const (
+	colLevel = 0
+	colPage  = 1
+	colBlock = 2
+	colPar   = 3
+	colLine  = 4
+	colConf  = 10
+	colText  = 11
+	numCols  = 12
+	// wordLevel 是 TSV 中表示单词的 level 值
+	wordLevel = "5"
+)
+
+// parseTSV 将 Tesseract 的 TSV 输出还原为按页的文本：同一行的单词以空格连接，段落之间空一行。
+// 页的置信度是该页所有单词置信度的平均值。
+func parseTSV(out []byte) []service.OCRPage {
+	type pageState struct {
+		text             strings.Builder
+		confSum          float64
+		words            int
+		lastBlock, lastP string
+		lastLine         string
+	}
+	pages := make(map[int]*pageState)
+	order := make([]int, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < numCols || cols[colLevel] != wordLevel {
+			continue // 表头、页/块/行等非单词记录
+		}
+		word := strings.TrimSpace(cols[colText])
+		conf, err := strconv.ParseFloat(cols[colConf], 64)
+		if word == "" || err != nil || conf < 0 {
+			continue
+		}
+		pageNum, err := strconv.Atoi(cols[colPage])
+		if err != nil {
+			continue
+		}
+		page, ok := pages[pageNum]
+		if !ok {
+			page = &pageState{}
+			pages[pageNum] = page
+			order = append(order, pageNum)
+		}
+
+		switch {
+		case page.text.Len() == 0:
+		case cols[colBlock] != page.lastBlock || cols[colPar] != page.lastP:
+			page.text.WriteString("\n\n")
+		case cols[colLine] != page.lastLine:
+			page.text.WriteString("\n")
+		default:
+			page.text.WriteString(" ")
+		}
+		page.text.WriteString(word)
+		page.lastBlock, page.lastP, page.lastLine = cols[colBlock], cols[colPar], cols[colLine]
+		page.confSum += conf
+		page.words++
+	}
+
+	sort.Ints(order)
+	result := make([]service.OCRPage, 0, len(order))
+	for _, num := range order {
+		page := pages[num]
+		result = append(result, service.OCRPage{
+			Number:     num,
+			Text:       page.text.String(),
+			Confidence: math.Round(page.confSum/float64(page.words)*10) / 1000, // Tesseract 的置信度为 0-100
+		})
+	}
+	return result
+}
+
+// runCommand 执行外部命令并返回标准输出。
+// 超时或被取消时返回 CodeUnavailable (可重试)，命令执行失败 (通常是文件损坏或格式不支持) 时返回 CodeValidation。
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return stdout.Bytes(), nil
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, apperr.Wrap(ctxErr, apperr.CodeUnavailable, "文档处理命令超时或被取消")
+	}
+	msg := strings.TrimSpace(stderr.String())
+	if len(msg) > maxStderrBytes {
+		msg = msg[:maxStderrBytes]
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		logger.WarnContext(ctx, "文档处理命令执行失败", "command", filepath.Base(name), "exit_code", exitErr.ExitCode(), "stderr", msg)
+		return nil, apperr.Wrap(err, apperr.CodeValidation, "无法识别文件内容").WithDetails(msg)
+	}
+	return nil, apperr.Wrap(err, apperr.CodeInternal, "无法执行文档处理命令").WithDetails(filepath.Base(name))
+}
@@ -0,0 +1,23 @@
+package service
+
+import "context"
+
+// OCRProvider 定义了从扫描版 PDF 和图片中识别文字的接口。
+type OCRProvider interface {
+	// Recognize 识别文件中的文字，按页返回结果。contentType 为嗅探出的 MIME 类型 (application/pdf 或 image/*)。
+	// 文件无法识别 (格式不支持、文件损坏) 时返回 CodeValidation 错误，超时等临时错误返回 CodeUnavailable。
+	Recognize(ctx context.Context, data []byte, contentType string) ([]OCRPage, error)
+}
+
+// OCRPage 是 OCR 识别出的一页内容。
+type OCRPage struct {
+	Number     int     // 页码，从 1 开始
+	Text       string  // 识别出的文字
+	Confidence float64 // 该页单词识别置信度的平均值 (0-1)
+}
+
+// PDFTextExtractor 定义了提取 PDF 文本层的接口。扫描版 PDF 没有文本层，提取结果为空。
+type PDFTextExtractor interface {
+	// ExtractText 返回 PDF 中的文本。
+	ExtractText(ctx context.Context, data []byte) (string, error)
+}
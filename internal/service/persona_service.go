@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// PersonaResolver 定义了聊天服务查找对话所用人设的接口。
+type PersonaResolver interface {
+	// ResolvePersona 返回对话使用的人设：对话选择的人设，或者对话没有选择时用户的默认人设。
+	// 都没有时返回 nil, nil (不发送系统提示词，使用默认生成设置)。
+	ResolvePersona(ctx context.Context, userID string, conversationID string) (*entity.Persona, error)
+
+	// GetPersona 获取指定用户的人设，不存在或不属于该用户时返回 CodeNotFound 错误。
+	GetPersona(ctx context.Context, userID string, personaID string) (*entity.Persona, error)
+}
+
+// PersonaService 定义了管理用户人设的业务逻辑接口。
+type PersonaService interface {
+	PersonaResolver
+
+	// ListPersonas 列出用户的所有人设，按名称排序。
+	ListPersonas(ctx context.Context, userID string) ([]*entity.Persona, error)
+
+	// CreatePersona 校验输入并创建人设。同一用户下名称重复时返回 CodeConflict 错误。
+	CreatePersona(ctx context.Context, userID string, input *entity.PersonaInput) (*entity.Persona, error)
+
+	// UpdatePersona 以 input 整体替换人设的名称、系统提示词和生成设置，返回更新后的人设。
+	UpdatePersona(ctx context.Context, userID string, personaID string, input *entity.PersonaInput) (*entity.Persona, error)
+
+	// DeletePersona 删除人设。使用该人设的对话之后使用用户的默认人设。
+	DeletePersona(ctx context.Context, userID string, personaID string) error
+
+	// SetDefaultPersona 将指定人设设为用户的默认人设 (没有选择人设的对话使用默认人设)。
+	// personaID 为空时取消默认人设。
+	SetDefaultPersona(ctx context.Context, userID string, personaID string) error
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+// Ensure personaServiceImpl implements PersonaService interface.
+var _ PersonaService = (*personaServiceImpl)(nil)
+
+// personaServiceImpl 是 PersonaService 接口的实现。
+type personaServiceImpl struct {
+	personaRepo repository.PersonaRepository
+}
+
+// NewPersonaService 创建一个新的 personaServiceImpl 实例。
+func NewPersonaService(personaRepo repository.PersonaRepository) PersonaService {
+	return &personaServiceImpl{personaRepo: personaRepo}
+}
+
+// ResolvePersona 返回对话使用的人设。
+func (s *personaServiceImpl) ResolvePersona(ctx context.Context, userID string, conversationID string) (*entity.Persona, error) {
+	if err := validateConversationID(conversationID); err != nil {
+		return nil, err
+	}
+	return s.personaRepo.GetConversationPersona(ctx, userID, conversationID)
+}
+
+// GetPersona 获取指定用户的人设。
+func (s *personaServiceImpl) GetPersona(ctx context.Context, userID string, personaID string) (*entity.Persona, error) {
+	return s.personaRepo.GetPersona(ctx, userID, personaID)
+}
+
+// ListPersonas 列出用户的所有人设。
+func (s *personaServiceImpl) ListPersonas(ctx context.Context, userID string) ([]*entity.Persona, error) {
+	return s.personaRepo.ListPersonas(ctx, userID)
+}
+
+// CreatePersona 校验输入并创建人设。
+func (s *personaServiceImpl) CreatePersona(ctx context.Context, userID string, input *entity.PersonaInput) (*entity.Persona, error) {
+	persona, err := newPersonaFromInput(input)
+	if err != nil {
+		return nil, err
+	}
+	persona.ID = uuid.NewString()
+	persona.UserID = userID
+	if err := s.personaRepo.CreatePersona(ctx, persona); err != nil {
+		return nil, err
+	}
+	return persona, nil
+}
+
+// UpdatePersona 校验输入并整体替换人设的设置。
+func (s *personaServiceImpl) UpdatePersona(ctx context.Context, userID string, personaID string, input *entity.PersonaInput) (*entity.Persona, error) {
+	persona, err := newPersonaFromInput(input)
+	if err != nil {
+		return nil, err
+	}
+	persona.ID = personaID
+	persona.UserID = userID
+	return s.personaRepo.UpdatePersona(ctx, persona)
+}
+
+// DeletePersona 删除人设。
+func (s *personaServiceImpl) DeletePersona(ctx context.Context, userID string, personaID string) error {
+	return s.personaRepo.DeletePersona(ctx, userID, personaID)
+}
+
+// SetDefaultPersona 设置或取消用户的默认人设。
+func (s *personaServiceImpl) SetDefaultPersona(ctx context.Context, userID string, personaID string) error {
+	return s.personaRepo.SetDefaultPersona(ctx, userID, strings.TrimSpace(personaID))
+}
+
+// newPersonaFromInput 校验人设输入并转换为 Persona (不含 ID 和 UserID)。
+func newPersonaFromInput(input *entity.PersonaInput) (*entity.Persona, error) {
+	if input == nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "缺少人设内容")
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, apperr.New(apperr.CodeValidation, "人设名称不能为空")
+	}
+	if utf8.RuneCountInString(name) > entity.MaxPersonaNameLength {
+		return nil, apperr.New(apperr.CodeValidation, fmt.Sprintf("人设名称不能超过 %d 个字符", entity.MaxPersonaNameLength))
+	}
+	systemPrompt := strings.TrimSpace(input.SystemPrompt)
+	if utf8.RuneCountInString(systemPrompt) > entity.MaxPersonaSystemPromptLength {
+		return nil, apperr.New(apperr.CodeValidation, fmt.Sprintf("系统提示词不能超过 %d 个字符", entity.MaxPersonaSystemPromptLength))
+	}
+	modelName := strings.TrimSpace(input.ModelName)
+	if utf8.RuneCountInString(modelName) > entity.MaxPersonaModelNameLength {
+		return nil, apperr.New(apperr.CodeValidation, fmt.Sprintf("模型名称不能超过 %d 个字符", entity.MaxPersonaModelNameLength))
+	}
+	if err := validateGenerationOptions(&entity.GenerationOptions{Temperature: input.Temperature}); err != nil {
+		return nil, err
+	}
+	ragEnabled := true
+	if input.RAGEnabled != nil {
+		ragEnabled = *input.RAGEnabled
+	}
+	return &entity.Persona{
+		Name:         name,
+		SystemPrompt: systemPrompt,
+		ModelName:    modelName,
+		Temperature:  input.Temperature,
+		RAGEnabled:   ragEnabled,
+	}, nil
+}
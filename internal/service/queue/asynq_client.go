@@ -3,23 +3,49 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
 	"github.com/soaringjerry/dreamhub/internal/service" // 引入 service 包以引用接口
 	"github.com/soaringjerry/dreamhub/pkg/apperr"
 	"github.com/soaringjerry/dreamhub/pkg/config"
 	"github.com/soaringjerry/dreamhub/pkg/logger"
 )
 
-// 定义任务类型常量，应与 Worker 端保持一致
-// TODO: 将这些常量移到共享位置 (e.g., internal/tasks)
 const (
-	TypeEmbedding = "embedding:generate"
+	// fetchURLMaxRetry 限制抓取任务的重试次数，目标站点长期不可用时不应无限重试。
+	fetchURLMaxRetry = 5
+	fetchURLTimeout  = 2 * time.Minute
+	// conversationTitleMaxRetry 和 conversationTitleTimeout 限制生成对话标题的任务，标题不是必需的，失败后不必反复重试。
+	conversationTitleMaxRetry = 3
+	conversationTitleTimeout  = time.Minute
+	// messageEmbeddingMaxRetry 和 messageEmbeddingTimeout 限制为消息生成搜索向量的任务。
+	messageEmbeddingMaxRetry = 3
+	messageEmbeddingTimeout  = time.Minute
+	// conversationImport* 限制导入对话的任务。大型归档可能包含上万条消息，因此使用较长的超时；
+	// 完成的任务保留一段时间，以便用户查询导入结果。
+	conversationImportMaxRetry  = 3
+	conversationImportTimeout   = 30 * time.Minute
+	conversationImportRetention = 24 * time.Hour
+	// memoryExtractionMaxRetry 和 memoryExtractionTimeout 限制提取用户记忆的任务，记忆提取不是必需的，失败后不必反复重试。
+	memoryExtractionMaxRetry = 2
+	memoryExtractionTimeout  = 2 * time.Minute
+	// eventDeliveryTimeout 限制 webhook 投递任务，单次请求的超时由 EVENT_WEBHOOK_TIMEOUT_SECONDS 控制。
+	eventDeliveryTimeout = time.Minute
 )
 
 // asynqClient 是 TaskQueueClient 接口的 Asynq 实现。
 type asynqClient struct {
-	client *asynq.Client
+	client        *asynq.Client
+	inspector     *asynq.Inspector
+	queueDepth    *queueDepthMonitor
+	maxQueueDepth int // 0 表示不限制
+	ocrMaxRetry   int
+	ocrTimeout    time.Duration
+	// eventDeliveryMaxRetry 是 webhook 投递任务的最大重试次数，Worker 据此判断是否为最后一次尝试。
+	eventDeliveryMaxRetry int
 }
 
 // NewAsynqClient 创建一个新的 Asynq 客户端实例。
@@ -32,33 +58,122 @@ func NewAsynqClient(cfg *config.Config) service.TaskQueueClient {
 	client := asynq.NewClient(redisOpt)
 	// 注意：这里没有显式的 Connect 方法，连接是在第一次操作时建立的。
 	// 可以考虑添加一个 Ping 或 Info 调用来验证连接，但这通常不是必需的。
-	logger.Info("Asynq 客户端初始化完成。", "redis_addr", cfg.RedisAddr)
-	return &asynqClient{client: client}
+	inspector := asynq.NewInspector(redisOpt) // 用于读取队列深度
+	logger.Info("Asynq 客户端初始化完成。", "redis_addr", cfg.RedisAddr, "max_queue_depth", cfg.QueueMaxDepth)
+	return &asynqClient{
+		client:        client,
+		inspector:     inspector,
+		queueDepth:    newQueueDepthMonitor(inspector),
+		maxQueueDepth: cfg.QueueMaxDepth,
+		ocrMaxRetry:   cfg.OCRMaxRetry,
+		ocrTimeout:    cfg.OCRTimeout,
+
+		eventDeliveryMaxRetry: cfg.EventWebhookMaxRetry,
+	}
 }
 
 // EnqueueEmbeddingTask 将生成 Embedding 的任务放入 Asynq 队列。
-func (c *asynqClient) EnqueueEmbeddingTask(ctx context.Context, payload map[string]interface{}) (taskID string, err error) {
+// 目标队列积压过多时返回 CodeRateLimited 错误，调用方应稍后重试。
+func (c *asynqClient) EnqueueEmbeddingTask(ctx context.Context, payload *entity.EmbeddingTaskPayload) (taskID string, err error) {
+	queue := payload.Priority.QueueName()
+	if err := c.checkBackpressure(ctx, queue); err != nil {
+		return "", err
+	}
+	return c.enqueue(ctx, entity.TaskTypeEmbedding, payload, asynq.Queue(queue))
+}
+
+// EnqueueFetchURLTask 将抓取 URL 文档的任务放入 Asynq 队列。
+// 与 EnqueueEmbeddingTask 相同，目标队列积压过多时返回 CodeRateLimited 错误。
+func (c *asynqClient) EnqueueFetchURLTask(ctx context.Context, payload *entity.FetchURLTaskPayload) (taskID string, err error) {
+	queue := payload.Priority.QueueName()
+	if err := c.checkBackpressure(ctx, queue); err != nil {
+		return "", err
+	}
+	return c.enqueue(ctx, entity.TaskTypeFetchURL, payload, asynq.Queue(queue), asynq.MaxRetry(fetchURLMaxRetry), asynq.Timeout(fetchURLTimeout))
+}
+
+// EnqueueOCRTask 将 OCR 任务放入 Asynq 队列。
+// OCR 耗时远高于普通的 Embedding 任务，且失败多为文件本身的问题，因此使用更长的超时和更少的重试次数。
+// OCR 任务由已经在处理中的 Embedding 任务派生，不受队列深度限制。
+func (c *asynqClient) EnqueueOCRTask(ctx context.Context, payload *entity.EmbeddingTaskPayload) (taskID string, err error) {
+	return c.enqueue(ctx, entity.TaskTypeOCR, payload, asynq.Queue(payload.Priority.QueueName()), asynq.MaxRetry(c.ocrMaxRetry), asynq.Timeout(c.ocrTimeout))
+}
+
+// EnqueueConversationTitleTask 将生成对话标题的任务放入 interactive 队列 (标题会显示在用户的对话列表中)。
+// 标题生成由聊天请求附带触发，不做队列深度检查，避免因队列繁忙导致聊天请求失败。
+func (c *asynqClient) EnqueueConversationTitleTask(ctx context.Context, payload *entity.ConversationTitleTaskPayload) (taskID string, err error) {
+	return c.enqueue(ctx, entity.TaskTypeConversationTitle, payload, asynq.Queue(entity.TaskPriorityInteractive.QueueName()),
+		asynq.MaxRetry(conversationTitleMaxRetry), asynq.Timeout(conversationTitleTimeout))
+}
+
+// EnqueueMessageEmbeddingTask 将为消息生成搜索向量的任务放入 bulk 队列 (搜索索引不需要立即更新)。
+// 与标题任务一样由聊天请求附带触发，不做队列深度检查。
+func (c *asynqClient) EnqueueMessageEmbeddingTask(ctx context.Context, payload *entity.MessageEmbeddingTaskPayload) (taskID string, err error) {
+	return c.enqueue(ctx, entity.TaskTypeMessageEmbedding, payload, asynq.Queue(entity.TaskPriorityBulk.QueueName()),
+		asynq.MaxRetry(messageEmbeddingMaxRetry), asynq.Timeout(messageEmbeddingTimeout))
+}
+
+// EnqueueConversationImportTask 将导入对话的任务放入 bulk 队列。
+// 与文档上传一样由用户直接发起，目标队列积压过多时返回 CodeRateLimited 错误。
+func (c *asynqClient) EnqueueConversationImportTask(ctx context.Context, payload *entity.ConversationImportTaskPayload) (taskID string, err error) {
+	queue := entity.TaskPriorityBulk.QueueName()
+	if err := c.checkBackpressure(ctx, queue); err != nil {
+		return "", err
+	}
+	return c.enqueue(ctx, entity.TaskTypeConversationImport, payload, asynq.Queue(queue),
+		asynq.MaxRetry(conversationImportMaxRetry), asynq.Timeout(conversationImportTimeout), asynq.Retention(conversationImportRetention))
+}
+
+// EnqueueMemoryExtractionTask 将提取用户记忆的任务放入 bulk 队列 (提取结果不需要立即可见)。
+// 与标题任务一样由聊天请求附带触发，不做队列深度检查。
+func (c *asynqClient) EnqueueMemoryExtractionTask(ctx context.Context, payload *entity.MemoryExtractionTaskPayload) (taskID string, err error) {
+	return c.enqueue(ctx, entity.TaskTypeMemoryExtraction, payload, asynq.Queue(entity.TaskPriorityBulk.QueueName()),
+		asynq.MaxRetry(memoryExtractionMaxRetry), asynq.Timeout(memoryExtractionTimeout))
+}
+
+// EnqueueEventDeliveryTask 将 webhook 投递任务放入 interactive 队列 (订阅方期望尽快收到事件)。
+// 投递由已经保存的事件派生，不做队列深度检查；失败时按 Asynq 的指数退避重试。
+func (c *asynqClient) EnqueueEventDeliveryTask(ctx context.Context, payload *entity.EventDeliveryTaskPayload) (taskID string, err error) {
+	return c.enqueue(ctx, entity.TaskTypeEventDelivery, payload, asynq.Queue(entity.TaskPriorityInteractive.QueueName()),
+		asynq.MaxRetry(c.eventDeliveryMaxRetry), asynq.Timeout(eventDeliveryTimeout))
+}
+
+// checkBackpressure 在队列积压的任务数达到上限时拒绝入队。
+// 读取队列深度失败时放行，Redis 不可用会在入队时报错。
+func (c *asynqClient) checkBackpressure(ctx context.Context, queue string) error {
+	if c.maxQueueDepth <= 0 {
+		return nil
+	}
+	depth, err := c.queueDepth.Depth(ctx, queue)
+	if err != nil || depth < c.maxQueueDepth {
+		return nil
+	}
+	logger.WarnContext(ctx, "任务队列积压过多，拒绝入队", "queue", queue, "depth", depth, "max_depth", c.maxQueueDepth)
+	return apperr.New(apperr.CodeRateLimited, "任务队列繁忙，请稍后重试").
+		WithDetails(fmt.Sprintf("queue=%s", queue), fmt.Sprintf("depth=%d", depth), fmt.Sprintf("max_depth=%d", c.maxQueueDepth))
+}
+
+// enqueue 校验并序列化 payload，然后将任务入队。
+// 入队前校验可以避免把 Worker 无法处理的任务放入队列。
+func (c *asynqClient) enqueue(ctx context.Context, taskType string, payload entity.TaskPayload, opts ...asynq.Option) (string, error) {
+	if err := payload.Validate(); err != nil {
+		logger.ErrorContext(ctx, "任务 payload 校验失败", "type", taskType, "error", err)
+		return "", apperr.Wrap(err, apperr.CodeInternal, "无效的任务 payload")
+	}
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		logger.ErrorContext(ctx, "序列化 Embedding 任务 payload 失败", "error", err)
+		logger.ErrorContext(ctx, "序列化任务 payload 失败", "type", taskType, "error", err)
 		return "", apperr.Wrap(err, apperr.CodeInternal, "无法序列化任务 payload")
 	}
 
-	// 创建一个新的 Asynq 任务
-	// TypeEmbedding 是任务类型，payloadBytes 是任务数据
-	task := asynq.NewTask(TypeEmbedding, payloadBytes)
-
-	// 将任务入队
-	// 可以指定队列名称和选项，例如延迟、重试次数等
-	// asynq.Queue("embeddings"), asynq.MaxRetry(5), asynq.Timeout(10*time.Minute)
-	taskInfo, err := c.client.EnqueueContext(ctx, task)
+	taskInfo, err := c.client.EnqueueContext(ctx, asynq.NewTask(taskType, payloadBytes, opts...))
 	if err != nil {
-		logger.ErrorContext(ctx, "将 Embedding 任务入队失败", "error", err)
+		logger.ErrorContext(ctx, "任务入队失败", "type", taskType, "error", err)
 		// 考虑根据错误类型返回不同的 AppError Code (e.g., CodeUnavailable if Redis is down)
 		return "", apperr.Wrap(err, apperr.CodeUnavailable, "无法将任务入队")
 	}
 
-	logger.InfoContext(ctx, "Embedding 任务成功入队", "task_id", taskInfo.ID, "queue", taskInfo.Queue)
+	logger.InfoContext(ctx, "任务成功入队", "type", taskType, "task_id", taskInfo.ID, "queue", taskInfo.Queue)
 	return taskInfo.ID, nil
 }
 
@@ -71,6 +186,10 @@ func (c *asynqClient) Close() error {
 			logger.Error("关闭 Asynq 客户端失败", "error", err)
 			return err
 		}
+		if err := c.inspector.Close(); err != nil {
+			logger.Error("关闭 Asynq Inspector 失败", "error", err)
+			return err
+		}
 		logger.Info("Asynq 客户端已关闭。")
 	}
 	return nil
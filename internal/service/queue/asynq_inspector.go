@@ -0,0 +1,234 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service" // 引入 service 包以引用接口
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// inspectPageSize 是每次从 Redis 读取的任务数。
+	inspectPageSize = 100
+	// maxInspectedTasks 是每个队列的每种状态最多返回的 (属于目标用户的) 任务数。
+	maxInspectedTasks = 1000
+	// maxScannedTasks 是每个队列的每种状态最多从 Redis 读取的任务数，避免死信队列堆积过多时单次请求读取全部任务。
+	maxScannedTasks = 20000
+)
+
+// Ensure asynqInspector implements TaskInspector interface.
+var _ service.TaskInspector = (*asynqInspector)(nil)
+
+// asynqInspector 是 TaskInspector 接口基于 Asynq Inspector 的实现。
+type asynqInspector struct {
+	inspector *asynq.Inspector
+}
+
+// NewAsynqInspector 创建一个新的 Asynq Inspector 实例。
+func NewAsynqInspector(cfg *config.Config) service.TaskInspector {
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+	})
+	logger.Info("Asynq Inspector 初始化完成。", "redis_addr", cfg.RedisAddr)
+	return &asynqInspector{inspector: inspector}
+}
+
+// ListFailedTasks 实现 TaskInspector 接口，结果按最后失败时间倒序排列。
+func (i *asynqInspector) ListFailedTasks(ctx context.Context, userID string, state entity.FailedTaskState) ([]*entity.FailedTask, bool, error) {
+	queues, err := i.inspector.Queues()
+	if err != nil {
+		logger.ErrorContext(ctx, "获取 Asynq 队列列表失败", "error", err)
+		return nil, false, apperr.Wrap(err, apperr.CodeUnavailable, "无法读取任务队列")
+	}
+
+	tasks := make([]*entity.FailedTask, 0)
+	truncated := false
+	for _, queue := range queues {
+		if state == "" || state == entity.FailedTaskStateRetry {
+			listed, partial, err := i.listTasks(ctx, queue, userID, i.inspector.ListRetryTasks)
+			if err != nil {
+				return nil, false, err
+			}
+			tasks = append(tasks, listed...)
+			truncated = truncated || partial
+		}
+		if state == "" || state == entity.FailedTaskStateArchived {
+			listed, partial, err := i.listTasks(ctx, queue, userID, i.inspector.ListArchivedTasks)
+			if err != nil {
+				return nil, false, err
+			}
+			tasks = append(tasks, listed...)
+			truncated = truncated || partial
+		}
+	}
+
+	sort.SliceStable(tasks, func(a, b int) bool {
+		return failedAt(tasks[a]).After(failedAt(tasks[b]))
+	})
+	return tasks, truncated, nil
+}
+
+// listTasks 分页读取一个队列中某种状态的任务，读取时即按用户过滤 (userID 为空时不过滤)，
+// 因此其他用户的大量失败任务不会占用该用户的名额。
+// 最多返回 maxInspectedTasks 个任务、读取 maxScannedTasks 个任务，达到任一上限时返回的 bool 为 true。
+func (i *asynqInspector) listTasks(ctx context.Context, queue string, userID string, list func(string, ...asynq.ListOption) ([]*asynq.TaskInfo, error)) ([]*entity.FailedTask, bool, error) {
+	tasks := make([]*entity.FailedTask, 0)
+	scanned := 0
+	for page := 1; ; page++ {
+		if len(tasks) >= maxInspectedTasks || scanned >= maxScannedTasks {
+			logger.WarnContext(ctx, "失败任务过多，只读取了一部分", "queue", queue, "user_id", userID, "returned", len(tasks), "scanned", scanned)
+			return tasks, true, nil
+		}
+		infos, err := list(queue, asynq.PageSize(inspectPageSize), asynq.Page(page))
+		if err != nil {
+			if errors.Is(err, asynq.ErrQueueNotFound) {
+				break // 队列在列出之后被删除
+			}
+			logger.ErrorContext(ctx, "读取失败任务列表失败", "error", err, "queue", queue)
+			return nil, false, apperr.Wrap(err, apperr.CodeUnavailable, "无法读取失败任务")
+		}
+		scanned += len(infos)
+		for _, info := range infos {
+			if isThrottled(info) {
+				continue
+			}
+			task := toFailedTask(info)
+			if userID != "" && task.UserID != userID {
+				continue
+			}
+			tasks = append(tasks, task)
+		}
+		if len(infos) < inspectPageSize {
+			break
+		}
+	}
+	return tasks, false, nil
+}
+
+// GetFailedTask 实现 TaskInspector 接口。
+func (i *asynqInspector) GetFailedTask(ctx context.Context, taskID string) (*entity.FailedTask, error) {
+	queues, err := i.inspector.Queues()
+	if err != nil {
+		logger.ErrorContext(ctx, "获取 Asynq 队列列表失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeUnavailable, "无法读取任务队列")
+	}
+	for _, queue := range queues {
+		info, err := i.inspector.GetTaskInfo(queue, taskID)
+		if err != nil {
+			if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+				continue
+			}
+			logger.ErrorContext(ctx, "读取任务信息失败", "error", err, "queue", queue, "task_id", taskID)
+			return nil, apperr.Wrap(err, apperr.CodeUnavailable, "无法读取任务信息")
+		}
+		if (info.State != asynq.TaskStateRetry && info.State != asynq.TaskStateArchived) || isThrottled(info) {
+			return nil, apperr.New(apperr.CodeConflict, "任务当前不处于失败状态").WithDetails("state=" + info.State.String())
+		}
+		return toFailedTask(info), nil
+	}
+	return nil, apperr.ErrNotFound("任务未找到")
+}
+
+// DeleteTask 实现 TaskInspector 接口。
+func (i *asynqInspector) DeleteTask(ctx context.Context, queue string, taskID string) error {
+	if err := i.inspector.DeleteTask(queue, taskID); err != nil {
+		if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+			return apperr.ErrNotFound("任务未找到")
+		}
+		logger.ErrorContext(ctx, "删除任务失败", "error", err, "queue", queue, "task_id", taskID)
+		return apperr.Wrap(err, apperr.CodeUnavailable, "无法删除任务")
+	}
+	logger.InfoContext(ctx, "已从队列中删除任务", "queue", queue, "task_id", taskID)
+	return nil
+}
+
+// GetTaskState 实现 TaskInspector 接口。
+func (i *asynqInspector) GetTaskState(ctx context.Context, taskID string) (string, error) {
+	info, err := i.GetTaskInfo(ctx, taskID)
+	if err != nil {
+		return "", err
+	}
+	return info.State, nil
+}
+
+// GetTaskInfo 实现 TaskInspector 接口。
+func (i *asynqInspector) GetTaskInfo(ctx context.Context, taskID string) (*entity.QueuedTaskInfo, error) {
+	queues, err := i.inspector.Queues()
+	if err != nil {
+		logger.ErrorContext(ctx, "获取 Asynq 队列列表失败", "error", err)
+		return nil, apperr.Wrap(err, apperr.CodeUnavailable, "无法读取任务队列")
+	}
+	for _, queue := range queues {
+		info, err := i.inspector.GetTaskInfo(queue, taskID)
+		if err != nil {
+			if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+				continue
+			}
+			logger.ErrorContext(ctx, "读取任务信息失败", "error", err, "queue", queue, "task_id", taskID)
+			return nil, apperr.Wrap(err, apperr.CodeUnavailable, "无法读取任务信息")
+		}
+		return &entity.QueuedTaskInfo{
+			ID:      info.ID,
+			Type:    info.Type,
+			Queue:   info.Queue,
+			State:   info.State.String(),
+			Payload: info.Payload,
+			Result:  info.Result,
+			LastErr: info.LastErr,
+		}, nil
+	}
+	return nil, apperr.ErrNotFound("任务未找到")
+}
+
+// Close 关闭 Inspector 的 Redis 连接。
+func (i *asynqInspector) Close() error {
+	return i.inspector.Close()
+}
+
+// isThrottled 判断任务是否只是因为用户并发上限被推迟 (处于 retry 状态但并未失败)。
+func isThrottled(info *asynq.TaskInfo) bool {
+	return info.State == asynq.TaskStateRetry && strings.HasPrefix(info.LastErr, entity.ErrTaskThrottled.Error())
+}
+
+// toFailedTask 将 Asynq 的任务信息转换为 FailedTask，用户和文档从 payload 的公共字段中读取。
+// 原始 payload 包含存储路径等内部信息，不放入 FailedTask。
+func toFailedTask(info *asynq.TaskInfo) *entity.FailedTask {
+	ref := entity.ParseTaskPayloadRef(info.Payload)
+	task := &entity.FailedTask{
+		ID:           info.ID,
+		Queue:        info.Queue,
+		Type:         info.Type,
+		State:        entity.FailedTaskState(info.State.String()),
+		UserID:       ref.UserID,
+		DocumentID:   ref.DocumentID,
+		Filename:     ref.Filename,
+		Retried:      info.Retried,
+		MaxRetry:     info.MaxRetry,
+		LastError:    info.LastErr,
+		ErrorHistory: []*entity.TaskFailure{},
+	}
+	if !info.LastFailedAt.IsZero() {
+		task.LastFailedAt = &info.LastFailedAt
+	}
+	if info.State == asynq.TaskStateRetry && !info.NextProcessAt.IsZero() {
+		task.NextProcessAt = &info.NextProcessAt
+	}
+	return task
+}
+
+// failedAt 返回任务最后一次失败的时间，没有记录时返回零值。
+func failedAt(task *entity.FailedTask) time.Time {
+	if task.LastFailedAt == nil {
+		return time.Time{}
+	}
+	return *task.LastFailedAt
+}
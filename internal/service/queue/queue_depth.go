@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	// queueDepthCacheTTL 是队列深度的缓存时间。读取队列信息需要多次访问 Redis，
+	// 批量上传时不必每次入队都重新读取。
+	queueDepthCacheTTL = 5 * time.Second
+	// queueDepthMetricName 是通过 expvar (/api/v1/admin/debug/vars，仅管理员可访问) 发布的队列深度指标名。
+	queueDepthMetricName = "asynq_queue_depth"
+)
+
+// monitoredQueues 是队列深度指标中包含的队列。
+var monitoredQueues = []string{
+	entity.TaskPriorityInteractive.QueueName(),
+	entity.TaskPriorityBulk.QueueName(),
+}
+
+// publishMetricOnce 保证指标只注册一次 (expvar.Publish 重复注册同名变量会 panic)。
+var publishMetricOnce sync.Once
+
+// queueDepthMonitor 读取并缓存各队列积压的任务数 (待执行、执行中、计划中和等待重试的任务)。
+type queueDepthMonitor struct {
+	inspector *asynq.Inspector
+	mu        sync.Mutex
+	cache     map[string]cachedDepth
+}
+
+// cachedDepth 是一次读取到的队列深度。
+type cachedDepth struct {
+	depth     int
+	checkedAt time.Time
+}
+
+// newQueueDepthMonitor 创建队列深度监视器，并将其发布为 expvar 指标。
+func newQueueDepthMonitor(inspector *asynq.Inspector) *queueDepthMonitor {
+	m := &queueDepthMonitor{
+		inspector: inspector,
+		cache:     make(map[string]cachedDepth),
+	}
+	publishMetricOnce.Do(func() {
+		expvar.Publish(queueDepthMetricName, expvar.Func(func() any {
+			return m.snapshot()
+		}))
+	})
+	return m
+}
+
+// Depth 返回队列当前积压的任务数。队列尚未创建 (从未入队过任务) 时返回 0。
+func (m *queueDepthMonitor) Depth(ctx context.Context, queue string) (int, error) {
+	m.mu.Lock()
+	cached, ok := m.cache[queue]
+	m.mu.Unlock()
+	if ok && time.Since(cached.checkedAt) < queueDepthCacheTTL {
+		return cached.depth, nil
+	}
+
+	depth := 0
+	info, err := m.inspector.GetQueueInfo(queue)
+	switch {
+	case err == nil:
+		depth = info.Pending + info.Active + info.Scheduled + info.Retry
+	case errors.Is(err, asynq.ErrQueueNotFound):
+	default:
+		logger.WarnContext(ctx, "读取队列深度失败", "error", err, "queue", queue)
+		return 0, err
+	}
+
+	m.mu.Lock()
+	m.cache[queue] = cachedDepth{depth: depth, checkedAt: time.Now()}
+	m.mu.Unlock()
+	return depth, nil
+}
+
+// snapshot 返回各队列的深度，用于指标输出。读取失败的队列记为 -1。
+func (m *queueDepthMonitor) snapshot() map[string]int {
+	depths := make(map[string]int, len(monitoredQueues))
+	for _, queue := range monitoredQueues {
+		depth, err := m.Depth(context.Background(), queue)
+		if err != nil {
+			depth = -1
+		}
+		depths[queue] = depth
+	}
+	return depths
+}
@@ -27,7 +27,12 @@ func NewRAGService(vectorRepo repository.VectorRepository, embeddingProvider Emb
 // RetrieveRelevantChunks 实现 RAGService 接口。
 // 它将查询文本转换为向量，然后使用向量仓库搜索相似的文档块。
 func (s *ragServiceImpl) RetrieveRelevantChunks(ctx context.Context, userID string, query string, limit int) ([]*entity.DocumentChunk, error) {
-	logger.InfoContext(ctx, "开始检索相关文档块", "userID", userID, "query", query, "limit", limit)
+	return s.RetrieveFilteredChunks(ctx, userID, query, limit, nil)
+}
+
+// RetrieveFilteredChunks 实现 RAGService 接口，filter 为 nil 时不过滤。
+func (s *ragServiceImpl) RetrieveFilteredChunks(ctx context.Context, userID string, query string, limit int, filter *entity.ChunkFilter) ([]*entity.DocumentChunk, error) {
+	logger.InfoContext(ctx, "开始检索相关文档块", "userID", userID, "query", query, "limit", limit, "filtered", !filter.IsEmpty())
 
 	// 1. 将查询文本转换为嵌入向量
 	queryEmbeddings, err := s.embeddingProvider.CreateEmbeddings(ctx, []string{query})
@@ -48,8 +53,7 @@ func (s *ragServiceImpl) RetrieveRelevantChunks(ctx context.Context, userID stri
 	// 2. 使用向量仓库搜索相似块
 	// 2. 使用向量仓库搜索相似块
 	// userID is now passed as a parameter.
-	// 如果需要额外的元数据过滤，可以在这里传递 filter map
-	searchResults, err := s.vectorRepo.SearchSimilarChunks(ctx, userID, queryVector, limit, nil) // 使用传入的 userID
+	searchResults, err := s.vectorRepo.SearchSimilarChunks(ctx, userID, queryVector, limit, filter) // 使用传入的 userID
 	if err != nil {
 		logger.ErrorContext(ctx, "向量搜索失败", "error", err, "userID", userID)
 		// vectorRepo 应该已经包装了错误，这里可以不再包装，或者根据需要再次包装
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// ResumableUploadService 定义了可恢复分块上传 (tus 风格) 的业务逻辑接口。
+// 流程：创建会话 -> 按顺序 PATCH 字节区间 (断线后查询 Offset 继续) -> 完成 (合并为文档并入队处理)。
+type ResumableUploadService interface {
+	// CreateUpload 创建上传会话。totalSize 会在创建时按单文件上限和用户配额校验。
+	CreateUpload(ctx context.Context, userID string, filename string, contentType string, totalSize int64) (*entity.UploadSession, error)
+
+	// GetUpload 获取上传会话 (包括当前 Offset)。
+	GetUpload(ctx context.Context, userID string, uploadID string) (*entity.UploadSession, error)
+
+	// AppendChunk 从 offset 处追加数据。offset 必须等于会话当前的 Offset，否则返回 CodeConflict 错误。
+	// 如果读取 data 时连接中断，已接收的部分仍会被保存，客户端可查询 Offset 后继续上传。
+	AppendChunk(ctx context.Context, userID string, uploadID string, offset int64, data io.Reader) (*entity.UploadSession, error)
+
+	// FinalizeUpload 将已完整接收的数据合并为文档，并像 FileService.UploadFile 一样触发 Embedding 任务。
+	// 返回创建的文档实体和任务 ID。
+	FinalizeUpload(ctx context.Context, userID string, uploadID string) (*entity.Document, string, error)
+
+	// AbortUpload 取消上传会话并删除已上传的数据。
+	AbortUpload(ctx context.Context, userID string, uploadID string) error
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// uploadSessionTTL 是上传会话在最后一次写入后的有效期，过期的会话由定时维护任务清理。
+const uploadSessionTTL = 24 * time.Hour
+
+// resumableUploadServiceImpl 是 ResumableUploadService 接口的实现。
+type resumableUploadServiceImpl struct {
+	sessionRepo repository.UploadSessionRepository // 上传会话仓库
+	fileStorage FileStorage                        // 存储各个数据块
+	fileService FileService                        // 完成时用于创建文档并入队
+}
+
+// NewResumableUploadService 创建一个新的 resumableUploadServiceImpl 实例。
+func NewResumableUploadService(sr repository.UploadSessionRepository, fs FileStorage, fileService FileService) ResumableUploadService {
+	return &resumableUploadServiceImpl{
+		sessionRepo: sr,
+		fileStorage: fs,
+		fileService: fileService,
+	}
+}
+
+// CreateUpload 创建上传会话。
+func (s *resumableUploadServiceImpl) CreateUpload(ctx context.Context, userID string, filename string, contentType string, totalSize int64) (*entity.UploadSession, error) {
+	filename = strings.TrimSpace(filename)
+	if filename == "" {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "文件名不能为空")
+	}
+	if totalSize < 0 {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "文件大小不能为负数")
+	}
+	// 提前按单文件上限和配额拒绝，避免客户端上传完才失败
+	if err := s.fileService.ValidateUploadSize(ctx, userID, totalSize); err != nil {
+		return nil, err
+	}
+
+	session := entity.NewUploadSession(userID, filename, contentType, totalSize, uploadSessionTTL)
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "可恢复上传会话已创建", "upload_id", session.ID, "user_id", userID, "filename", filename, "total_size", totalSize)
+	return session, nil
+}
+
+// GetUpload 获取上传会话。
+func (s *resumableUploadServiceImpl) GetUpload(ctx context.Context, userID string, uploadID string) (*entity.UploadSession, error) {
+	return s.sessionRepo.GetSession(ctx, userID, uploadID)
+}
+
+// AppendChunk 从 offset 处追加数据，每次调用保存为一个独立的数据块。
+func (s *resumableUploadServiceImpl) AppendChunk(ctx context.Context, userID string, uploadID string, offset int64, data io.Reader) (*entity.UploadSession, error) {
+	session, err := s.sessionRepo.GetSession(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != entity.UploadSessionStatusActive {
+		return nil, apperr.New(apperr.CodeConflict, "上传会话正在完成，不能再写入数据")
+	}
+	if offset != session.Offset {
+		return nil, apperr.New(apperr.CodeConflict, "上传偏移不匹配").
+			WithDetails(fmt.Sprintf("expected_offset=%d", session.Offset))
+	}
+
+	// 已接收的数据块计入存储配额；按本会话剩余的字节数检查，避免多个会话并行上传超出配额
+	if err := s.fileService.ValidateUploadSize(ctx, userID, session.TotalSize-session.Offset); err != nil {
+		return nil, err
+	}
+
+	// 连接中断时保留已接收的数据；超出声明的总大小时拒绝。
+	// 客户端断开后请求 ctx 会被取消，保存数据块和记录偏移时不能依赖它。
+	ctx = context.WithoutCancel(ctx)
+	body := &interruptibleReader{r: data}
+	limited := &limitedReader{
+		r:         body,
+		remaining: session.TotalSize - session.Offset,
+		limitErr: apperr.New(apperr.CodeValidation, "数据超出上传会话声明的文件大小").
+			WithDetails(fmt.Sprintf("total_size=%d", session.TotalSize)).
+			WithHTTPStatus(http.StatusRequestEntityTooLarge),
+	}
+	storedPath, err := s.fileStorage.SaveFile(ctx, userID, session.ID+".part", limited)
+	if err != nil {
+		if limited.exceeded {
+			return nil, limited.limitErr
+		}
+		return nil, err
+	}
+	if limited.read == 0 {
+		// 没有收到任何数据，不需要记录空的数据块
+		s.deletePartFile(ctx, storedPath)
+		return session, nil
+	}
+
+	part := &entity.UploadPart{
+		SessionID:  session.ID,
+		Offset:     offset,
+		Size:       limited.read,
+		StoredPath: storedPath,
+	}
+	if err := s.sessionRepo.AppendPart(ctx, userID, part, time.Now().Add(uploadSessionTTL)); err != nil {
+		// 并发写入同一偏移时只有一个请求成功，删除落败请求的数据块
+		s.deletePartFile(ctx, storedPath)
+		return nil, err
+	}
+	session.Offset += part.Size
+
+	if body.err != nil {
+		logger.WarnContext(ctx, "上传数据块时连接中断，已保存接收到的部分", "error", body.err, "upload_id", session.ID, "offset", session.Offset)
+	} else {
+		logger.DebugContext(ctx, "上传数据块已保存", "upload_id", session.ID, "offset", session.Offset, "total_size", session.TotalSize)
+	}
+	return session, nil
+}
+
+// FinalizeUpload 将所有数据块按顺序拼接后交给 FileService.UploadFile，然后清理会话。
+func (s *resumableUploadServiceImpl) FinalizeUpload(ctx context.Context, userID string, uploadID string) (*entity.Document, string, error) {
+	session, err := s.sessionRepo.GetSession(ctx, userID, uploadID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !session.IsComplete() {
+		return nil, "", apperr.New(apperr.CodeConflict, "上传尚未完成").
+			WithDetails(fmt.Sprintf("offset=%d", session.Offset), fmt.Sprintf("total_size=%d", session.TotalSize))
+	}
+	// 合并过程不应因客户端断开而中途取消，否则会话会停留在 finalizing 状态
+	ctx = context.WithoutCancel(ctx)
+	// 切换到 finalizing，防止并发完成或继续写入
+	if err := s.sessionRepo.UpdateStatus(ctx, userID, uploadID, entity.UploadSessionStatusActive, entity.UploadSessionStatusFinalizing); err != nil {
+		return nil, "", err
+	}
+
+	parts, err := s.sessionRepo.ListParts(ctx, uploadID)
+	if err == nil {
+		err = checkPartsContiguous(parts, session.TotalSize)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "上传会话的数据块无效", "error", err, "upload_id", uploadID)
+		s.reactivate(ctx, userID, uploadID)
+		return nil, "", err
+	}
+
+	reader := &partsReader{ctx: ctx, storage: s.fileStorage, parts: parts}
+	doc, taskID, err := s.fileService.UploadFile(ctx, userID, session.Filename, session.TotalSize, session.ContentType, reader)
+	_ = reader.Close()
+	if err != nil && doc == nil {
+		// 文档未创建，恢复会话以便客户端重试或取消
+		s.reactivate(ctx, userID, uploadID)
+		return nil, "", err
+	}
+
+	// 文档已创建 (即使入队失败)，会话的数据块不再需要
+	if delErr := s.deleteSessionData(ctx, userID, uploadID, parts); delErr != nil {
+		logger.WarnContext(ctx, "清理已完成的上传会话失败，将由过期清理处理", "error", delErr, "upload_id", uploadID)
+	}
+	logger.InfoContext(ctx, "可恢复上传已完成", "upload_id", uploadID, "document_id", doc.ID, "task_id", taskID)
+	return doc, taskID, err
+}
+
+// AbortUpload 取消上传会话并删除已上传的数据。
+func (s *resumableUploadServiceImpl) AbortUpload(ctx context.Context, userID string, uploadID string) error {
+	session, err := s.sessionRepo.GetSession(ctx, userID, uploadID)
+	if err != nil {
+		return err
+	}
+	if session.Status != entity.UploadSessionStatusActive {
+		return apperr.New(apperr.CodeConflict, "上传会话正在完成，无法取消")
+	}
+	parts, err := s.sessionRepo.ListParts(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteSessionData(ctx, userID, uploadID, parts); err != nil {
+		return err
+	}
+	logger.InfoContext(ctx, "可恢复上传已取消", "upload_id", uploadID, "user_id", userID)
+	return nil
+}
+
+// reactivate 将会话从 finalizing 恢复为 active。
+func (s *resumableUploadServiceImpl) reactivate(ctx context.Context, userID string, uploadID string) {
+	if err := s.sessionRepo.UpdateStatus(ctx, userID, uploadID, entity.UploadSessionStatusFinalizing, entity.UploadSessionStatusActive); err != nil {
+		logger.ErrorContext(ctx, "恢复上传会话状态失败", "error", err, "upload_id", uploadID)
+	}
+}
+
+// deleteSessionData 删除会话的所有数据块文件和会话记录。
+func (s *resumableUploadServiceImpl) deleteSessionData(ctx context.Context, userID string, uploadID string, parts []*entity.UploadPart) error {
+	for _, part := range parts {
+		s.deletePartFile(ctx, part.StoredPath)
+	}
+	return s.sessionRepo.DeleteSession(ctx, userID, uploadID)
+}
+
+// deletePartFile 删除一个数据块文件，失败时只记录日志。
+func (s *resumableUploadServiceImpl) deletePartFile(ctx context.Context, storedPath string) {
+	if err := s.fileStorage.DeleteFile(ctx, storedPath); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+		logger.WarnContext(ctx, "删除上传数据块失败", "error", err, "stored_path", storedPath)
+	}
+}
+
+// checkPartsContiguous 校验数据块从 0 开始连续且总大小等于 totalSize。
+func checkPartsContiguous(parts []*entity.UploadPart, totalSize int64) error {
+	var expected int64
+	for _, part := range parts {
+		if part.Offset != expected {
+			return apperr.New(apperr.CodeInternal, "上传数据块不连续").
+				WithDetails(fmt.Sprintf("expected_offset=%d", expected), fmt.Sprintf("part_offset=%d", part.Offset))
+		}
+		expected += part.Size
+	}
+	if expected != totalSize {
+		return apperr.New(apperr.CodeInternal, "上传数据块总大小与会话不一致")
+	}
+	return nil
+}
+
+// interruptibleReader 将底层读取错误 (通常是客户端断开连接) 转换为 io.EOF，
+// 使已接收的数据能被正常保存。原始错误记录在 err 中。
+type interruptibleReader struct {
+	r   io.Reader
+	err error
+}
+
+// Read 实现 io.Reader。
+func (r *interruptibleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// partsReader 按顺序读取上传会话的各个数据块，每次只打开一个文件。
+type partsReader struct {
+	ctx     context.Context
+	storage FileStorage
+	parts   []*entity.UploadPart
+	current io.ReadCloser
+}
+
+// Read 实现 io.Reader。
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			reader, err := r.storage.GetFileReader(r.ctx, r.parts[0].StoredPath)
+			if err != nil {
+				return 0, err
+			}
+			r.current = reader
+			r.parts = r.parts[1:]
+		}
+		n, err := r.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			_ = r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close 关闭当前打开的数据块。
+func (r *partsReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/internal/service" // 引入 service 包以引用接口
+	"github.com/soaringjerry/dreamhub/internal/util"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// rotateBatchSize 是密钥轮换时每批处理的数据密钥数量。
+const rotateBatchSize = 100
+
+// Ensure EncryptedStorage implements FileStorage and KeyedFileStorage interfaces.
+var (
+	_ service.FileStorage         = (*EncryptedStorage)(nil)
+	_ service.KeyedFileStorage    = (*EncryptedStorage)(nil)
+	_ service.ListableFileStorage = (*EncryptedStorage)(nil)
+)
+
+// EncryptedStorage 是 FileStorage 的装饰器，为上传文件提供信封加密。
+// 每个文件使用随机生成的数据密钥 (DEK) 加密，DEK 由主密钥包装后保存在 FileKeyRepository 中。
+// 读取时透明解密；没有数据密钥记录的文件 (启用加密前上传的) 按明文返回。
+type EncryptedStorage struct {
+	inner       service.FileStorage          // 实际存储文件字节的底层存储
+	keyRepo     repository.FileKeyRepository // 已包装数据密钥的存储
+	masterKeys  map[string]string            // 主密钥 ID -> 主密钥
+	activeKeyID string                       // 用于包装新数据密钥的主密钥 ID
+}
+
+// NewEncryptedStorage 创建一个新的 EncryptedStorage 实例。
+// 调用方应先通过 cfg.FileEncryptionEnabled() 确认已配置主密钥。
+func NewEncryptedStorage(inner service.FileStorage, keyRepo repository.FileKeyRepository, cfg *config.Config) (*EncryptedStorage, error) {
+	if !cfg.FileEncryptionEnabled() {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "未配置文件加密主密钥")
+	}
+	if _, ok := cfg.FileEncryptionKeys[cfg.FileEncryptionActiveKeyID]; !ok {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "当前文件加密主密钥 ID 无效")
+	}
+	logger.Info("文件静态加密已启用。", "active_key_id", cfg.FileEncryptionActiveKeyID, "key_count", len(cfg.FileEncryptionKeys))
+	return &EncryptedStorage{
+		inner:       inner,
+		keyRepo:     keyRepo,
+		masterKeys:  cfg.FileEncryptionKeys,
+		activeKeyID: cfg.FileEncryptionActiveKeyID,
+	}, nil
+}
+
+// ActiveKeyID 返回当前用于包装新文件数据密钥的主密钥 ID。
+func (s *EncryptedStorage) ActiveKeyID() string {
+	return s.activeKeyID
+}
+
+// SaveFile 加密文件内容后交给底层存储保存，并记录被包装的数据密钥。
+func (s *EncryptedStorage) SaveFile(ctx context.Context, userID string, filename string, fileData io.Reader) (storedPath string, err error) {
+	dataKey, err := util.NewDataKey()
+	if err != nil {
+		logger.ErrorContext(ctx, "生成文件数据密钥失败", "error", err)
+		return "", apperr.Wrap(err, apperr.CodeInternal, "无法加密文件")
+	}
+	wrappedKey, err := util.EncryptBytes(dataKey, s.masterKeys[s.activeKeyID])
+	if err != nil {
+		logger.ErrorContext(ctx, "包装文件数据密钥失败", "error", err, "key_id", s.activeKeyID)
+		return "", apperr.Wrap(err, apperr.CodeInternal, "无法加密文件")
+	}
+
+	// 通过管道边加密边写入底层存储，避免将整个文件读入内存
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, encErr := util.EncryptStream(pw, fileData, dataKey)
+		pw.CloseWithError(encErr)
+	}()
+	storedPath, err = s.inner.SaveFile(ctx, userID, filename, pr)
+	_ = pr.Close() // 如果底层存储提前返回，解除加密 goroutine 的阻塞
+	<-done
+	if err != nil {
+		return "", err // 底层存储已记录并包装错误
+	}
+
+	key := &entity.FileDataKey{
+		StoredPath: storedPath,
+		KeyID:      s.activeKeyID,
+		WrappedKey: wrappedKey,
+	}
+	if err := s.keyRepo.SaveFileKey(ctx, key); err != nil {
+		// 没有数据密钥的密文文件无法再读取，删除它以保持一致性
+		logger.WarnContext(ctx, "保存文件数据密钥失败，删除已写入的密文文件", "error", err, "stored_path", storedPath)
+		if delErr := s.inner.DeleteFile(ctx, storedPath); delErr != nil {
+			logger.ErrorContext(ctx, "回滚删除密文文件失败", "delete_error", delErr, "stored_path", storedPath)
+		}
+		return "", err
+	}
+
+	logger.InfoContext(ctx, "文件已加密保存", "stored_path", storedPath, "key_id", s.activeKeyID)
+	return storedPath, nil
+}
+
+// DeleteFile 删除底层文件及其数据密钥。
+func (s *EncryptedStorage) DeleteFile(ctx context.Context, storedPath string) error {
+	fileErr := s.inner.DeleteFile(ctx, storedPath)
+	if fileErr != nil && !apperr.Is(fileErr, apperr.CodeNotFound) {
+		return fileErr // 文件仍然存在时保留密钥，否则文件将永久无法解密
+	}
+	if err := s.keyRepo.DeleteFileKey(ctx, storedPath); err != nil {
+		return err
+	}
+	return fileErr
+}
+
+// WalkFiles 遍历底层存储中的文件 (底层存储不支持遍历时返回 CodeUnavailable 错误)。
+func (s *EncryptedStorage) WalkFiles(ctx context.Context, fn func(storedPath string, modTime time.Time) error) error {
+	listable, ok := s.inner.(service.ListableFileStorage)
+	if !ok {
+		return apperr.New(apperr.CodeUnavailable, "底层文件存储不支持遍历")
+	}
+	return listable.WalkFiles(ctx, fn)
+}
+
+// GetFileReader 返回解密后的文件内容。
+func (s *EncryptedStorage) GetFileReader(ctx context.Context, storedPath string) (io.ReadCloser, error) {
+	key, err := s.keyRepo.GetFileKey(ctx, storedPath)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			// 启用加密之前上传的文件没有数据密钥，按明文读取
+			logger.DebugContext(ctx, "文件没有数据密钥，按明文读取", "stored_path", storedPath)
+			return s.inner.GetFileReader(ctx, storedPath)
+		}
+		return nil, err
+	}
+
+	dataKey, err := s.unwrap(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := s.inner.GetFileReader(ctx, storedPath)
+	if err != nil {
+		return nil, err
+	}
+	if seeker, ok := raw.(io.ReadSeeker); ok {
+		// 底层文件可 Seek 时返回可随机访问的解密 reader，Range 请求只解密需要的段
+		plain, err := util.NewSeekableDecryptingReader(seeker, dataKey)
+		if err != nil {
+			_ = raw.Close()
+			logger.ErrorContext(ctx, "初始化文件解密失败", "error", err, "stored_path", storedPath)
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "无法解密文件")
+		}
+		return &seekableDecryptedFile{DecryptingReadSeeker: plain, closer: raw}, nil
+	}
+	plain, err := util.NewDecryptingReader(raw, dataKey)
+	if err != nil {
+		_ = raw.Close()
+		logger.ErrorContext(ctx, "初始化文件解密失败", "error", err, "stored_path", storedPath)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法解密文件")
+	}
+	return &decryptedFile{Reader: plain, closer: raw}, nil
+}
+
+// RotateKeys 使用当前主密钥重新包装所有由其他主密钥包装的数据密钥。
+// 只重写 file_encryption_keys 中的记录，文件内容保持不变。返回成功轮换和无法轮换的数量。
+// 旧主密钥在轮换完成前必须保留在 FILE_ENCRYPTION_KEYS 中；无法轮换的记录会被跳过，不影响其余记录。
+func (s *EncryptedStorage) RotateKeys(ctx context.Context) (rotated int, failed int, err error) {
+	afterPath := ""
+	for {
+		keys, err := s.keyRepo.ListKeysNotWrappedBy(ctx, s.activeKeyID, afterPath, rotateBatchSize)
+		if err != nil {
+			return rotated, failed, err
+		}
+		if len(keys) == 0 {
+			break
+		}
+		afterPath = keys[len(keys)-1].StoredPath
+
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return rotated, failed, err
+			}
+			dataKey, err := s.unwrap(ctx, key)
+			if err != nil {
+				failed++ // 已记录日志 (通常是旧主密钥已被移除)，跳过该文件
+				continue
+			}
+			wrappedKey, err := util.EncryptBytes(dataKey, s.masterKeys[s.activeKeyID])
+			if err != nil {
+				logger.ErrorContext(ctx, "重新包装文件数据密钥失败", "error", err, "stored_path", key.StoredPath)
+				failed++
+				continue
+			}
+			if err := s.keyRepo.RewrapKey(ctx, key.StoredPath, key.KeyID, s.activeKeyID, wrappedKey); err != nil {
+				if !apperr.Is(err, apperr.CodeConflict) {
+					// 冲突说明记录已被并发轮换或删除，不算失败
+					logger.ErrorContext(ctx, "保存重新包装的数据密钥失败", "error", err, "stored_path", key.StoredPath)
+					failed++
+				}
+				continue
+			}
+			rotated++
+		}
+		if len(keys) < rotateBatchSize {
+			break
+		}
+	}
+	if failed > 0 {
+		logger.WarnContext(ctx, "部分文件数据密钥无法轮换，请检查旧主密钥是否仍在配置中", "rotated", rotated, "failed", failed)
+	} else if rotated > 0 {
+		logger.InfoContext(ctx, "文件数据密钥轮换完成", "rotated", rotated, "active_key_id", s.activeKeyID)
+	}
+	return rotated, failed, nil
+}
+
+// unwrap 使用对应的主密钥解开数据密钥。
+func (s *EncryptedStorage) unwrap(ctx context.Context, key *entity.FileDataKey) ([]byte, error) {
+	masterKey, ok := s.masterKeys[key.KeyID]
+	if !ok {
+		logger.ErrorContext(ctx, "找不到包装数据密钥的主密钥", "key_id", key.KeyID, "stored_path", key.StoredPath)
+		return nil, apperr.New(apperr.CodeInternal, "缺少文件加密主密钥")
+	}
+	dataKey, err := util.DecryptBytes(key.WrappedKey, masterKey)
+	if err != nil {
+		logger.ErrorContext(ctx, "解包文件数据密钥失败", "error", err, "key_id", key.KeyID, "stored_path", key.StoredPath)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法解密文件数据密钥")
+	}
+	return dataKey, nil
+}
+
+// decryptedFile 将解密 reader 与底层文件的 Close 组合为 io.ReadCloser。
+type decryptedFile struct {
+	io.Reader
+	closer io.Closer
+}
+
+// Close 关闭底层文件。
+func (f *decryptedFile) Close() error {
+	return f.closer.Close()
+}
+
+// seekableDecryptedFile 将可随机访问的解密 reader 与底层文件的 Close 组合，
+// 同时实现 io.ReadSeeker 和 io.ReaderAt。
+type seekableDecryptedFile struct {
+	util.DecryptingReadSeeker
+	closer io.Closer
+}
+
+// Close 关闭底层文件。
+func (f *seekableDecryptedFile) Close() error {
+	return f.closer.Close()
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/soaringjerry/dreamhub/internal/service" // 引入 service 包以引用接口
@@ -14,6 +16,12 @@ import (
 	"github.com/soaringjerry/dreamhub/pkg/logger"
 )
 
+// Ensure LocalStorage implements FileStorage and ListableFileStorage interfaces.
+var (
+	_ service.FileStorage         = (*LocalStorage)(nil)
+	_ service.ListableFileStorage = (*LocalStorage)(nil)
+)
+
 // LocalStorage 实现了 FileStorage 接口，使用本地文件系统存储文件。
 type LocalStorage struct {
 	uploadDir string // 从配置中获取的基础上传目录
@@ -159,3 +167,38 @@ func (ls *LocalStorage) GetFileReader(ctx context.Context, storedPath string) (i
 	// file 实现了 io.ReadCloser 接口
 	return file, nil
 }
+
+// WalkFiles 遍历上传目录中的所有文件，返回的路径与 SaveFile 返回的格式一致 (uploadDir/userID/文件名)。
+func (ls *LocalStorage) WalkFiles(ctx context.Context, fn func(storedPath string, modTime time.Time) error) error {
+	err := filepath.WalkDir(ls.uploadDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // 遍历期间被删除
+			}
+			return err
+		}
+		rel, err := filepath.Rel(ls.uploadDir, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.Join(ls.uploadDir, rel), info.ModTime())
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.ErrorContext(ctx, "遍历上传目录失败", "error", err, "upload_dir", ls.uploadDir)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法遍历文件存储")
+	}
+	return nil
+}
@@ -6,25 +6,52 @@ import (
 	"github.com/soaringjerry/dreamhub/internal/entity"
 )
 
+// StructuredMemoryFilter narrows the memories returned by GetUserMemories.
+type StructuredMemoryFilter struct {
+	Namespace      string // Only memories in this namespace; empty means all namespaces
+	IncludeExpired bool   // Whether to include memories whose expiry has passed
+}
+
 // StructuredMemoryService defines the business logic for managing structured memories.
+// Every change is recorded in the memory's history, which can be listed and reverted to.
 type StructuredMemoryService interface {
 	// CreateMemory creates a new structured memory entry for the given user.
-	// Changed userID type from uuid.UUID to string (UUID)
-	CreateMemory(ctx context.Context, userID string, key, value string) (*entity.StructuredMemory, error)
+	// The value is validated against input.ValueType (string by default).
+	CreateMemory(ctx context.Context, userID string, input *entity.StructuredMemoryInput) (*entity.StructuredMemory, error)
 
 	// GetMemoryByKey retrieves a specific memory entry for the user by key.
 	// Changed userID type from uuid.UUID to string (UUID)
 	GetMemoryByKey(ctx context.Context, userID string, key string) (*entity.StructuredMemory, error)
 
-	// GetUserMemories retrieves all memory entries for the given user.
-	// Changed userID type from uuid.UUID to string (UUID)
-	GetUserMemories(ctx context.Context, userID string) ([]*entity.StructuredMemory, error)
+	// GetUserMemories retrieves the user's memory entries matching the filter (nil returns all unexpired memories).
+	GetUserMemories(ctx context.Context, userID string, filter *StructuredMemoryFilter) ([]*entity.StructuredMemory, error)
 
-	// UpdateMemory updates the value of an existing memory entry for the user.
-	// Changed userID type from uuid.UUID to string (UUID)
-	UpdateMemory(ctx context.Context, userID string, key, value string) (*entity.StructuredMemory, error)
+	// UpdateMemory replaces the value and attributes of an existing memory entry (input.Key is ignored).
+	// Omitted optional fields revert to their defaults, and the source becomes "manual".
+	UpdateMemory(ctx context.Context, userID string, key string, input *entity.StructuredMemoryInput) (*entity.StructuredMemory, error)
 
-	// DeleteMemory deletes a memory entry for the user by key.
+	// DeleteMemory deletes a memory entry for the user by key. Its history is kept.
 	// Changed userID type from uuid.UUID to string (UUID)
 	DeleteMemory(ctx context.Context, userID string, key string) error
+
+	// GetMemoryHistory lists every recorded version of the key, newest first, including versions of deleted memories.
+	GetMemoryHistory(ctx context.Context, userID string, key string) ([]*entity.StructuredMemoryHistory, error)
+
+	// RevertMemory restores the key to the version recorded in the given history entry.
+	// The revert is itself recorded as a new version; a deleted memory is created again.
+	RevertMemory(ctx context.Context, userID string, key string, historyID string) (*entity.StructuredMemory, error)
+
+	// ExportMemories renders the user's memories, including expired ones, as a JSON or CSV file.
+	// A non-empty namespace limits the export to that namespace.
+	ExportMemories(ctx context.Context, userID string, namespace string, format string) (*entity.ExportFile, error)
+
+	// ImportMemories writes the memories of a JSON or CSV file in one transaction, with source "imported".
+	// strategy decides what happens to keys the user already has (skip by default). Every item is
+	// validated first: if any is invalid, nothing is written and the returned summary lists the invalid items
+	// alongside the error.
+	ImportMemories(ctx context.Context, userID string, format string, strategy entity.MemoryConflictStrategy, data []byte) (*entity.MemoryBatchSummary, error)
+
+	// BatchMemories runs upserts and deletes in order in one transaction and returns one result per operation.
+	// Upserts replace existing memories like UpdateMemory. Invalid operations are reported as for ImportMemories.
+	BatchMemories(ctx context.Context, userID string, ops []*entity.MemoryBatchOperation) (*entity.MemoryBatchSummary, error)
 }
@@ -2,49 +2,49 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	// "github.com/google/uuid" // Removed unused import
 	"github.com/soaringjerry/dreamhub/internal/entity"
 	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
 )
 
 // structuredMemoryServiceImpl implements the StructuredMemoryService interface.
 type structuredMemoryServiceImpl struct {
-	repo repository.StructuredMemoryRepository
+	repo   repository.StructuredMemoryRepository
+	events EventPublisher // Can be nil: no memory changed events are published
 }
 
 // NewStructuredMemoryService creates a new instance of StructuredMemoryService.
-func NewStructuredMemoryService(repo repository.StructuredMemoryRepository) StructuredMemoryService {
-	return &structuredMemoryServiceImpl{repo: repo}
+func NewStructuredMemoryService(repo repository.StructuredMemoryRepository, events EventPublisher) StructuredMemoryService {
+	return &structuredMemoryServiceImpl{repo: repo, events: events}
 }
 
 // CreateMemory creates a new structured memory entry.
 // Changed userID type from uuid.UUID to string (UUID)
-func (s *structuredMemoryServiceImpl) CreateMemory(ctx context.Context, userID string, key, value string) (*entity.StructuredMemory, error) {
-	// Basic validation
-	key = strings.TrimSpace(key)
-	if key == "" {
-		return nil, errors.New("memory key cannot be empty")
-	}
-	// Value validation might depend on requirements (e.g., max length, format if JSON)
-	if strings.TrimSpace(value) == "" {
-		return nil, errors.New("memory value cannot be empty")
+func (s *structuredMemoryServiceImpl) CreateMemory(ctx context.Context, userID string, input *entity.StructuredMemoryInput) (*entity.StructuredMemory, error) {
+	if input == nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "缺少记忆内容")
 	}
-
-	memory := &entity.StructuredMemory{
-		UserID: userID,
-		Key:    key,
-		Value:  value,
-		// ID, CreatedAt, UpdatedAt will be set by the repository/database
+	memory, err := newStructuredMemory(userID, input.Key, input)
+	if err != nil {
+		return nil, err
 	}
 
-	err := s.repo.Create(ctx, memory)
+	err = s.repo.Create(ctx, memory)
 	if err != nil {
 		// The repository already maps pgx errors to specific repo errors like ErrDuplicateKey
 		return nil, err
 	}
+	publishMemoryChanges(ctx, s.events, userID, []entity.MemoryChange{entity.NewMemoryChange(memory)})
 	return memory, nil
 }
 
@@ -59,53 +59,50 @@ func (s *structuredMemoryServiceImpl) GetMemoryByKey(ctx context.Context, userID
 	return s.repo.GetByKey(ctx, userID, key)
 }
 
-// GetUserMemories retrieves all memory entries for a user.
+// GetUserMemories retrieves the memory entries of a user that match the filter.
 // Changed userID type from uuid.UUID to string (UUID)
-func (s *structuredMemoryServiceImpl) GetUserMemories(ctx context.Context, userID string) ([]*entity.StructuredMemory, error) {
+func (s *structuredMemoryServiceImpl) GetUserMemories(ctx context.Context, userID string, filter *StructuredMemoryFilter) ([]*entity.StructuredMemory, error) {
+	if filter == nil {
+		filter = &StructuredMemoryFilter{}
+	}
 	// Pass string userID to repository
-	return s.repo.GetByUserID(ctx, userID)
+	memories, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	filtered := make([]*entity.StructuredMemory, 0, len(memories))
+	for _, m := range memories {
+		if filter.Namespace != "" && m.Namespace != filter.Namespace {
+			continue
+		}
+		if !filter.IncludeExpired && m.Expired(now) {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	return filtered, nil
 }
 
-// UpdateMemory updates an existing memory entry.
+// UpdateMemory replaces the value and attributes of an existing memory entry.
 // Changed userID type from uuid.UUID to string (UUID)
-func (s *structuredMemoryServiceImpl) UpdateMemory(ctx context.Context, userID string, key, value string) (*entity.StructuredMemory, error) {
-	key = strings.TrimSpace(key)
-	if key == "" {
-		return nil, errors.New("memory key cannot be empty") // TODO: Use apperr
+func (s *structuredMemoryServiceImpl) UpdateMemory(ctx context.Context, userID string, key string, input *entity.StructuredMemoryInput) (*entity.StructuredMemory, error) {
+	if input == nil {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "缺少记忆内容")
 	}
-	if strings.TrimSpace(value) == "" {
-		return nil, errors.New("memory value cannot be empty") // TODO: Use apperr
-	}
-
-	// First, check if the memory exists (optional, repo update also checks)
-	// _, err := s.repo.GetByKey(ctx, userID, key)
-	// if err != nil {
-	// 	return nil, err // Return ErrNotFound or other errors
-	// }
-
-	memory := &entity.StructuredMemory{
-		UserID: userID,
-		Key:    key,
-		Value:  value,
-		// UpdatedAt will be set by the repository/database
+	memory, err := newStructuredMemory(userID, key, input)
+	if err != nil {
+		return nil, err
 	}
 
-	err := s.repo.Update(ctx, memory)
+	// The repository scans the updated entity (new version and UpdatedAt) back into memory
+	err = s.repo.Update(ctx, memory)
 	if err != nil {
 		// Repository handles ErrNotFound if the key doesn't exist for the user
 		return nil, err
 	}
-	// We need to return the full updated entity, including the new UpdatedAt.
-	// The repo.Update currently scans UpdatedAt back, but not the full entity.
-	// Let's fetch it again to return the complete, updated state.
-	// Alternatively, the repo.Update could be modified to return the full entity.
-	updatedMemory, fetchErr := s.repo.GetByKey(ctx, userID, key)
-	if fetchErr != nil {
-		// This shouldn't ideally happen if the update succeeded, but handle defensively.
-		return nil, fetchErr
-	}
-
-	return updatedMemory, nil
+	publishMemoryChanges(ctx, s.events, userID, []entity.MemoryChange{entity.NewMemoryChange(memory)})
+	return memory, nil
 }
 
 // DeleteMemory deletes a memory entry by key.
@@ -117,5 +114,149 @@ func (s *structuredMemoryServiceImpl) DeleteMemory(ctx context.Context, userID s
 	}
 	// Repository handles ErrNotFound if the key doesn't exist
 	// Pass string userID to repository
-	return s.repo.Delete(ctx, userID, key)
+	if err := s.repo.Delete(ctx, userID, key); err != nil {
+		return err
+	}
+	publishMemoryChanges(ctx, s.events, userID, []entity.MemoryChange{{Action: entity.MemoryChangeDeleted, Key: key}})
+	return nil
+}
+
+// GetMemoryHistory lists the recorded versions of a key.
+func (s *structuredMemoryServiceImpl) GetMemoryHistory(ctx context.Context, userID string, key string) ([]*entity.StructuredMemoryHistory, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, apperr.New(apperr.CodeInvalidArgument, "记忆的键不能为空")
+	}
+	entries, err := s.repo.ListHistory(ctx, userID, key)
+	if err != nil {
+		logger.ErrorContext(ctx, "获取记忆历史失败", "error", err, "user_id", userID, "key", key)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取记忆历史")
+	}
+	if len(entries) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return entries, nil
+}
+
+// RevertMemory writes the version recorded in a history entry back to the memory.
+func (s *structuredMemoryServiceImpl) RevertMemory(ctx context.Context, userID string, key string, historyID string) (*entity.StructuredMemory, error) {
+	key = strings.TrimSpace(key)
+	entry, err := s.repo.GetHistoryEntry(ctx, userID, historyID)
+	if err != nil {
+		return nil, err // ErrNotFound or a database error
+	}
+	if entry.Key != key {
+		return nil, repository.ErrNotFound // The entry belongs to another key
+	}
+	memory := &entity.StructuredMemory{
+		UserID:               userID,
+		Key:                  entry.Key,
+		Value:                entry.Value,
+		ValueType:            entry.ValueType,
+		Namespace:            entry.Namespace,
+		Source:               entry.Source,
+		SourceConversationID: entry.SourceConversationID,
+		Confidence:           entry.Confidence,
+		ExpiresAt:            entry.ExpiresAt,
+	}
+	if err := upsertStructuredMemory(ctx, s.repo, memory); err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "记忆已恢复到历史版本", "user_id", userID, "key", key, "history_id", historyID, "version", entry.Version)
+	publishMemoryChanges(ctx, s.events, userID, []entity.MemoryChange{entity.NewMemoryChange(memory)})
+	return memory, nil
+}
+
+// newStructuredMemory validates input and builds a manually written memory for key.
+func newStructuredMemory(userID string, key string, input *entity.StructuredMemoryInput) (*entity.StructuredMemory, error) {
+	memory := &entity.StructuredMemory{
+		UserID:     userID,
+		Key:        strings.TrimSpace(key),
+		Value:      strings.TrimSpace(input.Value),
+		ValueType:  input.ValueType,
+		Namespace:  strings.TrimSpace(input.Namespace),
+		Source:     entity.MemorySourceManual,
+		Confidence: input.Confidence,
+		ExpiresAt:  input.ExpiresAt,
+		// ID, Version, CreatedAt, UpdatedAt will be set by the repository/database
+	}
+	if memory.ValueType == "" {
+		memory.ValueType = entity.MemoryValueString
+	}
+	if err := validateStructuredMemory(memory); err != nil {
+		return nil, err
+	}
+	return memory, nil
+}
+
+// validateStructuredMemory checks the key, namespace and confidence, and that the value matches its type.
+func validateStructuredMemory(m *entity.StructuredMemory) error {
+	if m.Key == "" {
+		return apperr.New(apperr.CodeValidation, "记忆的键不能为空")
+	}
+	if utf8.RuneCountInString(m.Key) > entity.MaxMemoryKeyLength {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("记忆的键不能超过 %d 个字符", entity.MaxMemoryKeyLength))
+	}
+	if m.Value == "" {
+		return apperr.New(apperr.CodeValidation, "记忆的值不能为空")
+	}
+	if utf8.RuneCountInString(m.Namespace) > entity.MaxMemoryNamespaceLength {
+		return apperr.New(apperr.CodeValidation, fmt.Sprintf("命名空间不能超过 %d 个字符", entity.MaxMemoryNamespaceLength))
+	}
+	if c := m.Confidence; c != nil && (*c < 0 || *c > 1) {
+		return apperr.New(apperr.CodeValidation, "confidence 必须在 0 到 1 之间")
+	}
+	if err := validateMemoryValue(m.ValueType, m.Value); err != nil {
+		return apperr.New(apperr.CodeValidation, err.Error()).WithDetails("key=" + m.Key)
+	}
+	return nil
+}
+
+// validateMemoryValue checks that value is a valid value of type t.
+func validateMemoryValue(t entity.MemoryValueType, value string) error {
+	switch t {
+	case entity.MemoryValueString:
+		return nil
+	case entity.MemoryValueNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return errors.New("值不是有效的数字")
+		}
+	case entity.MemoryValueDate:
+		if _, err := time.Parse(time.DateOnly, value); err == nil {
+			return nil
+		}
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return errors.New("值不是有效的日期 (格式为 2006-01-02 或 RFC 3339 时间)")
+		}
+	case entity.MemoryValueJSON:
+		if !json.Valid([]byte(value)) {
+			return errors.New("值不是有效的 JSON")
+		}
+	case entity.MemoryValueList:
+		var list []any
+		if err := json.Unmarshal([]byte(value), &list); err != nil {
+			return errors.New("值不是有效的 JSON 数组")
+		}
+	default:
+		return fmt.Errorf("不支持的值类型 %q，可选值: %s, %s, %s, %s, %s", t,
+			entity.MemoryValueString, entity.MemoryValueNumber, entity.MemoryValueDate, entity.MemoryValueJSON, entity.MemoryValueList)
+	}
+	return nil
+}
+
+// upsertStructuredMemory writes memory for its key: it updates the existing memory, or creates it if the key does not exist.
+// The repository scans the stored memory back into memory.
+func upsertStructuredMemory(ctx context.Context, repo repository.StructuredMemoryRepository, memory *entity.StructuredMemory) error {
+	err := repo.Update(ctx, memory)
+	if errors.Is(err, repository.ErrNotFound) {
+		err = repo.Create(ctx, memory)
+		if errors.Is(err, repository.ErrDuplicateKey) {
+			err = repo.Update(ctx, memory) // 并发写入了同一个键
+		}
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "写入结构化记忆失败", "error", err, "user_id", memory.UserID, "key", memory.Key)
+		return apperr.Wrap(err, apperr.CodeInternal, "无法写入记忆")
+	}
+	return nil
 }
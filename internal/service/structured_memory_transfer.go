@@ -0,0 +1,311 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// memoryCSVColumns is the header of a CSV export. Imports only read key, value, value_type,
+// namespace, confidence and expires_at, so an export can be imported again as is.
+var memoryCSVColumns = []string{"key", "value", "value_type", "namespace", "source", "source_conversation_id", "confidence", "expires_at", "version", "created_at", "updated_at"}
+
+// ExportMemories renders the user's memories as a JSON or CSV file, sorted by key.
+func (s *structuredMemoryServiceImpl) ExportMemories(ctx context.Context, userID string, namespace string, format string) (*entity.ExportFile, error) {
+	if err := validateMemoryFileFormat(format); err != nil {
+		return nil, err
+	}
+	memories, err := s.GetUserMemories(ctx, userID, &StructuredMemoryFilter{Namespace: namespace, IncludeExpired: true})
+	if err != nil {
+		logger.ErrorContext(ctx, "导出结构化记忆失败", "error", err, "user_id", userID)
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法获取记忆")
+	}
+	sort.Slice(memories, func(i, j int) bool { return memories[i].Key < memories[j].Key })
+
+	logger.InfoContext(ctx, "导出结构化记忆", "user_id", userID, "format", format, "count", len(memories))
+	baseName := "memories-" + time.Now().UTC().Format("20060102")
+	if format == entity.MemoryFileFormatJSON {
+		data, err := json.MarshalIndent(memories, "", "  ")
+		if err != nil {
+			return nil, apperr.Wrap(err, apperr.CodeInternal, "无法生成导出文件")
+		}
+		return &entity.ExportFile{Filename: baseName + ".json", ContentType: "application/json", Data: data}, nil
+	}
+	data, err := renderMemoryCSV(memories)
+	if err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法生成导出文件")
+	}
+	return &entity.ExportFile{Filename: baseName + ".csv", ContentType: "text/csv; charset=utf-8", Data: data}, nil
+}
+
+// ImportMemories parses an import file and writes its memories in one transaction.
+func (s *structuredMemoryServiceImpl) ImportMemories(ctx context.Context, userID string, format string, strategy entity.MemoryConflictStrategy, data []byte) (*entity.MemoryBatchSummary, error) {
+	if err := validateMemoryFileFormat(format); err != nil {
+		return nil, err
+	}
+	if strategy == "" {
+		strategy = entity.MemoryConflictSkip
+	}
+	switch strategy {
+	case entity.MemoryConflictSkip, entity.MemoryConflictOverwrite, entity.MemoryConflictFail:
+	default:
+		return nil, apperr.New(apperr.CodeInvalidArgument, "不支持的冲突处理策略").
+			WithDetails(fmt.Sprintf("strategy=%s，可选值: skip、overwrite、fail", strategy))
+	}
+
+	var inputs []*entity.StructuredMemoryInput
+	var itemErrs map[int]error
+	if format == entity.MemoryFileFormatJSON {
+		if err := json.Unmarshal(data, &inputs); err != nil {
+			return nil, apperr.Wrap(err, apperr.CodeInvalidArgument, "导入文件不是有效的 JSON 数组")
+		}
+		itemErrs = make(map[int]error)
+	} else {
+		var err error
+		if inputs, itemErrs, err = parseMemoryCSV(data); err != nil {
+			return nil, err
+		}
+	}
+
+	// A key may appear only once in a file: with skip or fail its second occurrence would be a conflict with the first
+	seen := make(map[string]int, len(inputs))
+	ops := make([]*entity.MemoryBatchOperation, len(inputs))
+	for i, input := range inputs {
+		if input == nil {
+			input = &entity.StructuredMemoryInput{}
+		}
+		ops[i] = &entity.MemoryBatchOperation{Op: entity.MemoryBatchUpsert, StructuredMemoryInput: *input}
+		key := strings.TrimSpace(input.Key)
+		if first, ok := seen[key]; ok && key != "" && itemErrs[i] == nil {
+			itemErrs[i] = fmt.Errorf("键与 index 为 %d 的项重复", first)
+		} else if !ok {
+			seen[key] = i
+		}
+	}
+
+	summary, err := s.applyMemoryBatch(ctx, userID, ops, itemErrs, entity.MemorySourceImported, strategy)
+	if err != nil {
+		return summary, err
+	}
+	logger.InfoContext(ctx, "导入结构化记忆完成", "user_id", userID, "format", format, "strategy", strategy,
+		"created", summary.Created, "updated", summary.Updated, "skipped", summary.Skipped)
+	return summary, nil
+}
+
+// BatchMemories runs upserts and deletes in one transaction, overwriting existing memories.
+func (s *structuredMemoryServiceImpl) BatchMemories(ctx context.Context, userID string, ops []*entity.MemoryBatchOperation) (*entity.MemoryBatchSummary, error) {
+	summary, err := s.applyMemoryBatch(ctx, userID, ops, nil, entity.MemorySourceManual, entity.MemoryConflictOverwrite)
+	if err != nil {
+		return summary, err
+	}
+	logger.InfoContext(ctx, "批量写入结构化记忆完成", "user_id", userID, "operations", len(ops),
+		"created", summary.Created, "updated", summary.Updated, "deleted", summary.Deleted, "not_found", summary.NotFound)
+	return summary, nil
+}
+
+// applyMemoryBatch validates the operations and runs them in one transaction. itemErrs holds errors found
+// while parsing the items, by index. Upserted memories get the given source.
+// If any item is invalid nothing is written, and the summary of the invalid items is returned with the error.
+func (s *structuredMemoryServiceImpl) applyMemoryBatch(ctx context.Context, userID string, ops []*entity.MemoryBatchOperation, itemErrs map[int]error, source entity.MemorySource, strategy entity.MemoryConflictStrategy) (*entity.MemoryBatchSummary, error) {
+	if len(ops) == 0 {
+		return nil, apperr.New(apperr.CodeValidation, "没有要写入的记忆")
+	}
+	if len(ops) > entity.MaxMemoryBatchSize {
+		return nil, apperr.New(apperr.CodeValidation, fmt.Sprintf("一次最多写入 %d 条记忆", entity.MaxMemoryBatchSize)).
+			WithDetails(fmt.Sprintf("items=%d", len(ops)))
+	}
+
+	writes := make([]repository.MemoryWrite, 0, len(ops))
+	invalid := make([]*entity.MemoryBatchResult, 0)
+	for i, op := range ops {
+		if op == nil {
+			op = &entity.MemoryBatchOperation{}
+		}
+		err := itemErrs[i]
+		var memory *entity.StructuredMemory
+		if err == nil {
+			switch op.Op {
+			case entity.MemoryBatchUpsert:
+				if memory, err = newStructuredMemory(userID, op.Key, &op.StructuredMemoryInput); err == nil {
+					memory.Source = source
+				}
+			case entity.MemoryBatchDelete:
+				memory = &entity.StructuredMemory{UserID: userID, Key: strings.TrimSpace(op.Key)}
+				if memory.Key == "" {
+					err = errors.New("记忆的键不能为空")
+				}
+			default:
+				err = fmt.Errorf("不支持的操作 %q，可选值: upsert、delete", op.Op)
+			}
+		}
+		if err != nil {
+			invalid = append(invalid, &entity.MemoryBatchResult{Index: i, Op: op.Op, Key: op.Key, Status: entity.MemoryBatchInvalid, Error: memoryItemError(err)})
+			continue
+		}
+		writes = append(writes, repository.MemoryWrite{Op: op.Op, Memory: memory})
+	}
+	if len(invalid) > 0 {
+		return &entity.MemoryBatchSummary{Results: invalid},
+			apperr.New(apperr.CodeValidation, fmt.Sprintf("%d 条记忆未通过验证，没有写入任何记忆", len(invalid)))
+	}
+
+	results, err := s.repo.ApplyBatch(ctx, userID, writes, strategy)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateKey) {
+			return nil, apperr.Wrap(err, apperr.CodeConflict, "记忆的键已存在，没有写入任何记忆")
+		}
+		logger.ErrorContext(ctx, "批量写入结构化记忆失败", "error", err, "user_id", userID, "items", len(writes))
+		return nil, apperr.Wrap(err, apperr.CodeInternal, "无法写入记忆")
+	}
+
+	summary := &entity.MemoryBatchSummary{Results: results}
+	for _, r := range results {
+		switch r.Status {
+		case entity.MemoryBatchCreated:
+			summary.Created++
+		case entity.MemoryBatchUpdated:
+			summary.Updated++
+		case entity.MemoryBatchSkipped:
+			summary.Skipped++
+		case entity.MemoryBatchDeleted:
+			summary.Deleted++
+		case entity.MemoryBatchNotFound:
+			summary.NotFound++
+		}
+	}
+	publishMemoryChanges(ctx, s.events, userID, memoryBatchChanges(results))
+	return summary, nil
+}
+
+// memoryBatchChanges returns the changes of the items that wrote or deleted a memory, for the memory changed event.
+func memoryBatchChanges(results []*entity.MemoryBatchResult) []entity.MemoryChange {
+	var changes []entity.MemoryChange
+	for _, r := range results {
+		switch {
+		case (r.Status == entity.MemoryBatchCreated || r.Status == entity.MemoryBatchUpdated) && r.Memory != nil:
+			change := entity.NewMemoryChange(r.Memory)
+			change.Action = string(r.Status)
+			changes = append(changes, change)
+		case r.Status == entity.MemoryBatchDeleted:
+			changes = append(changes, entity.MemoryChange{Action: entity.MemoryChangeDeleted, Key: r.Key})
+		}
+	}
+	return changes
+}
+
+// memoryItemError returns the message reported for an invalid item, without the error code.
+func memoryItemError(err error) string {
+	var appErr *apperr.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return err.Error()
+}
+
+// validateMemoryFileFormat checks that format is a supported export or import format.
+func validateMemoryFileFormat(format string) error {
+	switch format {
+	case entity.MemoryFileFormatJSON, entity.MemoryFileFormatCSV:
+		return nil
+	}
+	return apperr.New(apperr.CodeInvalidArgument, "不支持的文件格式").
+		WithDetails("format=" + format + "，可选值: json、csv")
+}
+
+// renderMemoryCSV writes the memories as CSV with a memoryCSVColumns header.
+func renderMemoryCSV(memories []*entity.StructuredMemory) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(memoryCSVColumns); err != nil {
+		return nil, err
+	}
+	for _, m := range memories {
+		var sourceConversationID, confidence, expiresAt string
+		if m.SourceConversationID != nil {
+			sourceConversationID = *m.SourceConversationID
+		}
+		if m.Confidence != nil {
+			confidence = strconv.FormatFloat(*m.Confidence, 'f', -1, 32) // Stored as REAL
+		}
+		if m.ExpiresAt != nil {
+			expiresAt = m.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		record := []string{
+			m.Key, m.Value, string(m.ValueType), m.Namespace, string(m.Source), sourceConversationID, confidence, expiresAt,
+			strconv.Itoa(m.Version), m.CreatedAt.UTC().Format(time.RFC3339), m.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// parseMemoryCSV reads the memories of a CSV import file. The header row names the columns (any order,
+// unknown columns are ignored); key and value are required. Rows whose confidence or expires_at cannot be
+// parsed are returned with an error in rowErrs, keyed by the index of the data row.
+func parseMemoryCSV(data []byte) ([]*entity.StructuredMemoryInput, map[int]error, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))) // Spreadsheet programs often add a BOM
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, apperr.Wrap(err, apperr.CodeInvalidArgument, "导入文件不是有效的 CSV")
+	}
+	if len(records) == 0 {
+		return nil, nil, apperr.New(apperr.CodeInvalidArgument, "CSV 文件缺少表头")
+	}
+	columns := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"key", "value"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, apperr.New(apperr.CodeInvalidArgument, "CSV 表头缺少必需的列").WithDetails("column=" + required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	inputs := make([]*entity.StructuredMemoryInput, 0, len(records)-1)
+	rowErrs := make(map[int]error)
+	for i, record := range records[1:] {
+		input := &entity.StructuredMemoryInput{
+			Key:       field(record, "key"),
+			Value:     record[columns["value"]], // Leading and trailing spaces are trimmed with the other values during validation
+			ValueType: entity.MemoryValueType(field(record, "value_type")),
+			Namespace: field(record, "namespace"),
+		}
+		if v := field(record, "confidence"); v != "" {
+			c, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				rowErrs[i] = errors.New("confidence 不是有效的数字")
+			}
+			input.Confidence = &c
+		}
+		if v := field(record, "expires_at"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				rowErrs[i] = errors.New("expires_at 不是有效的 RFC 3339 时间")
+			}
+			input.ExpiresAt = &t
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, rowErrs, nil
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+// fakeMemoryBatchRepo records the writes passed to ApplyBatch and reports every write as created or deleted.
+type fakeMemoryBatchRepo struct {
+	repository.StructuredMemoryRepository
+	calls    int
+	writes   []repository.MemoryWrite
+	strategy entity.MemoryConflictStrategy
+}
+
+func (f *fakeMemoryBatchRepo) ApplyBatch(ctx context.Context, userID string, writes []repository.MemoryWrite, onConflict entity.MemoryConflictStrategy) ([]*entity.MemoryBatchResult, error) {
+	f.calls++
+	f.writes, f.strategy = writes, onConflict
+	results := make([]*entity.MemoryBatchResult, len(writes))
+	for i, w := range writes {
+		status := entity.MemoryBatchCreated
+		if w.Op == entity.MemoryBatchDelete {
+			status = entity.MemoryBatchDeleted
+		}
+		results[i] = &entity.MemoryBatchResult{Index: i, Op: w.Op, Key: w.Memory.Key, Status: status, Memory: w.Memory}
+	}
+	return results, nil
+}
+
+func TestParseMemoryCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantKeys []string
+		wantErr  string // Part of the message or details of the file-level error; empty when the file parses
+	}{
+		{"header only", "key,value\n", []string{}, ""},
+		{"export columns", "key,value,value_type,namespace,source,version\ncity,Berlin,string,home,manual,3\n", []string{"city"}, ""},
+		{"byte order mark", "\xef\xbb\xbfkey,value\ncity,Berlin\n", []string{"city"}, ""},
+		{"columns in any order and case", " Value ,KEY,extra\nBerlin,city,ignored\n", []string{"city"}, ""},
+		{"missing key column", "name,value\ncity,Berlin\n", nil, "column=key"},
+		{"missing value column", "key,val\ncity,Berlin\n", nil, "column=value"},
+		{"empty file", "", nil, "缺少表头"},
+		{"inconsistent row length", "key,value\ncity,Berlin,extra\n", nil, "不是有效的 CSV"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, rowErrs, err := parseMemoryCSV([]byte(tt.data))
+			if tt.wantErr != "" {
+				var appErr *apperr.AppError
+				if !errors.As(err, &appErr) || appErr.Code != apperr.CodeInvalidArgument ||
+					!strings.Contains(appErr.Error()+strings.Join(appErr.Details, " "), tt.wantErr) {
+					t.Fatalf("parseMemoryCSV() error = %v, want an invalid argument error mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMemoryCSV() error = %v", err)
+			}
+			keys := make([]string, 0, len(inputs))
+			for _, input := range inputs {
+				keys = append(keys, input.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys = %q, want %q", keys, tt.wantKeys)
+			}
+			if len(rowErrs) != 0 {
+				t.Errorf("row errors = %v, want none", rowErrs)
+			}
+		})
+	}
+}
+
+func TestParseMemoryCSVFields(t *testing.T) {
+	data := "key,value,value_type,namespace,confidence,expires_at\n" +
+		" city ,  Berlin  ,string, home ,0.8,2030-01-01T00:00:00Z\n" +
+		"age,42,number,,high,\n" +
+		"trip,Kyoto,,,,next week\n"
+	inputs, rowErrs, err := parseMemoryCSV([]byte(data))
+	if err != nil {
+		t.Fatalf("parseMemoryCSV() error = %v", err)
+	}
+	if len(inputs) != 3 {
+		t.Fatalf("parseMemoryCSV() returned %d rows, want 3", len(inputs))
+	}
+	city := inputs[0]
+	if city.Key != "city" || city.Value != "  Berlin  " || city.ValueType != entity.MemoryValueString || city.Namespace != "home" {
+		t.Errorf("row 0 = %+v, want trimmed key and namespace with the value left for validation", city)
+	}
+	if city.Confidence == nil || *city.Confidence != 0.8 || city.ExpiresAt == nil || city.ExpiresAt.Year() != 2030 {
+		t.Errorf("row 0 confidence and expiry = %v, %v", city.Confidence, city.ExpiresAt)
+	}
+	// Rows with unparsable values are reported by data row index and do not stop the other rows
+	if len(rowErrs) != 2 || rowErrs[1] == nil || rowErrs[2] == nil {
+		t.Errorf("row errors = %v, want errors for rows 1 and 2", rowErrs)
+	}
+}
+
+func TestImportMemories(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		data        string
+		wantKeys    []string       // Keys written, in order
+		wantInvalid map[int]string // Index -> part of the error of each invalid item
+	}{
+		{
+			name:     "json",
+			format:   entity.MemoryFileFormatJSON,
+			data:     `[{"key":"city","value":"Berlin"},{"key":"age","value":"42","value_type":"number"}]`,
+			wantKeys: []string{"city", "age"},
+		},
+		{
+			name:     "csv with byte order mark",
+			format:   entity.MemoryFileFormatCSV,
+			data:     "\xef\xbb\xbfkey,value\ncity,Berlin\nage,42\n",
+			wantKeys: []string{"city", "age"},
+		},
+		{
+			name:        "duplicate key in json",
+			format:      entity.MemoryFileFormatJSON,
+			data:        `[{"key":"city","value":"Berlin"},{"key":"trip","value":"Kyoto"},{"key":" city ","value":"Paris"}]`,
+			wantInvalid: map[int]string{2: "index 为 0 的项重复"},
+		},
+		{
+			name:        "duplicate key in csv",
+			format:      entity.MemoryFileFormatCSV,
+			data:        "key,value\ncity,Berlin\ncity,Paris\n",
+			wantInvalid: map[int]string{1: "index 为 0 的项重复"},
+		},
+		{
+			name:        "one invalid item aborts the batch",
+			format:      entity.MemoryFileFormatJSON,
+			data:        `[{"key":"city","value":"Berlin"},{"key":"age","value":"forty","value_type":"number"},{"key":"trip","value":"Kyoto"}]`,
+			wantInvalid: map[int]string{1: ""},
+		},
+		{
+			name:        "unparsable csv value aborts the batch",
+			format:      entity.MemoryFileFormatCSV,
+			data:        "key,value,confidence\ncity,Berlin,0.9\ntrip,Kyoto,very\n",
+			wantInvalid: map[int]string{1: "confidence"},
+		},
+		{
+			name:        "null and empty items",
+			format:      entity.MemoryFileFormatJSON,
+			data:        `[null,{"key":"city","value":""}]`,
+			wantInvalid: map[int]string{0: "键不能为空", 1: "值不能为空"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeMemoryBatchRepo{}
+			s := NewStructuredMemoryService(repo, nil)
+			summary, err := s.ImportMemories(context.Background(), "user-1", tt.format, "", []byte(tt.data))
+
+			if tt.wantInvalid != nil {
+				if !apperr.Is(err, apperr.CodeValidation) {
+					t.Fatalf("ImportMemories() error = %v, want code %s", err, apperr.CodeValidation)
+				}
+				if repo.calls != 0 {
+					t.Errorf("ApplyBatch called %d times, want nothing written", repo.calls)
+				}
+				if summary == nil || len(summary.Results) != len(tt.wantInvalid) {
+					t.Fatalf("summary = %+v, want %d invalid items", summary, len(tt.wantInvalid))
+				}
+				for _, r := range summary.Results {
+					want, ok := tt.wantInvalid[r.Index]
+					if !ok || r.Status != entity.MemoryBatchInvalid || !strings.Contains(r.Error, want) {
+						t.Errorf("result %+v, want invalid item error containing %q", r, want)
+					}
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ImportMemories() error = %v", err)
+			}
+			var keys []string
+			for _, w := range repo.writes {
+				keys = append(keys, w.Memory.Key)
+				if w.Op != entity.MemoryBatchUpsert || w.Memory.Source != entity.MemorySourceImported {
+					t.Errorf("write %+v, want an upsert of an imported memory", w)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("written keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if repo.strategy != entity.MemoryConflictSkip {
+				t.Errorf("strategy = %q, want the default %q", repo.strategy, entity.MemoryConflictSkip)
+			}
+			if summary.Created != len(tt.wantKeys) {
+				t.Errorf("summary.Created = %d, want %d", summary.Created, len(tt.wantKeys))
+			}
+		})
+	}
+}
+
+func TestImportMemoriesRejectsRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		strategy entity.MemoryConflictStrategy
+		data     string
+		code     apperr.ErrorCode
+	}{
+		{"unknown format", "xml", "", `[]`, apperr.CodeInvalidArgument},
+		{"unknown strategy", entity.MemoryFileFormatJSON, "merge", `[]`, apperr.CodeInvalidArgument},
+		{"json object", entity.MemoryFileFormatJSON, "", `{"key":"city"}`, apperr.CodeInvalidArgument},
+		{"empty file", entity.MemoryFileFormatJSON, "", `[]`, apperr.CodeValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeMemoryBatchRepo{}
+			_, err := NewStructuredMemoryService(repo, nil).ImportMemories(context.Background(), "user-1", tt.format, tt.strategy, []byte(tt.data))
+			if !apperr.Is(err, tt.code) {
+				t.Errorf("ImportMemories() error = %v, want code %s", err, tt.code)
+			}
+			if repo.calls != 0 {
+				t.Errorf("ApplyBatch called %d times, want nothing written", repo.calls)
+			}
+		})
+	}
+}
+
+func TestBatchMemoriesAllOrNothing(t *testing.T) {
+	repo := &fakeMemoryBatchRepo{}
+	s := NewStructuredMemoryService(repo, nil)
+	ops := []*entity.MemoryBatchOperation{
+		{Op: entity.MemoryBatchUpsert, StructuredMemoryInput: entity.StructuredMemoryInput{Key: "city", Value: "Berlin"}},
+		{Op: entity.MemoryBatchDelete, StructuredMemoryInput: entity.StructuredMemoryInput{Key: "  "}},
+		{Op: "rename", StructuredMemoryInput: entity.StructuredMemoryInput{Key: "trip"}},
+		{Op: entity.MemoryBatchDelete, StructuredMemoryInput: entity.StructuredMemoryInput{Key: "old_job"}},
+	}
+	summary, err := s.BatchMemories(context.Background(), "user-1", ops)
+	if !apperr.Is(err, apperr.CodeValidation) {
+		t.Fatalf("BatchMemories() error = %v, want code %s", err, apperr.CodeValidation)
+	}
+	if repo.calls != 0 {
+		t.Errorf("ApplyBatch called %d times, want nothing written", repo.calls)
+	}
+	if summary == nil || len(summary.Results) != 2 || summary.Results[0].Index != 1 || summary.Results[1].Index != 2 {
+		t.Errorf("summary = %+v, want items 1 and 2 reported as invalid", summary)
+	}
+
+	// Without the invalid items the same batch is written as is, overwriting existing memories
+	summary, err = s.BatchMemories(context.Background(), "user-1", []*entity.MemoryBatchOperation{ops[0], ops[3]})
+	if err != nil {
+		t.Fatalf("BatchMemories() error = %v", err)
+	}
+	if repo.calls != 1 || repo.strategy != entity.MemoryConflictOverwrite || repo.writes[0].Memory.Source != entity.MemorySourceManual {
+		t.Errorf("ApplyBatch calls = %d, strategy = %q, writes = %+v", repo.calls, repo.strategy, repo.writes)
+	}
+	if summary.Created != 1 || summary.Deleted != 1 {
+		t.Errorf("summary = %+v, want 1 created and 1 deleted", summary)
+	}
+}
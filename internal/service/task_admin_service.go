@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// TaskAdminService 定义了查看、重试和删除失败的异步任务 (重试等待中的任务和死信队列) 的业务逻辑接口。
+// userID 为空表示管理员视图，可以查看和操作所有用户的任务；否则只能访问 payload 属于该用户的任务，
+// 其他用户的任务按不存在处理。
+type TaskAdminService interface {
+	// ListFailedTasks 列出失败的任务及其失败历史 (按最后失败时间倒序，带分页)。
+	// state 为空时同时列出 retry 和 archived 状态的任务。返回当前页的任务、符合条件的任务总数，
+	// 以及失败任务过多、只检查了一部分时为 true 的 truncated (此时总数不完整)。
+	ListFailedTasks(ctx context.Context, userID string, state entity.FailedTaskState, limit int, offset int) (tasks []*entity.FailedTask, total int, truncated bool, err error)
+
+	// GetFailedTask 获取单个失败任务及其失败历史。
+	GetFailedTask(ctx context.Context, userID string, taskID string) (*entity.FailedTask, error)
+
+	// RetryTask 用原任务的参数重新入队一个新任务并删除原任务，失败历史转移到新任务。
+	// 关联文档的 ProcessingStatus 重置为 pending 并关联新任务 ID。返回新任务 ID。
+	RetryTask(ctx context.Context, userID string, taskID string) (string, error)
+
+	// DeleteTask 从队列中删除失败任务及其失败历史 (不修改关联文档)。
+	DeleteTask(ctx context.Context, userID string, taskID string) error
+}
+
+// TaskInspector 定义了检查任务队列中失败任务的接口，与 TaskQueueClient 一样将具体的队列实现解耦。
+type TaskInspector interface {
+	// ListFailedTasks 列出所有队列中属于 userID (为空时不限用户) 且处于 state 状态的任务，
+	// state 为空时列出 retry 和 archived 两种状态。每个队列检查的任务数有上限，超出时返回的 bool 为 true。
+	// 返回的任务不包含 ErrorHistory。
+	ListFailedTasks(ctx context.Context, userID string, state entity.FailedTaskState) ([]*entity.FailedTask, bool, error)
+
+	// GetFailedTask 在所有队列中查找任务。任务不存在时返回 CodeNotFound 错误，
+	// 任务存在但不处于失败状态 (例如已经在重新执行) 时返回 CodeConflict 错误。
+	GetFailedTask(ctx context.Context, taskID string) (*entity.FailedTask, error)
+
+	// DeleteTask 从队列中删除任务。
+	DeleteTask(ctx context.Context, queue string, taskID string) error
+
+	// GetTaskState 返回任务在队列中的状态 (pending、active、scheduled、retry、archived 等)。
+	// 任务不在任何队列中 (已完成并过了保留期，或 Redis 数据丢失) 时返回 CodeNotFound 错误。
+	GetTaskState(ctx context.Context, taskID string) (string, error)
+
+	// GetTaskInfo 在所有队列中查找任务，返回任务的状态、payload 和结果 (已完成的任务在保留期内可以查到)。
+	// 任务不在任何队列中时返回 CodeNotFound 错误。
+	GetTaskInfo(ctx context.Context, taskID string) (*entity.QueuedTaskInfo, error)
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// Ensure taskAdminServiceImpl implements TaskAdminService interface.
+var _ TaskAdminService = (*taskAdminServiceImpl)(nil)
+
+// taskAdminServiceImpl 是 TaskAdminService 接口的实现。
+type taskAdminServiceImpl struct {
+	inspector   TaskInspector
+	failureRepo repository.TaskFailureRepository
+	docRepo     repository.DocumentRepository
+	taskQueue   TaskQueueClient
+}
+
+// NewTaskAdminService 创建一个新的 taskAdminServiceImpl 实例。
+func NewTaskAdminService(inspector TaskInspector, failureRepo repository.TaskFailureRepository, docRepo repository.DocumentRepository, taskQueue TaskQueueClient) TaskAdminService {
+	return &taskAdminServiceImpl{
+		inspector:   inspector,
+		failureRepo: failureRepo,
+		docRepo:     docRepo,
+		taskQueue:   taskQueue,
+	}
+}
+
+// ListFailedTasks 列出用户的失败任务，分页并附加失败历史。
+func (s *taskAdminServiceImpl) ListFailedTasks(ctx context.Context, userID string, state entity.FailedTaskState, limit int, offset int) ([]*entity.FailedTask, int, bool, error) {
+	if state != "" && state != entity.FailedTaskStateRetry && state != entity.FailedTaskStateArchived {
+		return nil, 0, false, apperr.New(apperr.CodeInvalidArgument, "state 参数只能是 retry 或 archived")
+	}
+	tasks, truncated, err := s.inspector.ListFailedTasks(ctx, userID, state)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	total := len(tasks)
+	if offset >= total {
+		return []*entity.FailedTask{}, total, truncated, nil
+	}
+	page := tasks[offset:min(offset+limit, total)]
+
+	if err := s.attachHistory(ctx, page...); err != nil {
+		return nil, 0, false, err
+	}
+	return page, total, truncated, nil
+}
+
+// GetFailedTask 获取单个失败任务及其失败历史。
+func (s *taskAdminServiceImpl) GetFailedTask(ctx context.Context, userID string, taskID string) (*entity.FailedTask, error) {
+	task, err := s.getFailedTask(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachHistory(ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// RetryTask 重新入队失败任务。
+// 先入队新任务再删除原任务：即使删除失败，原任务也只是留在死信队列中，不会丢失待处理的文档。
+func (s *taskAdminServiceImpl) RetryTask(ctx context.Context, userID string, taskID string) (string, error) {
+	task, err := s.getFailedTask(ctx, userID, taskID)
+	if err != nil {
+		return "", err
+	}
+	if task.UserID == "" || task.DocumentID == "" {
+		return "", apperr.New(apperr.CodeValidation, "任务 payload 无效，无法重试，只能删除").WithDetails("task_id=" + task.ID)
+	}
+	// 重新读取文档：文档可能已被删除，或在任务失败后内容被替换 (存储路径变化)
+	doc, err := s.docRepo.GetDocumentByID(ctx, task.UserID, task.DocumentID)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			return "", apperr.New(apperr.CodeConflict, "任务关联的文档已被删除，无法重试").WithDetails("document_id=" + task.DocumentID)
+		}
+		return "", err
+	}
+
+	newTaskID, err := s.enqueue(ctx, task, doc)
+	if err != nil {
+		return "", err
+	}
+	logger.InfoContext(ctx, "失败任务已重新入队", "task_id", task.ID, "new_task_id", newTaskID, "type", task.Type, "document_id", doc.ID)
+
+	if err := s.inspector.DeleteTask(ctx, task.Queue, task.ID); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+		logger.WarnContext(ctx, "删除已重新入队的原任务失败", "error", err, "task_id", task.ID)
+	}
+	if err := s.failureRepo.ReassignTask(ctx, task.ID, newTaskID); err != nil {
+		logger.WarnContext(ctx, "转移任务失败历史失败", "error", err, "task_id", task.ID, "new_task_id", newTaskID)
+	}
+	if err := s.docRepo.UpdateDocumentStatus(ctx, doc.UserID, doc.ID, entity.TaskStatusPending, &newTaskID, ""); err != nil {
+		// 新任务已经入队，Worker 开始处理时会再次更新文档状态
+		logger.WarnContext(ctx, "重置文档处理状态失败", "error", err, "document_id", doc.ID, "new_task_id", newTaskID)
+	}
+	return newTaskID, nil
+}
+
+// enqueue 根据任务类型用文档的最新信息重新入队。手动重试由用户或管理员触发，进入 interactive 队列。
+func (s *taskAdminServiceImpl) enqueue(ctx context.Context, task *entity.FailedTask, doc *entity.Document) (string, error) {
+	switch task.Type {
+	case entity.TaskTypeEmbedding:
+		return s.taskQueue.EnqueueEmbeddingTask(ctx, entity.NewEmbeddingTaskPayload(doc, doc.ContentType, entity.TaskPriorityInteractive))
+	case entity.TaskTypeOCR:
+		return s.taskQueue.EnqueueOCRTask(ctx, entity.NewEmbeddingTaskPayload(doc, doc.ContentType, entity.TaskPriorityInteractive))
+	case entity.TaskTypeFetchURL:
+		return s.taskQueue.EnqueueFetchURLTask(ctx, &entity.FetchURLTaskPayload{UserID: doc.UserID, DocumentID: doc.ID, Priority: entity.TaskPriorityInteractive})
+	default:
+		return "", apperr.New(apperr.CodeValidation, "不支持重试该类型的任务").WithDetails("type=" + task.Type)
+	}
+}
+
+// DeleteTask 删除失败任务及其失败历史。
+func (s *taskAdminServiceImpl) DeleteTask(ctx context.Context, userID string, taskID string) error {
+	task, err := s.getFailedTask(ctx, userID, taskID)
+	if err != nil {
+		return err
+	}
+	if err := s.inspector.DeleteTask(ctx, task.Queue, task.ID); err != nil {
+		return err
+	}
+	if err := s.failureRepo.DeleteByTaskID(ctx, task.ID); err != nil {
+		logger.WarnContext(ctx, "删除任务失败历史失败", "error", err, "task_id", task.ID)
+	}
+	return nil
+}
+
+// getFailedTask 查找失败任务，并检查用户是否有权访问。其他用户的任务按不存在处理，避免泄露任务 ID。
+func (s *taskAdminServiceImpl) getFailedTask(ctx context.Context, userID string, taskID string) (*entity.FailedTask, error) {
+	task, err := s.inspector.GetFailedTask(ctx, taskID)
+	if err != nil {
+		if userID != "" && apperr.Is(err, apperr.CodeConflict) {
+			// 无法确认任务归属时，不向普通用户透露任务状态
+			return nil, apperr.ErrNotFound("任务未找到")
+		}
+		return nil, err
+	}
+	if userID != "" && task.UserID != userID {
+		logger.WarnContext(ctx, "用户尝试访问不属于自己的任务", "user_id", userID, "task_id", taskID)
+		return nil, apperr.ErrNotFound("任务未找到")
+	}
+	return task, nil
+}
+
+// attachHistory 为任务附加失败历史。
+func (s *taskAdminServiceImpl) attachHistory(ctx context.Context, tasks ...*entity.FailedTask) error {
+	ids := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	history, err := s.failureRepo.ListByTaskIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if failures, ok := history[task.ID]; ok {
+			task.ErrorHistory = failures
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/service" // 引入 service 包以引用接口
+	"github.com/soaringjerry/dreamhub/internal/service/webpage"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+const (
+	userAgent = "DreamHubEventBus/1.0 (+https://github.com/soaringjerry/dreamhub)"
+	// maxResponseBytes 是读取的响应体的最大字节数，响应内容不使用，读取只是为了复用连接。
+	maxResponseBytes = 64 * 1024
+)
+
+// Ensure httpSender implements WebhookSender interface.
+var _ service.WebhookSender = (*httpSender)(nil)
+
+// httpSender 是 WebhookSender 接口基于 net/http 的实现。
+type httpSender struct {
+	client *http.Client
+}
+
+// NewHTTPSender 创建一个新的 webhook 发送器。
+// 与网页抓取器相同，默认拒绝连接回环、内网、链路本地等地址；不跟随重定向，避免绕过地址检查和重复提交。
+func NewHTTPSender(cfg *config.Config) service.WebhookSender {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !cfg.EventWebhookAllowPrivateNetworks {
+		dialer.Control = webpage.RejectBlockedAddress
+	} else {
+		logger.Warn("webhook 投递允许访问内网地址 (EVENT_WEBHOOK_ALLOW_PRIVATE_NETWORKS=true)")
+	}
+	transport := &http.Transport{
+		Proxy:               nil, // 不使用环境变量中的代理，否则地址检查只会作用于代理本身
+		DialContext:         dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        20,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	client := &http.Client{
+		Timeout:   cfg.EventWebhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &httpSender{client: client}
+}
+
+// Send 将 body POST 到 url，并按状态码区分永久失败和临时失败。
+func (s *httpSender) Send(ctx context.Context, url string, header http.Header, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, apperr.Wrap(err, apperr.CodeValidation, "无效的 webhook 地址")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, classifyRequestError(err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	return resp.StatusCode, checkStatus(resp.StatusCode)
+}
+
+// checkStatus 将 HTTP 状态码映射为错误：408、429 和 5xx 可重试 (CodeUnavailable)，
+// 其余非 2xx (包括重定向) 视为 webhook 拒绝了事件。
+func checkStatus(status int) error {
+	switch {
+	case status >= 200 && status < 300:
+		return nil
+	case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500:
+		return apperr.New(apperr.CodeUnavailable, "webhook 暂时不可用").WithDetails(fmt.Sprintf("status=%d", status))
+	default:
+		return apperr.New(apperr.CodeValidation, "webhook 拒绝了事件").WithDetails(fmt.Sprintf("status=%d", status))
+	}
+}
+
+// classifyRequestError 区分永久错误 (被拦截的地址) 与临时错误 (超时、连接失败、DNS 解析失败)。
+func classifyRequestError(err error) error {
+	if errors.Is(err, webpage.ErrBlockedAddress) {
+		return apperr.New(apperr.CodeValidation, "不允许向该地址投递 webhook")
+	}
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return apperr.Wrap(err, apperr.CodeUnavailable, "webhook 请求超时")
+	}
+	return apperr.Wrap(err, apperr.CodeUnavailable, "无法连接 webhook")
+}
@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+)
+
+func TestCheckStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		code   apperr.ErrorCode // 空表示投递成功
+	}{
+		{http.StatusOK, ""},
+		{http.StatusAccepted, ""},
+		{http.StatusNoContent, ""},
+		{http.StatusFound, apperr.CodeValidation}, // 不跟随重定向
+		{http.StatusBadRequest, apperr.CodeValidation},
+		{http.StatusUnauthorized, apperr.CodeValidation},
+		{http.StatusGone, apperr.CodeValidation},
+		{http.StatusRequestTimeout, apperr.CodeUnavailable},
+		{http.StatusTooManyRequests, apperr.CodeUnavailable},
+		{http.StatusInternalServerError, apperr.CodeUnavailable},
+		{http.StatusBadGateway, apperr.CodeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := checkStatus(tt.status)
+			if tt.code == "" {
+				if err != nil {
+					t.Errorf("checkStatus(%d) = %v, want nil", tt.status, err)
+				}
+				return
+			}
+			if !apperr.Is(err, tt.code) {
+				t.Errorf("checkStatus(%d) = %v, want code %s", tt.status, err, tt.code)
+			}
+		})
+	}
+}
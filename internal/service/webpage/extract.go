@@ -0,0 +1,220 @@
+package webpage
+
+import (
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skippedElements 是不包含正文的元素，始终跳过。
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Object: true, atom.Canvas: true,
+	atom.Nav: true, atom.Aside: true, atom.Form: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+}
+
+// blockElements 是前后需要换行的块级元素。
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Header: true, atom.Footer: true, atom.Blockquote: true, atom.Pre: true, atom.Figure: true,
+	atom.Figcaption: true, atom.Ul: true, atom.Ol: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Table: true, atom.Tr: true, atom.Hr: true, atom.Details: true, atom.Summary: true, atom.Address: true,
+}
+
+// headingLevels 将标题元素映射为 Markdown 标题级别。
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// ExtractHTML 解析 HTML 并返回页面标题和可读正文 (也用于提取 HTML 邮件的正文)。
+// 正文优先取自 <article>，其次 <main>，最后是 <body> (此时跳过页眉和页脚)。
+// 标题和列表项分别渲染为 Markdown 的 "#" 和 "- "，以保留结构供分块使用。
+func ExtractHTML(r io.Reader) (title string, text string, err error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", err
+	}
+	if node := findElement(doc, atom.Title); node != nil {
+		title = collapseSpaces(nodeText(node))
+	}
+
+	root, skipChrome := findElement(doc, atom.Article), false
+	if root == nil {
+		root = findElement(doc, atom.Main)
+	}
+	if root == nil {
+		root, skipChrome = findElement(doc, atom.Body), true
+	}
+	if root == nil {
+		root, skipChrome = doc, true
+	}
+
+	w := &textWriter{skipChrome: skipChrome}
+	w.render(root)
+	return title, strings.TrimSpace(w.sb.String()), nil
+}
+
+// findElement 深度优先查找第一个指定类型的元素。
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// nodeText 拼接节点下的所有文本。
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+	}
+	return sb.String()
+}
+
+// collapseSpaces 将连续空白压缩为单个空格。
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// isHidden 判断元素是否被标记为不可见。
+func isHidden(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if strings.EqualFold(attr.Val, "true") {
+				return true
+			}
+		case "style":
+			style := strings.ToLower(strings.ReplaceAll(attr.Val, " ", ""))
+			if strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// textWriter 将 DOM 渲染为纯文本，负责合并空白和插入换行。
+type textWriter struct {
+	sb            strings.Builder
+	skipChrome    bool // 是否跳过 <header>/<footer> (正文取自 <body> 时它们通常是站点导航)
+	preDepth      int  // 位于 <pre> 内部时保留原始空白
+	newlines      int  // 末尾连续换行的数量
+	trailingSpace bool // 最后写入的字符是否为空白
+	pendingSpace  bool // 上一个文本节点以空白结尾，下一个单词前需要空格
+}
+
+// render 递归渲染节点。
+func (w *textWriter) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if w.preDepth > 0 {
+			w.writeRaw(n.Data)
+		} else {
+			w.writeText(n.Data)
+		}
+		return
+	case html.ElementNode:
+		if skippedElements[n.DataAtom] || isHidden(n) {
+			return
+		}
+		if w.skipChrome && (n.DataAtom == atom.Header || n.DataAtom == atom.Footer) {
+			return
+		}
+	case html.DocumentNode:
+	default:
+		return // 注释、doctype 等
+	}
+
+	switch {
+	case n.DataAtom == atom.Br:
+		w.breakLine(1)
+		return
+	case headingLevels[n.DataAtom] > 0:
+		w.breakLine(2)
+		w.writeRaw(strings.Repeat("#", headingLevels[n.DataAtom]) + " ")
+	case n.DataAtom == atom.Li:
+		w.breakLine(1)
+		w.writeRaw("- ")
+	case n.DataAtom == atom.Td || n.DataAtom == atom.Th:
+		w.pendingSpace = true
+	case blockElements[n.DataAtom]:
+		w.breakLine(2)
+	}
+
+	if n.DataAtom == atom.Pre {
+		w.preDepth++
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.render(c)
+	}
+	if n.DataAtom == atom.Pre {
+		w.preDepth--
+	}
+
+	switch {
+	case headingLevels[n.DataAtom] > 0, blockElements[n.DataAtom]:
+		w.breakLine(2)
+	case n.DataAtom == atom.Li:
+		w.breakLine(1)
+	}
+}
+
+// writeText 写入普通文本，压缩其中的空白。
+func (w *textWriter) writeText(s string) {
+	if s == "" {
+		return
+	}
+	if unicode.IsSpace(rune(s[0])) {
+		w.pendingSpace = true
+	}
+	for _, word := range strings.Fields(s) {
+		if w.pendingSpace && !w.trailingSpace && w.sb.Len() > 0 {
+			w.sb.WriteByte(' ')
+		}
+		w.sb.WriteString(word)
+		w.newlines, w.trailingSpace, w.pendingSpace = 0, false, true
+	}
+	w.pendingSpace = unicode.IsSpace(rune(s[len(s)-1]))
+}
+
+// writeRaw 原样写入文本 (用于 <pre> 和 Markdown 标记)。
+func (w *textWriter) writeRaw(s string) {
+	if s == "" {
+		return
+	}
+	w.sb.WriteString(s)
+	trimmed := strings.TrimRight(s, "\n")
+	if trimmed == "" {
+		w.newlines += len(s)
+	} else {
+		w.newlines = len(s) - len(trimmed)
+	}
+	w.trailingSpace = unicode.IsSpace(rune(s[len(s)-1]))
+	w.pendingSpace = false
+}
+
+// breakLine 确保末尾至少有 n 个换行 (1 表示换行，2 表示分段)。
+func (w *textWriter) breakLine(n int) {
+	if w.sb.Len() == 0 {
+		return
+	}
+	for w.newlines < n {
+		w.sb.WriteByte('\n')
+		w.newlines++
+	}
+	w.trailingSpace, w.pendingSpace = true, false
+}
@@ -0,0 +1,236 @@
+package webpage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/soaringjerry/dreamhub/internal/service" // 引入 service 包以引用接口
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	fetchTimeout = 30 * time.Second // 单次抓取 (含重定向和读取响应体) 的总超时
+	maxRedirects = 5
+	userAgent    = "DreamHubFetcher/1.0 (+https://github.com/soaringjerry/dreamhub)"
+	acceptHeader = "text/html,application/xhtml+xml,text/markdown;q=0.9,text/plain;q=0.9,*/*;q=0.1"
+)
+
+var (
+	// ErrBlockedAddress 表示目标地址位于禁止访问的网段 (SSRF 防护)。
+	ErrBlockedAddress = errors.New("目标地址不允许访问")
+	// errInvalidRedirect 表示重定向次数过多或重定向到了不支持的协议。
+	errInvalidRedirect = errors.New("无效的重定向")
+)
+
+// blockedPrefixes 是 net.IP 辅助方法未覆盖、但同样不应从服务端访问的网段。
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "本网络"
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF 协议分配
+	netip.MustParsePrefix("198.18.0.0/15"), // 基准测试
+	netip.MustParsePrefix("240.0.0.0/4"),   // 保留地址
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64，可映射到任意 IPv4 地址
+}
+
+// Ensure httpFetcher implements WebPageFetcher interface.
+var _ service.WebPageFetcher = (*httpFetcher)(nil)
+
+// httpFetcher 是 WebPageFetcher 接口基于 net/http 的实现。
+type httpFetcher struct {
+	client   *http.Client
+	maxBytes int64 // 响应体的最大字节数
+}
+
+// NewHTTPFetcher 创建一个新的网页抓取器。
+// 默认拒绝连接回环、内网、链路本地等地址，检查在建立连接时进行，因此同样适用于重定向和 DNS 重绑定。
+func NewHTTPFetcher(cfg *config.Config) service.WebPageFetcher {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !cfg.URLFetchAllowPrivateNetworks {
+		dialer.Control = RejectBlockedAddress
+	} else {
+		logger.Warn("URL 抓取允许访问内网地址 (URL_FETCH_ALLOW_PRIVATE_NETWORKS=true)")
+	}
+	transport := &http.Transport{
+		Proxy:                 nil, // 不使用环境变量中的代理，否则地址检查只会作用于代理本身
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	}
+	client := &http.Client{
+		Timeout:   fetchTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("%w: 超过 %d 次", errInvalidRedirect, maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: 不支持 %s 协议", errInvalidRedirect, req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return &httpFetcher{client: client, maxBytes: cfg.MaxUploadSizeBytes}
+}
+
+// Fetch 下载页面并提取正文。
+func (f *httpFetcher) Fetch(ctx context.Context, rawURL string) (*service.FetchedPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeValidation, "无效的 URL")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, apperr.New(apperr.CodeValidation, "只支持 http 和 https 协议的 URL")
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", acceptHeader)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, classifyRequestError(ctx, rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp.StatusCode); err != nil {
+		logger.WarnContext(ctx, "抓取 URL 返回非成功状态码", "url", rawURL, "status", resp.StatusCode)
+		return nil, err
+	}
+
+	headerType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(headerType)
+	if err != nil {
+		mediaType = "text/html" // 缺失或无法解析时按 HTML 处理，由解析器容错
+	}
+	if !isSupportedMediaType(mediaType) {
+		logger.WarnContext(ctx, "抓取的 URL 内容类型不受支持", "url", rawURL, "content_type", headerType)
+		return nil, apperr.New(apperr.CodeValidation, "不支持的网页内容类型").WithDetails("content_type=" + mediaType)
+	}
+
+	// 多读 1 字节以判断是否超出上限
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		logger.WarnContext(ctx, "读取 URL 响应体失败", "error", err, "url", rawURL)
+		return nil, apperr.Wrap(err, apperr.CodeUnavailable, "读取网页内容失败")
+	}
+	if int64(len(body)) > f.maxBytes {
+		return nil, apperr.New(apperr.CodeValidation, "网页大小超出上限").
+			WithDetails(fmt.Sprintf("max_upload_size_bytes=%d", f.maxBytes))
+	}
+
+	// 根据 Content-Type 头、BOM 和 <meta charset> 转换为 UTF-8
+	decoded, err := charset.NewReader(bytes.NewReader(body), headerType)
+	if err != nil {
+		return nil, apperr.Wrap(err, apperr.CodeValidation, "无法识别网页字符编码")
+	}
+
+	page := &service.FetchedPage{URL: resp.Request.URL.String(), ContentType: mediaType}
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		page.Title, page.Text, err = ExtractHTML(decoded)
+		if err != nil {
+			return nil, apperr.Wrap(err, apperr.CodeValidation, "无法解析网页 HTML")
+		}
+	} else {
+		text, err := io.ReadAll(decoded)
+		if err != nil {
+			return nil, apperr.Wrap(err, apperr.CodeValidation, "无法解码网页内容")
+		}
+		page.Text = strings.TrimSpace(string(text))
+	}
+	if page.Text == "" {
+		return nil, apperr.New(apperr.CodeValidation, "网页没有可提取的正文内容")
+	}
+
+	logger.InfoContext(ctx, "URL 抓取成功", "url", rawURL, "final_url", page.URL, "bytes", len(body), "text_length", len(page.Text))
+	return page, nil
+}
+
+// isSupportedMediaType 判断是否能从该类型中提取文本。
+func isSupportedMediaType(mediaType string) bool {
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/plain", "text/markdown", "text/x-markdown":
+		return true
+	}
+	return false
+}
+
+// checkStatus 将 HTTP 状态码映射为错误：429 和 5xx 可重试 (CodeUnavailable)，其余非 2xx 视为永久失败。
+func checkStatus(status int) error {
+	switch {
+	case status >= 200 && status < 300:
+		return nil
+	case status == http.StatusTooManyRequests || status >= 500:
+		return apperr.New(apperr.CodeUnavailable, "目标站点暂时不可用").WithDetails(fmt.Sprintf("status=%d", status))
+	default:
+		return apperr.New(apperr.CodeValidation, "目标站点拒绝了请求").WithDetails(fmt.Sprintf("status=%d", status))
+	}
+}
+
+// classifyRequestError 区分永久错误 (被拦截的地址、无效重定向) 与临时错误 (超时、网络故障)。
+func classifyRequestError(ctx context.Context, rawURL string, err error) error {
+	if errors.Is(err, ErrBlockedAddress) {
+		logger.WarnContext(ctx, "拒绝抓取内网地址", "url", rawURL, "error", err)
+		return apperr.New(apperr.CodeValidation, "不允许抓取该地址")
+	}
+	var urlErr interface{ Timeout() bool }
+	if errors.As(err, &urlErr) && urlErr.Timeout() {
+		logger.WarnContext(ctx, "抓取 URL 超时", "url", rawURL, "error", err)
+		return apperr.Wrap(err, apperr.CodeUnavailable, "抓取网页超时")
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return apperr.Wrap(err, apperr.CodeValidation, "无法解析目标域名")
+	}
+	if errors.Is(err, errInvalidRedirect) {
+		return apperr.Wrap(err, apperr.CodeValidation, "网页重定向无效")
+	}
+	logger.WarnContext(ctx, "抓取 URL 失败", "url", rawURL, "error", err)
+	return apperr.Wrap(err, apperr.CodeUnavailable, "抓取网页失败")
+}
+
+// RejectBlockedAddress 是 net.Dialer 的 Control 回调，在建立连接前检查已解析的目标 IP。
+// 其他需要访问用户提供的 URL 的客户端 (例如 webhook 投递) 也使用它防止 SSRF。
+func RejectBlockedAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if isBlockedAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+// isBlockedAddr 判断地址是否属于回环、私有、链路本地、组播等不应从服务端访问的网段。
+func isBlockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap() // ::ffff:127.0.0.1 按 IPv4 处理
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package webpage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/config"
+)
+
+func TestIsBlockedAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true}, // 云厂商的元数据服务
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"100.64.0.1", true},
+		{"198.18.0.1", true},
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::ffff:127.0.0.1", true}, // IPv4 映射的回环地址
+		{"64:ff9b::7f00:1", true},  // NAT64 映射的回环地址
+		{"93.184.216.34", false},
+		{"8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isBlockedAddr(netip.MustParseAddr(tt.addr)); got != tt.blocked {
+				t.Errorf("isBlockedAddr(%s) = %v, want %v", tt.addr, got, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestRejectBlockedAddress(t *testing.T) {
+	if err := RejectBlockedAddress("tcp", "127.0.0.1:80", nil); err == nil {
+		t.Error("RejectBlockedAddress(127.0.0.1:80) = nil, want error")
+	}
+	if err := RejectBlockedAddress("tcp", "[2606:4700:4700::1111]:443", nil); err != nil {
+		t.Errorf("RejectBlockedAddress(public IPv6) = %v, want nil", err)
+	}
+	if err := RejectBlockedAddress("tcp", "example.com:80", nil); err == nil {
+		t.Error("RejectBlockedAddress(unresolved host) = nil, want error")
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		code   apperr.ErrorCode // 空表示没有错误
+	}{
+		{http.StatusOK, ""},
+		{http.StatusNoContent, ""},
+		{http.StatusMovedPermanently, apperr.CodeValidation},
+		{http.StatusNotFound, apperr.CodeValidation},
+		{http.StatusForbidden, apperr.CodeValidation},
+		{http.StatusTooManyRequests, apperr.CodeUnavailable},
+		{http.StatusInternalServerError, apperr.CodeUnavailable},
+		{http.StatusServiceUnavailable, apperr.CodeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := checkStatus(tt.status)
+			if tt.code == "" {
+				if err != nil {
+					t.Errorf("checkStatus(%d) = %v, want nil", tt.status, err)
+				}
+				return
+			}
+			if !apperr.Is(err, tt.code) {
+				t.Errorf("checkStatus(%d) = %v, want code %s", tt.status, err, tt.code)
+			}
+		})
+	}
+}
+
+// newTestFetcher 返回允许访问 httptest 服务器 (回环地址) 的抓取器。
+func newTestFetcher(maxBytes int64) *httpFetcher {
+	return NewHTTPFetcher(&config.Config{URLFetchAllowPrivateNetworks: true, MaxUploadSizeBytes: maxBytes}).(*httpFetcher)
+}
+
+func TestHTTPFetcherFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("User-Agent"); got != userAgent {
+			t.Errorf("User-Agent = %q, want %q", got, userAgent)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title> Release notes </title><script>var x = 1;</script></head>
+<body><nav>Home | Docs</nav><article><h1>Version 2</h1><p>Faster   imports.</p><ul><li>One</li><li>Two</li></ul></article></body></html>`))
+	})
+	mux.HandleFunc("/notes.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("  plain text notes \n"))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/notes.txt", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/busy", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("a", 2048)))
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><script>only()</script></body></html>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	fetcher := newTestFetcher(1024)
+
+	t.Run("html", func(t *testing.T) {
+		page, err := fetcher.Fetch(context.Background(), server.URL+"/article")
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if page.Title != "Release notes" {
+			t.Errorf("Title = %q, want %q", page.Title, "Release notes")
+		}
+		if page.ContentType != "text/html" {
+			t.Errorf("ContentType = %q, want text/html", page.ContentType)
+		}
+		for _, want := range []string{"# Version 2", "Faster imports.", "- One", "- Two"} {
+			if !strings.Contains(page.Text, want) {
+				t.Errorf("Text = %q, want it to contain %q", page.Text, want)
+			}
+		}
+		for _, unwanted := range []string{"var x", "Home | Docs"} {
+			if strings.Contains(page.Text, unwanted) {
+				t.Errorf("Text = %q, should not contain %q", page.Text, unwanted)
+			}
+		}
+	})
+
+	t.Run("redirect to plain text", func(t *testing.T) {
+		page, err := fetcher.Fetch(context.Background(), server.URL+"/moved")
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if page.URL != server.URL+"/notes.txt" {
+			t.Errorf("URL = %q, want the final URL after redirects", page.URL)
+		}
+		if page.Text != "plain text notes" {
+			t.Errorf("Text = %q, want %q", page.Text, "plain text notes")
+		}
+	})
+
+	errorTests := []struct {
+		name string
+		url  string
+		code apperr.ErrorCode
+	}{
+		{"not found", server.URL + "/missing", apperr.CodeValidation},
+		{"unavailable", server.URL + "/busy", apperr.CodeUnavailable},
+		{"unsupported content type", server.URL + "/image.png", apperr.CodeValidation},
+		{"too large", server.URL + "/large", apperr.CodeValidation},
+		{"no text", server.URL + "/empty", apperr.CodeValidation},
+		{"unsupported scheme", "ftp://example.com/file", apperr.CodeValidation},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fetcher.Fetch(context.Background(), tt.url)
+			if !apperr.Is(err, tt.code) {
+				t.Errorf("Fetch(%s) error = %v, want code %s", tt.url, err, tt.code)
+			}
+		})
+	}
+}
+
+func TestHTTPFetcherRejectsPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the fetcher connected to a loopback address")
+	}))
+	defer server.Close()
+
+	fetcher := NewHTTPFetcher(&config.Config{MaxUploadSizeBytes: 1024})
+	_, err := fetcher.Fetch(context.Background(), server.URL)
+	if !apperr.Is(err, apperr.CodeValidation) {
+		t.Errorf("Fetch(loopback) error = %v, want code %s", err, apperr.CodeValidation)
+	}
+}
@@ -22,15 +22,26 @@ func deriveKey(secret string) []byte {
 // The secret is first derived into a 32-byte key using SHA-256.
 // The returned byte slice contains the nonce prefixed to the ciphertext.
 func EncryptString(plaintext string, secret string) ([]byte, error) {
-	key := deriveKey(secret)
-	block, err := aes.NewCipher(key)
+	return EncryptBytes([]byte(plaintext), secret)
+}
+
+// DecryptString decrypts a byte slice (nonce + ciphertext) using AES-GCM with the provided secret.
+// The secret is first derived into a 32-byte key using SHA-256.
+func DecryptString(ciphertext []byte, secret string) (string, error) {
+	plaintext, err := DecryptBytes(ciphertext, secret)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		return "", err
 	}
+	return string(plaintext), nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// EncryptBytes encrypts arbitrary bytes using AES-GCM with the provided secret.
+// It is used both for API keys (via EncryptString) and for wrapping per-file data keys.
+// The returned byte slice contains the nonce prefixed to the ciphertext.
+func EncryptBytes(plaintext []byte, secret string) ([]byte, error) {
+	gcm, err := newGCM(deriveKey(secret))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM cipher: %w", err)
+		return nil, err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
@@ -42,27 +53,20 @@ func EncryptString(plaintext string, secret string) ([]byte, error) {
 	// additional data and appends the result to dst, returning the updated
 	// slice. The nonce must be NonceSize() bytes long and unique for all
 	// time, for a given key.
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
 	return ciphertext, nil
 }
 
-// DecryptString decrypts a byte slice (nonce + ciphertext) using AES-GCM with the provided secret.
-// The secret is first derived into a 32-byte key using SHA-256.
-func DecryptString(ciphertext []byte, secret string) (string, error) {
-	key := deriveKey(secret)
-	block, err := aes.NewCipher(key)
+// DecryptBytes decrypts a byte slice (nonce + ciphertext) produced by EncryptBytes.
+func DecryptBytes(ciphertext []byte, secret string) ([]byte, error) {
+	gcm, err := newGCM(deriveKey(secret))
 	if err != nil {
-		return "", fmt.Errorf("failed to create AES cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GCM cipher: %w", err)
+		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
-		return "", errors.New("ciphertext too short")
+		return nil, errors.New("ciphertext too short")
 	}
 
 	nonce, encryptedMessage := ciphertext[:nonceSize], ciphertext[nonceSize:]
@@ -77,10 +81,24 @@ func DecryptString(ciphertext []byte, secret string) (string, error) {
 		// It's important not to reveal specific crypto errors to the outside world usually,
 		// but for internal debugging, logging the error might be useful.
 		// For user-facing errors, a generic "decryption failed" is often better.
-		return "", fmt.Errorf("failed to decrypt data: %w", err)
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
 	}
 
-	return string(plaintext), nil
+	return plaintext, nil
+}
+
+// newGCM creates an AES-GCM AEAD for the given 16/24/32-byte key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM cipher: %w", err)
+	}
+	return gcm, nil
 }
 
 // EncryptStringHex is a convenience function that encrypts and returns hex-encoded string.
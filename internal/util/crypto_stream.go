@@ -0,0 +1,360 @@
+package util
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Streaming encryption format used for files at rest:
+//
+//	header:  magic (4 bytes "DHE1") | nonce prefix (8 bytes)
+//	segment: ciphertext length (uint32 big-endian) | AES-GCM ciphertext
+//
+// Each segment encrypts up to StreamSegmentSize bytes of plaintext. The nonce of
+// segment i is nonce prefix || uint32(i), and the additional data marks whether
+// the segment is the last one, so truncation and reordering are both detected.
+const (
+	// StreamSegmentSize is the plaintext size of each encrypted segment.
+	StreamSegmentSize = 64 * 1024
+
+	streamMagic      = "DHE1"
+	streamPrefixSize = 8
+	streamHeaderSize = len(streamMagic) + streamPrefixSize
+)
+
+var (
+	streamADMiddle = []byte{0x00}
+	streamADFinal  = []byte{0x01}
+)
+
+// NewDataKey generates a random 32-byte key suitable for EncryptStream.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// EncryptStream reads plaintext from src, encrypts it with key in fixed-size
+// segments and writes the result to dst. It returns the number of plaintext bytes read.
+func EncryptStream(dst io.Writer, src io.Reader, key []byte) (int64, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, streamHeaderSize)
+	copy(header, streamMagic)
+	if _, err := io.ReadFull(rand.Reader, header[len(streamMagic):]); err != nil {
+		return 0, fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+	if _, err := dst.Write(header); err != nil {
+		return 0, fmt.Errorf("failed to write stream header: %w", err)
+	}
+	prefix := header[len(streamMagic):]
+
+	buf := make([]byte, StreamSegmentSize)
+	sealed := make([]byte, 0, StreamSegmentSize+gcm.Overhead())
+	var lenBuf [4]byte
+	var total int64
+	for counter := uint32(0); ; counter++ {
+		n, readErr := io.ReadFull(src, buf)
+		final := false
+		switch {
+		case readErr == io.EOF || readErr == io.ErrUnexpectedEOF:
+			final = true
+		case readErr != nil:
+			return total, fmt.Errorf("failed to read plaintext: %w", readErr)
+		}
+		total += int64(n)
+
+		ad := streamADMiddle
+		if final {
+			ad = streamADFinal
+		}
+		sealed = gcm.Seal(sealed[:0], segmentNonce(prefix, counter), buf[:n], ad)
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(sealed)))
+		if _, err := dst.Write(lenBuf[:]); err != nil {
+			return total, fmt.Errorf("failed to write segment length: %w", err)
+		}
+		if _, err := dst.Write(sealed); err != nil {
+			return total, fmt.Errorf("failed to write segment: %w", err)
+		}
+		if final {
+			return total, nil
+		}
+		if counter == ^uint32(0) {
+			return total, errors.New("stream too large to encrypt")
+		}
+	}
+}
+
+// decryptingReader 按段解密 EncryptStream 写出的数据。
+type decryptingReader struct {
+	src     io.Reader
+	gcm     cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte // 当前段解密后尚未读取的明文
+	plain   []byte
+	sealed  []byte
+	done    bool
+}
+
+// NewDecryptingReader returns a reader yielding the plaintext of a stream written by EncryptStream.
+// Authentication failures, truncation and trailing data are reported as errors from Read.
+func NewDecryptingReader(src io.Reader, key []byte) (io.Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+	if string(header[:len(streamMagic)]) != streamMagic {
+		return nil, errors.New("invalid encrypted stream header")
+	}
+	return &decryptingReader{
+		src:    src,
+		gcm:    gcm,
+		prefix: header[len(streamMagic):],
+	}, nil
+}
+
+// Read implements io.Reader.
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.nextSegment(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *decryptingReader) nextSegment() error {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r.src, lenBuf[:]); err != nil {
+		if err == io.EOF {
+			return errors.New("encrypted stream truncated")
+		}
+		return fmt.Errorf("failed to read segment length: %w", err)
+	}
+	size := binary.BigEndian.Uint32(lenBuf[:])
+	if size < uint32(r.gcm.Overhead()) || size > uint32(StreamSegmentSize+r.gcm.Overhead()) {
+		return errors.New("invalid encrypted segment length")
+	}
+	if cap(r.sealed) < int(size) {
+		r.sealed = make([]byte, size)
+	}
+	r.sealed = r.sealed[:size]
+	if _, err := io.ReadFull(r.src, r.sealed); err != nil {
+		return fmt.Errorf("failed to read encrypted segment: %w", err)
+	}
+
+	nonce := segmentNonce(r.prefix, r.counter)
+	// 注意：解密失败时 Open 会清空 dst，因此不能原地解密
+	plain, err := r.gcm.Open(r.plain[:0], nonce, r.sealed, streamADMiddle)
+	if err != nil {
+		plain, err = r.gcm.Open(r.plain[:0], nonce, r.sealed, streamADFinal)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt segment %d: %w", r.counter, err)
+		}
+		r.done = true
+		// 最后一段之后不应再有数据
+		var extra [1]byte
+		if n, _ := r.src.Read(extra[:]); n > 0 {
+			return errors.New("unexpected data after final encrypted segment")
+		}
+	}
+	r.plain = plain
+	r.buf = plain
+	r.counter++
+	return nil
+}
+
+// DecryptingReadSeeker gives random access to the plaintext of a stream written by EncryptStream.
+type DecryptingReadSeeker interface {
+	io.ReadSeeker
+	io.ReaderAt
+	// Size returns the plaintext size of the stream.
+	Size() int64
+}
+
+// seekableDecryptingReader 根据段的固定大小直接定位到包含目标偏移的段，只解密需要的段。
+type seekableDecryptingReader struct {
+	mu       sync.Mutex
+	src      io.ReadSeeker
+	gcm      cipher.AEAD
+	prefix   []byte
+	size     int64  // 明文总大小
+	lastSeg  int64  // 最后一段的序号
+	lastLen  int64  // 最后一段的明文长度
+	pos      int64  // Read/Seek 的当前位置
+	cacheSeg int64  // plain 对应的段序号，-1 表示没有缓存
+	plain    []byte // 最近解密的一段明文
+	sealed   []byte
+}
+
+// NewSeekableDecryptingReader returns a DecryptingReadSeeker over a stream written by EncryptStream.
+// Every segment except the last holds exactly StreamSegmentSize bytes of plaintext, so the
+// plaintext size and the position of each segment follow from the ciphertext size alone.
+// Each segment is authenticated when it is read; a truncated or modified stream is reported
+// as an error from Read or ReadAt. Callers must not use src concurrently.
+func NewSeekableDecryptingReader(src io.ReadSeeker, key []byte) (DecryptingReadSeeker, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	total, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine encrypted stream size: %w", err)
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind encrypted stream: %w", err)
+	}
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+	if string(header[:len(streamMagic)]) != streamMagic {
+		return nil, errors.New("invalid encrypted stream header")
+	}
+
+	fullSeg := int64(4 + StreamSegmentSize + gcm.Overhead())
+	body := total - int64(streamHeaderSize)
+	lastSeg, rem := body/fullSeg, body%fullSeg
+	lastLen := rem - int64(4+gcm.Overhead())
+	if lastLen < 0 {
+		return nil, errors.New("encrypted stream truncated")
+	}
+	return &seekableDecryptingReader{
+		src:      src,
+		gcm:      gcm,
+		prefix:   header[len(streamMagic):],
+		size:     lastSeg*StreamSegmentSize + lastLen,
+		lastSeg:  lastSeg,
+		lastLen:  lastLen,
+		cacheSeg: -1,
+	}, nil
+}
+
+// Size implements DecryptingReadSeeker.
+func (r *seekableDecryptingReader) Size() int64 {
+	return r.size
+}
+
+// Read implements io.Reader.
+func (r *seekableDecryptingReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err := r.readAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *seekableDecryptingReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *seekableDecryptingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readAt(p, off)
+}
+
+func (r *seekableDecryptingReader) readAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		seg := off / StreamSegmentSize
+		if err := r.loadSegment(seg); err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], r.plain[off-seg*StreamSegmentSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// loadSegment 解密序号为 seg 的段并缓存其明文。
+func (r *seekableDecryptingReader) loadSegment(seg int64) error {
+	if seg == r.cacheSeg {
+		return nil
+	}
+	plainLen, ad := int64(StreamSegmentSize), streamADMiddle
+	if seg == r.lastSeg {
+		plainLen, ad = r.lastLen, streamADFinal
+	}
+	fullSeg := int64(4 + StreamSegmentSize + r.gcm.Overhead())
+	if _, err := r.src.Seek(int64(streamHeaderSize)+seg*fullSeg, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to segment %d: %w", seg, err)
+	}
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r.src, lenBuf[:]); err != nil {
+		return fmt.Errorf("failed to read segment length: %w", err)
+	}
+	size := int64(binary.BigEndian.Uint32(lenBuf[:]))
+	if size != plainLen+int64(r.gcm.Overhead()) {
+		return errors.New("invalid encrypted segment length")
+	}
+	if int64(cap(r.sealed)) < size {
+		r.sealed = make([]byte, size)
+	}
+	r.sealed = r.sealed[:size]
+	if _, err := io.ReadFull(r.src, r.sealed); err != nil {
+		return fmt.Errorf("failed to read encrypted segment: %w", err)
+	}
+	r.cacheSeg = -1
+	plain, err := r.gcm.Open(r.plain[:0], segmentNonce(r.prefix, uint32(seg)), r.sealed, ad)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt segment %d: %w", seg, err)
+	}
+	r.plain = plain
+	r.cacheSeg = seg
+	return nil
+}
+
+func segmentNonce(prefix []byte, counter uint32) []byte {
+	nonce := make([]byte, streamPrefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	return nonce
+}
@@ -0,0 +1,165 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+// streamTestSizes covers empty input, partial segments, exact segment boundaries and multiple segments.
+var streamTestSizes = []int{0, 1, StreamSegmentSize - 1, StreamSegmentSize, StreamSegmentSize + 1, 3*StreamSegmentSize + 123}
+
+func newTestDataKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatalf("NewDataKey() error = %v", err)
+	}
+	return key
+}
+
+// encryptTestStream returns random plaintext of the given size and its encrypted form.
+func encryptTestStream(t *testing.T, key []byte, size int) ([]byte, []byte) {
+	t.Helper()
+	plain := make([]byte, size)
+	if _, err := rand.Read(plain); err != nil {
+		t.Fatal(err)
+	}
+	var sealed bytes.Buffer
+	n, err := EncryptStream(&sealed, bytes.NewReader(plain), key)
+	if err != nil {
+		t.Fatalf("EncryptStream() error = %v", err)
+	}
+	if n != int64(size) {
+		t.Fatalf("EncryptStream() = %d, want %d", n, size)
+	}
+	return plain, sealed.Bytes()
+}
+
+func TestEncryptStreamRoundTrip(t *testing.T) {
+	key := newTestDataKey(t)
+	for _, size := range streamTestSizes {
+		plain, sealed := encryptTestStream(t, key, size)
+
+		r, err := NewDecryptingReader(bytes.NewReader(sealed), key)
+		if err != nil {
+			t.Fatalf("size %d: NewDecryptingReader() error = %v", size, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: read error = %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: decrypted plaintext does not match", size)
+		}
+	}
+}
+
+func TestDecryptingReaderRejectsInvalidStreams(t *testing.T) {
+	key := newTestDataKey(t)
+	_, sealed := encryptTestStream(t, key, 2*StreamSegmentSize+10)
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 0xff
+	truncated := sealed[:len(sealed)-(StreamSegmentSize/2)]
+	// Dropping the final segment leaves a stream whose last segment is not marked final.
+	withoutFinal := sealed[:streamHeaderSize+2*(4+StreamSegmentSize+16)]
+
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed []byte
+	}{
+		{"wrong key", newTestDataKey(t), sealed},
+		{"tampered", key, tampered},
+		{"truncated segment", key, truncated},
+		{"missing final segment", key, withoutFinal},
+		{"bad header", key, append([]byte("NOPE"), sealed[4:]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewDecryptingReader(bytes.NewReader(tt.sealed), tt.key)
+			if err == nil {
+				_, err = io.ReadAll(r)
+			}
+			if err == nil {
+				t.Error("decryption succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestSeekableDecryptingReader(t *testing.T) {
+	key := newTestDataKey(t)
+	for _, size := range streamTestSizes {
+		plain, sealed := encryptTestStream(t, key, size)
+
+		r, err := NewSeekableDecryptingReader(bytes.NewReader(sealed), key)
+		if err != nil {
+			t.Fatalf("size %d: NewSeekableDecryptingReader() error = %v", size, err)
+		}
+		if r.Size() != int64(size) {
+			t.Errorf("size %d: Size() = %d", size, r.Size())
+		}
+
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: read error = %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: sequential read does not match", size)
+		}
+
+		// Ranges that start and end inside, at and across segment boundaries.
+		for _, rng := range [][2]int{
+			{0, 1},
+			{size / 2, size},
+			{StreamSegmentSize - 3, StreamSegmentSize + 3},
+			{StreamSegmentSize, 2 * StreamSegmentSize},
+			{1, 3*StreamSegmentSize + 5},
+		} {
+			start, end := min(rng[0], size), min(rng[1], size)
+			buf := make([]byte, end-start)
+			n, err := r.ReadAt(buf, int64(start))
+			if err != nil && !(err == io.EOF && end == size) {
+				t.Fatalf("size %d: ReadAt(%d) error = %v", size, start, err)
+			}
+			if n != end-start || !bytes.Equal(buf, plain[start:end]) {
+				t.Errorf("size %d: ReadAt(%d, len %d) returned the wrong bytes", size, start, end-start)
+			}
+		}
+
+		if size == 0 {
+			continue
+		}
+		offset := int64(size - size/3)
+		if pos, err := r.Seek(-int64(size/3), io.SeekEnd); err != nil || pos != offset {
+			t.Fatalf("size %d: Seek() = %d, %v, want %d", size, pos, err, offset)
+		}
+		got, err = io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: read after seek error = %v", size, err)
+		}
+		if !bytes.Equal(got, plain[offset:]) {
+			t.Errorf("size %d: read after seek does not match", size)
+		}
+	}
+}
+
+func TestSeekableDecryptingReaderRejectsInvalidStreams(t *testing.T) {
+	key := newTestDataKey(t)
+	_, sealed := encryptTestStream(t, key, StreamSegmentSize+10)
+
+	if _, err := NewSeekableDecryptingReader(bytes.NewReader(sealed[:streamHeaderSize+3]), key); err == nil {
+		t.Error("NewSeekableDecryptingReader(truncated) = nil error, want error")
+	}
+
+	r, err := NewSeekableDecryptingReader(bytes.NewReader(sealed), newTestDataKey(t))
+	if err != nil {
+		t.Fatalf("NewSeekableDecryptingReader() error = %v", err)
+	}
+	if _, err := r.ReadAt(make([]byte, 1), StreamSegmentSize); err == nil {
+		t.Error("ReadAt() with the wrong key succeeded, want error")
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// ConversationImportTaskHandler 处理 conversation:import_chatgpt 任务，从上传的 ChatGPT 导出文件中导入对话。
+type ConversationImportTaskHandler struct {
+	transfer service.ConversationTransferService
+}
+
+// NewConversationImportTaskHandler 创建一个新的 ConversationImportTaskHandler 实例。
+func NewConversationImportTaskHandler(transfer service.ConversationTransferService) *ConversationImportTaskHandler {
+	return &ConversationImportTaskHandler{
+		transfer: transfer,
+	}
+}
+
+// ProcessTask 实现 asynq.Handler 接口。导入结果写入任务结果，供 API 查询。
+func (h *ConversationImportTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var payload entity.ConversationImportTaskPayload
+	if err := decodePayload(ctx, t, &payload); err != nil {
+		return err
+	}
+
+	report, err := h.transfer.ImportChatGPT(ctx, &payload)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeValidation) {
+			// 文件无法解析，重试无意义
+			logger.WarnContext(ctx, "导入文件无效，跳过重试", "user_id", payload.UserID, "filename", payload.Filename, "error", err)
+			return fmt.Errorf("导入对话失败 (filename=%s): %w: %w", payload.Filename, err, asynq.SkipRetry)
+		}
+		return fmt.Errorf("导入对话失败 (filename=%s): %w", payload.Filename, err)
+	}
+
+	result, err := json.Marshal(report)
+	if err != nil {
+		logger.ErrorContext(ctx, "序列化导入结果失败", "error", err)
+		return nil // 对话已经导入，不因结果无法记录而重试
+	}
+	if _, err := t.ResultWriter().Write(result); err != nil {
+		logger.WarnContext(ctx, "写入导入结果失败", "error", err, "user_id", payload.UserID)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// ConversationTitleTaskHandler 处理 conversation:generate_title 任务，具体逻辑由 ConversationTitleService 实现。
+type ConversationTitleTaskHandler struct {
+	titler service.ConversationTitleService
+}
+
+// NewConversationTitleTaskHandler 创建一个新的 ConversationTitleTaskHandler 实例。
+func NewConversationTitleTaskHandler(titler service.ConversationTitleService) *ConversationTitleTaskHandler {
+	return &ConversationTitleTaskHandler{
+		titler: titler,
+	}
+}
+
+// ProcessTask 实现 asynq.Handler 接口。
+func (h *ConversationTitleTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var payload entity.ConversationTitleTaskPayload
+	if err := decodePayload(ctx, t, &payload); err != nil {
+		return err
+	}
+
+	title, updated, err := h.titler.GenerateTitle(ctx, &payload)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			// 对话在任务执行前已被删除，无需重试
+			logger.InfoContext(ctx, "对话不存在，跳过生成标题", "conversation_id", payload.ConversationID)
+			return nil
+		}
+		return fmt.Errorf("生成对话标题失败 (conversation_id=%s): %w", payload.ConversationID, err)
+	}
+
+	if updated {
+		if _, err := t.ResultWriter().Write([]byte(title)); err != nil {
+			logger.WarnContext(ctx, "写入标题任务结果失败", "error", err, "conversation_id", payload.ConversationID)
+		}
+	}
+	return nil
+}
@@ -2,9 +2,9 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 
 	// Import strings
 
@@ -13,20 +13,20 @@ import (
 	"github.com/soaringjerry/dreamhub/internal/entity"
 	"github.com/soaringjerry/dreamhub/internal/repository"
 	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/internal/service/importer"
 	"github.com/soaringjerry/dreamhub/pkg/apperr"  // Import apperr
 	"github.com/soaringjerry/dreamhub/pkg/ctxutil" // Import ctxutil
 	"github.com/soaringjerry/dreamhub/pkg/logger"
 	"github.com/tmc/langchaingo/textsplitter" // Import textsplitter
 )
 
-// EmbeddingTaskPayload 定义了 embedding:generate 任务的 payload 结构。
-type EmbeddingTaskPayload struct {
-	UserID     string `json:"user_id"`
-	DocumentID string `json:"document_id"` // UUID as string
-	// TaskID      string `json:"task_id"` // REMOVED: TaskID should be obtained from task context if needed, not payload.
-	FilePath    string `json:"file_path"`
-	Filename    string `json:"filename"`
-	ContentType string `json:"content_type"`
+// embeddingBatchSize 是单次调用 Embedding API 的最大文本块数量。
+const embeddingBatchSize = 100
+
+// chunkInput 是待生成 Embedding 的文本块及其元数据。
+type chunkInput struct {
+	content  string
+	metadata map[string]any
 }
 
 // EmbeddingTaskHandler 处理文件 Embedding 任务。
@@ -37,6 +37,11 @@ type EmbeddingTaskHandler struct {
 	taskRepo      repository.TaskRepository // Optional: for detailed task status updates
 	embedProvider service.EmbeddingProvider
 	textSplitter  textsplitter.TextSplitter // Add text splitter field
+	importers     []service.MessageImporter // 邮件/聊天导出的解析器，匹配的文件按消息分块
+	pdfExtractor  service.PDFTextExtractor  // Optional: nil 时 PDF 直接交给 OCR
+	ocrQueue      service.TaskQueueClient   // Optional: nil 表示未启用 OCR
+	graph         service.GraphRecorder     // Optional: nil 表示不记录图记忆
+	events        service.EventPublisher    // Optional: nil 表示不发布 dreamhub.document.indexed 事件
 }
 
 // NewEmbeddingTaskHandler 创建一个新的 EmbeddingTaskHandler 实例。
@@ -47,6 +52,11 @@ func NewEmbeddingTaskHandler(
 	tr repository.TaskRepository, // Can be nil if not updating Task entity
 	ep service.EmbeddingProvider,
 	ts textsplitter.TextSplitter, // Accept text splitter in constructor
+	importers []service.MessageImporter, // Can be nil: all files are split as plain text
+	pe service.PDFTextExtractor, // Can be nil: PDFs are always sent to OCR
+	oq service.TaskQueueClient, // Can be nil: OCR is disabled
+	gr service.GraphRecorder, // Can be nil: indexed documents are not recorded in the graph memory
+	ev service.EventPublisher, // Can be nil: no events are published
 ) *EmbeddingTaskHandler {
 	return &EmbeddingTaskHandler{
 		fileStorage:   fs,
@@ -55,24 +65,21 @@ func NewEmbeddingTaskHandler(
 		taskRepo:      tr,
 		embedProvider: ep,
 		textSplitter:  ts, // Store text splitter
+		importers:     importers,
+		pdfExtractor:  pe,
+		ocrQueue:      oq,
+		graph:         gr,
+		events:        ev,
 	}
 }
 
 // ProcessTask 实现 asynq.Handler 接口。
 func (h *EmbeddingTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
-	var payload EmbeddingTaskPayload
-	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		logger.ErrorContext(ctx, "无法解析 Embedding 任务 payload", "error", err, "payload", string(t.Payload()))
-		// 返回错误，但不重试，因为 payload 格式错误
-		return fmt.Errorf("无效的任务 payload: %w", err) // No retry for invalid payload
+	var payload entity.EmbeddingTaskPayload
+	if err := decodePayload(ctx, t, &payload); err != nil {
+		return err // 不重试，任务进入死信队列
 	}
-
-	// docID is now string, no need to parse. Use payload.DocumentID directly.
 	docID := payload.DocumentID
-	if docID == "" { // Add basic validation
-		logger.ErrorContext(ctx, "任务 payload 中缺少 document_id", "payload", string(t.Payload()))
-		return fmt.Errorf("无效的任务 payload: 缺少 document_id") // No retry
-	}
 
 	// 使用 payload 中的 user_id 设置上下文，以便后续操作使用
 	taskCtx := context.WithValue(ctx, ctxutil.UserIDKey, payload.UserID) // Use ctxutil after importing
@@ -112,70 +119,92 @@ func (h *EmbeddingTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) e
 		h.markDocumentAsFailed(taskCtx, docID, "读取文件内容失败") // Pass string docID
 		return fmt.Errorf("读取文件内容失败: %w", err)             // Retry might help
 	}
-	fileContent := string(fileContentBytes)
 	logger.InfoContext(taskCtx, "文件内容读取成功", "document_id", docID, "size", len(fileContentBytes))
 
-	// 2. 文本分块
-	// Use the injected text splitter
-	chunksContent, err := h.textSplitter.SplitText(fileContent) // Remove taskCtx argument
+	// 2. 提取文本：图片和没有文本层的 PDF (扫描件) 交给独立的 OCR 任务处理
+	content, needsOCR := h.extractText(taskCtx, &payload, fileContentBytes)
+	if needsOCR {
+		return h.enqueueOCR(taskCtx, &payload)
+	}
+
+	// 3. 文本分块 (邮件归档、聊天导出等按消息分块并附带元数据)
+	chunks, err := h.splitContent(taskCtx, payload.Filename, content)
 	if err != nil {
 		logger.ErrorContext(taskCtx, "文本分块失败", "error", err, "document_id", docID)
 		h.markDocumentAsFailed(taskCtx, docID, "文本分块失败") // Pass string docID
 		return fmt.Errorf("文本分块失败: %w", err)             // Consider retry? Depends on splitter error type.
 	}
-	if len(chunksContent) == 0 {
+	return h.saveChunks(taskCtx, &payload, chunks, "文件内容为空")
+}
+
+// saveChunks 为文本块生成 Embedding，保存到 VectorRepository 并将文档标记为完成。
+// chunks 为空时直接将文档标记为完成，emptyMessage 记录在文档的错误信息中。
+// ctx 中需要包含 UserID (markDocumentAsFailed 依赖它)。
+func (h *EmbeddingTaskHandler) saveChunks(taskCtx context.Context, payload *entity.EmbeddingTaskPayload, chunks []chunkInput, emptyMessage string) error {
+	docID := payload.DocumentID
+	if len(chunks) == 0 {
 		logger.WarnContext(taskCtx, "文件分块后内容为空", "document_id", docID, "filename", payload.Filename)
 		// 文件内容为空，标记为完成
 		// Pass string docID, userID. Pass nil for taskID.
-		errMsgEmpty := "文件内容为空"
-		if err := h.docRepo.UpdateDocumentStatus(taskCtx, payload.UserID, docID, entity.TaskStatusCompleted, nil, errMsgEmpty); err != nil {
+		if err := h.docRepo.UpdateDocumentStatus(taskCtx, payload.UserID, docID, entity.TaskStatusCompleted, nil, emptyMessage); err != nil {
 			logger.ErrorContext(taskCtx, "更新空文件状态为 Completed 失败", "error", err, "document_id", docID)
 			return fmt.Errorf("更新空文件状态失败: %w", err)
 		}
+		h.recordDocumentIndexed(taskCtx, payload, 0)
+		h.publishDocumentIndexed(taskCtx, payload, 0)
 		return nil // No chunks to process
 	}
-	logger.InfoContext(taskCtx, "文本分块完成", "document_id", docID, "chunk_count", len(chunksContent))
+	logger.InfoContext(taskCtx, "文本分块完成", "document_id", docID, "chunk_count", len(chunks))
 
-	// 3. 生成 Embeddings
-	// TODO: 处理大量 chunks 的情况，可能需要分批调用 Embedding API
-	embeddings, err := h.embedProvider.CreateEmbeddings(taskCtx, chunksContent)
-	if err != nil {
-		logger.ErrorContext(taskCtx, "生成 Embeddings 失败", "error", err, "document_id", docID)
-		h.markDocumentAsFailed(taskCtx, docID, "生成 Embeddings 失败") // Pass string docID
-		// 根据错误类型决定是否重试 (e.g., rate limit vs invalid input)
-		if apperr.Is(err, apperr.CodeRateLimited) || apperr.Is(err, apperr.CodeUnavailable) {
-			return fmt.Errorf("生成 Embeddings 失败 (可重试): %w", err)
+	// 4. 生成 Embeddings (分批调用 Embedding API)
+	chunksContent := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		chunksContent[i] = chunk.content
+	}
+	embeddings := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunksContent); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(chunksContent))
+		batch, err := h.embedProvider.CreateEmbeddings(taskCtx, chunksContent[start:end])
+		if err != nil {
+			logger.ErrorContext(taskCtx, "生成 Embeddings 失败", "error", err, "document_id", docID, "batch_start", start)
+			h.markDocumentAsFailed(taskCtx, docID, "生成 Embeddings 失败") // Pass string docID
+			// 根据错误类型决定是否重试 (e.g., rate limit vs invalid input)
+			if apperr.Is(err, apperr.CodeRateLimited) || apperr.Is(err, apperr.CodeUnavailable) {
+				return fmt.Errorf("生成 Embeddings 失败 (可重试): %w", err)
+			}
+			return fmt.Errorf("生成 Embeddings 失败 (不可重试): %w", err) // No retry for potentially permanent errors
 		}
-		return fmt.Errorf("生成 Embeddings 失败 (不可重试): %w", err) // No retry for potentially permanent errors
+		embeddings = append(embeddings, batch...)
+	}
+	if len(embeddings) != len(chunks) {
+		logger.ErrorContext(taskCtx, "Embedding 数量与块数量不一致", "document_id", docID, "chunk_count", len(chunks), "embedding_count", len(embeddings))
+		h.markDocumentAsFailed(taskCtx, docID, "Embedding 数量不匹配")
+		return fmt.Errorf("Embedding 数量不匹配 (预期 %d, 得到 %d)", len(chunks), len(embeddings))
 	}
 	logger.InfoContext(taskCtx, "Embeddings 生成成功", "document_id", docID, "embedding_count", len(embeddings))
 
-	// 4. 创建 DocumentChunk 实体
-	docChunks := make([]*entity.DocumentChunk, len(chunksContent))
+	// 5. 创建 DocumentChunk 实体
+	docChunks := make([]*entity.DocumentChunk, len(chunks))
 	embeddingDim := h.embedProvider.GetEmbeddingDimension()
-	for i, content := range chunksContent {
+	for i, chunk := range chunks {
 		if len(embeddings[i]) != embeddingDim {
 			errMsg := fmt.Sprintf("块 %d 的 Embedding 维度不匹配 (预期 %d, 得到 %d)", i, embeddingDim, len(embeddings[i]))
 			logger.ErrorContext(taskCtx, errMsg, "document_id", docID)
 			h.markDocumentAsFailed(taskCtx, docID, "Embedding 维度不匹配") // Pass string docID
 			return fmt.Errorf(errMsg)                                 // No retry
 		}
-		// 创建元数据
-		metadata := map[string]any{
-			// "page_number": ... // 如果能从分块器获取
-		}
 		// Pass string docID to NewDocumentChunk
 		docChunks[i] = entity.NewDocumentChunk(
 			docID,
 			payload.UserID,
 			i, // chunk index
-			content,
+			chunk.content,
 			pgvector.NewVector(embeddings[i]),
-			metadata,
+			chunk.metadata,
 		)
 	}
 
-	// 5. 批量保存 Chunks 到 VectorRepository
+	// 6. 批量保存 Chunks 到 VectorRepository
 	if err := h.vectorRepo.AddChunks(taskCtx, docChunks); err != nil {
 		logger.ErrorContext(taskCtx, "保存向量块到数据库失败", "error", err, "document_id", docID)
 		h.markDocumentAsFailed(taskCtx, docID, "保存向量数据失败") // Pass string docID
@@ -184,7 +213,7 @@ func (h *EmbeddingTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) e
 	}
 	logger.InfoContext(taskCtx, "向量块保存成功", "document_id", docID, "chunk_count", len(docChunks))
 
-	// 6. 更新文档状态为 Completed
+	// 7. 更新文档状态为 Completed
 	// Pass string docID, userID. Pass nil for taskID.
 	if err := h.docRepo.UpdateDocumentStatus(taskCtx, payload.UserID, docID, entity.TaskStatusCompleted, nil, ""); err != nil {
 		logger.ErrorContext(taskCtx, "更新文档状态为 Completed 失败", "error", err, "document_id", docID)
@@ -192,15 +221,38 @@ func (h *EmbeddingTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) e
 		return fmt.Errorf("更新最终文档状态失败: %w", err) // Retry
 	}
 
-	// 7. (可选) 更新 Task 实体状态
+	// 8. (可选) 更新 Task 实体状态
 	if h.taskRepo != nil {
 		// TODO: Update Task entity status if needed
 	}
 
+	h.recordDocumentIndexed(taskCtx, payload, len(docChunks))
+	h.publishDocumentIndexed(taskCtx, payload, len(docChunks))
 	logger.InfoContext(taskCtx, "Embedding 任务成功完成", "document_id", docID, "filename", payload.Filename)
 	return nil // 任务成功完成
 }
 
+// recordDocumentIndexed 将处理完成的文档记录到图记忆。图记忆不影响文档处理，记录失败只记录日志。
+func (h *EmbeddingTaskHandler) recordDocumentIndexed(ctx context.Context, payload *entity.EmbeddingTaskPayload, chunkCount int) {
+	if h.graph == nil {
+		return
+	}
+	if err := h.graph.RecordDocumentIndexed(ctx, payload.UserID, payload.DocumentID, payload.Filename, chunkCount); err != nil {
+		logger.WarnContext(ctx, "记录文档到图记忆失败", "error", err, "document_id", payload.DocumentID)
+	}
+}
+
+// publishDocumentIndexed 发布 dreamhub.document.indexed 事件，subject 为文档 ID。事件总线不影响文档处理，发布失败只记录日志。
+func (h *EmbeddingTaskHandler) publishDocumentIndexed(ctx context.Context, payload *entity.EmbeddingTaskPayload, chunkCount int) {
+	if h.events == nil {
+		return
+	}
+	data := &entity.DocumentIndexedEventData{DocumentID: payload.DocumentID, Filename: payload.Filename, ChunkCount: chunkCount}
+	if err := h.events.PublishSystemEvent(ctx, payload.UserID, entity.EventTypeDocumentIndexed, payload.DocumentID, data); err != nil {
+		logger.WarnContext(ctx, "发布文档处理完成事件失败", "error", err, "document_id", payload.DocumentID)
+	}
+}
+
 // markDocumentAsFailed 是一个辅助函数，用于更新文档状态为失败。
 // docID is now string
 func (h *EmbeddingTaskHandler) markDocumentAsFailed(ctx context.Context, docID string, errMsg string) {
@@ -230,4 +282,86 @@ func (h *EmbeddingTaskHandler) markDocumentAsFailed(ctx context.Context, docID s
 	// TODO: Update Task entity status if needed (using h.taskRepo) - would also need TaskID here.
 }
 
-// Removed splitTextSimple function as it's replaced by textSplitter field.
+// extractText 返回用于分块的文本内容，needsOCR 为 true 表示需要 OCR (图片或没有文本层的 PDF)。
+func (h *EmbeddingTaskHandler) extractText(ctx context.Context, payload *entity.EmbeddingTaskPayload, data []byte) (content []byte, needsOCR bool) {
+	switch {
+	case strings.HasPrefix(payload.ContentType, "image/"):
+		return nil, true
+	case strings.HasPrefix(payload.ContentType, "application/pdf"):
+		if h.pdfExtractor == nil {
+			return nil, true
+		}
+		text, err := h.pdfExtractor.ExtractText(ctx, data)
+		if err != nil {
+			logger.WarnContext(ctx, "提取 PDF 文本失败，尝试 OCR", "error", err, "document_id", payload.DocumentID)
+			return nil, true
+		}
+		if strings.TrimSpace(text) == "" {
+			logger.InfoContext(ctx, "PDF 没有文本层 (可能是扫描件)，尝试 OCR", "document_id", payload.DocumentID)
+			return nil, true
+		}
+		return []byte(text), false
+	default:
+		return data, false
+	}
+}
+
+// enqueueOCR 将文档交给 OCR 任务处理。OCR 未启用时将文档标记为失败，而不是作为空文件完成。
+func (h *EmbeddingTaskHandler) enqueueOCR(ctx context.Context, payload *entity.EmbeddingTaskPayload) error {
+	if h.ocrQueue == nil {
+		logger.WarnContext(ctx, "文件需要 OCR，但 OCR 未启用", "document_id", payload.DocumentID, "content_type", payload.ContentType)
+		h.markDocumentAsFailed(ctx, payload.DocumentID, "文件没有可提取的文本，且 OCR 未启用")
+		return nil // 重试无法解决
+	}
+	taskID, err := h.ocrQueue.EnqueueOCRTask(ctx, payload)
+	if err != nil {
+		logger.ErrorContext(ctx, "将 OCR 任务入队失败", "error", err, "document_id", payload.DocumentID)
+		h.markDocumentAsFailed(ctx, payload.DocumentID, "OCR 任务入队失败")
+		return fmt.Errorf("OCR 任务入队失败: %w", err) // Retry
+	}
+	if err := h.docRepo.UpdateDocumentStatus(ctx, payload.UserID, payload.DocumentID, entity.TaskStatusPending, &taskID, ""); err != nil {
+		logger.ErrorContext(ctx, "更新文档状态为 Pending 失败", "error", err, "document_id", payload.DocumentID, "task_id", taskID)
+	}
+	logger.InfoContext(ctx, "文件需要 OCR，OCR 任务已入队", "document_id", payload.DocumentID, "task_id", taskID)
+	return nil
+}
+
+// splitContent 将文件内容拆分为文本块。
+// 如果有导入器匹配该文件，按消息片段分块，每个块带上片段的元数据 (发送者、时间、会话)；
+// 导入器解析失败时退回到普通文本分块，以免格式识别错误导致文件无法索引。
+func (h *EmbeddingTaskHandler) splitContent(ctx context.Context, filename string, data []byte) ([]chunkInput, error) {
+	head := data[:min(len(data), importer.SniffLength())]
+	if imp := importer.Find(h.importers, filename, head); imp != nil {
+		segments, err := imp.Parse(filename, data)
+		if err == nil {
+			chunks := make([]chunkInput, 0, len(segments))
+			for _, segment := range segments {
+				parts, err := h.textSplitter.SplitText(segment.Content)
+				if err != nil {
+					return nil, err
+				}
+				for _, part := range parts {
+					metadata := make(map[string]any, len(segment.Metadata)+1)
+					for k, v := range segment.Metadata {
+						metadata[k] = v
+					}
+					metadata[entity.ChunkMetaSourceFormat] = imp.Format()
+					chunks = append(chunks, chunkInput{content: part, metadata: metadata})
+				}
+			}
+			logger.InfoContext(ctx, "按消息格式解析文件", "format", imp.Format(), "filename", filename, "segment_count", len(segments))
+			return chunks, nil
+		}
+		logger.WarnContext(ctx, "按消息格式解析文件失败，按普通文本处理", "error", err, "format", imp.Format(), "filename", filename)
+	}
+
+	parts, err := h.textSplitter.SplitText(string(data))
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]chunkInput, len(parts))
+	for i, part := range parts {
+		chunks[i] = chunkInput{content: part, metadata: map[string]any{}}
+	}
+	return chunks, nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// EventDeliveryTaskHandler 处理 event:deliver_webhook 任务，具体逻辑由 EventBusService 实现。
+type EventDeliveryTaskHandler struct {
+	eventBus service.EventBusService
+}
+
+// NewEventDeliveryTaskHandler 创建一个新的 EventDeliveryTaskHandler 实例。
+func NewEventDeliveryTaskHandler(eventBus service.EventBusService) *EventDeliveryTaskHandler {
+	return &EventDeliveryTaskHandler{
+		eventBus: eventBus,
+	}
+}
+
+// ProcessTask 实现 asynq.Handler 接口。
+// webhook 拒绝事件或订阅已删除时不再重试；其他失败按 Asynq 的退避策略重试，最后一次失败后投递记录标记为 failed。
+func (h *EventDeliveryTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var payload entity.EventDeliveryTaskPayload
+	if err := decodePayload(ctx, t, &payload); err != nil {
+		return err
+	}
+
+	retryCount, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	err := h.eventBus.DeliverWebhook(ctx, &payload, retryCount >= maxRetry)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, entity.ErrEventDeliveryRejected) {
+		logger.InfoContext(ctx, "webhook 投递不再重试", "delivery_id", payload.DeliveryID, "reason", err)
+		return fmt.Errorf("webhook 投递失败 (delivery_id=%s): %w: %w", payload.DeliveryID, err, asynq.SkipRetry)
+	}
+	return fmt.Errorf("webhook 投递失败 (delivery_id=%s): %w", payload.DeliveryID, err)
+}
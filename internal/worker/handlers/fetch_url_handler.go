@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/repository"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// FetchURLTaskHandler 抓取 URL 文档，保存正文快照并在内容变化时触发 Embedding 任务。
+type FetchURLTaskHandler struct {
+	fetcher     service.WebPageFetcher
+	fileStorage service.FileStorage
+	docRepo     repository.DocumentRepository
+	vectorRepo  repository.VectorRepository
+	taskQueue   service.TaskQueueClient
+}
+
+// NewFetchURLTaskHandler 创建一个新的 FetchURLTaskHandler 实例。
+func NewFetchURLTaskHandler(
+	f service.WebPageFetcher,
+	fs service.FileStorage,
+	dr repository.DocumentRepository,
+	vr repository.VectorRepository,
+	tq service.TaskQueueClient,
+) *FetchURLTaskHandler {
+	return &FetchURLTaskHandler{
+		fetcher:     f,
+		fileStorage: fs,
+		docRepo:     dr,
+		vectorRepo:  vr,
+		taskQueue:   tq,
+	}
+}
+
+// ProcessTask 实现 asynq.Handler 接口。
+func (h *FetchURLTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var payload entity.FetchURLTaskPayload
+	if err := decodePayload(ctx, t, &payload); err != nil {
+		return err
+	}
+
+	doc, err := h.docRepo.GetDocumentByID(ctx, payload.UserID, payload.DocumentID)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			logger.InfoContext(ctx, "URL 文档已被删除，跳过抓取", "document_id", payload.DocumentID)
+			return nil
+		}
+		return fmt.Errorf("获取文档失败: %w", err)
+	}
+	if doc.SourceURL == nil {
+		logger.ErrorContext(ctx, "文档不是 URL 文档，跳过抓取", "document_id", doc.ID)
+		return fmt.Errorf("文档没有来源 URL: %w", asynq.SkipRetry)
+	}
+	logger.InfoContext(ctx, "开始抓取 URL 文档", "document_id", doc.ID, "url", *doc.SourceURL)
+
+	page, err := h.fetcher.Fetch(ctx, *doc.SourceURL)
+	if err != nil {
+		return h.handleFetchError(ctx, doc, err)
+	}
+
+	// 快照内容包含标题和来源，便于检索结果引用；哈希基于完整快照计算
+	snapshot := renderSnapshot(doc, page)
+	sum := sha256.Sum256([]byte(snapshot))
+	contentHash := hex.EncodeToString(sum[:])
+	fetchedAt := time.Now()
+
+	// 内容未变化且之前的 Embedding 没有失败时，只记录抓取时间
+	if doc.StoredPath != "" && doc.ContentHash != nil && *doc.ContentHash == contentHash && doc.ProcessingStatus != entity.TaskStatusFailed {
+		if err := h.docRepo.MarkDocumentFetched(ctx, doc.UserID, doc.ID, fetchedAt); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+			return fmt.Errorf("更新抓取时间失败: %w", err)
+		}
+		logger.InfoContext(ctx, "URL 文档内容未变化，跳过重新索引", "document_id", doc.ID)
+		return nil
+	}
+
+	return h.replaceSnapshot(ctx, doc, snapshot, contentHash, fetchedAt, payload.Priority)
+}
+
+// replaceSnapshot 保存新快照、清除旧的向量数据并将 Embedding 任务入队 (沿用抓取任务的优先级)。
+func (h *FetchURLTaskHandler) replaceSnapshot(ctx context.Context, doc *entity.Document, snapshot string, contentHash string, fetchedAt time.Time, priority entity.TaskPriority) error {
+	storedPath, err := h.fileStorage.SaveFile(ctx, doc.UserID, doc.ID+".md", strings.NewReader(snapshot))
+	if err != nil {
+		return fmt.Errorf("保存网页快照失败: %w", err)
+	}
+	update := &repository.DocumentSnapshot{
+		StoredPath:  storedPath,
+		FileSize:    int64(len(snapshot)),
+		ContentType: "text/markdown",
+		ContentHash: contentHash,
+		FetchedAt:   fetchedAt,
+	}
+	if keyed, ok := h.fileStorage.(service.KeyedFileStorage); ok {
+		keyID := keyed.ActiveKeyID()
+		update.EncryptionKeyID = &keyID
+	}
+	if err := h.docRepo.UpdateDocumentSnapshot(ctx, doc.UserID, doc.ID, update); err != nil {
+		h.deleteFile(ctx, storedPath)
+		if apperr.Is(err, apperr.CodeNotFound) {
+			return nil // 抓取期间文档被删除
+		}
+		return fmt.Errorf("更新文档快照失败: %w", err)
+	}
+	if doc.StoredPath != "" {
+		h.deleteFile(ctx, doc.StoredPath)
+	}
+	// 快照写入成功后才删除旧的向量块，更新失败时文档保留旧快照和旧向量块，仍可被检索。
+	// 删除失败时将文档标记为失败：旧向量块仍可检索，重试时会因失败状态重新保存快照并重建索引。
+	if err := h.vectorRepo.DeleteChunksByDocumentID(ctx, doc.UserID, doc.ID); err != nil {
+		if updateErr := h.docRepo.UpdateDocumentStatus(ctx, doc.UserID, doc.ID, entity.TaskStatusFailed, nil, "Failed to delete previous chunks"); updateErr != nil {
+			logger.ErrorContext(ctx, "删除旧向量数据失败后更新文档状态也失败", "update_error", updateErr, "document_id", doc.ID)
+		}
+		return fmt.Errorf("删除旧向量数据失败: %w", err)
+	}
+
+	// 与上传文件使用相同的 Embedding 任务 payload
+	taskID, err := h.taskQueue.EnqueueEmbeddingTask(ctx, &entity.EmbeddingTaskPayload{
+		UserID:      doc.UserID,
+		DocumentID:  doc.ID,
+		FilePath:    storedPath,
+		Filename:    doc.OriginalFilename,
+		ContentType: update.ContentType,
+		Priority:    priority,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "将 Embedding 任务入队失败", "error", err, "document_id", doc.ID)
+		if updateErr := h.docRepo.UpdateDocumentStatus(ctx, doc.UserID, doc.ID, entity.TaskStatusFailed, nil, "Failed to enqueue processing task"); updateErr != nil {
+			logger.ErrorContext(ctx, "入队失败后更新文档状态也失败", "update_error", updateErr, "document_id", doc.ID)
+		}
+		return fmt.Errorf("Embedding 任务入队失败: %w", err) // 重试时文档状态为失败，会重新保存快照
+	}
+	if err := h.docRepo.UpdateDocumentStatus(ctx, doc.UserID, doc.ID, entity.TaskStatusPending, &taskID, ""); err != nil {
+		logger.ErrorContext(ctx, "更新文档状态为 Pending 失败", "error", err, "document_id", doc.ID, "task_id", taskID)
+	}
+
+	logger.InfoContext(ctx, "URL 文档快照已更新，Embedding 任务已入队", "document_id", doc.ID, "task_id", taskID, "size", update.FileSize)
+	return nil
+}
+
+// handleFetchError 处理抓取失败。
+// 永久错误不再重试；首次抓取失败 (或最后一次重试失败) 时将文档标记为失败，已有快照的文档保留旧内容。
+func (h *FetchURLTaskHandler) handleFetchError(ctx context.Context, doc *entity.Document, err error) error {
+	permanent := !apperr.Is(err, apperr.CodeUnavailable)
+	retryCount, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	lastAttempt := permanent || retryCount >= maxRetry
+
+	logger.WarnContext(ctx, "抓取 URL 文档失败", "error", err, "document_id", doc.ID, "url", *doc.SourceURL, "permanent", permanent, "retry", retryCount)
+	if lastAttempt && doc.StoredPath == "" {
+		if updateErr := h.docRepo.UpdateDocumentStatus(ctx, doc.UserID, doc.ID, entity.TaskStatusFailed, nil, "抓取网页失败: "+err.Error()); updateErr != nil {
+			logger.ErrorContext(ctx, "标记 URL 文档为失败状态时出错", "error", updateErr, "document_id", doc.ID)
+		}
+	}
+	if permanent {
+		return fmt.Errorf("抓取网页失败 (不可重试): %v: %w", err, asynq.SkipRetry)
+	}
+	return fmt.Errorf("抓取网页失败: %w", err)
+}
+
+// deleteFile 删除快照文件，失败时只记录日志。
+func (h *FetchURLTaskHandler) deleteFile(ctx context.Context, storedPath string) {
+	if err := h.fileStorage.DeleteFile(ctx, storedPath); err != nil && !apperr.Is(err, apperr.CodeNotFound) {
+		logger.WarnContext(ctx, "删除网页快照文件失败", "error", err, "path", storedPath)
+	}
+}
+
+// renderSnapshot 生成保存到存储中的 Markdown 快照。
+func renderSnapshot(doc *entity.Document, page *service.FetchedPage) string {
+	var sb strings.Builder
+	title := page.Title
+	if title == "" {
+		title = doc.OriginalFilename
+	}
+	sb.WriteString("# " + title + "\n\n")
+	sb.WriteString("Source: " + *doc.SourceURL + "\n\n")
+	sb.WriteString(page.Text)
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// EnqueueDueRecrawls 领取到期的 URL 文档并将抓取任务入队，返回入队的数量。
+// 由 Worker 定期调用，重新抓取属于后台任务，进入 bulk 队列。
+// ClaimDueRecrawls 已推迟了 next_crawl_at，入队失败 (包括队列积压被拒绝) 的文档要等到下一个抓取间隔才会再次被领取。
+func EnqueueDueRecrawls(ctx context.Context, docRepo repository.DocumentRepository, taskQueue service.TaskQueueClient, limit int) (int, error) {
+	docs, err := docRepo.ClaimDueRecrawls(ctx, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	enqueued := 0
+	for _, doc := range docs {
+		if _, err := taskQueue.EnqueueFetchURLTask(ctx, &entity.FetchURLTaskPayload{UserID: doc.UserID, DocumentID: doc.ID, Priority: entity.TaskPriorityBulk}); err != nil {
+			logger.ErrorContext(ctx, "将重新抓取任务入队失败", "error", err, "document_id", doc.ID)
+			continue
+		}
+		enqueued++
+	}
+	if enqueued > 0 {
+		logger.InfoContext(ctx, "已将到期的 URL 文档重新抓取任务入队", "count", enqueued)
+	}
+	return enqueued, nil
+}
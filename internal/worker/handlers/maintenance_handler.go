@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// MaintenanceTaskHandler 处理 Scheduler 定期触发的维护任务 (maintenance:*)，具体逻辑由 MaintenanceService 实现。
+type MaintenanceTaskHandler struct {
+	maintenance service.MaintenanceService
+}
+
+// NewMaintenanceTaskHandler 创建一个新的 MaintenanceTaskHandler 实例。
+func NewMaintenanceTaskHandler(ms service.MaintenanceService) *MaintenanceTaskHandler {
+	return &MaintenanceTaskHandler{
+		maintenance: ms,
+	}
+}
+
+// ProcessTask 实现 asynq.Handler 接口。
+// 执行结果写入任务的 result，保留期内可以在 Asynq 的已完成任务中查看。
+func (h *MaintenanceTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var run func(context.Context) (*entity.MaintenanceReport, error)
+	switch t.Type() {
+	case entity.TaskTypeMaintenanceOrphanFiles:
+		run = h.maintenance.ReconcileOrphanFiles
+	case entity.TaskTypeMaintenanceTaskRetention:
+		run = h.maintenance.PurgeTaskHistory
+	case entity.TaskTypeMaintenanceStaleDocuments:
+		run = h.maintenance.ResetStaleDocuments
+	case entity.TaskTypeMaintenanceVectorIndex:
+		run = h.maintenance.MaintainVectorIndex
+	case entity.TaskTypeMaintenanceExpiredUploads:
+		run = h.maintenance.PurgeExpiredUploads
+	default:
+		return fmt.Errorf("未知的维护任务类型 %q: %w", t.Type(), asynq.SkipRetry)
+	}
+
+	logger.InfoContext(ctx, "开始执行维护任务", "type", t.Type())
+	report, err := run(ctx)
+	if err != nil {
+		return fmt.Errorf("维护任务 %s 失败: %w", t.Type(), err)
+	}
+	logger.InfoContext(ctx, "维护任务完成", "type", t.Type(), "counts", report.Counts, "duration", report.FinishedAt.Sub(report.StartedAt))
+
+	if data, err := json.Marshal(report); err == nil {
+		if _, err := t.ResultWriter().Write(data); err != nil {
+			logger.WarnContext(ctx, "写入维护任务结果失败", "error", err, "type", t.Type())
+		}
+	}
+	return nil
+}
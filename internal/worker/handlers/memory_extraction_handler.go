@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// MemoryExtractionTaskHandler 处理 memory:extract 任务，具体逻辑由 MemoryExtractionService 实现。
+type MemoryExtractionTaskHandler struct {
+	extractor service.MemoryExtractionService
+}
+
+// NewMemoryExtractionTaskHandler 创建一个新的 MemoryExtractionTaskHandler 实例。
+func NewMemoryExtractionTaskHandler(extractor service.MemoryExtractionService) *MemoryExtractionTaskHandler {
+	return &MemoryExtractionTaskHandler{
+		extractor: extractor,
+	}
+}
+
+// ProcessTask 实现 asynq.Handler 接口。
+func (h *MemoryExtractionTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var payload entity.MemoryExtractionTaskPayload
+	if err := decodePayload(ctx, t, &payload); err != nil {
+		return err
+	}
+
+	result, err := h.extractor.ExtractMemories(ctx, &payload)
+	if err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			// 对话或消息在任务执行前已被删除，无需重试
+			logger.InfoContext(ctx, "消息不存在，跳过提取记忆", "conversation_id", payload.ConversationID, "message_id", payload.MessageID)
+			return nil
+		}
+		return fmt.Errorf("提取记忆失败 (conversation_id=%s): %w", payload.ConversationID, err)
+	}
+
+	if data, err := json.Marshal(result); err == nil {
+		if _, err := t.ResultWriter().Write(data); err != nil {
+			logger.WarnContext(ctx, "写入提取记忆任务结果失败", "error", err, "conversation_id", payload.ConversationID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// MessageEmbeddingTaskHandler 处理 message:embed 任务，为对话消息生成语义搜索向量。
+type MessageEmbeddingTaskHandler struct {
+	search service.MessageSearchService
+}
+
+// NewMessageEmbeddingTaskHandler 创建一个新的 MessageEmbeddingTaskHandler 实例。
+func NewMessageEmbeddingTaskHandler(search service.MessageSearchService) *MessageEmbeddingTaskHandler {
+	return &MessageEmbeddingTaskHandler{
+		search: search,
+	}
+}
+
+// ProcessTask 实现 asynq.Handler 接口。
+func (h *MessageEmbeddingTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var payload entity.MessageEmbeddingTaskPayload
+	if err := decodePayload(ctx, t, &payload); err != nil {
+		return err
+	}
+
+	if err := h.search.EmbedMessage(ctx, &payload); err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			// 消息所在的对话在任务执行前已被删除，无需重试
+			logger.InfoContext(ctx, "消息不存在，跳过生成向量", "message_id", payload.MessageID)
+			return nil
+		}
+		return fmt.Errorf("生成消息向量失败 (message_id=%s): %w", payload.MessageID, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/internal/service"
+	"github.com/soaringjerry/dreamhub/pkg/apperr"
+	"github.com/soaringjerry/dreamhub/pkg/ctxutil"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// OCRTaskHandler 处理 document:ocr 任务：识别扫描版 PDF 和图片中的文字，再按页分块生成 Embedding。
+// payload 与 Embedding 任务相同 (entity.EmbeddingTaskPayload)。
+type OCRTaskHandler struct {
+	ocr         service.OCRProvider
+	fileStorage service.FileStorage
+	embedding   *EmbeddingTaskHandler // 复用分块、Embedding 和保存向量块的逻辑
+}
+
+// NewOCRTaskHandler 创建一个新的 OCRTaskHandler 实例。
+func NewOCRTaskHandler(ocr service.OCRProvider, fs service.FileStorage, eh *EmbeddingTaskHandler) *OCRTaskHandler {
+	return &OCRTaskHandler{
+		ocr:         ocr,
+		fileStorage: fs,
+		embedding:   eh,
+	}
+}
+
+// ProcessTask 实现 asynq.Handler 接口。
+func (h *OCRTaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	var payload entity.EmbeddingTaskPayload
+	if err := decodePayload(ctx, t, &payload); err != nil {
+		return err
+	}
+	taskCtx := context.WithValue(ctx, ctxutil.UserIDKey, payload.UserID)
+	docID := payload.DocumentID
+	logger.InfoContext(taskCtx, "开始处理 OCR 任务", "document_id", docID, "filename", payload.Filename, "content_type", payload.ContentType)
+
+	if err := h.embedding.docRepo.UpdateDocumentStatus(taskCtx, payload.UserID, docID, entity.TaskStatusProcessing, nil, ""); err != nil {
+		if apperr.Is(err, apperr.CodeNotFound) {
+			logger.InfoContext(taskCtx, "文档已被删除，跳过 OCR", "document_id", docID)
+			return nil
+		}
+		return fmt.Errorf("更新文档状态失败: %w", err)
+	}
+
+	data, err := h.readFile(taskCtx, payload.FilePath)
+	if err != nil {
+		logger.ErrorContext(taskCtx, "读取待 OCR 的文件失败", "error", err, "path", payload.FilePath, "document_id", docID)
+		return h.handleOCRError(taskCtx, docID, apperr.Wrap(err, apperr.CodeUnavailable, "读取文件失败"))
+	}
+
+	pages, err := h.ocr.Recognize(taskCtx, data, payload.ContentType)
+	if err != nil {
+		return h.handleOCRError(taskCtx, docID, err)
+	}
+	logger.InfoContext(taskCtx, "OCR 识别完成", "document_id", docID, "page_count", len(pages))
+
+	chunks, err := h.pageChunks(pages)
+	if err != nil {
+		logger.ErrorContext(taskCtx, "OCR 文本分块失败", "error", err, "document_id", docID)
+		h.embedding.markDocumentAsFailed(taskCtx, docID, "文本分块失败")
+		return fmt.Errorf("文本分块失败: %w", err)
+	}
+	return h.embedding.saveChunks(taskCtx, &payload, chunks, "OCR 未识别出文字")
+}
+
+// readFile 读取文件的全部内容。
+func (h *OCRTaskHandler) readFile(ctx context.Context, storedPath string) ([]byte, error) {
+	reader, err := h.fileStorage.GetFileReader(ctx, storedPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// pageChunks 按页分块，每个块记录所在页码和该页的 OCR 置信度。
+func (h *OCRTaskHandler) pageChunks(pages []service.OCRPage) ([]chunkInput, error) {
+	chunks := make([]chunkInput, 0, len(pages))
+	for _, page := range pages {
+		text := strings.TrimSpace(page.Text)
+		if text == "" {
+			continue
+		}
+		parts, err := h.embedding.textSplitter.SplitText(text)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts {
+			chunks = append(chunks, chunkInput{
+				content: part,
+				metadata: map[string]any{
+					entity.ChunkMetaExtractionMethod: "ocr",
+					entity.ChunkMetaPageNumber:       page.Number,
+					entity.ChunkMetaOCRConfidence:    page.Confidence,
+				},
+			})
+		}
+	}
+	return chunks, nil
+}
+
+// handleOCRError 处理 OCR 失败。
+// 只有超时等临时错误 (CodeUnavailable) 会重试；永久错误或最后一次重试失败时将文档标记为失败。
+func (h *OCRTaskHandler) handleOCRError(ctx context.Context, docID string, err error) error {
+	permanent := !apperr.Is(err, apperr.CodeUnavailable)
+	retryCount, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+
+	logger.WarnContext(ctx, "OCR 失败", "error", err, "document_id", docID, "permanent", permanent, "retry", retryCount)
+	if permanent || retryCount >= maxRetry {
+		h.embedding.markDocumentAsFailed(ctx, docID, "OCR 失败: "+err.Error())
+	}
+	if permanent {
+		return fmt.Errorf("OCR 失败 (不可重试): %v: %w", err, asynq.SkipRetry)
+	}
+	return fmt.Errorf("OCR 失败: %w", err)
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// decodePayload 解析并校验任务 payload。
+// 无法解析的 payload 重试也不会成功，返回的错误包装了 asynq.SkipRetry，
+// Asynq 会直接将任务移入死信队列 (archived 集合)，保留原始 payload 和错误信息供排查。
+func decodePayload(ctx context.Context, t *asynq.Task, payload entity.TaskPayload) error {
+	if err := entity.DecodeTaskPayload(t.Payload(), payload); err != nil {
+		taskID, _ := asynq.GetTaskID(ctx)
+		logger.ErrorContext(ctx, "任务 payload 无效，移入死信队列", "type", t.Type(), "task_id", taskID, "error", err, "payload", string(t.Payload()))
+		return fmt.Errorf("%w: %w", err, asynq.SkipRetry)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+	"github.com/soaringjerry/dreamhub/pkg/logger"
+)
+
+// UserConcurrencyLimiter 限制同一用户在本 Worker 进程中同时执行的任务数，
+// 避免某个用户批量导入大量文件时占满所有 Worker 并发。
+// 超出上限的任务返回 entity.ErrTaskThrottled，由 Asynq 按重试延迟稍后重新执行 (Worker 配置中不将其计为失败)。
+// 被推迟的任务重新执行的先后取决于各自的重试时间，不保证按入队顺序执行。
+type UserConcurrencyLimiter struct {
+	limit    int
+	mu       sync.Mutex
+	active   map[string]int // 用户 ID -> 正在执行的任务数
+	released chan struct{}  // 每次释放名额时关闭并替换，用于唤醒等待的任务
+}
+
+// NewUserConcurrencyLimiter 创建一个新的 UserConcurrencyLimiter 实例。limit 为 0 时不限制。
+func NewUserConcurrencyLimiter(limit int) *UserConcurrencyLimiter {
+	return &UserConcurrencyLimiter{
+		limit:    limit,
+		active:   make(map[string]int),
+		released: make(chan struct{}),
+	}
+}
+
+// Middleware 实现 asynq.MiddlewareFunc。无法从 payload 中读取用户 ID 的任务不受限制。
+func (l *UserConcurrencyLimiter) Middleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		// 重试次数已用尽 (包括 MaxRetry 为 0) 的任务返回错误会被 Asynq 直接移入死信队列，不能推迟
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		return l.run(ctx, t, next, retried < maxRetry)
+	})
+}
+
+// run 在用户名额内执行任务。已达上限时，canDefer 为 true 则返回 entity.ErrTaskThrottled 推迟执行，
+// 否则在本 Worker 中等待名额，上限同样生效。
+func (l *UserConcurrencyLimiter) run(ctx context.Context, t *asynq.Task, next asynq.Handler, canDefer bool) error {
+	userID := entity.ParseTaskPayloadRef(t.Payload()).UserID
+	if l.limit <= 0 || userID == "" {
+		return next.ProcessTask(ctx, t)
+	}
+
+	if !l.tryAcquire(userID) {
+		if canDefer {
+			logger.DebugContext(ctx, "用户并发任务数已达上限，推迟执行", "user_id", userID, "type", t.Type(), "limit", l.limit)
+			return fmt.Errorf("%w: user_id=%s", entity.ErrTaskThrottled, userID)
+		}
+		logger.DebugContext(ctx, "用户并发任务数已达上限，任务没有剩余重试次数，等待名额", "user_id", userID, "type", t.Type(), "limit", l.limit)
+		if err := l.acquire(ctx, userID); err != nil {
+			return err
+		}
+	}
+	defer l.release(userID)
+	return next.ProcessTask(ctx, t)
+}
+
+// tryAcquire 为用户占用一个执行名额，已达上限时返回 false。
+func (l *UserConcurrencyLimiter) tryAcquire(userID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[userID] >= l.limit {
+		return false
+	}
+	l.active[userID]++
+	return true
+}
+
+// acquire 等待直到为用户占用一个执行名额，ctx 结束时返回其错误。
+func (l *UserConcurrencyLimiter) acquire(ctx context.Context, userID string) error {
+	for {
+		l.mu.Lock()
+		if l.active[userID] < l.limit {
+			l.active[userID]++
+			l.mu.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release 释放用户的一个执行名额，并唤醒等待名额的任务。
+func (l *UserConcurrencyLimiter) release(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[userID] <= 1 {
+		delete(l.active, userID)
+	} else {
+		l.active[userID]--
+	}
+	close(l.released)
+	l.released = make(chan struct{})
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/soaringjerry/dreamhub/internal/entity"
+)
+
+// newUserTask 返回属于 userID 的测试任务。
+func newUserTask(userID string) *asynq.Task {
+	return asynq.NewTask("test:task", []byte(`{"user_id":"`+userID+`"}`))
+}
+
+// blockingHandler 记录同时执行的任务数，任务在 release 关闭前不会返回。
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+	err     error
+	mu      sync.Mutex
+	active  map[string]int
+	peak    map[string]int
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		started: make(chan struct{}, 100),
+		release: make(chan struct{}),
+		active:  make(map[string]int),
+		peak:    make(map[string]int),
+	}
+}
+
+func (h *blockingHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
+	userID := entity.ParseTaskPayloadRef(t.Payload()).UserID
+	h.mu.Lock()
+	h.active[userID]++
+	h.peak[userID] = max(h.peak[userID], h.active[userID])
+	h.mu.Unlock()
+	h.started <- struct{}{}
+
+	<-h.release
+
+	h.mu.Lock()
+	h.active[userID]--
+	h.mu.Unlock()
+	return h.err
+}
+
+// waitStarted 等待 n 个任务开始执行。
+func (h *blockingHandler) waitStarted(t *testing.T, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case <-h.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for tasks to start")
+		}
+	}
+}
+
+// runAsync 在后台执行任务并返回接收结果的 channel。
+func runAsync(l *UserConcurrencyLimiter, h asynq.Handler, userID string, canDefer bool) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- l.run(context.Background(), newUserTask(userID), h, canDefer) }()
+	return done
+}
+
+func TestUserConcurrencyLimiterThrottlesOverLimit(t *testing.T) {
+	l := NewUserConcurrencyLimiter(2)
+	h := newBlockingHandler()
+
+	first := runAsync(l, h, "user-a", true)
+	second := runAsync(l, h, "user-a", true)
+	h.waitStarted(t, 2)
+
+	// 超出上限的任务立即返回 ErrTaskThrottled，不执行 handler
+	called := false
+	err := l.run(context.Background(), newUserTask("user-a"), asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		called = true
+		return nil
+	}), true)
+	if !errors.Is(err, entity.ErrTaskThrottled) {
+		t.Fatalf("run() over limit = %v, want ErrTaskThrottled", err)
+	}
+	if called {
+		t.Error("throttled task should not run its handler")
+	}
+
+	// 其他用户不受影响
+	other := runAsync(l, h, "user-b", true)
+	h.waitStarted(t, 1)
+
+	close(h.release)
+	for _, done := range []<-chan error{first, second, other} {
+		if err := <-done; err != nil {
+			t.Errorf("run() = %v, want nil", err)
+		}
+	}
+	if h.peak["user-a"] != 2 {
+		t.Errorf("peak concurrency for user-a = %d, want 2", h.peak["user-a"])
+	}
+	if len(l.active) != 0 {
+		t.Errorf("active = %v, want every slot released", l.active)
+	}
+}
+
+func TestUserConcurrencyLimiterReleasesSlotOnError(t *testing.T) {
+	l := NewUserConcurrencyLimiter(1)
+	errFailed := errors.New("handler failed")
+	failing := asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error { return errFailed })
+
+	for i := range 3 {
+		if err := l.run(context.Background(), newUserTask("user-a"), failing, true); !errors.Is(err, errFailed) {
+			t.Fatalf("run() #%d = %v, want the handler error rather than ErrTaskThrottled", i, err)
+		}
+	}
+	if len(l.active) != 0 {
+		t.Errorf("active = %v, want every slot released", l.active)
+	}
+}
+
+func TestUserConcurrencyLimiterWaitsWithoutRetriesLeft(t *testing.T) {
+	l := NewUserConcurrencyLimiter(1)
+	h := newBlockingHandler()
+
+	first := runAsync(l, h, "user-a", true)
+	h.waitStarted(t, 1)
+
+	// 没有剩余重试次数的任务等待名额，而不是返回 ErrTaskThrottled
+	waiting := runAsync(l, h, "user-a", false)
+	select {
+	case err := <-waiting:
+		t.Fatalf("run() without retries left returned %v before a slot was free", err)
+	case <-h.started:
+		t.Fatal("task without retries left ran over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(h.release)
+	if err := <-first; err != nil {
+		t.Errorf("first run() = %v", err)
+	}
+	if err := <-waiting; err != nil {
+		t.Errorf("waiting run() = %v, want nil", err)
+	}
+	if h.peak["user-a"] != 1 {
+		t.Errorf("peak concurrency = %d, want 1", h.peak["user-a"])
+	}
+}
+
+func TestUserConcurrencyLimiterWaitHonorsContext(t *testing.T) {
+	l := NewUserConcurrencyLimiter(1)
+	h := newBlockingHandler()
+	defer close(h.release)
+
+	runAsync(l, h, "user-a", true)
+	h.waitStarted(t, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.run(ctx, newUserTask("user-a"), h, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("run() = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestUserConcurrencyLimiterConcurrentTasks(t *testing.T) {
+	const limit, tasks = 3, 40
+	l := NewUserConcurrencyLimiter(limit)
+	var active, peak, ran, throttled atomic.Int32
+	handler := asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		active.Add(-1)
+		ran.Add(1)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 一半任务可以推迟，一半没有剩余重试次数
+			err := l.run(context.Background(), newUserTask("user-a"), handler, i%2 == 0)
+			if errors.Is(err, entity.ErrTaskThrottled) {
+				throttled.Add(1)
+			} else if err != nil {
+				t.Errorf("run() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() > limit {
+		t.Errorf("peak concurrency = %d, want at most %d", peak.Load(), limit)
+	}
+	if ran.Load()+throttled.Load() != tasks {
+		t.Errorf("ran %d and throttled %d tasks, want %d in total", ran.Load(), throttled.Load(), tasks)
+	}
+	if len(l.active) != 0 {
+		t.Errorf("active = %v, want every slot released", l.active)
+	}
+}
+
+func TestUserConcurrencyLimiterUnlimited(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		userID string
+	}{
+		{"no limit", 0, "user-a"},
+		{"no user", 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewUserConcurrencyLimiter(tt.limit)
+			h := newBlockingHandler()
+			var results []<-chan error
+			for range 3 {
+				results = append(results, runAsync(l, h, tt.userID, true))
+			}
+			h.waitStarted(t, 3)
+			close(h.release)
+			for _, done := range results {
+				if err := <-done; err != nil {
+					t.Errorf("run() = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
+func TestUserConcurrencyLimiterMiddlewareWithoutRetryInfo(t *testing.T) {
+	// 不在 Asynq 中执行时 ctx 没有重试信息，视为没有剩余重试次数：等待名额而不是推迟
+	l := NewUserConcurrencyLimiter(1)
+	h := newBlockingHandler()
+	first := runAsync(l, h, "user-a", true)
+	h.waitStarted(t, 1)
+
+	done := make(chan error, 1)
+	go func() { done <- l.Middleware(h).ProcessTask(context.Background(), newUserTask("user-a")) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Middleware() returned %v before a slot was free", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(h.release)
+	if err := <-first; err != nil {
+		t.Errorf("first run() = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Middleware() = %v, want nil", err)
+	}
+}
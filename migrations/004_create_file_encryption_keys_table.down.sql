@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS update_file_encryption_keys_updated_at ON file_encryption_keys;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS encryption_key_id;
+
+DROP INDEX IF EXISTS idx_file_encryption_keys_key_id;
+
+DROP TABLE IF EXISTS file_encryption_keys;
@@ -0,0 +1,28 @@
+-- Per-file data keys for encryption at rest (envelope encryption).
+-- The file content is encrypted with a random data key; the data key is stored
+-- here wrapped by a master key identified by key_id.
+CREATE TABLE IF NOT EXISTS file_encryption_keys (
+    stored_path VARCHAR(1024) PRIMARY KEY,
+    key_id VARCHAR(64) NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_encryption_keys_key_id ON file_encryption_keys(key_id);
+
+-- Record which master key protects each document's file.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS encryption_key_id VARCHAR(64);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+   NEW.updated_at = NOW();
+   RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER update_file_encryption_keys_updated_at
+BEFORE UPDATE ON file_encryption_keys
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
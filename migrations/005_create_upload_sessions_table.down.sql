@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS update_upload_sessions_updated_at ON upload_sessions;
+
+DROP TABLE IF EXISTS upload_session_parts;
+
+DROP INDEX IF EXISTS idx_upload_sessions_expires_at;
+DROP INDEX IF EXISTS idx_upload_sessions_user_id;
+
+DROP TABLE IF EXISTS upload_sessions;
@@ -0,0 +1,40 @@
+-- Resumable (tus-style) upload sessions.
+-- Each PATCH request is stored as a separate part through FileStorage; the parts
+-- are concatenated into a regular document when the session is finalized.
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id UUID PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    filename VARCHAR(1024) NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    total_size BIGINT NOT NULL CHECK (total_size >= 0),
+    upload_offset BIGINT NOT NULL DEFAULT 0 CHECK (upload_offset >= 0),
+    status VARCHAR(32) NOT NULL DEFAULT 'active', -- active, finalizing
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_user_id ON upload_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at);
+
+CREATE TABLE IF NOT EXISTS upload_session_parts (
+    session_id UUID NOT NULL REFERENCES upload_sessions(id) ON DELETE CASCADE,
+    part_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    stored_path VARCHAR(1024) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (session_id, part_offset)
+);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+   NEW.updated_at = NOW();
+   RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER update_upload_sessions_updated_at
+BEFORE UPDATE ON upload_sessions
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_documents_next_crawl_at;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS next_crawl_at;
+ALTER TABLE documents DROP COLUMN IF EXISTS recrawl_interval_minutes;
+ALTER TABLE documents DROP COLUMN IF EXISTS last_fetched_at;
+ALTER TABLE documents DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE documents DROP COLUMN IF EXISTS source_url;
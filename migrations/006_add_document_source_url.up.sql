@@ -0,0 +1,10 @@
+-- Documents ingested from a URL (web pages).
+-- content_hash is the SHA-256 of the extracted readable text and is used to
+-- skip re-embedding when a periodic re-crawl finds no changes.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS source_url TEXT;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS last_fetched_at TIMESTAMPTZ;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS recrawl_interval_minutes INT NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS next_crawl_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_documents_next_crawl_at ON documents(next_crawl_at) WHERE next_crawl_at IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_documents_user_source_path;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS source_modified_at;
+ALTER TABLE documents DROP COLUMN IF EXISTS source_path;
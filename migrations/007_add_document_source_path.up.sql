@@ -0,0 +1,8 @@
+-- Documents mirrored from a watched local folder.
+-- source_path is the absolute path of the file on the worker host; together
+-- with content_hash (SHA-256 of the file) and source_modified_at it lets the
+-- folder sync skip re-embedding unchanged files and reconcile after restarts.
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS source_path TEXT;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS source_modified_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_documents_user_source_path ON documents(user_id, source_path) WHERE source_path IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_task_failures_failed_at;
+DROP INDEX IF EXISTS idx_task_failures_task_id;
+
+DROP TABLE IF EXISTS task_failures;
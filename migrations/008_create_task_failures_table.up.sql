@@ -0,0 +1,18 @@
+-- Error history of failed Asynq task attempts.
+-- Asynq only keeps the last error of a task, so the worker records every failed
+-- attempt here. When a dead-lettered task is retried the rows are re-pointed to
+-- the new task id, keeping the full history across retries.
+CREATE TABLE IF NOT EXISTS task_failures (
+    id BIGSERIAL PRIMARY KEY,
+    task_id VARCHAR(255) NOT NULL,
+    queue VARCHAR(255) NOT NULL,
+    task_type VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255), -- NULL when the payload could not be decoded
+    document_id VARCHAR(255),
+    attempt INT NOT NULL,
+    error TEXT NOT NULL,
+    failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_failures_task_id ON task_failures(task_id, failed_at);
+CREATE INDEX IF NOT EXISTS idx_task_failures_failed_at ON task_failures(failed_at);
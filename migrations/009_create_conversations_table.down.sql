@@ -0,0 +1,7 @@
+ALTER TABLE conversation_history DROP CONSTRAINT IF EXISTS fk_conversation_history_conversation;
+
+DROP TRIGGER IF EXISTS update_conversations_updated_at ON conversations;
+
+DROP INDEX IF EXISTS idx_conversations_user_activity;
+
+DROP TABLE IF EXISTS conversations;
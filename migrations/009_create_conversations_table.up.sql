@@ -0,0 +1,34 @@
+-- Conversations as first-class rows.
+-- Until now a conversation only existed implicitly as the set of
+-- conversation_history rows sharing a conversation_id. The table stores the
+-- user-editable attributes (title, archived, pinned) and the time of the last
+-- message, so listing conversations no longer aggregates the whole history.
+CREATE TABLE IF NOT EXISTS conversations (
+    id UUID PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    archived BOOLEAN NOT NULL DEFAULT FALSE,
+    pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_message_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_user_activity ON conversations(user_id, pinned DESC, last_message_at DESC);
+
+-- Backfill conversations from the existing history.
+INSERT INTO conversations (id, user_id, created_at, last_message_at)
+SELECT conversation_id, MIN(user_id), MIN(timestamp), MAX(timestamp)
+FROM conversation_history
+GROUP BY conversation_id
+ON CONFLICT (id) DO NOTHING;
+
+-- Deleting a conversation deletes its messages.
+ALTER TABLE conversation_history
+    ADD CONSTRAINT fk_conversation_history_conversation
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE;
+
+CREATE TRIGGER update_conversations_updated_at
+BEFORE UPDATE ON conversations
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
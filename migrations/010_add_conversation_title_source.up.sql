@@ -0,0 +1,6 @@
+-- Where the conversation title came from: 'none' (untitled), 'auto' (generated
+-- by the LLM) or 'user' (set by hand). Generated titles never overwrite a
+-- title the user set.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS title_source VARCHAR(16) NOT NULL DEFAULT 'none';
+
+UPDATE conversations SET title_source = 'user' WHERE title <> '';
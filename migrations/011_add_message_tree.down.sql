@@ -0,0 +1,5 @@
+ALTER TABLE conversations DROP COLUMN IF EXISTS active_leaf_id;
+
+DROP INDEX IF EXISTS idx_conversation_history_parent_id;
+
+ALTER TABLE conversation_history DROP COLUMN IF EXISTS parent_id;
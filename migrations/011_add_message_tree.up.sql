@@ -0,0 +1,30 @@
+-- Messages form a tree: editing a message or regenerating a reply creates a
+-- sibling of the original instead of overwriting it. parent_id points at the
+-- previous message on the same branch (NULL for the first message), and
+-- conversations.active_leaf_id marks the last message of the branch the user
+-- is currently on. The LLM context is built by walking from the active leaf
+-- back to the root.
+ALTER TABLE conversation_history
+    ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES conversation_history(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_conversation_history_parent_id ON conversation_history(parent_id);
+
+-- Existing conversations become a single branch ordered by timestamp.
+UPDATE conversation_history h
+SET parent_id = chain.prev_id
+FROM (
+    SELECT id, LAG(id) OVER (PARTITION BY conversation_id ORDER BY timestamp, id) AS prev_id
+    FROM conversation_history
+) chain
+WHERE h.id = chain.id AND chain.prev_id IS NOT NULL;
+
+ALTER TABLE conversations
+    ADD COLUMN IF NOT EXISTS active_leaf_id UUID REFERENCES conversation_history(id) ON DELETE SET NULL;
+
+UPDATE conversations c
+SET active_leaf_id = (
+    SELECT h.id FROM conversation_history h
+    WHERE h.conversation_id = c.id
+    ORDER BY h.timestamp DESC, h.id DESC
+    LIMIT 1
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS message_embeddings;
+
+DROP INDEX IF EXISTS idx_conversation_history_content_trgm;
+DROP INDEX IF EXISTS idx_conversation_history_content_tsv;
+
+ALTER TABLE conversation_history DROP COLUMN IF EXISTS content_tsv;
@@ -0,0 +1,31 @@
+-- Full-text search over conversation history.
+-- The 'simple' configuration does not stem, so it works the same for every
+-- language. CJK text has no word boundaries, so queries containing CJK
+-- characters use substring matching backed by the trigram index instead.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE conversation_history
+    ADD COLUMN IF NOT EXISTS content_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', message_content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_conversation_history_content_tsv
+    ON conversation_history USING GIN (content_tsv);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_history_content_trgm
+    ON conversation_history USING GIN (message_content gin_trgm_ops);
+
+-- Optional semantic search: message embeddings live in their own table so
+-- they never show up in document RAG retrieval. The dimension must match the
+-- embedding model (text-embedding-3-small, same as langchain_pg_embedding).
+CREATE TABLE IF NOT EXISTS message_embeddings (
+    message_id UUID PRIMARY KEY REFERENCES conversation_history(id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    embedding vector(1536) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_embeddings_user_id ON message_embeddings(user_id);
+
+CREATE INDEX IF NOT EXISTS message_embeddings_ivfflat_idx
+    ON message_embeddings USING ivfflat (embedding vector_cosine_ops) WITH (lists = 100);
@@ -0,0 +1,4 @@
+ALTER TABLE conversations DROP COLUMN IF EXISTS persona_id;
+
+DROP TRIGGER IF EXISTS update_personas_updated_at ON personas;
+DROP TABLE IF EXISTS personas;
@@ -0,0 +1,28 @@
+-- User-defined personas: a named system prompt with default generation
+-- settings. A conversation can pick a persona; conversations without one use
+-- the user's default persona (at most one per user), and without a default no
+-- system prompt is sent.
+CREATE TABLE IF NOT EXISTS personas (
+    id UUID PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    system_prompt TEXT NOT NULL DEFAULT '',
+    model_name VARCHAR(100) NOT NULL DEFAULT '',
+    temperature REAL,
+    rag_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personas_user_default ON personas(user_id) WHERE is_default;
+
+CREATE TRIGGER update_personas_updated_at
+BEFORE UPDATE ON personas
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- Deleting a persona returns its conversations to the user's default.
+ALTER TABLE conversations
+    ADD COLUMN IF NOT EXISTS persona_id UUID REFERENCES personas(id) ON DELETE SET NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS structured_memory_embeddings;
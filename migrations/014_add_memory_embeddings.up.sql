@@ -0,0 +1,13 @@
+-- Embeddings of structured memories, used to rank memories by similarity to
+-- the chat message when they do not all fit in the prompt budget. They are
+-- computed lazily; memory_updated_at records the memory version that was
+-- embedded so that edited memories are re-embedded.
+CREATE TABLE IF NOT EXISTS structured_memory_embeddings (
+    memory_id UUID PRIMARY KEY REFERENCES structured_memories(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    embedding vector(1536) NOT NULL,
+    memory_updated_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_structured_memory_embeddings_user_id ON structured_memory_embeddings(user_id);
@@ -0,0 +1,18 @@
+-- Facts extracted from chats by the LLM that wait for the user to approve
+-- (written to structured_memories) or reject them. Resolved suggestions are
+-- kept so that the same key/value pair is not proposed again; values are
+-- capped by the extractor, which keeps the unique index small.
+CREATE TABLE IF NOT EXISTS memory_suggestions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key VARCHAR(255) NOT NULL,
+    value TEXT NOT NULL,
+    conversation_id UUID REFERENCES conversations(id) ON DELETE SET NULL,
+    message_id UUID REFERENCES conversation_history(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    UNIQUE (user_id, key, value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_memory_suggestions_user_status ON memory_suggestions(user_id, status, created_at DESC);
@@ -0,0 +1,17 @@
+DROP TRIGGER IF EXISTS record_structured_memories_history ON structured_memories;
+DROP TRIGGER IF EXISTS bump_structured_memories_version ON structured_memories;
+DROP FUNCTION IF EXISTS record_structured_memory_history();
+DROP FUNCTION IF EXISTS bump_structured_memory_version();
+DROP TABLE IF EXISTS structured_memory_history;
+
+ALTER TABLE memory_suggestions DROP COLUMN IF EXISTS confidence;
+
+DROP INDEX IF EXISTS idx_structured_memories_user_namespace;
+ALTER TABLE structured_memories
+    DROP COLUMN IF EXISTS value_type,
+    DROP COLUMN IF EXISTS namespace,
+    DROP COLUMN IF EXISTS source,
+    DROP COLUMN IF EXISTS source_conversation_id,
+    DROP COLUMN IF EXISTS confidence,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS version;
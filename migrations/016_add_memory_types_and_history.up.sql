@@ -0,0 +1,81 @@
+-- Typed, categorised structured memories with provenance, confidence and an
+-- optional expiry. Keys stay unique per user; namespace only groups memories.
+ALTER TABLE structured_memories
+    ADD COLUMN IF NOT EXISTS value_type VARCHAR(20) NOT NULL DEFAULT 'string'
+        CHECK (value_type IN ('string', 'number', 'date', 'json', 'list')),
+    ADD COLUMN IF NOT EXISTS namespace VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'manual'
+        CHECK (source IN ('manual', 'extracted', 'imported')),
+    ADD COLUMN IF NOT EXISTS source_conversation_id UUID REFERENCES conversations(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS confidence REAL CHECK (confidence >= 0 AND confidence <= 1),
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_structured_memories_user_namespace ON structured_memories(user_id, namespace);
+
+-- Confidence reported by the extractor, copied to the memory on approval.
+ALTER TABLE memory_suggestions
+    ADD COLUMN IF NOT EXISTS confidence REAL CHECK (confidence >= 0 AND confidence <= 1);
+
+-- Every version of every memory, written by triggers so that all code paths
+-- are covered. Rows outlive the memory (no foreign key) so that deleted
+-- memories can be restored.
+CREATE TABLE IF NOT EXISTS structured_memory_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    memory_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    value TEXT NOT NULL,
+    value_type VARCHAR(20) NOT NULL,
+    namespace VARCHAR(100) NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    source_conversation_id UUID,
+    confidence REAL,
+    expires_at TIMESTAMPTZ,
+    change_type VARCHAR(10) NOT NULL CHECK (change_type IN ('insert', 'update', 'delete')),
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_structured_memory_history_user_key ON structured_memory_history(user_id, key, changed_at DESC);
+
+CREATE OR REPLACE FUNCTION bump_structured_memory_version()
+RETURNS TRIGGER AS $$
+BEGIN
+   NEW.version = OLD.version + 1;
+   RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER bump_structured_memories_version
+BEFORE UPDATE ON structured_memories
+FOR EACH ROW
+EXECUTE FUNCTION bump_structured_memory_version();
+
+CREATE OR REPLACE FUNCTION record_structured_memory_history()
+RETURNS TRIGGER AS $$
+DECLARE
+   m structured_memories%ROWTYPE;
+BEGIN
+   IF TG_OP = 'DELETE' THEN
+      m := OLD;
+   ELSE
+      m := NEW;
+   END IF;
+   INSERT INTO structured_memory_history (memory_id, user_id, key, version, value, value_type, namespace, source,
+                                          source_conversation_id, confidence, expires_at, change_type)
+   VALUES (m.id, m.user_id, m.key, m.version, m.value, m.value_type, m.namespace, m.source,
+           m.source_conversation_id, m.confidence, m.expires_at, lower(TG_OP));
+   RETURN m;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER record_structured_memories_history
+AFTER INSERT OR UPDATE OR DELETE ON structured_memories
+FOR EACH ROW
+EXECUTE FUNCTION record_structured_memory_history();
+
+-- Existing memories start their history at version 1.
+INSERT INTO structured_memory_history (memory_id, user_id, key, version, value, value_type, namespace, source, change_type, changed_at)
+SELECT id, user_id, key, version, value, value_type, namespace, source, 'insert', COALESCE(updated_at, NOW())
+FROM structured_memories;
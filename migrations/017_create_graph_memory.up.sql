@@ -0,0 +1,36 @@
+-- Graph memory (PCAS plan, section 2.3): events, decisions, commands, results
+-- and feedback are stored as typed nodes, and the causal links between them
+-- as typed, directed edges (from cause to effect). Traversals use recursive
+-- CTEs over graph_edges.
+CREATE TABLE IF NOT EXISTS graph_nodes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    node_type VARCHAR(20) NOT NULL CHECK (node_type IN ('event', 'decision', 'command', 'result', 'feedback')),
+    label TEXT NOT NULL DEFAULT '',
+    properties JSONB NOT NULL DEFAULT '{}'::jsonb,
+    -- Optional reference to the object the node was recorded for (e.g. a chat
+    -- message or a document), so that automatic recording is idempotent and
+    -- later nodes can be linked to it. Empty when the node has no reference.
+    ref_type VARCHAR(50) NOT NULL DEFAULT '',
+    ref_id VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_graph_nodes_ref ON graph_nodes(user_id, ref_type, ref_id) WHERE ref_id <> '';
+CREATE INDEX IF NOT EXISTS idx_graph_nodes_user_type ON graph_nodes(user_id, node_type, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_graph_nodes_user_created ON graph_nodes(user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS graph_edges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_node_id UUID NOT NULL REFERENCES graph_nodes(id) ON DELETE CASCADE,
+    target_node_id UUID NOT NULL REFERENCES graph_nodes(id) ON DELETE CASCADE,
+    edge_type VARCHAR(20) NOT NULL CHECK (edge_type IN ('causes', 'follows', 'informs', 'evaluated_by')),
+    properties JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (source_node_id <> target_node_id),
+    UNIQUE (source_node_id, target_node_id, edge_type)
+);
+
+-- The unique constraint covers traversals towards descendants; this index covers ancestors.
+CREATE INDEX IF NOT EXISTS idx_graph_edges_target ON graph_edges(target_node_id);
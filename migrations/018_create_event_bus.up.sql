@@ -0,0 +1,67 @@
+-- Event bus (PCAS plan, sections 2.2 and 3.1): D-Apps publish events in a
+-- CloudEvents v1.0 compatible envelope and subscribe to them by type pattern.
+-- Events are stored durably; seq orders them per server and is the cursor for
+-- listing and for resuming SSE streams.
+CREATE TABLE IF NOT EXISTS events (
+    seq BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- CloudEvents attributes. source + id identify an event, so publishing the
+    -- same event twice stores it once.
+    event_id VARCHAR(255) NOT NULL,
+    source VARCHAR(1024) NOT NULL,
+    event_type VARCHAR(255) NOT NULL,
+    subject VARCHAR(1024) NOT NULL DEFAULT '',
+    event_time TIMESTAMPTZ NOT NULL,
+    data_content_type VARCHAR(255) NOT NULL DEFAULT '',
+    data_schema VARCHAR(1024) NOT NULL DEFAULT '',
+    -- Version of the data schema (the "dataversion" extension attribute);
+    -- data_major is its major version, which subscriptions can pin.
+    data_version VARCHAR(32) NOT NULL,
+    data_major INTEGER NOT NULL,
+    trace_id VARCHAR(255) NOT NULL DEFAULT '',
+    -- Other extension attributes, by name.
+    extensions JSONB NOT NULL DEFAULT '{}'::jsonb,
+    data JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT uq_events_source_id UNIQUE (user_id, source, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_user_seq ON events(user_id, seq);
+CREATE INDEX IF NOT EXISTS idx_events_user_type_seq ON events(user_id, event_type, seq);
+
+CREATE TABLE IF NOT EXISTS event_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- An exact event type, a prefix ending in ".*" or "*" for all events.
+    type_pattern VARCHAR(255) NOT NULL,
+    -- Only events with this major data version are delivered; NULL delivers all.
+    schema_version INTEGER,
+    delivery VARCHAR(20) NOT NULL CHECK (delivery IN ('sse', 'webhook')),
+    webhook_url TEXT NOT NULL DEFAULT '',
+    -- Key for the HMAC-SHA256 signature of webhook requests.
+    secret VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((delivery = 'webhook') = (webhook_url <> ''))
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_subscriptions_user ON event_subscriptions(user_id, created_at);
+
+-- One row per event delivered to a webhook subscription. The worker retries
+-- failed attempts; status becomes failed once the retries are used up.
+CREATE TABLE IF NOT EXISTS event_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subscription_id UUID NOT NULL REFERENCES event_subscriptions(id) ON DELETE CASCADE,
+    event_seq BIGINT NOT NULL REFERENCES events(seq) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_status_code INTEGER,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ,
+    UNIQUE (subscription_id, event_seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_deliveries_subscription ON event_deliveries(subscription_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_event_deliveries_event ON event_deliveries(event_seq);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS conversation_import_files;
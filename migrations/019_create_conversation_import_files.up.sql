@@ -0,0 +1,9 @@
+-- Uploaded conversation import files waiting to be processed by an import task.
+-- The orphan file maintenance job treats these paths as referenced while the
+-- task still exists in the queue, so queued or retrying imports keep their input.
+CREATE TABLE IF NOT EXISTS conversation_import_files (
+    stored_path VARCHAR(1024) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    task_id VARCHAR(255), -- NULL until the import task has been enqueued
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_structured_memory_history_source_conversation;
+ALTER TABLE structured_memory_history DROP CONSTRAINT IF EXISTS structured_memory_history_source_conversation_id_fkey;
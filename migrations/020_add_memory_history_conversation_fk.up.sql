@@ -0,0 +1,15 @@
+-- History entries keep the source conversation of each version. Give the column
+-- the same ON DELETE SET NULL foreign key as structured_memories, so reverting
+-- to a version whose conversation was deleted writes NULL instead of failing.
+UPDATE structured_memory_history h
+SET source_conversation_id = NULL
+WHERE source_conversation_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM conversations c WHERE c.id = h.source_conversation_id);
+
+ALTER TABLE structured_memory_history
+    ADD CONSTRAINT structured_memory_history_source_conversation_id_fkey
+        FOREIGN KEY (source_conversation_id) REFERENCES conversations(id) ON DELETE SET NULL;
+
+-- Deleting a conversation looks up the history entries that reference it.
+CREATE INDEX IF NOT EXISTS idx_structured_memory_history_source_conversation
+    ON structured_memory_history(source_conversation_id) WHERE source_conversation_id IS NOT NULL;
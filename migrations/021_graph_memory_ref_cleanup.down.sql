@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS delete_documents_graph_nodes ON documents;
+DROP TRIGGER IF EXISTS delete_conversation_history_graph_nodes ON conversation_history;
+DROP FUNCTION IF EXISTS delete_graph_nodes_for_ref();
+DROP INDEX IF EXISTS idx_graph_nodes_ref_id;
@@ -0,0 +1,38 @@
+-- Automatically recorded graph nodes reference chat messages and documents by
+-- ID. Delete those nodes (and, through the foreign keys, their edges) when the
+-- referenced message or document is deleted, including messages deleted by the
+-- conversation cascade, so no copy of deleted content stays in the graph.
+CREATE INDEX IF NOT EXISTS idx_graph_nodes_ref_id ON graph_nodes(ref_type, ref_id) WHERE ref_id <> '';
+
+CREATE OR REPLACE FUNCTION delete_graph_nodes_for_ref()
+RETURNS TRIGGER AS $$
+BEGIN
+   DELETE FROM graph_nodes
+   WHERE ref_type = TG_ARGV[0] AND ref_id = OLD.id::text AND user_id::text = OLD.user_id;
+   RETURN OLD;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER delete_conversation_history_graph_nodes
+AFTER DELETE ON conversation_history
+FOR EACH ROW
+EXECUTE FUNCTION delete_graph_nodes_for_ref('message');
+
+CREATE TRIGGER delete_documents_graph_nodes
+AFTER DELETE ON documents
+FOR EACH ROW
+EXECUTE FUNCTION delete_graph_nodes_for_ref('document');
+
+-- Remove nodes whose message or document was deleted before this migration.
+DELETE FROM graph_nodes n
+WHERE n.ref_type = 'message'
+  AND NOT EXISTS (SELECT 1 FROM conversation_history h WHERE h.id::text = n.ref_id);
+DELETE FROM graph_nodes n
+WHERE n.ref_type = 'document'
+  AND NOT EXISTS (SELECT 1 FROM documents d WHERE d.id::text = n.ref_id);
+
+-- Message nodes used to be labelled with the start of the message content.
+-- Labels now only name the role; the content stays in conversation_history.
+UPDATE graph_nodes
+SET label = CASE WHEN properties->>'role' = 'user' THEN '用户消息' ELSE 'AI 回复' END
+WHERE ref_type = 'message' AND properties->>'kind' = 'chat_message';
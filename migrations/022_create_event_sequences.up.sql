@@ -0,0 +1,14 @@
+-- events.seq comes from a sequence, so it is allocated when a row is inserted
+-- and two concurrent publishes can commit in the opposite order of their seq.
+-- A reader that resumes after the higher seq would then never see the lower
+-- one. Publishing locks the user's row here for the rest of its transaction
+-- before allocating seq, so each user's events commit in seq order and the
+-- "seq > after" cursor used for listing and SSE streams cannot skip events.
+CREATE TABLE IF NOT EXISTS event_sequences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_seq BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO event_sequences (user_id, last_seq)
+SELECT user_id, MAX(seq) FROM events GROUP BY user_id
+ON CONFLICT (user_id) DO NOTHING;
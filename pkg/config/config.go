@@ -3,8 +3,11 @@ package config
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv" // 用于加载 .env 文件
 )
@@ -27,8 +30,91 @@ type Config struct {
 	// 可以根据需要添加更多配置项...
 	// 例如：FrontendURL, VectorDBAddr 等
 	UserAPIKeyEncryptionSecret string // 用于加密用户 API Key 的密钥
+	// 上传文件静态加密 (信封加密) 相关配置
+	FileEncryptionKeys        map[string]string // 主密钥 ID -> 主密钥，为空表示不加密
+	FileEncryptionActiveKeyID string            // 用于包装新文件数据密钥的主密钥 ID
+	// 上传校验相关配置
+	MaxUploadSizeBytes     int64    // 单个上传文件的最大字节数
+	AllowedUploadMIMETypes []string // 允许上传的 MIME 类型 (基于内容嗅探)
+	UserStorageQuotaBytes  int64    // 每个用户的存储配额 (字节)，0 表示不限制
+	// URL 导入相关配置
+	URLFetchAllowPrivateNetworks bool // 是否允许抓取内网/回环地址 (默认禁止以防 SSRF)
+	// 本地目录同步相关配置 (由 Worker 执行，路径是 Worker 主机上的路径)
+	WatchedFolders     []WatchedFolder // 需要同步到文档库的本地目录
+	FolderSyncInterval time.Duration   // 扫描监视目录的周期
+	// OCR 相关配置 (由 Worker 使用，扫描版 PDF 和图片通过 Tesseract 识别文字)
+	OCREnabled    bool          // 是否启用 OCR
+	OCRLanguages  string        // Tesseract 语言包，例如 "eng+chi_sim"
+	OCRMaxPages   int           // 单个 PDF 最多识别的页数
+	OCRTimeout    time.Duration // 单个 OCR 任务的超时时间
+	OCRMaxRetry   int           // OCR 任务的最大重试次数
+	TesseractPath string        // tesseract 可执行文件路径
+	PDFToPPMPath  string        // pdftoppm (poppler-utils) 可执行文件路径，用于将 PDF 渲染为图片
+	PDFToTextPath string        // pdftotext (poppler-utils) 可执行文件路径，用于提取 PDF 文本层
+	// 任务队列相关配置
+	QueueWeightInteractive   int // interactive 队列 (用户直接触发的任务) 的权重
+	QueueWeightBulk          int // bulk 队列 (目录同步、定期重新抓取等批量任务) 的权重
+	QueueMaxDepth            int // 单个队列积压的任务数超过该值时拒绝新的入队请求 (HTTP 429)，0 表示不限制
+	WorkerPerUserConcurrency int // 每个 Worker 进程中同一用户同时执行的任务数上限，0 表示不限制
+	// 管理员配置
+	AdminUserIDs []string // 可以访问 /admin 接口 (例如所有用户的失败任务) 的用户 ID
+	// 定时维护任务 (由 Worker 中的 Asynq Scheduler 触发，每个任务可以单独启用和配置)
+	OrphanFileJob          ScheduledJob  // 删除存储中没有文档引用的文件，标记文件丢失的文档
+	OrphanFileGracePeriod  time.Duration // 只删除修改时间早于该时长的孤立文件 (刚保存的文件可能还没有写入文档记录)
+	TaskRetentionJob       ScheduledJob  // 删除超过保留期的任务记录和失败历史
+	TaskRetention          time.Duration // 已结束任务记录和失败历史的保留时长
+	StaleDocumentJob       ScheduledJob  // 重置长时间停留在 processing 状态的文档
+	StaleProcessingTimeout time.Duration // 文档停留在 processing 状态超过该时长且任务已不在队列中时视为卡住
+	VectorIndexJob         ScheduledJob  // 清理孤立向量块，VACUUM 向量表
+	VectorReindex          bool          // 维护向量表时是否同时重建 IVFFlat 索引 (数据量大时耗时较长)
+	ExpiredUploadJob       ScheduledJob  // 删除已过期的可恢复上传会话及其数据块
+	// 对话消息搜索
+	MessageSemanticSearchEnabled bool // 是否为新消息生成向量以支持语义搜索 (每条消息会调用一次 Embedding API)
+	// 对话导入
+	ConversationImportMaxSizeBytes int64 // 上传的对话导出文件 (例如 ChatGPT 导出) 的最大字节数
+	// 记忆注入
+	MemoryContextTokenBudget     int  // 每次聊天注入提示词的结构化记忆的最大 token 数 (估算值)，0 表示不注入
+	MemoryContextSemanticRanking bool // 记忆超出预算时是否按与消息的向量相似度选择 (否则选择最近更新的记忆)
+	// 记忆自动提取
+	MemoryExtractionMode     string // 聊天后由 LLM 提取用户记忆的方式：MemoryExtractionOff、MemoryExtractionSuggest 或 MemoryExtractionAuto
+	MemoryExtractionInterval int    // 每隔多少条用户消息提取一次记忆 (1 表示每轮交流后都提取)
+	// 图记忆
+	GraphMemoryAutoRecord bool // 是否将每轮交流和处理完成的文档自动记录为图记忆节点
+	// 事件总线
+	EventBusPublishInternal          bool          // 是否将聊天完成、文档处理完成和记忆变化发布为 dreamhub.* 事件
+	EventWebhookMaxRetry             int           // webhook 投递失败后的最大重试次数
+	EventWebhookTimeout              time.Duration // 单次 webhook 请求的超时时间
+	EventWebhookAllowPrivateNetworks bool          // 是否允许向内网/回环地址投递 webhook (默认禁止以防 SSRF)
+	EventStreamPollInterval          time.Duration // SSE 连接检查新事件的间隔
 }
 
+// 记忆自动提取的方式 (MEMORY_EXTRACTION_MODE)。
+const (
+	MemoryExtractionOff     = "off"     // 不自动提取
+	MemoryExtractionSuggest = "suggest" // 提取的记忆作为待确认的建议，由用户批准或拒绝
+	MemoryExtractionAuto    = "auto"    // 提取的记忆直接写入用户的结构化记忆 (手动写入的键除外，改为建议)
+)
+
+// ScheduledJob 描述一个定时维护任务的调度配置。
+type ScheduledJob struct {
+	Enabled  bool   // 是否启用
+	Cronspec string // cron 表达式，例如 "0 3 * * *" 或 "@every 1h"
+}
+
+// WatchedFolder 描述一个需要同步到某个用户文档库的本地目录。
+type WatchedFolder struct {
+	UserID string // 文档所属的用户 ID
+	Path   string // 目录的绝对路径
+}
+
+// FileEncryptionEnabled 返回是否启用了上传文件的静态加密。
+func (c *Config) FileEncryptionEnabled() bool {
+	return len(c.FileEncryptionKeys) > 0
+}
+
+// defaultAllowedUploadMIMETypes 是文本提取器当前支持的文件类型。
+const defaultAllowedUploadMIMETypes = "text/plain,text/markdown,text/csv,text/tab-separated-values,text/html,text/xml,application/xml,application/json,message/rfc822,application/pdf,image/png,image/jpeg,image/tiff"
+
 var (
 	cfg  *Config
 	once sync.Once
@@ -57,6 +143,81 @@ func LoadConfig() *Config {
 			jwtExpirationMinutes = 60
 		}
 
+		maxUploadSizeMB := getEnvInt64("MAX_UPLOAD_SIZE_MB", 50) // 默认 50 MB
+		if maxUploadSizeMB <= 0 {
+			// 0 会拒绝所有上传和网页抓取，视为未配置
+			log.Printf("警告: 无效的 MAX_UPLOAD_SIZE_MB 值 %d，将使用默认值 50。", maxUploadSizeMB)
+			maxUploadSizeMB = 50
+		}
+		conversationImportMaxSizeMB := getEnvInt64("CONVERSATION_IMPORT_MAX_SIZE_MB", 200)
+		memoryContextTokenBudget := getEnvInt64("MEMORY_CONTEXT_TOKEN_BUDGET", 1000)
+		if memoryContextTokenBudget < 0 {
+			memoryContextTokenBudget = 0
+		}
+		memoryExtractionMode := strings.ToLower(getEnv("MEMORY_EXTRACTION_MODE", MemoryExtractionSuggest))
+		switch memoryExtractionMode {
+		case MemoryExtractionOff, MemoryExtractionSuggest, MemoryExtractionAuto:
+		default:
+			log.Printf("警告: 无效的 MEMORY_EXTRACTION_MODE 值 '%s'，将使用默认值 %s。", memoryExtractionMode, MemoryExtractionSuggest)
+			memoryExtractionMode = MemoryExtractionSuggest
+		}
+		memoryExtractionInterval := getEnvInt64("MEMORY_EXTRACTION_INTERVAL", 1)
+		if memoryExtractionInterval < 1 {
+			memoryExtractionInterval = 1
+		}
+		eventWebhookMaxRetry := getEnvInt64("EVENT_WEBHOOK_MAX_RETRY", 8)
+		if eventWebhookMaxRetry < 0 {
+			eventWebhookMaxRetry = 0
+		}
+		eventWebhookTimeoutSeconds := getEnvInt64("EVENT_WEBHOOK_TIMEOUT_SECONDS", 10)
+		if eventWebhookTimeoutSeconds < 1 {
+			eventWebhookTimeoutSeconds = 1
+		} else if eventWebhookTimeoutSeconds > 50 {
+			eventWebhookTimeoutSeconds = 50 // 投递任务的超时为 1 分钟
+		}
+		eventStreamPollIntervalMS := getEnvInt64("EVENT_STREAM_POLL_INTERVAL_MS", 1000)
+		if eventStreamPollIntervalMS < 100 {
+			eventStreamPollIntervalMS = 100
+		}
+		userStorageQuotaMB := getEnvInt64("USER_STORAGE_QUOTA_MB", 1024) // 默认 1 GB
+		folderSyncIntervalSeconds := getEnvInt64("FOLDER_SYNC_INTERVAL_SECONDS", 60)
+		if folderSyncIntervalSeconds < 5 {
+			folderSyncIntervalSeconds = 5 // 避免过于频繁地遍历目录
+		}
+
+		ocrMaxPages := getEnvInt64("OCR_MAX_PAGES", 100)
+		if ocrMaxPages < 1 {
+			ocrMaxPages = 1
+		}
+		ocrTimeoutSeconds := getEnvInt64("OCR_TIMEOUT_SECONDS", 900) // 默认 15 分钟
+		if ocrTimeoutSeconds < 30 {
+			ocrTimeoutSeconds = 30
+		}
+
+		queueWeightInteractive := getEnvInt64("QUEUE_WEIGHT_INTERACTIVE", 6)
+		if queueWeightInteractive < 1 {
+			queueWeightInteractive = 1
+		}
+		queueWeightBulk := getEnvInt64("QUEUE_WEIGHT_BULK", 1)
+		if queueWeightBulk < 1 {
+			queueWeightBulk = 1 // 权重为 0 的队列不会被处理
+		}
+
+		orphanFileGraceHours := getEnvInt64("MAINTENANCE_ORPHAN_FILES_GRACE_HOURS", 24)
+		if orphanFileGraceHours < 1 {
+			orphanFileGraceHours = 1 // 避免删除正在上传的文件
+		}
+		taskRetentionDays := getEnvInt64("MAINTENANCE_TASK_RETENTION_DAYS", 30)
+		if taskRetentionDays < 1 {
+			taskRetentionDays = 1
+		}
+		// 超时必须大于最长的任务执行时间 (OCR 任务的超时)，否则会重置仍在处理中的文档
+		staleProcessingTimeout := time.Duration(getEnvInt64("MAINTENANCE_STALE_DOCUMENTS_TIMEOUT_MINUTES", 60)) * time.Minute
+		if minTimeout := time.Duration(ocrTimeoutSeconds)*time.Second + 15*time.Minute; staleProcessingTimeout < minTimeout {
+			log.Printf("警告: MAINTENANCE_STALE_DOCUMENTS_TIMEOUT_MINUTES 小于 OCR 任务超时，将使用 %v。", minTimeout)
+			staleProcessingTimeout = minTimeout
+		}
+
 		cfg = &Config{
 			ServerPort:    getEnv("SERVER_PORT", "8080"),          // 默认端口 8080
 			DatabaseURL:   getEnv("DATABASE_URL", ""),             // 没有默认值，必须提供
@@ -65,12 +226,54 @@ func LoadConfig() *Config {
 			OpenAIAPIKey:  getEnv("OPENAI_API_KEY", ""),           // 没有默认值，必须提供
 			OpenAIModel:   getEnv("OPENAI_MODEL", ""),             // 新增：加载聊天模型名称，默认为空
 			// OpenAIEmbeddingModel: getEnv("OPENAI_EMBEDDING_MODEL", ""), // TODO: Add if needed
-			UploadDir:                  getEnv("UPLOAD_DIR", "./uploads"), // 默认上传目录
-			LogLevel:                   getEnv("LOG_LEVEL", "info"),       // 默认日志级别 info
-			WorkerConcurrency:          workerConcurrency,
-			JWTSecret:                  getEnv("JWT_SECRET", ""), // 没有默认值，必须提供
-			JWTExpirationMinutes:       jwtExpirationMinutes,
-			UserAPIKeyEncryptionSecret: getEnv("USER_API_KEY_ENCRYPTION_SECRET", ""), // 没有默认值，必须提供
+			UploadDir:                        getEnv("UPLOAD_DIR", "./uploads"), // 默认上传目录
+			LogLevel:                         getEnv("LOG_LEVEL", "info"),       // 默认日志级别 info
+			WorkerConcurrency:                workerConcurrency,
+			JWTSecret:                        getEnv("JWT_SECRET", ""), // 没有默认值，必须提供
+			JWTExpirationMinutes:             jwtExpirationMinutes,
+			UserAPIKeyEncryptionSecret:       getEnv("USER_API_KEY_ENCRYPTION_SECRET", ""),     // 没有默认值，必须提供
+			FileEncryptionKeys:               parseKeyRing(getEnv("FILE_ENCRYPTION_KEYS", "")), // 格式: id1:secret1,id2:secret2
+			FileEncryptionActiveKeyID:        getEnv("FILE_ENCRYPTION_ACTIVE_KEY_ID", ""),
+			MaxUploadSizeBytes:               maxUploadSizeMB << 20,
+			AllowedUploadMIMETypes:           parseList(getEnv("ALLOWED_UPLOAD_MIME_TYPES", defaultAllowedUploadMIMETypes)),
+			UserStorageQuotaBytes:            userStorageQuotaMB << 20,
+			URLFetchAllowPrivateNetworks:     getEnvBool("URL_FETCH_ALLOW_PRIVATE_NETWORKS", false),
+			WatchedFolders:                   parseWatchedFolders(getEnv("WATCHED_FOLDERS", "")), // 格式: user_id:/abs/path,user_id:/other/path
+			FolderSyncInterval:               time.Duration(folderSyncIntervalSeconds) * time.Second,
+			OCREnabled:                       getEnvBool("OCR_ENABLED", true),
+			OCRLanguages:                     getEnv("OCR_LANGUAGES", "eng"),
+			OCRMaxPages:                      int(ocrMaxPages),
+			OCRTimeout:                       time.Duration(ocrTimeoutSeconds) * time.Second,
+			OCRMaxRetry:                      int(getEnvInt64("OCR_MAX_RETRY", 2)),
+			TesseractPath:                    getEnv("TESSERACT_PATH", "tesseract"),
+			PDFToPPMPath:                     getEnv("PDFTOPPM_PATH", "pdftoppm"),
+			PDFToTextPath:                    getEnv("PDFTOTEXT_PATH", "pdftotext"),
+			QueueWeightInteractive:           int(queueWeightInteractive),
+			QueueWeightBulk:                  int(queueWeightBulk),
+			QueueMaxDepth:                    int(getEnvInt64("QUEUE_MAX_DEPTH", 10000)),
+			WorkerPerUserConcurrency:         int(getEnvInt64("WORKER_PER_USER_CONCURRENCY", 3)),
+			AdminUserIDs:                     parseList(getEnv("ADMIN_USER_IDS", "")),
+			OrphanFileJob:                    getScheduledJob("MAINTENANCE_ORPHAN_FILES", "0 3 * * *"),
+			OrphanFileGracePeriod:            time.Duration(orphanFileGraceHours) * time.Hour,
+			TaskRetentionJob:                 getScheduledJob("MAINTENANCE_TASK_RETENTION", "30 3 * * *"),
+			TaskRetention:                    time.Duration(taskRetentionDays) * 24 * time.Hour,
+			StaleDocumentJob:                 getScheduledJob("MAINTENANCE_STALE_DOCUMENTS", "*/15 * * * *"),
+			StaleProcessingTimeout:           staleProcessingTimeout,
+			VectorIndexJob:                   getScheduledJob("MAINTENANCE_VECTOR_INDEX", "0 4 * * 0"),
+			VectorReindex:                    getEnvBool("MAINTENANCE_VECTOR_REINDEX", false),
+			ExpiredUploadJob:                 getScheduledJob("MAINTENANCE_EXPIRED_UPLOADS", "0 * * * *"),
+			MessageSemanticSearchEnabled:     getEnvBool("MESSAGE_SEMANTIC_SEARCH_ENABLED", false),
+			ConversationImportMaxSizeBytes:   conversationImportMaxSizeMB << 20,
+			MemoryContextTokenBudget:         int(memoryContextTokenBudget),
+			MemoryContextSemanticRanking:     getEnvBool("MEMORY_CONTEXT_SEMANTIC_RANKING", true),
+			MemoryExtractionMode:             memoryExtractionMode,
+			MemoryExtractionInterval:         int(memoryExtractionInterval),
+			GraphMemoryAutoRecord:            getEnvBool("GRAPH_MEMORY_AUTO_RECORD", true),
+			EventBusPublishInternal:          getEnvBool("EVENT_BUS_PUBLISH_INTERNAL", true),
+			EventWebhookMaxRetry:             int(eventWebhookMaxRetry),
+			EventWebhookTimeout:              time.Duration(eventWebhookTimeoutSeconds) * time.Second,
+			EventWebhookAllowPrivateNetworks: getEnvBool("EVENT_WEBHOOK_ALLOW_PRIVATE_NETWORKS", false),
+			EventStreamPollInterval:          time.Duration(eventStreamPollIntervalMS) * time.Millisecond,
 		}
 
 		// 可以在这里添加对必要配置项的检查
@@ -89,6 +292,17 @@ func LoadConfig() *Config {
 		if cfg.UserAPIKeyEncryptionSecret == "" {
 			log.Fatal("错误: 环境变量 USER_API_KEY_ENCRYPTION_SECRET 未设置。这是加密用户 API Key 所必需的。")
 		}
+		if cfg.FileEncryptionEnabled() {
+			if cfg.FileEncryptionActiveKeyID == "" && len(cfg.FileEncryptionKeys) == 1 {
+				// 只配置了一个主密钥时默认使用它
+				for keyID := range cfg.FileEncryptionKeys {
+					cfg.FileEncryptionActiveKeyID = keyID
+				}
+			}
+			if _, ok := cfg.FileEncryptionKeys[cfg.FileEncryptionActiveKeyID]; !ok {
+				log.Fatalf("错误: FILE_ENCRYPTION_ACTIVE_KEY_ID '%s' 不在 FILE_ENCRYPTION_KEYS 中。", cfg.FileEncryptionActiveKeyID)
+			}
+		}
 	})
 	return cfg
 }
@@ -110,3 +324,86 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// parseKeyRing 解析 "id1:secret1,id2:secret2" 格式的主密钥列表。
+// 格式错误的条目会被忽略并记录警告。
+func parseKeyRing(value string) map[string]string {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		keyID, secret, ok := strings.Cut(entry, ":")
+		keyID = strings.TrimSpace(keyID)
+		if !ok || keyID == "" || secret == "" {
+			log.Printf("警告: 忽略格式无效的 FILE_ENCRYPTION_KEYS 条目 (应为 id:secret)。")
+			continue
+		}
+		keys[keyID] = secret
+	}
+	return keys
+}
+
+// parseWatchedFolders 解析 "user_id:/abs/path,user_id:/other/path" 格式的监视目录列表。
+// 格式错误或不是绝对路径的条目会被忽略并记录警告。
+func parseWatchedFolders(value string) []WatchedFolder {
+	folders := make([]WatchedFolder, 0)
+	for _, entry := range parseList(value) {
+		userID, path, ok := strings.Cut(entry, ":")
+		userID, path = strings.TrimSpace(userID), strings.TrimSpace(path)
+		if !ok || userID == "" || !filepath.IsAbs(path) {
+			log.Printf("警告: 忽略格式无效的 WATCHED_FOLDERS 条目 '%s' (应为 user_id:/绝对路径)。", entry)
+			continue
+		}
+		folders = append(folders, WatchedFolder{UserID: userID, Path: filepath.Clean(path)})
+	}
+	return folders
+}
+
+// getEnvInt64 获取非负整数类型的环境变量，无效时记录警告并返回默认值。
+func getEnvInt64(key string, defaultValue int64) int64 {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseInt(valueStr, 10, 64)
+	if err != nil || value < 0 {
+		log.Printf("警告: 无效的 %s 值 '%s'，将使用默认值 %d。", key, valueStr, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool 获取布尔类型的环境变量，无效时记录警告并返回默认值。
+func getEnvBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		log.Printf("警告: 无效的 %s 值 '%s'，将使用默认值 %t。", key, valueStr, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// parseList 解析逗号分隔的列表，忽略空白条目。
+func parseList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getScheduledJob 读取 <prefix>_ENABLED (默认启用) 和 <prefix>_CRON 环境变量。
+func getScheduledJob(prefix string, defaultCronspec string) ScheduledJob {
+	return ScheduledJob{
+		Enabled:  getEnvBool(prefix+"_ENABLED", true),
+		Cronspec: getEnv(prefix+"_CRON", defaultCronspec),
+	}
+}